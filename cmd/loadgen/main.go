@@ -0,0 +1,356 @@
+// Command loadgen drives the wallet API with concurrent deposits, withdrawals
+// and reads, reports latency percentiles and error rates, and then checks
+// that every wallet balance moved by exactly the sum of accepted operations.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db"
+	"github.com/kuzmindeniss/itk/internal/handler"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+// Exit codes match cmd/reconcile: 1 when a balance does not add up, 2 on
+// errors. 3 is a mismatch that writes without a response may explain.
+const (
+	exitMismatch     = 1
+	exitError        = 2
+	exitInconclusive = 3
+)
+
+// outcome is the result of the final balance check.
+type outcome int
+
+const (
+	checkPassed outcome = iota
+	checkFailed
+	checkInconclusive
+)
+
+const defaultWallets = "8e3449a8-5cbc-4159-a8e2-45eea1eebdb1,8e3449a8-5cbc-4159-a8e2-45eea1eebdb2"
+
+type options struct {
+	url         string
+	apiKey      string
+	wallets     []uuid.UUID
+	concurrency int
+	rps         int
+	duration    time.Duration
+	timeout     time.Duration
+	workload    *workload
+}
+
+func main() {
+	opts, err := parseFlags()
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	result, err := run(context.Background(), opts, os.Stdout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	switch result {
+	case checkFailed:
+		os.Exit(exitMismatch)
+	case checkInconclusive:
+		os.Exit(exitInconclusive)
+	}
+}
+
+func parseFlags() (*options, error) {
+	url := flag.String("url", "http://localhost:8090", "base URL of the wallet API")
+	apiKey := flag.String("api-key", os.Getenv("WALLET_API_KEY"), "API key of the tenant owning the wallets; defaults to $WALLET_API_KEY")
+	walletList := flag.String("wallets", defaultWallets, "comma-separated IDs of existing wallets to load")
+	concurrency := flag.Int("concurrency", 64, "number of concurrent connections")
+	rps := flag.Int("rps", 1000, "target requests per second; 0 sends as fast as the workers allow")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	mixFlag := flag.String("mix", "deposit:45,withdraw:5,get:50", "relative weights of deposit, withdraw and get")
+	dist := flag.String("dist", distHot, "wallet distribution: uniform, zipf or hot (all requests to the first wallet)")
+	zipfS := flag.Float64("zipf-s", 1.2, "zipf exponent, greater than 1; higher is more skewed")
+	maxAmount := flag.Int("max-amount", 100, "amounts are uniform between 1 and this")
+	timeout := flag.Duration("timeout", 5*time.Second, "per-request timeout")
+	seed := flag.Uint64("seed", uint64(time.Now().UnixNano()), "random seed")
+	flag.Parse()
+
+	var wallets []uuid.UUID
+	for _, s := range strings.Split(*walletList, ",") {
+		id, err := uuid.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid wallet ID %q", s)
+		}
+		wallets = append(wallets, id)
+	}
+
+	if *apiKey == "" {
+		return nil, errors.New("api-key is required")
+	}
+
+	if *concurrency < 1 || *rps < 0 || *duration <= 0 || *maxAmount < 1 {
+		return nil, errors.New("concurrency, duration and max-amount must be positive and rps not negative")
+	}
+
+	m, err := parseMix(*mixFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	r := rand.New(rand.NewPCG(*seed, *seed))
+
+	pick, err := newWalletPicker(*dist, len(wallets), *zipfS, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &options{
+		url:         strings.TrimSuffix(*url, "/"),
+		apiKey:      *apiKey,
+		wallets:     wallets,
+		concurrency: *concurrency,
+		rps:         *rps,
+		duration:    *duration,
+		timeout:     *timeout,
+		workload: &workload{
+			wallets:   wallets,
+			mix:       m,
+			pick:      pick,
+			maxAmount: int32(*maxAmount),
+			rand:      r,
+		},
+	}, nil
+}
+
+func run(ctx context.Context, opts *options, out io.Writer) (outcome, error) {
+	c := &client{
+		http: &http.Client{
+			Timeout:   opts.timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: opts.concurrency},
+		},
+		url:    opts.url,
+		apiKey: opts.apiKey,
+	}
+
+	initial := make(map[uuid.UUID]int64, len(opts.wallets))
+	for _, id := range opts.wallets {
+		balance, err := c.balance(ctx, id)
+		if err != nil {
+			return checkFailed, fmt.Errorf("failed to read initial balance of %s: %w", id, err)
+		}
+		initial[id] = balance
+	}
+
+	log.Printf("loading %d wallets for %s with %d workers at %s", len(opts.wallets), opts.duration, opts.concurrency, rateString(opts.rps))
+
+	stats := newCollector()
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				status := c.do(ctx, j)
+				stats.record(j, status, time.Since(j.scheduled))
+			}
+		}()
+	}
+
+	start := time.Now()
+	generate(opts, start, jobs)
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	stats.report(out, elapsed)
+
+	return verify(ctx, c, initial, stats, out)
+}
+
+// generate feeds jobs until the duration is over. With a target rate, jobs
+// are scheduled at fixed intervals whether or not workers keep up.
+func generate(opts *options, start time.Time, jobs chan<- job) {
+	end := start.Add(opts.duration)
+
+	if opts.rps == 0 {
+		for time.Now().Before(end) {
+			jobs <- opts.workload.next(time.Now())
+		}
+		return
+	}
+
+	interval := time.Second / time.Duration(opts.rps)
+	for i := 0; ; i++ {
+		scheduled := start.Add(time.Duration(i) * interval)
+		if !scheduled.Before(end) {
+			return
+		}
+
+		time.Sleep(time.Until(scheduled))
+		jobs <- opts.workload.next(scheduled)
+	}
+}
+
+// verify compares the final balances with the initial ones plus the amounts
+// the API accepted. Other clients writing to the same wallets break it.
+func verify(ctx context.Context, c *client, initial map[uuid.UUID]int64, stats *collector, out io.Writer) (outcome, error) {
+	ok := true
+
+	for id, before := range initial {
+		after, err := c.balance(ctx, id)
+		if err != nil {
+			return checkFailed, fmt.Errorf("failed to read final balance of %s: %w", id, err)
+		}
+
+		expected := before + stats.applied[id]
+		if after != expected {
+			ok = false
+			fmt.Fprintf(out, "MISMATCH %s: balance %d, expected %d (%d %+d)\n", id, after, expected, before, stats.applied[id])
+		}
+	}
+
+	switch {
+	case ok:
+		fmt.Fprintf(out, "balance check passed for %d wallets\n", len(initial))
+		return checkPassed, nil
+	case stats.unknown > 0:
+		fmt.Fprintf(out, "balance check inconclusive: %d writes failed without a response and may have been applied\n", stats.unknown)
+		return checkInconclusive, nil
+	default:
+		fmt.Fprintln(out, "balance check FAILED")
+		return checkFailed, nil
+	}
+}
+
+func rateString(rps int) string {
+	if rps == 0 {
+		return "max rate"
+	}
+	return fmt.Sprintf("%d rps", rps)
+}
+
+type client struct {
+	http   *http.Client
+	url    string
+	apiKey string
+
+	// token is the newest read-your-writes token seen, so the final balance
+	// check is not served by a lagging replica.
+	mu    sync.Mutex
+	token db.LSN
+}
+
+// do sends the request of j and returns the response status, or 0 when
+// there was no response.
+func (c *client) do(ctx context.Context, j job) int {
+	var req *http.Request
+	var err error
+
+	switch j.op {
+	case opGet:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/api/v1/wallets/"+j.walletID.String(), nil)
+	default:
+		body := handler.UpdateBalanceRequest{
+			Amount:        j.amount,
+			WalletID:      j.walletID.String(),
+			OperationType: models.OperationDeposit,
+		}
+		if j.op == opWithdraw {
+			body.OperationType = models.OperationWithdraw
+		}
+
+		payload, _ := json.Marshal(body)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/api/v1/wallet", bytes.NewReader(payload))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return 0
+	}
+	c.authorize(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection is reused.
+	io.Copy(io.Discard, resp.Body)
+
+	c.observeToken(resp.Header.Get(handler.ConsistencyTokenHeader))
+
+	return resp.StatusCode
+}
+
+func (c *client) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+}
+
+func (c *client) observeToken(token string) {
+	if token == "" {
+		return
+	}
+
+	lsn, err := db.ParseLSN(token)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.token = max(c.token, lsn)
+	c.mu.Unlock()
+}
+
+func (c *client) balance(ctx context.Context, id uuid.UUID) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/api/v1/wallets/"+id.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	c.authorize(req)
+
+	c.mu.Lock()
+	if c.token != 0 {
+		req.Header.Set(handler.ConsistencyTokenHeader, c.token.String())
+	}
+	c.mu.Unlock()
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var wallet struct {
+		Balance int64 `json:"balance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&wallet); err != nil {
+		return 0, err
+	}
+
+	return wallet.Balance, nil
+}
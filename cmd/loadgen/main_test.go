@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	wallet := uuid.New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer itk_key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"balance": 120}`)
+	}))
+	defer server.Close()
+
+	c := &client{http: server.Client(), url: server.URL, apiKey: "itk_key"}
+	initial := map[uuid.UUID]int64{wallet: 100}
+
+	testCases := []struct {
+		name    string
+		applied int64
+		unknown int
+		want    outcome
+	}{
+		{"balance adds up", 20, 0, checkPassed},
+		{"balance adds up despite unknown writes", 20, 2, checkPassed},
+		{"mismatch", 10, 0, checkFailed},
+		{"mismatch with unknown writes", 10, 1, checkInconclusive},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := newCollector()
+			stats.applied[wallet] = tc.applied
+			stats.unknown = tc.unknown
+
+			got, err := verify(context.Background(), c, initial, stats, io.Discard)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
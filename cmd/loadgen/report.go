@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// opStats collects the outcomes of one kind of operation.
+type opStats struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	// failures are requests without an HTTP response.
+	failures int
+}
+
+type collector struct {
+	mu    sync.Mutex
+	stats [numOps]opStats
+	// applied is the net amount of the balance changes the API accepted.
+	applied map[uuid.UUID]int64
+	// unknown counts writes whose outcome is unknown, e.g. timeouts.
+	unknown int
+}
+
+func newCollector() *collector {
+	c := &collector{applied: make(map[uuid.UUID]int64)}
+	for k := range c.stats {
+		c.stats[k].statuses = make(map[int]int)
+	}
+	return c
+}
+
+// record stores the result of a request; status is 0 when it failed without
+// a response.
+func (c *collector) record(j job, status int, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &c.stats[j.op]
+	s.latencies = append(s.latencies, latency)
+
+	if status == 0 {
+		s.failures++
+		if j.op != opGet {
+			c.unknown++
+		}
+		return
+	}
+
+	s.statuses[status]++
+
+	if status == 200 {
+		switch j.op {
+		case opDeposit:
+			c.applied[j.walletID] += int64(j.amount)
+		case opWithdraw:
+			c.applied[j.walletID] -= int64(j.amount)
+		}
+	}
+}
+
+func (c *collector) report(w io.Writer, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "OP\tREQUESTS\tRPS\tP50\tP90\tP99\tMAX\tERRORS\tERROR RATE\tSTATUSES\t")
+
+	for k := range c.stats {
+		s := &c.stats[k]
+		total := len(s.latencies)
+		if total == 0 {
+			continue
+		}
+
+		slices.Sort(s.latencies)
+
+		errs := s.failures
+		for status, n := range s.statuses {
+			if status >= 500 {
+				errs += n
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%s\t%s\t%s\t%s\t%d\t%.2f%%\t%s\t\n",
+			opKind(k), total, float64(total)/elapsed.Seconds(),
+			percentile(s.latencies, 50), percentile(s.latencies, 90), percentile(s.latencies, 99), s.latencies[total-1].Round(time.Microsecond),
+			errs, 100*float64(errs)/float64(total), formatStatuses(s.statuses, s.failures))
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p + 99) / 100
+	return sorted[max(rank-1, 0)].Round(time.Microsecond)
+}
+
+func formatStatuses(statuses map[int]int, failures int) string {
+	codes := slices.Sorted(maps.Keys(statuses))
+
+	out := ""
+	for _, code := range codes {
+		out += fmt.Sprintf("%d=%d ", code, statuses[code])
+	}
+	if failures > 0 {
+		out += fmt.Sprintf("failed=%d ", failures)
+	}
+
+	return out
+}
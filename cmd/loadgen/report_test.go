@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector_Record(t *testing.T) {
+	c := newCollector()
+	wallet := uuid.New()
+
+	c.record(job{op: opDeposit, walletID: wallet, amount: 30}, 200, time.Millisecond)
+	c.record(job{op: opWithdraw, walletID: wallet, amount: 10}, 200, time.Millisecond)
+	c.record(job{op: opWithdraw, walletID: wallet, amount: 50}, 422, time.Millisecond)
+	c.record(job{op: opDeposit, walletID: wallet, amount: 7}, 0, time.Millisecond)
+	c.record(job{op: opGet, walletID: wallet}, 0, time.Millisecond)
+
+	assert.Equal(t, int64(20), c.applied[wallet], "only accepted changes count")
+	assert.Equal(t, 1, c.unknown, "a failed read does not make the check inconclusive")
+	assert.Equal(t, 1, c.stats[opDeposit].failures)
+	assert.Equal(t, map[int]int{200: 1, 422: 1}, c.stats[opWithdraw].statuses)
+}
+
+func TestCollector_Report(t *testing.T) {
+	c := newCollector()
+	wallet := uuid.New()
+
+	for i := range 100 {
+		c.record(job{op: opGet, walletID: wallet}, 200, time.Duration(i+1)*time.Millisecond)
+	}
+	c.record(job{op: opDeposit, walletID: wallet, amount: 1}, 500, time.Millisecond)
+	c.record(job{op: opDeposit, walletID: wallet, amount: 1}, 0, time.Millisecond)
+
+	var out bytes.Buffer
+	c.report(&out, time.Second)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3, "operations without requests are left out")
+	assert.Equal(t, []string{"deposit", "2", "2", "1ms", "1ms", "1ms", "1ms", "2", "100.00%", "500=1", "failed=1"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"get", "100", "100", "50ms", "90ms", "99ms", "100ms", "0", "0.00%", "200=100"}, strings.Fields(lines[2]))
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 10)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 5*time.Millisecond, percentile(latencies, 50))
+	assert.Equal(t, 9*time.Millisecond, percentile(latencies, 90))
+	assert.Equal(t, 10*time.Millisecond, percentile(latencies, 99))
+}
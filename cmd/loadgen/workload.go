@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type opKind int
+
+const (
+	opDeposit opKind = iota
+	opWithdraw
+	opGet
+	numOps
+)
+
+var opNames = [numOps]string{"deposit", "withdraw", "get"}
+
+func (k opKind) String() string {
+	return opNames[k]
+}
+
+// mix holds the relative weights of the operations.
+type mix [numOps]int
+
+// parseMix parses weights like "deposit:45,withdraw:5,get:50".
+func parseMix(s string) (mix, error) {
+	var m mix
+
+	for _, part := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return mix{}, fmt.Errorf("invalid mix entry %q: expected name:weight", part)
+		}
+
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return mix{}, fmt.Errorf("invalid weight in mix entry %q", part)
+		}
+
+		kind := -1
+		for k, n := range opNames {
+			if n == name {
+				kind = k
+			}
+		}
+		if kind < 0 {
+			return mix{}, fmt.Errorf("unknown operation %q in mix: expected deposit, withdraw or get", name)
+		}
+
+		m[kind] = w
+	}
+
+	if m[opDeposit]+m[opWithdraw]+m[opGet] == 0 {
+		return mix{}, fmt.Errorf("mix %q has no operations", s)
+	}
+
+	return m, nil
+}
+
+func (m mix) pick(r *rand.Rand) opKind {
+	n := r.IntN(m[opDeposit] + m[opWithdraw] + m[opGet])
+	for k, w := range m {
+		if n < w {
+			return opKind(k)
+		}
+		n -= w
+	}
+	panic("unreachable")
+}
+
+const (
+	distUniform = "uniform"
+	distZipf    = "zipf"
+	distHot     = "hot"
+)
+
+// walletPicker returns the index of the wallet the next request targets.
+type walletPicker func() int
+
+func newWalletPicker(dist string, wallets int, zipfS float64, r *rand.Rand) (walletPicker, error) {
+	switch dist {
+	case distUniform:
+		return func() int { return r.IntN(wallets) }, nil
+	case distZipf:
+		if zipfS <= 1 {
+			return nil, fmt.Errorf("zipf exponent must be greater than 1, got %v", zipfS)
+		}
+		z := rand.NewZipf(r, zipfS, 1, uint64(wallets-1))
+		return func() int { return int(z.Uint64()) }, nil
+	case distHot:
+		return func() int { return 0 }, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %q: expected %s, %s or %s", dist, distUniform, distZipf, distHot)
+	}
+}
+
+type job struct {
+	op       opKind
+	walletID uuid.UUID
+	amount   int32
+	// scheduled is when the request was due. Latency is measured from it, so
+	// a stalled server is not hidden by workers that wait for it.
+	scheduled time.Time
+}
+
+type workload struct {
+	wallets   []uuid.UUID
+	mix       mix
+	pick      walletPicker
+	maxAmount int32
+	rand      *rand.Rand
+}
+
+func (w *workload) next(scheduled time.Time) job {
+	return job{
+		op:        w.mix.pick(w.rand),
+		walletID:  w.wallets[w.pick()],
+		amount:    1 + w.rand.Int32N(w.maxAmount),
+		scheduled: scheduled,
+	}
+}
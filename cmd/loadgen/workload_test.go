@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMix(t *testing.T) {
+	m, err := parseMix("deposit:45, withdraw:5,get:50")
+	require.NoError(t, err)
+	assert.Equal(t, mix{45, 5, 50}, m)
+
+	m, err = parseMix("get:1")
+	require.NoError(t, err)
+	assert.Equal(t, mix{0, 0, 1}, m)
+
+	for _, s := range []string{"", "deposit", "deposit:x", "deposit:-1", "transfer:1", "deposit:0,get:0"} {
+		_, err := parseMix(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMix_Pick(t *testing.T) {
+	m := mix{3, 0, 1}
+	r := rand.New(rand.NewPCG(1, 1))
+
+	const picks = 40000
+	var counts [numOps]int
+	for range picks {
+		counts[m.pick(r)]++
+	}
+
+	assert.Zero(t, counts[opWithdraw], "an operation without weight is never picked")
+	assert.InDelta(t, 0.75, float64(counts[opDeposit])/picks, 0.02)
+	assert.InDelta(t, 0.25, float64(counts[opGet])/picks, 0.02)
+}
+
+func TestNewWalletPicker(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+
+	hot, err := newWalletPicker(distHot, 5, 0, r)
+	require.NoError(t, err)
+
+	uniform, err := newWalletPicker(distUniform, 5, 0, r)
+	require.NoError(t, err)
+
+	zipf, err := newWalletPicker(distZipf, 5, 1.2, r)
+	require.NoError(t, err)
+
+	var zipfCounts [5]int
+	for range 1000 {
+		assert.Equal(t, 0, hot())
+		assert.True(t, uniform() >= 0 && uniform() < 5)
+		zipfCounts[zipf()]++
+	}
+	assert.Greater(t, zipfCounts[0], zipfCounts[4], "zipf favours the first wallets")
+
+	_, err = newWalletPicker(distZipf, 5, 1, r)
+	assert.Error(t, err)
+
+	_, err = newWalletPicker("normal", 5, 0, r)
+	assert.Error(t, err)
+}
+
+func TestWorkload_Next(t *testing.T) {
+	wallets := []uuid.UUID{uuid.New(), uuid.New()}
+	r := rand.New(rand.NewPCG(1, 1))
+	w := &workload{
+		wallets:   wallets,
+		mix:       mix{1, 1, 0},
+		pick:      func() int { return 1 },
+		maxAmount: 10,
+		rand:      r,
+	}
+
+	scheduled := time.Now()
+	for range 1000 {
+		j := w.next(scheduled)
+		assert.NotEqual(t, opGet, j.op)
+		assert.Equal(t, wallets[1], j.walletID)
+		assert.True(t, j.amount >= 1 && j.amount <= 10, "amount %d", j.amount)
+		assert.Equal(t, scheduled, j.scheduled)
+	}
+}
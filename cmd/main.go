@@ -1,37 +1,275 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
+	"github.com/google/uuid"
 	"github.com/kuzmindeniss/itk/internal/config"
 	"github.com/kuzmindeniss/itk/internal/db"
-	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
 	"github.com/kuzmindeniss/itk/internal/handler"
 	"github.com/kuzmindeniss/itk/internal/router"
 	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/pressly/goose/v3"
 )
 
+const usage = `usage: main [command]
+
+commands:
+  serve [--storage=postgres|memory]       run the HTTP API (default)
+  migrate up|down|status|redo|version     manage schema migrations
+  seed                                    insert test wallets (development and test only)`
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := db.RunMigrations(cfg); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	command, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		err = serve(cfg, args)
+	case "migrate":
+		err = migrate(cfg, args)
+	case "seed":
+		err = seed(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	pool, err := db.Connect(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer pool.Close()
+}
+
+func serve(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	storage := flags.String("storage", "postgres", "wallet storage: postgres, or memory for demos without a database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch *storage {
+	case "postgres":
+		return servePostgres(cfg)
+	case "memory":
+		return serveMemory(cfg)
+	default:
+		return fmt.Errorf("unknown storage %q\n\n%s", *storage, usage)
+	}
+}
+
+func servePostgres(cfg *config.Config) error {
+	if cfg.RunMigrations {
+		if err := db.RunMigrations(cfg); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
+	pools, err := db.Connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer pools.Close()
+
+	store := db.NewStore(pools.Primary, pools.Replicas...)
+	walletService := service.NewWalletService(store, serviceOptions(cfg)...)
+
+	// Notifications keep the cache fresh and drive balance streams, including
+	// for changes made by other instances.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go db.ListenWalletChanges(ctx, pools.Primary, walletService)
+
+	var handlerOpts []handler.Option
+	if len(pools.Replicas) > 0 {
+		handlerOpts = append(handlerOpts, handler.WithConsistencyTokens(store))
+	}
+
+	return run(cfg, walletService, handlerOpts...)
+}
+
+// serveMemory keeps wallets in process memory; they are lost on exit.
+func serveMemory(cfg *config.Config) error {
+	store := memory.NewStore()
+	if cfg.SeedsAllowed() {
+		for _, id := range seedWalletIDs {
+			store.AddWallet(id)
+		}
+	}
+	if cfg.FeesEnabled {
+		store.AddWallet(cfg.FeeWalletID)
+	}
+
+	log.Print("using in-memory storage: wallets are lost on exit")
+
+	walletService := service.NewWalletService(store, serviceOptions(cfg)...)
+	if cfg.SeedsAllowed() {
+		// There is no walletctl for a store in memory to issue keys with.
+		key, err := walletService.IssueTenantKey(context.Background(), service.DefaultTenantID)
+		if err != nil {
+			return err
+		}
+		log.Printf("API key of the default tenant: %s", key)
+	}
+
+	return run(cfg, walletService)
+}
+
+// seedWalletIDs match the wallets of the seed migration.
+var seedWalletIDs = []uuid.UUID{
+	uuid.MustParse("8e3449a8-5cbc-4159-a8e2-45eea1eebdb1"),
+	uuid.MustParse("8e3449a8-5cbc-4159-a8e2-45eea1eebdb2"),
+}
 
-	repo := repository.New(pool)
-	walletService := service.NewWalletService(repo)
-	walletHandler := handler.NewWalletHandler(walletService)
+func serviceOptions(cfg *config.Config) []service.Option {
+	opts := []service.Option{
+		service.WithInterestConventions(cfg.InterestDayCount, cfg.InterestRounding),
+		service.WithExchange(cfg.ExchangeQuoteTTL, int32(cfg.ExchangeSpreadBps), cfg.ExchangeRounding),
+	}
+	if cfg.BatchingEnabled {
+		opts = append(opts, service.WithBatching(cfg.BatchMaxSize))
+	}
+
+	if cfg.CacheEnabled {
+		opts = append(opts, service.WithCache(cfg.CacheTTL, cfg.CacheSize))
+	}
 
-	r := router.SetupRouter(walletHandler)
+	if cfg.FeesEnabled {
+		opts = append(opts, service.WithFees(cfg.FeeWalletID))
+	}
+
+	return opts
+}
+
+func run(cfg *config.Config, walletService *service.WalletService, handlerOpts ...handler.Option) error {
+	if cfg.FeesEnabled {
+		// Tenants neither see the fee wallet nor move the fees in it.
+		if err := walletService.MarkSystemWallet(context.Background(), cfg.FeeWalletID); err != nil {
+			return fmt.Errorf("fee wallet %s: %w", cfg.FeeWalletID, err)
+		}
+	}
+
+	if cfg.CacheEnabled {
+		expvar.Publish("wallet_cache", expvar.Func(func() any {
+			stats, _ := walletService.CacheStats()
+			return stats
+		}))
+	}
+
+	if cfg.DebugAddr != "" {
+		go func() {
+			if err := router.SetupDebugRouter().Run(cfg.DebugAddr); err != nil {
+				log.Printf("debug listener stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.SchedulerEnabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go walletService.RunScheduler(ctx, cfg.SchedulerInterval)
+	}
+
+	if cfg.InterestEnabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go walletService.RunInterest(ctx, cfg.InterestInterval)
+	}
+
+	importCtx, cancelImports := context.WithCancel(context.Background())
+	defer cancelImports()
+
+	go walletService.RunImportRecovery(importCtx, cfg.ImportRecoveryInterval)
+
+	handlerOpts = append(handlerOpts,
+		handler.WithStreaming(cfg.StreamHeartbeat, cfg.StreamMaxPerClient),
+		handler.WithAmountLimits(cfg.MaxDepositAmount, cfg.MaxWithdrawAmount),
+	)
+
+	walletHandler := handler.NewWalletHandler(walletService, handlerOpts...)
+	scheduleHandler := handler.NewScheduleHandler(walletService)
+	interestHandler := handler.NewInterestHandler(walletService)
+	feeHandler := handler.NewFeeHandler(walletService)
+	importHandler := handler.NewImportHandler(walletService, cfg.ImportMaxRows)
+	auditHandler := handler.NewAuditHandler(walletService)
+	exchangeHandler := handler.NewExchangeHandler(walletService)
+
+	r := router.SetupRouter(walletHandler, scheduleHandler, interestHandler, feeHandler, importHandler, auditHandler, exchangeHandler, walletService, cfg.AdminAPIKey)
+	// The client IP in the audit log and the stream limits comes from
+	// X-Forwarded-For only when a trusted proxy sent it.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	return r.Run(":" + cfg.AppPort)
+}
+
+func migrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one migrate command\n\n%s", usage)
+	}
+
+	migrator, err := db.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "Pending"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", appliedAt, s.Source.Path)
+		}
+		return nil
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(version)
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], usage)
+	}
+}
+
+func seed(cfg *config.Config) error {
+	migrator, err := db.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
 
-	r.Run(":" + cfg.AppPort)
+	return migrator.Seed(context.Background())
 }
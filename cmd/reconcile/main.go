@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kuzmindeniss/itk/internal/config"
+	"github.com/kuzmindeniss/itk/internal/db"
+	"github.com/kuzmindeniss/itk/internal/reconcile"
+)
+
+// Exit codes follow diff(1): 0 when the ledger matches, 1 when discrepancies
+// were found (and not repaired), 2 on errors.
+const (
+	exitMismatch = 1
+	exitError    = 2
+)
+
+func main() {
+	format := flag.String("format", reconcile.FormatJSON, "output format: json or csv")
+	repair := flag.Bool("repair", false, "record a compensating ADJUSTMENT operation for every mismatch")
+	pageSize := flag.Int("page-size", reconcile.DefaultPageSize, "number of wallets fetched per query")
+	flag.Parse()
+
+	writer, err := reconcile.NewWriter(*format, os.Stdout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	pools, err := db.Connect(cfg)
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+	defer pools.Close()
+
+	reconciler := reconcile.NewReconciler(reconcile.NewStore(pools.Primary), int32(*pageSize))
+
+	summary, err := reconciler.Run(context.Background(), *repair, writer.Write)
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Print(err)
+		pools.Close()
+		os.Exit(exitError)
+	}
+
+	log.Printf("checked %d wallets: %d mismatched, %d repaired", summary.Checked, summary.Mismatched, summary.Repaired)
+
+	if summary.Mismatched > summary.Repaired {
+		pools.Close()
+		os.Exit(exitMismatch)
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+const exportPageSize = 1000
+
+var getCommand = command{
+	usage: "--id <wallet>",
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+
+			wallet, err := svc.GetWalletByID(ctx, walletID)
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var listCommand = command{
+	usage: "[--status ACTIVE|FROZEN] [--currency <code>] [--labels <selector>] [--sort id|balance|created_at] [--desc] [--after <wallet>] [--limit 50]",
+	setup: func(fs *flag.FlagSet) runFunc {
+		status := fs.String("status", "", "list wallets with this status only")
+		currency := fs.String("currency", "", "list wallets in this currency only")
+		labels := fs.String("labels", "", `label selector, e.g. "env=prod,tier!=gold,vip,!closed"`)
+		sortBy := fs.String("sort", service.SortByID, "sort key: id, balance or created_at")
+		desc := fs.Bool("desc", false, "sort in descending order")
+		after := fs.String("after", "", "list wallets after this one, the last of the previous page")
+		limit := fs.Int("limit", 50, "maximum number of wallets")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			search := service.WalletSearch{
+				Status:     models.WalletStatus(*status),
+				Currency:   *currency,
+				SortBy:     *sortBy,
+				Descending: *desc,
+				Limit:      int32(*limit),
+			}
+
+			var err error
+			if search.Labels, err = service.ParseLabelSelector(*labels); err != nil {
+				return err
+			}
+
+			if *after != "" {
+				if search.AfterID, err = parseWalletID(*after); err != nil {
+					return err
+				}
+			}
+
+			wallets, err := svc.SearchWallets(ctx, search)
+			if err != nil {
+				return err
+			}
+
+			return p.wallets(wallets)
+		}
+	},
+}
+
+var createCommand = command{
+	usage:    "[--balance 0] [--currency <code>] [--labels k=v,...] [--metadata <json>] [--tenant <tenant>] [--owner <owner>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		balance := fs.Int("balance", 0, "initial balance, recorded as a deposit")
+		currency := fs.String("currency", "", "ISO 4217 currency code; defaults to XXX, no currency")
+		labels := fs.String("labels", "", "comma-separated key=value labels")
+		metadata := fs.String("metadata", "", "metadata, a JSON object")
+		tenant := fs.String("tenant", "", "tenant the wallet belongs to; defaults to the default tenant")
+		owner := fs.String("owner", "", "owner of the wallet")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			w := service.NewWallet{Currency: *currency, InitialBalance: int32(*balance)}
+			if *metadata != "" {
+				w.Metadata = json.RawMessage(*metadata)
+			}
+
+			var err error
+			if w.Labels, err = parseLabels(*labels); err != nil {
+				return err
+			}
+
+			tenantID, err := parseOptionalID("tenant", *tenant)
+			if err != nil {
+				return err
+			}
+			ownerID, err := parseOptionalID("owner", *owner)
+			if err != nil {
+				return err
+			}
+
+			if tenantID != uuid.Nil {
+				ctx = service.WithTenant(ctx, tenantID)
+			}
+
+			wallet, err := svc.OpenWallet(ctx, w)
+			if err != nil {
+				return err
+			}
+
+			if ownerID != uuid.Nil {
+				if wallet, err = svc.SetWalletOwner(ctx, wallet.ID, ownerID); err != nil {
+					return err
+				}
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var ownerCommand = command{
+	usage:    "--id <wallet> [--owner <owner>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		owner := fs.String("owner", "", "new owner of the wallet; without it the wallet has no owner")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+			ownerID, err := parseOptionalID("owner", *owner)
+			if err != nil {
+				return err
+			}
+
+			wallet, err := svc.SetWalletOwner(ctx, walletID, ownerID)
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var productCommand = command{
+	usage:    "--id <wallet> [--product <product>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		product := fs.String("product", "", "product whose fee schedules apply to the wallet; without it the wallet has no product")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+			productID, err := parseOptionalID("product", *product)
+			if err != nil {
+				return err
+			}
+
+			wallet, err := svc.SetWalletProduct(ctx, walletID, productID)
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var tenantCommand = command{
+	usage:    "[--name <name>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		name := fs.String("name", "", "create a tenant with this name instead of listing tenants")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			if *name == "" {
+				tenants, err := svc.ListTenants(ctx)
+				if err != nil {
+					return err
+				}
+				return p.tenants(tenants)
+			}
+
+			tenant, err := svc.CreateTenant(ctx, *name)
+			if err != nil {
+				return err
+			}
+
+			return p.tenants([]repository.Tenant{tenant})
+		}
+	},
+}
+
+// tenantKeyCommand issues a new API key for a tenant. The key is shown only
+// once; the previous key of the tenant stops working.
+var tenantKeyCommand = command{
+	usage:    "--id <tenant>",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "tenant ID")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			tenantID, err := parseOptionalID("tenant", *id)
+			if err != nil {
+				return err
+			}
+			if tenantID == uuid.Nil {
+				return errors.New("--id is required")
+			}
+
+			key, err := svc.IssueTenantKey(ctx, tenantID)
+			if err != nil {
+				return err
+			}
+
+			return p.tenantKey(tenantID, key)
+		}
+	},
+}
+
+var depositCommand = command{
+	usage:    "--id <wallet> --amount <n>",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		return balanceCommand(fs, models.OperationDeposit)
+	},
+}
+
+var withdrawCommand = command{
+	usage:    "--id <wallet> --amount <n>",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		return balanceCommand(fs, models.OperationWithdraw)
+	},
+}
+
+func balanceCommand(fs *flag.FlagSet, operationType models.OperationType) runFunc {
+	id := fs.String("id", "", "wallet ID")
+	amount := fs.Int("amount", 0, "positive amount")
+
+	return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+		walletID, err := parseWalletID(*id)
+		if err != nil {
+			return err
+		}
+
+		if *amount <= 0 {
+			return errors.New("--amount must be positive")
+		}
+
+		delta := int32(*amount)
+		if operationType == models.OperationWithdraw {
+			delta = -delta
+		}
+
+		wallet, err := svc.TopUpWalletBalance(ctx, walletID, delta)
+		if err != nil {
+			return err
+		}
+
+		return p.wallet(wallet)
+	}
+}
+
+var reverseCommand = command{
+	usage:    "--id <operation> [--amount <n>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "operation ID")
+		amount := fs.Int("amount", 0, "positive amount to reverse; all that is left by default")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			if *id == "" {
+				return errors.New("--id is required")
+			}
+
+			operationID, err := uuid.Parse(*id)
+			if err != nil {
+				return fmt.Errorf("invalid operation ID %q: %w", *id, err)
+			}
+
+			if *amount < 0 {
+				return errors.New("--amount must be positive")
+			}
+
+			reversal, err := svc.ReverseOperation(ctx, operationID, int32(*amount))
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(reversal.Wallet)
+		}
+	},
+}
+
+var freezeCommand = command{
+	usage:    "--id <wallet> [--unfreeze]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		unfreeze := fs.Bool("unfreeze", false, "make a frozen wallet active again")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+
+			status := models.WalletStatusFrozen
+			if *unfreeze {
+				status = models.WalletStatusActive
+			}
+
+			wallet, err := svc.SetWalletStatus(ctx, walletID, status)
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var shardCommand = command{
+	usage:    "--id <wallet> --shards <n>",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		shards := fs.Int("shards", 0, fmt.Sprintf("number of credit shards, 0 to %d; 0 turns sharding off", service.MaxWalletShards))
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+
+			wallet, err := svc.SetWalletShards(ctx, walletID, int32(*shards))
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+var historyCommand = command{
+	usage: "--id <wallet> [--limit 50]",
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		limit := fs.Int("limit", 50, "maximum number of operations, newest first")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+
+			operations, err := svc.GetWalletHistory(ctx, walletID, int32(*limit))
+			if err != nil {
+				return err
+			}
+
+			return p.operations(operations)
+		}
+	},
+}
+
+var journalCommand = command{
+	usage: "",
+	setup: func(fs *flag.FlagSet) runFunc {
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			// The totals are printed even when they are off, to show where.
+			balance, err := svc.TrialBalance(ctx)
+			if err != nil && !errors.Is(err, service.ErrTrialBalanceOff) {
+				return err
+			}
+
+			if perr := p.trialBalance(balance); perr != nil {
+				return perr
+			}
+			return err
+		}
+	},
+}
+
+var exportCommand = command{
+	usage: "[--id <wallet>]",
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "export operations of this wallet only")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			params := repository.ListOperationsPageParams{
+				PageSize: exportPageSize,
+			}
+
+			if *id != "" {
+				walletID, err := parseWalletID(*id)
+				if err != nil {
+					return err
+				}
+				params.WalletID = walletID
+			}
+
+			stream := p.operationStream()
+
+			for {
+				operations, err := svc.ListOperationsPage(ctx, params)
+				if err != nil {
+					return err
+				}
+
+				if err := stream.write(operations); err != nil {
+					return err
+				}
+
+				if len(operations) < exportPageSize {
+					return nil
+				}
+
+				last := operations[len(operations)-1]
+				params.AfterCreatedAt = last.CreatedAt
+				params.AfterID = last.ID
+			}
+		}
+	},
+}
+
+var interestCommand = command{
+	usage:    "[--at 2006-01-02]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		at := fs.String("at", "", "accrue the days before this date and pay the months before its month; defaults to now")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			now := time.Now()
+			if *at != "" {
+				var err error
+				if now, err = time.Parse(time.DateOnly, *at); err != nil {
+					return fmt.Errorf("invalid --at %q: %w", *at, err)
+				}
+				if now.After(time.Now()) {
+					return errors.New("--at must not be in the future")
+				}
+			}
+
+			accrued, err := svc.AccrueInterest(ctx, now)
+			if err != nil {
+				return err
+			}
+
+			paid, err := svc.PayInterest(ctx, now)
+			if err != nil {
+				return err
+			}
+
+			return p.interestRun(accrued, paid)
+		}
+	},
+}
+
+func parseWalletID(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, errors.New("--id is required")
+	}
+
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid wallet ID %q: %w", s, err)
+	}
+
+	return id, nil
+}
+
+// labelsCommand sets the labels and metadata of a wallet.
+var labelsCommand = command{
+	usage:    "--id <wallet> [--labels k=v,...] [--metadata <json>]",
+	mutating: true,
+	setup: func(fs *flag.FlagSet) runFunc {
+		id := fs.String("id", "", "wallet ID")
+		labels := fs.String("labels", "", "comma-separated key=value labels replacing the current ones; - removes them all")
+		metadata := fs.String("metadata", "", "metadata replacing the current one, a JSON object")
+
+		return func(ctx context.Context, svc *service.WalletService, p *printer) error {
+			walletID, err := parseWalletID(*id)
+			if err != nil {
+				return err
+			}
+
+			var details service.WalletDetails
+			if *metadata != "" {
+				details.Metadata = json.RawMessage(*metadata)
+			}
+
+			switch *labels {
+			case "":
+			case "-":
+				details.Labels = map[string]string{}
+			default:
+				if details.Labels, err = parseLabels(*labels); err != nil {
+					return err
+				}
+			}
+
+			if details.Metadata == nil && details.Labels == nil {
+				return errors.New("--labels or --metadata is required")
+			}
+
+			wallet, err := svc.SetWalletDetails(ctx, walletID, details)
+			if err != nil {
+				return err
+			}
+
+			return p.wallet(wallet)
+		}
+	},
+}
+
+// parseLabels parses comma-separated key=value pairs, returning nil for an
+// empty string.
+func parseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return labels, nil
+}
+
+// parseOptionalID parses the value of --flag, returning a zero ID if it is
+// empty.
+func parseOptionalID(flag, s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, nil
+	}
+
+	id, err := uuid.Parse(s)
+	if err != nil || id == uuid.Nil {
+		return uuid.Nil, fmt.Errorf("invalid --%s %q", flag, s)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/kuzmindeniss/itk/internal/config"
+	"github.com/kuzmindeniss/itk/internal/db"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type runFunc func(ctx context.Context, svc *service.WalletService, p *printer) error
+
+type command struct {
+	usage string
+	// mutating commands accept --dry-run.
+	mutating bool
+	// setup registers the command flags and returns the function running it.
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+var commands = map[string]command{
+	"get":        getCommand,
+	"list":       listCommand,
+	"create":     createCommand,
+	"deposit":    depositCommand,
+	"withdraw":   withdrawCommand,
+	"freeze":     freezeCommand,
+	"reverse":    reverseCommand,
+	"shard":      shardCommand,
+	"history":    historyCommand,
+	"journal":    journalCommand,
+	"export":     exportCommand,
+	"interest":   interestCommand,
+	"labels":     labelsCommand,
+	"owner":      ownerCommand,
+	"product":    productCommand,
+	"tenant":     tenantCommand,
+	"tenant-key": tenantKeyCommand,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	inv, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(inv.output, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := execute(inv.run, p, inv.dryRun, inv.actor); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// invocation is a parsed walletctl command line.
+type invocation struct {
+	run    runFunc
+	output string
+	dryRun bool
+	actor  string
+}
+
+// errUsage is returned by parseArgs for a missing or unknown command.
+var errUsage = errors.New("unknown command")
+
+// parseArgs parses the command name and its flags, printing the usage to
+// stderr when they are wrong.
+func parseArgs(args []string, stderr io.Writer) (invocation, error) {
+	if len(args) < 1 {
+		usage(stderr)
+		return invocation{}, errUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(stderr)
+		return invocation{}, errUsage
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("output", formatTable, "output format: json or table")
+	dryRun, actor := new(bool), new(string)
+	if cmd.mutating {
+		dryRun = fs.Bool("dry-run", false, "show the resulting balance without committing")
+		actor = fs.String("actor", "", "who makes the change, for the audit log (required)")
+	}
+	run := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: walletctl %s %s\n", args[0], cmd.usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return invocation{}, err
+	}
+
+	if cmd.mutating && *actor == "" {
+		fmt.Fprintln(fs.Output(), "--actor is required")
+		fs.Usage()
+		return invocation{}, errors.New("--actor is required")
+	}
+
+	return invocation{run: run, output: *output, dryRun: *dryRun, actor: *actor}, nil
+}
+
+// execute audits the changes made by run as made by actor. Read-only
+// commands have no actor.
+func execute(run runFunc, p *printer, dryRun bool, actor string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	pools, err := db.Connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer pools.Close()
+
+	ctx := context.Background()
+	if actor != "" {
+		ctx = service.WithAudit(ctx, service.AuditInfo{Actor: actor})
+	}
+	walletService := service.NewWalletService(db.NewStore(pools.Primary),
+		service.WithInterestConventions(cfg.InterestDayCount, cfg.InterestRounding))
+
+	if !dryRun {
+		return run(ctx, walletService, p)
+	}
+
+	if err := walletService.DryRun(ctx, func(tx *service.WalletService) error {
+		return run(ctx, tx, p)
+	}); err != nil {
+		return err
+	}
+
+	log.Print("dry run: no changes were committed")
+	return nil
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: walletctl <command> [flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nall commands accept --output json|table; create, deposit, withdraw, freeze, reverse, shard, interest, labels, owner, product, tenant and tenant-key accept --dry-run and require --actor")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+		want    invocation
+	}{
+		{name: "no command", args: nil, wantErr: errUsage},
+		{name: "unknown command", args: []string{"drop"}, wantErr: errUsage},
+		{name: "help", args: []string{"get", "-h"}, wantErr: flag.ErrHelp},
+		{name: "unknown flag", args: []string{"get", "--wallet", "x"}},
+		{name: "bad int flag", args: []string{"deposit", "--actor", "ops", "--amount", "ten"}},
+		{name: "dry run on read-only command", args: []string{"get", "--dry-run"}},
+		{name: "missing actor", args: []string{"deposit", "--id", "x", "--amount", "10"}},
+		{name: "read-only", args: []string{"get", "--id", "x", "--output", "json"}, want: invocation{output: formatJSON}},
+		{name: "mutating", args: []string{"freeze", "--id", "x", "--actor", "ops", "--dry-run"}, want: invocation{output: formatTable, dryRun: true, actor: "ops"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			inv, err := parseArgs(tt.args, &stderr)
+
+			if tt.want.output == "" {
+				require.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+				assert.Contains(t, stderr.String(), "usage: walletctl")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, inv.run)
+			inv.run = nil
+			assert.Equal(t, tt.want, inv)
+		})
+	}
+}
+
+func TestCommands_InvalidArguments(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		wantErr string
+	}{
+		{command: "get", args: nil, wantErr: "--id is required"},
+		{command: "get", args: []string{"--id", "42"}, wantErr: `invalid wallet ID "42"`},
+		{command: "list", args: []string{"--after", "42"}, wantErr: `invalid wallet ID "42"`},
+		{command: "create", args: []string{"--labels", "vip"}, wantErr: `invalid label "vip"`},
+		{command: "create", args: []string{"--tenant", "acme"}, wantErr: `invalid --tenant "acme"`},
+		{command: "create", args: []string{"--owner", "00000000-0000-0000-0000-000000000000"}, wantErr: "invalid --owner"},
+		{command: "deposit", args: []string{"--id", "42", "--amount", "10"}, wantErr: `invalid wallet ID "42"`},
+		{command: "withdraw", args: []string{"--id", "9b2f5c7e-1d4a-4c1e-8f3b-2a6d7e8f9a0b"}, wantErr: "--amount must be positive"},
+		{command: "reverse", args: nil, wantErr: "--id is required"},
+		{command: "reverse", args: []string{"--id", "42"}, wantErr: `invalid operation ID "42"`},
+		{command: "reverse", args: []string{"--id", "9b2f5c7e-1d4a-4c1e-8f3b-2a6d7e8f9a0b", "--amount", "-1"}, wantErr: "--amount must be positive"},
+		{command: "freeze", args: nil, wantErr: "--id is required"},
+		{command: "shard", args: []string{"--id", "42"}, wantErr: `invalid wallet ID "42"`},
+		{command: "history", args: nil, wantErr: "--id is required"},
+		{command: "export", args: []string{"--id", "42"}, wantErr: `invalid wallet ID "42"`},
+		{command: "interest", args: []string{"--at", "01.02.2024"}, wantErr: `invalid --at "01.02.2024"`},
+		{command: "interest", args: []string{"--at", "2999-01-01"}, wantErr: "--at must not be in the future"},
+		{command: "labels", args: []string{"--id", "9b2f5c7e-1d4a-4c1e-8f3b-2a6d7e8f9a0b"}, wantErr: "--labels or --metadata is required"},
+		{command: "owner", args: []string{"--id", "9b2f5c7e-1d4a-4c1e-8f3b-2a6d7e8f9a0b", "--owner", "bob"}, wantErr: `invalid --owner "bob"`},
+		{command: "product", args: []string{"--id", "9b2f5c7e-1d4a-4c1e-8f3b-2a6d7e8f9a0b", "--product", "gold"}, wantErr: `invalid --product "gold"`},
+		{command: "tenant-key", args: nil, wantErr: "--id is required"},
+		{command: "tenant-key", args: []string{"--id", "acme"}, wantErr: `invalid --tenant "acme"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command+" "+tt.wantErr, func(t *testing.T) {
+			var stderr, stdout bytes.Buffer
+			args := []string{tt.command}
+			if commands[tt.command].mutating {
+				args = append(args, "--actor", "ops")
+			}
+			inv, err := parseArgs(append(args, tt.args...), &stderr)
+			require.NoError(t, err)
+
+			p, err := newPrinter(inv.output, &stdout)
+			require.NoError(t, err)
+
+			err = inv.run(context.Background(), service.NewWalletService(memory.NewStore()), p)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Empty(t, stdout.String())
+		})
+	}
+}
+
+func TestNewPrinter(t *testing.T) {
+	for _, format := range []string{formatJSON, formatTable} {
+		_, err := newPrinter(format, &bytes.Buffer{})
+		assert.NoError(t, err, format)
+	}
+
+	_, err := newPrinter("yaml", &bytes.Buffer{})
+	assert.EqualError(t, err, `unknown output format "yaml"`)
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "env=prod", want: map[string]string{"env": "prod"}},
+		{in: " env = prod , tier=", want: map[string]string{"env": "prod", "tier": ""}},
+		{in: "env=prod,vip", wantErr: true},
+		{in: ",", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseLabels(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
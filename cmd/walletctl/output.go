@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	if format != formatJSON && format != formatTable {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+
+	return &printer{format: format, w: w}, nil
+}
+
+func (p *printer) wallet(wallet repository.Wallet) error {
+	if p.format == formatJSON {
+		return p.json(wallet)
+	}
+	return p.wallets([]repository.Wallet{wallet})
+}
+
+func (p *printer) wallets(wallets []repository.Wallet) error {
+	if p.format == formatJSON {
+		if wallets == nil {
+			wallets = []repository.Wallet{}
+		}
+		return p.json(wallets)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tBALANCE\tCURRENCY\tSTATUS\tSHARDS\tTENANT\tOWNER\tLABELS\tCREATED AT")
+	for _, w := range wallets {
+		owner := "-"
+		if w.OwnerID != uuid.Nil {
+			owner = w.OwnerID.String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", w.ID, w.Balance, w.Currency, w.Status, w.ShardCount, w.TenantID, owner, w.Labels, w.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) tenants(tenants []repository.Tenant) error {
+	if p.format == formatJSON {
+		if tenants == nil {
+			tenants = []repository.Tenant{}
+		}
+		return p.json(tenants)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCREATED AT")
+	for _, t := range tenants {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", t.ID, t.Name, t.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) tenantKey(tenantID uuid.UUID, key string) error {
+	if p.format == formatJSON {
+		return p.json(map[string]string{"tenant_id": tenantID.String(), "api_key": key})
+	}
+
+	_, err := fmt.Fprintf(p.w, "API key of tenant %s: %s\n", tenantID, key)
+	return err
+}
+
+func (p *printer) operations(operations []repository.Operation) error {
+	if p.format == formatJSON {
+		if operations == nil {
+			operations = []repository.Operation{}
+		}
+		return p.json(operations)
+	}
+
+	stream := p.operationStream()
+	return stream.write(operations)
+}
+
+func (p *printer) interestRun(accruedDays, paidWallets int) error {
+	if p.format == formatJSON {
+		return p.json(map[string]int{"accrued_days": accruedDays, "paid_wallets": paidWallets})
+	}
+
+	_, err := fmt.Fprintf(p.w, "accrued %d days, paid %d wallets\n", accruedDays, paidWallets)
+	return err
+}
+
+func (p *printer) trialBalance(balance service.TrialBalance) error {
+	if p.format == formatJSON {
+		if balance.Currencies == nil {
+			balance.Currencies = []service.CurrencyBalance{}
+		}
+		return p.json(balance)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CURRENCY\tACCOUNT\tDEBIT\tCREDIT")
+	for _, c := range balance.Currencies {
+		for _, total := range c.Accounts {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", c.Currency, total.Account, total.Debit, total.Credit)
+		}
+		fmt.Fprintf(tw, "%s\tTOTAL\t%d\t%d\n", c.Currency, c.Debit, c.Credit)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(balance.Mismatches) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(p.w)
+	tw = tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WALLET\tBALANCE\tJOURNAL")
+	for _, m := range balance.Mismatches {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", m.WalletID, m.Balance, m.JournalBalance)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) json(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// operationStream writes operations page by page: JSON as one object per
+// line, tables with a single header.
+type operationStream struct {
+	p             *printer
+	headerWritten bool
+}
+
+func (p *printer) operationStream() *operationStream {
+	return &operationStream{p: p}
+}
+
+func (s *operationStream) write(operations []repository.Operation) error {
+	if s.p.format == formatJSON {
+		enc := json.NewEncoder(s.p.w)
+		for _, op := range operations {
+			if err := enc.Encode(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(s.p.w, 0, 0, 2, ' ', 0)
+	if !s.headerWritten {
+		fmt.Fprintln(tw, "ID\tWALLET ID\tTYPE\tAMOUNT\tREVERSED\tCREATED AT")
+		s.headerWritten = true
+	}
+	for _, op := range operations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", op.ID, op.WalletID, op.OperationType, op.Amount, op.ReversedAmount, op.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
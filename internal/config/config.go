@@ -1,32 +1,389 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvProduction  = "production"
 )
 
 type Config struct {
-	AppPort    string
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
+	AppEnv  string
+	AppPort string
+	// DebugAddr is where /debug/vars is served, apart from the API; empty
+	// turns it off.
+	DebugAddr string
+	// AdminAPIKey authorizes the /api/v1/admin routes; empty turns them off.
+	AdminAPIKey string
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For is
+	// believed for the client IP. Without any, it is the peer address.
+	TrustedProxies []string
+	DBHost         string
+	DBPort         string
+	DBUser         string
+	DBPassword     string
+	DBName         string
+	RunMigrations  bool
+
+	// DBReplicaURLs are DSNs of read replicas. Reads are routed to a replica
+	// only while its replication lag is at most ReplicaMaxLag.
+	DBReplicaURLs []string
+	ReplicaMaxLag time.Duration
+
+	// BatchingEnabled turns on group commit of concurrent balance changes
+	// per wallet, at most BatchMaxSize operations per transaction.
+	BatchingEnabled bool
+	BatchMaxSize    int
+	// CacheEnabled serves wallet reads from a per-instance cache of at most
+	// CacheSize wallets, each kept for up to CacheTTL.
+	CacheEnabled bool
+	CacheTTL     time.Duration
+	CacheSize    int
+
+	// StreamHeartbeat is how often idle balance streams send a comment to
+	// keep proxies from closing them; a client IP may hold at most
+	// StreamMaxPerClient streams.
+	StreamHeartbeat    time.Duration
+	StreamMaxPerClient int
+
+	// SchedulerEnabled runs due scheduled operations every SchedulerInterval.
+	SchedulerEnabled  bool
+	SchedulerInterval time.Duration
+
+	// InterestEnabled accrues interest for the days that have ended and pays
+	// past months every InterestInterval. InterestDayCount and
+	// InterestRounding apply to wallets without an interest product.
+	InterestEnabled  bool
+	InterestInterval time.Duration
+	InterestDayCount models.DayCount
+	InterestRounding models.Rounding
+
+	// FeesEnabled charges the fee schedules on balance operations and
+	// credits the fees to the system wallet FeeWalletID.
+	FeesEnabled bool
+	FeeWalletID uuid.UUID
+
+	// ImportMaxRows is the most rows one CSV import may have. Imports left
+	// pending for longer than ImportRecoveryInterval, as after a crash, are
+	// applied every ImportRecoveryInterval.
+	ImportMaxRows          int
+	ImportRecoveryInterval time.Duration
+
+	// MaxDepositAmount and MaxWithdrawAmount are the largest amounts one
+	// balance update through the API may move.
+	MaxDepositAmount  int32
+	MaxWithdrawAmount int32
+
+	// ExchangeQuoteTTL is how long a conversion quote holds its rate.
+	// Conversions get ExchangeSpreadBps less than the rate, rounded by
+	// ExchangeRounding.
+	ExchangeQuoteTTL  time.Duration
+	ExchangeSpreadBps int
+	ExchangeRounding  models.Rounding
 }
 
 func Load() (*Config, error) {
-	if err := godotenv.Load("config.env"); err != nil {
+	// config.env is optional: containers get their settings from the environment.
+	if err := godotenv.Load("config.env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("error loading .env file: %w", err)
 	}
 
+	appEnv := getEnv("APP_ENV", EnvProduction)
+	if appEnv != EnvDevelopment && appEnv != EnvTest && appEnv != EnvProduction {
+		return nil, fmt.Errorf("invalid APP_ENV %q: expected %s, %s or %s", appEnv, EnvDevelopment, EnvTest, EnvProduction)
+	}
+
+	replicaMaxLag, err := getEnvDuration("DB_REPLICA_MAX_LAG", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	runMigrations, err := getEnvBool("RUN_MIGRATIONS", true)
+	if err != nil {
+		return nil, err
+	}
+
+	batchingEnabled, err := getEnvBool("BATCHING_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	batchMaxSize, err := getEnvInt("BATCH_MAX_SIZE", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheEnabled, err := getEnvBool("CACHE_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := getEnvDuration("CACHE_TTL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize, err := getEnvInt("CACHE_SIZE", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	streamHeartbeat, err := getEnvDuration("STREAM_HEARTBEAT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if streamHeartbeat <= 0 {
+		return nil, fmt.Errorf("invalid STREAM_HEARTBEAT %s: must be positive", streamHeartbeat)
+	}
+
+	streamMaxPerClient, err := getEnvInt("STREAM_MAX_PER_CLIENT", 5)
+	if err != nil {
+		return nil, err
+	}
+	if streamMaxPerClient <= 0 {
+		return nil, fmt.Errorf("invalid STREAM_MAX_PER_CLIENT %d: must be positive", streamMaxPerClient)
+	}
+
+	schedulerEnabled, err := getEnvBool("SCHEDULER_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerInterval, err := getEnvDuration("SCHEDULER_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if schedulerInterval <= 0 {
+		return nil, fmt.Errorf("invalid SCHEDULER_INTERVAL %s: must be positive", schedulerInterval)
+	}
+
+	interestEnabled, err := getEnvBool("INTEREST_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+
+	interestInterval, err := getEnvDuration("INTEREST_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if interestInterval <= 0 {
+		return nil, fmt.Errorf("invalid INTEREST_INTERVAL %s: must be positive", interestInterval)
+	}
+
+	interestDayCount := models.DayCount(getEnv("INTEREST_DAY_COUNT", string(models.DayCountAct365)))
+	switch interestDayCount {
+	case models.DayCountAct365, models.DayCountAct360, models.DayCountActAct:
+	default:
+		return nil, fmt.Errorf("invalid INTEREST_DAY_COUNT %q: expected %s, %s or %s", interestDayCount, models.DayCountAct365, models.DayCountAct360, models.DayCountActAct)
+	}
+
+	interestRounding := models.Rounding(getEnv("INTEREST_ROUNDING", string(models.RoundingHalfEven)))
+	switch interestRounding {
+	case models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown:
+	default:
+		return nil, fmt.Errorf("invalid INTEREST_ROUNDING %q: expected %s, %s or %s", interestRounding, models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown)
+	}
+
+	feesEnabled, err := getEnvBool("FEES_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The default is the fee wallet created by the fees migration.
+	feeWalletValue := getEnv("FEE_WALLET_ID", "fee00000-0000-4000-8000-000000000000")
+	feeWalletID, err := uuid.Parse(feeWalletValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEE_WALLET_ID %q: %w", feeWalletValue, err)
+	}
+
+	importMaxRows, err := getEnvInt("IMPORT_MAX_ROWS", 100000)
+	if err != nil {
+		return nil, err
+	}
+
+	importRecoveryInterval, err := getEnvDuration("IMPORT_RECOVERY_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if importRecoveryInterval <= 0 {
+		return nil, fmt.Errorf("invalid IMPORT_RECOVERY_INTERVAL %s: must be positive", importRecoveryInterval)
+	}
+
+	maxDepositAmount, err := getEnvAmount("MAX_DEPOSIT_AMOUNT", 1000000000)
+	if err != nil {
+		return nil, err
+	}
+
+	maxWithdrawAmount, err := getEnvAmount("MAX_WITHDRAW_AMOUNT", 1000000000)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangeQuoteTTL, err := getEnvDuration("EXCHANGE_QUOTE_TTL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeQuoteTTL <= 0 {
+		return nil, fmt.Errorf("invalid EXCHANGE_QUOTE_TTL %s: must be positive", exchangeQuoteTTL)
+	}
+
+	exchangeSpreadBps, err := getEnvInt("EXCHANGE_SPREAD_BPS", 50)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeSpreadBps < 0 || exchangeSpreadBps >= 10000 {
+		return nil, fmt.Errorf("invalid EXCHANGE_SPREAD_BPS %d: expected 0 to 9999", exchangeSpreadBps)
+	}
+
+	exchangeRounding := models.Rounding(getEnv("EXCHANGE_ROUNDING", string(models.RoundingDown)))
+	switch exchangeRounding {
+	case models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown:
+	default:
+		return nil, fmt.Errorf("invalid EXCHANGE_ROUNDING %q: expected %s, %s or %s", exchangeRounding, models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown)
+	}
+
 	return &Config{
-		AppPort:    os.Getenv("APP_PORT"),
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
+		AppEnv:         appEnv,
+		AppPort:        os.Getenv("APP_PORT"),
+		DebugAddr:      getEnv("DEBUG_ADDR", "localhost:6060"),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+		AdminAPIKey:    os.Getenv("ADMIN_API_KEY"),
+		DBHost:         os.Getenv("DB_HOST"),
+		DBPort:         os.Getenv("DB_PORT"),
+		DBUser:         os.Getenv("DB_USER"),
+		DBPassword:     os.Getenv("DB_PASSWORD"),
+		DBName:         os.Getenv("DB_NAME"),
+		RunMigrations:  runMigrations,
+
+		DBReplicaURLs: getEnvList("DB_REPLICA_URLS"),
+		ReplicaMaxLag: replicaMaxLag,
+
+		BatchingEnabled: batchingEnabled,
+		BatchMaxSize:    batchMaxSize,
+
+		CacheEnabled: cacheEnabled,
+		CacheTTL:     cacheTTL,
+		CacheSize:    cacheSize,
+
+		StreamHeartbeat:    streamHeartbeat,
+		StreamMaxPerClient: streamMaxPerClient,
+
+		SchedulerEnabled:  schedulerEnabled,
+		SchedulerInterval: schedulerInterval,
+
+		InterestEnabled:  interestEnabled,
+		InterestInterval: interestInterval,
+		InterestDayCount: interestDayCount,
+		InterestRounding: interestRounding,
+
+		FeesEnabled: feesEnabled,
+		FeeWalletID: feeWalletID,
+
+		ImportMaxRows:          importMaxRows,
+		ImportRecoveryInterval: importRecoveryInterval,
+
+		MaxDepositAmount:  maxDepositAmount,
+		MaxWithdrawAmount: maxWithdrawAmount,
+
+		ExchangeQuoteTTL:  exchangeQuoteTTL,
+		ExchangeSpreadBps: exchangeSpreadBps,
+		ExchangeRounding:  exchangeRounding,
 	}, nil
 }
+
+// SeedsAllowed reports whether test wallets may be inserted. Seeds are never
+// applied in production.
+func (c *Config) SeedsAllowed() bool {
+	return c.AppEnv == EnvDevelopment || c.AppEnv == EnvTest
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated variable, skipping empty items.
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+
+	return parsed, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+
+	return parsed, nil
+}
+
+// getEnvAmount reads a positive amount that fits a balance.
+func getEnvAmount(key string, fallback int32) (int32, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("invalid %s %d: must be positive", key, parsed)
+	}
+
+	return int32(parsed), nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+
+	return parsed, nil
+}
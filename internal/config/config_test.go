@@ -0,0 +1,92 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	// Empty variables count as missing.
+	for _, key := range []string{"APP_ENV", "RUN_MIGRATIONS", "DB_REPLICA_MAX_LAG", "DB_REPLICA_URLS", "BATCH_MAX_SIZE", "CACHE_TTL", "INTEREST_DAY_COUNT", "EXCHANGE_ROUNDING", "MAX_DEPOSIT_AMOUNT", "ADMIN_API_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, EnvProduction, cfg.AppEnv)
+	assert.False(t, cfg.SeedsAllowed())
+	assert.True(t, cfg.RunMigrations)
+	assert.Equal(t, time.Second, cfg.ReplicaMaxLag)
+	assert.Equal(t, 100, cfg.BatchMaxSize)
+	assert.Equal(t, 5*time.Second, cfg.CacheTTL)
+	assert.Equal(t, models.DayCountAct365, cfg.InterestDayCount)
+	assert.Equal(t, models.RoundingDown, cfg.ExchangeRounding)
+	assert.Equal(t, int32(1000000000), cfg.MaxDepositAmount)
+	assert.Empty(t, cfg.AdminAPIKey)
+	assert.Nil(t, cfg.DBReplicaURLs)
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("APP_ENV", EnvTest)
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.0/8, ,127.0.0.1")
+	t.Setenv("CACHE_TTL", "1m")
+	t.Setenv("MAX_WITHDRAW_AMOUNT", "500")
+	t.Setenv("INTEREST_ROUNDING", string(models.RoundingHalfUp))
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.True(t, cfg.SeedsAllowed())
+	assert.Equal(t, []string{"10.0.0.0/8", "127.0.0.1"}, cfg.TrustedProxies)
+	assert.Equal(t, time.Minute, cfg.CacheTTL)
+	assert.Equal(t, int32(500), cfg.MaxWithdrawAmount)
+	assert.Equal(t, models.RoundingHalfUp, cfg.InterestRounding)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		wantErr string
+	}{
+		{key: "APP_ENV", value: "staging", wantErr: `invalid APP_ENV "staging"`},
+		{key: "DB_REPLICA_MAX_LAG", value: "1", wantErr: `invalid DB_REPLICA_MAX_LAG "1"`},
+		{key: "RUN_MIGRATIONS", value: "maybe", wantErr: `invalid RUN_MIGRATIONS "maybe"`},
+		{key: "BATCHING_ENABLED", value: "on", wantErr: `invalid BATCHING_ENABLED "on"`},
+		{key: "BATCH_MAX_SIZE", value: "1k", wantErr: `invalid BATCH_MAX_SIZE "1k"`},
+		{key: "CACHE_TTL", value: "soon", wantErr: `invalid CACHE_TTL "soon"`},
+		{key: "CACHE_SIZE", value: "10MB", wantErr: `invalid CACHE_SIZE "10MB"`},
+		{key: "STREAM_HEARTBEAT", value: "0s", wantErr: "invalid STREAM_HEARTBEAT 0s: must be positive"},
+		{key: "STREAM_MAX_PER_CLIENT", value: "0", wantErr: "invalid STREAM_MAX_PER_CLIENT 0: must be positive"},
+		{key: "SCHEDULER_INTERVAL", value: "-1s", wantErr: "invalid SCHEDULER_INTERVAL -1s: must be positive"},
+		{key: "INTEREST_INTERVAL", value: "hourly", wantErr: `invalid INTEREST_INTERVAL "hourly"`},
+		{key: "INTEREST_DAY_COUNT", value: "30/360", wantErr: `invalid INTEREST_DAY_COUNT "30/360"`},
+		{key: "INTEREST_ROUNDING", value: "UP", wantErr: `invalid INTEREST_ROUNDING "UP"`},
+		{key: "FEES_ENABLED", value: "yes", wantErr: `invalid FEES_ENABLED "yes"`},
+		{key: "FEE_WALLET_ID", value: "fees", wantErr: `invalid FEE_WALLET_ID "fees"`},
+		{key: "IMPORT_MAX_ROWS", value: "many", wantErr: `invalid IMPORT_MAX_ROWS "many"`},
+		{key: "IMPORT_RECOVERY_INTERVAL", value: "0", wantErr: "invalid IMPORT_RECOVERY_INTERVAL 0s: must be positive"},
+		{key: "MAX_DEPOSIT_AMOUNT", value: "3000000000", wantErr: `invalid MAX_DEPOSIT_AMOUNT "3000000000"`},
+		{key: "MAX_WITHDRAW_AMOUNT", value: "0", wantErr: "invalid MAX_WITHDRAW_AMOUNT 0: must be positive"},
+		{key: "EXCHANGE_QUOTE_TTL", value: "0s", wantErr: "invalid EXCHANGE_QUOTE_TTL 0s: must be positive"},
+		{key: "EXCHANGE_SPREAD_BPS", value: "10000", wantErr: "invalid EXCHANGE_SPREAD_BPS 10000: expected 0 to 9999"},
+		{key: "EXCHANGE_SPREAD_BPS", value: "-1", wantErr: "invalid EXCHANGE_SPREAD_BPS -1: expected 0 to 9999"},
+		{key: "EXCHANGE_ROUNDING", value: "CEILING", wantErr: `invalid EXCHANGE_ROUNDING "CEILING"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+
+			cfg, err := Load()
+			require.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
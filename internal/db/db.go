@@ -2,53 +2,84 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/kuzmindeniss/itk/internal/config"
-	"github.com/pressly/goose/v3"
 )
 
-func Connect(cfg *config.Config) (*pgxpool.Pool, error) {
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
+// Connect opens a pool to the primary and one to each configured replica,
+// and starts watching the replication lag of the replicas.
+func Connect(cfg *config.Config) (*Pools, error) {
+	primary, err := newPool(databaseURL(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pools := &Pools{
+		Primary:      primary,
+		stopMonitors: cancel,
+	}
+
+	for _, url := range cfg.DBReplicaURLs {
+		pool, err := newPool(url)
+		if err != nil {
+			pools.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+
+		replica := newReplica(pool, cfg.ReplicaMaxLag)
+		pools.Replicas = append(pools.Replicas, replica)
+
+		go replica.monitor(ctx)
+	}
 
-	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	return pools, nil
+}
+
+func newPool(url string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
 	}
 
 	poolConfig.MaxConns = 100
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	pool, err := pgxpool.NewWithConfig(context.Background(), withTenantHooks(poolConfig))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	return pool, err
+	return pool, nil
 }
 
+// RunMigrations applies pending schema migrations and, outside production,
+// the test wallet seeds.
 func RunMigrations(cfg *config.Config) error {
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
-
-	db, err := sql.Open("pgx", dbURL)
+	migrator, err := NewMigrator(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection for migrations: %w", err)
+		return err
 	}
-	defer db.Close()
+	defer migrator.Close()
 
-	if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("failed to set goose dialect: %w", err)
-	}
+	ctx := context.Background()
 
-	if err := goose.Up(db, "internal/db/sql/schema"); err != nil {
+	if err := migrator.Up(ctx); err != nil {
 		return fmt.Errorf("failed to run schema migrations: %w", err)
 	}
 
-	if err := goose.Up(db, "internal/db/sql/seeds"); err != nil {
+	if !cfg.SeedsAllowed() {
+		return nil
+	}
+
+	if err := migrator.Seed(ctx); err != nil {
 		return fmt.Errorf("failed to run seeds: %w", err)
 	}
 
 	return nil
 }
+
+func databaseURL(cfg *config.Config) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+func (s *Store) CreateAuditEntry(ctx context.Context, arg repository.CreateAuditEntryParams) (repository.AuditLog, error) {
+	var entry repository.AuditLog
+
+	err := s.write(ctx, func(now time.Time) error {
+		if !s.visible(ctx, arg.WalletID) {
+			return rowSecurityViolation("audit_log")
+		}
+
+		entry = repository.AuditLog{
+			ID:        uuid.New(),
+			Actor:     arg.Actor,
+			Action:    arg.Action,
+			WalletID:  arg.WalletID,
+			Before:    arg.Before,
+			After:     arg.After,
+			RequestID: arg.RequestID,
+			SourceIp:  arg.SourceIp,
+			CreatedAt: now,
+		}
+
+		n := len(s.data.audit)
+		s.onRollback(func() {
+			s.data.audit = s.data.audit[:n]
+		})
+
+		s.data.audit = append(s.data.audit, entry)
+		return nil
+	})
+
+	return entry, err
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, arg repository.ListAuditEntriesParams) ([]repository.AuditLog, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var entries []repository.AuditLog
+
+	err := s.read(ctx, func() error {
+		var after *repository.AuditLog
+		if arg.AfterID != uuid.Nil {
+			i := slices.IndexFunc(s.data.audit, func(e repository.AuditLog) bool {
+				return e.ID == arg.AfterID && s.visible(ctx, e.WalletID)
+			})
+			if i < 0 {
+				// The subquery yields NULL, so no row matches.
+				return nil
+			}
+			after = &s.data.audit[i]
+		}
+
+		for _, e := range s.data.audit {
+			switch {
+			case arg.Actor != "" && e.Actor != arg.Actor,
+				arg.WalletID != uuid.Nil && e.WalletID != arg.WalletID,
+				e.CreatedAt.Before(arg.FromTime),
+				!e.CreatedAt.Before(arg.ToTime),
+				after != nil && compareAuditEntries(e, *after) <= 0,
+				!s.visible(ctx, e.WalletID):
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(entries, compareAuditEntries)
+
+	return entries[:min(len(entries), int(arg.PageSize))], nil
+}
+
+func compareAuditEntries(a, b repository.AuditLog) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return compareUUID(a.ID, b.ID)
+}
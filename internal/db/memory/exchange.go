@@ -0,0 +1,224 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+func (s *Store) CreateExchangeRate(ctx context.Context, arg repository.CreateExchangeRateParams) (repository.ExchangeRate, error) {
+	var rate repository.ExchangeRate
+
+	err := s.write(ctx, func(now time.Time) error {
+		for _, currency := range []struct{ code, constraint string }{
+			{arg.BaseCurrency, "exchange_rates_base_currency_check"},
+			{arg.QuoteCurrency, "exchange_rates_quote_currency_check"},
+		} {
+			if !currencyPattern.MatchString(currency.code) || currency.code == service.NoCurrency {
+				return checkViolation("exchange_rates", currency.constraint)
+			}
+		}
+		switch {
+		case arg.RateMicros <= 0:
+			return checkViolation("exchange_rates", "exchange_rates_rate_micros_check")
+		case arg.Source == "":
+			return checkViolation("exchange_rates", "exchange_rates_source_check")
+		case arg.BaseCurrency == arg.QuoteCurrency:
+			return checkViolation("exchange_rates", "exchange_rates_pair_check")
+		}
+
+		for _, r := range s.data.exchangeRates {
+			if r.BaseCurrency == arg.BaseCurrency && r.QuoteCurrency == arg.QuoteCurrency && r.EffectiveFrom.Equal(arg.EffectiveFrom) {
+				return &pgconn.PgError{
+					Code:           codeUniqueViolation,
+					Message:        `duplicate key value violates unique constraint "exchange_rates_pair_key"`,
+					ConstraintName: "exchange_rates_pair_key",
+				}
+			}
+		}
+
+		rate = repository.ExchangeRate{
+			ID:            uuid.New(),
+			BaseCurrency:  arg.BaseCurrency,
+			QuoteCurrency: arg.QuoteCurrency,
+			RateMicros:    arg.RateMicros,
+			EffectiveFrom: arg.EffectiveFrom,
+			Source:        arg.Source,
+			CreatedAt:     now,
+		}
+
+		s.onRollback(func() {
+			delete(s.data.exchangeRates, rate.ID)
+		})
+		s.data.exchangeRates[rate.ID] = rate
+		return nil
+	})
+
+	return rate, err
+}
+
+func (s *Store) ListExchangeRates(ctx context.Context, arg repository.ListExchangeRatesParams) ([]repository.ExchangeRate, error) {
+	if arg.Limit < 0 {
+		return nil, negativeLimit()
+	}
+
+	var rates []repository.ExchangeRate
+
+	err := s.read(ctx, func() error {
+		for _, r := range s.data.exchangeRates {
+			if (arg.BaseCurrency == "" || r.BaseCurrency == arg.BaseCurrency) &&
+				(arg.QuoteCurrency == "" || r.QuoteCurrency == arg.QuoteCurrency) {
+				rates = append(rates, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(rates, func(a, b repository.ExchangeRate) int {
+		return cmp.Or(
+			cmp.Compare(a.BaseCurrency, b.BaseCurrency),
+			cmp.Compare(a.QuoteCurrency, b.QuoteCurrency),
+			b.EffectiveFrom.Compare(a.EffectiveFrom),
+		)
+	})
+
+	if len(rates) > int(arg.Limit) {
+		rates = rates[:arg.Limit]
+	}
+
+	return rates, nil
+}
+
+func (s *Store) GetEffectiveExchangeRate(ctx context.Context, arg repository.GetEffectiveExchangeRateParams) (repository.ExchangeRate, error) {
+	var rate repository.ExchangeRate
+
+	err := s.read(ctx, func() error {
+		found := false
+		for _, r := range s.data.exchangeRates {
+			if r.BaseCurrency != arg.BaseCurrency || r.QuoteCurrency != arg.QuoteCurrency || r.EffectiveFrom.After(arg.At) {
+				continue
+			}
+			if !found || r.EffectiveFrom.After(rate.EffectiveFrom) {
+				rate, found = r, true
+			}
+		}
+		if !found {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return rate, err
+}
+
+func (s *Store) CreateExchangeQuote(ctx context.Context, arg repository.CreateExchangeQuoteParams) (repository.ExchangeQuote, error) {
+	var quote repository.ExchangeQuote
+
+	err := s.write(ctx, func(now time.Time) error {
+		if _, ok := s.data.wallets[arg.FromWalletID]; !ok {
+			return foreignKeyViolation("exchange_quotes", "exchange_quotes_from_wallet_id_fkey")
+		}
+		if _, ok := s.data.wallets[arg.ToWalletID]; !ok {
+			return foreignKeyViolation("exchange_quotes", "exchange_quotes_to_wallet_id_fkey")
+		}
+		if !s.visible(ctx, arg.FromWalletID) {
+			return rowSecurityViolation("exchange_quotes")
+		}
+		if _, ok := s.data.exchangeRates[arg.RateID]; !ok {
+			return foreignKeyViolation("exchange_quotes", "exchange_quotes_rate_id_fkey")
+		}
+
+		switch models.Rounding(arg.Rounding) {
+		case models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown:
+		default:
+			return checkViolation("exchange_quotes", "exchange_quotes_rounding_check")
+		}
+		switch {
+		case arg.SpreadBps < 0 || arg.SpreadBps > service.MaxSpreadBps:
+			return checkViolation("exchange_quotes", "exchange_quotes_spread_bps_check")
+		case arg.Amount <= 0:
+			return checkViolation("exchange_quotes", "exchange_quotes_amount_check")
+		case arg.ConvertedAmount <= 0:
+			return checkViolation("exchange_quotes", "exchange_quotes_converted_amount_check")
+		}
+
+		quote = repository.ExchangeQuote{
+			ID:              uuid.New(),
+			FromWalletID:    arg.FromWalletID,
+			ToWalletID:      arg.ToWalletID,
+			RateID:          arg.RateID,
+			FromCurrency:    arg.FromCurrency,
+			ToCurrency:      arg.ToCurrency,
+			RateMicros:      arg.RateMicros,
+			SpreadBps:       arg.SpreadBps,
+			Rounding:        arg.Rounding,
+			Amount:          arg.Amount,
+			ConvertedAmount: arg.ConvertedAmount,
+			ExpiresAt:       arg.ExpiresAt,
+			CreatedAt:       now,
+		}
+
+		s.onRollback(func() {
+			delete(s.data.exchangeQuotes, quote.ID)
+		})
+		s.data.exchangeQuotes[quote.ID] = quote
+		return nil
+	})
+
+	return quote, err
+}
+
+func (s *Store) GetExchangeQuote(ctx context.Context, id uuid.UUID) (repository.ExchangeQuote, error) {
+	var quote repository.ExchangeQuote
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if quote, ok = s.data.exchangeQuotes[id]; !ok || !s.visible(ctx, quote.FromWalletID) {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return quote, err
+}
+
+func (s *Store) ExecuteExchangeQuote(ctx context.Context, arg repository.ExecuteExchangeQuoteParams) (repository.ExchangeQuote, error) {
+	var quote repository.ExchangeQuote
+
+	err := s.write(ctx, func(time.Time) error {
+		current, ok := s.data.exchangeQuotes[arg.ID]
+		if !ok || !s.visible(ctx, current.FromWalletID) || current.FromOperationID != uuid.Nil {
+			return pgx.ErrNoRows
+		}
+
+		if s.operationIndex(arg.FromOperationID) < 0 {
+			return foreignKeyViolation("exchange_quotes", "exchange_quotes_from_operation_id_fkey")
+		}
+		if s.operationIndex(arg.ToOperationID) < 0 {
+			return foreignKeyViolation("exchange_quotes", "exchange_quotes_to_operation_id_fkey")
+		}
+
+		s.onRollback(func() {
+			s.data.exchangeQuotes[arg.ID] = current
+		})
+
+		quote = current
+		quote.FromOperationID = arg.FromOperationID
+		quote.ToOperationID = arg.ToOperationID
+		s.data.exchangeQuotes[arg.ID] = quote
+		return nil
+	})
+
+	return quote, err
+}
@@ -0,0 +1,323 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+// maxFeeRateBps mirrors the rate checks of the fee tables.
+const maxFeeRateBps = 10000
+
+func (s *Store) CreateFeeSchedule(ctx context.Context, arg repository.CreateFeeScheduleParams) (repository.FeeSchedule, error) {
+	var schedule repository.FeeSchedule
+
+	err := s.write(ctx, func(now time.Time) error {
+		schedule = repository.FeeSchedule{
+			ID:            uuid.New(),
+			OperationType: arg.OperationType,
+			ProductID:     arg.ProductID,
+			Kind:          arg.Kind,
+			FlatAmount:    arg.FlatAmount,
+			RateBps:       arg.RateBps,
+			MinFee:        arg.MinFee,
+			MaxFee:        arg.MaxFee,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		if err := s.checkFeeSchedule(schedule); err != nil {
+			return err
+		}
+
+		s.putFeeSchedule(schedule)
+		return nil
+	})
+
+	return schedule, err
+}
+
+func (s *Store) GetFeeSchedule(ctx context.Context, id uuid.UUID) (repository.FeeSchedule, error) {
+	var schedule repository.FeeSchedule
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if schedule, ok = s.data.feeSchedules[id]; !ok {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return schedule, err
+}
+
+// ListFeeSchedules orders by operation type with the default schedule, which
+// has no product, first, like NULLS FIRST.
+func (s *Store) ListFeeSchedules(ctx context.Context) ([]repository.FeeSchedule, error) {
+	var schedules []repository.FeeSchedule
+
+	err := s.read(ctx, func() error {
+		for _, fs := range s.data.feeSchedules {
+			schedules = append(schedules, fs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(schedules, func(a, b repository.FeeSchedule) int {
+		if c := strings.Compare(a.OperationType, b.OperationType); c != 0 {
+			return c
+		}
+		return compareUUID(a.ProductID, b.ProductID)
+	})
+
+	return schedules, nil
+}
+
+func (s *Store) UpdateFeeSchedule(ctx context.Context, arg repository.UpdateFeeScheduleParams) (repository.FeeSchedule, error) {
+	var schedule repository.FeeSchedule
+
+	err := s.write(ctx, func(now time.Time) error {
+		var ok bool
+		if schedule, ok = s.data.feeSchedules[arg.ID]; !ok {
+			return pgx.ErrNoRows
+		}
+
+		schedule.OperationType = arg.OperationType
+		schedule.ProductID = arg.ProductID
+		schedule.Kind = arg.Kind
+		schedule.FlatAmount = arg.FlatAmount
+		schedule.RateBps = arg.RateBps
+		schedule.MinFee = arg.MinFee
+		schedule.MaxFee = arg.MaxFee
+		schedule.UpdatedAt = now
+
+		if err := s.checkFeeSchedule(schedule); err != nil {
+			return err
+		}
+
+		s.putFeeSchedule(schedule)
+		return nil
+	})
+	if err != nil {
+		return repository.FeeSchedule{}, err
+	}
+
+	return schedule, nil
+}
+
+// DeleteFeeSchedule also deletes the tiers of the schedule, like ON DELETE
+// CASCADE.
+func (s *Store) DeleteFeeSchedule(ctx context.Context, id uuid.UUID) (int64, error) {
+	var deleted int64
+
+	err := s.write(ctx, func(time.Time) error {
+		schedule, ok := s.data.feeSchedules[id]
+		if !ok {
+			return nil
+		}
+
+		tiers := s.data.feeTiers[id]
+		s.onRollback(func() {
+			s.data.feeSchedules[id] = schedule
+			if tiers != nil {
+				s.data.feeTiers[id] = tiers
+			}
+		})
+
+		delete(s.data.feeSchedules, id)
+		delete(s.data.feeTiers, id)
+		deleted = 1
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+func (s *Store) SetWalletProduct(ctx context.Context, arg repository.SetWalletProductParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		if _, ok := s.data.products[arg.ProductID]; arg.ProductID != uuid.Nil && !ok {
+			return foreignKeyViolation("wallets", "wallets_product_id_fkey")
+		}
+		w.ProductID = arg.ProductID
+		return nil
+	})
+}
+
+// GetWalletFeeSchedule prefers the schedule of the wallet's product to the
+// default one.
+func (s *Store) GetWalletFeeSchedule(ctx context.Context, arg repository.GetWalletFeeScheduleParams) (repository.FeeSchedule, error) {
+	var schedule repository.FeeSchedule
+
+	err := s.read(ctx, func() error {
+		productID := s.data.wallets[arg.WalletID].ProductID
+
+		found := false
+		for _, fs := range s.data.feeSchedules {
+			if fs.OperationType != arg.OperationType {
+				continue
+			}
+			if fs.ProductID != uuid.Nil && (productID == uuid.Nil || fs.ProductID != productID) {
+				continue
+			}
+			if !found || fs.ProductID != uuid.Nil {
+				schedule, found = fs, true
+			}
+		}
+
+		if !found {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return schedule, err
+}
+
+func (s *Store) CreateFeeTier(ctx context.Context, arg repository.CreateFeeTierParams) error {
+	return s.write(ctx, func(time.Time) error {
+		const table = "fee_tiers"
+
+		switch {
+		case arg.MinAmount < 0:
+			return checkViolation(table, "fee_tiers_min_amount_check")
+		case arg.FlatAmount < 0:
+			return checkViolation(table, "fee_tiers_flat_amount_check")
+		case arg.RateBps < 0 || arg.RateBps > maxFeeRateBps:
+			return checkViolation(table, "fee_tiers_rate_bps_check")
+		}
+
+		if _, ok := s.data.feeSchedules[arg.ScheduleID]; !ok {
+			return foreignKeyViolation(table, "fee_tiers_schedule_id_fkey")
+		}
+
+		prev := s.data.feeTiers[arg.ScheduleID]
+		for _, t := range prev {
+			if t.MinAmount == arg.MinAmount {
+				return &pgconn.PgError{
+					Code:           codeUniqueViolation,
+					Message:        `duplicate key value violates unique constraint "fee_tiers_pkey"`,
+					ConstraintName: "fee_tiers_pkey",
+				}
+			}
+		}
+
+		tiers := append(slices.Clone(prev), repository.FeeTier{
+			ScheduleID: arg.ScheduleID,
+			MinAmount:  arg.MinAmount,
+			FlatAmount: arg.FlatAmount,
+			RateBps:    arg.RateBps,
+		})
+		slices.SortFunc(tiers, func(a, b repository.FeeTier) int {
+			return cmp.Compare(a.MinAmount, b.MinAmount)
+		})
+
+		s.putFeeTiers(arg.ScheduleID, tiers)
+		return nil
+	})
+}
+
+func (s *Store) ListFeeTiers(ctx context.Context, scheduleID uuid.UUID) ([]repository.FeeTier, error) {
+	var tiers []repository.FeeTier
+
+	err := s.read(ctx, func() error {
+		tiers = slices.Clone(s.data.feeTiers[scheduleID])
+		return nil
+	})
+
+	return tiers, err
+}
+
+func (s *Store) DeleteFeeTiers(ctx context.Context, scheduleID uuid.UUID) error {
+	return s.write(ctx, func(time.Time) error {
+		s.putFeeTiers(scheduleID, nil)
+		return nil
+	})
+}
+
+func (s *Store) putFeeSchedule(schedule repository.FeeSchedule) {
+	prev, existed := s.data.feeSchedules[schedule.ID]
+	s.onRollback(func() {
+		if existed {
+			s.data.feeSchedules[schedule.ID] = prev
+		} else {
+			delete(s.data.feeSchedules, schedule.ID)
+		}
+	})
+
+	s.data.feeSchedules[schedule.ID] = schedule
+}
+
+func (s *Store) putFeeTiers(scheduleID uuid.UUID, tiers []repository.FeeTier) {
+	prev, existed := s.data.feeTiers[scheduleID]
+	s.onRollback(func() {
+		if existed {
+			s.data.feeTiers[scheduleID] = prev
+		} else {
+			delete(s.data.feeTiers, scheduleID)
+		}
+	})
+
+	if tiers == nil {
+		delete(s.data.feeTiers, scheduleID)
+	} else {
+		s.data.feeTiers[scheduleID] = tiers
+	}
+}
+
+// checkFeeSchedule enforces the constraints of fee_schedules.
+func (s *Store) checkFeeSchedule(schedule repository.FeeSchedule) error {
+	const table = "fee_schedules"
+
+	switch models.OperationType(schedule.OperationType) {
+	case models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer:
+	default:
+		return checkViolation(table, "fee_schedules_operation_type_check")
+	}
+
+	switch models.FeeKind(schedule.Kind) {
+	case models.FeeKindFlat, models.FeeKindPercentage, models.FeeKindTiered:
+	default:
+		return checkViolation(table, "fee_schedules_kind_check")
+	}
+
+	switch {
+	case schedule.FlatAmount < 0:
+		return checkViolation(table, "fee_schedules_flat_amount_check")
+	case schedule.RateBps < 0 || schedule.RateBps > maxFeeRateBps:
+		return checkViolation(table, "fee_schedules_rate_bps_check")
+	case schedule.MinFee < 0:
+		return checkViolation(table, "fee_schedules_min_fee_check")
+	case schedule.MaxFee < 0:
+		return checkViolation(table, "fee_schedules_max_fee_check")
+	case schedule.MaxFee != 0 && schedule.MaxFee < schedule.MinFee:
+		return checkViolation(table, "fee_schedules_check")
+	}
+
+	if _, ok := s.data.products[schedule.ProductID]; schedule.ProductID != uuid.Nil && !ok {
+		return foreignKeyViolation(table, "fee_schedules_product_id_fkey")
+	}
+
+	for _, fs := range s.data.feeSchedules {
+		if fs.OperationType == schedule.OperationType && fs.ProductID == schedule.ProductID && fs.ID != schedule.ID {
+			return &pgconn.PgError{
+				Code:           codeUniqueViolation,
+				Message:        `duplicate key value violates unique constraint "fee_schedules_operation_type_product_id_key"`,
+				ConstraintName: "fee_schedules_operation_type_product_id_key",
+			}
+		}
+	}
+
+	return nil
+}
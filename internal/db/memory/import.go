@@ -0,0 +1,496 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+func (s *Store) CreateImport(ctx context.Context, arg repository.CreateImportParams) (repository.Import, error) {
+	var imp repository.Import
+
+	err := s.write(ctx, func(now time.Time) error {
+		if arg.TotalRows < 0 {
+			return checkViolation("imports", "imports_total_rows_check")
+		}
+		tenant, ok := service.TenantFrom(ctx)
+		if !ok {
+			tenant = service.DefaultTenantID
+		}
+		if _, ok := s.importByFileHash(tenant, arg.FileHash); ok {
+			return &pgconn.PgError{
+				Code:           codeUniqueViolation,
+				Message:        `duplicate key value violates unique constraint "imports_file_hash_key"`,
+				ConstraintName: "imports_file_hash_key",
+			}
+		}
+
+		imp = repository.Import{
+			ID:          uuid.New(),
+			Status:      string(models.ImportStatusPending),
+			SkipInvalid: arg.SkipInvalid,
+			TotalRows:   arg.TotalRows,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			FileHash:    arg.FileHash,
+			TenantID:    tenant,
+		}
+
+		s.putImport(imp)
+		return nil
+	})
+
+	return imp, err
+}
+
+func (s *Store) GetImport(ctx context.Context, id uuid.UUID) (repository.Import, error) {
+	var imp repository.Import
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if imp, ok = s.importOf(ctx, id); !ok {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return imp, err
+}
+
+func (s *Store) GetImportByFileHash(ctx context.Context, fileHash string) (repository.Import, error) {
+	var imp repository.Import
+
+	err := s.read(ctx, func() error {
+		for _, i := range s.data.imports {
+			if i.FileHash == fileHash && i.Status != string(models.ImportStatusRejected) && s.importVisible(ctx, i) {
+				imp = i
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+
+	return imp, err
+}
+
+// importByFileHash finds the import of a tenant holding a file, as the
+// partial unique index on tenant_id and file_hash does.
+func (s *Store) importByFileHash(tenant uuid.UUID, fileHash string) (repository.Import, bool) {
+	if fileHash == "" {
+		return repository.Import{}, false
+	}
+
+	for _, imp := range s.data.imports {
+		if imp.TenantID == tenant && imp.FileHash == fileHash && imp.Status != string(models.ImportStatusRejected) {
+			return imp, true
+		}
+	}
+	return repository.Import{}, false
+}
+
+// ClaimImport returns a pending import. The transaction holds the store
+// lock, which stands in for the row lock.
+func (s *Store) ClaimImport(ctx context.Context, id uuid.UUID) (repository.Import, error) {
+	var imp repository.Import
+
+	err := s.write(ctx, func(time.Time) error {
+		var ok bool
+		if imp, ok = s.importOf(ctx, id); !ok || imp.Status != string(models.ImportStatusPending) {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return imp, err
+}
+
+func (s *Store) ListPendingImports(ctx context.Context, arg repository.ListPendingImportsParams) ([]repository.Import, error) {
+	var pending []repository.Import
+
+	err := s.read(ctx, func() error {
+		if arg.PageSize < 0 {
+			return negativeLimit()
+		}
+
+		for _, imp := range s.data.imports {
+			if imp.Status == string(models.ImportStatusPending) && imp.UpdatedAt.Before(arg.Before) && s.importVisible(ctx, imp) {
+				pending = append(pending, imp)
+			}
+		}
+
+		slices.SortFunc(pending, func(a, b repository.Import) int {
+			return cmp.Or(a.UpdatedAt.Compare(b.UpdatedAt), compareUUID(a.ID, b.ID))
+		})
+
+		pending = pending[:min(len(pending), int(arg.PageSize))]
+		return nil
+	})
+
+	return pending, err
+}
+
+func (s *Store) FinishImport(ctx context.Context, arg repository.FinishImportParams) (repository.Import, error) {
+	var imp repository.Import
+
+	err := s.write(ctx, func(now time.Time) error {
+		var ok bool
+		if imp, ok = s.importOf(ctx, arg.ID); !ok {
+			return pgx.ErrNoRows
+		}
+
+		switch models.ImportStatus(arg.Status) {
+		case models.ImportStatusPending, models.ImportStatusApplied, models.ImportStatusRejected:
+		default:
+			return checkViolation("imports", "imports_status_check")
+		}
+
+		imp.Status = arg.Status
+		imp.AppliedRows = arg.AppliedRows
+		imp.FailedRows = arg.FailedRows
+		imp.UpdatedAt = now
+
+		s.putImport(imp)
+		return nil
+	})
+	if err != nil {
+		return repository.Import{}, err
+	}
+
+	return imp, nil
+}
+
+// CreateImportRows inserts all rows or, like a failed COPY, none.
+func (s *Store) CreateImportRows(ctx context.Context, arg []repository.CreateImportRowsParams) (int64, error) {
+	err := s.write(ctx, func(time.Time) error {
+		added := make(map[uuid.UUID][]repository.ImportRow)
+
+		for _, a := range arg {
+			if _, ok := s.data.imports[a.ImportID]; !ok {
+				return foreignKeyViolation("import_rows", "import_rows_import_id_fkey")
+			}
+
+			rows, ok := added[a.ImportID]
+			if !ok {
+				rows = slices.Clone(s.data.importRows[a.ImportID])
+			}
+
+			for _, r := range rows {
+				if r.RowNumber == a.RowNumber {
+					return &pgconn.PgError{
+						Code:           codeUniqueViolation,
+						Message:        `duplicate key value violates unique constraint "import_rows_pkey"`,
+						ConstraintName: "import_rows_pkey",
+					}
+				}
+			}
+
+			added[a.ImportID] = append(rows, repository.ImportRow(a))
+		}
+
+		for id, rows := range added {
+			slices.SortFunc(rows, func(a, b repository.ImportRow) int {
+				return cmp.Compare(a.RowNumber, b.RowNumber)
+			})
+			s.putImportRows(id, rows)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(arg)), nil
+}
+
+func (s *Store) ListImportRows(ctx context.Context, arg repository.ListImportRowsParams) ([]repository.ImportRow, error) {
+	var rows []repository.ImportRow
+
+	err := s.read(ctx, func() error {
+		if arg.PageSize < 0 {
+			return negativeLimit()
+		}
+
+		for _, r := range s.data.importRows[arg.ImportID] {
+			if len(rows) == int(arg.PageSize) {
+				break
+			}
+			if r.RowNumber > arg.AfterRow {
+				rows = append(rows, r)
+			}
+		}
+		return nil
+	})
+
+	return rows, err
+}
+
+func (s *Store) ListImportErrors(ctx context.Context, importID uuid.UUID) ([]repository.ImportRow, error) {
+	var rows []repository.ImportRow
+
+	err := s.read(ctx, func() error {
+		for _, r := range s.data.importRows[importID] {
+			if r.Error != "" {
+				rows = append(rows, r)
+			}
+		}
+		return nil
+	})
+
+	return rows, err
+}
+
+func (s *Store) SetImportRowError(ctx context.Context, arg repository.SetImportRowErrorParams) error {
+	return s.write(ctx, func(time.Time) error {
+		rows := s.data.importRows[arg.ImportID]
+
+		i := slices.IndexFunc(rows, func(r repository.ImportRow) bool {
+			return r.RowNumber == arg.RowNumber
+		})
+		if i < 0 {
+			return nil
+		}
+
+		rows = slices.Clone(rows)
+		rows[i].Error = arg.Error
+		s.putImportRows(arg.ImportID, rows)
+		return nil
+	})
+}
+
+func (s *Store) SetImportRowErrors(ctx context.Context, arg repository.SetImportRowErrorsParams) error {
+	return s.write(ctx, func(time.Time) error {
+		rows := slices.Clone(s.data.importRows[arg.ImportID])
+		for i, r := range rows {
+			if j := slices.Index(arg.RowNumbers, r.RowNumber); j >= 0 {
+				rows[i].Error = arg.Errors[j]
+			}
+		}
+
+		s.putImportRows(arg.ImportID, rows)
+		return nil
+	})
+}
+
+// importOf returns an import, if the tenant of ctx may see it, like the
+// row-level security policy of imports.
+func (s *Store) importOf(ctx context.Context, id uuid.UUID) (repository.Import, bool) {
+	imp, ok := s.data.imports[id]
+	if !ok || !s.importVisible(ctx, imp) {
+		return repository.Import{}, false
+	}
+	return imp, true
+}
+
+func (s *Store) importVisible(ctx context.Context, imp repository.Import) bool {
+	tenant, ok := service.TenantFrom(ctx)
+	return !ok || imp.TenantID == tenant
+}
+
+func (s *Store) putImport(imp repository.Import) {
+	prev, existed := s.data.imports[imp.ID]
+	s.onRollback(func() {
+		if existed {
+			s.data.imports[imp.ID] = prev
+		} else {
+			delete(s.data.imports, imp.ID)
+		}
+	})
+
+	s.data.imports[imp.ID] = imp
+}
+
+func (s *Store) putImportRows(importID uuid.UUID, rows []repository.ImportRow) {
+	prev, existed := s.data.importRows[importID]
+	s.onRollback(func() {
+		if existed {
+			s.data.importRows[importID] = prev
+		} else {
+			delete(s.data.importRows, importID)
+		}
+	})
+
+	s.data.importRows[importID] = rows
+}
+
+func (s *Store) LockImportWallets(ctx context.Context, importID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+
+	err := s.write(ctx, func(time.Time) error {
+		for _, r := range s.data.importRows[importID] {
+			if _, ok := s.importWallet(ctx, r); ok && !slices.Contains(ids, r.WalletID) {
+				ids = append(ids, r.WalletID)
+			}
+		}
+		slices.SortFunc(ids, compareUUID)
+		return nil
+	})
+
+	return ids, err
+}
+
+func (s *Store) CheckImportRows(ctx context.Context, arg repository.CheckImportRowsParams) (int64, error) {
+	var marked int64
+
+	err := s.write(ctx, func(time.Time) error {
+		rows := slices.Clone(s.data.importRows[arg.ImportID])
+		for i, r := range rows {
+			if r.Error != "" {
+				continue
+			}
+
+			wallet, ok := s.data.wallets[r.WalletID]
+			switch {
+			case !ok || !s.visible(ctx, r.WalletID):
+				rows[i].Error = arg.WalletNotFound
+			case wallet.Status != string(models.WalletStatusActive):
+				rows[i].Error = arg.WalletFrozen
+			default:
+				continue
+			}
+			marked++
+		}
+
+		if marked > 0 {
+			s.putImportRows(arg.ImportID, rows)
+		}
+		return nil
+	})
+
+	return marked, err
+}
+
+func (s *Store) ListImportRowBalances(ctx context.Context, importID uuid.UUID) ([]repository.ListImportRowBalancesRow, error) {
+	var rows []repository.ListImportRowBalancesRow
+
+	err := s.read(ctx, func() error {
+		for _, r := range s.data.importRows[importID] {
+			wallet, ok := s.importWallet(ctx, r)
+			if !ok || wallet.ShardCount != 0 {
+				continue
+			}
+
+			rows = append(rows, repository.ListImportRowBalancesRow{
+				RowNumber:     r.RowNumber,
+				WalletID:      r.WalletID,
+				OperationType: r.OperationType,
+				Amount:        r.Amount,
+				Balance:       wallet.Balance,
+			})
+		}
+		return nil
+	})
+
+	slices.SortStableFunc(rows, func(a, b repository.ListImportRowBalancesRow) int {
+		return compareUUID(a.WalletID, b.WalletID)
+	})
+
+	return rows, err
+}
+
+func (s *Store) ApplyImportRows(ctx context.Context, importID uuid.UUID) (int32, error) {
+	var applied int32
+
+	err := s.write(ctx, func(now time.Time) error {
+		var (
+			ops     []repository.Operation
+			wallets []uuid.UUID
+			totals  = make(map[uuid.UUID]int32)
+		)
+
+		for _, r := range s.data.importRows[importID] {
+			wallet, ok := s.importWallet(ctx, r)
+			if !ok || wallet.ShardCount != 0 {
+				continue
+			}
+
+			op := newOperation(r.WalletID, r.OperationType, importAmount(r), now)
+			op.ImportID = importID
+			op.Reference = r.Reference
+			ops = append(ops, op)
+
+			if _, ok := totals[r.WalletID]; !ok {
+				wallets = append(wallets, r.WalletID)
+			}
+			totals[r.WalletID] += op.Amount
+		}
+		slices.SortFunc(wallets, compareUUID)
+
+		entry := repository.JournalEntry{ID: uuid.New(), Description: "IMPORT", CreatedAt: now}
+		var legs []repository.JournalLeg
+		for _, id := range wallets {
+			amount := totals[id]
+			if amount == 0 {
+				continue
+			}
+
+			wallet := s.data.wallets[id]
+			balance, err := addInt32(wallet.Balance, amount)
+			if err != nil {
+				return err
+			}
+			wallet.Balance = balance
+			s.putWallet(wallet)
+
+			legs = append(legs,
+				repository.JournalLeg{EntryID: entry.ID, Account: string(models.JournalAccountWallet), WalletID: id,
+					Debit: max(-amount, 0), Credit: max(amount, 0), Currency: wallet.Currency},
+				repository.JournalLeg{EntryID: entry.ID, Account: string(models.JournalAccountAdjustments),
+					Debit: max(amount, 0), Credit: max(-amount, 0), Currency: wallet.Currency},
+			)
+		}
+
+		s.appendOperations(ops...)
+		if len(legs) > 0 {
+			for i := range legs {
+				legs[i].Leg = int32(i + 1)
+			}
+			s.appendJournalEntry(entry, legs)
+		}
+
+		applied = int32(len(ops))
+		return nil
+	})
+
+	return applied, err
+}
+
+func (s *Store) ListShardedImportRows(ctx context.Context, importID uuid.UUID) ([]repository.ImportRow, error) {
+	var rows []repository.ImportRow
+
+	err := s.read(ctx, func() error {
+		for _, r := range s.data.importRows[importID] {
+			if wallet, ok := s.importWallet(ctx, r); ok && wallet.ShardCount > 0 {
+				rows = append(rows, r)
+			}
+		}
+		return nil
+	})
+
+	return rows, err
+}
+
+// importWallet returns the wallet of a valid row, if it is visible.
+func (s *Store) importWallet(ctx context.Context, r repository.ImportRow) (repository.Wallet, bool) {
+	if r.Error != "" || !s.visible(ctx, r.WalletID) {
+		return repository.Wallet{}, false
+	}
+
+	wallet, ok := s.data.wallets[r.WalletID]
+	return wallet, ok
+}
+
+// importAmount is the signed amount a row changes its wallet by.
+func importAmount(r repository.ImportRow) int32 {
+	if r.OperationType == string(models.OperationWithdraw) {
+		return -r.Amount
+	}
+	return r.Amount
+}
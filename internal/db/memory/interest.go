@@ -0,0 +1,538 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+// maxAnnualRateBps mirrors the rate checks of the interest tables.
+const maxAnnualRateBps = 100000
+
+func (s *Store) CreateInterestProduct(ctx context.Context, arg repository.CreateInterestProductParams) (repository.InterestProduct, error) {
+	var product repository.InterestProduct
+
+	err := s.write(ctx, func(now time.Time) error {
+		product = repository.InterestProduct{
+			ID:            uuid.New(),
+			Name:          arg.Name,
+			AnnualRateBps: arg.AnnualRateBps,
+			DayCount:      arg.DayCount,
+			Rounding:      arg.Rounding,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		if err := s.checkInterestProduct(product); err != nil {
+			return err
+		}
+
+		s.putInterestProduct(product)
+		return nil
+	})
+
+	return product, err
+}
+
+func (s *Store) GetInterestProduct(ctx context.Context, id uuid.UUID) (repository.InterestProduct, error) {
+	var product repository.InterestProduct
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if product, ok = s.data.products[id]; !ok {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return product, err
+}
+
+func (s *Store) ListInterestProducts(ctx context.Context) ([]repository.InterestProduct, error) {
+	var products []repository.InterestProduct
+
+	err := s.read(ctx, func() error {
+		for _, p := range s.data.products {
+			products = append(products, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(products, func(a, b repository.InterestProduct) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return products, nil
+}
+
+func (s *Store) UpdateInterestProduct(ctx context.Context, arg repository.UpdateInterestProductParams) (repository.InterestProduct, error) {
+	var product repository.InterestProduct
+
+	err := s.write(ctx, func(now time.Time) error {
+		var ok bool
+		if product, ok = s.data.products[arg.ID]; !ok {
+			return pgx.ErrNoRows
+		}
+
+		product.Name = arg.Name
+		product.AnnualRateBps = arg.AnnualRateBps
+		product.DayCount = arg.DayCount
+		product.Rounding = arg.Rounding
+		product.UpdatedAt = now
+
+		if err := s.checkInterestProduct(product); err != nil {
+			return err
+		}
+
+		s.putInterestProduct(product)
+		return nil
+	})
+	if err != nil {
+		return repository.InterestProduct{}, err
+	}
+
+	return product, nil
+}
+
+// SetWalletInterest inserts or updates the row, like INSERT ... ON CONFLICT
+// DO UPDATE, keeping created_at of an existing one.
+func (s *Store) SetWalletInterest(ctx context.Context, arg repository.SetWalletInterestParams) (repository.WalletInterest, error) {
+	var wi repository.WalletInterest
+
+	err := s.write(ctx, func(now time.Time) error {
+		const table = "wallet_interest"
+
+		if _, ok := s.data.wallets[arg.WalletID]; !ok {
+			return foreignKeyViolation(table, "wallet_interest_wallet_id_fkey")
+		}
+		if !s.visible(ctx, arg.WalletID) {
+			return rowSecurityViolation(table)
+		}
+		if _, ok := s.data.products[arg.ProductID]; arg.ProductID != uuid.Nil && !ok {
+			return foreignKeyViolation(table, "wallet_interest_product_id_fkey")
+		}
+		if rate := arg.AnnualRateBps; rate.Valid && (rate.Int32 < 0 || rate.Int32 > maxAnnualRateBps) {
+			return checkViolation(table, "wallet_interest_annual_rate_bps_check")
+		}
+		if arg.ProductID == uuid.Nil && !arg.AnnualRateBps.Valid {
+			return checkViolation(table, "wallet_interest_check")
+		}
+
+		prev, existed := s.data.walletInterest[arg.WalletID]
+		s.onRollback(func() {
+			if existed {
+				s.data.walletInterest[arg.WalletID] = prev
+			} else {
+				delete(s.data.walletInterest, arg.WalletID)
+			}
+		})
+
+		wi = repository.WalletInterest{
+			WalletID:      arg.WalletID,
+			ProductID:     arg.ProductID,
+			AnnualRateBps: arg.AnnualRateBps,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if existed {
+			wi.CreatedAt = prev.CreatedAt
+		}
+
+		s.data.walletInterest[arg.WalletID] = wi
+		return nil
+	})
+
+	return wi, err
+}
+
+func (s *Store) GetWalletInterest(ctx context.Context, walletID uuid.UUID) (repository.WalletInterest, error) {
+	var wi repository.WalletInterest
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if wi, ok = s.data.walletInterest[walletID]; !ok || !s.visible(ctx, walletID) {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return wi, err
+}
+
+func (s *Store) DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	var deleted int64
+
+	err := s.write(ctx, func(time.Time) error {
+		wi, ok := s.data.walletInterest[walletID]
+		if !ok || !s.visible(ctx, walletID) {
+			return nil
+		}
+
+		s.onRollback(func() {
+			s.data.walletInterest[walletID] = wi
+		})
+
+		delete(s.data.walletInterest, walletID)
+		deleted = 1
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+func (s *Store) GetInterestTerms(ctx context.Context, walletID uuid.UUID) (repository.WalletInterestTerm, error) {
+	var terms repository.WalletInterestTerm
+
+	err := s.read(ctx, func() error {
+		wi, ok := s.data.walletInterest[walletID]
+		if !ok || !s.visible(ctx, walletID) {
+			return pgx.ErrNoRows
+		}
+		terms = s.interestTerms(wi)
+		return nil
+	})
+
+	return terms, err
+}
+
+func (s *Store) ListInterestTerms(ctx context.Context, arg repository.ListInterestTermsParams) ([]repository.WalletInterestTerm, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var terms []repository.WalletInterestTerm
+
+	err := s.read(ctx, func() error {
+		for _, wi := range s.data.walletInterest {
+			if compareUUID(wi.WalletID, arg.AfterWalletID) > 0 && s.visible(ctx, wi.WalletID) {
+				terms = append(terms, s.interestTerms(wi))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(terms, func(a, b repository.WalletInterestTerm) int {
+		return compareUUID(a.WalletID, b.WalletID)
+	})
+
+	return terms[:min(len(terms), int(arg.PageSize))], nil
+}
+
+// interestTerms computes a row of the wallet_interest_terms view.
+func (s *Store) interestTerms(wi repository.WalletInterest) repository.WalletInterestTerm {
+	terms := repository.WalletInterestTerm{
+		WalletID:      wi.WalletID,
+		CreatedAt:     wi.CreatedAt,
+		AnnualRateBps: wi.AnnualRateBps.Int32,
+	}
+
+	if product, ok := s.data.products[wi.ProductID]; ok {
+		if !wi.AnnualRateBps.Valid {
+			terms.AnnualRateBps = product.AnnualRateBps
+		}
+		terms.DayCount = product.DayCount
+		terms.Rounding = product.Rounding
+	}
+
+	return terms
+}
+
+func (s *Store) GetWalletBalanceAt(ctx context.Context, arg repository.GetWalletBalanceAtParams) (int64, error) {
+	var balance int64
+
+	err := s.read(ctx, func() error {
+		for _, op := range s.data.operations {
+			if op.WalletID == arg.WalletID && op.CreatedAt.Before(arg.Before) && s.visible(ctx, op.WalletID) {
+				balance += int64(op.Amount)
+			}
+		}
+		return nil
+	})
+
+	return balance, err
+}
+
+// CreateInterestAccrual skips an existing accrual of the day, like ON
+// CONFLICT DO NOTHING.
+func (s *Store) CreateInterestAccrual(ctx context.Context, arg repository.CreateInterestAccrualParams) (int64, error) {
+	var created int64
+
+	err := s.write(ctx, func(now time.Time) error {
+		if _, ok := s.data.wallets[arg.WalletID]; !ok {
+			return foreignKeyViolation("interest_accruals", "interest_accruals_wallet_id_fkey")
+		}
+		if !s.visible(ctx, arg.WalletID) {
+			return rowSecurityViolation("interest_accruals")
+		}
+
+		day := date(arg.AccrualDate)
+		for _, a := range s.data.accruals {
+			if a.WalletID == arg.WalletID && a.AccrualDate.Equal(day) {
+				return nil
+			}
+		}
+
+		s.putAccruals(append(slices.Clone(s.data.accruals), repository.InterestAccrual{
+			WalletID:      arg.WalletID,
+			AccrualDate:   day,
+			Balance:       arg.Balance,
+			AnnualRateBps: arg.AnnualRateBps,
+			DayCount:      arg.DayCount,
+			AmountMicros:  arg.AmountMicros,
+			CreatedAt:     now,
+		}))
+		created = 1
+
+		return nil
+	})
+
+	return created, err
+}
+
+func (s *Store) ListInterestAccruals(ctx context.Context, arg repository.ListInterestAccrualsParams) ([]repository.InterestAccrual, error) {
+	var accruals []repository.InterestAccrual
+
+	err := s.read(ctx, func() error {
+		from := date(arg.FromDate)
+		for _, a := range s.data.accruals {
+			if a.WalletID == arg.WalletID && !a.AccrualDate.Before(from) && s.visible(ctx, a.WalletID) {
+				accruals = append(accruals, a)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(accruals, func(a, b repository.InterestAccrual) int {
+		return a.AccrualDate.Compare(b.AccrualDate)
+	})
+
+	return accruals, nil
+}
+
+func (s *Store) ListWalletsWithUnpaidInterest(ctx context.Context, arg repository.ListWalletsWithUnpaidInterestParams) ([]uuid.UUID, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var walletIDs []uuid.UUID
+
+	err := s.read(ctx, func() error {
+		before := date(arg.BeforeDate)
+		for _, a := range s.data.accruals {
+			if !a.Paid && a.AccrualDate.Before(before) && compareUUID(a.WalletID, arg.AfterWalletID) > 0 &&
+				s.visible(ctx, a.WalletID) && !slices.Contains(walletIDs, a.WalletID) {
+				walletIDs = append(walletIDs, a.WalletID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(walletIDs, compareUUID)
+
+	return walletIDs[:min(len(walletIDs), int(arg.PageSize))], nil
+}
+
+func (s *Store) MarkInterestAccrualsPaid(ctx context.Context, arg repository.MarkInterestAccrualsPaidParams) (int64, error) {
+	var accrued int64
+
+	err := s.write(ctx, func(time.Time) error {
+		before := date(arg.BeforeDate)
+		accruals := slices.Clone(s.data.accruals)
+
+		for i, a := range accruals {
+			if a.WalletID == arg.WalletID && !a.Paid && a.AccrualDate.Before(before) && s.visible(ctx, a.WalletID) {
+				accruals[i].Paid = true
+				accrued += a.AmountMicros
+			}
+		}
+
+		s.putAccruals(accruals)
+		return nil
+	})
+
+	return accrued, err
+}
+
+func (s *Store) GetUnpaidInterest(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	var accrued int64
+
+	err := s.read(ctx, func() error {
+		for _, a := range s.data.accruals {
+			if a.WalletID == walletID && !a.Paid && s.visible(ctx, a.WalletID) {
+				accrued += a.AmountMicros
+			}
+		}
+		return nil
+	})
+
+	return accrued, err
+}
+
+func (s *Store) GetLatestInterestPayout(ctx context.Context, walletID uuid.UUID) (repository.InterestPayout, error) {
+	payouts, err := s.ListInterestPayouts(ctx, repository.ListInterestPayoutsParams{WalletID: walletID, Limit: 1})
+	if err != nil {
+		return repository.InterestPayout{}, err
+	}
+	if len(payouts) == 0 {
+		return repository.InterestPayout{}, pgx.ErrNoRows
+	}
+	return payouts[0], nil
+}
+
+// CreateInterestPayout skips a payout of a month already paid, like ON
+// CONFLICT DO NOTHING.
+func (s *Store) CreateInterestPayout(ctx context.Context, arg repository.CreateInterestPayoutParams) (int64, error) {
+	var created int64
+
+	err := s.write(ctx, func(now time.Time) error {
+		const table = "interest_payouts"
+
+		period := date(arg.Period)
+		switch {
+		case period.Day() != 1:
+			return checkViolation(table, "interest_payouts_period_check")
+		case arg.Amount < 0:
+			return checkViolation(table, "interest_payouts_amount_check")
+		}
+		if _, ok := s.data.wallets[arg.WalletID]; !ok {
+			return foreignKeyViolation(table, "interest_payouts_wallet_id_fkey")
+		}
+		if !s.visible(ctx, arg.WalletID) {
+			return rowSecurityViolation(table)
+		}
+
+		for _, p := range s.data.payouts {
+			if p.WalletID == arg.WalletID && p.Period.Equal(period) {
+				return nil
+			}
+		}
+
+		n := len(s.data.payouts)
+		s.onRollback(func() {
+			s.data.payouts = s.data.payouts[:n]
+		})
+		s.data.payouts = append(s.data.payouts, repository.InterestPayout{
+			WalletID:      arg.WalletID,
+			Period:        period,
+			AccruedMicros: arg.AccruedMicros,
+			Amount:        arg.Amount,
+			CarryMicros:   arg.CarryMicros,
+			CreatedAt:     now,
+		})
+		created = 1
+
+		return nil
+	})
+
+	return created, err
+}
+
+func (s *Store) ListInterestPayouts(ctx context.Context, arg repository.ListInterestPayoutsParams) ([]repository.InterestPayout, error) {
+	if arg.Limit < 0 {
+		return nil, negativeLimit()
+	}
+
+	var payouts []repository.InterestPayout
+
+	err := s.read(ctx, func() error {
+		for _, p := range s.data.payouts {
+			if p.WalletID == arg.WalletID && s.visible(ctx, p.WalletID) {
+				payouts = append(payouts, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(payouts, func(a, b repository.InterestPayout) int {
+		return b.Period.Compare(a.Period)
+	})
+
+	return payouts[:min(len(payouts), int(arg.Limit))], nil
+}
+
+func (s *Store) putInterestProduct(product repository.InterestProduct) {
+	prev, existed := s.data.products[product.ID]
+	s.onRollback(func() {
+		if existed {
+			s.data.products[product.ID] = prev
+		} else {
+			delete(s.data.products, product.ID)
+		}
+	})
+
+	s.data.products[product.ID] = product
+}
+
+// putAccruals replaces the accruals with an updated copy.
+func (s *Store) putAccruals(accruals []repository.InterestAccrual) {
+	prev := s.data.accruals
+	s.onRollback(func() {
+		s.data.accruals = prev
+	})
+
+	s.data.accruals = accruals
+}
+
+// checkInterestProduct enforces the constraints of interest_products.
+func (s *Store) checkInterestProduct(product repository.InterestProduct) error {
+	const table = "interest_products"
+
+	switch {
+	case product.Name == "":
+		return checkViolation(table, "interest_products_name_check")
+	case product.AnnualRateBps < 0 || product.AnnualRateBps > maxAnnualRateBps:
+		return checkViolation(table, "interest_products_annual_rate_bps_check")
+	}
+
+	switch models.DayCount(product.DayCount) {
+	case models.DayCountAct365, models.DayCountAct360, models.DayCountActAct:
+	default:
+		return checkViolation(table, "interest_products_day_count_check")
+	}
+
+	switch models.Rounding(product.Rounding) {
+	case models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown:
+	default:
+		return checkViolation(table, "interest_products_rounding_check")
+	}
+
+	for _, p := range s.data.products {
+		if p.Name == product.Name && p.ID != product.ID {
+			return &pgconn.PgError{
+				Code:           codeUniqueViolation,
+				Message:        `duplicate key value violates unique constraint "interest_products_name_key"`,
+				ConstraintName: "interest_products_name_key",
+			}
+		}
+	}
+
+	return nil
+}
+
+// date truncates t to the date Postgres stores for it.
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+func (s *Store) CreateJournalEntry(ctx context.Context, arg repository.CreateJournalEntryParams) (repository.CreateJournalEntryRow, error) {
+	var row repository.CreateJournalEntryRow
+
+	err := s.write(ctx, func(now time.Time) error {
+		// Legs past the end of the other arrays get NULLs.
+		legs := make([]repository.JournalLeg, len(arg.Accounts))
+		for i, account := range arg.Accounts {
+			if i >= len(arg.Debits) || i >= len(arg.Credits) {
+				return &pgconn.PgError{Code: codeNotNullViolation, Message: `null value in column violates not-null constraint`}
+			}
+
+			legs[i] = repository.JournalLeg{
+				Leg:     int32(i + 1),
+				Account: account,
+				Debit:   arg.Debits[i],
+				Credit:  arg.Credits[i],
+			}
+			if i < len(arg.WalletIds) {
+				legs[i].WalletID = arg.WalletIds[i]
+			}
+			if i < len(arg.Currencies) {
+				legs[i].Currency = arg.Currencies[i]
+			}
+		}
+
+		entryCurrency := s.entryCurrency(ctx, arg.WalletIds)
+		totals := make(map[string][2]int64)
+		for i := range legs {
+			if legs[i].Currency == "" {
+				legs[i].Currency = entryCurrency
+				if wallet, ok := s.data.wallets[legs[i].WalletID]; ok && s.visible(ctx, wallet.ID) {
+					legs[i].Currency = wallet.Currency
+				}
+			}
+
+			total := totals[legs[i].Currency]
+			totals[legs[i].Currency] = [2]int64{total[0] + int64(legs[i].Debit), total[1] + int64(legs[i].Credit)}
+		}
+
+		if len(legs) == 0 {
+			return pgx.ErrNoRows
+		}
+		for _, total := range totals {
+			if total[0] != total[1] {
+				return pgx.ErrNoRows
+			}
+		}
+
+		row = repository.CreateJournalEntryRow{ID: uuid.New(), Description: arg.Description, CreatedAt: now}
+
+		for i := range legs {
+			if err := s.checkJournalLeg(legs[i]); err != nil {
+				return err
+			}
+			legs[i].EntryID = row.ID
+		}
+
+		s.appendJournalEntry(repository.JournalEntry(row), legs)
+		return nil
+	})
+
+	return row, err
+}
+
+func (s *Store) appendJournalEntry(entry repository.JournalEntry, legs []repository.JournalLeg) {
+	n := len(s.data.journalEntries)
+	s.onRollback(func() {
+		s.data.journalEntries = s.data.journalEntries[:n]
+		delete(s.data.journalLegs, entry.ID)
+	})
+
+	s.data.journalEntries = append(s.data.journalEntries, entry)
+	s.data.journalLegs[entry.ID] = legs
+}
+
+// entryCurrency is the currency of the wallets of an entry, if they have
+// only one.
+func (s *Store) entryCurrency(ctx context.Context, walletIDs []uuid.UUID) string {
+	currency := ""
+	for _, id := range walletIDs {
+		wallet, ok := s.data.wallets[id]
+		if !ok || !s.visible(ctx, id) {
+			continue
+		}
+		if currency != "" && currency != wallet.Currency {
+			return ""
+		}
+		currency = wallet.Currency
+	}
+	return currency
+}
+
+func (s *Store) checkJournalLeg(leg repository.JournalLeg) error {
+	if leg.Currency == "" {
+		return &pgconn.PgError{Code: codeNotNullViolation, Message: `null value in column "currency" of relation "journal_legs" violates not-null constraint`}
+	}
+
+	switch models.JournalAccount(leg.Account) {
+	case models.JournalAccountWallet, models.JournalAccountCashIn, models.JournalAccountCashOut,
+		models.JournalAccountFees, models.JournalAccountAdjustments, models.JournalAccountOpening,
+		models.JournalAccountExchange, models.JournalAccountInterest:
+	default:
+		return checkViolation("journal_legs", "journal_legs_account_check")
+	}
+
+	if leg.Debit < 0 || leg.Credit < 0 || (leg.Debit == 0) == (leg.Credit == 0) {
+		return checkViolation("journal_legs", "journal_legs_amount_check")
+	}
+
+	if !currencyPattern.MatchString(leg.Currency) {
+		return checkViolation("journal_legs", "journal_legs_currency_check")
+	}
+
+	if (leg.Account == string(models.JournalAccountWallet)) != (leg.WalletID != uuid.Nil) {
+		return checkViolation("journal_legs", "journal_legs_wallet_check")
+	}
+
+	if _, ok := s.data.wallets[leg.WalletID]; leg.WalletID != uuid.Nil && !ok {
+		return foreignKeyViolation("journal_legs", "journal_legs_wallet_id_fkey")
+	}
+
+	return nil
+}
+
+func (s *Store) ListJournalLegs(ctx context.Context, entryID uuid.UUID) ([]repository.JournalLeg, error) {
+	var legs []repository.JournalLeg
+
+	err := s.read(ctx, func() error {
+		legs = slices.Clone(s.data.journalLegs[entryID])
+		return nil
+	})
+
+	return legs, err
+}
+
+func (s *Store) GetTrialBalance(ctx context.Context) ([]repository.GetTrialBalanceRow, error) {
+	var rows []repository.GetTrialBalanceRow
+
+	err := s.read(ctx, func() error {
+		type key struct{ currency, account string }
+		totals := make(map[key]*repository.GetTrialBalanceRow)
+		for _, legs := range s.data.journalLegs {
+			for _, leg := range legs {
+				k := key{leg.Currency, leg.Account}
+				total, ok := totals[k]
+				if !ok {
+					total = &repository.GetTrialBalanceRow{Currency: leg.Currency, Account: leg.Account}
+					totals[k] = total
+				}
+				total.Debit += int64(leg.Debit)
+				total.Credit += int64(leg.Credit)
+			}
+		}
+
+		for _, total := range totals {
+			rows = append(rows, *total)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(rows, func(a, b repository.GetTrialBalanceRow) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), cmp.Compare(a.Account, b.Account))
+	})
+
+	return rows, nil
+}
+
+func (s *Store) ListWalletJournalMismatches(ctx context.Context, maxRows int32) ([]repository.ListWalletJournalMismatchesRow, error) {
+	var rows []repository.ListWalletJournalMismatchesRow
+
+	err := s.read(ctx, func() error {
+		journal := make(map[uuid.UUID]int64)
+		for _, legs := range s.data.journalLegs {
+			for _, leg := range legs {
+				if leg.Account == string(models.JournalAccountWallet) {
+					journal[leg.WalletID] += int64(leg.Credit) - int64(leg.Debit)
+				}
+			}
+		}
+
+		for id, wallet := range s.data.wallets {
+			if !s.visible(ctx, id) {
+				continue
+			}
+			balance := int64(wallet.Balance)
+			for _, shard := range s.data.shards[id] {
+				balance += int64(shard.Balance)
+			}
+			if balance != journal[id] {
+				rows = append(rows, repository.ListWalletJournalMismatchesRow{ID: id, Balance: balance, JournalBalance: journal[id]})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(rows, func(a, b repository.ListWalletJournalMismatchesRow) int {
+		return compareUUID(a.ID, b.ID)
+	})
+
+	return rows[:min(len(rows), int(max(maxRows, 0)))], nil
+}
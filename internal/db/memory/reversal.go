@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+// operationIndex returns the index of operation id in s.data.operations, or
+// -1 if there is none.
+func (s *Store) operationIndex(id uuid.UUID) int {
+	for i, op := range s.data.operations {
+		if op.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) GetOperation(ctx context.Context, id uuid.UUID) (repository.Operation, error) {
+	var op repository.Operation
+
+	err := s.read(ctx, func() error {
+		i := s.operationIndex(id)
+		if i < 0 || !s.visible(ctx, s.data.operations[i].WalletID) {
+			return pgx.ErrNoRows
+		}
+
+		op = s.data.operations[i]
+		return nil
+	})
+
+	return op, err
+}
+
+func (s *Store) ReverseOperation(ctx context.Context, arg repository.ReverseOperationParams) (repository.Operation, error) {
+	var op repository.Operation
+
+	err := s.write(ctx, func(time.Time) error {
+		i := s.operationIndex(arg.ID)
+		if i < 0 || !s.visible(ctx, s.data.operations[i].WalletID) {
+			return pgx.ErrNoRows
+		}
+
+		current := s.data.operations[i]
+		reversed := int64(current.ReversedAmount) + int64(arg.Amount)
+		if reversed > abs64(current.Amount) {
+			return pgx.ErrNoRows
+		}
+		if reversed < 0 {
+			return checkViolation("operations", "operations_reversed_amount_check")
+		}
+
+		s.onRollback(func() {
+			s.data.operations[i] = current
+		})
+
+		s.data.operations[i].ReversedAmount = int32(reversed)
+		op = s.data.operations[i]
+		return nil
+	})
+
+	return op, err
+}
+
+func (s *Store) SetOperationCounterpart(ctx context.Context, arg repository.SetOperationCounterpartParams) error {
+	return s.write(ctx, func(time.Time) error {
+		i := s.operationIndex(arg.ID)
+		if i < 0 || !s.visible(ctx, s.data.operations[i].WalletID) {
+			return nil
+		}
+		if arg.CounterpartID != uuid.Nil && s.operationIndex(arg.CounterpartID) < 0 {
+			return foreignKeyViolation("operations", "operations_counterpart_id_fkey")
+		}
+
+		current := s.data.operations[i]
+		s.onRollback(func() {
+			s.data.operations[i] = current
+		})
+
+		s.data.operations[i].CounterpartID = arg.CounterpartID
+		return nil
+	})
+}
+
+func abs64(n int32) int64 {
+	if n < 0 {
+		return -int64(n)
+	}
+	return int64(n)
+}
@@ -0,0 +1,297 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+func (s *Store) CreateScheduledOperation(ctx context.Context, arg repository.CreateScheduledOperationParams) (repository.ScheduledOperation, error) {
+	var op repository.ScheduledOperation
+
+	err := s.write(ctx, func(now time.Time) error {
+		op = repository.ScheduledOperation{
+			ID:             uuid.New(),
+			WalletID:       arg.WalletID,
+			TargetWalletID: arg.TargetWalletID,
+			OperationType:  arg.OperationType,
+			Amount:         arg.Amount,
+			Cron:           arg.Cron,
+			Status:         string(models.ScheduleStatusActive),
+			NextRunAt:      arg.NextRunAt,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+
+		if err := s.checkScheduledOperation(op); err != nil {
+			return err
+		}
+		if !s.visible(ctx, op.WalletID) {
+			return rowSecurityViolation("scheduled_operations")
+		}
+
+		s.putScheduledOperation(op)
+		return nil
+	})
+
+	return op, err
+}
+
+func (s *Store) GetScheduledOperation(ctx context.Context, id uuid.UUID) (repository.ScheduledOperation, error) {
+	var op repository.ScheduledOperation
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if op, ok = s.data.scheduled[id]; !ok || !s.visible(ctx, op.WalletID) {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return op, err
+}
+
+func (s *Store) ListScheduledOperations(ctx context.Context, arg repository.ListScheduledOperationsParams) ([]repository.ScheduledOperation, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var ops []repository.ScheduledOperation
+
+	err := s.read(ctx, func() error {
+		for _, op := range s.data.scheduled {
+			if compareUUID(op.ID, arg.AfterID) <= 0 || !s.visible(ctx, op.WalletID) {
+				continue
+			}
+			if arg.WalletID != uuid.Nil && op.WalletID != arg.WalletID && op.TargetWalletID != arg.WalletID {
+				continue
+			}
+			ops = append(ops, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(ops, func(a, b repository.ScheduledOperation) int {
+		return compareUUID(a.ID, b.ID)
+	})
+
+	return ops[:min(len(ops), int(arg.PageSize))], nil
+}
+
+func (s *Store) UpdateScheduledOperation(ctx context.Context, arg repository.UpdateScheduledOperationParams) (repository.ScheduledOperation, error) {
+	var op repository.ScheduledOperation
+
+	err := s.write(ctx, func(now time.Time) error {
+		var ok bool
+		if op, ok = s.data.scheduled[arg.ID]; !ok || !s.visible(ctx, op.WalletID) {
+			return pgx.ErrNoRows
+		}
+
+		op.TargetWalletID = arg.TargetWalletID
+		op.OperationType = arg.OperationType
+		op.Amount = arg.Amount
+		op.Cron = arg.Cron
+		op.Status = arg.Status
+		op.NextRunAt = arg.NextRunAt
+		op.UpdatedAt = now
+
+		if err := s.checkScheduledOperation(op); err != nil {
+			return err
+		}
+
+		s.putScheduledOperation(op)
+		return nil
+	})
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	return op, nil
+}
+
+// DeleteScheduledOperation also deletes the runs of the operation, like ON
+// DELETE CASCADE.
+func (s *Store) DeleteScheduledOperation(ctx context.Context, id uuid.UUID) (int64, error) {
+	var deleted int64
+
+	err := s.write(ctx, func(time.Time) error {
+		op, ok := s.data.scheduled[id]
+		if !ok || !s.visible(ctx, op.WalletID) {
+			return nil
+		}
+
+		runs := s.data.runs
+		s.onRollback(func() {
+			s.data.scheduled[id] = op
+			s.data.runs = runs
+		})
+
+		delete(s.data.scheduled, id)
+		s.data.runs = slices.DeleteFunc(slices.Clone(runs), func(run repository.ScheduledOperationRun) bool {
+			return run.ScheduledOperationID == id
+		})
+		deleted = 1
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// ClaimDueScheduledOperation needs no SKIP LOCKED: transactions never run
+// concurrently, so no due operation can be locked by another one.
+func (s *Store) ClaimDueScheduledOperation(ctx context.Context, now time.Time) (repository.ScheduledOperation, error) {
+	var due []repository.ScheduledOperation
+
+	err := s.read(ctx, func() error {
+		for _, op := range s.data.scheduled {
+			if op.Status == string(models.ScheduleStatusActive) && !op.NextRunAt.After(now) && s.visible(ctx, op.WalletID) {
+				due = append(due, op)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+	if len(due) == 0 {
+		return repository.ScheduledOperation{}, pgx.ErrNoRows
+	}
+
+	return slices.MinFunc(due, func(a, b repository.ScheduledOperation) int {
+		return a.NextRunAt.Compare(b.NextRunAt)
+	}), nil
+}
+
+func (s *Store) CreateScheduledOperationRun(ctx context.Context, arg repository.CreateScheduledOperationRunParams) (repository.ScheduledOperationRun, error) {
+	var run repository.ScheduledOperationRun
+
+	err := s.write(ctx, func(now time.Time) error {
+		op, ok := s.data.scheduled[arg.ScheduledOperationID]
+		if !ok {
+			return foreignKeyViolation("scheduled_operation_runs", "scheduled_operation_runs_scheduled_operation_id_fkey")
+		}
+		if !s.visible(ctx, op.WalletID) {
+			return rowSecurityViolation("scheduled_operation_runs")
+		}
+		if arg.Status != string(models.RunStatusSucceeded) && arg.Status != string(models.RunStatusFailed) {
+			return checkViolation("scheduled_operation_runs", "scheduled_operation_runs_status_check")
+		}
+
+		for _, r := range s.data.runs {
+			if r.ScheduledOperationID == arg.ScheduledOperationID && r.ScheduledFor.Equal(arg.ScheduledFor) {
+				return &pgconn.PgError{
+					Code:           codeUniqueViolation,
+					Message:        `duplicate key value violates unique constraint "scheduled_operation_runs_scheduled_operation_id_scheduled_f_key"`,
+					ConstraintName: "scheduled_operation_runs_scheduled_operation_id_scheduled_f_key",
+				}
+			}
+		}
+
+		run = repository.ScheduledOperationRun{
+			ID:                   uuid.New(),
+			ScheduledOperationID: arg.ScheduledOperationID,
+			ScheduledFor:         arg.ScheduledFor,
+			Status:               arg.Status,
+			Error:                arg.Error,
+			CreatedAt:            now,
+		}
+
+		n := len(s.data.runs)
+		s.onRollback(func() {
+			s.data.runs = s.data.runs[:n]
+		})
+		s.data.runs = append(s.data.runs, run)
+
+		return nil
+	})
+
+	return run, err
+}
+
+func (s *Store) ListScheduledOperationRuns(ctx context.Context, arg repository.ListScheduledOperationRunsParams) ([]repository.ScheduledOperationRun, error) {
+	if arg.Limit < 0 {
+		return nil, negativeLimit()
+	}
+
+	var runs []repository.ScheduledOperationRun
+
+	err := s.read(ctx, func() error {
+		if op, ok := s.data.scheduled[arg.ScheduledOperationID]; ok && !s.visible(ctx, op.WalletID) {
+			return nil
+		}
+
+		for _, run := range s.data.runs {
+			if run.ScheduledOperationID == arg.ScheduledOperationID {
+				runs = append(runs, run)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(runs, func(a, b repository.ScheduledOperationRun) int {
+		return b.ScheduledFor.Compare(a.ScheduledFor)
+	})
+
+	return runs[:min(len(runs), int(arg.Limit))], nil
+}
+
+func (s *Store) putScheduledOperation(op repository.ScheduledOperation) {
+	prev, existed := s.data.scheduled[op.ID]
+	s.onRollback(func() {
+		if existed {
+			s.data.scheduled[op.ID] = prev
+		} else {
+			delete(s.data.scheduled, op.ID)
+		}
+	})
+
+	s.data.scheduled[op.ID] = op
+}
+
+// checkScheduledOperation enforces the constraints of scheduled_operations.
+func (s *Store) checkScheduledOperation(op repository.ScheduledOperation) error {
+	const table = "scheduled_operations"
+
+	switch models.OperationType(op.OperationType) {
+	case models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer:
+	default:
+		return checkViolation(table, "scheduled_operations_operation_type_check")
+	}
+
+	switch models.ScheduleStatus(op.Status) {
+	case models.ScheduleStatusActive, models.ScheduleStatusPaused, models.ScheduleStatusDone:
+	default:
+		return checkViolation(table, "scheduled_operations_status_check")
+	}
+
+	switch {
+	case op.Amount <= 0:
+		return checkViolation(table, "scheduled_operations_amount_check")
+	case (op.OperationType == string(models.OperationTransfer)) != (op.TargetWalletID != uuid.Nil):
+		return checkViolation(table, "scheduled_operations_check")
+	case op.TargetWalletID == op.WalletID:
+		return checkViolation(table, "scheduled_operations_check1")
+	}
+
+	if _, ok := s.data.wallets[op.WalletID]; !ok {
+		return foreignKeyViolation(table, "scheduled_operations_wallet_id_fkey")
+	}
+	if _, ok := s.data.wallets[op.TargetWalletID]; op.TargetWalletID != uuid.Nil && !ok {
+		return foreignKeyViolation(table, "scheduled_operations_target_wallet_id_fkey")
+	}
+
+	return nil
+}
@@ -0,0 +1,759 @@
+// Package memory implements service.WalletRepositoryInterface in process
+// memory, for tests and demos that should run without Postgres.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// SQLSTATE codes of the Postgres errors the store reproduces.
+const (
+	codeNumericOutOfRange     = "22003"
+	codeInvalidJSON           = "22P02"
+	codeInvalidRowCount       = "2201W"
+	codeNotNullViolation      = "23502"
+	codeForeignKeyViolation   = "23503"
+	codeUniqueViolation       = "23505"
+	codeCheckViolation        = "23514"
+	codeReadOnlyTransaction   = "25006"
+	codeInsufficientPrivilege = "42501"
+)
+
+type data struct {
+	tenants    map[uuid.UUID]repository.Tenant
+	wallets    map[uuid.UUID]repository.Wallet
+	operations []repository.Operation
+	// shards holds the shards of a wallet, indexed by shard_id.
+	shards map[uuid.UUID][]repository.WalletShard
+
+	scheduled map[uuid.UUID]repository.ScheduledOperation
+	runs      []repository.ScheduledOperationRun
+
+	products       map[uuid.UUID]repository.InterestProduct
+	walletInterest map[uuid.UUID]repository.WalletInterest
+	accruals       []repository.InterestAccrual
+	payouts        []repository.InterestPayout
+
+	feeSchedules map[uuid.UUID]repository.FeeSchedule
+	// feeTiers holds the tiers of a schedule, ordered by min_amount.
+	feeTiers map[uuid.UUID][]repository.FeeTier
+
+	imports map[uuid.UUID]repository.Import
+	// importRows holds the rows of an import, ordered by row_number.
+	importRows map[uuid.UUID][]repository.ImportRow
+
+	// audit is append-only, like the audit_log table.
+	audit []repository.AuditLog
+
+	journalEntries []repository.JournalEntry
+	// journalLegs holds the legs of an entry, ordered by leg.
+	journalLegs map[uuid.UUID][]repository.JournalLeg
+
+	exchangeRates  map[uuid.UUID]repository.ExchangeRate
+	exchangeQuotes map[uuid.UUID]repository.ExchangeQuote
+}
+
+type txn struct {
+	// now is the transaction start time, which Postgres uses for now().
+	now    time.Time
+	undo   []func()
+	closed bool
+	// readOnly transactions hold the shared lock and may not write.
+	readOnly bool
+}
+
+// Store mirrors the semantics of the Postgres queries, errors included.
+// Transactions are serialized: ExecTx holds an exclusive lock until fn
+// returns and undoes every change if fn fails.
+type Store struct {
+	mu   *sync.RWMutex
+	data *data
+	tx   *txn
+}
+
+func NewStore() *Store {
+	return &Store{
+		mu: new(sync.RWMutex),
+		data: &data{
+			// The tenants migration creates the default tenant.
+			tenants: map[uuid.UUID]repository.Tenant{
+				service.DefaultTenantID: {ID: service.DefaultTenantID, Name: "default", CreatedAt: timestamp()},
+			},
+			wallets:   make(map[uuid.UUID]repository.Wallet),
+			shards:    make(map[uuid.UUID][]repository.WalletShard),
+			scheduled: make(map[uuid.UUID]repository.ScheduledOperation),
+
+			products:       make(map[uuid.UUID]repository.InterestProduct),
+			walletInterest: make(map[uuid.UUID]repository.WalletInterest),
+
+			feeSchedules: make(map[uuid.UUID]repository.FeeSchedule),
+			feeTiers:     make(map[uuid.UUID][]repository.FeeTier),
+
+			imports:    make(map[uuid.UUID]repository.Import),
+			importRows: make(map[uuid.UUID][]repository.ImportRow),
+
+			journalLegs: make(map[uuid.UUID][]repository.JournalLeg),
+
+			exchangeRates:  make(map[uuid.UUID]repository.ExchangeRate),
+			exchangeQuotes: make(map[uuid.UUID]repository.ExchangeQuote),
+		},
+	}
+}
+
+// AddWallet inserts an empty wallet with the given ID unless it exists, like
+// the seed migration.
+func (s *Store) AddWallet(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.wallets[id]; !ok {
+		s.data.wallets[id] = newWallet(id, timestamp())
+	}
+}
+
+// ExecTx runs fn inside a transaction. Calling ExecTx on the store passed to
+// fn opens a savepoint.
+func (s *Store) ExecTx(ctx context.Context, fn func(repo service.WalletRepositoryInterface) error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		savepoint := len(s.tx.undo)
+		if err := fn(s); err != nil {
+			s.rollbackTo(savepoint)
+			return err
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Store{mu: s.mu, data: s.data, tx: &txn{now: timestamp()}}
+	defer func() {
+		// Also reached when fn panics.
+		if !tx.tx.closed {
+			tx.rollbackTo(0)
+			tx.tx.closed = true
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	tx.tx.closed = true
+	return nil
+}
+
+// ExecSnapshot runs fn inside a read-only transaction. It holds the shared
+// lock, so writers wait until fn returns and all its reads see one state.
+func (s *Store) ExecSnapshot(ctx context.Context, fn func(repo service.WalletRepositoryInterface) error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx := &Store{mu: s.mu, data: s.data, tx: &txn{now: timestamp(), readOnly: true}}
+	defer func() { tx.tx.closed = true }()
+
+	return fn(tx)
+}
+
+func (s *Store) rollbackTo(savepoint int) {
+	for i := len(s.tx.undo) - 1; i >= savepoint; i-- {
+		s.tx.undo[i]()
+	}
+	s.tx.undo = s.tx.undo[:savepoint]
+}
+
+// onRollback registers how to revert a change made inside a transaction.
+func (s *Store) onRollback(undo func()) {
+	if s.tx != nil {
+		s.tx.undo = append(s.tx.undo, undo)
+	}
+}
+
+func (s *Store) check(ctx context.Context) error {
+	if s.tx != nil && s.tx.closed {
+		return pgx.ErrTxClosed
+	}
+	return ctx.Err()
+}
+
+// read runs fn under a shared lock, or within the transaction holding the
+// exclusive one.
+func (s *Store) read(ctx context.Context, fn func() error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	if s.tx == nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+
+	return fn()
+}
+
+// write runs fn under the exclusive lock and passes it the value of now().
+func (s *Store) write(ctx context.Context, fn func(now time.Time) error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		if s.tx.readOnly {
+			return &pgconn.PgError{
+				Code:    codeReadOnlyTransaction,
+				Message: "cannot execute statement in a read-only transaction",
+			}
+		}
+		return fn(s.tx.now)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(timestamp())
+}
+
+// putWallet stores wallet and returns it with the version the
+// wallets_bump_version trigger would give it.
+func (s *Store) putWallet(wallet repository.Wallet) repository.Wallet {
+	prev, existed := s.data.wallets[wallet.ID]
+	s.onRollback(func() {
+		if existed {
+			s.data.wallets[wallet.ID] = prev
+		} else {
+			delete(s.data.wallets, wallet.ID)
+		}
+	})
+
+	if existed && (wallet.Balance != prev.Balance || wallet.Status != prev.Status || wallet.ShardCount != prev.ShardCount) {
+		wallet.Version = prev.Version + 1
+	}
+
+	s.data.wallets[wallet.ID] = wallet
+	return wallet
+}
+
+func (s *Store) putShards(walletID uuid.UUID, shards []repository.WalletShard) {
+	prev, existed := s.data.shards[walletID]
+	s.onRollback(func() {
+		if existed {
+			s.data.shards[walletID] = prev
+		} else {
+			delete(s.data.shards, walletID)
+		}
+	})
+
+	if shards == nil {
+		delete(s.data.shards, walletID)
+	} else {
+		s.data.shards[walletID] = shards
+	}
+}
+
+func (s *Store) appendOperations(ops ...repository.Operation) {
+	n := len(s.data.operations)
+	s.onRollback(func() {
+		s.data.operations = s.data.operations[:n]
+	})
+
+	s.data.operations = append(s.data.operations, ops...)
+}
+
+func (s *Store) GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	var wallet repository.Wallet
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if wallet, ok = s.data.wallets[id]; !ok || !s.visible(ctx, id) {
+			return pgx.ErrNoRows
+		}
+		return nil
+	})
+
+	return wallet, err
+}
+
+// GetWalletByIDForUpdate needs no row lock: the transaction already holds
+// the store exclusively.
+func (s *Store) GetWalletByIDForUpdate(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	return s.GetWalletByID(ctx, id)
+}
+
+func (s *Store) CreateWallet(ctx context.Context, arg repository.CreateWalletParams) (repository.Wallet, error) {
+	var wallet repository.Wallet
+
+	err := s.write(ctx, func(now time.Time) error {
+		wallet = newWallet(uuid.New(), now)
+		if tenant, ok := service.TenantFrom(ctx); ok {
+			wallet.TenantID = tenant
+		}
+		if arg.Currency != "" {
+			wallet.Currency = arg.Currency
+		}
+		if arg.Metadata != nil {
+			wallet.Metadata = arg.Metadata
+		}
+		if arg.Labels != nil {
+			wallet.Labels = arg.Labels
+		}
+
+		if err := checkWalletDetails(wallet); err != nil {
+			return err
+		}
+		if _, ok := s.data.tenants[wallet.TenantID]; !ok {
+			return foreignKeyViolation("wallets", "wallets_tenant_id_fkey")
+		}
+
+		s.putWallet(wallet)
+		return nil
+	})
+
+	return wallet, err
+}
+
+func (s *Store) ListWallets(ctx context.Context, arg repository.ListWalletsParams) ([]repository.Wallet, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var wallets []repository.Wallet
+
+	err := s.read(ctx, func() error {
+		for _, w := range s.data.wallets {
+			if compareUUID(w.ID, arg.AfterID) > 0 && s.visible(ctx, w.ID) {
+				wallets = append(wallets, w)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(wallets, func(a, b repository.Wallet) int {
+		return compareUUID(a.ID, b.ID)
+	})
+
+	return wallets[:min(len(wallets), int(arg.PageSize))], nil
+}
+
+func (s *Store) UpdateWallet(ctx context.Context, arg repository.UpdateWalletParams) (repository.Wallet, error) {
+	var wallet repository.Wallet
+
+	err := s.write(ctx, func(time.Time) error {
+		current, ok := s.data.wallets[arg.ID]
+		if !ok || !s.visible(ctx, arg.ID) ||
+			current.Status != string(models.WalletStatusActive) ||
+			current.ShardCount != 0 ||
+			(arg.Amount < 0 && int64(current.Balance)+int64(arg.Amount) < 0) {
+			return pgx.ErrNoRows
+		}
+
+		balance, err := addInt32(current.Balance, arg.Amount)
+		if err != nil {
+			return err
+		}
+
+		wallet = current
+		wallet.Balance = balance
+		wallet = s.putWallet(wallet)
+
+		return nil
+	})
+
+	return wallet, err
+}
+
+func (s *Store) SetWalletBalance(ctx context.Context, arg repository.SetWalletBalanceParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		w.Balance = arg.Balance
+		return nil
+	})
+}
+
+func (s *Store) SetWalletStatus(ctx context.Context, arg repository.SetWalletStatusParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		if arg.Status != string(models.WalletStatusActive) && arg.Status != string(models.WalletStatusFrozen) {
+			return checkViolation("wallets", "wallets_status_check")
+		}
+		w.Status = arg.Status
+		return nil
+	})
+}
+
+func (s *Store) SetWalletShardCount(ctx context.Context, arg repository.SetWalletShardCountParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		if arg.ShardCount < 0 {
+			return checkViolation("wallets", "wallets_shard_count_check")
+		}
+		w.ShardCount = arg.ShardCount
+		return nil
+	})
+}
+
+// updateWallet applies set to an existing wallet, like an UPDATE ... WHERE
+// id = $1 RETURNING *.
+func (s *Store) updateWallet(ctx context.Context, id uuid.UUID, set func(w *repository.Wallet) error) (repository.Wallet, error) {
+	var wallet repository.Wallet
+
+	err := s.write(ctx, func(time.Time) error {
+		var ok bool
+		if wallet, ok = s.data.wallets[id]; !ok || !s.visible(ctx, id) {
+			return pgx.ErrNoRows
+		}
+
+		if err := set(&wallet); err != nil {
+			return err
+		}
+
+		wallet = s.putWallet(wallet)
+		return nil
+	})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+func (s *Store) CreateWalletShards(ctx context.Context, id uuid.UUID) error {
+	return s.write(ctx, func(time.Time) error {
+		wallet, ok := s.data.wallets[id]
+		if !ok || !s.visible(ctx, id) || wallet.ShardCount <= 0 {
+			return nil
+		}
+
+		if len(s.data.shards[id]) > 0 {
+			return &pgconn.PgError{
+				Code:           codeUniqueViolation,
+				Message:        `duplicate key value violates unique constraint "wallet_shards_pkey"`,
+				ConstraintName: "wallet_shards_pkey",
+			}
+		}
+
+		shards := make([]repository.WalletShard, wallet.ShardCount)
+		for i := range shards {
+			shards[i] = repository.WalletShard{WalletID: id, ShardID: int32(i)}
+		}
+
+		s.putShards(id, shards)
+		return nil
+	})
+}
+
+func (s *Store) CreditWalletShard(ctx context.Context, arg repository.CreditWalletShardParams) (int64, error) {
+	var credited int64
+
+	err := s.write(ctx, func(time.Time) error {
+		wallet, ok := s.data.wallets[arg.WalletID]
+		shards := s.data.shards[arg.WalletID]
+		if !ok || !s.visible(ctx, arg.WalletID) || wallet.Status != string(models.WalletStatusActive) || arg.ShardID < 0 || int(arg.ShardID) >= len(shards) {
+			return nil
+		}
+
+		balance, err := addInt32(shards[arg.ShardID].Balance, arg.Amount)
+		if err != nil {
+			return err
+		}
+
+		updated := slices.Clone(shards)
+		setShardBalance(&updated[arg.ShardID], balance)
+		s.putShards(arg.WalletID, updated)
+		credited = 1
+
+		return nil
+	})
+
+	return credited, err
+}
+
+func (s *Store) SumWalletShards(ctx context.Context, walletID uuid.UUID) (repository.SumWalletShardsRow, error) {
+	var sum repository.SumWalletShardsRow
+
+	err := s.read(ctx, func() error {
+		if !s.visible(ctx, walletID) {
+			return nil
+		}
+
+		for _, shard := range s.data.shards[walletID] {
+			sum.Balance += int64(shard.Balance)
+			sum.Version += shard.Version
+		}
+		return nil
+	})
+
+	return sum, err
+}
+
+func (s *Store) GetWalletWithShards(ctx context.Context, id uuid.UUID) (repository.GetWalletWithShardsRow, error) {
+	var row repository.GetWalletWithShardsRow
+
+	err := s.read(ctx, func() error {
+		var ok bool
+		if row.Wallet, ok = s.data.wallets[id]; !ok || !s.visible(ctx, id) {
+			return pgx.ErrNoRows
+		}
+
+		for _, shard := range s.data.shards[id] {
+			row.ShardsBalance += int64(shard.Balance)
+			row.ShardsVersion += shard.Version
+		}
+		return nil
+	})
+
+	return row, err
+}
+
+func (s *Store) LockWalletShards(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	sum, err := s.SumWalletShards(ctx, walletID)
+	return sum.Balance, err
+}
+
+func (s *Store) ResetWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	return s.write(ctx, func(time.Time) error {
+		shards, ok := s.data.shards[walletID]
+		if !ok || !s.visible(ctx, walletID) {
+			return nil
+		}
+
+		updated := slices.Clone(shards)
+		for i := range updated {
+			setShardBalance(&updated[i], 0)
+		}
+
+		s.putShards(walletID, updated)
+		return nil
+	})
+}
+
+// DeleteWalletShards hands the versions of the deleted shards over to the
+// wallet, like the wallet_shards_fold_version trigger.
+func (s *Store) DeleteWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	return s.write(ctx, func(time.Time) error {
+		shards, ok := s.data.shards[walletID]
+		if !ok || !s.visible(ctx, walletID) {
+			return nil
+		}
+
+		if wallet, ok := s.data.wallets[walletID]; ok {
+			for _, shard := range shards {
+				wallet.Version += shard.Version
+			}
+			s.putWallet(wallet)
+		}
+
+		s.putShards(walletID, nil)
+		return nil
+	})
+}
+
+// setShardBalance updates a shard like the wallet_shards_bump_version
+// trigger, moving its version only when the balance changes.
+func setShardBalance(shard *repository.WalletShard, balance int32) {
+	if shard.Balance != balance {
+		shard.Balance = balance
+		shard.Version++
+	}
+}
+
+func (s *Store) CreateOperation(ctx context.Context, arg repository.CreateOperationParams) (repository.Operation, error) {
+	var op repository.Operation
+
+	err := s.write(ctx, func(now time.Time) error {
+		if _, ok := s.data.wallets[arg.WalletID]; !ok {
+			return foreignKeyViolation("operations", "operations_wallet_id_fkey")
+		}
+		if !s.visible(ctx, arg.WalletID) {
+			return rowSecurityViolation("operations")
+		}
+		if arg.ReversalOf != uuid.Nil && s.operationIndex(arg.ReversalOf) < 0 {
+			return foreignKeyViolation("operations", "operations_reversal_of_fkey")
+		}
+		if arg.CounterpartID != uuid.Nil && s.operationIndex(arg.CounterpartID) < 0 {
+			return foreignKeyViolation("operations", "operations_counterpart_id_fkey")
+		}
+		if _, ok := s.data.imports[arg.ImportID]; arg.ImportID != uuid.Nil && !ok {
+			return foreignKeyViolation("operations", "operations_import_id_fkey")
+		}
+
+		op = newOperation(arg.WalletID, arg.OperationType, arg.Amount, now)
+		op.ReversalOf = arg.ReversalOf
+		op.CounterpartID = arg.CounterpartID
+		op.ImportID = arg.ImportID
+		op.Reference = arg.Reference
+		s.appendOperations(op)
+
+		return nil
+	})
+
+	return op, err
+}
+
+// CreateOperations inserts all operations or, like a failed COPY, none.
+func (s *Store) CreateOperations(ctx context.Context, arg []repository.CreateOperationsParams) (int64, error) {
+	err := s.write(ctx, func(now time.Time) error {
+		ops := make([]repository.Operation, 0, len(arg))
+		for _, a := range arg {
+			if _, ok := s.data.wallets[a.WalletID]; !ok {
+				return foreignKeyViolation("operations", "operations_wallet_id_fkey")
+			}
+			if !s.visible(ctx, a.WalletID) {
+				return rowSecurityViolation("operations")
+			}
+			ops = append(ops, newOperation(a.WalletID, a.OperationType, a.Amount, now))
+		}
+
+		s.appendOperations(ops...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(arg)), nil
+}
+
+func (s *Store) ListWalletOperations(ctx context.Context, arg repository.ListWalletOperationsParams) ([]repository.Operation, error) {
+	ops, err := s.findOperations(ctx, arg.Limit, func(op repository.Operation) bool {
+		return op.WalletID == arg.WalletID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(ops)
+
+	return ops[:min(len(ops), int(arg.Limit))], nil
+}
+
+func (s *Store) ListOperationsPage(ctx context.Context, arg repository.ListOperationsPageParams) ([]repository.Operation, error) {
+	ops, err := s.findOperations(ctx, arg.PageSize, func(op repository.Operation) bool {
+		if arg.WalletID != uuid.Nil && op.WalletID != arg.WalletID {
+			return false
+		}
+		return compareOperations(op, repository.Operation{ID: arg.AfterID, CreatedAt: arg.AfterCreatedAt}) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ops[:min(len(ops), int(arg.PageSize))], nil
+}
+
+// findOperations returns the matching operations ordered by (created_at, id).
+func (s *Store) findOperations(ctx context.Context, limit int32, match func(op repository.Operation) bool) ([]repository.Operation, error) {
+	if limit < 0 {
+		return nil, negativeLimit()
+	}
+
+	var ops []repository.Operation
+
+	err := s.read(ctx, func() error {
+		for _, op := range s.data.operations {
+			if match(op) && s.visible(ctx, op.WalletID) {
+				ops = append(ops, op)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(ops, compareOperations)
+
+	return ops, nil
+}
+
+func newWallet(id uuid.UUID, now time.Time) repository.Wallet {
+	return repository.Wallet{
+		ID:        id,
+		Status:    string(models.WalletStatusActive),
+		CreatedAt: now,
+		TenantID:  service.DefaultTenantID,
+		Currency:  service.NoCurrency,
+		Metadata:  json.RawMessage(`{}`),
+		Labels:    json.RawMessage(`{}`),
+	}
+}
+
+func newOperation(walletID uuid.UUID, operationType string, amount int32, now time.Time) repository.Operation {
+	return repository.Operation{
+		ID:            uuid.New(),
+		WalletID:      walletID,
+		OperationType: operationType,
+		Amount:        amount,
+		CreatedAt:     now,
+	}
+}
+
+// timestamp returns the current time at the microsecond precision of
+// timestamptz.
+func timestamp() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// compareUUID orders UUIDs the way Postgres does, byte by byte.
+func compareUUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func compareOperations(a, b repository.Operation) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return compareUUID(a.ID, b.ID)
+}
+
+func addInt32(a, b int32) (int32, error) {
+	sum := int64(a) + int64(b)
+	if sum < math.MinInt32 || sum > math.MaxInt32 {
+		return 0, &pgconn.PgError{Code: codeNumericOutOfRange, Message: "integer out of range"}
+	}
+	return int32(sum), nil
+}
+
+func negativeLimit() error {
+	return &pgconn.PgError{Code: codeInvalidRowCount, Message: "LIMIT must not be negative"}
+}
+
+func checkViolation(table, constraint string) error {
+	return &pgconn.PgError{
+		Code:           codeCheckViolation,
+		Message:        `new row for relation "` + table + `" violates check constraint "` + constraint + `"`,
+		ConstraintName: constraint,
+	}
+}
+
+func foreignKeyViolation(table, constraint string) error {
+	return &pgconn.PgError{
+		Code:           codeForeignKeyViolation,
+		Message:        `insert or update on table "` + table + `" violates foreign key constraint "` + constraint + `"`,
+		ConstraintName: constraint,
+	}
+}
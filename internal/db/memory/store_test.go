@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/db/repotest"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	repotest.Run(t, NewStore())
+}
+
+func TestStore_ExecTx_ClosedAfterCommit(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+
+	var leaked service.WalletRepositoryInterface
+	require.NoError(t, store.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		leaked = tx
+		return nil
+	}))
+
+	_, err := leaked.CreateWallet(ctx, repository.CreateWalletParams{})
+	assert.ErrorIs(t, err, pgx.ErrTxClosed)
+}
+
+func TestStore_ExecTx_RollbackOnPanic(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+
+	wallet, err := store.CreateWallet(ctx, repository.CreateWalletParams{})
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		_ = store.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+			if _, err := tx.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: "FROZEN"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+
+	got, err := store.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ACTIVE", got.Status)
+}
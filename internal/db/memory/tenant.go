@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// visible reports whether the tenant of ctx may see the rows of a wallet,
+// like the row-level security policies of the tenants migration. No tenant
+// sees a system wallet.
+func (s *Store) visible(ctx context.Context, walletID uuid.UUID) bool {
+	tenant, ok := service.TenantFrom(ctx)
+	if !ok {
+		return true
+	}
+
+	wallet, ok := s.data.wallets[walletID]
+	return ok && wallet.TenantID == tenant && !wallet.IsSystem
+}
+
+func rowSecurityViolation(table string) error {
+	return &pgconn.PgError{
+		Code:    codeInsufficientPrivilege,
+		Message: `new row violates row-level security policy for table "` + table + `"`,
+	}
+}
+
+func (s *Store) MarkSystemWallet(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	return s.updateWallet(ctx, id, func(w *repository.Wallet) error {
+		w.IsSystem = true
+		return nil
+	})
+}
+
+func (s *Store) SetWalletOwner(ctx context.Context, arg repository.SetWalletOwnerParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		w.OwnerID = arg.OwnerID
+		return nil
+	})
+}
+
+func (s *Store) ListOwnerWallets(ctx context.Context, arg repository.ListOwnerWalletsParams) ([]repository.Wallet, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	var wallets []repository.Wallet
+
+	err := s.read(ctx, func() error {
+		// A NULL owner matches no owner_id, not even a zero one.
+		if arg.OwnerID == uuid.Nil {
+			return nil
+		}
+
+		for _, w := range s.data.wallets {
+			if w.OwnerID == arg.OwnerID && compareUUID(w.ID, arg.AfterID) > 0 && s.visible(ctx, w.ID) {
+				wallets = append(wallets, w)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(wallets, func(a, b repository.Wallet) int {
+		return compareUUID(a.ID, b.ID)
+	})
+
+	return wallets[:min(len(wallets), int(arg.PageSize))], nil
+}
+
+func (s *Store) CreateTenant(ctx context.Context, name string) (repository.Tenant, error) {
+	var tenant repository.Tenant
+
+	err := s.write(ctx, func(now time.Time) error {
+		for _, t := range s.data.tenants {
+			if t.Name == name {
+				return &pgconn.PgError{
+					Code:           codeUniqueViolation,
+					Message:        `duplicate key value violates unique constraint "tenants_name_key"`,
+					ConstraintName: "tenants_name_key",
+				}
+			}
+		}
+
+		tenant = repository.Tenant{ID: uuid.New(), Name: name, CreatedAt: now}
+
+		s.onRollback(func() {
+			delete(s.data.tenants, tenant.ID)
+		})
+		s.data.tenants[tenant.ID] = tenant
+		return nil
+	})
+
+	return tenant, err
+}
+
+func (s *Store) ListTenants(ctx context.Context) ([]repository.Tenant, error) {
+	var tenants []repository.Tenant
+
+	err := s.read(ctx, func() error {
+		for _, t := range s.data.tenants {
+			tenants = append(tenants, t)
+		}
+		return nil
+	})
+
+	slices.SortFunc(tenants, func(a, b repository.Tenant) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return tenants, err
+}
+
+func (s *Store) SetTenantKeyHash(ctx context.Context, arg repository.SetTenantKeyHashParams) (repository.Tenant, error) {
+	var tenant repository.Tenant
+
+	err := s.write(ctx, func(time.Time) error {
+		old, ok := s.data.tenants[arg.ID]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+
+		if arg.ApiKeyHash.Valid {
+			for _, t := range s.data.tenants {
+				if t.ID != arg.ID && t.ApiKeyHash == arg.ApiKeyHash {
+					return &pgconn.PgError{
+						Code:           codeUniqueViolation,
+						Message:        `duplicate key value violates unique constraint "tenants_api_key_hash_key"`,
+						ConstraintName: "tenants_api_key_hash_key",
+					}
+				}
+			}
+		}
+
+		tenant = old
+		tenant.ApiKeyHash = arg.ApiKeyHash
+
+		s.onRollback(func() {
+			s.data.tenants[old.ID] = old
+		})
+		s.data.tenants[tenant.ID] = tenant
+		return nil
+	})
+
+	return tenant, err
+}
+
+func (s *Store) GetTenantByKeyHash(ctx context.Context, apiKeyHash pgtype.Text) (repository.Tenant, error) {
+	var tenant repository.Tenant
+
+	err := s.read(ctx, func() error {
+		// A NULL hash equals nothing, so a tenant without a key is never found.
+		if !apiKeyHash.Valid {
+			return pgx.ErrNoRows
+		}
+
+		for _, t := range s.data.tenants {
+			if t.ApiKeyHash == apiKeyHash {
+				tenant = t
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+
+	return tenant, err
+}
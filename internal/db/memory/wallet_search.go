@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// checkWalletDetails enforces the check constraints of the wallet metadata
+// migration.
+func checkWalletDetails(w repository.Wallet) error {
+	if !currencyPattern.MatchString(w.Currency) {
+		return checkViolation("wallets", "wallets_currency_check")
+	}
+
+	var metadata any
+	if err := json.Unmarshal(w.Metadata, &metadata); err != nil {
+		return invalidJSON()
+	}
+	if _, ok := metadata.(map[string]any); !ok {
+		return checkViolation("wallets", "wallets_metadata_check")
+	}
+
+	if !json.Valid(w.Labels) {
+		return invalidJSON()
+	}
+	if _, err := decodeLabels(w.Labels); err != nil {
+		return checkViolation("wallets", "wallets_labels_check")
+	}
+
+	return nil
+}
+
+func decodeLabels(raw json.RawMessage) (map[string]string, error) {
+	var labels map[string]string
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return nil, err
+	}
+	if labels == nil {
+		return nil, &json.UnmarshalTypeError{Value: "null"}
+	}
+	return labels, nil
+}
+
+func invalidJSON() error {
+	return &pgconn.PgError{Code: codeInvalidJSON, Message: "invalid input syntax for type json"}
+}
+
+func (s *Store) SetWalletDetails(ctx context.Context, arg repository.SetWalletDetailsParams) (repository.Wallet, error) {
+	return s.updateWallet(ctx, arg.ID, func(w *repository.Wallet) error {
+		if arg.Metadata != nil {
+			w.Metadata = arg.Metadata
+		}
+		if arg.Labels != nil {
+			w.Labels = arg.Labels
+		}
+		return checkWalletDetails(*w)
+	})
+}
+
+func (s *Store) SearchWallets(ctx context.Context, arg service.SearchWalletsParams) ([]repository.Wallet, error) {
+	if arg.PageSize < 0 {
+		return nil, negativeLimit()
+	}
+
+	match, err := selectorLabels(arg.LabelsMatch)
+	if err != nil {
+		return nil, err
+	}
+	not, err := selectorLabels(arg.LabelsNot)
+	if err != nil {
+		return nil, err
+	}
+
+	compare := func(a, b repository.Wallet) int {
+		var c int
+		switch arg.SortBy {
+		case service.SortByBalance:
+			c = cmp.Compare(a.Balance, b.Balance)
+		case service.SortByCreatedAt:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = compareUUID(a.ID, b.ID)
+		}
+		if arg.Descending {
+			c = -c
+		}
+		return c
+	}
+
+	var wallets []repository.Wallet
+
+	err = s.read(ctx, func() error {
+		var after *repository.Wallet
+		if arg.AfterID != uuid.Nil {
+			// A cursor the caller cannot see compares as NULL.
+			w, ok := s.data.wallets[arg.AfterID]
+			if !ok || !s.visible(ctx, w.ID) {
+				return nil
+			}
+			after = &w
+		}
+
+		for _, w := range s.data.wallets {
+			if !s.visible(ctx, w.ID) || after != nil && compare(w, *after) <= 0 {
+				continue
+			}
+
+			labels, err := decodeLabels(w.Labels)
+			if err != nil {
+				return err
+			}
+
+			if (arg.Status == "" || w.Status == arg.Status) &&
+				(arg.Currency == "" || w.Currency == arg.Currency) &&
+				w.Balance >= arg.MinBalance && w.Balance <= arg.MaxBalance &&
+				!w.CreatedAt.Before(arg.CreatedFrom) && w.CreatedAt.Before(arg.CreatedTo) &&
+				matchLabels(labels, match, not, arg.LabelsHas, arg.LabelsMissing) {
+				wallets = append(wallets, w)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(wallets, compare)
+
+	return wallets[:min(len(wallets), int(arg.PageSize))], nil
+}
+
+func selectorLabels(raw json.RawMessage) (map[string]string, error) {
+	if raw == nil || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var labels map[string]string
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return nil, invalidJSON()
+	}
+	return labels, nil
+}
+
+func matchLabels(labels, match, not map[string]string, has, missing []string) bool {
+	for key, value := range match {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	for key, value := range not {
+		if got, ok := labels[key]; ok && got == value {
+			return false
+		}
+	}
+	for _, key := range has {
+		if _, ok := labels[key]; !ok {
+			return false
+		}
+	}
+	for _, key := range missing {
+		if _, ok := labels[key]; ok {
+			return false
+		}
+	}
+	return true
+}
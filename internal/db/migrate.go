@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kuzmindeniss/itk/internal/config"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+)
+
+// Migrations are embedded so the binary does not depend on the source tree.
+//
+//go:embed sql/schema/*.sql sql/seeds/*.sql
+var migrationsFS embed.FS
+
+const (
+	schemaDir = "sql/schema"
+	seedsDir  = "sql/seeds"
+
+	schemaVersionTable = goose.DefaultTablename
+	seedVersionTable   = "goose_seed_version"
+)
+
+var ErrSeedsNotAllowed = errors.New("seeds are only applied in development and test environments")
+
+// Migrator runs schema migrations and seeds. Each has its own goose version
+// table, so seeds never interleave with schema versions.
+type Migrator struct {
+	db           *sql.DB
+	schema       *goose.Provider
+	seeds        *goose.Provider
+	seedsAllowed bool
+}
+
+func NewMigrator(cfg *config.Config) (*Migrator, error) {
+	db, err := sql.Open("pgx", databaseURL(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection for migrations: %w", err)
+	}
+
+	migrator, err := newMigrator(db, cfg.SeedsAllowed())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+func newMigrator(db *sql.DB, seedsAllowed bool) (*Migrator, error) {
+	schema, err := newProvider(db, schemaDir, schemaVersionTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema migrations: %w", err)
+	}
+
+	seeds, err := newProvider(db, seedsDir, seedVersionTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seeds: %w", err)
+	}
+
+	return &Migrator{
+		db:           db,
+		schema:       schema,
+		seeds:        seeds,
+		seedsAllowed: seedsAllowed,
+	}, nil
+}
+
+func newProvider(db *sql.DB, dir string, versionTable string) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := database.NewStore(database.DialectPostgres, versionTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return goose.NewProvider("", db, fsys, goose.WithStore(store), goose.WithVerbose(true))
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	if err := m.forgetLegacySeedVersions(ctx); err != nil {
+		return err
+	}
+
+	_, err := m.schema.Up(ctx)
+	return err
+}
+
+// Down rolls back the most recent schema migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	if err := m.forgetLegacySeedVersions(ctx); err != nil {
+		return err
+	}
+
+	_, err := m.schema.Down(ctx)
+	return err
+}
+
+// Redo rolls back the most recent schema migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	if err := m.Down(ctx); err != nil {
+		return err
+	}
+
+	_, err := m.schema.UpByOne(ctx)
+	return err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	if err := m.forgetLegacySeedVersions(ctx); err != nil {
+		return nil, err
+	}
+
+	return m.schema.Status(ctx)
+}
+
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	if err := m.forgetLegacySeedVersions(ctx); err != nil {
+		return 0, err
+	}
+
+	return m.schema.GetDBVersion(ctx)
+}
+
+// Seed inserts the test wallets. It refuses to run in production.
+func (m *Migrator) Seed(ctx context.Context) error {
+	if !m.seedsAllowed {
+		return ErrSeedsNotAllowed
+	}
+
+	_, err := m.seeds.Up(ctx)
+	return err
+}
+
+// forgetLegacySeedVersions removes seed versions from the schema version
+// table, where they were recorded before seeds got a table of their own.
+// Seeds are idempotent, so a later Seed simply records them again.
+func (m *Migrator) forgetLegacySeedVersions(ctx context.Context) error {
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", schemaVersionTable).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check schema version table: %w", err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	versions := make([]int64, 0)
+	for _, source := range m.seeds.ListSources() {
+		versions = append(versions, source.Version)
+	}
+
+	if _, err := m.db.ExecContext(ctx, "DELETE FROM "+schemaVersionTable+" WHERE version_id = ANY($1)", versions); err != nil {
+		return fmt.Errorf("failed to remove legacy seed versions: %w", err)
+	}
+
+	return nil
+}
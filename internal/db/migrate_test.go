@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseURL points at a scratch database; tests that need Postgres are
+// skipped without it. The migration tests drop every table they create.
+func testDatabaseURL(t testing.TB) string {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	return url
+}
+
+func TestEmbeddedMigrations_Sources(t *testing.T) {
+	schemaFiles, err := fs.Glob(migrationsFS, schemaDir+"/*.sql")
+	require.NoError(t, err)
+	seedFiles, err := fs.Glob(migrationsFS, seedsDir+"/*.sql")
+	require.NoError(t, err)
+
+	db, err := sql.Open("pgx", "postgres://localhost/unused")
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := newMigrator(db, true)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, schemaFiles)
+	assert.NotEmpty(t, seedFiles)
+	assert.Len(t, migrator.schema.ListSources(), len(schemaFiles))
+	assert.Len(t, migrator.seeds.ListSources(), len(seedFiles))
+}
+
+func TestMigrator_UpAndRollback(t *testing.T) {
+	db, err := sql.Open("pgx", testDatabaseURL(t))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := newMigrator(db, true)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sources := migrator.schema.ListSources()
+	latest := sources[len(sources)-1].Version
+
+	require.NoError(t, migrator.Up(ctx))
+	require.NoError(t, migrator.Seed(ctx))
+
+	version, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	var wallets int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM wallets").Scan(&wallets))
+	assert.Positive(t, wallets)
+
+	require.NoError(t, migrator.Redo(ctx))
+
+	_, err = migrator.seeds.DownTo(ctx, 0)
+	require.NoError(t, err)
+	_, err = migrator.schema.DownTo(ctx, 0)
+	require.NoError(t, err)
+
+	version, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	var exists bool
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT to_regclass('wallets') IS NOT NULL").Scan(&exists))
+	assert.False(t, exists)
+
+	// Everything rolled back must apply cleanly again.
+	require.NoError(t, migrator.Up(ctx))
+	_, err = migrator.schema.DownTo(ctx, 0)
+	require.NoError(t, err)
+}
+
+func TestMigrator_SeedNotAllowed(t *testing.T) {
+	db, err := sql.Open("pgx", "postgres://localhost/unused")
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := newMigrator(db, false)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, migrator.Seed(context.Background()), ErrSeedsNotAllowed)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WalletChangedChannel is the channel the wallet triggers notify with the ID
+// of every changed wallet.
+const WalletChangedChannel = "wallet_changed"
+
+// WalletListener receives wallet change notifications. ChangesMissed is
+// called whenever notifications may have been missed, i.e. after
+// (re)connecting.
+type WalletListener interface {
+	WalletChanged(id uuid.UUID)
+	ChangesMissed()
+}
+
+const listenRetryDelay = time.Second
+
+// ListenWalletChanges holds a pooled connection listening on
+// WalletChangedChannel and forwards notifications to l until ctx is done.
+// A lost connection is reopened after a short delay.
+func ListenWalletChanges(ctx context.Context, pool *pgxpool.Pool, l WalletListener) {
+	for {
+		err := listenWalletChanges(ctx, pool, l)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("wallet change listener: %v; reconnecting", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func listenWalletChanges(ctx context.Context, pool *pgxpool.Pool, l WalletListener) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays subscribed, so it must not go back to the pool.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+WalletChangedChannel); err != nil {
+		return err
+	}
+
+	// Changes made while no connection was listening went unnoticed.
+	l.ChangesMissed()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := uuid.Parse(notification.Payload)
+		if err != nil {
+			log.Printf("wallet change listener: invalid payload %q", notification.Payload)
+			continue
+		}
+
+		l.WalletChanged(id)
+	}
+}
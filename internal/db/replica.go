@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+// LSN is a Postgres write-ahead log position. A token returned after a write
+// is the primary's LSN at that moment; a replica that has replayed up to it
+// sees the write.
+type LSN uint64
+
+// ParseLSN parses the textual form of pg_lsn, e.g. "16/B374D848".
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+
+	return LSN(h<<32 | l), nil
+}
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint64(l)>>32, uint64(l)&0xFFFFFFFF)
+}
+
+type readAfterKey struct{}
+
+func readAfter(ctx context.Context) LSN {
+	lsn, _ := ctx.Value(readAfterKey{}).(LSN)
+	return lsn
+}
+
+const replicaPollInterval = 500 * time.Millisecond
+
+// Replica is a read-only pool together with the replication state last
+// observed on it.
+type Replica struct {
+	pool    *pgxpool.Pool
+	queries *repository.Queries
+	maxLag  time.Duration
+
+	available atomic.Bool
+	replayLSN atomic.Uint64
+	lag       atomic.Int64
+}
+
+func newReplica(pool *pgxpool.Pool, maxLag time.Duration) *Replica {
+	return &Replica{
+		pool:    pool,
+		queries: repository.New(tenantPool{pool}),
+		maxLag:  maxLag,
+	}
+}
+
+// fresh reports whether the replica may serve a read that must observe lsn.
+func (r *Replica) fresh(lsn LSN) bool {
+	return r.available.Load() &&
+		time.Duration(r.lag.Load()) <= r.maxLag &&
+		LSN(r.replayLSN.Load()) >= lsn
+}
+
+func (r *Replica) monitor(ctx context.Context) {
+	ticker := time.NewTicker(replicaPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.poll(ctx); err != nil {
+			if r.available.Swap(false) {
+				log.Printf("replica %s unavailable: %v", r.pool.Config().ConnConfig.Host, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var errNotStandby = errors.New("server is not in recovery")
+
+func (r *Replica) poll(ctx context.Context) error {
+	var (
+		inRecovery bool
+		replayLSN  *string
+		lagSeconds *float64
+	)
+
+	// A standby that is connected to the primary and has replayed everything
+	// it received is not lagging, however long ago the primary last
+	// committed. Without a WAL receiver it receives nothing, so the lag is
+	// counted from the last replayed commit, and is unknown before one.
+	err := r.pool.QueryRow(ctx, `
+		SELECT pg_is_in_recovery(),
+		       pg_last_wal_replay_lsn()::text,
+		       CASE WHEN EXISTS (SELECT 1 FROM pg_stat_wal_receiver)
+		                 AND pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		            ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8
+		       END`,
+	).Scan(&inRecovery, &replayLSN, &lagSeconds)
+	if err != nil {
+		return err
+	}
+	if !inRecovery || replayLSN == nil {
+		return errNotStandby
+	}
+
+	lsn, err := ParseLSN(*replayLSN)
+	if err != nil {
+		return err
+	}
+
+	lag := time.Duration(math.MaxInt64)
+	if lagSeconds != nil {
+		lag = time.Duration(*lagSeconds * float64(time.Second))
+	}
+
+	r.replayLSN.Store(uint64(lsn))
+	r.lag.Store(int64(lag))
+	r.available.Store(true)
+
+	return nil
+}
+
+// Pools are the connection pools of the primary and of its read replicas.
+type Pools struct {
+	Primary  *pgxpool.Pool
+	Replicas []*Replica
+
+	stopMonitors context.CancelFunc
+}
+
+func (p *Pools) Close() {
+	p.stopMonitors()
+	for _, r := range p.Replicas {
+		r.pool.Close()
+	}
+	p.Primary.Close()
+}
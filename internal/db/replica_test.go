@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	require.NoError(t, err)
+	assert.Equal(t, LSN(0x16_B374D848), lsn)
+	assert.Equal(t, "16/B374D848", lsn.String())
+
+	for _, invalid := range []string{"", "16", "16/", "x/1", "1/100000000"} {
+		_, err := ParseLSN(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func testReplica(replayLSN LSN, lag time.Duration) *Replica {
+	r := &Replica{queries: repository.New(nil), maxLag: time.Second}
+	r.available.Store(true)
+	r.replayLSN.Store(uint64(replayLSN))
+	r.lag.Store(int64(lag))
+	return r
+}
+
+func TestStore_Reader(t *testing.T) {
+	lagging := testReplica(100, time.Minute)
+	behind := testReplica(50, 0)
+	unavailable := testReplica(200, 0)
+	unavailable.available.Store(false)
+
+	store := NewStore(nil, lagging, behind, unavailable)
+	ctx := context.Background()
+
+	assert.Same(t, behind.queries, store.reader(ctx))
+
+	// No replica has replayed the token yet.
+	token, err := store.ReadAfter(ctx, LSN(80).String())
+	require.NoError(t, err)
+	assert.Same(t, store.Queries, store.reader(token))
+
+	behind.replayLSN.Store(80)
+	assert.Same(t, behind.queries, store.reader(token))
+
+	assert.Same(t, store.Queries, store.reader(service.FromPrimary(ctx)))
+
+	_, err = store.ReadAfter(ctx, "not an lsn")
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: audit.sql
+
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAuditEntry = `-- name: CreateAuditEntry :one
+INSERT INTO audit_log (actor, action, wallet_id, before, after, request_id, source_ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, actor, action, wallet_id, before, after, request_id, source_ip, created_at
+`
+
+type CreateAuditEntryParams struct {
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	WalletID  uuid.UUID       `json:"wallet_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id"`
+	SourceIp  string          `json:"source_ip"`
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) (AuditLog, error) {
+	row := q.db.QueryRow(ctx, createAuditEntry,
+		arg.Actor,
+		arg.Action,
+		arg.WalletID,
+		arg.Before,
+		arg.After,
+		arg.RequestID,
+		arg.SourceIp,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.Action,
+		&i.WalletID,
+		&i.Before,
+		&i.After,
+		&i.RequestID,
+		&i.SourceIp,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAuditEntries = `-- name: ListAuditEntries :many
+SELECT id, actor, action, wallet_id, before, after, request_id, source_ip, created_at FROM audit_log
+WHERE ($1::text = '' OR actor = $1::text)
+  AND ($2::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = $2::uuid)
+  AND created_at >= $3::timestamptz
+  AND created_at < $4::timestamptz
+  AND ($5::uuid = '00000000-0000-0000-0000-000000000000'
+    OR (created_at, id) > (SELECT a.created_at, a.id FROM audit_log a WHERE a.id = $5::uuid))
+ORDER BY created_at, id
+LIMIT $6
+`
+
+type ListAuditEntriesParams struct {
+	Actor    string    `json:"actor"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	FromTime time.Time `json:"from_time"`
+	ToTime   time.Time `json:"to_time"`
+	AfterID  uuid.UUID `json:"after_id"`
+	PageSize int32     `json:"page_size"`
+}
+
+// Empty filters match everything. Entries come in time order after the
+// entry after_id, or from the start with a zero after_id.
+func (q *Queries) ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditEntries,
+		arg.Actor,
+		arg.WalletID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.Actor,
+			&i.Action,
+			&i.WalletID,
+			&i.Before,
+			&i.After,
+			&i.RequestID,
+			&i.SourceIp,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
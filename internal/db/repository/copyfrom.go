@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: copyfrom.go
+
+package repository
+
+import (
+	"context"
+)
+
+// iteratorForCreateImportRows implements pgx.CopyFromSource.
+type iteratorForCreateImportRows struct {
+	rows                 []CreateImportRowsParams
+	skippedFirstNextCall bool
+}
+
+func (r *iteratorForCreateImportRows) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	if !r.skippedFirstNextCall {
+		r.skippedFirstNextCall = true
+		return true
+	}
+	r.rows = r.rows[1:]
+	return len(r.rows) > 0
+}
+
+func (r iteratorForCreateImportRows) Values() ([]interface{}, error) {
+	return []interface{}{
+		r.rows[0].ImportID,
+		r.rows[0].RowNumber,
+		r.rows[0].WalletID,
+		r.rows[0].OperationType,
+		r.rows[0].Amount,
+		r.rows[0].Reference,
+		r.rows[0].Error,
+	}, nil
+}
+
+func (r iteratorForCreateImportRows) Err() error {
+	return nil
+}
+
+func (q *Queries) CreateImportRows(ctx context.Context, arg []CreateImportRowsParams) (int64, error) {
+	return q.db.CopyFrom(ctx, []string{"import_rows"}, []string{"import_id", "row_number", "wallet_id", "operation_type", "amount", "reference", "error"}, &iteratorForCreateImportRows{rows: arg})
+}
+
+// iteratorForCreateOperations implements pgx.CopyFromSource.
+type iteratorForCreateOperations struct {
+	rows                 []CreateOperationsParams
+	skippedFirstNextCall bool
+}
+
+func (r *iteratorForCreateOperations) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	if !r.skippedFirstNextCall {
+		r.skippedFirstNextCall = true
+		return true
+	}
+	r.rows = r.rows[1:]
+	return len(r.rows) > 0
+}
+
+func (r iteratorForCreateOperations) Values() ([]interface{}, error) {
+	return []interface{}{
+		r.rows[0].WalletID,
+		r.rows[0].OperationType,
+		r.rows[0].Amount,
+	}, nil
+}
+
+func (r iteratorForCreateOperations) Err() error {
+	return nil
+}
+
+func (q *Queries) CreateOperations(ctx context.Context, arg []CreateOperationsParams) (int64, error) {
+	return q.db.CopyFrom(ctx, []string{"operations"}, []string{"wallet_id", "operation_type", "amount"}, &iteratorForCreateOperations{rows: arg})
+}
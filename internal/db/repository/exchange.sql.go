@@ -0,0 +1,246 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: exchange.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createExchangeQuote = `-- name: CreateExchangeQuote :one
+INSERT INTO exchange_quotes (
+  from_wallet_id, to_wallet_id, rate_id, from_currency, to_currency,
+  rate_micros, spread_bps, rounding, amount, converted_amount, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5,
+  $6, $7, $8, $9, $10, $11
+)
+RETURNING id, from_wallet_id, to_wallet_id, rate_id, from_currency, to_currency, rate_micros, spread_bps, rounding, amount, converted_amount, expires_at, from_operation_id, to_operation_id, created_at
+`
+
+type CreateExchangeQuoteParams struct {
+	FromWalletID    uuid.UUID `json:"from_wallet_id"`
+	ToWalletID      uuid.UUID `json:"to_wallet_id"`
+	RateID          uuid.UUID `json:"rate_id"`
+	FromCurrency    string    `json:"from_currency"`
+	ToCurrency      string    `json:"to_currency"`
+	RateMicros      int64     `json:"rate_micros"`
+	SpreadBps       int32     `json:"spread_bps"`
+	Rounding        string    `json:"rounding"`
+	Amount          int32     `json:"amount"`
+	ConvertedAmount int32     `json:"converted_amount"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateExchangeQuote(ctx context.Context, arg CreateExchangeQuoteParams) (ExchangeQuote, error) {
+	row := q.db.QueryRow(ctx, createExchangeQuote,
+		arg.FromWalletID,
+		arg.ToWalletID,
+		arg.RateID,
+		arg.FromCurrency,
+		arg.ToCurrency,
+		arg.RateMicros,
+		arg.SpreadBps,
+		arg.Rounding,
+		arg.Amount,
+		arg.ConvertedAmount,
+		arg.ExpiresAt,
+	)
+	var i ExchangeQuote
+	err := row.Scan(
+		&i.ID,
+		&i.FromWalletID,
+		&i.ToWalletID,
+		&i.RateID,
+		&i.FromCurrency,
+		&i.ToCurrency,
+		&i.RateMicros,
+		&i.SpreadBps,
+		&i.Rounding,
+		&i.Amount,
+		&i.ConvertedAmount,
+		&i.ExpiresAt,
+		&i.FromOperationID,
+		&i.ToOperationID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createExchangeRate = `-- name: CreateExchangeRate :one
+INSERT INTO exchange_rates (base_currency, quote_currency, rate_micros, effective_from, source)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, base_currency, quote_currency, rate_micros, effective_from, source, created_at
+`
+
+type CreateExchangeRateParams struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	RateMicros    int64     `json:"rate_micros"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	Source        string    `json:"source"`
+}
+
+func (q *Queries) CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error) {
+	row := q.db.QueryRow(ctx, createExchangeRate,
+		arg.BaseCurrency,
+		arg.QuoteCurrency,
+		arg.RateMicros,
+		arg.EffectiveFrom,
+		arg.Source,
+	)
+	var i ExchangeRate
+	err := row.Scan(
+		&i.ID,
+		&i.BaseCurrency,
+		&i.QuoteCurrency,
+		&i.RateMicros,
+		&i.EffectiveFrom,
+		&i.Source,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const executeExchangeQuote = `-- name: ExecuteExchangeQuote :one
+UPDATE exchange_quotes
+SET from_operation_id = $1, to_operation_id = $2
+WHERE id = $3 AND from_operation_id IS NULL
+RETURNING id, from_wallet_id, to_wallet_id, rate_id, from_currency, to_currency, rate_micros, spread_bps, rounding, amount, converted_amount, expires_at, from_operation_id, to_operation_id, created_at
+`
+
+type ExecuteExchangeQuoteParams struct {
+	FromOperationID uuid.UUID `json:"from_operation_id"`
+	ToOperationID   uuid.UUID `json:"to_operation_id"`
+	ID              uuid.UUID `json:"id"`
+}
+
+// Matches only a quote that has not been executed, so a quote is executed
+// at most once even by concurrent requests.
+func (q *Queries) ExecuteExchangeQuote(ctx context.Context, arg ExecuteExchangeQuoteParams) (ExchangeQuote, error) {
+	row := q.db.QueryRow(ctx, executeExchangeQuote, arg.FromOperationID, arg.ToOperationID, arg.ID)
+	var i ExchangeQuote
+	err := row.Scan(
+		&i.ID,
+		&i.FromWalletID,
+		&i.ToWalletID,
+		&i.RateID,
+		&i.FromCurrency,
+		&i.ToCurrency,
+		&i.RateMicros,
+		&i.SpreadBps,
+		&i.Rounding,
+		&i.Amount,
+		&i.ConvertedAmount,
+		&i.ExpiresAt,
+		&i.FromOperationID,
+		&i.ToOperationID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getEffectiveExchangeRate = `-- name: GetEffectiveExchangeRate :one
+SELECT id, base_currency, quote_currency, rate_micros, effective_from, source, created_at FROM exchange_rates
+WHERE base_currency = $1
+  AND quote_currency = $2
+  AND effective_from <= $3
+ORDER BY effective_from DESC
+LIMIT 1
+`
+
+type GetEffectiveExchangeRateParams struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	At            time.Time `json:"at"`
+}
+
+func (q *Queries) GetEffectiveExchangeRate(ctx context.Context, arg GetEffectiveExchangeRateParams) (ExchangeRate, error) {
+	row := q.db.QueryRow(ctx, getEffectiveExchangeRate, arg.BaseCurrency, arg.QuoteCurrency, arg.At)
+	var i ExchangeRate
+	err := row.Scan(
+		&i.ID,
+		&i.BaseCurrency,
+		&i.QuoteCurrency,
+		&i.RateMicros,
+		&i.EffectiveFrom,
+		&i.Source,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getExchangeQuote = `-- name: GetExchangeQuote :one
+SELECT id, from_wallet_id, to_wallet_id, rate_id, from_currency, to_currency, rate_micros, spread_bps, rounding, amount, converted_amount, expires_at, from_operation_id, to_operation_id, created_at FROM exchange_quotes WHERE id = $1
+`
+
+func (q *Queries) GetExchangeQuote(ctx context.Context, id uuid.UUID) (ExchangeQuote, error) {
+	row := q.db.QueryRow(ctx, getExchangeQuote, id)
+	var i ExchangeQuote
+	err := row.Scan(
+		&i.ID,
+		&i.FromWalletID,
+		&i.ToWalletID,
+		&i.RateID,
+		&i.FromCurrency,
+		&i.ToCurrency,
+		&i.RateMicros,
+		&i.SpreadBps,
+		&i.Rounding,
+		&i.Amount,
+		&i.ConvertedAmount,
+		&i.ExpiresAt,
+		&i.FromOperationID,
+		&i.ToOperationID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listExchangeRates = `-- name: ListExchangeRates :many
+SELECT id, base_currency, quote_currency, rate_micros, effective_from, source, created_at FROM exchange_rates
+WHERE ($1::text = '' OR base_currency = $1)
+  AND ($2::text = '' OR quote_currency = $2)
+ORDER BY base_currency, quote_currency, effective_from DESC
+LIMIT $3
+`
+
+type ListExchangeRatesParams struct {
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	Limit         int32  `json:"limit"`
+}
+
+// Empty currencies match any pair; the newest rates of a pair come first.
+func (q *Queries) ListExchangeRates(ctx context.Context, arg ListExchangeRatesParams) ([]ExchangeRate, error) {
+	rows, err := q.db.Query(ctx, listExchangeRates, arg.BaseCurrency, arg.QuoteCurrency, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExchangeRate
+	for rows.Next() {
+		var i ExchangeRate
+		if err := rows.Scan(
+			&i.ID,
+			&i.BaseCurrency,
+			&i.QuoteCurrency,
+			&i.RateMicros,
+			&i.EffectiveFrom,
+			&i.Source,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
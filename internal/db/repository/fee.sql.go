@@ -0,0 +1,268 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: fee.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createFeeSchedule = `-- name: CreateFeeSchedule :one
+INSERT INTO fee_schedules (operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee)
+VALUES ($1, NULLIF($2::uuid, '00000000-0000-0000-0000-000000000000'), $3, $4, $5, $6, $7)
+RETURNING id, operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee, created_at, updated_at
+`
+
+type CreateFeeScheduleParams struct {
+	OperationType string    `json:"operation_type"`
+	ProductID     uuid.UUID `json:"product_id"`
+	Kind          string    `json:"kind"`
+	FlatAmount    int32     `json:"flat_amount"`
+	RateBps       int32     `json:"rate_bps"`
+	MinFee        int32     `json:"min_fee"`
+	MaxFee        int32     `json:"max_fee"`
+}
+
+func (q *Queries) CreateFeeSchedule(ctx context.Context, arg CreateFeeScheduleParams) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, createFeeSchedule,
+		arg.OperationType,
+		arg.ProductID,
+		arg.Kind,
+		arg.FlatAmount,
+		arg.RateBps,
+		arg.MinFee,
+		arg.MaxFee,
+	)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.OperationType,
+		&i.ProductID,
+		&i.Kind,
+		&i.FlatAmount,
+		&i.RateBps,
+		&i.MinFee,
+		&i.MaxFee,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createFeeTier = `-- name: CreateFeeTier :exec
+INSERT INTO fee_tiers (schedule_id, min_amount, flat_amount, rate_bps)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateFeeTierParams struct {
+	ScheduleID uuid.UUID `json:"schedule_id"`
+	MinAmount  int32     `json:"min_amount"`
+	FlatAmount int32     `json:"flat_amount"`
+	RateBps    int32     `json:"rate_bps"`
+}
+
+func (q *Queries) CreateFeeTier(ctx context.Context, arg CreateFeeTierParams) error {
+	_, err := q.db.Exec(ctx, createFeeTier,
+		arg.ScheduleID,
+		arg.MinAmount,
+		arg.FlatAmount,
+		arg.RateBps,
+	)
+	return err
+}
+
+const deleteFeeSchedule = `-- name: DeleteFeeSchedule :execrows
+DELETE FROM fee_schedules WHERE id = $1
+`
+
+func (q *Queries) DeleteFeeSchedule(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteFeeSchedule, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteFeeTiers = `-- name: DeleteFeeTiers :exec
+DELETE FROM fee_tiers WHERE schedule_id = $1
+`
+
+func (q *Queries) DeleteFeeTiers(ctx context.Context, scheduleID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteFeeTiers, scheduleID)
+	return err
+}
+
+const getFeeSchedule = `-- name: GetFeeSchedule :one
+SELECT id, operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee, created_at, updated_at FROM fee_schedules WHERE id = $1
+`
+
+func (q *Queries) GetFeeSchedule(ctx context.Context, id uuid.UUID) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, getFeeSchedule, id)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.OperationType,
+		&i.ProductID,
+		&i.Kind,
+		&i.FlatAmount,
+		&i.RateBps,
+		&i.MinFee,
+		&i.MaxFee,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWalletFeeSchedule = `-- name: GetWalletFeeSchedule :one
+SELECT fs.id, fs.operation_type, fs.product_id, fs.kind, fs.flat_amount, fs.rate_bps, fs.min_fee, fs.max_fee, fs.created_at, fs.updated_at FROM fee_schedules fs
+LEFT JOIN wallets w ON w.id = $1
+WHERE fs.operation_type = $2
+  AND (fs.product_id IS NULL OR fs.product_id = w.product_id)
+ORDER BY fs.product_id IS NULL
+LIMIT 1
+`
+
+type GetWalletFeeScheduleParams struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+}
+
+// The schedule of the wallet's product wins over the default one.
+func (q *Queries) GetWalletFeeSchedule(ctx context.Context, arg GetWalletFeeScheduleParams) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, getWalletFeeSchedule, arg.WalletID, arg.OperationType)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.OperationType,
+		&i.ProductID,
+		&i.Kind,
+		&i.FlatAmount,
+		&i.RateBps,
+		&i.MinFee,
+		&i.MaxFee,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listFeeSchedules = `-- name: ListFeeSchedules :many
+SELECT id, operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee, created_at, updated_at FROM fee_schedules ORDER BY operation_type, product_id NULLS FIRST
+`
+
+func (q *Queries) ListFeeSchedules(ctx context.Context) ([]FeeSchedule, error) {
+	rows, err := q.db.Query(ctx, listFeeSchedules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FeeSchedule
+	for rows.Next() {
+		var i FeeSchedule
+		if err := rows.Scan(
+			&i.ID,
+			&i.OperationType,
+			&i.ProductID,
+			&i.Kind,
+			&i.FlatAmount,
+			&i.RateBps,
+			&i.MinFee,
+			&i.MaxFee,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeeTiers = `-- name: ListFeeTiers :many
+SELECT schedule_id, min_amount, flat_amount, rate_bps FROM fee_tiers WHERE schedule_id = $1 ORDER BY min_amount
+`
+
+func (q *Queries) ListFeeTiers(ctx context.Context, scheduleID uuid.UUID) ([]FeeTier, error) {
+	rows, err := q.db.Query(ctx, listFeeTiers, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FeeTier
+	for rows.Next() {
+		var i FeeTier
+		if err := rows.Scan(
+			&i.ScheduleID,
+			&i.MinAmount,
+			&i.FlatAmount,
+			&i.RateBps,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateFeeSchedule = `-- name: UpdateFeeSchedule :one
+UPDATE fee_schedules
+SET operation_type = $1,
+    product_id = NULLIF($2::uuid, '00000000-0000-0000-0000-000000000000'),
+    kind = $3,
+    flat_amount = $4,
+    rate_bps = $5,
+    min_fee = $6,
+    max_fee = $7,
+    updated_at = now()
+WHERE id = $8
+RETURNING id, operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee, created_at, updated_at
+`
+
+type UpdateFeeScheduleParams struct {
+	OperationType string    `json:"operation_type"`
+	ProductID     uuid.UUID `json:"product_id"`
+	Kind          string    `json:"kind"`
+	FlatAmount    int32     `json:"flat_amount"`
+	RateBps       int32     `json:"rate_bps"`
+	MinFee        int32     `json:"min_fee"`
+	MaxFee        int32     `json:"max_fee"`
+	ID            uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateFeeSchedule(ctx context.Context, arg UpdateFeeScheduleParams) (FeeSchedule, error) {
+	row := q.db.QueryRow(ctx, updateFeeSchedule,
+		arg.OperationType,
+		arg.ProductID,
+		arg.Kind,
+		arg.FlatAmount,
+		arg.RateBps,
+		arg.MinFee,
+		arg.MaxFee,
+		arg.ID,
+	)
+	var i FeeSchedule
+	err := row.Scan(
+		&i.ID,
+		&i.OperationType,
+		&i.ProductID,
+		&i.Kind,
+		&i.FlatAmount,
+		&i.RateBps,
+		&i.MinFee,
+		&i.MaxFee,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,509 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: import.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const applyImportRows = `-- name: ApplyImportRows :one
+WITH applied AS (
+  SELECT
+    r.row_number, r.wallet_id, r.operation_type, r.reference,
+    CASE WHEN r.operation_type = 'WITHDRAW' THEN -r.amount ELSE r.amount END AS amount
+  FROM import_rows r
+  JOIN wallets w ON w.id = r.wallet_id
+  WHERE r.import_id = $1 AND r.error = '' AND w.shard_count = 0
+), totals AS (
+  SELECT
+    a.wallet_id,
+    w.currency,
+    SUM(a.amount)::int AS amount,
+    row_number() OVER (ORDER BY a.wallet_id)::int AS n
+  FROM applied a
+  JOIN wallets w ON w.id = a.wallet_id
+  GROUP BY a.wallet_id, w.currency
+  HAVING SUM(a.amount) <> 0
+), balances AS (
+  UPDATE wallets w
+  SET balance = w.balance + t.amount
+  FROM totals t
+  WHERE w.id = t.wallet_id
+), created AS (
+  INSERT INTO operations (wallet_id, operation_type, amount, import_id, reference)
+  SELECT a.wallet_id, a.operation_type, a.amount, $1, a.reference
+  FROM applied a
+  ORDER BY a.row_number
+), entry AS (
+  INSERT INTO journal_entries (description)
+  SELECT 'IMPORT'
+  WHERE EXISTS (SELECT 1 FROM totals)
+  RETURNING id
+), legs AS (
+  INSERT INTO journal_legs (entry_id, leg, account, wallet_id, debit, credit, currency)
+  SELECT entry.id, 2 * t.n - 1, 'wallet', t.wallet_id, GREATEST(-t.amount, 0), GREATEST(t.amount, 0), t.currency
+  FROM entry, totals t
+  UNION ALL
+  SELECT entry.id, 2 * t.n, 'adjustments', NULL, GREATEST(t.amount, 0), GREATEST(-t.amount, 0), t.currency
+  FROM entry, totals t
+)
+SELECT count(*)::int AS applied_rows FROM applied
+`
+
+// Applies the valid rows of unsharded wallets at once: the balances, an
+// operation per row and one journal entry booking each wallet against
+// adjustments. The rows must have been checked with the wallets locked.
+func (q *Queries) ApplyImportRows(ctx context.Context, importID uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, applyImportRows, importID)
+	var applied_rows int32
+	err := row.Scan(&applied_rows)
+	return applied_rows, err
+}
+
+const checkImportRows = `-- name: CheckImportRows :execrows
+UPDATE import_rows r
+SET error = CASE
+  WHEN NOT EXISTS (SELECT 1 FROM wallets w WHERE w.id = r.wallet_id) THEN $1::text
+  ELSE $2::text
+END
+WHERE r.import_id = $3
+  AND r.error = ''
+  AND NOT EXISTS (SELECT 1 FROM wallets w WHERE w.id = r.wallet_id AND w.status = 'ACTIVE')
+`
+
+type CheckImportRowsParams struct {
+	WalletNotFound string    `json:"wallet_not_found"`
+	WalletFrozen   string    `json:"wallet_frozen"`
+	ImportID       uuid.UUID `json:"import_id"`
+}
+
+// Marks the rows of wallets that are missing or not active.
+func (q *Queries) CheckImportRows(ctx context.Context, arg CheckImportRowsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, checkImportRows, arg.WalletNotFound, arg.WalletFrozen, arg.ImportID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const claimImport = `-- name: ClaimImport :one
+SELECT id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id FROM imports
+WHERE id = $1 AND status = 'PENDING'
+FOR UPDATE
+`
+
+// Locks a pending import for applying it. Whoever waited for the lock gets
+// no row once the import is finished.
+func (q *Queries) ClaimImport(ctx context.Context, id uuid.UUID) (Import, error) {
+	row := q.db.QueryRow(ctx, claimImport, id)
+	var i Import
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.SkipInvalid,
+		&i.TotalRows,
+		&i.AppliedRows,
+		&i.FailedRows,
+		&i.FileHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const createImport = `-- name: CreateImport :one
+INSERT INTO imports (skip_invalid, total_rows, file_hash)
+VALUES ($1, $2, $3)
+RETURNING id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id
+`
+
+type CreateImportParams struct {
+	SkipInvalid bool   `json:"skip_invalid"`
+	TotalRows   int32  `json:"total_rows"`
+	FileHash    string `json:"file_hash"`
+}
+
+func (q *Queries) CreateImport(ctx context.Context, arg CreateImportParams) (Import, error) {
+	row := q.db.QueryRow(ctx, createImport, arg.SkipInvalid, arg.TotalRows, arg.FileHash)
+	var i Import
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.SkipInvalid,
+		&i.TotalRows,
+		&i.AppliedRows,
+		&i.FailedRows,
+		&i.FileHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+type CreateImportRowsParams struct {
+	ImportID      uuid.UUID `json:"import_id"`
+	RowNumber     int32     `json:"row_number"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+	Reference     string    `json:"reference"`
+	Error         string    `json:"error"`
+}
+
+const finishImport = `-- name: FinishImport :one
+UPDATE imports
+SET status = $1,
+    applied_rows = $2,
+    failed_rows = $3,
+    updated_at = now()
+WHERE id = $4
+RETURNING id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id
+`
+
+type FinishImportParams struct {
+	Status      string    `json:"status"`
+	AppliedRows int32     `json:"applied_rows"`
+	FailedRows  int32     `json:"failed_rows"`
+	ID          uuid.UUID `json:"id"`
+}
+
+func (q *Queries) FinishImport(ctx context.Context, arg FinishImportParams) (Import, error) {
+	row := q.db.QueryRow(ctx, finishImport,
+		arg.Status,
+		arg.AppliedRows,
+		arg.FailedRows,
+		arg.ID,
+	)
+	var i Import
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.SkipInvalid,
+		&i.TotalRows,
+		&i.AppliedRows,
+		&i.FailedRows,
+		&i.FileHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getImport = `-- name: GetImport :one
+SELECT id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id FROM imports WHERE id = $1
+`
+
+func (q *Queries) GetImport(ctx context.Context, id uuid.UUID) (Import, error) {
+	row := q.db.QueryRow(ctx, getImport, id)
+	var i Import
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.SkipInvalid,
+		&i.TotalRows,
+		&i.AppliedRows,
+		&i.FailedRows,
+		&i.FileHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getImportByFileHash = `-- name: GetImportByFileHash :one
+SELECT id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id FROM imports
+WHERE file_hash = $1 AND status <> 'REJECTED'
+`
+
+// The import of the tenant that holds the file, unless it was rejected.
+func (q *Queries) GetImportByFileHash(ctx context.Context, fileHash string) (Import, error) {
+	row := q.db.QueryRow(ctx, getImportByFileHash, fileHash)
+	var i Import
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.SkipInvalid,
+		&i.TotalRows,
+		&i.AppliedRows,
+		&i.FailedRows,
+		&i.FileHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const listImportErrors = `-- name: ListImportErrors :many
+SELECT import_id, row_number, wallet_id, operation_type, amount, reference, error FROM import_rows
+WHERE import_id = $1 AND error <> ''
+ORDER BY row_number
+`
+
+func (q *Queries) ListImportErrors(ctx context.Context, importID uuid.UUID) ([]ImportRow, error) {
+	rows, err := q.db.Query(ctx, listImportErrors, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ImportRow
+	for rows.Next() {
+		var i ImportRow
+		if err := rows.Scan(
+			&i.ImportID,
+			&i.RowNumber,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.Reference,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImportRowBalances = `-- name: ListImportRowBalances :many
+SELECT r.row_number, r.wallet_id, r.operation_type, r.amount, w.balance
+FROM import_rows r
+JOIN wallets w ON w.id = r.wallet_id
+WHERE r.import_id = $1 AND r.error = '' AND w.shard_count = 0
+ORDER BY r.wallet_id, r.row_number
+`
+
+type ListImportRowBalancesRow struct {
+	RowNumber     int32     `json:"row_number"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+	Balance       int32     `json:"balance"`
+}
+
+// The valid rows of unsharded wallets with the balance of their wallet, in
+// the order they are checked: by wallet, then by row.
+func (q *Queries) ListImportRowBalances(ctx context.Context, importID uuid.UUID) ([]ListImportRowBalancesRow, error) {
+	rows, err := q.db.Query(ctx, listImportRowBalances, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListImportRowBalancesRow
+	for rows.Next() {
+		var i ListImportRowBalancesRow
+		if err := rows.Scan(
+			&i.RowNumber,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.Balance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImportRows = `-- name: ListImportRows :many
+SELECT import_id, row_number, wallet_id, operation_type, amount, reference, error FROM import_rows
+WHERE import_id = $1 AND row_number > $2
+ORDER BY row_number
+LIMIT $3
+`
+
+type ListImportRowsParams struct {
+	ImportID uuid.UUID `json:"import_id"`
+	AfterRow int32     `json:"after_row"`
+	PageSize int32     `json:"page_size"`
+}
+
+func (q *Queries) ListImportRows(ctx context.Context, arg ListImportRowsParams) ([]ImportRow, error) {
+	rows, err := q.db.Query(ctx, listImportRows, arg.ImportID, arg.AfterRow, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ImportRow
+	for rows.Next() {
+		var i ImportRow
+		if err := rows.Scan(
+			&i.ImportID,
+			&i.RowNumber,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.Reference,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingImports = `-- name: ListPendingImports :many
+SELECT id, status, skip_invalid, total_rows, applied_rows, failed_rows, file_hash, created_at, updated_at, tenant_id FROM imports
+WHERE status = 'PENDING' AND updated_at < $1
+ORDER BY updated_at
+LIMIT $2
+`
+
+type ListPendingImportsParams struct {
+	Before   time.Time `json:"before"`
+	PageSize int32     `json:"page_size"`
+}
+
+func (q *Queries) ListPendingImports(ctx context.Context, arg ListPendingImportsParams) ([]Import, error) {
+	rows, err := q.db.Query(ctx, listPendingImports, arg.Before, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Import
+	for rows.Next() {
+		var i Import
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.SkipInvalid,
+			&i.TotalRows,
+			&i.AppliedRows,
+			&i.FailedRows,
+			&i.FileHash,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listShardedImportRows = `-- name: ListShardedImportRows :many
+SELECT r.import_id, r.row_number, r.wallet_id, r.operation_type, r.amount, r.reference, r.error FROM import_rows r
+JOIN wallets w ON w.id = r.wallet_id
+WHERE r.import_id = $1 AND r.error = '' AND w.shard_count > 0
+ORDER BY r.row_number
+`
+
+// The valid rows of sharded wallets, which are applied one by one.
+func (q *Queries) ListShardedImportRows(ctx context.Context, importID uuid.UUID) ([]ImportRow, error) {
+	rows, err := q.db.Query(ctx, listShardedImportRows, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ImportRow
+	for rows.Next() {
+		var i ImportRow
+		if err := rows.Scan(
+			&i.ImportID,
+			&i.RowNumber,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.Reference,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockImportWallets = `-- name: LockImportWallets :many
+SELECT id FROM wallets
+WHERE id IN (SELECT r.wallet_id FROM import_rows r WHERE r.import_id = $1 AND r.error = '')
+ORDER BY id
+FOR UPDATE
+`
+
+// Locks the wallets of the valid rows in ID order, so that imports and
+// transfers lock them alike.
+func (q *Queries) LockImportWallets(ctx context.Context, importID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, lockImportWallets, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setImportRowError = `-- name: SetImportRowError :exec
+UPDATE import_rows SET error = $1
+WHERE import_id = $2 AND row_number = $3
+`
+
+type SetImportRowErrorParams struct {
+	Error     string    `json:"error"`
+	ImportID  uuid.UUID `json:"import_id"`
+	RowNumber int32     `json:"row_number"`
+}
+
+func (q *Queries) SetImportRowError(ctx context.Context, arg SetImportRowErrorParams) error {
+	_, err := q.db.Exec(ctx, setImportRowError, arg.Error, arg.ImportID, arg.RowNumber)
+	return err
+}
+
+const setImportRowErrors = `-- name: SetImportRowErrors :exec
+UPDATE import_rows r SET error = e.error
+FROM (
+  SELECT ($2::int[])[i] AS row_number, ($3::text[])[i] AS error
+  FROM generate_subscripts($2::int[], 1) AS i
+) e
+WHERE r.import_id = $1 AND r.row_number = e.row_number
+`
+
+type SetImportRowErrorsParams struct {
+	ImportID   uuid.UUID `json:"import_id"`
+	RowNumbers []int32   `json:"row_numbers"`
+	Errors     []string  `json:"errors"`
+}
+
+// Sets errors[i] on row row_numbers[i].
+func (q *Queries) SetImportRowErrors(ctx context.Context, arg SetImportRowErrorsParams) error {
+	_, err := q.db.Exec(ctx, setImportRowErrors, arg.ImportID, arg.RowNumbers, arg.Errors)
+	return err
+}
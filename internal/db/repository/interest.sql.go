@@ -0,0 +1,497 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: interest.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createInterestAccrual = `-- name: CreateInterestAccrual :execrows
+INSERT INTO interest_accruals (wallet_id, accrual_date, balance, annual_rate_bps, day_count, amount_micros)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (wallet_id, accrual_date) DO NOTHING
+`
+
+type CreateInterestAccrualParams struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	AccrualDate   time.Time `json:"accrual_date"`
+	Balance       int64     `json:"balance"`
+	AnnualRateBps int32     `json:"annual_rate_bps"`
+	DayCount      string    `json:"day_count"`
+	AmountMicros  int64     `json:"amount_micros"`
+}
+
+func (q *Queries) CreateInterestAccrual(ctx context.Context, arg CreateInterestAccrualParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createInterestAccrual,
+		arg.WalletID,
+		arg.AccrualDate,
+		arg.Balance,
+		arg.AnnualRateBps,
+		arg.DayCount,
+		arg.AmountMicros,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createInterestPayout = `-- name: CreateInterestPayout :execrows
+INSERT INTO interest_payouts (wallet_id, period, accrued_micros, amount, carry_micros)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (wallet_id, period) DO NOTHING
+`
+
+type CreateInterestPayoutParams struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	Period        time.Time `json:"period"`
+	AccruedMicros int64     `json:"accrued_micros"`
+	Amount        int32     `json:"amount"`
+	CarryMicros   int64     `json:"carry_micros"`
+}
+
+func (q *Queries) CreateInterestPayout(ctx context.Context, arg CreateInterestPayoutParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createInterestPayout,
+		arg.WalletID,
+		arg.Period,
+		arg.AccruedMicros,
+		arg.Amount,
+		arg.CarryMicros,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createInterestProduct = `-- name: CreateInterestProduct :one
+INSERT INTO interest_products (name, annual_rate_bps, day_count, rounding)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, annual_rate_bps, day_count, rounding, created_at, updated_at
+`
+
+type CreateInterestProductParams struct {
+	Name          string `json:"name"`
+	AnnualRateBps int32  `json:"annual_rate_bps"`
+	DayCount      string `json:"day_count"`
+	Rounding      string `json:"rounding"`
+}
+
+func (q *Queries) CreateInterestProduct(ctx context.Context, arg CreateInterestProductParams) (InterestProduct, error) {
+	row := q.db.QueryRow(ctx, createInterestProduct,
+		arg.Name,
+		arg.AnnualRateBps,
+		arg.DayCount,
+		arg.Rounding,
+	)
+	var i InterestProduct
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AnnualRateBps,
+		&i.DayCount,
+		&i.Rounding,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteWalletInterest = `-- name: DeleteWalletInterest :execrows
+DELETE FROM wallet_interest WHERE wallet_id = $1
+`
+
+func (q *Queries) DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWalletInterest, walletID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getInterestProduct = `-- name: GetInterestProduct :one
+SELECT id, name, annual_rate_bps, day_count, rounding, created_at, updated_at FROM interest_products WHERE id = $1
+`
+
+func (q *Queries) GetInterestProduct(ctx context.Context, id uuid.UUID) (InterestProduct, error) {
+	row := q.db.QueryRow(ctx, getInterestProduct, id)
+	var i InterestProduct
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AnnualRateBps,
+		&i.DayCount,
+		&i.Rounding,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getInterestTerms = `-- name: GetInterestTerms :one
+SELECT wallet_id, created_at, annual_rate_bps, day_count, rounding FROM wallet_interest_terms WHERE wallet_id = $1
+`
+
+func (q *Queries) GetInterestTerms(ctx context.Context, walletID uuid.UUID) (WalletInterestTerm, error) {
+	row := q.db.QueryRow(ctx, getInterestTerms, walletID)
+	var i WalletInterestTerm
+	err := row.Scan(
+		&i.WalletID,
+		&i.CreatedAt,
+		&i.AnnualRateBps,
+		&i.DayCount,
+		&i.Rounding,
+	)
+	return i, err
+}
+
+const getLatestInterestPayout = `-- name: GetLatestInterestPayout :one
+SELECT wallet_id, period, accrued_micros, amount, carry_micros, created_at FROM interest_payouts
+WHERE wallet_id = $1
+ORDER BY period DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestInterestPayout(ctx context.Context, walletID uuid.UUID) (InterestPayout, error) {
+	row := q.db.QueryRow(ctx, getLatestInterestPayout, walletID)
+	var i InterestPayout
+	err := row.Scan(
+		&i.WalletID,
+		&i.Period,
+		&i.AccruedMicros,
+		&i.Amount,
+		&i.CarryMicros,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUnpaidInterest = `-- name: GetUnpaidInterest :one
+SELECT COALESCE(SUM(amount_micros), 0)::bigint AS accrued_micros
+FROM interest_accruals
+WHERE wallet_id = $1 AND NOT paid
+`
+
+func (q *Queries) GetUnpaidInterest(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, getUnpaidInterest, walletID)
+	var accrued_micros int64
+	err := row.Scan(&accrued_micros)
+	return accrued_micros, err
+}
+
+const getWalletBalanceAt = `-- name: GetWalletBalanceAt :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS balance
+FROM operations
+WHERE wallet_id = $1 AND created_at < $2::timestamptz
+`
+
+type GetWalletBalanceAtParams struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Before   time.Time `json:"before"`
+}
+
+// The ledger balance of the wallet just before the given time.
+func (q *Queries) GetWalletBalanceAt(ctx context.Context, arg GetWalletBalanceAtParams) (int64, error) {
+	row := q.db.QueryRow(ctx, getWalletBalanceAt, arg.WalletID, arg.Before)
+	var balance int64
+	err := row.Scan(&balance)
+	return balance, err
+}
+
+const getWalletInterest = `-- name: GetWalletInterest :one
+SELECT wallet_id, product_id, annual_rate_bps, created_at, updated_at FROM wallet_interest WHERE wallet_id = $1
+`
+
+func (q *Queries) GetWalletInterest(ctx context.Context, walletID uuid.UUID) (WalletInterest, error) {
+	row := q.db.QueryRow(ctx, getWalletInterest, walletID)
+	var i WalletInterest
+	err := row.Scan(
+		&i.WalletID,
+		&i.ProductID,
+		&i.AnnualRateBps,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listInterestAccruals = `-- name: ListInterestAccruals :many
+SELECT wallet_id, accrual_date, balance, annual_rate_bps, day_count, amount_micros, paid, created_at FROM interest_accruals
+WHERE wallet_id = $1 AND accrual_date >= $2
+ORDER BY accrual_date
+`
+
+type ListInterestAccrualsParams struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	FromDate time.Time `json:"from_date"`
+}
+
+func (q *Queries) ListInterestAccruals(ctx context.Context, arg ListInterestAccrualsParams) ([]InterestAccrual, error) {
+	rows, err := q.db.Query(ctx, listInterestAccruals, arg.WalletID, arg.FromDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InterestAccrual
+	for rows.Next() {
+		var i InterestAccrual
+		if err := rows.Scan(
+			&i.WalletID,
+			&i.AccrualDate,
+			&i.Balance,
+			&i.AnnualRateBps,
+			&i.DayCount,
+			&i.AmountMicros,
+			&i.Paid,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInterestPayouts = `-- name: ListInterestPayouts :many
+SELECT wallet_id, period, accrued_micros, amount, carry_micros, created_at FROM interest_payouts
+WHERE wallet_id = $1
+ORDER BY period DESC
+LIMIT $2
+`
+
+type ListInterestPayoutsParams struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Limit    int32     `json:"limit"`
+}
+
+func (q *Queries) ListInterestPayouts(ctx context.Context, arg ListInterestPayoutsParams) ([]InterestPayout, error) {
+	rows, err := q.db.Query(ctx, listInterestPayouts, arg.WalletID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InterestPayout
+	for rows.Next() {
+		var i InterestPayout
+		if err := rows.Scan(
+			&i.WalletID,
+			&i.Period,
+			&i.AccruedMicros,
+			&i.Amount,
+			&i.CarryMicros,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInterestProducts = `-- name: ListInterestProducts :many
+SELECT id, name, annual_rate_bps, day_count, rounding, created_at, updated_at FROM interest_products ORDER BY name
+`
+
+func (q *Queries) ListInterestProducts(ctx context.Context) ([]InterestProduct, error) {
+	rows, err := q.db.Query(ctx, listInterestProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InterestProduct
+	for rows.Next() {
+		var i InterestProduct
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AnnualRateBps,
+			&i.DayCount,
+			&i.Rounding,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInterestTerms = `-- name: ListInterestTerms :many
+SELECT wallet_id, created_at, annual_rate_bps, day_count, rounding FROM wallet_interest_terms
+WHERE wallet_id > $1
+ORDER BY wallet_id
+LIMIT $2
+`
+
+type ListInterestTermsParams struct {
+	AfterWalletID uuid.UUID `json:"after_wallet_id"`
+	PageSize      int32     `json:"page_size"`
+}
+
+func (q *Queries) ListInterestTerms(ctx context.Context, arg ListInterestTermsParams) ([]WalletInterestTerm, error) {
+	rows, err := q.db.Query(ctx, listInterestTerms, arg.AfterWalletID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WalletInterestTerm
+	for rows.Next() {
+		var i WalletInterestTerm
+		if err := rows.Scan(
+			&i.WalletID,
+			&i.CreatedAt,
+			&i.AnnualRateBps,
+			&i.DayCount,
+			&i.Rounding,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWalletsWithUnpaidInterest = `-- name: ListWalletsWithUnpaidInterest :many
+SELECT DISTINCT wallet_id FROM interest_accruals
+WHERE NOT paid AND accrual_date < $1 AND wallet_id > $2
+ORDER BY wallet_id
+LIMIT $3
+`
+
+type ListWalletsWithUnpaidInterestParams struct {
+	BeforeDate    time.Time `json:"before_date"`
+	AfterWalletID uuid.UUID `json:"after_wallet_id"`
+	PageSize      int32     `json:"page_size"`
+}
+
+func (q *Queries) ListWalletsWithUnpaidInterest(ctx context.Context, arg ListWalletsWithUnpaidInterestParams) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, listWalletsWithUnpaidInterest, arg.BeforeDate, arg.AfterWalletID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var wallet_id uuid.UUID
+		if err := rows.Scan(&wallet_id); err != nil {
+			return nil, err
+		}
+		items = append(items, wallet_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markInterestAccrualsPaid = `-- name: MarkInterestAccrualsPaid :one
+WITH marked AS (
+  UPDATE interest_accruals
+  SET paid = true
+  WHERE wallet_id = $1 AND NOT paid AND accrual_date < $2
+  RETURNING amount_micros
+)
+SELECT COALESCE(SUM(amount_micros), 0)::bigint AS accrued_micros FROM marked
+`
+
+type MarkInterestAccrualsPaidParams struct {
+	WalletID   uuid.UUID `json:"wallet_id"`
+	BeforeDate time.Time `json:"before_date"`
+}
+
+// Returns the sum of the accruals it marked.
+func (q *Queries) MarkInterestAccrualsPaid(ctx context.Context, arg MarkInterestAccrualsPaidParams) (int64, error) {
+	row := q.db.QueryRow(ctx, markInterestAccrualsPaid, arg.WalletID, arg.BeforeDate)
+	var accrued_micros int64
+	err := row.Scan(&accrued_micros)
+	return accrued_micros, err
+}
+
+const setWalletInterest = `-- name: SetWalletInterest :one
+INSERT INTO wallet_interest (wallet_id, product_id, annual_rate_bps)
+VALUES ($1, NULLIF($2::uuid, '00000000-0000-0000-0000-000000000000'), $3)
+ON CONFLICT (wallet_id) DO UPDATE
+SET product_id = excluded.product_id,
+    annual_rate_bps = excluded.annual_rate_bps,
+    updated_at = now()
+RETURNING wallet_id, product_id, annual_rate_bps, created_at, updated_at
+`
+
+type SetWalletInterestParams struct {
+	WalletID      uuid.UUID   `json:"wallet_id"`
+	ProductID     uuid.UUID   `json:"product_id"`
+	AnnualRateBps pgtype.Int4 `json:"annual_rate_bps"`
+}
+
+func (q *Queries) SetWalletInterest(ctx context.Context, arg SetWalletInterestParams) (WalletInterest, error) {
+	row := q.db.QueryRow(ctx, setWalletInterest, arg.WalletID, arg.ProductID, arg.AnnualRateBps)
+	var i WalletInterest
+	err := row.Scan(
+		&i.WalletID,
+		&i.ProductID,
+		&i.AnnualRateBps,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateInterestProduct = `-- name: UpdateInterestProduct :one
+UPDATE interest_products
+SET name = $2,
+    annual_rate_bps = $3,
+    day_count = $4,
+    rounding = $5,
+    updated_at = now()
+WHERE id = $1
+RETURNING id, name, annual_rate_bps, day_count, rounding, created_at, updated_at
+`
+
+type UpdateInterestProductParams struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	AnnualRateBps int32     `json:"annual_rate_bps"`
+	DayCount      string    `json:"day_count"`
+	Rounding      string    `json:"rounding"`
+}
+
+func (q *Queries) UpdateInterestProduct(ctx context.Context, arg UpdateInterestProductParams) (InterestProduct, error) {
+	row := q.db.QueryRow(ctx, updateInterestProduct,
+		arg.ID,
+		arg.Name,
+		arg.AnnualRateBps,
+		arg.DayCount,
+		arg.Rounding,
+	)
+	var i InterestProduct
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AnnualRateBps,
+		&i.DayCount,
+		&i.Rounding,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,202 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: journal.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createJournalEntry = `-- name: CreateJournalEntry :one
+WITH legs AS (
+  SELECT
+    i AS leg,
+    ($1::text[])[i] AS account,
+    ($2::uuid[])[i] AS wallet_id,
+    ($3::int[])[i] AS debit,
+    ($4::int[])[i] AS credit,
+    NULLIF(($5::text[])[i], '') AS currency
+  FROM generate_subscripts($1::text[], 1) AS i
+), priced AS (
+  SELECT
+    legs.leg, legs.account, legs.wallet_id, legs.debit, legs.credit,
+    COALESCE(legs.currency, w.currency, (
+      SELECT CASE WHEN count(DISTINCT ew.currency) = 1 THEN min(ew.currency) END
+      FROM wallets ew
+      WHERE ew.id = ANY($2::uuid[])
+    )) AS currency
+  FROM legs
+  LEFT JOIN wallets w ON w.id = legs.wallet_id
+), entry AS (
+  INSERT INTO journal_entries (description)
+  SELECT $6::text
+  WHERE (
+    SELECT bool_and(t.debit = t.credit)
+    FROM (SELECT SUM(debit) AS debit, SUM(credit) AS credit FROM priced GROUP BY currency) t
+  )
+  RETURNING id, description, created_at
+), inserted AS (
+  INSERT INTO journal_legs (entry_id, leg, account, wallet_id, debit, credit, currency)
+  SELECT entry.id, priced.leg, priced.account, NULLIF(priced.wallet_id, '00000000-0000-0000-0000-000000000000'), priced.debit, priced.credit, priced.currency
+  FROM entry, priced
+)
+SELECT id, description, created_at FROM entry
+`
+
+type CreateJournalEntryParams struct {
+	Accounts    []string    `json:"accounts"`
+	WalletIds   []uuid.UUID `json:"wallet_ids"`
+	Debits      []int32     `json:"debits"`
+	Credits     []int32     `json:"credits"`
+	Currencies  []string    `json:"currencies"`
+	Description string      `json:"description"`
+}
+
+type CreateJournalEntryRow struct {
+	ID          uuid.UUID `json:"id"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// The legs are given as parallel arrays, a zero wallet ID meaning a system
+// account. A leg without a currency is in that of its wallet or, on a
+// system account, in the one currency of the wallets of the entry. Nothing
+// is inserted, and no row returned, unless the debits equal the credits in
+// every currency.
+func (q *Queries) CreateJournalEntry(ctx context.Context, arg CreateJournalEntryParams) (CreateJournalEntryRow, error) {
+	row := q.db.QueryRow(ctx, createJournalEntry,
+		arg.Accounts,
+		arg.WalletIds,
+		arg.Debits,
+		arg.Credits,
+		arg.Currencies,
+		arg.Description,
+	)
+	var i CreateJournalEntryRow
+	err := row.Scan(&i.ID, &i.Description, &i.CreatedAt)
+	return i, err
+}
+
+const getTrialBalance = `-- name: GetTrialBalance :many
+SELECT
+  currency,
+  account,
+  COALESCE(SUM(debit), 0)::bigint AS debit,
+  COALESCE(SUM(credit), 0)::bigint AS credit
+FROM journal_legs
+GROUP BY currency, account
+ORDER BY currency, account
+`
+
+type GetTrialBalanceRow struct {
+	Currency string `json:"currency"`
+	Account  string `json:"account"`
+	Debit    int64  `json:"debit"`
+	Credit   int64  `json:"credit"`
+}
+
+func (q *Queries) GetTrialBalance(ctx context.Context) ([]GetTrialBalanceRow, error) {
+	rows, err := q.db.Query(ctx, getTrialBalance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTrialBalanceRow
+	for rows.Next() {
+		var i GetTrialBalanceRow
+		if err := rows.Scan(
+			&i.Currency,
+			&i.Account,
+			&i.Debit,
+			&i.Credit,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJournalLegs = `-- name: ListJournalLegs :many
+SELECT entry_id, leg, account, wallet_id, currency, debit, credit FROM journal_legs
+WHERE entry_id = $1
+ORDER BY leg
+`
+
+func (q *Queries) ListJournalLegs(ctx context.Context, entryID uuid.UUID) ([]JournalLeg, error) {
+	rows, err := q.db.Query(ctx, listJournalLegs, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JournalLeg
+	for rows.Next() {
+		var i JournalLeg
+		if err := rows.Scan(
+			&i.EntryID,
+			&i.Leg,
+			&i.Account,
+			&i.WalletID,
+			&i.Currency,
+			&i.Debit,
+			&i.Credit,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWalletJournalMismatches = `-- name: ListWalletJournalMismatches :many
+SELECT id, balance, journal_balance
+FROM (
+  SELECT
+    w.id,
+    (w.balance + COALESCE((SELECT SUM(s.balance) FROM wallet_shards s WHERE s.wallet_id = w.id), 0))::bigint AS balance,
+    COALESCE((SELECT SUM(l.credit::bigint - l.debit) FROM journal_legs l WHERE l.wallet_id = w.id AND l.account = 'wallet'), 0)::bigint AS journal_balance
+  FROM wallets w
+) b
+WHERE b.balance <> b.journal_balance
+ORDER BY b.id
+LIMIT $1
+`
+
+type ListWalletJournalMismatchesRow struct {
+	ID             uuid.UUID `json:"id"`
+	Balance        int64     `json:"balance"`
+	JournalBalance int64     `json:"journal_balance"`
+}
+
+// Wallets whose legs in the journal do not add up to their balance, their
+// shards included.
+func (q *Queries) ListWalletJournalMismatches(ctx context.Context, maxRows int32) ([]ListWalletJournalMismatchesRow, error) {
+	rows, err := q.db.Query(ctx, listWalletJournalMismatches, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWalletJournalMismatchesRow
+	for rows.Next() {
+		var i ListWalletJournalMismatchesRow
+		if err := rows.Scan(&i.ID, &i.Balance, &i.JournalBalance); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -5,10 +5,219 @@
 package repository
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditLog struct {
+	ID        uuid.UUID       `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	WalletID  uuid.UUID       `json:"wallet_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id"`
+	SourceIp  string          `json:"source_ip"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ExchangeQuote struct {
+	ID              uuid.UUID `json:"id"`
+	FromWalletID    uuid.UUID `json:"from_wallet_id"`
+	ToWalletID      uuid.UUID `json:"to_wallet_id"`
+	RateID          uuid.UUID `json:"rate_id"`
+	FromCurrency    string    `json:"from_currency"`
+	ToCurrency      string    `json:"to_currency"`
+	RateMicros      int64     `json:"rate_micros"`
+	SpreadBps       int32     `json:"spread_bps"`
+	Rounding        string    `json:"rounding"`
+	Amount          int32     `json:"amount"`
+	ConvertedAmount int32     `json:"converted_amount"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	FromOperationID uuid.UUID `json:"from_operation_id"`
+	ToOperationID   uuid.UUID `json:"to_operation_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ExchangeRate struct {
+	ID            uuid.UUID `json:"id"`
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	RateMicros    int64     `json:"rate_micros"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	Source        string    `json:"source"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type FeeSchedule struct {
+	ID            uuid.UUID `json:"id"`
+	OperationType string    `json:"operation_type"`
+	ProductID     uuid.UUID `json:"product_id"`
+	Kind          string    `json:"kind"`
+	FlatAmount    int32     `json:"flat_amount"`
+	RateBps       int32     `json:"rate_bps"`
+	MinFee        int32     `json:"min_fee"`
+	MaxFee        int32     `json:"max_fee"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type FeeTier struct {
+	ScheduleID uuid.UUID `json:"schedule_id"`
+	MinAmount  int32     `json:"min_amount"`
+	FlatAmount int32     `json:"flat_amount"`
+	RateBps    int32     `json:"rate_bps"`
+}
+
+type Import struct {
+	ID          uuid.UUID `json:"id"`
+	Status      string    `json:"status"`
+	SkipInvalid bool      `json:"skip_invalid"`
+	TotalRows   int32     `json:"total_rows"`
+	AppliedRows int32     `json:"applied_rows"`
+	FailedRows  int32     `json:"failed_rows"`
+	FileHash    string    `json:"file_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	TenantID    uuid.UUID `json:"tenant_id"`
+}
+
+type ImportRow struct {
+	ImportID      uuid.UUID `json:"import_id"`
+	RowNumber     int32     `json:"row_number"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+	Reference     string    `json:"reference"`
+	Error         string    `json:"error"`
+}
+
+type InterestAccrual struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	AccrualDate   time.Time `json:"accrual_date"`
+	Balance       int64     `json:"balance"`
+	AnnualRateBps int32     `json:"annual_rate_bps"`
+	DayCount      string    `json:"day_count"`
+	AmountMicros  int64     `json:"amount_micros"`
+	Paid          bool      `json:"paid"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type InterestPayout struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	Period        time.Time `json:"period"`
+	AccruedMicros int64     `json:"accrued_micros"`
+	Amount        int32     `json:"amount"`
+	CarryMicros   int64     `json:"carry_micros"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type InterestProduct struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	AnnualRateBps int32     `json:"annual_rate_bps"`
+	DayCount      string    `json:"day_count"`
+	Rounding      string    `json:"rounding"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type JournalEntry struct {
+	ID          uuid.UUID `json:"id"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type JournalLeg struct {
+	EntryID  uuid.UUID `json:"entry_id"`
+	Leg      int32     `json:"leg"`
+	Account  string    `json:"account"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	Currency string    `json:"currency"`
+	Debit    int32     `json:"debit"`
+	Credit   int32     `json:"credit"`
+}
+
+type Operation struct {
+	ID             uuid.UUID `json:"id"`
+	WalletID       uuid.UUID `json:"wallet_id"`
+	OperationType  string    `json:"operation_type"`
+	Amount         int32     `json:"amount"`
+	CreatedAt      time.Time `json:"created_at"`
+	ImportID       uuid.UUID `json:"import_id"`
+	Reference      string    `json:"reference"`
+	ReversalOf     uuid.UUID `json:"reversal_of"`
+	ReversedAmount int32     `json:"reversed_amount"`
+	CounterpartID  uuid.UUID `json:"counterpart_id"`
+}
+
+type ScheduledOperation struct {
+	ID             uuid.UUID `json:"id"`
+	WalletID       uuid.UUID `json:"wallet_id"`
+	TargetWalletID uuid.UUID `json:"target_wallet_id"`
+	OperationType  string    `json:"operation_type"`
+	Amount         int32     `json:"amount"`
+	Cron           string    `json:"cron"`
+	Status         string    `json:"status"`
+	NextRunAt      time.Time `json:"next_run_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type ScheduledOperationRun struct {
+	ID                   uuid.UUID `json:"id"`
+	ScheduledOperationID uuid.UUID `json:"scheduled_operation_id"`
+	ScheduledFor         time.Time `json:"scheduled_for"`
+	Status               string    `json:"status"`
+	Error                string    `json:"error"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+type Tenant struct {
+	ID         uuid.UUID   `json:"id"`
+	Name       string      `json:"name"`
+	ApiKeyHash pgtype.Text `json:"-"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
 type Wallet struct {
-	ID      uuid.UUID `json:"id"`
-	Balance int32     `json:"balance"`
+	ID         uuid.UUID       `json:"id"`
+	Balance    int32           `json:"balance"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ShardCount int32           `json:"shard_count"`
+	Version    int64           `json:"version"`
+	ProductID  uuid.UUID       `json:"product_id"`
+	TenantID   uuid.UUID       `json:"tenant_id"`
+	OwnerID    uuid.UUID       `json:"owner_id"`
+	IsSystem   bool            `json:"is_system"`
+	Currency   string          `json:"currency"`
+	Metadata   json.RawMessage `json:"metadata"`
+	Labels     json.RawMessage `json:"labels"`
+}
+
+type WalletInterest struct {
+	WalletID      uuid.UUID   `json:"wallet_id"`
+	ProductID     uuid.UUID   `json:"product_id"`
+	AnnualRateBps pgtype.Int4 `json:"annual_rate_bps"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type WalletInterestTerm struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	AnnualRateBps int32     `json:"annual_rate_bps"`
+	DayCount      string    `json:"day_count"`
+	Rounding      string    `json:"rounding"`
+}
+
+type WalletShard struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	ShardID  int32     `json:"shard_id"`
+	Balance  int32     `json:"balance"`
+	Version  int64     `json:"version"`
 }
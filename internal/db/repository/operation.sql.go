@@ -0,0 +1,292 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: operation.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createOperation = `-- name: CreateOperation :one
+INSERT INTO operations (wallet_id, operation_type, amount, reversal_of, counterpart_id, import_id, reference)
+VALUES (
+  $1, $2, $3,
+  NULLIF($4::uuid, '00000000-0000-0000-0000-000000000000'),
+  NULLIF($5::uuid, '00000000-0000-0000-0000-000000000000'),
+  NULLIF($6::uuid, '00000000-0000-0000-0000-000000000000'),
+  $7
+)
+RETURNING id, wallet_id, operation_type, amount, created_at, import_id, reference, reversal_of, reversed_amount, counterpart_id
+`
+
+type CreateOperationParams struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+	ReversalOf    uuid.UUID `json:"reversal_of"`
+	CounterpartID uuid.UUID `json:"counterpart_id"`
+	ImportID      uuid.UUID `json:"import_id"`
+	Reference     string    `json:"reference"`
+}
+
+// A zero reversal_of records an operation that reverses none, a zero
+// counterpart_id one that is not a leg of a transfer, a zero import_id one
+// that was not imported.
+func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams) (Operation, error) {
+	row := q.db.QueryRow(ctx, createOperation,
+		arg.WalletID,
+		arg.OperationType,
+		arg.Amount,
+		arg.ReversalOf,
+		arg.CounterpartID,
+		arg.ImportID,
+		arg.Reference,
+	)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.ImportID,
+		&i.Reference,
+		&i.ReversalOf,
+		&i.ReversedAmount,
+		&i.CounterpartID,
+	)
+	return i, err
+}
+
+type CreateOperationsParams struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+}
+
+const getOperation = `-- name: GetOperation :one
+SELECT id, wallet_id, operation_type, amount, created_at, import_id, reference, reversal_of, reversed_amount, counterpart_id FROM operations WHERE id = $1
+`
+
+func (q *Queries) GetOperation(ctx context.Context, id uuid.UUID) (Operation, error) {
+	row := q.db.QueryRow(ctx, getOperation, id)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.ImportID,
+		&i.Reference,
+		&i.ReversalOf,
+		&i.ReversedAmount,
+		&i.CounterpartID,
+	)
+	return i, err
+}
+
+const getWalletLedgerBalance = `-- name: GetWalletLedgerBalance :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS ledger_balance
+FROM operations
+WHERE wallet_id = $1
+`
+
+func (q *Queries) GetWalletLedgerBalance(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, getWalletLedgerBalance, walletID)
+	var ledger_balance int64
+	err := row.Scan(&ledger_balance)
+	return ledger_balance, err
+}
+
+const listOperationsPage = `-- name: ListOperationsPage :many
+SELECT id, wallet_id, operation_type, amount, created_at, import_id, reference, reversal_of, reversed_amount, counterpart_id FROM operations
+WHERE (created_at, id) > ($1::timestamptz, $2::uuid)
+  AND ($3::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = $3::uuid)
+ORDER BY created_at, id
+LIMIT $4
+`
+
+type ListOperationsPageParams struct {
+	AfterCreatedAt time.Time `json:"after_created_at"`
+	AfterID        uuid.UUID `json:"after_id"`
+	WalletID       uuid.UUID `json:"wallet_id"`
+	PageSize       int32     `json:"page_size"`
+}
+
+func (q *Queries) ListOperationsPage(ctx context.Context, arg ListOperationsPageParams) ([]Operation, error) {
+	rows, err := q.db.Query(ctx, listOperationsPage,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.WalletID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Operation
+	for rows.Next() {
+		var i Operation
+		if err := rows.Scan(
+			&i.ID,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.ImportID,
+			&i.Reference,
+			&i.ReversalOf,
+			&i.ReversedAmount,
+			&i.CounterpartID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWalletLedgerPage = `-- name: ListWalletLedgerPage :many
+SELECT
+  w.id,
+  (w.balance + COALESCE((SELECT SUM(s.balance) FROM wallet_shards s WHERE s.wallet_id = w.id), 0))::bigint AS balance,
+  COALESCE(SUM(o.amount), 0)::bigint AS ledger_balance
+FROM wallets w
+LEFT JOIN operations o ON o.wallet_id = w.id
+WHERE w.id > $1
+GROUP BY w.id
+ORDER BY w.id
+LIMIT $2
+`
+
+type ListWalletLedgerPageParams struct {
+	AfterID  uuid.UUID `json:"after_id"`
+	PageSize int32     `json:"page_size"`
+}
+
+type ListWalletLedgerPageRow struct {
+	ID            uuid.UUID `json:"id"`
+	Balance       int64     `json:"balance"`
+	LedgerBalance int64     `json:"ledger_balance"`
+}
+
+func (q *Queries) ListWalletLedgerPage(ctx context.Context, arg ListWalletLedgerPageParams) ([]ListWalletLedgerPageRow, error) {
+	rows, err := q.db.Query(ctx, listWalletLedgerPage, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWalletLedgerPageRow
+	for rows.Next() {
+		var i ListWalletLedgerPageRow
+		if err := rows.Scan(&i.ID, &i.Balance, &i.LedgerBalance); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWalletOperations = `-- name: ListWalletOperations :many
+SELECT id, wallet_id, operation_type, amount, created_at, import_id, reference, reversal_of, reversed_amount, counterpart_id FROM operations
+WHERE wallet_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+`
+
+type ListWalletOperationsParams struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Limit    int32     `json:"limit"`
+}
+
+func (q *Queries) ListWalletOperations(ctx context.Context, arg ListWalletOperationsParams) ([]Operation, error) {
+	rows, err := q.db.Query(ctx, listWalletOperations, arg.WalletID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Operation
+	for rows.Next() {
+		var i Operation
+		if err := rows.Scan(
+			&i.ID,
+			&i.WalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.ImportID,
+			&i.Reference,
+			&i.ReversalOf,
+			&i.ReversedAmount,
+			&i.CounterpartID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reverseOperation = `-- name: ReverseOperation :one
+UPDATE operations
+SET reversed_amount = reversed_amount + $1
+WHERE id = $2
+  AND reversed_amount + $1 <= abs(operations.amount::bigint)
+RETURNING id, wallet_id, operation_type, amount, created_at, import_id, reference, reversal_of, reversed_amount, counterpart_id
+`
+
+type ReverseOperationParams struct {
+	Amount int32     `json:"amount"`
+	ID     uuid.UUID `json:"id"`
+}
+
+// Fails to match once the operation would be reversed by more than its
+// amount.
+func (q *Queries) ReverseOperation(ctx context.Context, arg ReverseOperationParams) (Operation, error) {
+	row := q.db.QueryRow(ctx, reverseOperation, arg.Amount, arg.ID)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.ImportID,
+		&i.Reference,
+		&i.ReversalOf,
+		&i.ReversedAmount,
+		&i.CounterpartID,
+	)
+	return i, err
+}
+
+const setOperationCounterpart = `-- name: SetOperationCounterpart :exec
+UPDATE operations SET counterpart_id = $1 WHERE id = $2
+`
+
+type SetOperationCounterpartParams struct {
+	CounterpartID uuid.UUID `json:"counterpart_id"`
+	ID            uuid.UUID `json:"id"`
+}
+
+// Links the first leg of a transfer to the second, which is created with
+// the first as its counterpart.
+func (q *Queries) SetOperationCounterpart(ctx context.Context, arg SetOperationCounterpartParams) error {
+	_, err := q.db.Exec(ctx, setOperationCounterpart, arg.CounterpartID, arg.ID)
+	return err
+}
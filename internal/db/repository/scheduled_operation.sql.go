@@ -0,0 +1,280 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: scheduled_operation.sql
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimDueScheduledOperation = `-- name: ClaimDueScheduledOperation :one
+SELECT id, wallet_id, target_wallet_id, operation_type, amount, cron, status, next_run_at, created_at, updated_at FROM scheduled_operations
+WHERE status = 'ACTIVE' AND next_run_at <= $1::timestamptz
+ORDER BY next_run_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+// Rows claimed by other schedulers are skipped, so each instance takes a
+// different operation and none waits for another.
+func (q *Queries) ClaimDueScheduledOperation(ctx context.Context, now time.Time) (ScheduledOperation, error) {
+	row := q.db.QueryRow(ctx, claimDueScheduledOperation, now)
+	var i ScheduledOperation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.TargetWalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.Cron,
+		&i.Status,
+		&i.NextRunAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createScheduledOperation = `-- name: CreateScheduledOperation :one
+INSERT INTO scheduled_operations (wallet_id, target_wallet_id, operation_type, amount, cron, next_run_at)
+VALUES ($1, NULLIF($2::uuid, '00000000-0000-0000-0000-000000000000'), $3, $4, $5, $6)
+RETURNING id, wallet_id, target_wallet_id, operation_type, amount, cron, status, next_run_at, created_at, updated_at
+`
+
+type CreateScheduledOperationParams struct {
+	WalletID       uuid.UUID `json:"wallet_id"`
+	TargetWalletID uuid.UUID `json:"target_wallet_id"`
+	OperationType  string    `json:"operation_type"`
+	Amount         int32     `json:"amount"`
+	Cron           string    `json:"cron"`
+	NextRunAt      time.Time `json:"next_run_at"`
+}
+
+func (q *Queries) CreateScheduledOperation(ctx context.Context, arg CreateScheduledOperationParams) (ScheduledOperation, error) {
+	row := q.db.QueryRow(ctx, createScheduledOperation,
+		arg.WalletID,
+		arg.TargetWalletID,
+		arg.OperationType,
+		arg.Amount,
+		arg.Cron,
+		arg.NextRunAt,
+	)
+	var i ScheduledOperation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.TargetWalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.Cron,
+		&i.Status,
+		&i.NextRunAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createScheduledOperationRun = `-- name: CreateScheduledOperationRun :one
+INSERT INTO scheduled_operation_runs (scheduled_operation_id, scheduled_for, status, error)
+VALUES ($1, $2, $3, $4)
+RETURNING id, scheduled_operation_id, scheduled_for, status, error, created_at
+`
+
+type CreateScheduledOperationRunParams struct {
+	ScheduledOperationID uuid.UUID `json:"scheduled_operation_id"`
+	ScheduledFor         time.Time `json:"scheduled_for"`
+	Status               string    `json:"status"`
+	Error                string    `json:"error"`
+}
+
+func (q *Queries) CreateScheduledOperationRun(ctx context.Context, arg CreateScheduledOperationRunParams) (ScheduledOperationRun, error) {
+	row := q.db.QueryRow(ctx, createScheduledOperationRun,
+		arg.ScheduledOperationID,
+		arg.ScheduledFor,
+		arg.Status,
+		arg.Error,
+	)
+	var i ScheduledOperationRun
+	err := row.Scan(
+		&i.ID,
+		&i.ScheduledOperationID,
+		&i.ScheduledFor,
+		&i.Status,
+		&i.Error,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteScheduledOperation = `-- name: DeleteScheduledOperation :execrows
+DELETE FROM scheduled_operations WHERE id = $1
+`
+
+func (q *Queries) DeleteScheduledOperation(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteScheduledOperation, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getScheduledOperation = `-- name: GetScheduledOperation :one
+SELECT id, wallet_id, target_wallet_id, operation_type, amount, cron, status, next_run_at, created_at, updated_at FROM scheduled_operations WHERE id = $1
+`
+
+func (q *Queries) GetScheduledOperation(ctx context.Context, id uuid.UUID) (ScheduledOperation, error) {
+	row := q.db.QueryRow(ctx, getScheduledOperation, id)
+	var i ScheduledOperation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.TargetWalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.Cron,
+		&i.Status,
+		&i.NextRunAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listScheduledOperationRuns = `-- name: ListScheduledOperationRuns :many
+SELECT id, scheduled_operation_id, scheduled_for, status, error, created_at FROM scheduled_operation_runs
+WHERE scheduled_operation_id = $1
+ORDER BY scheduled_for DESC
+LIMIT $2
+`
+
+type ListScheduledOperationRunsParams struct {
+	ScheduledOperationID uuid.UUID `json:"scheduled_operation_id"`
+	Limit                int32     `json:"limit"`
+}
+
+func (q *Queries) ListScheduledOperationRuns(ctx context.Context, arg ListScheduledOperationRunsParams) ([]ScheduledOperationRun, error) {
+	rows, err := q.db.Query(ctx, listScheduledOperationRuns, arg.ScheduledOperationID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ScheduledOperationRun
+	for rows.Next() {
+		var i ScheduledOperationRun
+		if err := rows.Scan(
+			&i.ID,
+			&i.ScheduledOperationID,
+			&i.ScheduledFor,
+			&i.Status,
+			&i.Error,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduledOperations = `-- name: ListScheduledOperations :many
+SELECT id, wallet_id, target_wallet_id, operation_type, amount, cron, status, next_run_at, created_at, updated_at FROM scheduled_operations
+WHERE id > $1
+  AND ($2::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = $2::uuid OR target_wallet_id = $2::uuid)
+ORDER BY id
+LIMIT $3
+`
+
+type ListScheduledOperationsParams struct {
+	AfterID  uuid.UUID `json:"after_id"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	PageSize int32     `json:"page_size"`
+}
+
+func (q *Queries) ListScheduledOperations(ctx context.Context, arg ListScheduledOperationsParams) ([]ScheduledOperation, error) {
+	rows, err := q.db.Query(ctx, listScheduledOperations, arg.AfterID, arg.WalletID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ScheduledOperation
+	for rows.Next() {
+		var i ScheduledOperation
+		if err := rows.Scan(
+			&i.ID,
+			&i.WalletID,
+			&i.TargetWalletID,
+			&i.OperationType,
+			&i.Amount,
+			&i.Cron,
+			&i.Status,
+			&i.NextRunAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateScheduledOperation = `-- name: UpdateScheduledOperation :one
+UPDATE scheduled_operations
+SET target_wallet_id = NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000'),
+    operation_type = $2,
+    amount = $3,
+    cron = $4,
+    status = $5,
+    next_run_at = $6,
+    updated_at = now()
+WHERE id = $7
+RETURNING id, wallet_id, target_wallet_id, operation_type, amount, cron, status, next_run_at, created_at, updated_at
+`
+
+type UpdateScheduledOperationParams struct {
+	TargetWalletID uuid.UUID `json:"target_wallet_id"`
+	OperationType  string    `json:"operation_type"`
+	Amount         int32     `json:"amount"`
+	Cron           string    `json:"cron"`
+	Status         string    `json:"status"`
+	NextRunAt      time.Time `json:"next_run_at"`
+	ID             uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateScheduledOperation(ctx context.Context, arg UpdateScheduledOperationParams) (ScheduledOperation, error) {
+	row := q.db.QueryRow(ctx, updateScheduledOperation,
+		arg.TargetWalletID,
+		arg.OperationType,
+		arg.Amount,
+		arg.Cron,
+		arg.Status,
+		arg.NextRunAt,
+		arg.ID,
+	)
+	var i ScheduledOperation
+	err := row.Scan(
+		&i.ID,
+		&i.WalletID,
+		&i.TargetWalletID,
+		&i.OperationType,
+		&i.Amount,
+		&i.Cron,
+		&i.Status,
+		&i.NextRunAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
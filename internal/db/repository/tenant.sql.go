@@ -0,0 +1,102 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: tenant.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createTenant = `-- name: CreateTenant :one
+INSERT INTO tenants (name)
+VALUES ($1)
+RETURNING id, name, api_key_hash, created_at
+`
+
+func (q *Queries) CreateTenant(ctx context.Context, name string) (Tenant, error) {
+	row := q.db.QueryRow(ctx, createTenant, name)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ApiKeyHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getTenantByKeyHash = `-- name: GetTenantByKeyHash :one
+SELECT id, name, api_key_hash, created_at FROM tenants
+WHERE api_key_hash = $1
+`
+
+func (q *Queries) GetTenantByKeyHash(ctx context.Context, apiKeyHash pgtype.Text) (Tenant, error) {
+	row := q.db.QueryRow(ctx, getTenantByKeyHash, apiKeyHash)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ApiKeyHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listTenants = `-- name: ListTenants :many
+SELECT id, name, api_key_hash, created_at FROM tenants
+ORDER BY name
+`
+
+func (q *Queries) ListTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := q.db.Query(ctx, listTenants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Tenant
+	for rows.Next() {
+		var i Tenant
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.ApiKeyHash,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setTenantKeyHash = `-- name: SetTenantKeyHash :one
+UPDATE tenants
+SET api_key_hash = $1
+WHERE id = $2
+RETURNING id, name, api_key_hash, created_at
+`
+
+type SetTenantKeyHashParams struct {
+	ApiKeyHash pgtype.Text `json:"-"`
+	ID         uuid.UUID   `json:"id"`
+}
+
+func (q *Queries) SetTenantKeyHash(ctx context.Context, arg SetTenantKeyHashParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, setTenantKeyHash, arg.ApiKeyHash, arg.ID)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ApiKeyHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
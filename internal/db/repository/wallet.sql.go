@@ -7,18 +7,421 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/google/uuid"
 )
 
+const createWallet = `-- name: CreateWallet :one
+INSERT INTO wallets (currency, metadata, labels)
+VALUES (
+  COALESCE(NULLIF($1::text, ''), 'XXX'),
+  COALESCE($2::jsonb, '{}'),
+  COALESCE($3::jsonb, '{}')
+)
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type CreateWalletParams struct {
+	Currency string          `json:"currency"`
+	Metadata json.RawMessage `json:"metadata"`
+	Labels   json.RawMessage `json:"labels"`
+}
+
+// Empty fields take the column defaults.
+func (q *Queries) CreateWallet(ctx context.Context, arg CreateWalletParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, createWallet, arg.Currency, arg.Metadata, arg.Labels)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
 const getWalletByID = `-- name: GetWalletByID :one
-SELECT id, balance FROM wallets WHERE id = $1
+SELECT id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels FROM wallets WHERE id = $1
 `
 
 func (q *Queries) GetWalletByID(ctx context.Context, id uuid.UUID) (Wallet, error) {
 	row := q.db.QueryRow(ctx, getWalletByID, id)
 	var i Wallet
-	err := row.Scan(&i.ID, &i.Balance)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const getWalletByIDForUpdate = `-- name: GetWalletByIDForUpdate :one
+SELECT id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels FROM wallets WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) GetWalletByIDForUpdate(ctx context.Context, id uuid.UUID) (Wallet, error) {
+	row := q.db.QueryRow(ctx, getWalletByIDForUpdate, id)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const listOwnerWallets = `-- name: ListOwnerWallets :many
+SELECT id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels FROM wallets
+WHERE owner_id = $1
+  AND id > $2
+ORDER BY id
+LIMIT $3
+`
+
+type ListOwnerWalletsParams struct {
+	OwnerID  uuid.UUID `json:"owner_id"`
+	AfterID  uuid.UUID `json:"after_id"`
+	PageSize int32     `json:"page_size"`
+}
+
+func (q *Queries) ListOwnerWallets(ctx context.Context, arg ListOwnerWalletsParams) ([]Wallet, error) {
+	rows, err := q.db.Query(ctx, listOwnerWallets, arg.OwnerID, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Wallet
+	for rows.Next() {
+		var i Wallet
+		if err := rows.Scan(
+			&i.ID,
+			&i.Balance,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ShardCount,
+			&i.Version,
+			&i.ProductID,
+			&i.TenantID,
+			&i.OwnerID,
+			&i.IsSystem,
+			&i.Currency,
+			&i.Metadata,
+			&i.Labels,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWallets = `-- name: ListWallets :many
+SELECT id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels FROM wallets
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListWalletsParams struct {
+	AfterID  uuid.UUID `json:"after_id"`
+	PageSize int32     `json:"page_size"`
+}
+
+func (q *Queries) ListWallets(ctx context.Context, arg ListWalletsParams) ([]Wallet, error) {
+	rows, err := q.db.Query(ctx, listWallets, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Wallet
+	for rows.Next() {
+		var i Wallet
+		if err := rows.Scan(
+			&i.ID,
+			&i.Balance,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ShardCount,
+			&i.Version,
+			&i.ProductID,
+			&i.TenantID,
+			&i.OwnerID,
+			&i.IsSystem,
+			&i.Currency,
+			&i.Metadata,
+			&i.Labels,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markSystemWallet = `-- name: MarkSystemWallet :one
+UPDATE wallets
+SET is_system = true
+WHERE id = $1
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+func (q *Queries) MarkSystemWallet(ctx context.Context, id uuid.UUID) (Wallet, error) {
+	row := q.db.QueryRow(ctx, markSystemWallet, id)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletBalance = `-- name: SetWalletBalance :one
+UPDATE wallets
+SET balance = $1
+WHERE id = $2
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletBalanceParams struct {
+	Balance int32     `json:"balance"`
+	ID      uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetWalletBalance(ctx context.Context, arg SetWalletBalanceParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletBalance, arg.Balance, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletDetails = `-- name: SetWalletDetails :one
+UPDATE wallets
+SET metadata = COALESCE($1::jsonb, metadata),
+    labels = COALESCE($2::jsonb, labels)
+WHERE id = $3
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletDetailsParams struct {
+	Metadata json.RawMessage `json:"metadata"`
+	Labels   json.RawMessage `json:"labels"`
+	ID       uuid.UUID       `json:"id"`
+}
+
+// A NULL field is left as it is.
+func (q *Queries) SetWalletDetails(ctx context.Context, arg SetWalletDetailsParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletDetails, arg.Metadata, arg.Labels, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletOwner = `-- name: SetWalletOwner :one
+UPDATE wallets
+SET owner_id = NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000')
+WHERE id = $2
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletOwnerParams struct {
+	OwnerID uuid.UUID `json:"owner_id"`
+	ID      uuid.UUID `json:"id"`
+}
+
+// A zero owner_id clears the owner.
+func (q *Queries) SetWalletOwner(ctx context.Context, arg SetWalletOwnerParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletOwner, arg.OwnerID, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletProduct = `-- name: SetWalletProduct :one
+UPDATE wallets
+SET product_id = NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000')
+WHERE id = $2
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletProductParams struct {
+	ProductID uuid.UUID `json:"product_id"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// A zero product_id clears the product.
+func (q *Queries) SetWalletProduct(ctx context.Context, arg SetWalletProductParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletProduct, arg.ProductID, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletShardCount = `-- name: SetWalletShardCount :one
+UPDATE wallets
+SET shard_count = $1
+WHERE id = $2
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletShardCountParams struct {
+	ShardCount int32     `json:"shard_count"`
+	ID         uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetWalletShardCount(ctx context.Context, arg SetWalletShardCountParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletShardCount, arg.ShardCount, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const setWalletStatus = `-- name: SetWalletStatus :one
+UPDATE wallets
+SET status = $1
+WHERE id = $2
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
+`
+
+type SetWalletStatusParams struct {
+	Status string    `json:"status"`
+	ID     uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetWalletStatus(ctx context.Context, arg SetWalletStatusParams) (Wallet, error) {
+	row := q.db.QueryRow(ctx, setWalletStatus, arg.Status, arg.ID)
+	var i Wallet
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
 	return i, err
 }
 
@@ -26,7 +429,10 @@ const updateWallet = `-- name: UpdateWallet :one
 UPDATE wallets 
 SET balance = balance + $1
 WHERE id = $2
-RETURNING id, balance
+  AND status = 'ACTIVE'
+  AND shard_count = 0
+  AND ($1 >= 0 OR balance + $1 >= 0)
+RETURNING id, balance, status, created_at, shard_count, version, product_id, tenant_id, owner_id, is_system, currency, metadata, labels
 `
 
 type UpdateWalletParams struct {
@@ -37,6 +443,20 @@ type UpdateWalletParams struct {
 func (q *Queries) UpdateWallet(ctx context.Context, arg UpdateWalletParams) (Wallet, error) {
 	row := q.db.QueryRow(ctx, updateWallet, arg.Amount, arg.ID)
 	var i Wallet
-	err := row.Scan(&i.ID, &i.Balance)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ShardCount,
+		&i.Version,
+		&i.ProductID,
+		&i.TenantID,
+		&i.OwnerID,
+		&i.IsSystem,
+		&i.Currency,
+		&i.Metadata,
+		&i.Labels,
+	)
 	return i, err
 }
@@ -0,0 +1,147 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: wallet_shard.sql
+
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createWalletShards = `-- name: CreateWalletShards :exec
+INSERT INTO wallet_shards (wallet_id, shard_id)
+SELECT w.id, generate_series(0, w.shard_count - 1)
+FROM wallets w
+WHERE w.id = $1
+`
+
+func (q *Queries) CreateWalletShards(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, createWalletShards, id)
+	return err
+}
+
+const creditWalletShard = `-- name: CreditWalletShard :execrows
+UPDATE wallet_shards s
+SET balance = s.balance + $1
+FROM wallets w
+WHERE s.wallet_id = $2
+  AND s.shard_id = $3
+  AND w.id = s.wallet_id
+  AND w.status = 'ACTIVE'
+`
+
+type CreditWalletShardParams struct {
+	Amount   int32     `json:"amount"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	ShardID  int32     `json:"shard_id"`
+}
+
+func (q *Queries) CreditWalletShard(ctx context.Context, arg CreditWalletShardParams) (int64, error) {
+	result, err := q.db.Exec(ctx, creditWalletShard, arg.Amount, arg.WalletID, arg.ShardID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWalletShards = `-- name: DeleteWalletShards :exec
+DELETE FROM wallet_shards WHERE wallet_id = $1
+`
+
+func (q *Queries) DeleteWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteWalletShards, walletID)
+	return err
+}
+
+const getWalletWithShards = `-- name: GetWalletWithShards :one
+SELECT
+  w.id, w.balance, w.status, w.created_at, w.shard_count, w.version, w.product_id, w.tenant_id, w.owner_id, w.is_system, w.currency, w.metadata, w.labels,
+  COALESCE(SUM(s.balance), 0)::bigint AS shards_balance,
+  COALESCE(SUM(s.version), 0)::bigint AS shards_version
+FROM wallets w
+LEFT JOIN wallet_shards s ON s.wallet_id = w.id
+WHERE w.id = $1
+GROUP BY w.id
+`
+
+type GetWalletWithShardsRow struct {
+	Wallet        Wallet `json:"wallet"`
+	ShardsBalance int64  `json:"shards_balance"`
+	ShardsVersion int64  `json:"shards_version"`
+}
+
+// One statement, so the wallet and its shards come from the same snapshot
+// and a concurrent fold is counted exactly once.
+func (q *Queries) GetWalletWithShards(ctx context.Context, id uuid.UUID) (GetWalletWithShardsRow, error) {
+	row := q.db.QueryRow(ctx, getWalletWithShards, id)
+	var i GetWalletWithShardsRow
+	err := row.Scan(
+		&i.Wallet.ID,
+		&i.Wallet.Balance,
+		&i.Wallet.Status,
+		&i.Wallet.CreatedAt,
+		&i.Wallet.ShardCount,
+		&i.Wallet.Version,
+		&i.Wallet.ProductID,
+		&i.Wallet.TenantID,
+		&i.Wallet.OwnerID,
+		&i.Wallet.IsSystem,
+		&i.Wallet.Currency,
+		&i.Wallet.Metadata,
+		&i.Wallet.Labels,
+		&i.ShardsBalance,
+		&i.ShardsVersion,
+	)
+	return i, err
+}
+
+const lockWalletShards = `-- name: LockWalletShards :one
+SELECT COALESCE(SUM(balance), 0)::bigint AS shards_balance
+FROM (
+  SELECT balance FROM wallet_shards
+  WHERE wallet_id = $1
+  ORDER BY shard_id
+  FOR UPDATE
+) locked
+`
+
+func (q *Queries) LockWalletShards(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, lockWalletShards, walletID)
+	var shards_balance int64
+	err := row.Scan(&shards_balance)
+	return shards_balance, err
+}
+
+const resetWalletShards = `-- name: ResetWalletShards :exec
+UPDATE wallet_shards
+SET balance = 0
+WHERE wallet_id = $1 AND balance <> 0
+`
+
+func (q *Queries) ResetWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, resetWalletShards, walletID)
+	return err
+}
+
+const sumWalletShards = `-- name: SumWalletShards :one
+SELECT
+  COALESCE(SUM(balance), 0)::bigint AS balance,
+  COALESCE(SUM(version), 0)::bigint AS version
+FROM wallet_shards
+WHERE wallet_id = $1
+`
+
+type SumWalletShardsRow struct {
+	Balance int64 `json:"balance"`
+	Version int64 `json:"version"`
+}
+
+func (q *Queries) SumWalletShards(ctx context.Context, walletID uuid.UUID) (SumWalletShardsRow, error) {
+	row := q.db.QueryRow(ctx, sumWalletShards, walletID)
+	var i SumWalletShardsRow
+	err := row.Scan(&i.Balance, &i.Version)
+	return i, err
+}
@@ -0,0 +1,2360 @@
+// Package repotest is a conformance suite for implementations of
+// service.WalletRepositoryInterface. The Postgres store and the in-memory
+// store must both pass it, so tests written against either can be trusted
+// for the other.
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRollback = errors.New("rollback")
+
+// Run checks repo against the behaviour of the Postgres queries. The tests
+// create their own wallets and never assume the store is empty.
+func Run(t *testing.T, repo service.WalletRepositoryInterface) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo service.WalletRepositoryInterface)
+	}{
+		{"CreateWallet", testCreateWallet},
+		{"UpdateWallet", testUpdateWallet},
+		{"SetWallet", testSetWallet},
+		{"ListWallets", testListWallets},
+		{"Operations", testOperations},
+		{"Shards", testShards},
+		{"Version", testVersion},
+		{"ScheduledOperations", testScheduledOperations},
+		{"ClaimScheduledOperation", testClaimScheduledOperation},
+		{"InterestProducts", testInterestProducts},
+		{"WalletInterest", testWalletInterest},
+		{"InterestAccruals", testInterestAccruals},
+		{"FeeSchedules", testFeeSchedules},
+		{"WalletFeeSchedule", testWalletFeeSchedule},
+		{"Imports", testImports},
+		{"ApplyImport", testApplyImport},
+		{"Audit", testAudit},
+		{"Tenants", testTenants},
+		{"WalletDetails", testWalletDetails},
+		{"SearchWallets", testSearchWallets},
+		{"Reversals", testReversals},
+		{"Journal", testJournal},
+		{"Exchange", testExchange},
+		{"ExecTx", testExecTx},
+		{"ExecSnapshot", testExecSnapshot},
+		{"ConcurrentTx", testConcurrentTx},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, repo)
+		})
+	}
+}
+
+func createWallet(t *testing.T, repo service.WalletRepositoryInterface, balance int32) repository.Wallet {
+	t.Helper()
+
+	ctx := context.Background()
+
+	wallet, err := repo.CreateWallet(ctx, repository.CreateWalletParams{})
+	require.NoError(t, err)
+
+	if balance != 0 {
+		wallet, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: balance})
+		require.NoError(t, err)
+	}
+
+	return wallet
+}
+
+func testCreateWallet(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	wallet := createWallet(t, repo, 0)
+	assert.NotEqual(t, uuid.Nil, wallet.ID)
+	assert.Zero(t, wallet.Balance)
+	assert.Equal(t, string(models.WalletStatusActive), wallet.Status)
+	assert.Zero(t, wallet.ShardCount)
+	assert.False(t, wallet.CreatedAt.IsZero())
+
+	got, err := repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID, got.ID)
+	assert.True(t, wallet.CreatedAt.Equal(got.CreatedAt))
+
+	_, err = repo.GetWalletByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	_, err = repo.GetWalletByIDForUpdate(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func testUpdateWallet(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	update := func(id uuid.UUID, amount int32) (repository.Wallet, error) {
+		return repo.UpdateWallet(ctx, repository.UpdateWalletParams{ID: id, Amount: amount})
+	}
+
+	wallet := createWallet(t, repo, 100)
+
+	updated, err := update(wallet.ID, 50)
+	require.NoError(t, err)
+	assert.Equal(t, int32(150), updated.Balance)
+
+	updated, err = update(wallet.ID, -150)
+	require.NoError(t, err)
+	assert.Zero(t, updated.Balance)
+
+	_, err = update(wallet.ID, -1)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "overdraft")
+
+	_, err = update(uuid.New(), 1)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "missing wallet")
+
+	full := createWallet(t, repo, math.MaxInt32)
+	_, err = update(full.ID, 1)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, pgx.ErrNoRows, "overflow is an error, not a mismatch")
+
+	frozen := createWallet(t, repo, 100)
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: frozen.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+	_, err = update(frozen.ID, 1)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "frozen wallet")
+
+	sharded := createWallet(t, repo, 100)
+	_, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: sharded.ID, ShardCount: 2})
+	require.NoError(t, err)
+	_, err = update(sharded.ID, 1)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "sharded wallet")
+
+	for _, id := range []uuid.UUID{wallet.ID, frozen.ID, sharded.ID} {
+		got, err := repo.GetWalletByID(ctx, id)
+		require.NoError(t, err)
+		assert.Contains(t, []int32{0, 100}, got.Balance, "rejected updates leave the balance unchanged")
+	}
+}
+
+func testSetWallet(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	updated, err := repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: 42})
+	require.NoError(t, err)
+	assert.Equal(t, int32(42), updated.Balance)
+
+	updated, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.WalletStatusFrozen), updated.Status)
+
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: "CLOSED"})
+	assert.Error(t, err, "status is constrained")
+
+	_, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: wallet.ID, ShardCount: -1})
+	assert.Error(t, err, "shard count is constrained")
+
+	_, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: uuid.New(), Balance: 1})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: uuid.New(), Status: "CLOSED"})
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "a missing row is not checked")
+	_, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: uuid.New(), ShardCount: 1})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	got, err := repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(42), got.Balance)
+	assert.Equal(t, string(models.WalletStatusFrozen), got.Status)
+	assert.Zero(t, got.ShardCount)
+}
+
+func testListWallets(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	created := make(map[uuid.UUID]bool)
+	for range 5 {
+		created[createWallet(t, repo, 0).ID] = true
+	}
+
+	var listed []uuid.UUID
+	afterID := uuid.Nil
+	for {
+		page, err := repo.ListWallets(ctx, repository.ListWalletsParams{AfterID: afterID, PageSize: 2})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 2)
+		if len(page) == 0 {
+			break
+		}
+
+		for _, w := range page {
+			listed = append(listed, w.ID)
+		}
+		afterID = page[len(page)-1].ID
+	}
+
+	assert.True(t, slices.IsSortedFunc(listed, compareUUID), "wallets are listed in ID order")
+
+	found := 0
+	for _, id := range listed {
+		if created[id] {
+			found++
+		}
+	}
+	assert.Equal(t, len(created), found)
+
+	empty, err := repo.ListWallets(ctx, repository.ListWalletsParams{AfterID: uuid.Nil, PageSize: 0})
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	_, err = repo.ListWallets(ctx, repository.ListWalletsParams{AfterID: uuid.Nil, PageSize: -1})
+	assert.Error(t, err)
+}
+
+func testOperations(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+	other := createWallet(t, repo, 0)
+
+	var amounts []int32
+	for i := range int32(3) {
+		op, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+			WalletID:      wallet.ID,
+			OperationType: string(models.OperationDeposit),
+			Amount:        i + 1,
+		})
+		require.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, op.ID)
+		assert.Equal(t, wallet.ID, op.WalletID)
+		assert.False(t, op.CreatedAt.IsZero())
+		amounts = append(amounts, op.Amount)
+	}
+
+	n, err := repo.CreateOperations(ctx, []repository.CreateOperationsParams{
+		{WalletID: wallet.ID, OperationType: string(models.OperationWithdraw), Amount: -1},
+		{WalletID: wallet.ID, OperationType: string(models.OperationWithdraw), Amount: -2},
+		{WalletID: other.ID, OperationType: string(models.OperationDeposit), Amount: 7},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	amounts = append(amounts, -1, -2)
+
+	_, err = repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      uuid.New(),
+		OperationType: string(models.OperationDeposit),
+		Amount:        1,
+	})
+	assert.Error(t, err, "operations reference wallets")
+
+	_, err = repo.CreateOperations(ctx, []repository.CreateOperationsParams{
+		{WalletID: wallet.ID, OperationType: string(models.OperationDeposit), Amount: 100},
+		{WalletID: uuid.New(), OperationType: string(models.OperationDeposit), Amount: 100},
+	})
+	assert.Error(t, err)
+
+	latest, err := repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, latest, len(amounts), "a failed batch inserts nothing")
+	assert.True(t, slices.IsSortedFunc(latest, func(a, b repository.Operation) int {
+		return compareOperations(b, a)
+	}), "history is newest first")
+
+	limited, err := repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, latest[:2], limited)
+
+	var paged []repository.Operation
+	after := repository.Operation{}
+	for {
+		page, err := repo.ListOperationsPage(ctx, repository.ListOperationsPageParams{
+			AfterCreatedAt: after.CreatedAt,
+			AfterID:        after.ID,
+			WalletID:       wallet.ID,
+			PageSize:       2,
+		})
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+
+		paged = append(paged, page...)
+		after = page[len(page)-1]
+	}
+
+	slices.Reverse(latest)
+	assert.Equal(t, latest, paged, "pages are the history in creation order")
+
+	all, err := repo.ListOperationsPage(ctx, repository.ListOperationsPageParams{
+		AfterCreatedAt: paged[0].CreatedAt.Add(-time.Microsecond),
+		PageSize:       math.MaxInt32,
+	})
+	require.NoError(t, err)
+	assert.True(t, slices.ContainsFunc(all, func(op repository.Operation) bool {
+		return op.WalletID == other.ID
+	}), "a zero wallet ID lists every wallet")
+
+	_, err = repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: -1})
+	assert.Error(t, err)
+}
+
+func testShards(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	credit := func(id uuid.UUID, shard, amount int32) int64 {
+		t.Helper()
+		n, err := repo.CreditWalletShard(ctx, repository.CreditWalletShardParams{WalletID: id, ShardID: shard, Amount: amount})
+		require.NoError(t, err)
+		return n
+	}
+	shardsBalance := func(id uuid.UUID) int64 {
+		t.Helper()
+		sum, err := repo.SumWalletShards(ctx, id)
+		require.NoError(t, err)
+		return sum.Balance
+	}
+
+	wallet := createWallet(t, repo, 0)
+
+	require.NoError(t, repo.CreateWalletShards(ctx, wallet.ID), "no shards while shard_count is 0")
+	assert.Zero(t, credit(wallet.ID, 0, 1))
+
+	_, err := repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: wallet.ID, ShardCount: 3})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateWalletShards(ctx, wallet.ID))
+	assert.Error(t, repo.CreateWalletShards(ctx, wallet.ID), "shards exist already")
+	require.NoError(t, repo.CreateWalletShards(ctx, uuid.New()))
+
+	assert.Equal(t, int64(1), credit(wallet.ID, 0, 10))
+	assert.Equal(t, int64(1), credit(wallet.ID, 2, 5))
+	assert.Zero(t, credit(wallet.ID, 3, 5), "no such shard")
+	assert.Zero(t, credit(uuid.New(), 0, 5))
+	assert.Equal(t, int64(15), shardsBalance(wallet.ID))
+
+	locked, err := repo.LockWalletShards(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), locked)
+
+	withShards, err := repo.GetWalletWithShards(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID, withShards.Wallet.ID)
+	assert.Equal(t, int64(15), withShards.ShardsBalance)
+	assert.Equal(t, int64(2), withShards.ShardsVersion)
+
+	plain, err := repo.GetWalletWithShards(ctx, createWallet(t, repo, 7).ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), plain.Wallet.Balance)
+	assert.Zero(t, plain.ShardsBalance)
+
+	_, err = repo.GetWalletWithShards(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+	assert.Zero(t, credit(wallet.ID, 1, 5), "frozen wallet")
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: string(models.WalletStatusActive)})
+	require.NoError(t, err)
+
+	_, err = repo.CreditWalletShard(ctx, repository.CreditWalletShardParams{WalletID: wallet.ID, ShardID: 0, Amount: math.MaxInt32})
+	assert.Error(t, err, "shard balance overflow")
+
+	require.NoError(t, repo.ResetWalletShards(ctx, wallet.ID))
+	assert.Zero(t, shardsBalance(wallet.ID))
+	assert.Equal(t, int64(1), credit(wallet.ID, 1, 1), "reset keeps the shards")
+
+	require.NoError(t, repo.DeleteWalletShards(ctx, wallet.ID))
+	assert.Zero(t, shardsBalance(wallet.ID))
+	assert.Zero(t, credit(wallet.ID, 1, 1))
+	require.NoError(t, repo.CreateWalletShards(ctx, wallet.ID), "shards can be recreated")
+}
+
+func testVersion(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	version := func(id uuid.UUID) (wallet, shards int64) {
+		t.Helper()
+		w, err := repo.GetWalletByID(ctx, id)
+		require.NoError(t, err)
+		sum, err := repo.SumWalletShards(ctx, id)
+		require.NoError(t, err)
+		return w.Version, sum.Version
+	}
+
+	wallet := createWallet(t, repo, 0)
+	assert.Zero(t, wallet.Version)
+
+	updated, err := repo.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), updated.Version, "returned rows carry the new version")
+
+	_, err = repo.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 0})
+	require.NoError(t, err)
+	_, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: 10})
+	require.NoError(t, err)
+	w, _ := version(wallet.ID)
+	assert.Equal(t, int64(1), w, "writes that change nothing keep the version")
+
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: wallet.ID, Status: string(models.WalletStatusActive)})
+	require.NoError(t, err)
+	_, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: wallet.ID, ShardCount: 2})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateWalletShards(ctx, wallet.ID))
+
+	w, sh := version(wallet.ID)
+	assert.Equal(t, int64(4), w)
+	assert.Zero(t, sh)
+
+	_, err = repo.CreditWalletShard(ctx, repository.CreditWalletShardParams{WalletID: wallet.ID, ShardID: 0, Amount: 5})
+	require.NoError(t, err)
+	w, sh = version(wallet.ID)
+	assert.Equal(t, int64(4), w, "shard credits leave the wallets row alone")
+	assert.Equal(t, int64(1), sh)
+
+	require.NoError(t, repo.ResetWalletShards(ctx, wallet.ID))
+	_, sh = version(wallet.ID)
+	assert.Equal(t, int64(2), sh, "only shards with a balance are reset")
+
+	require.NoError(t, repo.DeleteWalletShards(ctx, wallet.ID))
+	w, sh = version(wallet.ID)
+	assert.Equal(t, int64(6), w, "deleted shards hand their versions to the wallet")
+	assert.Zero(t, sh)
+
+	err = repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		if _, err := tx.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: 1}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	w, _ = version(wallet.ID)
+	assert.Equal(t, int64(6), w, "rolled back version")
+}
+
+func testImports(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	imp, err := repo.CreateImport(ctx, repository.CreateImportParams{SkipInvalid: true, TotalRows: 3})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusPending), imp.Status)
+	assert.True(t, imp.SkipInvalid)
+
+	walletID := uuid.New()
+	row := func(n int32, err string) repository.CreateImportRowsParams {
+		return repository.CreateImportRowsParams{
+			ImportID:      imp.ID,
+			RowNumber:     n,
+			WalletID:      walletID,
+			OperationType: string(models.OperationDeposit),
+			Amount:        n,
+			Reference:     "ref",
+			Error:         err,
+		}
+	}
+
+	n, err := repo.CreateImportRows(ctx, []repository.CreateImportRowsParams{row(2, ""), row(1, ""), row(3, "bad row")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	_, err = repo.CreateImportRows(ctx, []repository.CreateImportRowsParams{row(4, ""), row(1, "")})
+	assert.Error(t, err, "duplicate row number")
+
+	_, err = repo.CreateImportRows(ctx, []repository.CreateImportRowsParams{{ImportID: uuid.New(), RowNumber: 1}})
+	assert.Error(t, err, "unknown import")
+
+	rows, err := repo.ListImportRows(ctx, repository.ListImportRowsParams{ImportID: imp.ID, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, int32(1), rows[0].RowNumber)
+	assert.Equal(t, walletID, rows[0].WalletID)
+	assert.Equal(t, "ref", rows[0].Reference)
+
+	rows, err = repo.ListImportRows(ctx, repository.ListImportRowsParams{ImportID: imp.ID, AfterRow: 2, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rows, 1, "the failed COPY added nothing")
+	assert.Equal(t, int32(3), rows[0].RowNumber)
+
+	require.NoError(t, repo.SetImportRowError(ctx, repository.SetImportRowErrorParams{ImportID: imp.ID, RowNumber: 1, Error: "wallet not found"}))
+
+	failed, err := repo.ListImportErrors(ctx, imp.ID)
+	require.NoError(t, err)
+	require.Len(t, failed, 2)
+	assert.Equal(t, "wallet not found", failed[0].Error)
+	assert.Equal(t, "bad row", failed[1].Error)
+
+	finished, err := repo.FinishImport(ctx, repository.FinishImportParams{
+		ID:          imp.ID,
+		Status:      string(models.ImportStatusApplied),
+		AppliedRows: 1,
+		FailedRows:  2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), finished.AppliedRows)
+
+	_, err = repo.FinishImport(ctx, repository.FinishImportParams{ID: imp.ID, Status: "DONE"})
+	assert.Error(t, err)
+
+	got, err := repo.GetImport(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusApplied), got.Status)
+	assert.Equal(t, int32(2), got.FailedRows)
+
+	_, err = repo.GetImport(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	_, err = repo.FinishImport(ctx, repository.FinishImportParams{ID: uuid.New(), Status: string(models.ImportStatusApplied)})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func testApplyImport(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	hash := uuid.NewString()
+	imp, err := repo.CreateImport(ctx, repository.CreateImportParams{TotalRows: 8, FileHash: hash})
+	require.NoError(t, err)
+	assert.Equal(t, hash, imp.FileHash)
+
+	_, err = repo.CreateImport(ctx, repository.CreateImportParams{FileHash: hash})
+	assert.Error(t, err, "the file is pending")
+
+	got, err := repo.GetImportByFileHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, imp.ID, got.ID)
+
+	_, err = repo.GetImportByFileHash(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	plain := createWallet(t, repo, 10)
+	other := createWallet(t, repo, 0)
+	frozen := createWallet(t, repo, 0)
+	_, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: frozen.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+	sharded := createWallet(t, repo, 0)
+	_, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{ID: sharded.ID, ShardCount: 2})
+	require.NoError(t, err)
+
+	row := func(n int32, walletID uuid.UUID, opType models.OperationType, amount int32) repository.CreateImportRowsParams {
+		return repository.CreateImportRowsParams{
+			ImportID:      imp.ID,
+			RowNumber:     n,
+			WalletID:      walletID,
+			OperationType: string(opType),
+			Amount:        amount,
+			Reference:     fmt.Sprintf("r%d", n),
+		}
+	}
+	_, err = repo.CreateImportRows(ctx, []repository.CreateImportRowsParams{
+		row(1, plain.ID, models.OperationWithdraw, 15),
+		row(2, plain.ID, models.OperationDeposit, 5),
+		row(3, plain.ID, models.OperationWithdraw, 16),
+		row(4, plain.ID, models.OperationWithdraw, 1),
+		row(5, other.ID, models.OperationAdjustment, math.MaxInt32),
+		row(6, other.ID, models.OperationDeposit, 1),
+		row(7, frozen.ID, models.OperationDeposit, 1),
+		row(8, uuid.New(), models.OperationDeposit, 1),
+		row(9, sharded.ID, models.OperationDeposit, 1),
+	})
+	require.NoError(t, err)
+
+	claimed, err := repo.ClaimImport(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, imp.ID, claimed.ID)
+
+	pendingIDs := func(before time.Time) []uuid.UUID {
+		pending, err := repo.ListPendingImports(ctx, repository.ListPendingImportsParams{Before: before, PageSize: 1000})
+		require.NoError(t, err)
+		var ids []uuid.UUID
+		for _, p := range pending {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	assert.Contains(t, pendingIDs(imp.UpdatedAt.Add(time.Second)), imp.ID)
+	assert.NotContains(t, pendingIDs(imp.UpdatedAt), imp.ID)
+
+	locked, err := repo.LockImportWallets(ctx, imp.ID)
+	require.NoError(t, err)
+	want := []uuid.UUID{plain.ID, other.ID, frozen.ID, sharded.ID}
+	slices.SortFunc(want, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	assert.Equal(t, want, locked)
+
+	marked, err := repo.CheckImportRows(ctx, repository.CheckImportRowsParams{ImportID: imp.ID, WalletNotFound: "missing", WalletFrozen: "frozen"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), marked)
+
+	balances, err := repo.ListImportRowBalances(ctx, imp.ID)
+	require.NoError(t, err)
+	var rowNumbers []int32
+	for _, r := range balances {
+		rowNumbers = append(rowNumbers, r.RowNumber)
+		switch r.WalletID {
+		case plain.ID:
+			assert.Equal(t, int32(10), r.Balance)
+		case other.ID:
+			assert.Zero(t, r.Balance)
+		default:
+			t.Errorf("row %d of wallet %s is not valid or is sharded", r.RowNumber, r.WalletID)
+		}
+	}
+	assert.ElementsMatch(t, []int32{1, 2, 3, 4, 5, 6}, rowNumbers)
+	assert.True(t, slices.IsSortedFunc(balances, func(a, b repository.ListImportRowBalancesRow) int {
+		if c := bytes.Compare(a.WalletID[:], b.WalletID[:]); c != 0 {
+			return c
+		}
+		return int(a.RowNumber - b.RowNumber)
+	}), "rows are ordered by wallet, then by row")
+
+	// Row 1 overdraws 10; without it, row 3 overdraws 15. Row 6 overflows.
+	require.NoError(t, repo.SetImportRowErrors(ctx, repository.SetImportRowErrorsParams{
+		ImportID:   imp.ID,
+		RowNumbers: []int32{1, 3, 6},
+		Errors:     []string{"funds", "funds", "overflow"},
+	}))
+
+	failed, err := repo.ListImportErrors(ctx, imp.ID)
+	require.NoError(t, err)
+	errs := make(map[int32]string)
+	for _, r := range failed {
+		errs[r.RowNumber] = r.Error
+	}
+	assert.Equal(t, map[int32]string{1: "funds", 3: "funds", 6: "overflow", 7: "frozen", 8: "missing"}, errs)
+
+	shardedRows, err := repo.ListShardedImportRows(ctx, imp.ID)
+	require.NoError(t, err)
+	require.Len(t, shardedRows, 1)
+	assert.Equal(t, int32(9), shardedRows[0].RowNumber)
+
+	applied, err := repo.ApplyImportRows(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), applied, "rows 2, 4 and 5")
+
+	w, err := repo.GetWalletByID(ctx, plain.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(14), w.Balance)
+	w, err = repo.GetWalletByID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(math.MaxInt32), w.Balance)
+	w, err = repo.GetWalletByID(ctx, sharded.ID)
+	require.NoError(t, err)
+	assert.Zero(t, w.Balance, "sharded rows are applied one by one")
+
+	ops, err := repo.ListOperationsPage(ctx, repository.ListOperationsPageParams{WalletID: plain.ID, PageSize: 10})
+	require.NoError(t, err)
+	var references []string
+	for _, op := range ops {
+		assert.Equal(t, imp.ID, op.ImportID)
+		references = append(references, op.Reference)
+	}
+	assert.ElementsMatch(t, []string{"r2", "r4"}, references)
+
+	mismatches, err := repo.ListWalletJournalMismatches(ctx, 1000)
+	require.NoError(t, err)
+	for _, m := range mismatches {
+		assert.NotEqual(t, other.ID, m.ID, "the import is booked")
+	}
+
+	_, err = repo.FinishImport(ctx, repository.FinishImportParams{ID: imp.ID, Status: string(models.ImportStatusApplied), AppliedRows: applied})
+	require.NoError(t, err)
+
+	_, err = repo.ClaimImport(ctx, imp.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "only a pending import is claimed")
+
+	_, err = repo.CreateImport(ctx, repository.CreateImportParams{FileHash: hash})
+	assert.Error(t, err, "the file is applied")
+
+	rejected, err := repo.CreateImport(ctx, repository.CreateImportParams{FileHash: uuid.NewString()})
+	require.NoError(t, err)
+	_, err = repo.FinishImport(ctx, repository.FinishImportParams{ID: rejected.ID, Status: string(models.ImportStatusRejected)})
+	require.NoError(t, err)
+	_, err = repo.CreateImport(ctx, repository.CreateImportParams{FileHash: rejected.FileHash})
+	assert.NoError(t, err, "a rejected file may be imported again")
+
+	_, err = repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      plain.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        1,
+		ImportID:      uuid.New(),
+	})
+	assert.Error(t, err, "unknown import")
+}
+
+func testAudit(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	// A unique actor keeps entries of other tests out of the results.
+	actor := "repotest-" + uuid.NewString()
+	walletID := uuid.New()
+	start := time.Now().Add(-time.Minute)
+
+	entry := func(walletID uuid.UUID) repository.CreateAuditEntryParams {
+		return repository.CreateAuditEntryParams{
+			Actor:     actor,
+			Action:    string(models.AuditActionBalanceChange),
+			WalletID:  walletID,
+			Before:    []byte(`{"balance": 1}`),
+			After:     []byte(`{"balance": 2}`),
+			RequestID: "req-1",
+			SourceIp:  "10.0.0.1",
+		}
+	}
+
+	first, err := repo.CreateAuditEntry(ctx, entry(walletID))
+	require.NoError(t, err)
+	assert.Equal(t, actor, first.Actor)
+	assert.JSONEq(t, `{"balance": 2}`, string(first.After))
+	assert.Equal(t, "10.0.0.1", first.SourceIp)
+
+	var second repository.AuditLog
+	err = repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		var err error
+		second, err = tx.CreateAuditEntry(ctx, entry(uuid.New()))
+		return err
+	})
+	require.NoError(t, err)
+
+	err = repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		if _, err := tx.CreateAuditEntry(ctx, entry(walletID)); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	list := func(arg repository.ListAuditEntriesParams) []repository.AuditLog {
+		t.Helper()
+
+		if arg.ToTime.IsZero() {
+			arg.ToTime = time.Now().Add(time.Minute)
+		}
+		arg.FromTime = start
+		arg.PageSize = 10
+
+		entries, err := repo.ListAuditEntries(ctx, arg)
+		require.NoError(t, err)
+		return entries
+	}
+
+	ids := func(entries []repository.AuditLog) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uuid.UUID{first.ID, second.ID}, ids(list(repository.ListAuditEntriesParams{Actor: actor})),
+		"the rolled back entry is gone")
+	assert.Equal(t, []uuid.UUID{first.ID}, ids(list(repository.ListAuditEntriesParams{Actor: actor, WalletID: walletID})))
+	assert.Equal(t, []uuid.UUID{second.ID}, ids(list(repository.ListAuditEntriesParams{Actor: actor, AfterID: first.ID})))
+	assert.Empty(t, list(repository.ListAuditEntriesParams{Actor: actor, ToTime: start.Add(time.Second)}))
+	assert.Empty(t, list(repository.ListAuditEntriesParams{Actor: "repotest-" + uuid.NewString()}))
+
+	_, err = repo.ListAuditEntries(ctx, repository.ListAuditEntriesParams{Actor: actor, ToTime: time.Now(), PageSize: -1})
+	assert.Error(t, err)
+}
+
+func testTenants(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	// Unique names keep reruns against the same database apart.
+	suffix := uuid.NewString()
+	acme, err := repo.CreateTenant(ctx, "acme-"+suffix)
+	require.NoError(t, err)
+	globex, err := repo.CreateTenant(ctx, "globex-"+suffix)
+	require.NoError(t, err)
+
+	_, err = repo.CreateTenant(ctx, "acme-"+suffix)
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "tenants_name_key", pgErr.ConstraintName)
+
+	tenants, err := repo.ListTenants(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, tenant := range tenants {
+		names = append(names, tenant.Name)
+	}
+	assert.Contains(t, names, "default")
+	assert.Less(t, slices.Index(names, acme.Name), slices.Index(names, globex.Name))
+
+	hash := pgtype.Text{String: "hash-" + suffix, Valid: true}
+	_, err = repo.GetTenantByKeyHash(ctx, hash)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	keyed, err := repo.SetTenantKeyHash(ctx, repository.SetTenantKeyHashParams{ID: acme.ID, ApiKeyHash: hash})
+	require.NoError(t, err)
+	assert.Equal(t, hash, keyed.ApiKeyHash)
+	found, err := repo.GetTenantByKeyHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, found.ID)
+	_, err = repo.SetTenantKeyHash(ctx, repository.SetTenantKeyHashParams{ID: globex.ID, ApiKeyHash: hash})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "tenants_api_key_hash_key", pgErr.ConstraintName)
+	_, err = repo.SetTenantKeyHash(ctx, repository.SetTenantKeyHashParams{ID: uuid.New(), ApiKeyHash: hash})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.GetTenantByKeyHash(ctx, pgtype.Text{})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	acmeCtx := service.WithTenant(ctx, acme.ID)
+	globexCtx := service.WithTenant(ctx, globex.ID)
+
+	wallet, err := repo.CreateWallet(acmeCtx, repository.CreateWalletParams{})
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, wallet.TenantID)
+	assert.Equal(t, service.DefaultTenantID, createWallet(t, repo, 0).TenantID)
+
+	_, err = repo.CreateOperation(acmeCtx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        10,
+	})
+	require.NoError(t, err)
+
+	_, err = repo.GetWalletByID(acmeCtx, wallet.ID)
+	assert.NoError(t, err)
+	_, err = repo.GetWalletByID(ctx, wallet.ID)
+	assert.NoError(t, err, "without a tenant every wallet is visible")
+
+	_, err = repo.GetWalletByID(globexCtx, wallet.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.UpdateWallet(globexCtx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 1})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	ops, err := repo.ListWalletOperations(globexCtx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+	ops, err = repo.ListWalletOperations(acmeCtx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, ops, 1)
+
+	_, err = repo.CreateOperation(globexCtx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        10,
+	})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "42501", pgErr.Code)
+
+	err = repo.ExecTx(globexCtx, func(tx service.WalletRepositoryInterface) error {
+		// A statement may lift the isolation of its transaction.
+		if _, err := tx.GetWalletByID(ctx, wallet.ID); err != nil {
+			return err
+		}
+		_, err := tx.GetWalletByID(globexCtx, wallet.ID)
+		return err
+	})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	ownerID := uuid.New()
+	owned, err := repo.SetWalletOwner(acmeCtx, repository.SetWalletOwnerParams{ID: wallet.ID, OwnerID: ownerID})
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, owned.OwnerID)
+
+	_, err = repo.SetWalletOwner(globexCtx, repository.SetWalletOwnerParams{ID: wallet.ID, OwnerID: uuid.New()})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	other, err := repo.CreateWallet(globexCtx, repository.CreateWalletParams{})
+	require.NoError(t, err)
+	_, err = repo.SetWalletOwner(globexCtx, repository.SetWalletOwnerParams{ID: other.ID, OwnerID: ownerID})
+	require.NoError(t, err)
+
+	list := func(ctx context.Context) []uuid.UUID {
+		t.Helper()
+
+		wallets, err := repo.ListOwnerWallets(ctx, repository.ListOwnerWalletsParams{OwnerID: ownerID, PageSize: 10})
+		require.NoError(t, err)
+
+		var ids []uuid.UUID
+		for _, w := range wallets {
+			ids = append(ids, w.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uuid.UUID{wallet.ID}, list(acmeCtx))
+	assert.Equal(t, []uuid.UUID{other.ID}, list(globexCtx))
+	assert.Len(t, list(ctx), 2)
+
+	owned, err = repo.SetWalletOwner(acmeCtx, repository.SetWalletOwnerParams{ID: wallet.ID})
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, owned.OwnerID)
+	assert.Empty(t, list(acmeCtx))
+
+	system, err := repo.MarkSystemWallet(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.True(t, system.IsSystem)
+
+	_, err = repo.GetWalletByID(acmeCtx, wallet.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "no tenant sees a system wallet")
+	_, err = repo.UpdateWallet(acmeCtx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 1})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	ops, err = repo.ListWalletOperations(acmeCtx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+	_, err = repo.GetWalletByID(ctx, wallet.ID)
+	assert.NoError(t, err)
+
+	_, err = repo.MarkSystemWallet(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	fileHash := "file-" + suffix
+	imp, err := repo.CreateImport(acmeCtx, repository.CreateImportParams{TotalRows: 1, FileHash: fileHash})
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, imp.TenantID)
+	_, err = repo.CreateImportRows(acmeCtx, []repository.CreateImportRowsParams{
+		{ImportID: imp.ID, RowNumber: 1, WalletID: wallet.ID, OperationType: string(models.OperationDeposit), Amount: 1},
+	})
+	require.NoError(t, err, "rows are staged with COPY for a tenant")
+
+	_, err = repo.GetImport(globexCtx, imp.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.ClaimImport(globexCtx, imp.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	_, err = repo.GetImportByFileHash(globexCtx, fileHash)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.CreateImport(globexCtx, repository.CreateImportParams{TotalRows: 1, FileHash: fileHash})
+	assert.NoError(t, err, "each tenant may import the same file")
+	_, err = repo.CreateImport(acmeCtx, repository.CreateImportParams{TotalRows: 1, FileHash: fileHash})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "imports_file_hash_key", pgErr.ConstraintName)
+
+	got, err := repo.GetImportByFileHash(acmeCtx, fileHash)
+	require.NoError(t, err)
+	assert.Equal(t, imp.ID, got.ID)
+	_, err = repo.GetImport(ctx, imp.ID)
+	assert.NoError(t, err)
+}
+
+func testWalletDetails(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	wallet := createWallet(t, repo, 0)
+	assert.Equal(t, "XXX", wallet.Currency)
+	assert.JSONEq(t, `{}`, string(wallet.Metadata))
+	assert.JSONEq(t, `{}`, string(wallet.Labels))
+
+	wallet, err := repo.CreateWallet(ctx, repository.CreateWalletParams{
+		Currency: "EUR",
+		Metadata: []byte(`{"note": "savings", "limits": [1, 2]}`),
+		Labels:   []byte(`{"env": "prod"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", wallet.Currency)
+	assert.JSONEq(t, `{"note": "savings", "limits": [1, 2]}`, string(wallet.Metadata))
+	assert.JSONEq(t, `{"env": "prod"}`, string(wallet.Labels))
+
+	wallet, err = repo.SetWalletDetails(ctx, repository.SetWalletDetailsParams{ID: wallet.ID, Labels: []byte(`{"tier": "gold"}`)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"note": "savings", "limits": [1, 2]}`, string(wallet.Metadata), "metadata is left as it is")
+	assert.JSONEq(t, `{"tier": "gold"}`, string(wallet.Labels))
+
+	_, err = repo.SetWalletDetails(ctx, repository.SetWalletDetailsParams{ID: uuid.New(), Metadata: []byte(`{}`)})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for constraint, arg := range map[string]repository.CreateWalletParams{
+		"wallets_currency_check": {Currency: "euro"},
+		"wallets_metadata_check": {Metadata: []byte(`[1]`)},
+		"wallets_labels_check":   {Labels: []byte(`{"env": 1}`)},
+	} {
+		_, err := repo.CreateWallet(ctx, arg)
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr, constraint)
+		assert.Equal(t, constraint, pgErr.ConstraintName)
+	}
+
+	_, err = repo.SetWalletDetails(ctx, repository.SetWalletDetailsParams{ID: wallet.ID, Metadata: []byte(`"note"`)})
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "wallets_metadata_check", pgErr.ConstraintName)
+}
+
+func testSearchWallets(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+
+	// A label of its own keeps wallets of other tests out of the results.
+	run := "repotest-" + uuid.NewString()
+
+	create := func(balance int32, labels map[string]string) repository.Wallet {
+		t.Helper()
+
+		labels[run] = ""
+		encoded, err := json.Marshal(labels)
+		require.NoError(t, err)
+
+		wallet, err := repo.CreateWallet(ctx, repository.CreateWalletParams{Currency: "XTS", Labels: encoded})
+		require.NoError(t, err)
+
+		wallet, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: balance})
+		require.NoError(t, err)
+		return wallet
+	}
+
+	gold := create(300, map[string]string{"env": "prod", "tier": "gold"})
+	silver := create(100, map[string]string{"env": "prod", "tier": "silver", "vip": ""})
+	test := create(200, map[string]string{"env": "test"})
+	frozen := create(100, map[string]string{"env": "prod"})
+	_, err := repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{ID: frozen.ID, Status: string(models.WalletStatusFrozen)})
+	require.NoError(t, err)
+
+	search := func(arg service.SearchWalletsParams) []uuid.UUID {
+		t.Helper()
+
+		arg.Currency = "XTS"
+		arg.LabelsHas = append(arg.LabelsHas, run)
+		if arg.MinBalance == 0 && arg.MaxBalance == 0 {
+			arg.MinBalance, arg.MaxBalance = math.MinInt32, math.MaxInt32
+		}
+		if arg.CreatedFrom.IsZero() {
+			arg.CreatedFrom = start
+		}
+		if arg.CreatedTo.IsZero() {
+			arg.CreatedTo = time.Now().Add(time.Minute)
+		}
+		if arg.SortBy == "" {
+			arg.SortBy = service.SortByBalance
+		}
+		if arg.PageSize == 0 {
+			arg.PageSize = 10
+		}
+
+		wallets, err := repo.SearchWallets(ctx, arg)
+		require.NoError(t, err)
+
+		var ids []uuid.UUID
+		for _, w := range wallets {
+			ids = append(ids, w.ID)
+		}
+		return ids
+	}
+
+	// Equal balances are ordered by ID.
+	low := []uuid.UUID{silver.ID, frozen.ID}
+	if compareUUID(frozen.ID, silver.ID) < 0 {
+		low = []uuid.UUID{frozen.ID, silver.ID}
+	}
+
+	assert.Equal(t, append(slices.Clone(low), test.ID, gold.ID), search(service.SearchWalletsParams{}))
+	assert.Equal(t, []uuid.UUID{gold.ID, test.ID, low[1], low[0]}, search(service.SearchWalletsParams{Descending: true}))
+
+	assert.Equal(t, []uuid.UUID{test.ID, gold.ID}, search(service.SearchWalletsParams{AfterID: low[1]}))
+	assert.Equal(t, []uuid.UUID{low[1], low[0]}, search(service.SearchWalletsParams{Descending: true, AfterID: test.ID}))
+	assert.Equal(t, []uuid.UUID{low[0]}, search(service.SearchWalletsParams{PageSize: 1}))
+
+	assert.Equal(t, []uuid.UUID{frozen.ID}, search(service.SearchWalletsParams{Status: string(models.WalletStatusFrozen)}))
+	assert.Equal(t, []uuid.UUID{test.ID, gold.ID}, search(service.SearchWalletsParams{MinBalance: 150, MaxBalance: 300}))
+	assert.Empty(t, search(service.SearchWalletsParams{CreatedFrom: time.Now().Add(time.Minute), CreatedTo: time.Now().Add(2 * time.Minute)}))
+
+	assert.Equal(t, []uuid.UUID{silver.ID, gold.ID}, search(service.SearchWalletsParams{
+		LabelsMatch: []byte(`{"env": "prod"}`),
+		LabelsHas:   []string{"tier"},
+	}))
+	assert.Equal(t, []uuid.UUID{gold.ID}, search(service.SearchWalletsParams{
+		LabelsMatch:   []byte(`{"env": "prod"}`),
+		LabelsMissing: []string{"vip"},
+		LabelsNot:     []byte(`{"tier": "bronze"}`),
+		MinBalance:    101,
+		MaxBalance:    math.MaxInt32,
+	}))
+	assert.Equal(t, []uuid.UUID{test.ID}, search(service.SearchWalletsParams{LabelsNot: []byte(`{"env": "prod", "tier": "silver"}`)}),
+		"a wallet with any of the labels is left out")
+
+	byCreation := search(service.SearchWalletsParams{SortBy: service.SortByCreatedAt})
+	require.Len(t, byCreation, 4)
+	assert.Equal(t, byCreation[1:], search(service.SearchWalletsParams{SortBy: service.SortByCreatedAt, AfterID: byCreation[0]}))
+
+	byID := search(service.SearchWalletsParams{SortBy: service.SortByID})
+	require.Len(t, byID, 4)
+	assert.True(t, slices.IsSortedFunc(byID, compareUUID))
+	assert.Equal(t, []uuid.UUID{byID[2], byID[1], byID[0]}, search(service.SearchWalletsParams{SortBy: service.SortByID, Descending: true, AfterID: byID[3]}))
+}
+
+func testReversals(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	deposit, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        100,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, deposit.ReversalOf)
+	assert.Zero(t, deposit.ReversedAmount)
+
+	got, err := repo.GetOperation(ctx, deposit.ID)
+	require.NoError(t, err)
+	assert.Equal(t, deposit, got)
+
+	_, err = repo.GetOperation(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	reversed, err := repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: deposit.ID, Amount: 30})
+	require.NoError(t, err)
+	assert.Equal(t, int32(30), reversed.ReversedAmount)
+	assert.Equal(t, int32(100), reversed.Amount)
+
+	_, err = repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: deposit.ID, Amount: 71})
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "an operation is not reversed by more than its amount")
+
+	reversed, err = repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: deposit.ID, Amount: 70})
+	require.NoError(t, err)
+	assert.Equal(t, int32(100), reversed.ReversedAmount)
+
+	_, err = repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: uuid.New(), Amount: 1})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	withdrawal, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationWithdraw),
+		Amount:        -40,
+	})
+	require.NoError(t, err)
+
+	var pgErr *pgconn.PgError
+	_, err = repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: withdrawal.ID, Amount: -1})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "operations_reversed_amount_check", pgErr.ConstraintName)
+
+	reversed, err = repo.ReverseOperation(ctx, repository.ReverseOperationParams{ID: withdrawal.ID, Amount: 40})
+	require.NoError(t, err)
+	assert.Equal(t, int32(40), reversed.ReversedAmount)
+
+	reversal, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationReversal),
+		Amount:        40,
+		ReversalOf:    withdrawal.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, withdrawal.ID, reversal.ReversalOf)
+
+	_, err = repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationReversal),
+		Amount:        1,
+		ReversalOf:    uuid.New(),
+	})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "operations_reversal_of_fkey", pgErr.ConstraintName)
+
+	target := createWallet(t, repo, 0)
+	debit, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationTransfer),
+		Amount:        -10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, debit.CounterpartID)
+	credit, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      target.ID,
+		OperationType: string(models.OperationTransfer),
+		Amount:        10,
+		CounterpartID: debit.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, debit.ID, credit.CounterpartID)
+	require.NoError(t, repo.SetOperationCounterpart(ctx, repository.SetOperationCounterpartParams{ID: debit.ID, CounterpartID: credit.ID}))
+	got, err = repo.GetOperation(ctx, debit.ID)
+	require.NoError(t, err)
+	assert.Equal(t, credit.ID, got.CounterpartID)
+
+	_, err = repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      target.ID,
+		OperationType: string(models.OperationTransfer),
+		Amount:        1,
+		CounterpartID: uuid.New(),
+	})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "operations_counterpart_id_fkey", pgErr.ConstraintName)
+
+	ops, err := repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+	assert.Contains(t, ops, reversal)
+	assert.Contains(t, ops, reversed, "history shows what was reversed")
+	assert.Contains(t, ops, got, "history shows what a transfer leg is linked to")
+
+	tenant, err := repo.CreateTenant(ctx, "reversals-"+uuid.NewString())
+	require.NoError(t, err)
+	tenantCtx := service.WithTenant(ctx, tenant.ID)
+
+	_, err = repo.GetOperation(tenantCtx, deposit.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.ReverseOperation(tenantCtx, repository.ReverseOperationParams{ID: withdrawal.ID})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func testJournal(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	totals := func() map[string][2]int64 {
+		rows, err := repo.GetTrialBalance(ctx)
+		require.NoError(t, err)
+
+		totals := make(map[string][2]int64)
+		for _, row := range rows {
+			totals[row.Currency+" "+row.Account] = [2]int64{row.Debit, row.Credit}
+		}
+		return totals
+	}
+	before := totals()
+
+	entry, err := repo.CreateJournalEntry(ctx, repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "cash_in"},
+		WalletIds:   []uuid.UUID{wallet.ID, uuid.Nil},
+		Debits:      []int32{0, 100},
+		Credits:     []int32{100, 0},
+		Description: "DEPOSIT",
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, entry.ID)
+	assert.Equal(t, "DEPOSIT", entry.Description)
+
+	legs, err := repo.ListJournalLegs(ctx, entry.ID)
+	require.NoError(t, err)
+	require.Len(t, legs, 2)
+	assert.Equal(t, repository.JournalLeg{EntryID: entry.ID, Leg: 1, Account: "wallet", WalletID: wallet.ID, Credit: 100, Currency: "XXX"}, legs[0],
+		"a wallet leg is in the currency of the wallet")
+	assert.Equal(t, repository.JournalLeg{EntryID: entry.ID, Leg: 2, Account: "cash_in", Debit: 100, Currency: "XXX"}, legs[1],
+		"a system leg is in the currency of the wallets of the entry")
+
+	after := totals()
+	assert.Equal(t, int64(100), after["XXX wallet"][1]-before["XXX wallet"][1])
+	assert.Equal(t, int64(100), after["XXX cash_in"][0]-before["XXX cash_in"][0])
+
+	mismatches, err := repo.ListWalletJournalMismatches(ctx, math.MaxInt32)
+	require.NoError(t, err)
+	assert.Contains(t, mismatches, repository.ListWalletJournalMismatchesRow{ID: wallet.ID, Balance: 0, JournalBalance: 100},
+		"the wallet was credited in the journal only")
+
+	_, err = repo.CreateJournalEntry(ctx, repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "interest"},
+		WalletIds:   []uuid.UUID{wallet.ID, uuid.Nil},
+		Debits:      []int32{100, 0},
+		Credits:     []int32{0, 100},
+		Description: "INTEREST",
+	})
+	require.NoError(t, err)
+	mismatches, err = repo.ListWalletJournalMismatches(ctx, math.MaxInt32)
+	require.NoError(t, err)
+	for _, m := range mismatches {
+		assert.NotEqual(t, wallet.ID, m.ID, "the wallet's legs add up to its balance again")
+	}
+
+	euro, err := repo.CreateWallet(ctx, repository.CreateWalletParams{Currency: "EUR"})
+	require.NoError(t, err)
+	conversion := repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "exchange", "exchange", "wallet"},
+		WalletIds:   []uuid.UUID{wallet.ID, uuid.Nil, uuid.Nil, euro.ID},
+		Debits:      []int32{10, 0, 9, 0},
+		Credits:     []int32{0, 10, 0, 9},
+		Currencies:  []string{"", "XXX", "EUR", ""},
+		Description: "EXCHANGE",
+	}
+	entry, err = repo.CreateJournalEntry(ctx, conversion)
+	require.NoError(t, err, "an entry balances in each currency")
+	legs, err = repo.ListJournalLegs(ctx, entry.ID)
+	require.NoError(t, err)
+	require.Len(t, legs, 4)
+	assert.Equal(t, "XXX", legs[0].Currency)
+	assert.Equal(t, "EUR", legs[3].Currency)
+
+	conversion.Currencies = []string{"", "XXX", "XXX", ""}
+	_, err = repo.CreateJournalEntry(ctx, conversion)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "debits and credits balance, but not per currency")
+
+	conversion.Currencies = nil
+	_, err = repo.CreateJournalEntry(ctx, conversion)
+	assert.Error(t, err, "the system legs of an entry between currencies need a currency")
+
+	// Put the wallets back where they were for the totals below.
+	_, err = repo.CreateJournalEntry(ctx, repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "exchange", "exchange", "wallet"},
+		WalletIds:   []uuid.UUID{wallet.ID, uuid.Nil, uuid.Nil, euro.ID},
+		Debits:      []int32{0, 10, 0, 9},
+		Credits:     []int32{10, 0, 9, 0},
+		Currencies:  []string{"", "XXX", "EUR", ""},
+		Description: "EXCHANGE",
+	})
+	require.NoError(t, err)
+	after = totals()
+
+	_, err = repo.CreateJournalEntry(ctx, repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "cash_out"},
+		WalletIds:   []uuid.UUID{wallet.ID, uuid.Nil},
+		Debits:      []int32{50, 0},
+		Credits:     []int32{0, 40},
+		Description: "WITHDRAW",
+	})
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "an entry that does not balance is not written")
+
+	_, err = repo.CreateJournalEntry(ctx, repository.CreateJournalEntryParams{Description: "EMPTY"})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for constraint, arg := range map[string]repository.CreateJournalEntryParams{
+		"journal_legs_account_check": {
+			Accounts:  []string{"wallet", "bank"},
+			WalletIds: []uuid.UUID{wallet.ID, uuid.Nil},
+			Debits:    []int32{10, 0},
+			Credits:   []int32{0, 10},
+		},
+		"journal_legs_wallet_check": {
+			Accounts:   []string{"wallet", "cash_in"},
+			WalletIds:  []uuid.UUID{uuid.Nil, uuid.Nil},
+			Debits:     []int32{0, 10},
+			Credits:    []int32{10, 0},
+			Currencies: []string{"XXX", "XXX"},
+		},
+		"journal_legs_currency_check": {
+			Accounts:   []string{"wallet", "cash_in"},
+			WalletIds:  []uuid.UUID{wallet.ID, uuid.Nil},
+			Debits:     []int32{0, 10},
+			Credits:    []int32{10, 0},
+			Currencies: []string{"usd", "usd"},
+		},
+		"journal_legs_amount_check": {
+			Accounts:  []string{"wallet", "cash_in"},
+			WalletIds: []uuid.UUID{wallet.ID, uuid.Nil},
+			Debits:    []int32{10, 10},
+			Credits:   []int32{10, 10},
+		},
+		"journal_legs_wallet_id_fkey": {
+			Accounts:   []string{"wallet", "cash_in"},
+			WalletIds:  []uuid.UUID{uuid.New(), uuid.Nil},
+			Debits:     []int32{0, 10},
+			Credits:    []int32{10, 0},
+			Currencies: []string{"XXX", "XXX"},
+		},
+	} {
+		_, err := repo.CreateJournalEntry(ctx, arg)
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr, constraint)
+		assert.Equal(t, constraint, pgErr.ConstraintName)
+	}
+
+	assert.Equal(t, after, totals(), "failed entries leave nothing behind")
+
+	legs, err = repo.ListJournalLegs(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, legs)
+}
+
+func testExchange(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	// Rates are shared by every run against the database, so this one picks
+	// an instant nobody else has used.
+	base := "XTS"
+	day := time.Unix(rand.Int64N(1<<32), 0).UTC()
+
+	older, err := repo.CreateExchangeRate(ctx, repository.CreateExchangeRateParams{
+		BaseCurrency: base, QuoteCurrency: "EUR", RateMicros: 900000, EffectiveFrom: day, Source: "test",
+	})
+	require.NoError(t, err)
+	newer, err := repo.CreateExchangeRate(ctx, repository.CreateExchangeRateParams{
+		BaseCurrency: base, QuoteCurrency: "EUR", RateMicros: 950000, EffectiveFrom: day.Add(time.Hour), Source: "test",
+	})
+	require.NoError(t, err)
+
+	_, err = repo.CreateExchangeRate(ctx, repository.CreateExchangeRateParams{
+		BaseCurrency: base, QuoteCurrency: "EUR", RateMicros: 1, EffectiveFrom: day, Source: "test",
+	})
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "exchange_rates_pair_key", pgErr.ConstraintName)
+
+	for constraint, arg := range map[string]repository.CreateExchangeRateParams{
+		"exchange_rates_base_currency_check":  {BaseCurrency: "XXX", QuoteCurrency: "EUR", RateMicros: 1, Source: "test"},
+		"exchange_rates_quote_currency_check": {BaseCurrency: base, QuoteCurrency: "eur", RateMicros: 1, Source: "test"},
+		"exchange_rates_rate_micros_check":    {BaseCurrency: base, QuoteCurrency: "EUR", Source: "test"},
+		"exchange_rates_source_check":         {BaseCurrency: base, QuoteCurrency: "EUR", RateMicros: 1},
+		"exchange_rates_pair_check":           {BaseCurrency: base, QuoteCurrency: base, RateMicros: 1, Source: "test"},
+	} {
+		_, err := repo.CreateExchangeRate(ctx, arg)
+		require.ErrorAs(t, err, &pgErr, constraint)
+		assert.Equal(t, constraint, pgErr.ConstraintName)
+	}
+
+	rates, err := repo.ListExchangeRates(ctx, repository.ListExchangeRatesParams{BaseCurrency: base, QuoteCurrency: "EUR", Limit: 10000})
+	require.NoError(t, err)
+	newerAt := slices.IndexFunc(rates, func(r repository.ExchangeRate) bool { return r.ID == newer.ID })
+	olderAt := slices.IndexFunc(rates, func(r repository.ExchangeRate) bool { return r.ID == older.ID })
+	require.GreaterOrEqual(t, newerAt, 0)
+	assert.Greater(t, olderAt, newerAt, "newer rates come first")
+	for _, r := range rates {
+		assert.Equal(t, base, r.BaseCurrency)
+		assert.Equal(t, "EUR", r.QuoteCurrency)
+	}
+
+	rates, err = repo.ListExchangeRates(ctx, repository.ListExchangeRatesParams{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, rates, 1)
+
+	_, err = repo.ListExchangeRates(ctx, repository.ListExchangeRatesParams{Limit: -1})
+	assert.Error(t, err)
+
+	effective := func(at time.Time) (repository.ExchangeRate, error) {
+		return repo.GetEffectiveExchangeRate(ctx, repository.GetEffectiveExchangeRateParams{BaseCurrency: base, QuoteCurrency: "EUR", At: at})
+	}
+	rate, err := effective(day.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, older, rate)
+	rate, err = effective(day.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, newer.ID, rate.ID, "a rate applies from its effective time")
+	_, err = effective(day.Add(-time.Second))
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	from := createWallet(t, repo, 100)
+	to := createWallet(t, repo, 0)
+
+	quote, err := repo.CreateExchangeQuote(ctx, repository.CreateExchangeQuoteParams{
+		FromWalletID:    from.ID,
+		ToWalletID:      to.ID,
+		RateID:          newer.ID,
+		FromCurrency:    base,
+		ToCurrency:      "EUR",
+		RateMicros:      newer.RateMicros,
+		SpreadBps:       50,
+		Rounding:        string(models.RoundingDown),
+		Amount:          100,
+		ConvertedAmount: 94,
+		ExpiresAt:       day,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, quote.FromOperationID)
+	assert.True(t, quote.ExpiresAt.Equal(day))
+
+	got, err := repo.GetExchangeQuote(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, quote.ID, got.ID)
+	_, err = repo.GetExchangeQuote(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for constraint, arg := range map[string]repository.CreateExchangeQuoteParams{
+		"exchange_quotes_from_wallet_id_fkey":    {FromWalletID: uuid.New(), ToWalletID: to.ID, RateID: newer.ID, Rounding: "DOWN", Amount: 1, ConvertedAmount: 1},
+		"exchange_quotes_rate_id_fkey":           {FromWalletID: from.ID, ToWalletID: to.ID, RateID: uuid.New(), Rounding: "DOWN", Amount: 1, ConvertedAmount: 1},
+		"exchange_quotes_rounding_check":         {FromWalletID: from.ID, ToWalletID: to.ID, RateID: newer.ID, Rounding: "UP", Amount: 1, ConvertedAmount: 1},
+		"exchange_quotes_spread_bps_check":       {FromWalletID: from.ID, ToWalletID: to.ID, RateID: newer.ID, Rounding: "DOWN", SpreadBps: -1, Amount: 1, ConvertedAmount: 1},
+		"exchange_quotes_converted_amount_check": {FromWalletID: from.ID, ToWalletID: to.ID, RateID: newer.ID, Rounding: "DOWN", Amount: 1},
+	} {
+		_, err := repo.CreateExchangeQuote(ctx, arg)
+		require.ErrorAs(t, err, &pgErr, constraint)
+		assert.Equal(t, constraint, pgErr.ConstraintName)
+	}
+
+	debit, err := repo.CreateOperation(ctx, repository.CreateOperationParams{WalletID: from.ID, OperationType: string(models.OperationExchange), Amount: -100})
+	require.NoError(t, err)
+	credit, err := repo.CreateOperation(ctx, repository.CreateOperationParams{WalletID: to.ID, OperationType: string(models.OperationExchange), Amount: 94})
+	require.NoError(t, err)
+
+	_, err = repo.ExecuteExchangeQuote(ctx, repository.ExecuteExchangeQuoteParams{ID: quote.ID, FromOperationID: uuid.New(), ToOperationID: credit.ID})
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "exchange_quotes_from_operation_id_fkey", pgErr.ConstraintName)
+
+	executed, err := repo.ExecuteExchangeQuote(ctx, repository.ExecuteExchangeQuoteParams{ID: quote.ID, FromOperationID: debit.ID, ToOperationID: credit.ID})
+	require.NoError(t, err)
+	assert.Equal(t, debit.ID, executed.FromOperationID)
+	assert.Equal(t, credit.ID, executed.ToOperationID)
+
+	_, err = repo.ExecuteExchangeQuote(ctx, repository.ExecuteExchangeQuoteParams{ID: quote.ID, FromOperationID: debit.ID, ToOperationID: credit.ID})
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "a quote is executed once")
+
+	tenant, err := repo.CreateTenant(ctx, "exchange-"+uuid.NewString())
+	require.NoError(t, err)
+	_, err = repo.GetExchangeQuote(service.WithTenant(ctx, tenant.ID), quote.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "quotes of other tenants are not visible")
+}
+
+func testExecTx(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 100)
+
+	var created repository.Wallet
+	err := repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		var err error
+		if created, err = tx.CreateWallet(ctx, repository.CreateWalletParams{}); err != nil {
+			return err
+		}
+		if _, err := tx.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: -30}); err != nil {
+			return err
+		}
+		if _, err := tx.CreateOperation(ctx, repository.CreateOperationParams{
+			WalletID:      wallet.ID,
+			OperationType: string(models.OperationWithdraw),
+			Amount:        -30,
+		}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	_, err = repo.GetWalletByID(ctx, created.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "rolled back wallet")
+
+	got, err := repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(100), got.Balance, "rolled back balance")
+
+	ops, err := repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, ops, "rolled back operation")
+
+	err = repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		if _, err := tx.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 10}); err != nil {
+			return err
+		}
+
+		for range 2 {
+			if _, err := tx.CreateOperation(ctx, repository.CreateOperationParams{
+				WalletID:      wallet.ID,
+				OperationType: string(models.OperationDeposit),
+				Amount:        5,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// A failed savepoint leaves the rest of the transaction intact.
+		err := tx.ExecTx(ctx, func(sp service.WalletRepositoryInterface) error {
+			if _, err := sp.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 1000}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			return err
+		}
+
+		return tx.ExecTx(ctx, func(sp service.WalletRepositoryInterface) error {
+			_, err := sp.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 1})
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	got, err = repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(111), got.Balance)
+
+	ops, err = repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.True(t, ops[0].CreatedAt.Equal(ops[1].CreatedAt), "now() is the transaction start time")
+}
+
+// testExecSnapshot checks that a snapshot misses writes committed while it
+// is open, whether they wait for it or not, and rejects writes of its own.
+func testExecSnapshot(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 100)
+
+	var wg sync.WaitGroup
+	err := repo.ExecSnapshot(ctx, func(tx service.WalletRepositoryInterface) error {
+		got, err := tx.GetWalletByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(100), got.Balance)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 10})
+			assert.NoError(t, err)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		got, err = tx.GetWalletByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(100), got.Balance, "the snapshot does not change")
+
+		_, err = tx.UpdateWallet(ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 1})
+		var pgErr *pgconn.PgError
+		if assert.ErrorAs(t, err, &pgErr) {
+			assert.Equal(t, "25006", pgErr.Code, "read-only transaction")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	wg.Wait()
+
+	got, err := repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(110), got.Balance)
+}
+
+func testConcurrentTx(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	const workers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			errs <- repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+				current, err := tx.GetWalletByIDForUpdate(ctx, wallet.ID)
+				if err != nil {
+					return err
+				}
+				_, err = tx.SetWalletBalance(ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: current.Balance + 1})
+				return err
+			})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	got, err := repo.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(workers), got.Balance, "FOR UPDATE serializes read-modify-write")
+}
+
+// scheduleEpoch is long before anything else in the store is due, so the
+// scheduling tests only claim their own operations.
+var scheduleEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func createScheduledOperation(t *testing.T, repo service.WalletRepositoryInterface, walletID uuid.UUID, nextRunAt time.Time) repository.ScheduledOperation {
+	t.Helper()
+
+	op, err := repo.CreateScheduledOperation(context.Background(), repository.CreateScheduledOperationParams{
+		WalletID:      walletID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        10,
+		NextRunAt:     nextRunAt,
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		repo.DeleteScheduledOperation(context.Background(), op.ID)
+	})
+
+	return op
+}
+
+func testScheduledOperations(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+	target := createWallet(t, repo, 0)
+
+	transfer, err := repo.CreateScheduledOperation(ctx, repository.CreateScheduledOperationParams{
+		WalletID:       wallet.ID,
+		TargetWalletID: target.ID,
+		OperationType:  string(models.OperationTransfer),
+		Amount:         25,
+		Cron:           "@monthly",
+		NextRunAt:      scheduleEpoch,
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, transfer.ID)
+	assert.Equal(t, target.ID, transfer.TargetWalletID)
+	assert.Equal(t, string(models.ScheduleStatusActive), transfer.Status)
+	assert.True(t, scheduleEpoch.Equal(transfer.NextRunAt))
+	assert.False(t, transfer.CreatedAt.IsZero())
+
+	deposit := createScheduledOperation(t, repo, wallet.ID, scheduleEpoch)
+	assert.Equal(t, uuid.Nil, deposit.TargetWalletID, "NULL target reads as the zero UUID")
+
+	got, err := repo.GetScheduledOperation(ctx, transfer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, transfer.ID, got.ID)
+	assert.Equal(t, transfer.Cron, got.Cron)
+
+	_, err = repo.GetScheduledOperation(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for name, arg := range map[string]repository.CreateScheduledOperationParams{
+		"unknown wallet":          {WalletID: uuid.New(), OperationType: string(models.OperationDeposit), Amount: 1, NextRunAt: scheduleEpoch},
+		"unknown target":          {WalletID: wallet.ID, TargetWalletID: uuid.New(), OperationType: string(models.OperationTransfer), Amount: 1, NextRunAt: scheduleEpoch},
+		"transfer without target": {WalletID: wallet.ID, OperationType: string(models.OperationTransfer), Amount: 1, NextRunAt: scheduleEpoch},
+		"deposit with target":     {WalletID: wallet.ID, TargetWalletID: target.ID, OperationType: string(models.OperationDeposit), Amount: 1, NextRunAt: scheduleEpoch},
+		"transfer to itself":      {WalletID: wallet.ID, TargetWalletID: wallet.ID, OperationType: string(models.OperationTransfer), Amount: 1, NextRunAt: scheduleEpoch},
+		"zero amount":             {WalletID: wallet.ID, OperationType: string(models.OperationDeposit), NextRunAt: scheduleEpoch},
+		"unknown type":            {WalletID: wallet.ID, OperationType: "GIFT", Amount: 1, NextRunAt: scheduleEpoch},
+	} {
+		_, err := repo.CreateScheduledOperation(ctx, arg)
+		assert.Error(t, err, name)
+	}
+
+	for _, id := range []uuid.UUID{wallet.ID, target.ID} {
+		listed, err := repo.ListScheduledOperations(ctx, repository.ListScheduledOperationsParams{WalletID: id, PageSize: math.MaxInt32})
+		require.NoError(t, err)
+		assert.True(t, slices.ContainsFunc(listed, func(op repository.ScheduledOperation) bool {
+			return op.ID == transfer.ID
+		}), "a transfer is listed for both wallets")
+	}
+
+	listed, err := repo.ListScheduledOperations(ctx, repository.ListScheduledOperationsParams{WalletID: target.ID, PageSize: math.MaxInt32})
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+
+	page, err := repo.ListScheduledOperations(ctx, repository.ListScheduledOperationsParams{WalletID: wallet.ID, PageSize: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	rest, err := repo.ListScheduledOperations(ctx, repository.ListScheduledOperationsParams{AfterID: page[0].ID, WalletID: wallet.ID, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Positive(t, compareUUID(rest[0].ID, page[0].ID), "pages are in ID order")
+
+	next := scheduleEpoch.AddDate(0, 1, 0)
+	updated, err := repo.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+		ID:            transfer.ID,
+		OperationType: string(models.OperationWithdraw),
+		Amount:        5,
+		Status:        string(models.ScheduleStatusPaused),
+		NextRunAt:     next,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, updated.TargetWalletID)
+	assert.Equal(t, string(models.ScheduleStatusPaused), updated.Status)
+	assert.True(t, next.Equal(updated.NextRunAt))
+	assert.False(t, updated.UpdatedAt.Before(transfer.UpdatedAt))
+
+	_, err = repo.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+		ID:            transfer.ID,
+		OperationType: string(models.OperationWithdraw),
+		Amount:        5,
+		Status:        "SLEEPING",
+		NextRunAt:     next,
+	})
+	assert.Error(t, err)
+
+	_, err = repo.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+		ID:            uuid.New(),
+		OperationType: string(models.OperationDeposit),
+		Amount:        1,
+		Status:        string(models.ScheduleStatusActive),
+		NextRunAt:     next,
+	})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for i := range 3 {
+		_, err := repo.CreateScheduledOperationRun(ctx, repository.CreateScheduledOperationRunParams{
+			ScheduledOperationID: transfer.ID,
+			ScheduledFor:         scheduleEpoch.AddDate(0, i, 0),
+			Status:               string(models.RunStatusSucceeded),
+		})
+		require.NoError(t, err)
+	}
+
+	_, err = repo.CreateScheduledOperationRun(ctx, repository.CreateScheduledOperationRunParams{
+		ScheduledOperationID: transfer.ID,
+		ScheduledFor:         scheduleEpoch,
+		Status:               string(models.RunStatusFailed),
+		Error:                "again",
+	})
+	assert.Error(t, err, "an occurrence runs once")
+
+	_, err = repo.CreateScheduledOperationRun(ctx, repository.CreateScheduledOperationRunParams{
+		ScheduledOperationID: uuid.New(),
+		ScheduledFor:         scheduleEpoch,
+		Status:               string(models.RunStatusSucceeded),
+	})
+	assert.Error(t, err, "runs reference scheduled operations")
+
+	runs, err := repo.ListScheduledOperationRuns(ctx, repository.ListScheduledOperationRunsParams{ScheduledOperationID: transfer.ID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.True(t, scheduleEpoch.AddDate(0, 2, 0).Equal(runs[0].ScheduledFor), "runs are newest first")
+	assert.True(t, scheduleEpoch.AddDate(0, 1, 0).Equal(runs[1].ScheduledFor))
+
+	deleted, err := repo.DeleteScheduledOperation(ctx, transfer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repo.DeleteScheduledOperation(ctx, transfer.ID)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	runs, err = repo.ListScheduledOperationRuns(ctx, repository.ListScheduledOperationRunsParams{ScheduledOperationID: transfer.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, runs, "runs are deleted with their operation")
+}
+
+func testClaimScheduledOperation(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	claim := func(now time.Time) (repository.ScheduledOperation, error) {
+		var op repository.ScheduledOperation
+		err := repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+			var err error
+			op, err = tx.ClaimDueScheduledOperation(ctx, now)
+			return err
+		})
+		return op, err
+	}
+
+	later := createScheduledOperation(t, repo, wallet.ID, scheduleEpoch.Add(2*time.Hour))
+	first := createScheduledOperation(t, repo, wallet.ID, scheduleEpoch.Add(time.Hour))
+	paused := createScheduledOperation(t, repo, wallet.ID, scheduleEpoch)
+	_, err := repo.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+		ID:            paused.ID,
+		OperationType: paused.OperationType,
+		Amount:        paused.Amount,
+		Status:        string(models.ScheduleStatusPaused),
+		NextRunAt:     paused.NextRunAt,
+	})
+	require.NoError(t, err)
+
+	_, err = claim(scheduleEpoch.Add(time.Hour - time.Second))
+	assert.ErrorIs(t, err, pgx.ErrNoRows, "nothing is due and paused operations never are")
+
+	op, err := claim(scheduleEpoch.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, op.ID, "the earliest due operation is claimed first")
+
+	// While one transaction holds the earliest operation, another claims
+	// the next one instead of waiting. A store that serializes transactions
+	// gets there too, once the first transaction has marked it done.
+	now := scheduleEpoch.Add(3 * time.Hour)
+	claimed := make(chan uuid.UUID)
+	release := make(chan struct{})
+
+	go func() {
+		err := repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+			op, err := tx.ClaimDueScheduledOperation(ctx, now)
+			if err != nil {
+				return err
+			}
+			claimed <- op.ID
+			<-release
+
+			_, err = tx.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+				ID:            op.ID,
+				OperationType: op.OperationType,
+				Amount:        op.Amount,
+				Status:        string(models.ScheduleStatusDone),
+				NextRunAt:     op.NextRunAt,
+			})
+			return err
+		})
+		assert.NoError(t, err)
+		close(claimed)
+	}()
+
+	held := <-claimed
+	assert.Equal(t, first.ID, held)
+
+	second := make(chan repository.ScheduledOperation, 1)
+	go func() {
+		op, err := claim(now)
+		assert.NoError(t, err)
+		second <- op
+	}()
+
+	var other repository.ScheduledOperation
+	select {
+	case other = <-second:
+		close(release)
+	case <-time.After(200 * time.Millisecond):
+		close(release)
+		other = <-second
+	}
+	<-claimed
+
+	assert.Equal(t, later.ID, other.ID)
+}
+
+func createInterestProduct(t *testing.T, repo service.WalletRepositoryInterface, rateBps int32) repository.InterestProduct {
+	t.Helper()
+
+	product, err := repo.CreateInterestProduct(context.Background(), repository.CreateInterestProductParams{
+		Name:          "savings " + uuid.NewString(),
+		AnnualRateBps: rateBps,
+		DayCount:      string(models.DayCountAct360),
+		Rounding:      string(models.RoundingHalfUp),
+	})
+	require.NoError(t, err)
+
+	return product
+}
+
+func testInterestProducts(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+
+	product := createInterestProduct(t, repo, 250)
+	assert.NotEqual(t, uuid.Nil, product.ID)
+	assert.Equal(t, int32(250), product.AnnualRateBps)
+	assert.False(t, product.CreatedAt.IsZero())
+
+	got, err := repo.GetInterestProduct(ctx, product.ID)
+	require.NoError(t, err)
+	assert.Equal(t, product.Name, got.Name)
+
+	_, err = repo.GetInterestProduct(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for name, arg := range map[string]repository.CreateInterestProductParams{
+		"taken name":        {Name: product.Name, AnnualRateBps: 1, DayCount: string(models.DayCountAct365), Rounding: string(models.RoundingDown)},
+		"empty name":        {AnnualRateBps: 1, DayCount: string(models.DayCountAct365), Rounding: string(models.RoundingDown)},
+		"negative rate":     {Name: uuid.NewString(), AnnualRateBps: -1, DayCount: string(models.DayCountAct365), Rounding: string(models.RoundingDown)},
+		"rate too high":     {Name: uuid.NewString(), AnnualRateBps: 100001, DayCount: string(models.DayCountAct365), Rounding: string(models.RoundingDown)},
+		"unknown day count": {Name: uuid.NewString(), AnnualRateBps: 1, DayCount: "30/360", Rounding: string(models.RoundingDown)},
+		"unknown rounding":  {Name: uuid.NewString(), AnnualRateBps: 1, DayCount: string(models.DayCountAct365), Rounding: "CEILING"},
+	} {
+		_, err := repo.CreateInterestProduct(ctx, arg)
+		assert.Error(t, err, name)
+	}
+
+	other := createInterestProduct(t, repo, 100)
+	_, err = repo.UpdateInterestProduct(ctx, repository.UpdateInterestProductParams{
+		ID:            other.ID,
+		Name:          product.Name,
+		AnnualRateBps: 100,
+		DayCount:      other.DayCount,
+		Rounding:      other.Rounding,
+	})
+	assert.Error(t, err, "names are unique")
+
+	updated, err := repo.UpdateInterestProduct(ctx, repository.UpdateInterestProductParams{
+		ID:            product.ID,
+		Name:          product.Name,
+		AnnualRateBps: 300,
+		DayCount:      string(models.DayCountActAct),
+		Rounding:      string(models.RoundingHalfEven),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(300), updated.AnnualRateBps)
+	assert.Equal(t, string(models.DayCountActAct), updated.DayCount)
+	assert.False(t, updated.UpdatedAt.Before(product.UpdatedAt))
+
+	_, err = repo.UpdateInterestProduct(ctx, repository.UpdateInterestProductParams{
+		ID:       uuid.New(),
+		Name:     uuid.NewString(),
+		DayCount: string(models.DayCountAct365),
+		Rounding: string(models.RoundingDown),
+	})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	products, err := repo.ListInterestProducts(ctx)
+	require.NoError(t, err)
+	assert.True(t, slices.ContainsFunc(products, func(p repository.InterestProduct) bool {
+		return p.ID == other.ID
+	}))
+}
+
+func testWalletInterest(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+	product := createInterestProduct(t, repo, 250)
+
+	_, err := repo.GetWalletInterest(ctx, wallet.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for name, arg := range map[string]repository.SetWalletInterestParams{
+		"unknown wallet":           {WalletID: uuid.New(), ProductID: product.ID},
+		"unknown product":          {WalletID: wallet.ID, ProductID: uuid.New()},
+		"neither product nor rate": {WalletID: wallet.ID},
+		"negative rate":            {WalletID: wallet.ID, AnnualRateBps: pgtype.Int4{Int32: -1, Valid: true}},
+	} {
+		_, err := repo.SetWalletInterest(ctx, arg)
+		assert.Error(t, err, name)
+	}
+
+	wi, err := repo.SetWalletInterest(ctx, repository.SetWalletInterestParams{WalletID: wallet.ID, ProductID: product.ID})
+	require.NoError(t, err)
+	assert.Equal(t, product.ID, wi.ProductID)
+	assert.False(t, wi.AnnualRateBps.Valid)
+
+	terms, err := repo.GetInterestTerms(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.WalletInterestTerm{
+		WalletID:      wallet.ID,
+		CreatedAt:     wi.CreatedAt,
+		AnnualRateBps: 250,
+		DayCount:      string(models.DayCountAct360),
+		Rounding:      string(models.RoundingHalfUp),
+	}, terms, "terms come from the product")
+
+	overridden, err := repo.SetWalletInterest(ctx, repository.SetWalletInterestParams{
+		WalletID:      wallet.ID,
+		ProductID:     product.ID,
+		AnnualRateBps: pgtype.Int4{Int32: 400, Valid: true},
+	})
+	require.NoError(t, err)
+	assert.True(t, wi.CreatedAt.Equal(overridden.CreatedAt), "enrolment keeps its date")
+
+	terms, err = repo.GetInterestTerms(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(400), terms.AnnualRateBps, "the wallet rate overrides the product rate")
+	assert.Equal(t, string(models.DayCountAct360), terms.DayCount)
+
+	own := createWallet(t, repo, 0)
+	_, err = repo.SetWalletInterest(ctx, repository.SetWalletInterestParams{
+		WalletID:      own.ID,
+		AnnualRateBps: pgtype.Int4{Int32: 100, Valid: true},
+	})
+	require.NoError(t, err)
+
+	var listed []repository.WalletInterestTerm
+	params := repository.ListInterestTermsParams{PageSize: 100}
+	for {
+		page, err := repo.ListInterestTerms(ctx, params)
+		require.NoError(t, err)
+		listed = append(listed, page...)
+		if len(page) < int(params.PageSize) {
+			break
+		}
+		params.AfterWalletID = page[len(page)-1].WalletID
+	}
+	assert.True(t, slices.IsSortedFunc(listed, func(a, b repository.WalletInterestTerm) int {
+		return compareUUID(a.WalletID, b.WalletID)
+	}))
+
+	i := slices.IndexFunc(listed, func(t repository.WalletInterestTerm) bool { return t.WalletID == own.ID })
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, int32(100), listed[i].AnnualRateBps)
+	assert.Empty(t, listed[i].DayCount, "a wallet without a product has no conventions")
+
+	deleted, err := repo.DeleteWalletInterest(ctx, own.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repo.DeleteWalletInterest(ctx, own.ID)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	_, err = repo.GetInterestTerms(ctx, own.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func testInterestAccruals(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	wallet := createWallet(t, repo, 0)
+
+	op, err := repo.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        40,
+	})
+	require.NoError(t, err)
+
+	balance, err := repo.GetWalletBalanceAt(ctx, repository.GetWalletBalanceAtParams{WalletID: wallet.ID, Before: op.CreatedAt})
+	require.NoError(t, err)
+	assert.Zero(t, balance, "operations at the time itself are excluded")
+
+	balance, err = repo.GetWalletBalanceAt(ctx, repository.GetWalletBalanceAtParams{WalletID: wallet.ID, Before: op.CreatedAt.Add(time.Microsecond)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), balance)
+
+	accrue := func(day time.Time, micros int64) int64 {
+		n, err := repo.CreateInterestAccrual(ctx, repository.CreateInterestAccrualParams{
+			WalletID:      wallet.ID,
+			AccrualDate:   day,
+			Balance:       40,
+			AnnualRateBps: 365,
+			DayCount:      string(models.DayCountAct365),
+			AmountMicros:  micros,
+		})
+		require.NoError(t, err)
+		return n
+	}
+
+	for i := range 3 {
+		assert.Equal(t, int64(1), accrue(scheduleEpoch.AddDate(0, 0, 30+i), 4000))
+	}
+	assert.Zero(t, accrue(scheduleEpoch.AddDate(0, 0, 30), 9999), "a day accrues once")
+
+	_, err = repo.CreateInterestAccrual(ctx, repository.CreateInterestAccrualParams{WalletID: uuid.New(), AccrualDate: scheduleEpoch})
+	assert.Error(t, err, "accruals reference wallets")
+
+	accruals, err := repo.ListInterestAccruals(ctx, repository.ListInterestAccrualsParams{WalletID: wallet.ID, FromDate: scheduleEpoch.AddDate(0, 0, 31)})
+	require.NoError(t, err)
+	require.Len(t, accruals, 2)
+	assert.True(t, scheduleEpoch.AddDate(0, 0, 31).Equal(accruals[0].AccrualDate), "accruals are in date order")
+	assert.Equal(t, int64(4000), accruals[0].AmountMicros)
+	assert.False(t, accruals[0].Paid)
+
+	february := scheduleEpoch.AddDate(0, 1, 0)
+	walletIDs, err := repo.ListWalletsWithUnpaidInterest(ctx, repository.ListWalletsWithUnpaidInterestParams{BeforeDate: february, PageSize: math.MaxInt32})
+	require.NoError(t, err)
+	assert.Contains(t, walletIDs, wallet.ID)
+
+	unpaid, err := repo.GetUnpaidInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12000), unpaid)
+
+	paid, err := repo.MarkInterestAccrualsPaid(ctx, repository.MarkInterestAccrualsPaidParams{WalletID: wallet.ID, BeforeDate: february})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4000), paid, "only days before the date are paid")
+
+	paid, err = repo.MarkInterestAccrualsPaid(ctx, repository.MarkInterestAccrualsPaidParams{WalletID: wallet.ID, BeforeDate: february})
+	require.NoError(t, err)
+	assert.Zero(t, paid, "a day is paid once")
+
+	walletIDs, err = repo.ListWalletsWithUnpaidInterest(ctx, repository.ListWalletsWithUnpaidInterestParams{BeforeDate: february, PageSize: math.MaxInt32})
+	require.NoError(t, err)
+	assert.NotContains(t, walletIDs, wallet.ID)
+
+	unpaid, err = repo.GetUnpaidInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8000), unpaid)
+
+	_, err = repo.GetLatestInterestPayout(ctx, wallet.ID)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	pay := func(period time.Time, amount int32) (int64, error) {
+		return repo.CreateInterestPayout(ctx, repository.CreateInterestPayoutParams{
+			WalletID:      wallet.ID,
+			Period:        period,
+			AccruedMicros: int64(amount) * 1_000_000,
+			Amount:        amount,
+			CarryMicros:   -5,
+		})
+	}
+
+	n, err := pay(scheduleEpoch, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = pay(february, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = pay(february, 3)
+	require.NoError(t, err)
+	assert.Zero(t, n, "a month is paid once")
+
+	_, err = pay(february.AddDate(0, 0, 1), 1)
+	assert.Error(t, err, "periods are months")
+
+	_, err = pay(february.AddDate(0, 1, 0), -1)
+	assert.Error(t, err)
+
+	latest, err := repo.GetLatestInterestPayout(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.True(t, february.Equal(latest.Period))
+	assert.Equal(t, int32(2), latest.Amount)
+	assert.Equal(t, int64(-5), latest.CarryMicros)
+
+	payouts, err := repo.ListInterestPayouts(ctx, repository.ListInterestPayoutsParams{WalletID: wallet.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, payouts, 2)
+	assert.True(t, scheduleEpoch.Equal(payouts[1].Period), "payouts are newest first")
+}
+
+// compareUUID orders UUIDs like Postgres, byte by byte.
+func createFeeSchedule(t *testing.T, repo service.WalletRepositoryInterface, productID uuid.UUID, kind models.FeeKind) repository.FeeSchedule {
+	t.Helper()
+
+	schedule, err := repo.CreateFeeSchedule(context.Background(), repository.CreateFeeScheduleParams{
+		OperationType: string(models.OperationWithdraw),
+		ProductID:     productID,
+		Kind:          string(kind),
+		RateBps:       100,
+		MinFee:        1,
+		MaxFee:        50,
+	})
+	require.NoError(t, err)
+
+	return schedule
+}
+
+// testFeeSchedules scopes schedules to fresh products, except inside rolled
+// back transactions: a default schedule may exist in the store already.
+func testFeeSchedules(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	product := createInterestProduct(t, repo, 0)
+
+	schedule := createFeeSchedule(t, repo, product.ID, models.FeeKindPercentage)
+	assert.NotEqual(t, uuid.Nil, schedule.ID)
+	assert.Equal(t, product.ID, schedule.ProductID)
+	assert.False(t, schedule.CreatedAt.IsZero())
+
+	got, err := repo.GetFeeSchedule(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, schedule.Kind, got.Kind)
+
+	_, err = repo.GetFeeSchedule(ctx, uuid.New())
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	valid := repository.CreateFeeScheduleParams{
+		OperationType: string(models.OperationDeposit),
+		ProductID:     product.ID,
+		Kind:          string(models.FeeKindFlat),
+	}
+	for name, mutate := range map[string]func(p *repository.CreateFeeScheduleParams){
+		"taken operation type": func(p *repository.CreateFeeScheduleParams) { p.OperationType = string(models.OperationWithdraw) },
+		"unknown type":         func(p *repository.CreateFeeScheduleParams) { p.OperationType = string(models.OperationFee) },
+		"unknown kind":         func(p *repository.CreateFeeScheduleParams) { p.Kind = "CAPPED" },
+		"negative flat amount": func(p *repository.CreateFeeScheduleParams) { p.FlatAmount = -1 },
+		"rate too high":        func(p *repository.CreateFeeScheduleParams) { p.RateBps = 10001 },
+		"max below min":        func(p *repository.CreateFeeScheduleParams) { p.MinFee, p.MaxFee = 5, 4 },
+		"missing product":      func(p *repository.CreateFeeScheduleParams) { p.ProductID = uuid.New() },
+	} {
+		arg := valid
+		mutate(&arg)
+		_, err := repo.CreateFeeSchedule(ctx, arg)
+		assert.Error(t, err, name)
+	}
+
+	updated, err := repo.UpdateFeeSchedule(ctx, repository.UpdateFeeScheduleParams{
+		ID:            schedule.ID,
+		OperationType: schedule.OperationType,
+		ProductID:     product.ID,
+		Kind:          string(models.FeeKindTiered),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.FeeKindTiered), updated.Kind)
+	assert.Zero(t, updated.RateBps)
+	assert.False(t, updated.UpdatedAt.Before(schedule.UpdatedAt))
+
+	_, err = repo.UpdateFeeSchedule(ctx, repository.UpdateFeeScheduleParams{
+		ID:            uuid.New(),
+		OperationType: string(models.OperationDeposit),
+		Kind:          string(models.FeeKindFlat),
+	})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	for _, minAmount := range []int32{1000, 0} {
+		require.NoError(t, repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{ScheduleID: schedule.ID, MinAmount: minAmount, RateBps: 10}))
+	}
+	assert.Error(t, repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{ScheduleID: schedule.ID, MinAmount: 0}), "tiers start at distinct amounts")
+	assert.Error(t, repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{ScheduleID: uuid.New()}), "tiers reference schedules")
+	assert.Error(t, repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{ScheduleID: schedule.ID, MinAmount: 5, RateBps: -1}), "tier rates are checked")
+
+	tiers, err := repo.ListFeeTiers(ctx, schedule.ID)
+	require.NoError(t, err)
+	require.Len(t, tiers, 2)
+	assert.Equal(t, int32(0), tiers[0].MinAmount, "tiers are ordered by min amount")
+
+	require.NoError(t, repo.DeleteFeeTiers(ctx, schedule.ID))
+	tiers, err = repo.ListFeeTiers(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tiers)
+
+	schedules, err := repo.ListFeeSchedules(ctx)
+	require.NoError(t, err)
+	assert.True(t, slices.ContainsFunc(schedules, func(fs repository.FeeSchedule) bool {
+		return fs.ID == schedule.ID
+	}))
+
+	require.NoError(t, repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{ScheduleID: schedule.ID}))
+	deleted, err := repo.DeleteFeeSchedule(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	tiers, err = repo.ListFeeTiers(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tiers, "tiers are deleted with their schedule")
+
+	deleted, err = repo.DeleteFeeSchedule(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func testWalletFeeSchedule(t *testing.T, repo service.WalletRepositoryInterface) {
+	ctx := context.Background()
+	product := createInterestProduct(t, repo, 0)
+	other := createInterestProduct(t, repo, 0)
+
+	enrolled := createWallet(t, repo, 0)
+	wallet, err := repo.SetWalletProduct(ctx, repository.SetWalletProductParams{ID: enrolled.ID, ProductID: product.ID})
+	require.NoError(t, err)
+	assert.Equal(t, product.ID, wallet.ProductID)
+
+	_, err = repo.SetWalletProduct(ctx, repository.SetWalletProductParams{ID: enrolled.ID, ProductID: uuid.New()})
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "wallets_product_id_fkey", pgErr.ConstraintName)
+
+	// Earning the interest of a product does not make it the wallet's.
+	plain := createWallet(t, repo, 0)
+	_, err = repo.SetWalletInterest(ctx, repository.SetWalletInterestParams{WalletID: plain.ID, ProductID: product.ID})
+	require.NoError(t, err)
+
+	err = repo.ExecTx(ctx, func(tx service.WalletRepositoryInterface) error {
+		// Make sure no default schedule is left from earlier runs.
+		schedules, err := tx.ListFeeSchedules(ctx)
+		if err != nil {
+			return err
+		}
+		for _, fs := range schedules {
+			if fs.ProductID == uuid.Nil {
+				if _, err := tx.DeleteFeeSchedule(ctx, fs.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		lookup := func(walletID uuid.UUID) (repository.FeeSchedule, error) {
+			return tx.GetWalletFeeSchedule(ctx, repository.GetWalletFeeScheduleParams{
+				WalletID:      walletID,
+				OperationType: string(models.OperationWithdraw),
+			})
+		}
+
+		_, err = lookup(plain.ID)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "no schedule applies")
+
+		createFeeSchedule(t, tx, other.ID, models.FeeKindFlat)
+		_, err = lookup(enrolled.ID)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "schedules of other products do not apply")
+
+		byDefault := createFeeSchedule(t, tx, uuid.Nil, models.FeeKindFlat)
+		assert.Equal(t, uuid.Nil, byDefault.ProductID)
+
+		_, err = tx.CreateFeeSchedule(ctx, repository.CreateFeeScheduleParams{
+			OperationType: string(models.OperationWithdraw),
+			Kind:          string(models.FeeKindFlat),
+		})
+		assert.Error(t, err, "one default schedule per operation type")
+
+		got, err := lookup(plain.ID)
+		require.NoError(t, err)
+		assert.Equal(t, byDefault.ID, got.ID, "wallets without a product get the default")
+
+		got, err = lookup(enrolled.ID)
+		require.NoError(t, err)
+		assert.Equal(t, byDefault.ID, got.ID, "the default applies without a product schedule")
+
+		own := createFeeSchedule(t, tx, product.ID, models.FeeKindFlat)
+		got, err = lookup(enrolled.ID)
+		require.NoError(t, err)
+		assert.Equal(t, own.ID, got.ID, "the product schedule wins")
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func compareOperations(a, b repository.Operation) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return compareUUID(a.ID, b.ID)
+}
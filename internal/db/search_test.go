@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedQuery struct {
+	sql  string
+	args []any
+}
+
+// queryRecorder is a tracer keeping the statements a pool runs.
+type queryRecorder struct {
+	mu      sync.Mutex
+	queries []recordedQuery
+}
+
+func (r *queryRecorder) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queries = append(r.queries, recordedQuery{sql: data.SQL, args: data.Args})
+	return ctx
+}
+
+func (r *queryRecorder) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// last returns the last statement generated from the query name.
+func (r *queryRecorder) last(name string) (recordedQuery, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.queries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(r.queries[i].sql, "-- name: "+name+" ") {
+			return r.queries[i], true
+		}
+	}
+	return recordedQuery{}, false
+}
+
+// The plans are checked with sequential scans, bitmap scans and sorts made
+// prohibitively expensive, so a test table of a few rows still shows whether
+// the index can return the page in order.
+func TestStore_SearchWallets_UsesIndex(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+
+	cfg, err := pgxpool.ParseConfig(testDatabaseURL(t))
+	require.NoError(t, err)
+	recorder := &queryRecorder{}
+	cfg.ConnConfig.Tracer = recorder
+
+	pool, err := pgxpool.NewWithConfig(ctx, withTenantHooks(cfg))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	store := NewStore(pool)
+
+	conn, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SET enable_seqscan = off; SET enable_bitmapscan = off; SET enable_sort = off; SET plan_cache_mode = force_generic_plan")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		query      string
+		sortBy     string
+		descending bool
+		index      string
+	}{
+		{"SearchWalletsByID", service.SortByID, false, "wallets_pkey"},
+		{"SearchWalletsByIDDesc", service.SortByID, true, "wallets_pkey"},
+		{"SearchWalletsByBalance", service.SortByBalance, false, "wallets_balance_idx"},
+		{"SearchWalletsByBalanceDesc", service.SortByBalance, true, "wallets_balance_idx"},
+		{"SearchWalletsByCreatedAt", service.SortByCreatedAt, false, "wallets_created_at_idx"},
+		{"SearchWalletsByCreatedAtDesc", service.SortByCreatedAt, true, "wallets_created_at_idx"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			for _, afterID := range []uuid.UUID{uuid.Nil, uuid.New()} {
+				_, err := store.SearchWallets(ctx, service.SearchWalletsParams{
+					LabelsHas:     []string{},
+					LabelsMissing: []string{},
+					MinBalance:    math.MinInt32,
+					MaxBalance:    math.MaxInt32,
+					CreatedTo:     time.Now().Add(time.Hour),
+					SortBy:        tc.sortBy,
+					Descending:    tc.descending,
+					AfterID:       afterID,
+					PageSize:      10,
+				})
+				require.NoError(t, err)
+
+				query, ok := recorder.last(tc.query)
+				require.True(t, ok, "the search did not run %s", tc.query)
+
+				rows, err := conn.Query(ctx, "EXPLAIN (COSTS OFF) "+query.sql, query.args...)
+				require.NoError(t, err)
+				lines, err := pgx.CollectRows(rows, pgx.RowTo[string])
+				require.NoError(t, err)
+				plan := strings.Join(lines, "\n")
+
+				assert.Contains(t, plan, "Index Scan", plan)
+				assert.Contains(t, plan, tc.index, plan)
+				assert.NotContains(t, plan, "Sort", plan)
+			}
+		})
+	}
+}
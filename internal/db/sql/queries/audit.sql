@@ -0,0 +1,17 @@
+-- name: CreateAuditEntry :one
+INSERT INTO audit_log (actor, action, wallet_id, before, after, request_id, source_ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ListAuditEntries :many
+-- Empty filters match everything. Entries come in time order after the
+-- entry after_id, or from the start with a zero after_id.
+SELECT * FROM audit_log
+WHERE (@actor::text = '' OR actor = @actor::text)
+  AND (@wallet_id::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = @wallet_id::uuid)
+  AND created_at >= @from_time::timestamptz
+  AND created_at < @to_time::timestamptz
+  AND (@after_id::uuid = '00000000-0000-0000-0000-000000000000'
+    OR (created_at, id) > (SELECT a.created_at, a.id FROM audit_log a WHERE a.id = @after_id::uuid))
+ORDER BY created_at, id
+LIMIT @page_size;
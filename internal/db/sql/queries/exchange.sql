@@ -0,0 +1,41 @@
+-- name: CreateExchangeRate :one
+INSERT INTO exchange_rates (base_currency, quote_currency, rate_micros, effective_from, source)
+VALUES (@base_currency, @quote_currency, @rate_micros, @effective_from, @source)
+RETURNING *;
+
+-- name: ListExchangeRates :many
+-- Empty currencies match any pair; the newest rates of a pair come first.
+SELECT * FROM exchange_rates
+WHERE (@base_currency::text = '' OR base_currency = @base_currency)
+  AND (@quote_currency::text = '' OR quote_currency = @quote_currency)
+ORDER BY base_currency, quote_currency, effective_from DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetEffectiveExchangeRate :one
+SELECT * FROM exchange_rates
+WHERE base_currency = @base_currency
+  AND quote_currency = @quote_currency
+  AND effective_from <= @at
+ORDER BY effective_from DESC
+LIMIT 1;
+
+-- name: CreateExchangeQuote :one
+INSERT INTO exchange_quotes (
+  from_wallet_id, to_wallet_id, rate_id, from_currency, to_currency,
+  rate_micros, spread_bps, rounding, amount, converted_amount, expires_at
+) VALUES (
+  @from_wallet_id, @to_wallet_id, @rate_id, @from_currency, @to_currency,
+  @rate_micros, @spread_bps, @rounding, @amount, @converted_amount, @expires_at
+)
+RETURNING *;
+
+-- name: GetExchangeQuote :one
+SELECT * FROM exchange_quotes WHERE id = $1;
+
+-- name: ExecuteExchangeQuote :one
+-- Matches only a quote that has not been executed, so a quote is executed
+-- at most once even by concurrent requests.
+UPDATE exchange_quotes
+SET from_operation_id = @from_operation_id, to_operation_id = @to_operation_id
+WHERE id = @id AND from_operation_id IS NULL
+RETURNING *;
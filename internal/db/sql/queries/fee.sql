@@ -0,0 +1,45 @@
+-- name: CreateFeeSchedule :one
+INSERT INTO fee_schedules (operation_type, product_id, kind, flat_amount, rate_bps, min_fee, max_fee)
+VALUES (@operation_type, NULLIF(@product_id::uuid, '00000000-0000-0000-0000-000000000000'), @kind, @flat_amount, @rate_bps, @min_fee, @max_fee)
+RETURNING *;
+
+-- name: GetFeeSchedule :one
+SELECT * FROM fee_schedules WHERE id = $1;
+
+-- name: ListFeeSchedules :many
+SELECT * FROM fee_schedules ORDER BY operation_type, product_id NULLS FIRST;
+
+-- name: UpdateFeeSchedule :one
+UPDATE fee_schedules
+SET operation_type = @operation_type,
+    product_id = NULLIF(@product_id::uuid, '00000000-0000-0000-0000-000000000000'),
+    kind = @kind,
+    flat_amount = @flat_amount,
+    rate_bps = @rate_bps,
+    min_fee = @min_fee,
+    max_fee = @max_fee,
+    updated_at = now()
+WHERE id = @id
+RETURNING *;
+
+-- name: DeleteFeeSchedule :execrows
+DELETE FROM fee_schedules WHERE id = $1;
+
+-- name: GetWalletFeeSchedule :one
+-- The schedule of the wallet's product wins over the default one.
+SELECT fs.* FROM fee_schedules fs
+LEFT JOIN wallets w ON w.id = @wallet_id
+WHERE fs.operation_type = @operation_type
+  AND (fs.product_id IS NULL OR fs.product_id = w.product_id)
+ORDER BY fs.product_id IS NULL
+LIMIT 1;
+
+-- name: CreateFeeTier :exec
+INSERT INTO fee_tiers (schedule_id, min_amount, flat_amount, rate_bps)
+VALUES ($1, $2, $3, $4);
+
+-- name: ListFeeTiers :many
+SELECT * FROM fee_tiers WHERE schedule_id = $1 ORDER BY min_amount;
+
+-- name: DeleteFeeTiers :exec
+DELETE FROM fee_tiers WHERE schedule_id = $1;
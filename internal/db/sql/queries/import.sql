@@ -0,0 +1,143 @@
+-- name: CreateImport :one
+INSERT INTO imports (skip_invalid, total_rows, file_hash)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetImport :one
+SELECT * FROM imports WHERE id = $1;
+
+-- name: GetImportByFileHash :one
+-- The import of the tenant that holds the file, unless it was rejected.
+SELECT * FROM imports
+WHERE file_hash = $1 AND status <> 'REJECTED';
+
+-- name: ClaimImport :one
+-- Locks a pending import for applying it. Whoever waited for the lock gets
+-- no row once the import is finished.
+SELECT * FROM imports
+WHERE id = $1 AND status = 'PENDING'
+FOR UPDATE;
+
+-- name: ListPendingImports :many
+SELECT * FROM imports
+WHERE status = 'PENDING' AND updated_at < @before
+ORDER BY updated_at
+LIMIT @page_size;
+
+-- name: FinishImport :one
+UPDATE imports
+SET status = @status,
+    applied_rows = @applied_rows,
+    failed_rows = @failed_rows,
+    updated_at = now()
+WHERE id = @id
+RETURNING *;
+
+-- name: CreateImportRows :copyfrom
+INSERT INTO import_rows (import_id, row_number, wallet_id, operation_type, amount, reference, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: ListImportRows :many
+SELECT * FROM import_rows
+WHERE import_id = @import_id AND row_number > @after_row
+ORDER BY row_number
+LIMIT @page_size;
+
+-- name: ListImportErrors :many
+SELECT * FROM import_rows
+WHERE import_id = $1 AND error <> ''
+ORDER BY row_number;
+
+-- name: SetImportRowError :exec
+UPDATE import_rows SET error = @error
+WHERE import_id = @import_id AND row_number = @row_number;
+
+-- name: LockImportWallets :many
+-- Locks the wallets of the valid rows in ID order, so that imports and
+-- transfers lock them alike.
+SELECT id FROM wallets
+WHERE id IN (SELECT r.wallet_id FROM import_rows r WHERE r.import_id = $1 AND r.error = '')
+ORDER BY id
+FOR UPDATE;
+
+-- name: CheckImportRows :execrows
+-- Marks the rows of wallets that are missing or not active.
+UPDATE import_rows r
+SET error = CASE
+  WHEN NOT EXISTS (SELECT 1 FROM wallets w WHERE w.id = r.wallet_id) THEN @wallet_not_found::text
+  ELSE @wallet_frozen::text
+END
+WHERE r.import_id = @import_id
+  AND r.error = ''
+  AND NOT EXISTS (SELECT 1 FROM wallets w WHERE w.id = r.wallet_id AND w.status = 'ACTIVE');
+
+-- name: ListImportRowBalances :many
+-- The valid rows of unsharded wallets with the balance of their wallet, in
+-- the order they are checked: by wallet, then by row.
+SELECT r.row_number, r.wallet_id, r.operation_type, r.amount, w.balance
+FROM import_rows r
+JOIN wallets w ON w.id = r.wallet_id
+WHERE r.import_id = $1 AND r.error = '' AND w.shard_count = 0
+ORDER BY r.wallet_id, r.row_number;
+
+-- name: SetImportRowErrors :exec
+-- Sets errors[i] on row row_numbers[i].
+UPDATE import_rows r SET error = e.error
+FROM (
+  SELECT (@row_numbers::int[])[i] AS row_number, (@errors::text[])[i] AS error
+  FROM generate_subscripts(@row_numbers::int[], 1) AS i
+) e
+WHERE r.import_id = @import_id AND r.row_number = e.row_number;
+
+-- name: ApplyImportRows :one
+-- Applies the valid rows of unsharded wallets at once: the balances, an
+-- operation per row and one journal entry booking each wallet against
+-- adjustments. The rows must have been checked with the wallets locked.
+WITH applied AS (
+  SELECT
+    r.row_number, r.wallet_id, r.operation_type, r.reference,
+    CASE WHEN r.operation_type = 'WITHDRAW' THEN -r.amount ELSE r.amount END AS amount
+  FROM import_rows r
+  JOIN wallets w ON w.id = r.wallet_id
+  WHERE r.import_id = @import_id AND r.error = '' AND w.shard_count = 0
+), totals AS (
+  SELECT
+    a.wallet_id,
+    w.currency,
+    SUM(a.amount)::int AS amount,
+    row_number() OVER (ORDER BY a.wallet_id)::int AS n
+  FROM applied a
+  JOIN wallets w ON w.id = a.wallet_id
+  GROUP BY a.wallet_id, w.currency
+  HAVING SUM(a.amount) <> 0
+), balances AS (
+  UPDATE wallets w
+  SET balance = w.balance + t.amount
+  FROM totals t
+  WHERE w.id = t.wallet_id
+), created AS (
+  INSERT INTO operations (wallet_id, operation_type, amount, import_id, reference)
+  SELECT a.wallet_id, a.operation_type, a.amount, @import_id, a.reference
+  FROM applied a
+  ORDER BY a.row_number
+), entry AS (
+  INSERT INTO journal_entries (description)
+  SELECT 'IMPORT'
+  WHERE EXISTS (SELECT 1 FROM totals)
+  RETURNING id
+), legs AS (
+  INSERT INTO journal_legs (entry_id, leg, account, wallet_id, debit, credit, currency)
+  SELECT entry.id, 2 * t.n - 1, 'wallet', t.wallet_id, GREATEST(-t.amount, 0), GREATEST(t.amount, 0), t.currency
+  FROM entry, totals t
+  UNION ALL
+  SELECT entry.id, 2 * t.n, 'adjustments', NULL, GREATEST(t.amount, 0), GREATEST(-t.amount, 0), t.currency
+  FROM entry, totals t
+)
+SELECT count(*)::int AS applied_rows FROM applied;
+
+-- name: ListShardedImportRows :many
+-- The valid rows of sharded wallets, which are applied one by one.
+SELECT r.* FROM import_rows r
+JOIN wallets w ON w.id = r.wallet_id
+WHERE r.import_id = $1 AND r.error = '' AND w.shard_count > 0
+ORDER BY r.row_number;
@@ -0,0 +1,98 @@
+-- name: CreateInterestProduct :one
+INSERT INTO interest_products (name, annual_rate_bps, day_count, rounding)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetInterestProduct :one
+SELECT * FROM interest_products WHERE id = $1;
+
+-- name: ListInterestProducts :many
+SELECT * FROM interest_products ORDER BY name;
+
+-- name: UpdateInterestProduct :one
+UPDATE interest_products
+SET name = $2,
+    annual_rate_bps = $3,
+    day_count = $4,
+    rounding = $5,
+    updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetWalletInterest :one
+INSERT INTO wallet_interest (wallet_id, product_id, annual_rate_bps)
+VALUES (@wallet_id, NULLIF(@product_id::uuid, '00000000-0000-0000-0000-000000000000'), @annual_rate_bps)
+ON CONFLICT (wallet_id) DO UPDATE
+SET product_id = excluded.product_id,
+    annual_rate_bps = excluded.annual_rate_bps,
+    updated_at = now()
+RETURNING *;
+
+-- name: GetWalletInterest :one
+SELECT * FROM wallet_interest WHERE wallet_id = $1;
+
+-- name: DeleteWalletInterest :execrows
+DELETE FROM wallet_interest WHERE wallet_id = $1;
+
+-- name: GetInterestTerms :one
+SELECT * FROM wallet_interest_terms WHERE wallet_id = $1;
+
+-- name: ListInterestTerms :many
+SELECT * FROM wallet_interest_terms
+WHERE wallet_id > @after_wallet_id
+ORDER BY wallet_id
+LIMIT @page_size;
+
+-- name: GetWalletBalanceAt :one
+-- The ledger balance of the wallet just before the given time.
+SELECT COALESCE(SUM(amount), 0)::bigint AS balance
+FROM operations
+WHERE wallet_id = @wallet_id AND created_at < @before::timestamptz;
+
+-- name: CreateInterestAccrual :execrows
+INSERT INTO interest_accruals (wallet_id, accrual_date, balance, annual_rate_bps, day_count, amount_micros)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (wallet_id, accrual_date) DO NOTHING;
+
+-- name: ListInterestAccruals :many
+SELECT * FROM interest_accruals
+WHERE wallet_id = @wallet_id AND accrual_date >= @from_date
+ORDER BY accrual_date;
+
+-- name: ListWalletsWithUnpaidInterest :many
+SELECT DISTINCT wallet_id FROM interest_accruals
+WHERE NOT paid AND accrual_date < @before_date AND wallet_id > @after_wallet_id
+ORDER BY wallet_id
+LIMIT @page_size;
+
+-- name: MarkInterestAccrualsPaid :one
+-- Returns the sum of the accruals it marked.
+WITH marked AS (
+  UPDATE interest_accruals
+  SET paid = true
+  WHERE wallet_id = @wallet_id AND NOT paid AND accrual_date < @before_date
+  RETURNING amount_micros
+)
+SELECT COALESCE(SUM(amount_micros), 0)::bigint AS accrued_micros FROM marked;
+
+-- name: GetUnpaidInterest :one
+SELECT COALESCE(SUM(amount_micros), 0)::bigint AS accrued_micros
+FROM interest_accruals
+WHERE wallet_id = $1 AND NOT paid;
+
+-- name: GetLatestInterestPayout :one
+SELECT * FROM interest_payouts
+WHERE wallet_id = $1
+ORDER BY period DESC
+LIMIT 1;
+
+-- name: CreateInterestPayout :execrows
+INSERT INTO interest_payouts (wallet_id, period, accrued_micros, amount, carry_micros)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (wallet_id, period) DO NOTHING;
+
+-- name: ListInterestPayouts :many
+SELECT * FROM interest_payouts
+WHERE wallet_id = $1
+ORDER BY period DESC
+LIMIT $2;
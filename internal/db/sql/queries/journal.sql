@@ -0,0 +1,69 @@
+-- name: CreateJournalEntry :one
+-- The legs are given as parallel arrays, a zero wallet ID meaning a system
+-- account. A leg without a currency is in that of its wallet or, on a
+-- system account, in the one currency of the wallets of the entry. Nothing
+-- is inserted, and no row returned, unless the debits equal the credits in
+-- every currency.
+WITH legs AS (
+  SELECT
+    i AS leg,
+    (@accounts::text[])[i] AS account,
+    (@wallet_ids::uuid[])[i] AS wallet_id,
+    (@debits::int[])[i] AS debit,
+    (@credits::int[])[i] AS credit,
+    NULLIF((@currencies::text[])[i], '') AS currency
+  FROM generate_subscripts(@accounts::text[], 1) AS i
+), priced AS (
+  SELECT
+    legs.leg, legs.account, legs.wallet_id, legs.debit, legs.credit,
+    COALESCE(legs.currency, w.currency, (
+      SELECT CASE WHEN count(DISTINCT ew.currency) = 1 THEN min(ew.currency) END
+      FROM wallets ew
+      WHERE ew.id = ANY(@wallet_ids::uuid[])
+    )) AS currency
+  FROM legs
+  LEFT JOIN wallets w ON w.id = legs.wallet_id
+), entry AS (
+  INSERT INTO journal_entries (description)
+  SELECT @description::text
+  WHERE (
+    SELECT bool_and(t.debit = t.credit)
+    FROM (SELECT SUM(debit) AS debit, SUM(credit) AS credit FROM priced GROUP BY currency) t
+  )
+  RETURNING *
+), inserted AS (
+  INSERT INTO journal_legs (entry_id, leg, account, wallet_id, debit, credit, currency)
+  SELECT entry.id, priced.leg, priced.account, NULLIF(priced.wallet_id, '00000000-0000-0000-0000-000000000000'), priced.debit, priced.credit, priced.currency
+  FROM entry, priced
+)
+SELECT * FROM entry;
+
+-- name: ListJournalLegs :many
+SELECT * FROM journal_legs
+WHERE entry_id = $1
+ORDER BY leg;
+
+-- name: GetTrialBalance :many
+SELECT
+  currency,
+  account,
+  COALESCE(SUM(debit), 0)::bigint AS debit,
+  COALESCE(SUM(credit), 0)::bigint AS credit
+FROM journal_legs
+GROUP BY currency, account
+ORDER BY currency, account;
+
+-- name: ListWalletJournalMismatches :many
+-- Wallets whose legs in the journal do not add up to their balance, their
+-- shards included.
+SELECT *
+FROM (
+  SELECT
+    w.id,
+    (w.balance + COALESCE((SELECT SUM(s.balance) FROM wallet_shards s WHERE s.wallet_id = w.id), 0))::bigint AS balance,
+    COALESCE((SELECT SUM(l.credit::bigint - l.debit) FROM journal_legs l WHERE l.wallet_id = w.id AND l.account = 'wallet'), 0)::bigint AS journal_balance
+  FROM wallets w
+) b
+WHERE b.balance <> b.journal_balance
+ORDER BY b.id
+LIMIT @max_rows;
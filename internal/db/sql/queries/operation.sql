@@ -0,0 +1,64 @@
+-- name: CreateOperation :one
+-- A zero reversal_of records an operation that reverses none, a zero
+-- counterpart_id one that is not a leg of a transfer, a zero import_id one
+-- that was not imported.
+INSERT INTO operations (wallet_id, operation_type, amount, reversal_of, counterpart_id, import_id, reference)
+VALUES (
+  @wallet_id, @operation_type, @amount,
+  NULLIF(@reversal_of::uuid, '00000000-0000-0000-0000-000000000000'),
+  NULLIF(@counterpart_id::uuid, '00000000-0000-0000-0000-000000000000'),
+  NULLIF(@import_id::uuid, '00000000-0000-0000-0000-000000000000'),
+  @reference
+)
+RETURNING *;
+
+-- name: SetOperationCounterpart :exec
+-- Links the first leg of a transfer to the second, which is created with
+-- the first as its counterpart.
+UPDATE operations SET counterpart_id = @counterpart_id WHERE id = @id;
+
+-- name: GetOperation :one
+SELECT * FROM operations WHERE id = $1;
+
+-- name: ReverseOperation :one
+-- Fails to match once the operation would be reversed by more than its
+-- amount.
+UPDATE operations
+SET reversed_amount = reversed_amount + @amount
+WHERE id = @id
+  AND reversed_amount + @amount <= abs(operations.amount::bigint)
+RETURNING *;
+
+-- name: GetWalletLedgerBalance :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS ledger_balance
+FROM operations
+WHERE wallet_id = $1;
+
+-- name: ListWalletLedgerPage :many
+SELECT
+  w.id,
+  (w.balance + COALESCE((SELECT SUM(s.balance) FROM wallet_shards s WHERE s.wallet_id = w.id), 0))::bigint AS balance,
+  COALESCE(SUM(o.amount), 0)::bigint AS ledger_balance
+FROM wallets w
+LEFT JOIN operations o ON o.wallet_id = w.id
+WHERE w.id > @after_id
+GROUP BY w.id
+ORDER BY w.id
+LIMIT @page_size;
+
+-- name: ListWalletOperations :many
+SELECT * FROM operations
+WHERE wallet_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: ListOperationsPage :many
+SELECT * FROM operations
+WHERE (created_at, id) > (@after_created_at::timestamptz, @after_id::uuid)
+  AND (@wallet_id::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = @wallet_id::uuid)
+ORDER BY created_at, id
+LIMIT @page_size;
+
+-- name: CreateOperations :copyfrom
+INSERT INTO operations (wallet_id, operation_type, amount)
+VALUES ($1, $2, $3);
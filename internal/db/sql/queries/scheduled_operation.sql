@@ -0,0 +1,49 @@
+-- name: CreateScheduledOperation :one
+INSERT INTO scheduled_operations (wallet_id, target_wallet_id, operation_type, amount, cron, next_run_at)
+VALUES (@wallet_id, NULLIF(@target_wallet_id::uuid, '00000000-0000-0000-0000-000000000000'), @operation_type, @amount, @cron, @next_run_at)
+RETURNING *;
+
+-- name: GetScheduledOperation :one
+SELECT * FROM scheduled_operations WHERE id = $1;
+
+-- name: ListScheduledOperations :many
+SELECT * FROM scheduled_operations
+WHERE id > @after_id
+  AND (@wallet_id::uuid = '00000000-0000-0000-0000-000000000000' OR wallet_id = @wallet_id::uuid OR target_wallet_id = @wallet_id::uuid)
+ORDER BY id
+LIMIT @page_size;
+
+-- name: UpdateScheduledOperation :one
+UPDATE scheduled_operations
+SET target_wallet_id = NULLIF(@target_wallet_id::uuid, '00000000-0000-0000-0000-000000000000'),
+    operation_type = @operation_type,
+    amount = @amount,
+    cron = @cron,
+    status = @status,
+    next_run_at = @next_run_at,
+    updated_at = now()
+WHERE id = @id
+RETURNING *;
+
+-- name: DeleteScheduledOperation :execrows
+DELETE FROM scheduled_operations WHERE id = $1;
+
+-- name: ClaimDueScheduledOperation :one
+-- Rows claimed by other schedulers are skipped, so each instance takes a
+-- different operation and none waits for another.
+SELECT * FROM scheduled_operations
+WHERE status = 'ACTIVE' AND next_run_at <= @now::timestamptz
+ORDER BY next_run_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: CreateScheduledOperationRun :one
+INSERT INTO scheduled_operation_runs (scheduled_operation_id, scheduled_for, status, error)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ListScheduledOperationRuns :many
+SELECT * FROM scheduled_operation_runs
+WHERE scheduled_operation_id = $1
+ORDER BY scheduled_for DESC
+LIMIT $2;
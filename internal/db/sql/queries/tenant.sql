@@ -0,0 +1,18 @@
+-- name: CreateTenant :one
+INSERT INTO tenants (name)
+VALUES ($1)
+RETURNING *;
+
+-- name: ListTenants :many
+SELECT * FROM tenants
+ORDER BY name;
+
+-- name: SetTenantKeyHash :one
+UPDATE tenants
+SET api_key_hash = @api_key_hash
+WHERE id = @id
+RETURNING *;
+
+-- name: GetTenantByKeyHash :one
+SELECT * FROM tenants
+WHERE api_key_hash = $1;
@@ -1,8 +1,83 @@
 -- name: GetWalletByID :one
 SELECT * FROM wallets WHERE id = $1;
 
+-- name: GetWalletByIDForUpdate :one
+SELECT * FROM wallets WHERE id = $1 FOR UPDATE;
+
+-- name: CreateWallet :one
+-- Empty fields take the column defaults.
+INSERT INTO wallets (currency, metadata, labels)
+VALUES (
+  COALESCE(NULLIF(@currency::text, ''), 'XXX'),
+  COALESCE(sqlc.narg('metadata')::jsonb, '{}'),
+  COALESCE(sqlc.narg('labels')::jsonb, '{}')
+)
+RETURNING *;
+
+-- name: ListWallets :many
+SELECT * FROM wallets
+WHERE id > @after_id
+ORDER BY id
+LIMIT @page_size;
+
 -- name: UpdateWallet :one
 UPDATE wallets 
 SET balance = balance + @amount
+WHERE id = @id
+  AND status = 'ACTIVE'
+  AND shard_count = 0
+  AND (@amount >= 0 OR balance + @amount >= 0)
+RETURNING *;
+
+-- name: SetWalletBalance :one
+UPDATE wallets
+SET balance = @balance
+WHERE id = @id
+RETURNING *;
+
+-- name: SetWalletShardCount :one
+UPDATE wallets
+SET shard_count = @shard_count
+WHERE id = @id
+RETURNING *;
+
+-- name: SetWalletStatus :one
+UPDATE wallets
+SET status = @status
+WHERE id = @id
+RETURNING *;
+
+-- name: MarkSystemWallet :one
+UPDATE wallets
+SET is_system = true
+WHERE id = $1
+RETURNING *;
+
+-- name: SetWalletOwner :one
+-- A zero owner_id clears the owner.
+UPDATE wallets
+SET owner_id = NULLIF(@owner_id::uuid, '00000000-0000-0000-0000-000000000000')
+WHERE id = @id
+RETURNING *;
+
+-- name: SetWalletProduct :one
+-- A zero product_id clears the product.
+UPDATE wallets
+SET product_id = NULLIF(@product_id::uuid, '00000000-0000-0000-0000-000000000000')
+WHERE id = @id
+RETURNING *;
+
+-- name: ListOwnerWallets :many
+SELECT * FROM wallets
+WHERE owner_id = @owner_id
+  AND id > @after_id
+ORDER BY id
+LIMIT @page_size;
+
+-- name: SetWalletDetails :one
+-- A NULL field is left as it is.
+UPDATE wallets
+SET metadata = COALESCE(sqlc.narg('metadata')::jsonb, metadata),
+    labels = COALESCE(sqlc.narg('labels')::jsonb, labels)
 WHERE id = @id
 RETURNING *;
@@ -0,0 +1,137 @@
+-- The wallet search has one query per sort key and direction. With the
+-- order and the cursor spelled out, the index on (key, id) returns the page
+-- in order and starts at the cursor: a CASE in ORDER BY or in the cursor
+-- condition hides the key from the planner and makes it sort every match.
+-- TestStore_SearchWallets_UsesIndex checks the plans.
+--
+-- Empty filters match everything. labels_match are labels a wallet must
+-- have, labels_not labels it must not have, labels_has and labels_missing
+-- keys it must have and must not have with any value. The page starts after
+-- the wallet after_id, or at the first wallet without one; sorted by
+-- balance or creation time, a cursor that does not exist matches nothing.
+-- Status and currency are filters on top of the order, so a search by them
+-- reads the sort index, not theirs.
+
+-- name: SearchWalletsByID :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND id > @after_id::uuid
+ORDER BY id
+LIMIT @page_size;
+
+-- name: SearchWalletsByIDDesc :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND id < COALESCE(NULLIF(@after_id::uuid, '00000000-0000-0000-0000-000000000000'::uuid), 'ffffffff-ffff-ffff-ffff-ffffffffffff'::uuid)
+ORDER BY id DESC
+LIMIT @page_size;
+
+-- name: SearchWalletsByBalance :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND (balance, id) > (
+    SELECT w.balance, w.id FROM wallets w WHERE w.id = @after_id::uuid
+    UNION ALL
+    SELECT (-2147483648)::integer, '00000000-0000-0000-0000-000000000000'::uuid WHERE @after_id::uuid = '00000000-0000-0000-0000-000000000000'::uuid
+  )
+ORDER BY balance, id
+LIMIT @page_size;
+
+-- name: SearchWalletsByBalanceDesc :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND (balance, id) < (
+    SELECT w.balance, w.id FROM wallets w WHERE w.id = @after_id::uuid
+    UNION ALL
+    SELECT 2147483647, 'ffffffff-ffff-ffff-ffff-ffffffffffff'::uuid WHERE @after_id::uuid = '00000000-0000-0000-0000-000000000000'::uuid
+  )
+ORDER BY balance DESC, id DESC
+LIMIT @page_size;
+
+-- name: SearchWalletsByCreatedAt :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND (created_at, id) > (
+    SELECT w.created_at, w.id FROM wallets w WHERE w.id = @after_id::uuid
+    UNION ALL
+    SELECT '-infinity'::timestamptz, '00000000-0000-0000-0000-000000000000'::uuid WHERE @after_id::uuid = '00000000-0000-0000-0000-000000000000'::uuid
+  )
+ORDER BY created_at, id
+LIMIT @page_size;
+
+-- name: SearchWalletsByCreatedAtDesc :many
+SELECT * FROM wallets
+WHERE (@status::text = '' OR status = @status::text)
+  AND (@currency::text = '' OR currency = @currency::text)
+  AND labels @> COALESCE(sqlc.narg('labels_match')::jsonb, '{}')
+  AND NOT EXISTS (
+    SELECT 1 FROM jsonb_each_text(COALESCE(sqlc.narg('labels_not')::jsonb, '{}')) l
+    WHERE labels ->> l.key = l.value
+  )
+  AND labels ?& COALESCE(@labels_has::text[], '{}')
+  AND NOT labels ?| COALESCE(@labels_missing::text[], '{}')
+  AND balance BETWEEN @min_balance::integer AND @max_balance::integer
+  AND created_at >= @created_from::timestamptz
+  AND created_at < @created_to::timestamptz
+  AND (created_at, id) < (
+    SELECT w.created_at, w.id FROM wallets w WHERE w.id = @after_id::uuid
+    UNION ALL
+    SELECT 'infinity'::timestamptz, 'ffffffff-ffff-ffff-ffff-ffffffffffff'::uuid WHERE @after_id::uuid = '00000000-0000-0000-0000-000000000000'::uuid
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT @page_size;
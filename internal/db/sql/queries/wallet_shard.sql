@@ -0,0 +1,50 @@
+-- name: CreditWalletShard :execrows
+UPDATE wallet_shards s
+SET balance = s.balance + @amount
+FROM wallets w
+WHERE s.wallet_id = @wallet_id
+  AND s.shard_id = @shard_id
+  AND w.id = s.wallet_id
+  AND w.status = 'ACTIVE';
+
+-- name: SumWalletShards :one
+SELECT
+  COALESCE(SUM(balance), 0)::bigint AS balance,
+  COALESCE(SUM(version), 0)::bigint AS version
+FROM wallet_shards
+WHERE wallet_id = $1;
+
+-- name: GetWalletWithShards :one
+-- One statement, so the wallet and its shards come from the same snapshot
+-- and a concurrent fold is counted exactly once.
+SELECT
+  sqlc.embed(w),
+  COALESCE(SUM(s.balance), 0)::bigint AS shards_balance,
+  COALESCE(SUM(s.version), 0)::bigint AS shards_version
+FROM wallets w
+LEFT JOIN wallet_shards s ON s.wallet_id = w.id
+WHERE w.id = $1
+GROUP BY w.id;
+
+-- name: LockWalletShards :one
+SELECT COALESCE(SUM(balance), 0)::bigint AS shards_balance
+FROM (
+  SELECT balance FROM wallet_shards
+  WHERE wallet_id = $1
+  ORDER BY shard_id
+  FOR UPDATE
+) locked;
+
+-- name: ResetWalletShards :exec
+UPDATE wallet_shards
+SET balance = 0
+WHERE wallet_id = $1 AND balance <> 0;
+
+-- name: DeleteWalletShards :exec
+DELETE FROM wallet_shards WHERE wallet_id = $1;
+
+-- name: CreateWalletShards :exec
+INSERT INTO wallet_shards (wallet_id, shard_id)
+SELECT w.id, generate_series(0, w.shard_count - 1)
+FROM wallets w
+WHERE w.id = $1;
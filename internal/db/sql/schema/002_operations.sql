@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS operations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  operation_type TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS operations_wallet_id_created_at_idx ON operations (wallet_id, created_at);
+
+-- Balances that existed before operations were recorded get an opening entry
+-- so the ledger matches wallets.balance from the start.
+INSERT INTO operations (wallet_id, operation_type, amount)
+SELECT id, 'ADJUSTMENT', balance FROM wallets WHERE balance <> 0;
+
+-- +goose Down
+DROP TABLE IF EXISTS operations;
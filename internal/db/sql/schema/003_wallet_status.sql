@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE wallets
+  ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'FROZEN')),
+  ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE wallets
+  DROP COLUMN IF EXISTS status,
+  DROP COLUMN IF EXISTS created_at;
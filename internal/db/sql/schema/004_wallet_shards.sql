@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE wallets
+  ADD COLUMN IF NOT EXISTS shard_count INTEGER NOT NULL DEFAULT 0 CHECK (shard_count >= 0);
+
+-- Credits to a sharded wallet land on one of its shards instead of the
+-- wallets row; the wallet balance is wallets.balance plus all shard balances.
+CREATE TABLE IF NOT EXISTS wallet_shards (
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  shard_id INTEGER NOT NULL,
+  balance INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (wallet_id, shard_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS wallet_shards;
+
+ALTER TABLE wallets
+  DROP COLUMN IF EXISTS shard_count;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Every balance, status or shard change publishes the wallet ID on the
+-- wallet_changed channel, so API instances can drop their cached copy.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_wallet_changed() RETURNS trigger AS $$
+BEGIN
+  IF TG_TABLE_NAME = 'wallet_shards' THEN
+    PERFORM pg_notify('wallet_changed', NEW.wallet_id::text);
+  ELSIF TG_OP = 'DELETE' THEN
+    PERFORM pg_notify('wallet_changed', OLD.id::text);
+  ELSE
+    PERFORM pg_notify('wallet_changed', NEW.id::text);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER wallets_notify_changed
+  AFTER UPDATE OF balance, status, shard_count OR DELETE ON wallets
+  FOR EACH ROW EXECUTE FUNCTION notify_wallet_changed();
+
+CREATE TRIGGER wallet_shards_notify_changed
+  AFTER UPDATE OF balance ON wallet_shards
+  FOR EACH ROW EXECUTE FUNCTION notify_wallet_changed();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS wallet_shards_notify_changed ON wallet_shards;
+DROP TRIGGER IF EXISTS wallets_notify_changed ON wallets;
+DROP FUNCTION IF EXISTS notify_wallet_changed();
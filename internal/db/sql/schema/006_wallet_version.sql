@@ -0,0 +1,70 @@
+-- +goose Up
+-- A wallet's version is wallets.version plus the versions of its shards, so
+-- credits to a shard never touch the wallets row. Every change of balance,
+-- status or shard count moves it forward.
+ALTER TABLE wallets
+  ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE wallet_shards
+  ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wallets_bump_version() RETURNS trigger AS $$
+BEGIN
+  IF NEW.balance IS DISTINCT FROM OLD.balance
+    OR NEW.status IS DISTINCT FROM OLD.status
+    OR NEW.shard_count IS DISTINCT FROM OLD.shard_count THEN
+    NEW.version := OLD.version + 1;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wallet_shards_bump_version() RETURNS trigger AS $$
+BEGIN
+  IF NEW.balance IS DISTINCT FROM OLD.balance THEN
+    NEW.version := OLD.version + 1;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Deleted shards hand their versions over to the wallet, so its version
+-- never goes back.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION wallet_shards_fold_version() RETURNS trigger AS $$
+BEGIN
+  UPDATE wallets SET version = version + OLD.version WHERE id = OLD.wallet_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER wallets_bump_version
+  BEFORE UPDATE ON wallets
+  FOR EACH ROW EXECUTE FUNCTION wallets_bump_version();
+
+CREATE TRIGGER wallet_shards_bump_version
+  BEFORE UPDATE ON wallet_shards
+  FOR EACH ROW EXECUTE FUNCTION wallet_shards_bump_version();
+
+CREATE TRIGGER wallet_shards_fold_version
+  BEFORE DELETE ON wallet_shards
+  FOR EACH ROW EXECUTE FUNCTION wallet_shards_fold_version();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS wallet_shards_fold_version ON wallet_shards;
+DROP TRIGGER IF EXISTS wallet_shards_bump_version ON wallet_shards;
+DROP TRIGGER IF EXISTS wallets_bump_version ON wallets;
+DROP FUNCTION IF EXISTS wallet_shards_fold_version();
+DROP FUNCTION IF EXISTS wallet_shards_bump_version();
+DROP FUNCTION IF EXISTS wallets_bump_version();
+
+ALTER TABLE wallet_shards
+  DROP COLUMN IF EXISTS version;
+
+ALTER TABLE wallets
+  DROP COLUMN IF EXISTS version;
@@ -0,0 +1,41 @@
+-- +goose Up
+-- A scheduled operation runs once at next_run_at or, with a cron schedule,
+-- again at every following time the schedule matches. Transfers move the
+-- amount from wallet_id to target_wallet_id.
+CREATE TABLE IF NOT EXISTS scheduled_operations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  target_wallet_id UUID REFERENCES wallets (id) ON DELETE CASCADE,
+  operation_type TEXT NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER')),
+  amount INTEGER NOT NULL CHECK (amount > 0),
+  cron TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'PAUSED', 'DONE')),
+  next_run_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((operation_type = 'TRANSFER') = (target_wallet_id IS NOT NULL)),
+  CHECK (target_wallet_id <> wallet_id)
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_operations_due_idx ON scheduled_operations (next_run_at) WHERE status = 'ACTIVE';
+CREATE INDEX IF NOT EXISTS scheduled_operations_wallet_id_idx ON scheduled_operations (wallet_id);
+-- Deleting a wallet cascades to the transfers scheduled to it, and the list
+-- of a wallet's scheduled operations includes them; both look them up by
+-- target_wallet_id.
+CREATE INDEX IF NOT EXISTS scheduled_operations_target_wallet_id_idx ON scheduled_operations (target_wallet_id);
+
+-- One row per execution. The unique key makes a second execution of the
+-- same occurrence fail even if two schedulers ever claimed it.
+CREATE TABLE IF NOT EXISTS scheduled_operation_runs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  scheduled_operation_id UUID NOT NULL REFERENCES scheduled_operations (id) ON DELETE CASCADE,
+  scheduled_for TIMESTAMPTZ NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('SUCCEEDED', 'FAILED')),
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (scheduled_operation_id, scheduled_for)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS scheduled_operation_runs;
+DROP TABLE IF EXISTS scheduled_operations;
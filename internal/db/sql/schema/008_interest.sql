@@ -0,0 +1,70 @@
+-- +goose Up
+-- Interest products bundle an annual rate, in basis points, with the
+-- day-count convention and rounding mode used to accrue it.
+CREATE TABLE IF NOT EXISTS interest_products (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE CHECK (name <> ''),
+  annual_rate_bps INTEGER NOT NULL CHECK (annual_rate_bps BETWEEN 0 AND 100000),
+  day_count TEXT NOT NULL DEFAULT 'ACT/365' CHECK (day_count IN ('ACT/365', 'ACT/360', 'ACT/ACT')),
+  rounding TEXT NOT NULL DEFAULT 'HALF_EVEN' CHECK (rounding IN ('HALF_UP', 'HALF_EVEN', 'DOWN')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- A wallet earns interest from the day it is enrolled, at its own rate when
+-- annual_rate_bps is set and at the rate of its product otherwise.
+CREATE TABLE IF NOT EXISTS wallet_interest (
+  wallet_id UUID PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+  product_id UUID REFERENCES interest_products (id),
+  annual_rate_bps INTEGER CHECK (annual_rate_bps BETWEEN 0 AND 100000),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (product_id IS NOT NULL OR annual_rate_bps IS NOT NULL)
+);
+
+-- The terms each enrolled wallet accrues at. Empty conventions mean the
+-- wallet has no product and uses the service defaults.
+CREATE OR REPLACE VIEW wallet_interest_terms AS
+SELECT
+  wi.wallet_id,
+  wi.created_at,
+  COALESCE(wi.annual_rate_bps, p.annual_rate_bps) AS annual_rate_bps,
+  COALESCE(p.day_count, '') AS day_count,
+  COALESCE(p.rounding, '') AS rounding
+FROM wallet_interest wi
+LEFT JOIN interest_products p ON p.id = wi.product_id;
+
+-- One row per wallet and day, so accruing a day twice is a no-op. Amounts
+-- are in millionths of a balance unit; the terms used are kept for audits.
+CREATE TABLE IF NOT EXISTS interest_accruals (
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  accrual_date DATE NOT NULL,
+  balance BIGINT NOT NULL,
+  annual_rate_bps INTEGER NOT NULL,
+  day_count TEXT NOT NULL,
+  amount_micros BIGINT NOT NULL,
+  paid BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (wallet_id, accrual_date)
+);
+
+CREATE INDEX IF NOT EXISTS interest_accruals_unpaid_idx ON interest_accruals (accrual_date) WHERE NOT paid;
+
+-- One row per wallet and month paid. carry_micros is the rounding remainder
+-- moved into the next payout.
+CREATE TABLE IF NOT EXISTS interest_payouts (
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  period DATE NOT NULL CHECK (extract(day FROM period) = 1),
+  accrued_micros BIGINT NOT NULL,
+  amount INTEGER NOT NULL CHECK (amount >= 0),
+  carry_micros BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (wallet_id, period)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS interest_payouts;
+DROP TABLE IF EXISTS interest_accruals;
+DROP VIEW IF EXISTS wallet_interest_terms;
+DROP TABLE IF EXISTS wallet_interest;
+DROP TABLE IF EXISTS interest_products;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- A fee schedule prices one operation type, for the wallets of one product
+-- or, without a product, for all other wallets. Fees are in balance units:
+-- FLAT charges flat_amount, PERCENTAGE charges rate_bps of the amount and
+-- TIERED charges flat_amount plus rate_bps of the tier the amount falls in.
+-- The result is clamped to min_fee and, unless it is zero, max_fee.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  operation_type TEXT NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER')),
+  product_id UUID REFERENCES interest_products (id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('FLAT', 'PERCENTAGE', 'TIERED')),
+  flat_amount INTEGER NOT NULL DEFAULT 0 CHECK (flat_amount >= 0),
+  rate_bps INTEGER NOT NULL DEFAULT 0 CHECK (rate_bps BETWEEN 0 AND 10000),
+  min_fee INTEGER NOT NULL DEFAULT 0 CHECK (min_fee >= 0),
+  max_fee INTEGER NOT NULL DEFAULT 0 CHECK (max_fee >= 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE NULLS NOT DISTINCT (operation_type, product_id),
+  CHECK (max_fee = 0 OR max_fee >= min_fee)
+);
+
+-- A tier applies to amounts from min_amount up to the next tier.
+CREATE TABLE IF NOT EXISTS fee_tiers (
+  schedule_id UUID NOT NULL REFERENCES fee_schedules (id) ON DELETE CASCADE,
+  min_amount INTEGER NOT NULL CHECK (min_amount >= 0),
+  flat_amount INTEGER NOT NULL DEFAULT 0 CHECK (flat_amount >= 0),
+  rate_bps INTEGER NOT NULL DEFAULT 0 CHECK (rate_bps BETWEEN 0 AND 10000),
+  PRIMARY KEY (schedule_id, min_amount)
+);
+
+-- The product a wallet is sold as. The fee schedules of the product apply
+-- to it.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS product_id UUID REFERENCES interest_products (id);
+
+-- Fees are credited to this system wallet. Its shards spread the credits,
+-- so charging fees does not serialize all operations on one row.
+INSERT INTO wallets (id, shard_count)
+VALUES ('fee00000-0000-4000-8000-000000000000', 16)
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO wallet_shards (wallet_id, shard_id)
+SELECT 'fee00000-0000-4000-8000-000000000000', generate_series(0, 15)
+ON CONFLICT (wallet_id, shard_id) DO NOTHING;
+
+-- +goose Down
+-- The fee wallet is kept: it holds the fees collected so far.
+DROP TABLE IF EXISTS fee_tiers;
+DROP TABLE IF EXISTS fee_schedules;
+ALTER TABLE wallets DROP COLUMN IF EXISTS product_id;
@@ -0,0 +1,50 @@
+-- +goose Up
+-- An import applies the rows of an uploaded CSV. Without skip_invalid a
+-- single invalid row rejects the whole import; with it only the valid rows
+-- are applied. file_hash identifies the rows: a file is imported once,
+-- unless its import was rejected.
+CREATE TABLE IF NOT EXISTS imports (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  status TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPLIED', 'REJECTED')),
+  skip_invalid BOOLEAN NOT NULL,
+  total_rows INTEGER NOT NULL CHECK (total_rows >= 0),
+  applied_rows INTEGER NOT NULL DEFAULT 0,
+  failed_rows INTEGER NOT NULL DEFAULT 0,
+  file_hash TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS imports_file_hash_key ON imports (file_hash) WHERE status <> 'REJECTED';
+
+-- Recovery looks for imports left pending by a crash.
+CREATE INDEX IF NOT EXISTS imports_pending_idx ON imports (updated_at) WHERE status = 'PENDING';
+
+-- import_rows stages the rows with COPY. error is empty for a valid row.
+-- wallet_id has no foreign key: rows of unknown wallets are staged and
+-- reported like any other invalid row.
+CREATE TABLE IF NOT EXISTS import_rows (
+  import_id UUID NOT NULL REFERENCES imports (id) ON DELETE CASCADE,
+  row_number INTEGER NOT NULL,
+  wallet_id UUID NOT NULL,
+  operation_type TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  reference TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (import_id, row_number)
+);
+
+-- An imported operation keeps the import it came from and the reference of
+-- its row.
+ALTER TABLE operations
+  ADD COLUMN IF NOT EXISTS import_id UUID REFERENCES imports (id),
+  ADD COLUMN IF NOT EXISTS reference TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS operations_import_id_idx ON operations (import_id) WHERE import_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE operations
+  DROP COLUMN IF EXISTS reference,
+  DROP COLUMN IF EXISTS import_id;
+DROP TABLE IF EXISTS import_rows;
+DROP TABLE IF EXISTS imports;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- audit_log records who changed a wallet and how. before and after hold the
+-- wallet state around the change. wallet_id has no foreign key, so the log
+-- does not depend on the wallet it describes.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  actor TEXT NOT NULL,
+  action TEXT NOT NULL,
+  wallet_id UUID NOT NULL,
+  before JSONB NOT NULL,
+  after JSONB NOT NULL,
+  request_id TEXT NOT NULL DEFAULT '',
+  source_ip TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at, id);
+CREATE INDEX IF NOT EXISTS audit_log_wallet_id_idx ON audit_log (wallet_id, created_at, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, created_at, id);
+
+-- The log is append-only.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only' USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_immutable
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_immutable();
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_immutable();
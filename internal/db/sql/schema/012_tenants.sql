@@ -0,0 +1,158 @@
+-- +goose Up
+-- A tenant is a brand sharing the deployment. Every wallet belongs to one;
+-- wallets that existed before tenants belong to the default tenant.
+-- Requests authenticate with the API key of their tenant. Only its SHA-256
+-- is kept; a tenant without a key cannot call the API until one is issued.
+CREATE TABLE IF NOT EXISTS tenants (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE,
+  api_key_hash TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tenants_api_key_hash_key ON tenants (api_key_hash) WHERE api_key_hash IS NOT NULL;
+
+INSERT INTO tenants (id, name)
+VALUES ('defa0000-0000-4000-8000-000000000000', 'default')
+ON CONFLICT (id) DO NOTHING;
+
+-- current_tenant is the tenant a request runs for, or NULL for the service
+-- itself: schedulers, interest and the command line see every tenant.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION current_tenant() RETURNS UUID AS $$
+  SELECT NULLIF(current_setting('app.tenant_id', true), '')::uuid
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- New wallets belong to the tenant creating them. owner_id is the client of
+-- the tenant the wallet belongs to; the service does not interpret it. A
+-- system wallet, such as the fee wallet, belongs to the service: no tenant
+-- sees it or moves money in or out of it. The service marks the fee wallet
+-- it is configured with on start.
+ALTER TABLE wallets
+  ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL
+    DEFAULT COALESCE(current_tenant(), 'defa0000-0000-4000-8000-000000000000')
+    REFERENCES tenants (id),
+  ADD COLUMN IF NOT EXISTS owner_id UUID,
+  ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS wallets_owner_id_idx ON wallets (owner_id, id);
+
+UPDATE wallets SET is_system = true WHERE id = 'fee00000-0000-4000-8000-000000000000';
+
+-- Imports belong to the tenant uploading them, and the same file may be
+-- imported once by each tenant.
+ALTER TABLE imports
+  ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL
+    DEFAULT COALESCE(current_tenant(), 'defa0000-0000-4000-8000-000000000000')
+    REFERENCES tenants (id);
+
+DROP INDEX IF EXISTS imports_file_hash_key;
+CREATE UNIQUE INDEX IF NOT EXISTS imports_file_hash_key ON imports (tenant_id, file_hash) WHERE status <> 'REJECTED';
+
+-- Requests switch to this role, which row-level security applies to even
+-- when the service connects as a superuser or as the owner of the tables.
+-- +goose StatementBegin
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'wallet_tenant') THEN
+    CREATE ROLE wallet_tenant NOLOGIN;
+  END IF;
+END
+$$;
+-- +goose StatementEnd
+
+GRANT wallet_tenant TO CURRENT_USER;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO wallet_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO wallet_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO wallet_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO wallet_tenant;
+
+-- A tenant sees its own wallets, but no system wallet, its own imports and
+-- the rows that belong to them. Products and fee schedules are shared by all
+-- tenants.
+ALTER TABLE wallets ENABLE ROW LEVEL SECURITY;
+CREATE POLICY wallets_tenant ON wallets
+  USING (current_tenant() IS NULL OR (tenant_id = current_tenant() AND NOT is_system));
+
+ALTER TABLE imports ENABLE ROW LEVEL SECURITY;
+CREATE POLICY imports_tenant ON imports
+  USING (current_tenant() IS NULL OR tenant_id = current_tenant());
+
+-- import_rows has no policy, since COPY FROM does not support row-level
+-- security. Its rows are only read and written for an import found first.
+
+ALTER TABLE wallet_shards ENABLE ROW LEVEL SECURITY;
+CREATE POLICY wallet_shards_tenant ON wallet_shards
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE operations ENABLE ROW LEVEL SECURITY;
+CREATE POLICY operations_tenant ON operations
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE scheduled_operations ENABLE ROW LEVEL SECURITY;
+CREATE POLICY scheduled_operations_tenant ON scheduled_operations
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE scheduled_operation_runs ENABLE ROW LEVEL SECURITY;
+CREATE POLICY scheduled_operation_runs_tenant ON scheduled_operation_runs
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM scheduled_operations o WHERE o.id = scheduled_operation_id));
+
+ALTER TABLE wallet_interest ENABLE ROW LEVEL SECURITY;
+CREATE POLICY wallet_interest_tenant ON wallet_interest
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE interest_accruals ENABLE ROW LEVEL SECURITY;
+CREATE POLICY interest_accruals_tenant ON interest_accruals
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE interest_payouts ENABLE ROW LEVEL SECURITY;
+CREATE POLICY interest_payouts_tenant ON interest_payouts
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+CREATE POLICY audit_log_tenant ON audit_log
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = wallet_id));
+
+-- Views bypass row-level security unless they run as the caller.
+ALTER VIEW wallet_interest_terms SET (security_invoker = true);
+
+-- +goose Down
+ALTER VIEW wallet_interest_terms RESET (security_invoker);
+
+DROP POLICY IF EXISTS audit_log_tenant ON audit_log;
+ALTER TABLE audit_log DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS interest_payouts_tenant ON interest_payouts;
+ALTER TABLE interest_payouts DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS interest_accruals_tenant ON interest_accruals;
+ALTER TABLE interest_accruals DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS wallet_interest_tenant ON wallet_interest;
+ALTER TABLE wallet_interest DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS scheduled_operation_runs_tenant ON scheduled_operation_runs;
+ALTER TABLE scheduled_operation_runs DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS scheduled_operations_tenant ON scheduled_operations;
+ALTER TABLE scheduled_operations DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS operations_tenant ON operations;
+ALTER TABLE operations DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS wallet_shards_tenant ON wallet_shards;
+ALTER TABLE wallet_shards DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS imports_tenant ON imports;
+ALTER TABLE imports DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS wallets_tenant ON wallets;
+ALTER TABLE wallets DISABLE ROW LEVEL SECURITY;
+
+-- The role is shared by the databases of the cluster; only its privileges
+-- here are revoked.
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON SEQUENCES FROM wallet_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON TABLES FROM wallet_tenant;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM wallet_tenant;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM wallet_tenant;
+
+DROP INDEX IF EXISTS imports_file_hash_key;
+ALTER TABLE imports DROP COLUMN IF EXISTS tenant_id;
+CREATE UNIQUE INDEX IF NOT EXISTS imports_file_hash_key ON imports (file_hash) WHERE status <> 'REJECTED';
+
+DROP INDEX IF EXISTS wallets_owner_id_idx;
+ALTER TABLE wallets DROP COLUMN IF EXISTS is_system, DROP COLUMN IF EXISTS owner_id, DROP COLUMN IF EXISTS tenant_id;
+DROP FUNCTION IF EXISTS current_tenant();
+DROP TABLE IF EXISTS tenants;
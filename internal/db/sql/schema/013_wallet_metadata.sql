@@ -0,0 +1,34 @@
+-- +goose Up
+-- currency is an ISO 4217 code; XXX, "no currency", is kept by the wallets
+-- that existed before currencies. metadata is free-form and never looked
+-- into; labels are string key/value pairs that wallets are searched by.
+ALTER TABLE wallets
+  ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'XXX'
+    CONSTRAINT wallets_currency_check CHECK (currency ~ '^[A-Z]{3}$'),
+  ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'
+    CONSTRAINT wallets_metadata_check CHECK (jsonb_typeof(metadata) = 'object'),
+  ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'
+    CONSTRAINT wallets_labels_check CHECK (
+      jsonb_typeof(labels) = 'object'
+      AND NOT jsonb_path_exists(labels, '$.* ? (@.type() != "string")')
+    );
+
+-- Searches filter by any of these and page through wallets ordered by id,
+-- balance or creation time.
+CREATE INDEX IF NOT EXISTS wallets_labels_idx ON wallets USING GIN (labels);
+CREATE INDEX IF NOT EXISTS wallets_status_idx ON wallets (status, id);
+CREATE INDEX IF NOT EXISTS wallets_currency_idx ON wallets (currency, id);
+CREATE INDEX IF NOT EXISTS wallets_balance_idx ON wallets (balance, id);
+CREATE INDEX IF NOT EXISTS wallets_created_at_idx ON wallets (created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS wallets_created_at_idx;
+DROP INDEX IF EXISTS wallets_balance_idx;
+DROP INDEX IF EXISTS wallets_currency_idx;
+DROP INDEX IF EXISTS wallets_status_idx;
+DROP INDEX IF EXISTS wallets_labels_idx;
+
+ALTER TABLE wallets
+  DROP COLUMN IF EXISTS labels,
+  DROP COLUMN IF EXISTS metadata,
+  DROP COLUMN IF EXISTS currency;
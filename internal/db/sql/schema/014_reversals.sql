@@ -0,0 +1,23 @@
+-- +goose Up
+-- A reversal is a REVERSAL operation on the wallet of the operation it
+-- reverses, for the opposite sign of all or part of its amount.
+-- reversed_amount is how much of an operation has been reversed so far;
+-- the check keeps it from being reversed more than once over.
+--
+-- A transfer is recorded as two TRANSFER operations, one on each wallet,
+-- each naming the other as its counterpart, so that a reversal of either
+-- finds the other.
+ALTER TABLE operations
+  ADD COLUMN IF NOT EXISTS reversal_of UUID REFERENCES operations (id),
+  ADD COLUMN IF NOT EXISTS reversed_amount INTEGER NOT NULL DEFAULT 0
+    CONSTRAINT operations_reversed_amount_check CHECK (reversed_amount BETWEEN 0 AND abs(amount::bigint)),
+  ADD COLUMN IF NOT EXISTS counterpart_id UUID REFERENCES operations (id);
+
+CREATE INDEX IF NOT EXISTS operations_reversal_of_idx ON operations (reversal_of) WHERE reversal_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS operations_reversal_of_idx;
+ALTER TABLE operations
+  DROP COLUMN IF EXISTS counterpart_id,
+  DROP COLUMN IF EXISTS reversed_amount,
+  DROP COLUMN IF EXISTS reversal_of;
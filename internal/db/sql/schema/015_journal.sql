@@ -0,0 +1,57 @@
+-- +goose Up
+-- The journal books every balance change as an entry of legs whose debits
+-- and credits are equal. A leg is booked on a wallet or on a system
+-- account: cash_in is money received by deposits, cash_out money paid out
+-- by withdrawals, fees clears the fees charged to wallets into the fee
+-- wallet, interest is the expense of interest payouts, and adjustments and
+-- opening are the counterparts of corrections, imports included, and of the
+-- balances that existed before the journal. A wallet is
+-- credited with what it receives, so its credits less its debits are its
+-- balance. Every leg is in a currency, and an entry balances in each
+-- currency it has legs in: a wallet leg is in the currency of its wallet,
+-- and a leg of a system account in the currency of the wallet it is booked
+-- against.
+CREATE TABLE IF NOT EXISTS journal_entries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  description TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS journal_legs (
+  entry_id UUID NOT NULL REFERENCES journal_entries (id),
+  leg INTEGER NOT NULL,
+  account TEXT NOT NULL
+    CONSTRAINT journal_legs_account_check CHECK (account IN ('wallet', 'cash_in', 'cash_out', 'fees', 'adjustments', 'interest', 'opening')),
+  wallet_id UUID REFERENCES wallets (id),
+  currency TEXT NOT NULL CONSTRAINT journal_legs_currency_check CHECK (currency ~ '^[A-Z]{3}$'),
+  debit INTEGER NOT NULL DEFAULT 0,
+  credit INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (entry_id, leg),
+  CONSTRAINT journal_legs_wallet_check CHECK ((account = 'wallet') = (wallet_id IS NOT NULL)),
+  CONSTRAINT journal_legs_amount_check CHECK (debit >= 0 AND credit >= 0 AND (debit = 0) <> (credit = 0))
+);
+
+CREATE INDEX IF NOT EXISTS journal_legs_wallet_id_idx ON journal_legs (wallet_id) WHERE wallet_id IS NOT NULL;
+
+-- Balances that existed before the journal are booked against opening.
+WITH opening AS MATERIALIZED (
+  SELECT
+    gen_random_uuid() AS entry_id,
+    w.id AS wallet_id,
+    w.currency,
+    w.balance + COALESCE((SELECT SUM(s.balance) FROM wallet_shards s WHERE s.wallet_id = w.id), 0) AS balance
+  FROM wallets w
+), entries AS (
+  INSERT INTO journal_entries (id, description)
+  SELECT entry_id, 'OPENING' FROM opening WHERE balance <> 0
+)
+INSERT INTO journal_legs (entry_id, leg, account, wallet_id, currency, debit, credit)
+SELECT entry_id, 1, 'opening', NULL, currency, GREATEST(balance, 0), GREATEST(-balance, 0)
+FROM opening WHERE balance <> 0
+UNION ALL
+SELECT entry_id, 2, 'wallet', wallet_id, currency, GREATEST(-balance, 0), GREATEST(balance, 0)
+FROM opening WHERE balance <> 0;
+
+-- +goose Down
+DROP TABLE IF EXISTS journal_legs;
+DROP TABLE IF EXISTS journal_entries;
@@ -0,0 +1,61 @@
+-- +goose Up
+-- A rate converts balance units of base_currency into rate_micros millionths
+-- of a balance unit of quote_currency. It applies from effective_from until
+-- the next rate of the pair; source tells where it came from, such as the
+-- feed of a central bank. Rates are shared by all tenants.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  base_currency TEXT NOT NULL
+    CONSTRAINT exchange_rates_base_currency_check CHECK (base_currency ~ '^[A-Z]{3}$' AND base_currency <> 'XXX'),
+  quote_currency TEXT NOT NULL
+    CONSTRAINT exchange_rates_quote_currency_check CHECK (quote_currency ~ '^[A-Z]{3}$' AND quote_currency <> 'XXX'),
+  rate_micros BIGINT NOT NULL CONSTRAINT exchange_rates_rate_micros_check CHECK (rate_micros > 0),
+  effective_from TIMESTAMPTZ NOT NULL,
+  source TEXT NOT NULL CONSTRAINT exchange_rates_source_check CHECK (source <> ''),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT exchange_rates_pair_check CHECK (base_currency <> quote_currency),
+  CONSTRAINT exchange_rates_pair_key UNIQUE (base_currency, quote_currency, effective_from)
+);
+
+-- A quote holds a rate, less the spread, for a conversion until expires_at.
+-- Executing it records the two EXCHANGE operations, so every conversion
+-- keeps the rate it was made at.
+CREATE TABLE IF NOT EXISTS exchange_quotes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  from_wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  to_wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  rate_id UUID NOT NULL REFERENCES exchange_rates (id),
+  from_currency TEXT NOT NULL,
+  to_currency TEXT NOT NULL,
+  rate_micros BIGINT NOT NULL,
+  spread_bps INTEGER NOT NULL CONSTRAINT exchange_quotes_spread_bps_check CHECK (spread_bps BETWEEN 0 AND 10000),
+  rounding TEXT NOT NULL CONSTRAINT exchange_quotes_rounding_check CHECK (rounding IN ('HALF_UP', 'HALF_EVEN', 'DOWN')),
+  amount INTEGER NOT NULL CONSTRAINT exchange_quotes_amount_check CHECK (amount > 0),
+  converted_amount INTEGER NOT NULL CONSTRAINT exchange_quotes_converted_amount_check CHECK (converted_amount > 0),
+  expires_at TIMESTAMPTZ NOT NULL,
+  from_operation_id UUID REFERENCES operations (id),
+  to_operation_id UUID REFERENCES operations (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT exchange_quotes_executed_check CHECK ((from_operation_id IS NULL) = (to_operation_id IS NULL))
+);
+
+ALTER TABLE exchange_quotes ENABLE ROW LEVEL SECURITY;
+CREATE POLICY exchange_quotes_tenant ON exchange_quotes
+  USING (current_tenant() IS NULL OR EXISTS (SELECT 1 FROM wallets w WHERE w.id = from_wallet_id));
+
+-- A conversion is booked through the exchange account, once in each
+-- currency.
+ALTER TABLE journal_legs
+  DROP CONSTRAINT journal_legs_account_check,
+  ADD CONSTRAINT journal_legs_account_check
+    CHECK (account IN ('wallet', 'cash_in', 'cash_out', 'fees', 'adjustments', 'interest', 'opening', 'exchange'));
+
+-- +goose Down
+-- Fails while the journal has exchange legs.
+ALTER TABLE journal_legs
+  DROP CONSTRAINT journal_legs_account_check,
+  ADD CONSTRAINT journal_legs_account_check
+    CHECK (account IN ('wallet', 'cash_in', 'cash_out', 'fees', 'adjustments', 'interest', 'opening'));
+
+DROP TABLE IF EXISTS exchange_quotes;
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Store is the Postgres implementation of service.WalletRepositoryInterface.
+// Reads outside a transaction are served by a replica when one is fresh
+// enough, see ReadAfter.
+type Store struct {
+	*repository.Queries
+	db txBeginner
+
+	primary  *pgxpool.Pool
+	replicas []*Replica
+	next     *atomic.Uint32
+}
+
+// NewStore returns a store on pools opened by Connect, which set the
+// tenant of each connection.
+func NewStore(pool *pgxpool.Pool, replicas ...*Replica) *Store {
+	return &Store{
+		Queries:  repository.New(tenantPool{pool}),
+		db:       tenantPool{pool},
+		primary:  pool,
+		replicas: replicas,
+		next:     new(atomic.Uint32),
+	}
+}
+
+// ExecTx runs fn inside a transaction and commits it if fn returns nil.
+// Calling ExecTx on the store passed to fn opens a savepoint.
+func (s *Store) ExecTx(ctx context.Context, fn func(repo service.WalletRepositoryInterface) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Everything in a transaction, reads included, goes to the primary.
+	if err := fn(&Store{Queries: repository.New(tx), db: tx}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ExecSnapshot runs fn inside a read-only REPEATABLE READ transaction, so
+// every read of fn sees the same snapshot. Inside a transaction fn shares it.
+func (s *Store) ExecSnapshot(ctx context.Context, fn func(repo service.WalletRepositoryInterface) error) error {
+	if s.primary == nil {
+		return fn(s)
+	}
+
+	tx, err := tenantPool{s.primary}.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&Store{Queries: repository.New(tx), db: tx}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsistencyToken returns the current WAL position of the primary. Passed
+// back to ReadAfter, it keeps later reads from missing the writes committed
+// so far.
+func (s *Store) ConsistencyToken(ctx context.Context) (string, error) {
+	var lsn string
+	err := s.primary.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn)
+	return lsn, err
+}
+
+// ReadAfter makes reads under the returned context use only replicas that
+// have replayed the position of a token from ConsistencyToken.
+func (s *Store) ReadAfter(ctx context.Context, token string) (context.Context, error) {
+	lsn, err := ParseLSN(token)
+	if err != nil {
+		return nil, err
+	}
+	return service.Consistent(context.WithValue(ctx, readAfterKey{}, lsn)), nil
+}
+
+// reader picks queries for a read: a fresh replica, taken round-robin, or
+// the primary if none is or ctx asks for it.
+func (s *Store) reader(ctx context.Context) *repository.Queries {
+	if service.ReadsPrimary(ctx) {
+		return s.Queries
+	}
+
+	lsn := readAfter(ctx)
+
+	for range s.replicas {
+		r := s.replicas[int(s.next.Add(1))%len(s.replicas)]
+		if r.fresh(lsn) {
+			return r.queries
+		}
+	}
+
+	return s.Queries
+}
+
+func (s *Store) GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	return s.reader(ctx).GetWalletByID(ctx, id)
+}
+
+func (s *Store) ListWallets(ctx context.Context, arg repository.ListWalletsParams) ([]repository.Wallet, error) {
+	return s.reader(ctx).ListWallets(ctx, arg)
+}
+
+// SearchWallets runs the query of the sort key and direction of arg, whose
+// order an index can serve.
+func (s *Store) SearchWallets(ctx context.Context, arg service.SearchWalletsParams) ([]repository.Wallet, error) {
+	q := s.reader(ctx)
+
+	// The queries differ only in order, so their parameters convert.
+	filter := repository.SearchWalletsByIDParams{
+		Status:        arg.Status,
+		Currency:      arg.Currency,
+		LabelsMatch:   arg.LabelsMatch,
+		LabelsNot:     arg.LabelsNot,
+		LabelsHas:     arg.LabelsHas,
+		LabelsMissing: arg.LabelsMissing,
+		MinBalance:    arg.MinBalance,
+		MaxBalance:    arg.MaxBalance,
+		CreatedFrom:   arg.CreatedFrom,
+		CreatedTo:     arg.CreatedTo,
+		AfterID:       arg.AfterID,
+		PageSize:      arg.PageSize,
+	}
+
+	switch arg.SortBy {
+	case service.SortByBalance:
+		if arg.Descending {
+			return q.SearchWalletsByBalanceDesc(ctx, repository.SearchWalletsByBalanceDescParams(filter))
+		}
+		return q.SearchWalletsByBalance(ctx, repository.SearchWalletsByBalanceParams(filter))
+	case service.SortByCreatedAt:
+		if arg.Descending {
+			return q.SearchWalletsByCreatedAtDesc(ctx, repository.SearchWalletsByCreatedAtDescParams(filter))
+		}
+		return q.SearchWalletsByCreatedAt(ctx, repository.SearchWalletsByCreatedAtParams(filter))
+	default:
+		if arg.Descending {
+			return q.SearchWalletsByIDDesc(ctx, repository.SearchWalletsByIDDescParams(filter))
+		}
+		return q.SearchWalletsByID(ctx, filter)
+	}
+}
+
+func (s *Store) SumWalletShards(ctx context.Context, walletID uuid.UUID) (repository.SumWalletShardsRow, error) {
+	return s.reader(ctx).SumWalletShards(ctx, walletID)
+}
+
+func (s *Store) GetWalletWithShards(ctx context.Context, id uuid.UUID) (repository.GetWalletWithShardsRow, error) {
+	return s.reader(ctx).GetWalletWithShards(ctx, id)
+}
+
+func (s *Store) ListWalletOperations(ctx context.Context, arg repository.ListWalletOperationsParams) ([]repository.Operation, error) {
+	return s.reader(ctx).ListWalletOperations(ctx, arg)
+}
+
+func (s *Store) ListOperationsPage(ctx context.Context, arg repository.ListOperationsPageParams) ([]repository.Operation, error) {
+	return s.reader(ctx).ListOperationsPage(ctx, arg)
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStore migrates the database behind TEST_DATABASE_URL and returns a
+// store connected to it.
+func newTestStore(tb testing.TB) *Store {
+	tb.Helper()
+
+	url := testDatabaseURL(tb)
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("pgx", url)
+	require.NoError(tb, err)
+	defer sqlDB.Close()
+
+	migrator, err := newMigrator(sqlDB, false)
+	require.NoError(tb, err)
+	require.NoError(tb, migrator.Up(ctx))
+
+	pool, err := newPool(url)
+	require.NoError(tb, err)
+	tb.Cleanup(pool.Close)
+
+	return NewStore(pool)
+}
+
+// Concurrent deposits into a single wallet: with neither batching nor shards
+// every deposit waits for the row lock held by the previous transaction.
+func benchmarkHotWallet(b *testing.B, shards int32, opts ...service.Option) {
+	walletService := service.NewWalletService(newTestStore(b), opts...)
+
+	wallet, err := walletService.CreateWallet(context.Background(), 0)
+	require.NoError(b, err)
+
+	if shards > 0 {
+		_, err = walletService.SetWalletShards(context.Background(), wallet.ID, shards)
+		require.NoError(b, err)
+	}
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := walletService.TopUpWalletBalance(context.Background(), wallet.ID, 1); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkStore_HotWallet_Direct(b *testing.B) {
+	benchmarkHotWallet(b, 0)
+}
+
+func BenchmarkStore_HotWallet_Batched(b *testing.B) {
+	benchmarkHotWallet(b, 0, service.WithBatching(100))
+}
+
+func BenchmarkStore_HotWallet_Sharded(b *testing.B) {
+	benchmarkHotWallet(b, 16)
+}
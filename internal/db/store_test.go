@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repotest"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	repotest.Run(t, newTestStore(t))
+}
+
+func TestStore_TenantPerConnection(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	tenant := uuid.New()
+
+	setting := func(ctx context.Context) (string, string) {
+		t.Helper()
+
+		var role, setting string
+		require.NoError(t, store.primary.QueryRow(ctx,
+			"SELECT current_user, current_setting('app.tenant_id', true)").Scan(&role, &setting))
+		return role, setting
+	}
+
+	for range 2 {
+		role, got := setting(service.WithTenant(ctx, tenant))
+		assert.Equal(t, tenantRole, role)
+		assert.Equal(t, tenant.String(), got)
+	}
+
+	role, got := setting(ctx)
+	assert.NotEqual(t, tenantRole, role, "a statement without a tenant sees every row")
+	assert.Empty(t, got)
+
+	other := uuid.New()
+	role, got = setting(service.WithTenant(ctx, other))
+	assert.Equal(t, tenantRole, role)
+	assert.Equal(t, other.String(), got)
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// Tenant isolation is enforced by the row-level security policies of the
+// tenants migration. They apply to the wallet_tenant role and read the tenant
+// from app.tenant_id. The pool sets both on a connection when it is acquired
+// for a context of another tenant than its last; transactions set them
+// locally when a statement changes tenant. Statements without a tenant run
+// as the connecting user, which sees every row.
+const (
+	setTenantSQL        = "SELECT set_config('role', $1, true), set_config('app.tenant_id', $2, true)"
+	setSessionTenantSQL = "SELECT set_config('role', $1, false), set_config('app.tenant_id', $2, false)"
+)
+
+const tenantRole = "wallet_tenant"
+
+// tenantSetting is the value of app.tenant_id for ctx, empty without a tenant.
+func tenantSetting(ctx context.Context) string {
+	tenant, ok := service.TenantFrom(ctx)
+	if !ok {
+		return ""
+	}
+	return tenant.String()
+}
+
+// tenantRoleFor is the role that statements with setting run as.
+func tenantRoleFor(setting string) string {
+	if setting == "" {
+		return "none"
+	}
+	return tenantRole
+}
+
+// withTenantHooks makes the pool of cfg set the tenant of the acquiring
+// context on each connection. Every pool that a Store uses needs them.
+func withTenantHooks(cfg *pgxpool.Config) *pgxpool.Config {
+	// applied holds the session setting of each open connection.
+	var applied sync.Map
+
+	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		want := tenantSetting(ctx)
+		if setting, ok := applied.Load(conn); ok && setting == want {
+			return true
+		}
+
+		applied.Delete(conn)
+		if _, err := conn.Exec(ctx, setSessionTenantSQL, tenantRoleFor(want), want); err != nil {
+			// The pool closes the connection and acquires another.
+			return false
+		}
+
+		applied.Store(conn, want)
+		return true
+	}
+	cfg.BeforeClose = func(conn *pgx.Conn) {
+		applied.Delete(conn)
+	}
+
+	return cfg
+}
+
+// tenantPool hands out transactions that follow the tenant of each
+// statement.
+type tenantPool struct {
+	*pgxpool.Pool
+}
+
+func (p tenantPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return p.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// BeginTx begins on a connection that the pool set to the tenant of ctx.
+func (p tenantPool) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	tx, err := p.Pool.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := tenantSetting(ctx)
+	return &tenantTx{Tx: tx, applied: &applied}, nil
+}
+
+// tenantTx sets the tenant of each statement before running it, unless the
+// transaction already has it. applied is the setting in effect, nil when a
+// rolled back savepoint left it unknown.
+type tenantTx struct {
+	pgx.Tx
+	applied *string
+	parent  *tenantTx
+}
+
+func (t *tenantTx) apply(ctx context.Context) error {
+	want := tenantSetting(ctx)
+	if t.applied != nil && *t.applied == want {
+		return nil
+	}
+
+	t.applied = nil
+	if _, err := t.Tx.Exec(ctx, setTenantSQL, tenantRoleFor(want), want); err != nil {
+		return err
+	}
+
+	t.applied = &want
+	return nil
+}
+
+// Begin opens a savepoint. Settings made inside it are undone with it.
+func (t *tenantTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	sp, err := t.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantTx{Tx: sp, applied: t.applied, parent: t}, nil
+}
+
+func (t *tenantTx) Commit(ctx context.Context) error {
+	err := t.Tx.Commit(ctx)
+	if err == nil && t.parent != nil {
+		t.parent.applied = t.applied
+	}
+	return err
+}
+
+func (t *tenantTx) Rollback(ctx context.Context) error {
+	err := t.Tx.Rollback(ctx)
+	if err == nil && t.parent != nil {
+		t.parent.applied = nil
+	}
+	return err
+}
+
+func (t *tenantTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := t.apply(ctx); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return t.Tx.Exec(ctx, sql, args...)
+}
+
+func (t *tenantTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := t.apply(ctx); err != nil {
+		return nil, err
+	}
+	return t.Tx.Query(ctx, sql, args...)
+}
+
+func (t *tenantTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := t.apply(ctx); err != nil {
+		return errRow{err}
+	}
+	return t.Tx.QueryRow(ctx, sql, args...)
+}
+
+func (t *tenantTx) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	if err := t.apply(ctx); err != nil {
+		return 0, err
+	}
+	return t.Tx.CopyFrom(ctx, table, columns, src)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
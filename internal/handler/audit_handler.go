@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type AuditHandler struct {
+	service service.AuditServiceInterface
+}
+
+func NewAuditHandler(service service.AuditServiceInterface) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// ListAuditEntries returns audit entries oldest first. actor and walletId
+// narrow them down; from and to bound their time like a statement period,
+// from defaulting to the beginning and to to now. afterId is the last entry
+// of the previous page.
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	filter := service.AuditFilter{
+		Actor: c.Query("actor"),
+		To:    time.Now(),
+	}
+
+	var err error
+	if value := c.Query("walletId"); value != "" {
+		if filter.WalletID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid wallet ID"))
+			return
+		}
+	}
+
+	if value := c.Query("afterId"); value != "" {
+		if filter.AfterID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid afterId"))
+			return
+		}
+	}
+
+	if value := c.Query("from"); value != "" {
+		if filter.From, err = parseStatementTime(value); err != nil {
+			abort(c, invalidParameter("Invalid from"))
+			return
+		}
+	}
+
+	if value := c.Query("to"); value != "" {
+		if filter.To, err = parseStatementTime(value); err != nil {
+			abort(c, invalidParameter("Invalid to"))
+			return
+		}
+	}
+
+	var ok bool
+	if filter.Limit, ok = pageSize(c); !ok {
+		return
+	}
+
+	entries, err := h.service.ListAuditEntries(c, filter)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(entries))
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockAuditService struct {
+	mock.Mock
+}
+
+func (m *MockAuditService) ListAuditEntries(ctx context.Context, filter service.AuditFilter) ([]service.AuditEntry, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]service.AuditEntry), args.Error(1)
+}
+
+func setupAuditRouter(mockService *MockAuditService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAuditHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.GET("/audit", handler.ListAuditEntries)
+
+	return r
+}
+
+func TestAuditHandler_ListAuditEntries(t *testing.T) {
+	mockService := new(MockAuditService)
+	router := setupAuditRouter(mockService)
+
+	walletID, afterID := uuid.New(), uuid.New()
+	entry := service.AuditEntry{
+		ID:       uuid.New(),
+		Actor:    "admin",
+		Action:   "BALANCE_CHANGE",
+		WalletID: walletID,
+		Before:   service.AuditState{Balance: 100, Status: "ACTIVE"},
+		After:    service.AuditState{Balance: 150, Status: "ACTIVE"},
+	}
+	mockService.On("ListAuditEntries", mock.Anything, service.AuditFilter{
+		Actor:    "admin",
+		WalletID: walletID,
+		From:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		AfterID:  afterID,
+		Limit:    5,
+	}).Return([]service.AuditEntry{entry}, nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/audit?actor=admin&walletId=%s&from=2026-01-01&to=2026-02-01T00:00:00Z&afterId=%s&limit=5", walletID, afterID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response []service.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []service.AuditEntry{entry}, response)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestAuditHandler_ListAuditEntries_Defaults(t *testing.T) {
+	mockService := new(MockAuditService)
+	router := setupAuditRouter(mockService)
+
+	before := time.Now()
+	mockService.On("ListAuditEntries", mock.Anything, mock.MatchedBy(func(f service.AuditFilter) bool {
+		return f.Actor == "" && f.WalletID == uuid.Nil && f.From.IsZero() && !f.To.Before(before) && f.Limit == defaultPageSize
+	})).Return([]service.AuditEntry(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestAuditHandler_ListAuditEntries_BadRequest(t *testing.T) {
+	testCases := []struct {
+		query string
+		error string
+	}{
+		{"?walletId=wallet", "Invalid wallet ID"},
+		{"?afterId=entry", "Invalid afterId"},
+		{"?from=yesterday", "Invalid from"},
+		{"?to=2026-13-01", "Invalid to"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockAuditService)
+		router := setupAuditRouter(mockService)
+
+		req, _ := http.NewRequest("GET", "/api/v1/audit"+tc.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.error, assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail, tc.query)
+		mockService.AssertNotCalled(t, "ListAuditEntries", mock.Anything, mock.Anything)
+	}
+}
+
+func TestAuditHandler_ListAuditEntries_InvalidPeriod(t *testing.T) {
+	mockService := new(MockAuditService)
+	router := setupAuditRouter(mockService)
+
+	mockService.On("ListAuditEntries", mock.Anything, mock.Anything).
+		Return([]service.AuditEntry(nil), fmt.Errorf("%w: from must be before to", service.ErrInvalidAuditFilter))
+
+	req, _ := http.NewRequest("GET", "/api/v1/audit?from=2026-02-01&to=2026-01-01", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "invalid audit filter: from must be before to", assertProblem(t, w, http.StatusBadRequest, "INVALID_AUDIT_FILTER").Detail)
+}
+
+func TestAuditHandler_ListAuditEntries_Error(t *testing.T) {
+	mockService := new(MockAuditService)
+	router := setupAuditRouter(mockService)
+
+	mockService.On("ListAuditEntries", mock.Anything, mock.Anything).Return([]service.AuditEntry(nil), errors.New("database error"))
+
+	req, _ := http.NewRequest("GET", "/api/v1/audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
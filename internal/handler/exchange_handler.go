@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type ExchangeHandler struct {
+	service service.ExchangeServiceInterface
+}
+
+func NewExchangeHandler(service service.ExchangeServiceInterface) *ExchangeHandler {
+	return &ExchangeHandler{
+		service: service,
+	}
+}
+
+// ExchangeRateRequest adds a rate of a currency pair. RateMicros is how many
+// millionths of a quote currency unit one base currency unit buys; without
+// EffectiveFrom the rate applies from now.
+type ExchangeRateRequest struct {
+	BaseCurrency  string    `json:"baseCurrency" binding:"required"`
+	QuoteCurrency string    `json:"quoteCurrency" binding:"required"`
+	RateMicros    int64     `json:"rateMicros" binding:"required"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	Source        string    `json:"source" binding:"required"`
+}
+
+type ExchangeQuoteRequest struct {
+	FromWalletID string `json:"fromWalletId" binding:"required"`
+	ToWalletID   string `json:"toWalletId" binding:"required"`
+	Amount       int32  `json:"amount" binding:"required"`
+}
+
+func (h *ExchangeHandler) CreateExchangeRate(c *gin.Context) {
+	var req ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	rate, err := h.service.CreateExchangeRate(c, service.ExchangeRateParams{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		RateMicros:    req.RateMicros,
+		EffectiveFrom: req.EffectiveFrom,
+		Source:        req.Source,
+	})
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// ListExchangeRates filters by ?base=&quote=, newest rates of a pair first.
+func (h *ExchangeHandler) ListExchangeRates(c *gin.Context) {
+	limit, ok := pageSize(c)
+	if !ok {
+		return
+	}
+
+	rates, err := h.service.ListExchangeRates(c, c.Query("base"), c.Query("quote"), limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(rates))
+}
+
+func (h *ExchangeHandler) QuoteExchange(c *gin.Context) {
+	var req ExchangeQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	fromID, err := uuid.Parse(req.FromWalletID)
+	if err != nil {
+		abort(c, invalidParameter("Invalid source wallet ID"))
+		return
+	}
+	toID, err := uuid.Parse(req.ToWalletID)
+	if err != nil {
+		abort(c, invalidParameter("Invalid target wallet ID"))
+		return
+	}
+
+	quote, err := h.service.QuoteExchange(c, fromID, toID, req.Amount)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, quote)
+}
+
+func (h *ExchangeHandler) ExecuteExchange(c *gin.Context) {
+	quoteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid quote ID"))
+		return
+	}
+
+	exchange, err := h.service.ExecuteExchange(auditContext(c), quoteID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exchange)
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockExchangeService struct {
+	mock.Mock
+}
+
+func (m *MockExchangeService) CreateExchangeRate(ctx context.Context, p service.ExchangeRateParams) (repository.ExchangeRate, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).(repository.ExchangeRate), args.Error(1)
+}
+
+func (m *MockExchangeService) ListExchangeRates(ctx context.Context, baseCurrency, quoteCurrency string, limit int32) ([]repository.ExchangeRate, error) {
+	args := m.Called(ctx, baseCurrency, quoteCurrency, limit)
+	return args.Get(0).([]repository.ExchangeRate), args.Error(1)
+}
+
+func (m *MockExchangeService) QuoteExchange(ctx context.Context, fromID, toID uuid.UUID, amount int32) (repository.ExchangeQuote, error) {
+	args := m.Called(ctx, fromID, toID, amount)
+	return args.Get(0).(repository.ExchangeQuote), args.Error(1)
+}
+
+func (m *MockExchangeService) ExecuteExchange(ctx context.Context, quoteID uuid.UUID) (service.Exchange, error) {
+	args := m.Called(ctx, quoteID)
+	return args.Get(0).(service.Exchange), args.Error(1)
+}
+
+func setupExchangeRouter(mockService *MockExchangeService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewExchangeHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.POST("/exchange-rates", handler.CreateExchangeRate)
+	v1.GET("/exchange-rates", handler.ListExchangeRates)
+	v1.POST("/exchange/quotes", handler.QuoteExchange)
+	v1.POST("/exchange/quotes/:id/execute", handler.ExecuteExchange)
+
+	return r
+}
+
+func TestExchangeHandler_CreateExchangeRate(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	effectiveFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := repository.ExchangeRate{ID: uuid.New(), BaseCurrency: "USD", QuoteCurrency: "EUR", RateMicros: 920000}
+	mockService.On("CreateExchangeRate", mock.Anything, service.ExchangeRateParams{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "EUR",
+		RateMicros:    920000,
+		EffectiveFrom: effectiveFrom,
+		Source:        "ECB",
+	}).Return(created, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/exchange-rates", gin.H{
+		"baseCurrency":  "USD",
+		"quoteCurrency": "EUR",
+		"rateMicros":    920000,
+		"effectiveFrom": effectiveFrom,
+		"source":        "ECB",
+	}))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response repository.ExchangeRate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestExchangeHandler_CreateExchangeRate_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{fmt.Errorf("%w: rate must be positive", service.ErrInvalidExchangeRate), http.StatusBadRequest, "INVALID_EXCHANGE_RATE"},
+		{service.ErrExchangeRateExists, http.StatusConflict, "EXCHANGE_RATE_EXISTS"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockExchangeService)
+		router := setupExchangeRouter(mockService)
+
+		mockService.On("CreateExchangeRate", mock.Anything, mock.Anything).Return(repository.ExchangeRate{}, tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/exchange-rates", gin.H{"baseCurrency": "USD", "quoteCurrency": "EUR", "rateMicros": 1, "source": "ECB"}))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestExchangeHandler_ListExchangeRates(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	mockService.On("ListExchangeRates", mock.Anything, "USD", "", int32(5)).Return([]repository.ExchangeRate(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/exchange-rates?base=USD&limit=5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestExchangeHandler_QuoteExchange(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	fromID, toID := uuid.New(), uuid.New()
+	quote := repository.ExchangeQuote{ID: uuid.New(), FromWalletID: fromID, ToWalletID: toID, Amount: 1000, ConvertedAmount: 915}
+	mockService.On("QuoteExchange", mock.Anything, fromID, toID, int32(1000)).Return(quote, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/exchange/quotes", gin.H{
+		"fromWalletId": fromID.String(),
+		"toWalletId":   toID.String(),
+		"amount":       1000,
+	}))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response repository.ExchangeQuote
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, quote.ID, response.ID)
+	assert.Equal(t, int32(915), response.ConvertedAmount)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestExchangeHandler_QuoteExchange_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{fmt.Errorf("%w: wallets have the same currency", service.ErrInvalidExchange), http.StatusBadRequest, "INVALID_EXCHANGE"},
+		{service.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND"},
+		{fmt.Errorf("%w: no rate from USD to JPY", service.ErrExchangeRateNotFound), http.StatusUnprocessableEntity, "EXCHANGE_RATE_NOT_FOUND"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockExchangeService)
+		router := setupExchangeRouter(mockService)
+
+		mockService.On("QuoteExchange", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(repository.ExchangeQuote{}, tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/exchange/quotes", gin.H{
+			"fromWalletId": uuid.NewString(),
+			"toWalletId":   uuid.NewString(),
+			"amount":       10,
+		}))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestExchangeHandler_QuoteExchange_InvalidWalletID(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/exchange/quotes", gin.H{
+		"fromWalletId": uuid.NewString(),
+		"toWalletId":   "euros",
+		"amount":       10,
+	}))
+
+	assert.Equal(t, "Invalid target wallet ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+	mockService.AssertNotCalled(t, "QuoteExchange", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestExchangeHandler_ExecuteExchange(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	quoteID := uuid.New()
+	mockService.On("ExecuteExchange", mock.Anything, quoteID).Return(service.Exchange{
+		Quote: repository.ExchangeQuote{ID: quoteID, FromOperationID: uuid.New(), ToOperationID: uuid.New()},
+		From:  repository.Wallet{Balance: 500},
+		To:    repository.Wallet{Balance: 925},
+	}, nil)
+
+	req, _ := http.NewRequest("POST", "/api/v1/exchange/quotes/"+quoteID.String()+"/execute", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response service.Exchange
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, quoteID, response.Quote.ID)
+	assert.Equal(t, int32(925), response.To.Balance)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestExchangeHandler_ExecuteExchange_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{service.ErrExchangeQuoteNotFound, http.StatusNotFound, "EXCHANGE_QUOTE_NOT_FOUND"},
+		{service.ErrExchangeQuoteExecuted, http.StatusConflict, "EXCHANGE_QUOTE_EXECUTED"},
+		{service.ErrWalletFrozen, http.StatusConflict, "WALLET_FROZEN"},
+		{service.ErrExchangeQuoteExpired, http.StatusGone, "EXCHANGE_QUOTE_EXPIRED"},
+		{service.ErrInsufficientFunds, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockExchangeService)
+		router := setupExchangeRouter(mockService)
+
+		mockService.On("ExecuteExchange", mock.Anything, mock.Anything).Return(service.Exchange{}, tc.err)
+
+		req, _ := http.NewRequest("POST", "/api/v1/exchange/quotes/"+uuid.NewString()+"/execute", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestExchangeHandler_ExecuteExchange_InvalidID(t *testing.T) {
+	mockService := new(MockExchangeService)
+	router := setupExchangeRouter(mockService)
+
+	req, _ := http.NewRequest("POST", "/api/v1/exchange/quotes/latest/execute", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Invalid quote ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+	mockService.AssertNotCalled(t, "ExecuteExchange", mock.Anything, mock.Anything)
+}
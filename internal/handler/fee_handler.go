@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type FeeHandler struct {
+	service service.FeeServiceInterface
+}
+
+func NewFeeHandler(service service.FeeServiceInterface) *FeeHandler {
+	return &FeeHandler{
+		service: service,
+	}
+}
+
+type FeeTierRequest struct {
+	MinAmount  int32 `json:"minAmount"`
+	FlatAmount int32 `json:"flatAmount"`
+	RateBps    int32 `json:"rateBps"`
+}
+
+// FeeScheduleRequest creates or replaces a schedule. Without a product it is
+// the default schedule of the operation type.
+type FeeScheduleRequest struct {
+	OperationType models.OperationType `json:"operationType" binding:"required"`
+	ProductID     string               `json:"productId"`
+	Kind          models.FeeKind       `json:"kind" binding:"required"`
+	FlatAmount    int32                `json:"flatAmount"`
+	RateBps       int32                `json:"rateBps"`
+	MinFee        int32                `json:"minFee"`
+	MaxFee        int32                `json:"maxFee"`
+	Tiers         []FeeTierRequest     `json:"tiers"`
+}
+
+func (r FeeScheduleRequest) params() (service.FeeScheduleParams, error) {
+	p := service.FeeScheduleParams{
+		OperationType: r.OperationType,
+		Kind:          r.Kind,
+		FlatAmount:    r.FlatAmount,
+		RateBps:       r.RateBps,
+		MinFee:        r.MinFee,
+		MaxFee:        r.MaxFee,
+	}
+
+	if r.ProductID != "" {
+		var err error
+		if p.ProductID, err = uuid.Parse(r.ProductID); err != nil {
+			return service.FeeScheduleParams{}, err
+		}
+	}
+
+	for _, t := range r.Tiers {
+		p.Tiers = append(p.Tiers, service.FeeTierParams{
+			MinAmount:  t.MinAmount,
+			FlatAmount: t.FlatAmount,
+			RateBps:    t.RateBps,
+		})
+	}
+
+	return p, nil
+}
+
+func (h *FeeHandler) CreateFeeSchedule(c *gin.Context) {
+	p, ok := bindFeeSchedule(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.CreateFeeSchedule(c, p)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (h *FeeHandler) ListFeeSchedules(c *gin.Context) {
+	schedules, err := h.service.ListFeeSchedules(c)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(schedules))
+}
+
+func (h *FeeHandler) GetFeeSchedule(c *gin.Context) {
+	id, ok := feeScheduleID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.GetFeeSchedule(c, id)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *FeeHandler) UpdateFeeSchedule(c *gin.Context) {
+	id, ok := feeScheduleID(c)
+	if !ok {
+		return
+	}
+
+	p, ok := bindFeeSchedule(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.UpdateFeeSchedule(c, id, p)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *FeeHandler) DeleteFeeSchedule(c *gin.Context) {
+	id, ok := feeScheduleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteFeeSchedule(c, id); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// QuoteFee previews the fee of an operation without performing it. The
+// amount is positive for every operation type.
+func (h *FeeHandler) QuoteFee(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Query("walletId"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return
+	}
+
+	amount, err := strconv.ParseInt(c.Query("amount"), 10, 32)
+	if err != nil {
+		abort(c, invalidParameter("Invalid amount"))
+		return
+	}
+
+	quote, err := h.service.QuoteFee(c, walletID, models.OperationType(c.Query("operationType")), int32(amount))
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+func bindFeeSchedule(c *gin.Context) (service.FeeScheduleParams, bool) {
+	var req FeeScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return service.FeeScheduleParams{}, false
+	}
+
+	p, err := req.params()
+	if err != nil {
+		abort(c, invalidParameter("Invalid product ID"))
+		return service.FeeScheduleParams{}, false
+	}
+
+	return p, true
+}
+
+func feeScheduleID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid fee schedule ID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockFeeService struct {
+	mock.Mock
+}
+
+func (m *MockFeeService) CreateFeeSchedule(ctx context.Context, p service.FeeScheduleParams) (service.FeeSchedule, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).(service.FeeSchedule), args.Error(1)
+}
+
+func (m *MockFeeService) GetFeeSchedule(ctx context.Context, id uuid.UUID) (service.FeeSchedule, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(service.FeeSchedule), args.Error(1)
+}
+
+func (m *MockFeeService) ListFeeSchedules(ctx context.Context) ([]service.FeeSchedule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]service.FeeSchedule), args.Error(1)
+}
+
+func (m *MockFeeService) UpdateFeeSchedule(ctx context.Context, id uuid.UUID, p service.FeeScheduleParams) (service.FeeSchedule, error) {
+	args := m.Called(ctx, id, p)
+	return args.Get(0).(service.FeeSchedule), args.Error(1)
+}
+
+func (m *MockFeeService) DeleteFeeSchedule(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockFeeService) QuoteFee(ctx context.Context, walletID uuid.UUID, opType models.OperationType, amount int32) (service.FeeQuote, error) {
+	args := m.Called(ctx, walletID, opType, amount)
+	return args.Get(0).(service.FeeQuote), args.Error(1)
+}
+
+func setupFeeRouter(mockService *MockFeeService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewFeeHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.POST("/fee-schedules", handler.CreateFeeSchedule)
+	v1.GET("/fee-schedules", handler.ListFeeSchedules)
+	v1.GET("/fee-schedules/:id", handler.GetFeeSchedule)
+	v1.PUT("/fee-schedules/:id", handler.UpdateFeeSchedule)
+	v1.DELETE("/fee-schedules/:id", handler.DeleteFeeSchedule)
+	v1.GET("/fees/quote", handler.QuoteFee)
+
+	return r
+}
+
+func TestFeeHandler_CreateFeeSchedule(t *testing.T) {
+	mockService := new(MockFeeService)
+	router := setupFeeRouter(mockService)
+
+	productID := uuid.New()
+	created := service.FeeSchedule{
+		FeeSchedule: repository.FeeSchedule{ID: uuid.New(), Kind: string(models.FeeKindTiered)},
+		Tiers:       []repository.FeeTier{{MinAmount: 100, RateBps: 50}},
+	}
+	mockService.On("CreateFeeSchedule", mock.Anything, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		ProductID:     productID,
+		Kind:          models.FeeKindTiered,
+		MaxFee:        30,
+		Tiers:         []service.FeeTierParams{{MinAmount: 100, RateBps: 50}},
+	}).Return(created, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/fee-schedules", gin.H{
+		"operationType": "WITHDRAW",
+		"productId":     productID.String(),
+		"kind":          "TIERED",
+		"maxFee":        30,
+		"tiers":         []gin.H{{"minAmount": 100, "rateBps": 50}},
+	}))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response service.FeeSchedule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+	assert.Len(t, response.Tiers, 1)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestFeeHandler_CreateFeeSchedule_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{fmt.Errorf("%w: a flat fee has no rate or tiers", service.ErrInvalidFeeSchedule), http.StatusBadRequest, "INVALID_FEE_SCHEDULE"},
+		{service.ErrInterestProductNotFound, http.StatusNotFound, "INTEREST_PRODUCT_NOT_FOUND"},
+		{service.ErrFeeScheduleExists, http.StatusConflict, "FEE_SCHEDULE_EXISTS"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockFeeService)
+		router := setupFeeRouter(mockService)
+
+		mockService.On("CreateFeeSchedule", mock.Anything, mock.Anything).Return(service.FeeSchedule{}, tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/fee-schedules", gin.H{"operationType": "DEPOSIT", "kind": "FLAT", "rateBps": 1}))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestFeeHandler_CreateFeeSchedule_InvalidProductID(t *testing.T) {
+	mockService := new(MockFeeService)
+	router := setupFeeRouter(mockService)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/fee-schedules", gin.H{"operationType": "DEPOSIT", "kind": "FLAT", "productId": "premium"}))
+
+	assert.Equal(t, "Invalid product ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+	mockService.AssertNotCalled(t, "CreateFeeSchedule", mock.Anything, mock.Anything)
+}
+
+func TestFeeHandler_DeleteFeeSchedule_NotFound(t *testing.T) {
+	mockService := new(MockFeeService)
+	router := setupFeeRouter(mockService)
+
+	id := uuid.New()
+	mockService.On("DeleteFeeSchedule", mock.Anything, id).Return(service.ErrFeeScheduleNotFound)
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/fee-schedules/"+id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Fee schedule not found", assertProblem(t, w, http.StatusNotFound, "FEE_SCHEDULE_NOT_FOUND").Title)
+}
+
+func TestFeeHandler_QuoteFee(t *testing.T) {
+	mockService := new(MockFeeService)
+	router := setupFeeRouter(mockService)
+
+	walletID, scheduleID := uuid.New(), uuid.New()
+	mockService.On("QuoteFee", mock.Anything, walletID, models.OperationTransfer, int32(250)).Return(service.FeeQuote{
+		WalletID:      walletID,
+		OperationType: models.OperationTransfer,
+		Amount:        250,
+		Fee:           3,
+		ScheduleID:    scheduleID,
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/fees/quote?walletId="+walletID.String()+"&operationType=TRANSFER&amount=250", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response service.FeeQuote
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int32(3), response.Fee)
+	assert.Equal(t, scheduleID, response.ScheduleID)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestFeeHandler_QuoteFee_BadRequest(t *testing.T) {
+	walletID := uuid.New()
+
+	testCases := []struct {
+		query  string
+		detail string
+	}{
+		{"walletId=wallet&operationType=DEPOSIT&amount=1", "Invalid wallet ID"},
+		{"walletId=" + walletID.String() + "&operationType=DEPOSIT&amount=ten", "Invalid amount"},
+		{"walletId=" + walletID.String() + "&operationType=DEPOSIT", "Invalid amount"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockFeeService)
+		router := setupFeeRouter(mockService)
+
+		req, _ := http.NewRequest("GET", "/api/v1/fees/quote?"+tc.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.detail, assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail, tc.query)
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+const defaultImportMaxRows = 100000
+
+type ImportHandler struct {
+	service service.ImportServiceInterface
+	maxRows int
+}
+
+// NewImportHandler accepts files of at most maxRows rows, or of the default
+// limit if maxRows is not positive.
+func NewImportHandler(service service.ImportServiceInterface, maxRows int) *ImportHandler {
+	if maxRows <= 0 {
+		maxRows = defaultImportMaxRows
+	}
+
+	return &ImportHandler{
+		service: service,
+		maxRows: maxRows,
+	}
+}
+
+// CreateImport applies a CSV of operations, sent as the body or as the
+// "file" field of a multipart form. skipInvalid=true applies the valid rows
+// when others fail; by default any invalid row rejects the whole file. A
+// file already imported is refused with 409.
+func (h *ImportHandler) CreateImport(c *gin.Context) {
+	skipInvalid, err := strconv.ParseBool(c.DefaultQuery("skipInvalid", "false"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid skipInvalid"))
+		return
+	}
+
+	body := io.Reader(c.Request.Body)
+	if c.ContentType() == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			abort(c, invalidParameter("Missing file"))
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		defer file.Close()
+
+		body = file
+	}
+
+	rows, err := readImportRows(body, h.maxRows)
+	if err != nil {
+		abort(c, fmt.Errorf("%w: %w", service.ErrInvalidImport, err))
+		return
+	}
+
+	imp, err := h.service.CreateImport(auditContext(c), rows, skipInvalid)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, imp)
+}
+
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid import ID"))
+		return
+	}
+
+	imp, err := h.service.GetImport(c, id)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, imp)
+}
+
+// readImportRows reads a CSV with a header naming its columns: walletId,
+// operationType and amount, and optionally reference. A row whose fields
+// cannot be parsed keeps the reason in its Error, so that it is reported
+// like any other invalid row.
+func readImportRows(r io.Reader, maxRows int) ([]service.ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"walletId", "operationType", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var rows []service.ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf("more than %d rows", maxRows)
+		}
+
+		if errors.Is(err, csv.ErrFieldCount) {
+			rows = append(rows, service.ImportRow{Error: "wrong number of fields"})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		rows = append(rows, parseImportRow(record, columns))
+	}
+}
+
+func parseImportRow(record []string, columns map[string]int) service.ImportRow {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := service.ImportRow{
+		OperationType: models.OperationType(field("operationType")),
+		Reference:     field("reference"),
+	}
+
+	var err error
+	if row.WalletID, err = uuid.Parse(field("walletId")); err != nil {
+		row.Error = "invalid wallet ID"
+		return row
+	}
+
+	amount, err := strconv.ParseInt(field("amount"), 10, 32)
+	if err != nil {
+		row.Error = "invalid amount"
+		return row
+	}
+	row.Amount = int32(amount)
+
+	return row
+}
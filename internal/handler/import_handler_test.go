@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockImportService struct {
+	mock.Mock
+}
+
+func (m *MockImportService) CreateImport(ctx context.Context, rows []service.ImportRow, skipInvalid bool) (service.Import, error) {
+	args := m.Called(ctx, rows, skipInvalid)
+	return args.Get(0).(service.Import), args.Error(1)
+}
+
+func (m *MockImportService) GetImport(ctx context.Context, id uuid.UUID) (service.Import, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(service.Import), args.Error(1)
+}
+
+func setupImportRouter(mockService *MockImportService, maxRows int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewImportHandler(mockService, maxRows)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.POST("/imports", handler.CreateImport)
+	v1.GET("/imports/:id", handler.GetImport)
+
+	return r
+}
+
+func importRequest(query, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/api/v1/imports"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	return req
+}
+
+func TestImportHandler_CreateImport(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	walletID := uuid.New()
+	created := service.Import{
+		Import: repository.Import{ID: uuid.New(), Status: string(models.ImportStatusApplied), TotalRows: 5, AppliedRows: 2, FailedRows: 3},
+		Errors: []service.ImportRowError{{Row: 3, Error: "invalid wallet ID"}},
+	}
+	mockService.On("CreateImport", mock.Anything, []service.ImportRow{
+		{WalletID: walletID, OperationType: models.OperationDeposit, Amount: 100, Reference: "INV-1"},
+		{WalletID: walletID, OperationType: models.OperationAdjustment, Amount: -5},
+		{OperationType: models.OperationDeposit, Error: "invalid wallet ID"},
+		{WalletID: walletID, OperationType: models.OperationWithdraw, Error: "invalid amount"},
+		{Error: "wrong number of fields"},
+	}, true).Return(created, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest("?skipInvalid=true", fmt.Sprintf(
+		"operationType,walletId,amount,reference\n"+
+			"DEPOSIT,%[1]s,100,INV-1\n"+
+			"ADJUSTMENT, %[1]s ,-5,\n"+
+			"DEPOSIT,wallet,1,\n"+
+			"WITHDRAW,%[1]s,ten,\n"+
+			"DEPOSIT,%[1]s\n", walletID)))
+
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var response service.Import
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+	assert.Equal(t, created.Errors, response.Errors)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestImportHandler_CreateImport_Multipart(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	walletID := uuid.New()
+	mockService.On("CreateImport", mock.Anything, []service.ImportRow{
+		{WalletID: walletID, OperationType: models.OperationDeposit, Amount: 7},
+	}, false).Return(service.Import{}, nil)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "corrections.csv")
+	require.NoError(t, err)
+	fmt.Fprintf(part, "walletId,operationType,amount\n%s,DEPOSIT,7\n", walletID)
+	require.NoError(t, form.Close())
+
+	req, _ := http.NewRequest("POST", "/api/v1/imports", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestImportHandler_CreateImport_BadRequest(t *testing.T) {
+	walletID := uuid.New()
+
+	testCases := []struct {
+		query  string
+		body   string
+		code   string
+		detail string
+	}{
+		{"?skipInvalid=maybe", "walletId,operationType,amount\n", "INVALID_PARAMETER", "Invalid skipInvalid"},
+		{"", "", "INVALID_IMPORT", "invalid import: empty file"},
+		{"", "walletId,amount\n", "INVALID_IMPORT", `invalid import: missing column "operationType"`},
+		{"", "walletId,operationType,amount\n\"DEPOSIT,1\n", "INVALID_IMPORT", `invalid import: invalid CSV: parse error on line 2, column 12: extraneous or missing " in quoted-field`},
+		{"", "walletId,operationType,amount\n" + strings.Repeat(walletID.String()+",DEPOSIT,1\n", 3), "INVALID_IMPORT", "invalid import: more than 2 rows"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockImportService)
+		router := setupImportRouter(mockService, 2)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, importRequest(tc.query, tc.body))
+
+		assert.Equal(t, tc.detail, assertProblem(t, w, http.StatusBadRequest, tc.code).Detail, tc.body)
+		mockService.AssertNotCalled(t, "CreateImport", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestImportHandler_CreateImport_NoRows(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	mockService.On("CreateImport", mock.Anything, []service.ImportRow(nil), false).
+		Return(service.Import{}, fmt.Errorf("%w: no rows", service.ErrInvalidImport))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest("", "walletId,operationType,amount\n"))
+
+	assert.Equal(t, "invalid import: no rows", assertProblem(t, w, http.StatusBadRequest, "INVALID_IMPORT").Detail)
+}
+
+func TestImportHandler_CreateImport_Duplicate(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	id := uuid.New()
+	mockService.On("CreateImport", mock.Anything, mock.Anything, false).
+		Return(service.Import{}, fmt.Errorf("%w: already imported as %s", service.ErrDuplicateImport, id))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest("", "walletId,operationType,amount\n"+uuid.NewString()+",DEPOSIT,100\n"))
+
+	assert.Equal(t, "file already imported: already imported as "+id.String(),
+		assertProblem(t, w, http.StatusConflict, "IMPORT_DUPLICATE").Detail)
+}
+
+func TestImportHandler_GetImport(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	id := uuid.New()
+	mockService.On("GetImport", mock.Anything, id).Return(service.Import{
+		Import: repository.Import{ID: id, Status: string(models.ImportStatusRejected)},
+		Errors: []service.ImportRowError{{Row: 1, Error: "wallet not found"}},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/imports/"+id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"REJECTED"`)
+	assert.Contains(t, w.Body.String(), `"errors":[{"row":1,"error":"wallet not found"}]`)
+}
+
+func TestImportHandler_GetImport_NotFound(t *testing.T) {
+	mockService := new(MockImportService)
+	router := setupImportRouter(mockService, 0)
+
+	id := uuid.New()
+	mockService.On("GetImport", mock.Anything, id).Return(service.Import{}, service.ErrImportNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/v1/imports/"+id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Import not found", assertProblem(t, w, http.StatusNotFound, "IMPORT_NOT_FOUND").Title)
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type InterestHandler struct {
+	service service.InterestServiceInterface
+}
+
+func NewInterestHandler(service service.InterestServiceInterface) *InterestHandler {
+	return &InterestHandler{
+		service: service,
+	}
+}
+
+// InterestProductRequest creates or replaces a product. The annual rate is
+// in basis points; empty conventions take the server defaults.
+type InterestProductRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	AnnualRateBps int32           `json:"annualRateBps"`
+	DayCount      models.DayCount `json:"dayCount"`
+	Rounding      models.Rounding `json:"rounding"`
+}
+
+func (r InterestProductRequest) params() service.InterestProductParams {
+	return service.InterestProductParams{
+		Name:          r.Name,
+		AnnualRateBps: r.AnnualRateBps,
+		DayCount:      r.DayCount,
+		Rounding:      r.Rounding,
+	}
+}
+
+// WalletInterestRequest enrolls a wallet in a product, at its own annual
+// rate, or both.
+type WalletInterestRequest struct {
+	ProductID     string `json:"productId"`
+	AnnualRateBps *int32 `json:"annualRateBps"`
+}
+
+func (h *InterestHandler) CreateInterestProduct(c *gin.Context) {
+	var req InterestProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	product, err := h.service.CreateInterestProduct(c, req.params())
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func (h *InterestHandler) ListInterestProducts(c *gin.Context) {
+	products, err := h.service.ListInterestProducts(c)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(products))
+}
+
+func (h *InterestHandler) GetInterestProduct(c *gin.Context) {
+	id, ok := interestProductID(c)
+	if !ok {
+		return
+	}
+
+	product, err := h.service.GetInterestProduct(c, id)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *InterestHandler) UpdateInterestProduct(c *gin.Context) {
+	id, ok := interestProductID(c)
+	if !ok {
+		return
+	}
+
+	var req InterestProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	product, err := h.service.UpdateInterestProduct(c, id, req.params())
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *InterestHandler) SetWalletInterest(c *gin.Context) {
+	walletID, ok := walletIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req WalletInterestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	p := service.WalletInterestParams{AnnualRateBps: req.AnnualRateBps}
+	if req.ProductID != "" {
+		var err error
+		if p.ProductID, err = uuid.Parse(req.ProductID); err != nil {
+			abort(c, invalidParameter("Invalid product ID"))
+			return
+		}
+	}
+
+	wi, err := h.service.SetWalletInterest(auditContext(c), walletID, p)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wi)
+}
+
+// GetWalletInterest returns the terms of the wallet and the interest accrued
+// since the last payout.
+func (h *InterestHandler) GetWalletInterest(c *gin.Context) {
+	walletID, ok := walletIDParam(c)
+	if !ok {
+		return
+	}
+
+	wi, err := h.service.GetWalletInterest(c, walletID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wi)
+}
+
+func (h *InterestHandler) DeleteWalletInterest(c *gin.Context) {
+	walletID, ok := walletIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWalletInterest(auditContext(c), walletID); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListInterestPayouts returns the latest monthly payouts, newest first.
+func (h *InterestHandler) ListInterestPayouts(c *gin.Context) {
+	walletID, ok := walletIDParam(c)
+	if !ok {
+		return
+	}
+
+	limit, ok := pageSize(c)
+	if !ok {
+		return
+	}
+
+	payouts, err := h.service.ListInterestPayouts(c, walletID, limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(payouts))
+}
+
+func interestProductID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid product ID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func walletIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
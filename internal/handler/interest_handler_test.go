@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockInterestService struct {
+	mock.Mock
+}
+
+func (m *MockInterestService) CreateInterestProduct(ctx context.Context, p service.InterestProductParams) (repository.InterestProduct, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).(repository.InterestProduct), args.Error(1)
+}
+
+func (m *MockInterestService) GetInterestProduct(ctx context.Context, id uuid.UUID) (repository.InterestProduct, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.InterestProduct), args.Error(1)
+}
+
+func (m *MockInterestService) ListInterestProducts(ctx context.Context) ([]repository.InterestProduct, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repository.InterestProduct), args.Error(1)
+}
+
+func (m *MockInterestService) UpdateInterestProduct(ctx context.Context, id uuid.UUID, p service.InterestProductParams) (repository.InterestProduct, error) {
+	args := m.Called(ctx, id, p)
+	return args.Get(0).(repository.InterestProduct), args.Error(1)
+}
+
+func (m *MockInterestService) SetWalletInterest(ctx context.Context, walletID uuid.UUID, p service.WalletInterestParams) (service.WalletInterest, error) {
+	args := m.Called(ctx, walletID, p)
+	return args.Get(0).(service.WalletInterest), args.Error(1)
+}
+
+func (m *MockInterestService) GetWalletInterest(ctx context.Context, walletID uuid.UUID) (service.WalletInterest, error) {
+	args := m.Called(ctx, walletID)
+	return args.Get(0).(service.WalletInterest), args.Error(1)
+}
+
+func (m *MockInterestService) DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) error {
+	args := m.Called(ctx, walletID)
+	return args.Error(0)
+}
+
+func (m *MockInterestService) ListInterestPayouts(ctx context.Context, walletID uuid.UUID, limit int32) ([]repository.InterestPayout, error) {
+	args := m.Called(ctx, walletID, limit)
+	return args.Get(0).([]repository.InterestPayout), args.Error(1)
+}
+
+func setupInterestRouter(mockService *MockInterestService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewInterestHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.POST("/interest-products", handler.CreateInterestProduct)
+	v1.GET("/interest-products", handler.ListInterestProducts)
+	v1.GET("/interest-products/:id", handler.GetInterestProduct)
+	v1.PUT("/interest-products/:id", handler.UpdateInterestProduct)
+	v1.PUT("/wallets/:id/interest", handler.SetWalletInterest)
+	v1.GET("/wallets/:id/interest", handler.GetWalletInterest)
+	v1.DELETE("/wallets/:id/interest", handler.DeleteWalletInterest)
+	v1.GET("/wallets/:id/interest/payouts", handler.ListInterestPayouts)
+
+	return r
+}
+
+func TestInterestHandler_CreateInterestProduct(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	created := repository.InterestProduct{ID: uuid.New(), Name: "savings", AnnualRateBps: 250}
+	mockService.On("CreateInterestProduct", mock.Anything, service.InterestProductParams{
+		Name:          "savings",
+		AnnualRateBps: 250,
+		DayCount:      models.DayCountAct360,
+	}).Return(created, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/interest-products", gin.H{
+		"name":          "savings",
+		"annualRateBps": 250,
+		"dayCount":      "ACT/360",
+	}))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response repository.InterestProduct
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestInterestHandler_CreateInterestProduct_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{fmt.Errorf("%w: rounding must be HALF_UP, HALF_EVEN or DOWN", service.ErrInvalidInterest), http.StatusBadRequest, "INVALID_INTEREST"},
+		{service.ErrInterestProductExists, http.StatusConflict, "INTEREST_PRODUCT_EXISTS"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockInterestService)
+		router := setupInterestRouter(mockService)
+
+		mockService.On("CreateInterestProduct", mock.Anything, mock.Anything).Return(repository.InterestProduct{}, tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/interest-products", gin.H{"name": "savings", "rounding": "CEILING"}))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestInterestHandler_SetWalletInterest(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	walletID, productID := uuid.New(), uuid.New()
+	rate := int32(400)
+
+	mockService.On("SetWalletInterest", mock.Anything, walletID, service.WalletInterestParams{
+		ProductID:     productID,
+		AnnualRateBps: &rate,
+	}).Return(service.WalletInterest{
+		WalletInterest: repository.WalletInterest{WalletID: walletID, ProductID: productID},
+		PendingMicros:  1500,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("PUT", "/api/v1/wallets/"+walletID.String()+"/interest", gin.H{
+		"productId":     productID,
+		"annualRateBps": 400,
+	}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"pending_micros":1500`)
+	assert.Contains(t, w.Body.String(), `"wallet_id":"`+walletID.String()+`"`)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestInterestHandler_SetWalletInterest_InvalidIDs(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("PUT", "/api/v1/wallets/nope/interest", gin.H{"annualRateBps": 1}))
+	assert.Equal(t, "Invalid wallet ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("PUT", "/api/v1/wallets/"+uuid.NewString()+"/interest", gin.H{"productId": "nope"}))
+	assert.Equal(t, "Invalid product ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+
+	mockService.AssertNotCalled(t, "SetWalletInterest", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestInterestHandler_GetWalletInterest_NotEnrolled(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("GetWalletInterest", mock.Anything, walletID).Return(service.WalletInterest{}, service.ErrWalletInterestNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"/interest", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Wallet does not earn interest", assertProblem(t, w, http.StatusNotFound, "WALLET_INTEREST_NOT_FOUND").Title)
+}
+
+func TestInterestHandler_DeleteWalletInterest(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("DeleteWalletInterest", mock.Anything, walletID).Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/wallets/"+walletID.String()+"/interest", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestInterestHandler_ListInterestPayouts(t *testing.T) {
+	mockService := new(MockInterestService)
+	router := setupInterestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("ListInterestPayouts", mock.Anything, walletID, int32(12)).Return([]repository.InterestPayout(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"/interest/payouts?limit=12", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"/interest/payouts?limit=0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// ProblemContentType is the media type of every error response, RFC 7807
+// problem details.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix makes a problem type URI of a code. The URIs identify
+// problems and are not meant to be fetched.
+const problemTypePrefix = "urn:itk:problem:"
+
+const requestIDKey = "requestID"
+
+// Problem describes why a request failed. Code is a stable machine-readable
+// name of the problem, Type the same as a URI; Instance is the request ID.
+// Errors lists the invalid fields of a request body.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// FieldError is a field of a request body that failed validation. Field is
+// its JSON path, such as tiers[0].minAmount.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// serviceProblems maps the errors of the service to the problems they
+// cause; the first match wins. Validation errors explain themselves, so
+// their message becomes the detail.
+var serviceProblems = []struct {
+	err    error
+	status int
+	code   string
+	title  string
+}{
+	{service.ErrInvalidWallet, http.StatusBadRequest, "INVALID_WALLET", "Invalid wallet"},
+	{service.ErrInvalidWalletSearch, http.StatusBadRequest, "INVALID_WALLET_SEARCH", "Invalid wallet search"},
+	{service.ErrInvalidSchedule, http.StatusBadRequest, "INVALID_SCHEDULE", "Invalid scheduled operation"},
+	{service.ErrInvalidInterest, http.StatusBadRequest, "INVALID_INTEREST", "Invalid interest terms"},
+	{service.ErrInvalidFeeSchedule, http.StatusBadRequest, "INVALID_FEE_SCHEDULE", "Invalid fee schedule"},
+	{service.ErrInvalidFeeQuote, http.StatusBadRequest, "INVALID_FEE_QUOTE", "Invalid fee quote"},
+	{service.ErrInvalidImport, http.StatusBadRequest, "INVALID_IMPORT", "Invalid import"},
+	{service.ErrInvalidAuditFilter, http.StatusBadRequest, "INVALID_AUDIT_FILTER", "Invalid audit filter"},
+	{service.ErrInvalidStatementPeriod, http.StatusBadRequest, "INVALID_STATEMENT_PERIOD", "Invalid statement period"},
+	{service.ErrInvalidReversal, http.StatusBadRequest, "INVALID_REVERSAL", "Invalid reversal"},
+	{service.ErrInvalidExchangeRate, http.StatusBadRequest, "INVALID_EXCHANGE_RATE", "Invalid exchange rate"},
+	{service.ErrInvalidExchange, http.StatusBadRequest, "INVALID_EXCHANGE", "Invalid exchange"},
+	{service.ErrInvalidAPIKey, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized"},
+	{service.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND", "Wallet not found"},
+	{service.ErrOperationNotFound, http.StatusNotFound, "TRANSACTION_NOT_FOUND", "Transaction not found"},
+	{service.ErrScheduledOperationNotFound, http.StatusNotFound, "SCHEDULED_OPERATION_NOT_FOUND", "Scheduled operation not found"},
+	{service.ErrInterestProductNotFound, http.StatusNotFound, "INTEREST_PRODUCT_NOT_FOUND", "Interest product not found"},
+	{service.ErrWalletInterestNotFound, http.StatusNotFound, "WALLET_INTEREST_NOT_FOUND", "Wallet does not earn interest"},
+	{service.ErrFeeScheduleNotFound, http.StatusNotFound, "FEE_SCHEDULE_NOT_FOUND", "Fee schedule not found"},
+	{service.ErrImportNotFound, http.StatusNotFound, "IMPORT_NOT_FOUND", "Import not found"},
+	{service.ErrExchangeQuoteNotFound, http.StatusNotFound, "EXCHANGE_QUOTE_NOT_FOUND", "Exchange quote not found"},
+	{service.ErrWalletFrozen, http.StatusConflict, "WALLET_FROZEN", "Wallet is frozen"},
+	{service.ErrOperationNotReversible, http.StatusConflict, "TRANSACTION_NOT_REVERSIBLE", "Transaction cannot be reversed"},
+	{service.ErrOperationReversed, http.StatusConflict, "TRANSACTION_REVERSED", "Transaction is already reversed"},
+	{service.ErrInterestProductExists, http.StatusConflict, "INTEREST_PRODUCT_EXISTS", "Interest product already exists"},
+	{service.ErrFeeScheduleExists, http.StatusConflict, "FEE_SCHEDULE_EXISTS", "Fee schedule already exists"},
+	{service.ErrExchangeRateExists, http.StatusConflict, "EXCHANGE_RATE_EXISTS", "Exchange rate already exists"},
+	{service.ErrDuplicateImport, http.StatusConflict, "IMPORT_DUPLICATE", "File is already imported"},
+	{service.ErrExchangeQuoteExecuted, http.StatusConflict, "EXCHANGE_QUOTE_EXECUTED", "Exchange quote is already executed"},
+	{service.ErrExchangeQuoteExpired, http.StatusGone, "EXCHANGE_QUOTE_EXPIRED", "Exchange quote has expired"},
+	{service.ErrInsufficientFunds, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", "Insufficient funds"},
+	{service.ErrExchangeRateNotFound, http.StatusUnprocessableEntity, "EXCHANGE_RATE_NOT_FOUND", "Exchange rate not found"},
+}
+
+// fieldProblems names the validation tags of request bodies.
+var fieldProblems = map[string]struct{ code, detail string }{
+	"required":     {"REQUIRED", "is required"},
+	"oneof":        {"ONE_OF", "must be one of %s"},
+	"gt":           {"GREATER_THAN", "must be greater than %s"},
+	"uuid_rfc4122": {"UUID", "must be a UUID"},
+}
+
+func init() {
+	// Field errors name fields as clients send them.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// Problems writes the error a handler aborted with as problem details. It
+// also gives every request an ID, from RequestIDHeader if the client sent
+// one, which problems carry as their instance.
+func Problems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID(c)
+
+		c.Next()
+
+		// A streamed response may fail midway; all that is left is to
+		// log the error, which the logger does.
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		writeProblem(c, problemOf(c.Errors.Last()))
+	}
+}
+
+// Recovered answers a request whose handler panicked, for
+// gin.CustomRecovery.
+func Recovered(c *gin.Context, _ any) {
+	c.Abort()
+	writeProblem(c, internalProblem())
+}
+
+// RouteNotFound answers requests that match no route.
+func RouteNotFound(c *gin.Context) {
+	abort(c, &Problem{
+		Status: http.StatusNotFound,
+		Code:   "ROUTE_NOT_FOUND",
+		Title:  "Route not found",
+		Detail: c.Request.Method + " " + c.Request.URL.Path,
+	})
+}
+
+// abort fails the request with err: a *Problem, an error of the service or
+// anything else, which becomes an internal error.
+func abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// abortBind fails the request with the error of binding its body.
+func abortBind(c *gin.Context, err error) {
+	_ = c.Error(err).SetType(gin.ErrorTypeBind)
+	c.Abort()
+}
+
+// invalidParameter is a malformed path or query parameter, or header.
+func invalidParameter(detail string) *Problem {
+	return &Problem{
+		Status: http.StatusBadRequest,
+		Code:   "INVALID_PARAMETER",
+		Title:  "Invalid parameter",
+		Detail: detail,
+	}
+}
+
+// unauthorized is a request without a valid credential.
+func unauthorized(detail string) *Problem {
+	return &Problem{
+		Status: http.StatusUnauthorized,
+		Code:   "UNAUTHORIZED",
+		Title:  "Unauthorized",
+		Detail: detail,
+	}
+}
+
+func malformedBody(detail string) *Problem {
+	return &Problem{
+		Status: http.StatusBadRequest,
+		Code:   "MALFORMED_BODY",
+		Title:  "Malformed request body",
+		Detail: detail,
+	}
+}
+
+func internalProblem() *Problem {
+	return &Problem{
+		Status: http.StatusInternalServerError,
+		Code:   "INTERNAL_ERROR",
+		Title:  "Internal server error",
+	}
+}
+
+func problemOf(e *gin.Error) *Problem {
+	var p *Problem
+	if errors.As(e.Err, &p) {
+		problem := *p
+		return &problem
+	}
+
+	if e.IsType(gin.ErrorTypeBind) {
+		return bindProblem(e.Err)
+	}
+
+	for _, sp := range serviceProblems {
+		if errors.Is(e.Err, sp.err) {
+			return &Problem{Status: sp.status, Code: sp.code, Title: sp.title, Detail: e.Err.Error()}
+		}
+	}
+
+	// The logger records the error; the client learns nothing of the
+	// internals.
+	return internalProblem()
+}
+
+func bindProblem(err error) *Problem {
+	var fields validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &fields):
+		invalid := make([]FieldError, len(fields))
+		for i, f := range fields {
+			invalid[i] = fieldError(f)
+		}
+		return fieldsInvalid(invalid...)
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return malformedBody("the body must be a JSON object")
+	case errors.As(err, &typeErr):
+		return fieldsInvalid(FieldError{
+			Field:  typeErr.Field,
+			Code:   "TYPE",
+			Detail: "cannot hold a JSON " + typeErr.Value,
+		})
+	case errors.As(err, &tooLarge):
+		return &Problem{
+			Status: http.StatusRequestEntityTooLarge,
+			Code:   "BODY_TOO_LARGE",
+			Title:  "Request body too large",
+			Detail: "the body exceeds " + strconv.FormatInt(tooLarge.Limit, 10) + " bytes",
+		}
+	case errors.Is(err, io.EOF):
+		return malformedBody("the body is empty")
+	}
+
+	// encoding/json reports unknown fields in plain text only.
+	if field, ok := strings.CutPrefix(err.Error(), `json: unknown field "`); ok {
+		return fieldsInvalid(FieldError{
+			Field:  strings.TrimSuffix(field, `"`),
+			Code:   "UNKNOWN",
+			Detail: "is not allowed",
+		})
+	}
+
+	return malformedBody(err.Error())
+}
+
+// fieldsInvalid is the problem of a body with invalid fields.
+func fieldsInvalid(errs ...FieldError) *Problem {
+	detail := "1 field is invalid"
+	if len(errs) != 1 {
+		detail = strconv.Itoa(len(errs)) + " fields are invalid"
+	}
+
+	return &Problem{
+		Status: http.StatusBadRequest,
+		Code:   "VALIDATION_FAILED",
+		Title:  "Request validation failed",
+		Detail: detail,
+		Errors: errs,
+	}
+}
+
+func fieldError(f validator.FieldError) FieldError {
+	// The namespace starts with the name of the request type.
+	field := f.Namespace()
+	if _, path, ok := strings.Cut(field, "."); ok {
+		field = path
+	}
+
+	known, ok := fieldProblems[f.Tag()]
+	if !ok {
+		return FieldError{Field: field, Code: strings.ToUpper(f.Tag()), Detail: "is invalid"}
+	}
+
+	detail := known.detail
+	if strings.Contains(detail, "%s") {
+		detail = fmt.Sprintf(detail, strings.ReplaceAll(f.Param(), " ", ", "))
+	}
+
+	return FieldError{Field: field, Code: known.code, Detail: detail}
+}
+
+func writeProblem(c *gin.Context, p *Problem) {
+	p.Type = problemTypePrefix + strings.ToLower(strings.ReplaceAll(p.Code, "_", "-"))
+	p.Instance = requestID(c)
+
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(p.Status, p)
+}
+
+// requestID returns the ID of the request, taken from RequestIDHeader or
+// generated, and sends it back in the same header.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+
+	id := c.GetHeader(RequestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+
+	return id
+}
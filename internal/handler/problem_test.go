@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertProblem checks that w answers with problem details of status and
+// code, and returns them.
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) Problem {
+	t.Helper()
+
+	assert.Equal(t, status, w.Code, w.Body.String())
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, status, problem.Status)
+	assert.Equal(t, code, problem.Code)
+	assert.Equal(t, w.Header().Get(RequestIDHeader), problem.Instance)
+
+	return problem
+}
+
+func TestProblems_ValidationErrors(t *testing.T) {
+	router := setupTestRouter(new(MockWalletService))
+
+	testCases := []struct {
+		body   string
+		errors []FieldError
+	}{
+		{`{}`, []FieldError{
+			{Field: "amount", Code: "GREATER_THAN", Detail: "must be greater than 0"},
+			{Field: "walletId", Code: "REQUIRED", Detail: "is required"},
+			{Field: "operationType", Code: "REQUIRED", Detail: "is required"},
+		}},
+		{`{"amount": 10, "walletId": "wallet", "operationType": "TRANSFER"}`, []FieldError{
+			{Field: "walletId", Code: "UUID", Detail: "must be a UUID"},
+			{Field: "operationType", Code: "ONE_OF", Detail: "must be one of DEPOSIT, WITHDRAW"},
+		}},
+		{`{"amount": "ten"}`, []FieldError{
+			{Field: "amount", Code: "TYPE", Detail: "cannot hold a JSON string"},
+		}},
+		{`{"amount": 10000000000}`, []FieldError{
+			{Field: "amount", Code: "TYPE", Detail: "cannot hold a JSON number 10000000000"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("POST", "/api/v1/wallet", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		problem := assertProblem(t, w, http.StatusBadRequest, "VALIDATION_FAILED")
+		assert.Equal(t, "urn:itk:problem:validation-failed", problem.Type)
+		assert.Equal(t, tc.errors, problem.Errors, tc.body)
+	}
+}
+
+func TestProblems_MalformedBody(t *testing.T) {
+	router := setupTestRouter(new(MockWalletService))
+
+	for _, body := range []string{``, `{"amount":`, `[1]`} {
+		req, _ := http.NewRequest("POST", "/api/v1/wallet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		problem := assertProblem(t, w, http.StatusBadRequest, "MALFORMED_BODY")
+		assert.NotEmpty(t, problem.Detail, body)
+	}
+}
+
+func TestProblems_Instance(t *testing.T) {
+	router := setupTestRouter(new(MockWalletService))
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/wallet", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	problem := assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER")
+	assert.Equal(t, "req-1", problem.Instance)
+	assert.Equal(t, "Invalid parameter", problem.Title)
+}
+
+func TestProblems_Unhandled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(gin.CustomRecovery(Recovered), Problems())
+	r.NoRoute(RouteNotFound)
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	problem := assertProblem(t, w, http.StatusInternalServerError, "INTERNAL_ERROR")
+	assert.NotContains(t, w.Body.String(), "boom")
+	assert.NotEmpty(t, problem.Instance)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/wallets", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	problem = assertProblem(t, w, http.StatusNotFound, "ROUTE_NOT_FOUND")
+	assert.Equal(t, "DELETE /api/v1/wallets", problem.Detail)
+}
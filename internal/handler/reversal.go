@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReverseRequest is the optional body of a reversal. Without an amount, or
+// without a body, all that is left of the operation is reversed.
+type ReverseRequest struct {
+	Amount int32 `json:"amount"`
+}
+
+func (h *WalletHandler) ReverseTransaction(c *gin.Context) {
+	operationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid transaction ID"))
+		return
+	}
+
+	var req ReverseRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		abortBind(c, err)
+		return
+	}
+
+	reversal, err := h.service.ReverseOperation(auditContext(c), operationID, req.Amount)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	h.setConsistencyToken(c)
+
+	c.JSON(http.StatusCreated, reversal)
+}
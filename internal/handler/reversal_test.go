@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletHandler_ReverseTransaction(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	operationID := uuid.New()
+	walletID := uuid.New()
+	reversal := service.Reversal{
+		Reversal: repository.Operation{ID: uuid.New(), WalletID: walletID, OperationType: string(models.OperationReversal), Amount: -30, ReversalOf: operationID},
+		Original: repository.Operation{ID: operationID, WalletID: walletID, OperationType: string(models.OperationDeposit), Amount: 100, ReversedAmount: 30},
+		Wallet:   repository.Wallet{ID: walletID, Balance: 70},
+	}
+	mockService.On("ReverseOperation", mock.Anything, operationID, int32(30)).Return(reversal, nil)
+	mockService.On("ReverseOperation", mock.Anything, operationID, int32(0)).Return(reversal, nil)
+
+	for _, body := range []string{`{"amount": 30}`, ``} {
+		req, _ := http.NewRequest("POST", "/api/v1/transactions/"+operationID.String()+"/reverse", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusCreated, w.Code, body)
+
+		var got struct {
+			Reversal repository.Operation `json:"reversal"`
+			Original repository.Operation `json:"original"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, operationID, got.Reversal.ReversalOf)
+		assert.Equal(t, int32(30), got.Original.ReversedAmount)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_ReverseTransaction_Errors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"not found", service.ErrOperationNotFound, http.StatusNotFound},
+		{"over-reversal", service.ErrInvalidReversal, http.StatusBadRequest},
+		{"already reversed", service.ErrOperationReversed, http.StatusConflict},
+		{"not reversible", service.ErrOperationNotReversible, http.StatusConflict},
+		{"frozen", service.ErrWalletFrozen, http.StatusConflict},
+		{"insufficient funds", service.ErrInsufficientFunds, http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockWalletService)
+			router := setupTestRouter(mockService)
+
+			operationID := uuid.New()
+			mockService.On("ReverseOperation", mock.Anything, operationID, int32(10)).Return(service.Reversal{}, tc.err)
+
+			req, _ := http.NewRequest("POST", "/api/v1/transactions/"+operationID.String()+"/reverse", bytes.NewBufferString(`{"amount": 10}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestWalletHandler_ReverseTransaction_BadRequest(t *testing.T) {
+	for name, tc := range map[string]struct{ id, body string }{
+		"invalid id":     {"nope", ``},
+		"invalid body":   {uuid.NewString(), `{"amount": "all"}`},
+		"malformed body": {uuid.NewString(), `{`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockService := new(MockWalletService)
+			router := setupTestRouter(mockService)
+
+			req, _ := http.NewRequest("POST", "/api/v1/transactions/"+tc.id+"/reverse", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "ReverseOperation")
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type ScheduleHandler struct {
+	service service.ScheduleServiceInterface
+}
+
+func NewScheduleHandler(service service.ScheduleServiceInterface) *ScheduleHandler {
+	return &ScheduleHandler{
+		service: service,
+	}
+}
+
+// ScheduledOperationRequest creates or replaces a scheduled operation. Set
+// either RunAt for a one-off operation or Cron for a recurring one.
+type ScheduledOperationRequest struct {
+	WalletID       string                `json:"walletId"`
+	TargetWalletID string                `json:"targetWalletId"`
+	OperationType  models.OperationType  `json:"operationType" binding:"required"`
+	Amount         int32                 `json:"amount" binding:"required"`
+	RunAt          time.Time             `json:"runAt"`
+	Cron           string                `json:"cron"`
+	Status         models.ScheduleStatus `json:"status"`
+}
+
+func (r ScheduledOperationRequest) params() (service.ScheduleParams, error) {
+	p := service.ScheduleParams{
+		OperationType: r.OperationType,
+		Amount:        r.Amount,
+		RunAt:         r.RunAt,
+		Cron:          r.Cron,
+		Status:        r.Status,
+	}
+
+	var err error
+	if r.WalletID != "" {
+		if p.WalletID, err = uuid.Parse(r.WalletID); err != nil {
+			return service.ScheduleParams{}, err
+		}
+	}
+	if r.TargetWalletID != "" {
+		if p.TargetWalletID, err = uuid.Parse(r.TargetWalletID); err != nil {
+			return service.ScheduleParams{}, err
+		}
+	}
+
+	return p, nil
+}
+
+func (h *ScheduleHandler) CreateScheduledOperation(c *gin.Context) {
+	var req ScheduledOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	p, err := req.params()
+	if err != nil || p.WalletID == uuid.Nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return
+	}
+
+	op, err := h.service.CreateScheduledOperation(c, p)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, op)
+}
+
+func (h *ScheduleHandler) GetScheduledOperation(c *gin.Context) {
+	id, ok := scheduledOperationID(c)
+	if !ok {
+		return
+	}
+
+	op, err := h.service.GetScheduledOperation(c, id)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, op)
+}
+
+// ListScheduledOperations pages with ?afterId=&limit= and filters with
+// ?walletId= to the operations moving money from or to that wallet.
+func (h *ScheduleHandler) ListScheduledOperations(c *gin.Context) {
+	var walletID, afterID uuid.UUID
+	var err error
+
+	if value := c.Query("walletId"); value != "" {
+		if walletID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid wallet ID"))
+			return
+		}
+	}
+	if value := c.Query("afterId"); value != "" {
+		if afterID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid afterId"))
+			return
+		}
+	}
+
+	limit, ok := pageSize(c)
+	if !ok {
+		return
+	}
+
+	ops, err := h.service.ListScheduledOperations(c, walletID, afterID, limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(ops))
+}
+
+func (h *ScheduleHandler) UpdateScheduledOperation(c *gin.Context) {
+	id, ok := scheduledOperationID(c)
+	if !ok {
+		return
+	}
+
+	var req ScheduledOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	p, err := req.params()
+	if err != nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return
+	}
+
+	op, err := h.service.UpdateScheduledOperation(c, id, p)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, op)
+}
+
+func (h *ScheduleHandler) DeleteScheduledOperation(c *gin.Context) {
+	id, ok := scheduledOperationID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteScheduledOperation(c, id); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListScheduledOperationRuns returns the latest runs, newest first.
+func (h *ScheduleHandler) ListScheduledOperationRuns(c *gin.Context) {
+	id, ok := scheduledOperationID(c)
+	if !ok {
+		return
+	}
+
+	limit, ok := pageSize(c)
+	if !ok {
+		return
+	}
+
+	runs, err := h.service.ListScheduledOperationRuns(c, id, limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(runs))
+}
+
+func scheduledOperationID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid scheduled operation ID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func pageSize(c *gin.Context) (int32, bool) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultPageSize, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		abort(c, invalidParameter("Invalid limit: expected 1 to "+strconv.Itoa(maxPageSize)))
+		return 0, false
+	}
+	return int32(limit), true
+}
+
+// nonNil makes an empty list encode as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockScheduleService struct {
+	mock.Mock
+}
+
+func (m *MockScheduleService) CreateScheduledOperation(ctx context.Context, p service.ScheduleParams) (repository.ScheduledOperation, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).(repository.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleService) GetScheduledOperation(ctx context.Context, id uuid.UUID) (repository.ScheduledOperation, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleService) ListScheduledOperations(ctx context.Context, walletID, afterID uuid.UUID, limit int32) ([]repository.ScheduledOperation, error) {
+	args := m.Called(ctx, walletID, afterID, limit)
+	return args.Get(0).([]repository.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleService) UpdateScheduledOperation(ctx context.Context, id uuid.UUID, p service.ScheduleParams) (repository.ScheduledOperation, error) {
+	args := m.Called(ctx, id, p)
+	return args.Get(0).(repository.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleService) DeleteScheduledOperation(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockScheduleService) ListScheduledOperationRuns(ctx context.Context, id uuid.UUID, limit int32) ([]repository.ScheduledOperationRun, error) {
+	args := m.Called(ctx, id, limit)
+	return args.Get(0).([]repository.ScheduledOperationRun), args.Error(1)
+}
+
+func setupScheduleRouter(mockService *MockScheduleService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewScheduleHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	v1 := r.Group("/api/v1")
+	v1.POST("/scheduled-operations", handler.CreateScheduledOperation)
+	v1.GET("/scheduled-operations", handler.ListScheduledOperations)
+	v1.GET("/scheduled-operations/:id", handler.GetScheduledOperation)
+	v1.PUT("/scheduled-operations/:id", handler.UpdateScheduledOperation)
+	v1.DELETE("/scheduled-operations/:id", handler.DeleteScheduledOperation)
+	v1.GET("/scheduled-operations/:id/runs", handler.ListScheduledOperationRuns)
+
+	return r
+}
+
+func scheduleRequest(method, path string, body any) *http.Request {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestScheduleHandler_CreateScheduledOperation(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	walletID := uuid.New()
+	runAt := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	created := repository.ScheduledOperation{ID: uuid.New(), WalletID: walletID, Amount: 100, NextRunAt: runAt}
+
+	mockService.On("CreateScheduledOperation", mock.Anything, service.ScheduleParams{
+		WalletID:      walletID,
+		OperationType: models.OperationDeposit,
+		Amount:        100,
+		RunAt:         runAt,
+	}).Return(created, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/scheduled-operations", gin.H{
+		"walletId":      walletID,
+		"operationType": "DEPOSIT",
+		"amount":        100,
+		"runAt":         "2030-01-01T09:00:00Z",
+	}))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response repository.ScheduledOperation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestScheduleHandler_CreateScheduledOperation_InvalidWalletID(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	for _, body := range []gin.H{
+		{"operationType": "DEPOSIT", "amount": 1, "cron": "@daily"},
+		{"walletId": "nope", "operationType": "DEPOSIT", "amount": 1, "cron": "@daily"},
+		{"walletId": uuid.New(), "targetWalletId": "nope", "operationType": "TRANSFER", "amount": 1, "cron": "@daily"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/scheduled-operations", body))
+
+		assert.Equal(t, "Invalid wallet ID", assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail)
+	}
+
+	mockService.AssertNotCalled(t, "CreateScheduledOperation", mock.Anything, mock.Anything)
+}
+
+func TestScheduleHandler_CreateScheduledOperation_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{fmt.Errorf("%w: amount must be positive", service.ErrInvalidSchedule), http.StatusBadRequest, "INVALID_SCHEDULE"},
+		{service.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockScheduleService)
+		router := setupScheduleRouter(mockService)
+
+		mockService.On("CreateScheduledOperation", mock.Anything, mock.Anything).Return(repository.ScheduledOperation{}, tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, scheduleRequest("POST", "/api/v1/scheduled-operations", gin.H{
+			"walletId":      uuid.New(),
+			"operationType": "WITHDRAW",
+			"amount":        5,
+			"cron":          "@monthly",
+		}))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestScheduleHandler_GetScheduledOperation_NotFound(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	id := uuid.New()
+	mockService.On("GetScheduledOperation", mock.Anything, id).Return(repository.ScheduledOperation{}, service.ErrScheduledOperationNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scheduled-operations/"+id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Scheduled operation not found", assertProblem(t, w, http.StatusNotFound, "SCHEDULED_OPERATION_NOT_FOUND").Title)
+}
+
+func TestScheduleHandler_ListScheduledOperations(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("ListScheduledOperations", mock.Anything, walletID, uuid.Nil, int32(defaultPageSize)).
+		Return([]repository.ScheduledOperation(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scheduled-operations?walletId="+walletID.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestScheduleHandler_UpdateScheduledOperation(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	id := uuid.New()
+	mockService.On("UpdateScheduledOperation", mock.Anything, id, service.ScheduleParams{
+		OperationType: models.OperationDeposit,
+		Amount:        10,
+		Cron:          "@weekly",
+		Status:        models.ScheduleStatusPaused,
+	}).Return(repository.ScheduledOperation{ID: id, Status: string(models.ScheduleStatusPaused)}, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, scheduleRequest("PUT", "/api/v1/scheduled-operations/"+id.String(), gin.H{
+		"operationType": "DEPOSIT",
+		"amount":        10,
+		"cron":          "@weekly",
+		"status":        "PAUSED",
+	}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestScheduleHandler_DeleteScheduledOperation(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	id := uuid.New()
+	mockService.On("DeleteScheduledOperation", mock.Anything, id).Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/scheduled-operations/"+id.String(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestScheduleHandler_ListScheduledOperationRuns_InvalidLimit(t *testing.T) {
+	mockService := new(MockScheduleService)
+	router := setupScheduleRouter(mockService)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scheduled-operations/"+uuid.NewString()+"/runs?limit=1000", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "ListScheduledOperationRuns", mock.Anything, mock.Anything, mock.Anything)
+}
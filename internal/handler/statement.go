@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// statementTimeout bounds how long a statement may take to write. Its
+// snapshot stays open meanwhile, so a slow client must not hold it.
+const statementTimeout = time.Minute
+
+// statementFormat writers buffer their output; Closing flushes it.
+type statementFormat struct {
+	contentType string
+	newWriter   func(w io.Writer) service.StatementWriter
+}
+
+var statementFormats = map[string]statementFormat{
+	"csv":   {"text/csv; charset=utf-8", newCSVStatement},
+	"jsonl": {"application/x-ndjson", newJSONLStatement},
+	"ofx":   {"application/x-ofx", newOFXStatement},
+}
+
+// GetStatement streams the statement of a wallet for [from, to). to defaults
+// to now. Both take a date or an RFC 3339 time. A statement is complete only
+// if it ends with the closing balance: an error after the first line can no
+// longer change the status, so it just ends the response.
+func (h *WalletHandler) GetStatement(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return
+	}
+
+	name := c.DefaultQuery("format", "csv")
+	format, ok := statementFormats[name]
+	if !ok {
+		abort(c, invalidParameter("Invalid format"))
+		return
+	}
+
+	from, err := parseStatementTime(c.Query("from"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid from"))
+		return
+	}
+
+	to := time.Now()
+	if c.Query("to") != "" {
+		if to, err = parseStatementTime(c.Query("to")); err != nil {
+			abort(c, invalidParameter("Invalid to"))
+			return
+		}
+	}
+
+	w := &statementResponse{
+		c:        c,
+		format:   format,
+		filename: fmt.Sprintf("statement-%s.%s", walletID, name),
+	}
+
+	// A write blocked past the deadline fails, and the snapshot is cancelled
+	// with it.
+	deadline := time.Now().Add(statementTimeout)
+	ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+	defer cancel()
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		abort(c, err)
+		return
+	}
+
+	err = h.service.WriteStatement(ctx, walletID, from, to, w)
+	switch {
+	case err == nil:
+	case c.Writer.Written():
+		log.Printf("statement of wallet %s aborted: %v", walletID, err)
+	default:
+		abort(c, err)
+	}
+}
+
+func parseStatementTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// statementResponse sends the headers once the statement starts, so that
+// errors found before it still get a JSON response.
+type statementResponse struct {
+	c        *gin.Context
+	format   statementFormat
+	filename string
+
+	w service.StatementWriter
+}
+
+func (r *statementResponse) Opening(o service.StatementOpening) error {
+	r.c.Header("Content-Type", r.format.contentType)
+	r.c.Header("Content-Disposition", `attachment; filename="`+r.filename+`"`)
+	r.c.Writer.WriteHeaderNow()
+
+	r.w = r.format.newWriter(r.c.Writer)
+	return r.w.Opening(o)
+}
+
+func (r *statementResponse) Operation(op repository.Operation, balance int64) error {
+	return r.w.Operation(op, balance)
+}
+
+func (r *statementResponse) Closing(c service.StatementClosing) error {
+	return r.w.Closing(c)
+}
+
+// csvStatement writes a row per operation between an OPENING_BALANCE and a
+// CLOSING_BALANCE row.
+type csvStatement struct {
+	w  *csv.Writer
+	to time.Time
+}
+
+func newCSVStatement(w io.Writer) service.StatementWriter {
+	return &csvStatement{w: csv.NewWriter(w)}
+}
+
+func (s *csvStatement) Opening(o service.StatementOpening) error {
+	s.to = o.To
+	if err := s.w.Write([]string{"date", "operation_id", "operation_type", "amount", "balance"}); err != nil {
+		return err
+	}
+	return s.w.Write([]string{formatStatementTime(o.From), "", "OPENING_BALANCE", "", strconv.FormatInt(o.Balance, 10)})
+}
+
+func (s *csvStatement) Operation(op repository.Operation, balance int64) error {
+	return s.w.Write([]string{
+		formatStatementTime(op.CreatedAt),
+		op.ID.String(),
+		op.OperationType,
+		strconv.FormatInt(int64(op.Amount), 10),
+		strconv.FormatInt(balance, 10),
+	})
+}
+
+func (s *csvStatement) Closing(c service.StatementClosing) error {
+	if err := s.w.Write([]string{formatStatementTime(s.to), "", "CLOSING_BALANCE", "", strconv.FormatInt(c.Balance, 10)}); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// jsonlStatement writes one JSON object per line, told apart by "type".
+type jsonlStatement struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+type jsonlOpening struct {
+	Type     string    `json:"type"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Balance  int64     `json:"balance"`
+}
+
+type jsonlOperation struct {
+	Type          string    `json:"type"`
+	ID            uuid.UUID `json:"id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int32     `json:"amount"`
+	Balance       int64     `json:"balance"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type jsonlClosing struct {
+	Type       string `json:"type"`
+	Balance    int64  `json:"balance"`
+	Credits    int64  `json:"credits"`
+	Debits     int64  `json:"debits"`
+	Operations int    `json:"operations"`
+}
+
+func newJSONLStatement(w io.Writer) service.StatementWriter {
+	buf := bufio.NewWriter(w)
+	return &jsonlStatement{w: buf, enc: json.NewEncoder(buf)}
+}
+
+func (s *jsonlStatement) Opening(o service.StatementOpening) error {
+	return s.enc.Encode(jsonlOpening{"opening", o.WalletID, o.From.UTC(), o.To.UTC(), o.Balance})
+}
+
+func (s *jsonlStatement) Operation(op repository.Operation, balance int64) error {
+	return s.enc.Encode(jsonlOperation{"operation", op.ID, op.OperationType, op.Amount, balance, op.CreatedAt.UTC()})
+}
+
+func (s *jsonlStatement) Closing(c service.StatementClosing) error {
+	if err := s.enc.Encode(jsonlClosing{"closing", c.Balance, c.Credits, c.Debits, c.Operations}); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// ofxStatement writes an OFX 2.2 bank statement. OFX has no opening balance:
+// the ledger balance is the closing one.
+type ofxStatement struct {
+	w  *bufio.Writer
+	to time.Time
+}
+
+func newOFXStatement(w io.Writer) service.StatementWriter {
+	return &ofxStatement{w: bufio.NewWriter(w)}
+}
+
+func (s *ofxStatement) Opening(o service.StatementOpening) error {
+	s.to = o.To
+	_, err := fmt.Fprintf(s.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>0</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS><CURDEF>%s</CURDEF>
+<BANKACCTFROM><BANKID>ITK</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>
+`, formatOFXTime(time.Now()), ofxCurrency(o.Currency), o.WalletID, formatOFXTime(o.From), formatOFXTime(o.To))
+	return err
+}
+
+// ofxCurrency is the currency of a wallet as an OFX CURDEF, which is
+// required.
+func ofxCurrency(currency string) string {
+	if currency == "" {
+		return service.NoCurrency
+	}
+	return currency
+}
+
+func (s *ofxStatement) Operation(op repository.Operation, balance int64) error {
+	if _, err := fmt.Fprintf(s.w, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%d</TRNAMT><FITID>%s</FITID><NAME>",
+		ofxTransactionType(op), formatOFXTime(op.CreatedAt), op.Amount, op.ID); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(s.w, []byte(op.OperationType)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.w, "</NAME></STMTTRN>\n")
+	return err
+}
+
+func (s *ofxStatement) Closing(c service.StatementClosing) error {
+	if _, err := fmt.Fprintf(s.w, `</BANKTRANLIST>
+<LEDGERBAL><BALAMT>%d</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`, c.Balance, formatOFXTime(s.to)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func ofxTransactionType(op repository.Operation) string {
+	switch {
+	case models.OperationType(op.OperationType) == models.OperationFee:
+		return "FEE"
+	case op.Amount < 0:
+		return "DEBIT"
+	default:
+		return "CREDIT"
+	}
+}
+
+func formatStatementTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatOFXTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
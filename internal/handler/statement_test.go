@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	statementFrom = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	statementTo   = time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// writeStatement makes the mock write a statement with a deposit and a fee.
+func writeStatement(walletID, depositID, feeID uuid.UUID) func(args mock.Arguments) {
+	return func(args mock.Arguments) {
+		w := args.Get(4).(service.StatementWriter)
+		at := statementFrom.Add(90 * time.Minute)
+
+		_ = w.Opening(service.StatementOpening{WalletID: walletID, Currency: "EUR", From: statementFrom, To: statementTo, Balance: 10})
+		_ = w.Operation(repository.Operation{ID: depositID, WalletID: walletID, OperationType: "DEPOSIT", Amount: 100, CreatedAt: at}, 110)
+		_ = w.Operation(repository.Operation{ID: feeID, WalletID: walletID, OperationType: "FEE", Amount: -2, CreatedAt: at}, 108)
+		_ = w.Closing(service.StatementClosing{Balance: 108, Credits: 100, Debits: 2, Operations: 2})
+	}
+}
+
+func statementRequest(walletID uuid.UUID, query string) *http.Request {
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"/statement?"+query, nil)
+	return req
+}
+
+func TestWalletHandler_GetStatement_CSV(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID, depositID, feeID := uuid.New(), uuid.New(), uuid.New()
+	mockService.On("WriteStatement", mock.Anything, walletID, statementFrom, statementTo, mock.Anything).
+		Run(writeStatement(walletID, depositID, feeID)).
+		Return(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01&to=2025-02-01T00:00:00Z"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="statement-`+walletID.String()+`.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "date,operation_id,operation_type,amount,balance\n"+
+		"2025-01-01T00:00:00Z,,OPENING_BALANCE,,10\n"+
+		"2025-01-01T01:30:00Z,"+depositID.String()+",DEPOSIT,100,110\n"+
+		"2025-01-01T01:30:00Z,"+feeID.String()+",FEE,-2,108\n"+
+		"2025-02-01T00:00:00Z,,CLOSING_BALANCE,,108\n", w.Body.String())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetStatement_Deadline(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	hasDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) <= statementTimeout
+	})
+	mockService.On("WriteStatement", hasDeadline, walletID, statementFrom, statementTo, mock.Anything).
+		Return(context.DeadlineExceeded)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01&to=2025-02-01"))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetStatement_JSONL(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID, depositID, feeID := uuid.New(), uuid.New(), uuid.New()
+	mockService.On("WriteStatement", mock.Anything, walletID, statementFrom, statementTo, mock.Anything).
+		Run(writeStatement(walletID, depositID, feeID)).
+		Return(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01&to=2025-02-01&format=jsonl"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.JSONEq(t, `{"type":"opening","wallet_id":"`+walletID.String()+`","from":"2025-01-01T00:00:00Z","to":"2025-02-01T00:00:00Z","balance":10}`, lines[0])
+		assert.JSONEq(t, `{"type":"operation","id":"`+depositID.String()+`","operation_type":"DEPOSIT","amount":100,"balance":110,"created_at":"2025-01-01T01:30:00Z"}`, lines[1])
+		assert.JSONEq(t, `{"type":"closing","balance":108,"credits":100,"debits":2,"operations":2}`, lines[3])
+	}
+}
+
+func TestWalletHandler_GetStatement_OFX(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID, depositID, feeID := uuid.New(), uuid.New(), uuid.New()
+	mockService.On("WriteStatement", mock.Anything, walletID, statementFrom, statementTo, mock.Anything).
+		Run(writeStatement(walletID, depositID, feeID)).
+		Return(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01&to=2025-02-01&format=ofx"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ofx", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "<CURDEF>EUR</CURDEF>")
+	assert.Contains(t, body, "<ACCTID>"+walletID.String()+"</ACCTID>")
+	assert.Contains(t, body, "<DTSTART>20250101000000.000[0:GMT]</DTSTART><DTEND>20250201000000.000[0:GMT]</DTEND>")
+	assert.Contains(t, body, "<STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20250101013000.000[0:GMT]</DTPOSTED><TRNAMT>100</TRNAMT><FITID>"+depositID.String()+"</FITID><NAME>DEPOSIT</NAME></STMTTRN>")
+	assert.Contains(t, body, "<TRNTYPE>FEE</TRNTYPE>")
+	assert.Contains(t, body, "<LEDGERBAL><BALAMT>108</BALAMT><DTASOF>20250201000000.000[0:GMT]</DTASOF></LEDGERBAL>")
+	assert.True(t, strings.HasSuffix(body, "</OFX>\n"))
+}
+
+func TestWalletHandler_GetStatement_BadRequest(t *testing.T) {
+	walletID := uuid.New()
+
+	testCases := []struct {
+		path   string
+		detail string
+	}{
+		{"/api/v1/wallets/wallet/statement?from=2025-01-01", "Invalid wallet ID"},
+		{"/api/v1/wallets/" + walletID.String() + "/statement?from=2025-01-01&format=pdf", "Invalid format"},
+		{"/api/v1/wallets/" + walletID.String() + "/statement", "Invalid from"},
+		{"/api/v1/wallets/" + walletID.String() + "/statement?from=2025-01-01&to=tomorrow", "Invalid to"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockWalletService)
+		router := setupTestRouter(mockService)
+
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.detail, assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER").Detail, tc.path)
+		mockService.AssertNotCalled(t, "WriteStatement", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestWalletHandler_GetStatement_Errors(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+	}{
+		{service.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND"},
+		{service.ErrInvalidStatementPeriod, http.StatusBadRequest, "INVALID_STATEMENT_PERIOD"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockWalletService)
+		router := setupTestRouter(mockService)
+
+		walletID := uuid.New()
+		mockService.On("WriteStatement", mock.Anything, walletID, mock.Anything, mock.Anything, mock.Anything).Return(tc.err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01"))
+
+		assertProblem(t, w, tc.expected, tc.code)
+	}
+}
+
+func TestWalletHandler_GetStatement_FailsMidway(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("WriteStatement", mock.Anything, walletID, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			w := args.Get(4).(service.StatementWriter)
+			_ = w.Opening(service.StatementOpening{WalletID: walletID, From: statementFrom, To: statementTo})
+		}).
+		Return(errors.New("connection reset"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, statementRequest(walletID, "from=2025-01-01&format=jsonl"))
+
+	assert.Equal(t, http.StatusOK, w.Code, "the status is already sent")
+	assert.NotContains(t, w.Body.String(), "closing")
+	assert.NotContains(t, w.Body.String(), "error")
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultStreamHeartbeat     = 15 * time.Second
+	defaultMaxStreamsPerClient = 5
+)
+
+// WithStreaming sets how often idle balance streams send a heartbeat comment
+// and how many streams one client IP may hold open at once.
+func WithStreaming(heartbeat time.Duration, maxStreamsPerClient int) Option {
+	return func(h *WalletHandler) {
+		h.heartbeat = heartbeat
+		h.streams = newStreamLimiter(maxStreamsPerClient)
+	}
+}
+
+// streamLimiter counts open streams per client.
+type streamLimiter struct {
+	max int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newStreamLimiter(max int) *streamLimiter {
+	return &streamLimiter{max: max, active: make(map[string]int)}
+}
+
+func (l *streamLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client] >= l.max {
+		return false
+	}
+	l.active[client]++
+	return true
+}
+
+func (l *streamLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client]--; l.active[client] <= 0 {
+		delete(l.active, client)
+	}
+}
+
+// StreamWallet sends the wallet as a Server-Sent Event now and after every
+// change. Event IDs are wallet versions, so a client reconnecting with
+// Last-Event-ID only receives the wallet once it has changed again.
+func (h *WalletHandler) StreamWallet(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, invalidParameter("Invalid wallet ID"))
+		return
+	}
+
+	version := int64(-1)
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		version, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || version < 0 {
+			abort(c, invalidParameter("Invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	client := c.ClientIP()
+	if !h.streams.acquire(client) {
+		abort(c, &Problem{Status: http.StatusTooManyRequests, Code: "TOO_MANY_STREAMS", Title: "Too many open streams"})
+		return
+	}
+	defer h.streams.release(client)
+
+	ctx := c.Request.Context()
+	started := false
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, h.heartbeat)
+		wallet, err := h.service.WaitForVersion(waitCtx, walletID, version)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			version = wallet.Version
+		case errors.Is(err, context.DeadlineExceeded):
+		case started:
+			// The client reconnects and resumes from the last event.
+			return
+		default:
+			abort(c, err)
+			return
+		}
+
+		if !started {
+			c.Header("Content-Type", sse.ContentType)
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+			started = true
+		}
+
+		if err == nil {
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatInt(wallet.Version, 10),
+				Event: "balance",
+				Data:  wallet,
+			})
+		} else {
+			c.Writer.WriteString(": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = time.Minute
+)
+
+// waitForWallet long-polls for clients that cannot use SSE: it responds once
+// the wallet version is greater than waitForVersion, or with the unchanged
+// wallet when the timeout fires first.
+func (h *WalletHandler) waitForWallet(c *gin.Context, walletID uuid.UUID) {
+	version, err := strconv.ParseInt(c.Query("waitForVersion"), 10, 64)
+	if err != nil || version < 0 {
+		abort(c, invalidParameter("Invalid waitForVersion"))
+		return
+	}
+
+	timeout := defaultWaitTimeout
+	if value := c.Query("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			abort(c, invalidParameter("Invalid timeout: expected a duration up to "+maxWaitTimeout.String()))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	wallet, err := h.service.WaitForVersion(ctx, walletID, version)
+	if errors.Is(err, context.DeadlineExceeded) && c.Request.Context().Err() == nil {
+		// The timeout may have fired before the wallet was read at all.
+		if wallet.ID == uuid.Nil {
+			wallet, err = h.service.GetWalletByID(c, walletID)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newStreamRequest returns a stream request and a function that ends it, as
+// a disconnecting client would.
+func newStreamRequest(walletID uuid.UUID) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/v1/wallets/"+walletID.String()+"/stream", nil)
+	return req, cancel
+}
+
+func TestWalletHandler_StreamWallet(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	req, disconnect := newStreamRequest(walletID)
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Return(repository.Wallet{ID: walletID, Balance: 100, Version: 2}, nil)
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(2)).
+		Return(repository.Wallet{ID: walletID, Balance: 150, Version: 3}, nil)
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(3)).
+		Run(func(mock.Arguments) { disconnect() }).
+		Return(repository.Wallet{}, context.Canceled)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, sse.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "id:2\nevent:balance\ndata:{\"id\":\""+walletID.String()+"\",\"balance\":100,")
+	assert.Contains(t, w.Body.String(), "id:3\nevent:balance\ndata:{\"id\":\""+walletID.String()+"\",\"balance\":150,")
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_StreamWallet_LastEventID(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	req, disconnect := newStreamRequest(walletID)
+	req.Header.Set("Last-Event-ID", "7")
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(7)).
+		Run(func(mock.Arguments) { disconnect() }).
+		Return(repository.Wallet{}, context.Canceled)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_StreamWallet_InvalidLastEventID(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	req, _ := newStreamRequest(uuid.New())
+	req.Header.Set("Last-Event-ID", "-1")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "WaitForVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWalletHandler_StreamWallet_Heartbeat(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService, WithStreaming(time.Millisecond, 1))
+
+	walletID := uuid.New()
+	req, disconnect := newStreamRequest(walletID)
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Return(repository.Wallet{}, context.DeadlineExceeded).Once()
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Run(func(mock.Arguments) { disconnect() }).
+		Return(repository.Wallet{}, context.Canceled).Once()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ": heartbeat\n\n", w.Body.String())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_StreamWallet_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	req, _ := newStreamRequest(walletID)
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Return(repository.Wallet{}, service.ErrWalletNotFound)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Wallet not found", assertProblem(t, w, http.StatusNotFound, "WALLET_NOT_FOUND").Title)
+}
+
+func TestWalletHandler_StreamWallet_TooManyStreams(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService, WithStreaming(time.Minute, 1))
+
+	walletID := uuid.New()
+	waiting := make(chan struct{})
+	release := make(chan struct{})
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Run(func(mock.Arguments) {
+			close(waiting)
+			<-release
+		}).
+		Return(repository.Wallet{}, service.ErrWalletNotFound).Once()
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(-1)).
+		Return(repository.Wallet{}, service.ErrWalletNotFound).Once()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, _ := newStreamRequest(walletID)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-waiting
+
+	req, _ := newStreamRequest(walletID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	close(release)
+	<-done
+
+	// The slot is free again once the first stream has ended.
+	req, _ = newStreamRequest(walletID)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWalletHandler_GetWallet_WaitForVersion(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	changed := repository.Wallet{ID: walletID, Balance: 150, Version: 4}
+
+	withDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) <= 10*time.Second
+	})
+	mockService.On("WaitForVersion", withDeadline, walletID, int64(3)).Return(changed, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"?waitForVersion=3&timeout=10s", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.Wallet
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, changed.Balance, response.Balance)
+	assert.Equal(t, changed.Version, response.Version)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetWallet_WaitForVersion_Timeout(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	unchanged := repository.Wallet{ID: walletID, Balance: 100, Version: 3}
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(3)).Return(unchanged, context.DeadlineExceeded)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"?waitForVersion=3", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response repository.Wallet
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, unchanged.Version, response.Version)
+
+	mockService.AssertNotCalled(t, "GetWalletByID", mock.Anything, mock.Anything)
+}
+
+func TestWalletHandler_GetWallet_WaitForVersion_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+
+	mockService.On("WaitForVersion", mock.Anything, walletID, int64(0)).Return(repository.Wallet{}, service.ErrWalletNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String()+"?waitForVersion=0", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWalletHandler_GetWallet_WaitForVersion_InvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"waitForVersion=abc",
+		"waitForVersion=-1",
+		"waitForVersion=1&timeout=soon",
+		"waitForVersion=1&timeout=0s",
+		"waitForVersion=1&timeout=2h",
+	} {
+		t.Run(query, func(t *testing.T) {
+			mockService := new(MockWalletService)
+			router := setupTestRouter(mockService)
+
+			req, _ := http.NewRequest("GET", "/api/v1/wallets/"+uuid.NewString()+"?"+query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "WaitForVersion", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+// actorKey holds who a request acts for, for the audit log: the tenant of
+// its API key or the admin.
+const (
+	actorKey   = "actor"
+	adminActor = "admin"
+)
+
+// TenantAuthenticator finds the tenant an API key was issued to.
+type TenantAuthenticator interface {
+	TenantForKey(ctx context.Context, key string) (uuid.UUID, error)
+}
+
+// Tenant confines the rest of the request to the wallets of the tenant whose
+// API key it carries in "Authorization: Bearer <key>". Requests without a
+// valid key are rejected. The engine must have ContextWithFallback set for
+// handlers to see the tenant.
+func Tenant(auth TenantAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := bearerKey(c)
+		if !ok {
+			return
+		}
+
+		tenant, err := auth.TenantForKey(c, key)
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		if err != nil {
+			abort(c, err)
+			return
+		}
+
+		c.Request = c.Request.WithContext(service.WithTenant(c.Request.Context(), tenant))
+		c.Set(actorKey, "tenant:"+tenant.String())
+		c.Next()
+	}
+}
+
+// Admin lets through only requests that carry adminKey in
+// "Authorization: Bearer <key>", for the routes that change what all tenants
+// share. They act for no tenant. Without adminKey no request gets through.
+func Admin(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := bearerKey(c)
+		if !ok {
+			return
+		}
+
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abort(c, unauthorized("Invalid admin API key"))
+			return
+		}
+
+		c.Set(actorKey, adminActor)
+		c.Next()
+	}
+}
+
+// bearerKey returns the key of "Authorization: Bearer <key>", or fails the
+// request without one.
+func bearerKey(c *gin.Context) (string, bool) {
+	scheme, key, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || key == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		abort(c, unauthorized("API key is required"))
+		return "", false
+	}
+	return key, true
+}
+
+func (h *WalletHandler) ListOwnerWallets(c *gin.Context) {
+	ownerID, err := uuid.Parse(c.Param("ownerId"))
+	if err != nil || ownerID == uuid.Nil {
+		abort(c, invalidParameter("Invalid owner ID"))
+		return
+	}
+
+	var afterID uuid.UUID
+	if value := c.Query("afterId"); value != "" {
+		if afterID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid afterId"))
+			return
+		}
+	}
+
+	limit, ok := pageSize(c)
+	if !ok {
+		return
+	}
+
+	wallets, err := h.service.ListOwnerWallets(c, ownerID, afterID, limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(wallets))
+}
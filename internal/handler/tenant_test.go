@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantKeys authenticates the API keys in it as their tenants.
+type tenantKeys map[string]uuid.UUID
+
+func (k tenantKeys) TenantForKey(_ context.Context, key string) (uuid.UUID, error) {
+	tenant, ok := k[key]
+	if !ok {
+		return uuid.Nil, service.ErrInvalidAPIKey
+	}
+	return tenant, nil
+}
+
+func setupTenantRouter(mockService *MockWalletService, keys tenantKeys) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewWalletHandler(mockService)
+
+	r := gin.New()
+	r.Use(Problems())
+	r.ContextWithFallback = true
+	v1 := r.Group("/api/v1", Tenant(keys))
+	v1.GET("/owners/:ownerId/wallets", handler.ListOwnerWallets)
+
+	return r
+}
+
+func forTenant(tenant uuid.UUID) any {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		got, ok := service.TenantFrom(ctx)
+		return ok && got == tenant
+	})
+}
+
+func TestWalletHandler_ListOwnerWallets(t *testing.T) {
+	tenant := uuid.New()
+	mockService := new(MockWalletService)
+	router := setupTenantRouter(mockService, tenantKeys{"acme-key": tenant})
+
+	ownerID := uuid.New()
+	afterID := uuid.New()
+	wallets := []repository.Wallet{{
+		ID:       uuid.New(),
+		Balance:  10,
+		OwnerID:  ownerID,
+		TenantID: tenant,
+		Metadata: json.RawMessage(`{}`),
+		Labels:   json.RawMessage(`{}`),
+	}}
+
+	mockService.On("ListOwnerWallets", forTenant(tenant), ownerID, afterID, int32(5)).Return(wallets, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/owners/"+ownerID.String()+"/wallets?afterId="+afterID.String()+"&limit=5", nil)
+	req.Header.Set("Authorization", "Bearer acme-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got []repository.Wallet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, wallets, got)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_ListOwnerWallets_Unauthorized(t *testing.T) {
+	path := "/api/v1/owners/" + uuid.NewString() + "/wallets"
+
+	testCases := []struct {
+		name          string
+		authorization string
+		challenge     string
+	}{
+		{"no key", "", "Bearer"},
+		{"other scheme", "Basic Zm9vOmJhcg==", "Bearer"},
+		{"empty key", "Bearer ", "Bearer"},
+		{"unknown key", "Bearer other-key", `Bearer error="invalid_token"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockWalletService)
+			router := setupTenantRouter(mockService, tenantKeys{"acme-key": uuid.New()})
+
+			req, _ := http.NewRequest("GET", path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, tc.challenge, w.Header().Get("WWW-Authenticate"))
+			assert.Contains(t, w.Body.String(), `"code":"UNAUTHORIZED"`)
+			mockService.AssertNotCalled(t, "ListOwnerWallets")
+		})
+	}
+}
+
+func TestWalletHandler_ListOwnerWallets_Invalid(t *testing.T) {
+	ownerID := uuid.NewString()
+
+	testCases := []struct {
+		name string
+		path string
+	}{
+		{"invalid owner", "/api/v1/owners/not-a-uuid/wallets"},
+		{"nil owner", "/api/v1/owners/" + uuid.Nil.String() + "/wallets"},
+		{"invalid afterId", "/api/v1/owners/" + ownerID + "/wallets?afterId=nope"},
+		{"invalid limit", "/api/v1/owners/" + ownerID + "/wallets?limit=0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockWalletService)
+			router := setupTenantRouter(mockService, tenantKeys{"acme-key": uuid.New()})
+
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Authorization", "Bearer acme-key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "ListOwnerWallets")
+		})
+	}
+}
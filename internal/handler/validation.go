@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+// maxBalanceBodyBytes bounds the body of a balance update, which is a
+// hundred bytes or so when valid.
+const maxBalanceBodyBytes = 1 << 10
+
+// WithAmountLimits sets the largest amount one deposit and one withdrawal
+// may move. Without it, any amount that fits the balance type is accepted.
+func WithAmountLimits(maxDeposit, maxWithdraw int32) Option {
+	return func(h *WalletHandler) {
+		h.maxDeposit = maxDeposit
+		h.maxWithdraw = maxWithdraw
+	}
+}
+
+// maxAmount is the limit of an operation type; both types the request
+// accepts have one.
+func (h *WalletHandler) maxAmount(operation models.OperationType) int32 {
+	if operation == models.OperationWithdraw {
+		return h.maxWithdraw
+	}
+	return h.maxDeposit
+}
+
+// bindStrictJSON decodes a body of at most maxBytes into obj and validates
+// it. Unlike ShouldBindJSON it rejects fields obj does not have and anything
+// after the JSON object. Its errors are for abortBind.
+func bindStrictJSON(c *gin.Context, obj any, maxBytes int64) error {
+	body := c.Request.Body
+	if body == nil {
+		return io.EOF
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, body, maxBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(obj); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return malformedBody("the body must hold a single JSON object")
+	}
+
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// amountTooLarge is the problem of an amount above the limit of its
+// operation.
+func amountTooLarge(limit int32) *Problem {
+	return fieldsInvalid(FieldError{
+		Field:  "amount",
+		Code:   "AT_MOST",
+		Detail: fmt.Sprintf("must be at most %d", limit),
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func postBalance(t *testing.T, mockService *MockWalletService, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := setupTestRouter(mockService, WithAmountLimits(1000, 500))
+
+	req, _ := http.NewRequest("POST", "/api/v1/wallet", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestWalletHandler_UpdateWalletBalance_Strict(t *testing.T) {
+	walletID := uuid.NewString()
+	body := func(operation string, amount int64, extra string) string {
+		return `{"walletId": "` + walletID + `", "operationType": "` + operation + `", "amount": ` + strconv.FormatInt(amount, 10) + extra + `}`
+	}
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		errors []FieldError
+	}{
+		{"negative deposit", body("DEPOSIT", -100, ""), http.StatusBadRequest, "VALIDATION_FAILED", []FieldError{
+			{Field: "amount", Code: "GREATER_THAN", Detail: "must be greater than 0"},
+		}},
+		{"zero", body("WITHDRAW", 0, ""), http.StatusBadRequest, "VALIDATION_FAILED", []FieldError{
+			{Field: "amount", Code: "GREATER_THAN", Detail: "must be greater than 0"},
+		}},
+		{"deposit above limit", body("DEPOSIT", 1001, ""), http.StatusBadRequest, "VALIDATION_FAILED", []FieldError{
+			{Field: "amount", Code: "AT_MOST", Detail: "must be at most 1000"},
+		}},
+		{"withdrawal above limit", body("WITHDRAW", 501, ""), http.StatusBadRequest, "VALIDATION_FAILED", []FieldError{
+			{Field: "amount", Code: "AT_MOST", Detail: "must be at most 500"},
+		}},
+		{"unknown field", body("DEPOSIT", 10, `, "currency": "USD"`), http.StatusBadRequest, "VALIDATION_FAILED", []FieldError{
+			{Field: "currency", Code: "UNKNOWN", Detail: "is not allowed"},
+		}},
+		{"trailing data", body("DEPOSIT", 10, "") + `{}`, http.StatusBadRequest, "MALFORMED_BODY", nil},
+		{"oversized", body("DEPOSIT", 10, `, "padding": "`+strings.Repeat("x", maxBalanceBodyBytes)+`"`), http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockWalletService)
+
+			problem := assertProblem(t, postBalance(t, mockService, tc.body), tc.status, tc.code)
+			assert.Equal(t, tc.errors, problem.Errors)
+
+			mockService.AssertNotCalled(t, "ChangeWalletBalance", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestWalletHandler_UpdateWalletBalance_AtLimit(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(-500)).Return(service.BalanceChange{Wallet: repository.Wallet{ID: walletID}}, nil)
+
+	w := postBalance(t, mockService, `{"walletId": "`+walletID.String()+`", "operationType": "WITHDRAW", "amount": 500}`)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func FuzzUpdateWalletBalance(f *testing.F) {
+	walletID := uuid.NewString()
+	for _, seed := range []string{
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": 100}`,
+		`{"walletId": "` + walletID + `", "operationType": "WITHDRAW", "amount": 500}`,
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": -100}`,
+		`{"walletId": "` + walletID + `", "operationType": "WITHDRAW", "amount": 0}`,
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": 2147483648}`,
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": 1e3}`,
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": 1, "amount": -1}`,
+		`{"walletId": "` + walletID + `", "operationType": "DEPOSIT", "amount": 1, "extra": null}`,
+		`{"walletId": null, "operationType": 1, "amount": "1"}`,
+		`{"amount": 1} []`,
+		`[]`,
+		`null`,
+		``,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		mockService := new(MockWalletService)
+		mockService.On("ChangeWalletBalance", mock.Anything, mock.Anything, mock.Anything).Return(service.BalanceChange{}, nil)
+
+		w := postBalance(t, mockService, body)
+
+		if w.Code != http.StatusOK {
+			require.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), w.Body.String())
+			require.GreaterOrEqual(t, w.Code, 400)
+			require.Less(t, w.Code, 500, w.Body.String())
+			mockService.AssertNotCalled(t, "ChangeWalletBalance", mock.Anything, mock.Anything, mock.Anything)
+			return
+		}
+
+		// An accepted body is valid JSON in the shape of the request.
+		var req UpdateBalanceRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &req))
+
+		require.Len(t, mockService.Calls, 1)
+		amount := mockService.Calls[0].Arguments.Get(2).(int32)
+		switch req.OperationType {
+		case models.OperationDeposit:
+			assert.True(t, amount > 0 && amount <= 1000, "deposit of %d", amount)
+		case models.OperationWithdraw:
+			assert.True(t, amount < 0 && amount >= -500, "withdrawal of %d", -amount)
+		default:
+			t.Fatalf("accepted operation %q", req.OperationType)
+		}
+		assert.Equal(t, uuid.MustParse(req.WalletID), mockService.Calls[0].Arguments.Get(1))
+	})
+}
@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"context"
+	"log"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -9,76 +13,165 @@ import (
 	"github.com/kuzmindeniss/itk/internal/service"
 )
 
+// ConsistencyTokenHeader carries a token returned after a write. Sent back
+// with a read, it makes the read observe that write even when reads are
+// served by a lagging replica.
+const ConsistencyTokenHeader = "X-Consistency-Token"
+
+// RequestIDHeader ties the audit entry and any error response to the
+// request; one is generated if it is missing and returned either way.
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	anonymousActor = "anonymous"
+)
+
+// ConsistencyTokens issues and applies read-your-writes tokens.
+type ConsistencyTokens interface {
+	ConsistencyToken(ctx context.Context) (string, error)
+	ReadAfter(ctx context.Context, token string) (context.Context, error)
+}
+
 type WalletHandler struct {
 	service service.WalletServiceInterface
+	tokens  ConsistencyTokens
+
+	heartbeat time.Duration
+	streams   *streamLimiter
+
+	maxDeposit  int32
+	maxWithdraw int32
 }
 
-func NewWalletHandler(service service.WalletServiceInterface) *WalletHandler {
-	return &WalletHandler{
-		service: service,
+type Option func(h *WalletHandler)
+
+// WithConsistencyTokens returns a token with every write and honours tokens
+// sent with reads.
+func WithConsistencyTokens(tokens ConsistencyTokens) Option {
+	return func(h *WalletHandler) {
+		h.tokens = tokens
 	}
 }
 
+func NewWalletHandler(service service.WalletServiceInterface, opts ...Option) *WalletHandler {
+	h := &WalletHandler{
+		service:   service,
+		heartbeat: defaultStreamHeartbeat,
+		streams:   newStreamLimiter(defaultMaxStreamsPerClient),
+
+		maxDeposit:  math.MaxInt32,
+		maxWithdraw: math.MaxInt32,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
 func (h *WalletHandler) GetWallet(c *gin.Context) {
 	walletID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+		abort(c, invalidParameter("Invalid wallet ID"))
 		return
 	}
 
-	wallet, err := h.service.GetWalletByID(c, walletID)
+	if c.Query("waitForVersion") != "" {
+		h.waitForWallet(c, walletID)
+		return
+	}
+
+	var ctx context.Context = c
+	if token := c.GetHeader(ConsistencyTokenHeader); token != "" && h.tokens != nil {
+		ctx, err = h.tokens.ReadAfter(c, token)
+		if err != nil {
+			abort(c, invalidParameter("Invalid consistency token"))
+			return
+		}
+	}
+
+	wallet, err := h.service.GetWalletByID(ctx, walletID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, wallet)
 }
 
+// UpdateBalanceRequest deposits or withdraws Amount, which is always
+// positive: the operation type gives the direction.
 type UpdateBalanceRequest struct {
-	Amount        int32                `json:"amount" binding:"required"`
-	WalletID      string               `json:"walletId" binding:"required"`
-	OperationType models.OperationType `json:"operationType" binding:"required"`
+	Amount        int32                `json:"amount" binding:"gt=0"`
+	WalletID      string               `json:"walletId" binding:"required,uuid_rfc4122"`
+	OperationType models.OperationType `json:"operationType" binding:"required,oneof=DEPOSIT WITHDRAW"`
 }
 
 func (h *WalletHandler) UpdateWalletBalance(c *gin.Context) {
 	var req UpdateBalanceRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindStrictJSON(c, &req, maxBalanceBodyBytes); err != nil {
+		abortBind(c, err)
 		return
 	}
 
-	if req.OperationType != models.OperationDeposit && req.OperationType != models.OperationWithdraw {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operation type"})
+	if limit := h.maxAmount(req.OperationType); req.Amount > limit {
+		abort(c, amountTooLarge(limit))
 		return
 	}
 
-	var walletID uuid.UUID
-
-	if req.WalletID != "" {
-		var err error
-		walletID, err = uuid.Parse(req.WalletID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
-			return
-		}
-	}
+	// The binding has checked the ID.
+	walletID := uuid.MustParse(req.WalletID)
 
 	if req.OperationType == models.OperationWithdraw {
 		req.Amount = -req.Amount
 	}
 
-	wallet, err := h.service.TopUpWalletBalance(c, walletID, int32(req.Amount))
+	change, err := h.service.ChangeWalletBalance(auditContext(c), walletID, req.Amount)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wallet balance"})
+		abort(c, err)
 		return
 	}
 
+	h.setConsistencyToken(c)
+
 	c.JSON(http.StatusOK, gin.H{
 		"wallet": gin.H{
-			"id":      wallet.ID,
-			"balance": wallet.Balance,
+			"id":      change.Wallet.ID,
+			"balance": change.Wallet.Balance,
 		},
+		"fee": change.Fee,
+	})
+}
+
+// setConsistencyToken returns the token of a committed write, if tokens are
+// issued.
+func (h *WalletHandler) setConsistencyToken(c *gin.Context) {
+	if h.tokens == nil {
+		return
+	}
+
+	// The write is committed; without a token the client merely risks a
+	// stale read, so a failure here does not fail the request.
+	if token, err := h.tokens.ConsistencyToken(c); err != nil {
+		log.Printf("failed to get consistency token: %v", err)
+	} else {
+		c.Header(ConsistencyTokenHeader, token)
+	}
+}
+
+// auditContext makes the changes of a request recorded in the audit log as
+// made by whoever Tenant or Admin authenticated.
+func auditContext(c *gin.Context) context.Context {
+	actor := c.GetString(actorKey)
+	if actor == "" {
+		actor = anonymousActor
+	}
+
+	return service.WithAudit(c, service.AuditInfo{
+		Actor:     actor,
+		RequestID: requestID(c),
+		SourceIP:  c.ClientIP(),
 	})
 }
@@ -8,11 +8,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/kuzmindeniss/itk/internal/db/repository"
 	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -26,20 +28,81 @@ func (m *MockWalletService) GetWalletByID(ctx context.Context, id uuid.UUID) (re
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
-func (m *MockWalletService) TopUpWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (repository.Wallet, error) {
+func (m *MockWalletService) ChangeWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (service.BalanceChange, error) {
 	args := m.Called(ctx, id, amount)
+	return args.Get(0).(service.BalanceChange), args.Error(1)
+}
+
+func (m *MockWalletService) WaitForVersion(ctx context.Context, id uuid.UUID, version int64) (repository.Wallet, error) {
+	args := m.Called(ctx, id, version)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) WriteStatement(ctx context.Context, id uuid.UUID, from, to time.Time, w service.StatementWriter) error {
+	args := m.Called(ctx, id, from, to, w)
+	return args.Error(0)
+}
+
+func (m *MockWalletService) ListOwnerWallets(ctx context.Context, ownerID, afterID uuid.UUID, limit int32) ([]repository.Wallet, error) {
+	args := m.Called(ctx, ownerID, afterID, limit)
+	return args.Get(0).([]repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) OpenWallet(ctx context.Context, w service.NewWallet) (repository.Wallet, error) {
+	args := m.Called(ctx, w)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) SetWalletDetails(ctx context.Context, id uuid.UUID, details service.WalletDetails) (repository.Wallet, error) {
+	args := m.Called(ctx, id, details)
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
-func setupTestRouter(mockService *MockWalletService) *gin.Engine {
+func (m *MockWalletService) SearchWallets(ctx context.Context, search service.WalletSearch) ([]repository.Wallet, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).([]repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) ReverseOperation(ctx context.Context, id uuid.UUID, amount int32) (service.Reversal, error) {
+	args := m.Called(ctx, id, amount)
+	return args.Get(0).(service.Reversal), args.Error(1)
+}
+
+type MockConsistencyTokens struct {
+	mock.Mock
+}
+
+func (m *MockConsistencyTokens) ConsistencyToken(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockConsistencyTokens) ReadAfter(ctx context.Context, token string) (context.Context, error) {
+	args := m.Called(ctx, token)
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, tokenKey{}, token), nil
+}
+
+type tokenKey struct{}
+
+func setupTestRouter(mockService *MockWalletService, opts ...Option) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 
-	handler := NewWalletHandler(mockService)
+	handler := NewWalletHandler(mockService, opts...)
 
 	r := gin.New()
+	r.Use(Problems())
 	v1 := r.Group("/api/v1")
+	v1.POST("/wallets", handler.CreateWallet)
+	v1.GET("/wallets", handler.ListWallets)
 	v1.GET("/wallets/:id", handler.GetWallet)
+	v1.PATCH("/wallets/:id", handler.UpdateWallet)
+	v1.GET("/wallets/:id/stream", handler.StreamWallet)
+	v1.GET("/wallets/:id/statement", handler.GetStatement)
 	v1.POST("/wallet", handler.UpdateWalletBalance)
+	v1.POST("/transactions/:id/reverse", handler.ReverseTransaction)
 
 	return r
 }
@@ -81,12 +144,8 @@ func TestWalletHandler_GetWallet_InvalidID(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Invalid wallet ID", response["error"])
+	problem := assertProblem(t, w, http.StatusBadRequest, "INVALID_PARAMETER")
+	assert.Equal(t, "Invalid wallet ID", problem.Detail)
 }
 
 func TestWalletHandler_GetWallet_ServiceError(t *testing.T) {
@@ -101,12 +160,8 @@ func TestWalletHandler_GetWallet_ServiceError(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "database error", response["error"])
+	problem := assertProblem(t, w, http.StatusInternalServerError, "INTERNAL_ERROR")
+	assert.Empty(t, problem.Detail, "internal errors are not disclosed")
 
 	mockService.AssertExpectations(t)
 }
@@ -127,7 +182,7 @@ func TestWalletHandler_UpdateWalletBalance_Deposit_Success(t *testing.T) {
 		Balance: 1500,
 	}
 
-	mockService.On("TopUpWalletBalance", mock.Anything, walletID, int32(500)).Return(expectedWallet, nil)
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(500)).Return(service.BalanceChange{Wallet: expectedWallet}, nil)
 
 	jsonBody, _ := json.Marshal(requestBody)
 	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
@@ -165,7 +220,7 @@ func TestWalletHandler_UpdateWalletBalance_Withdraw_Success(t *testing.T) {
 		Balance: 700,
 	}
 
-	mockService.On("TopUpWalletBalance", mock.Anything, walletID, int32(-300)).Return(expectedWallet, nil)
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(-300)).Return(service.BalanceChange{Wallet: expectedWallet, Fee: 5}, nil)
 
 	jsonBody, _ := json.Marshal(requestBody)
 	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
@@ -183,6 +238,7 @@ func TestWalletHandler_UpdateWalletBalance_Withdraw_Success(t *testing.T) {
 	wallet := response["wallet"].(map[string]interface{})
 	assert.Equal(t, walletID.String(), wallet["id"])
 	assert.Equal(t, float64(700), wallet["balance"])
+	assert.Equal(t, float64(5), response["fee"])
 
 	mockService.AssertExpectations(t)
 }
@@ -218,12 +274,8 @@ func TestWalletHandler_UpdateWalletBalance_InvalidOperationType(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Invalid operation type", response["error"])
+	problem := assertProblem(t, w, http.StatusBadRequest, "VALIDATION_FAILED")
+	assert.Equal(t, []FieldError{{Field: "operationType", Code: "ONE_OF", Detail: "must be one of DEPOSIT, WITHDRAW"}}, problem.Errors)
 }
 
 func TestWalletHandler_UpdateWalletBalance_InvalidWalletID(t *testing.T) {
@@ -243,12 +295,8 @@ func TestWalletHandler_UpdateWalletBalance_InvalidWalletID(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Invalid wallet ID", response["error"])
+	problem := assertProblem(t, w, http.StatusBadRequest, "VALIDATION_FAILED")
+	assert.Equal(t, []FieldError{{Field: "walletId", Code: "UUID", Detail: "must be a UUID"}}, problem.Errors)
 }
 
 func TestWalletHandler_UpdateWalletBalance_ServiceError(t *testing.T) {
@@ -262,7 +310,7 @@ func TestWalletHandler_UpdateWalletBalance_ServiceError(t *testing.T) {
 		OperationType: models.OperationDeposit,
 	}
 
-	mockService.On("TopUpWalletBalance", mock.Anything, walletID, int32(500)).Return(repository.Wallet{}, errors.New("database error"))
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(500)).Return(service.BalanceChange{}, errors.New("database error"))
 
 	jsonBody, _ := json.Marshal(requestBody)
 	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
@@ -271,12 +319,164 @@ func TestWalletHandler_UpdateWalletBalance_ServiceError(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	problem := assertProblem(t, w, http.StatusInternalServerError, "INTERNAL_ERROR")
+	assert.Empty(t, problem.Detail)
 
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "Failed to update wallet balance", response["error"])
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetWallet_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("GetWalletByID", mock.Anything, walletID).Return(repository.Wallet{}, service.ErrWalletNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	problem := assertProblem(t, w, http.StatusNotFound, "WALLET_NOT_FOUND")
+	assert.Equal(t, "Wallet not found", problem.Title)
 
 	mockService.AssertExpectations(t)
 }
+
+func TestWalletHandler_UpdateWalletBalance_Rejected(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+		code     string
+		title    string
+	}{
+		{service.ErrWalletNotFound, http.StatusNotFound, "WALLET_NOT_FOUND", "Wallet not found"},
+		{service.ErrWalletFrozen, http.StatusConflict, "WALLET_FROZEN", "Wallet is frozen"},
+		{service.ErrInsufficientFunds, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", "Insufficient funds"},
+	}
+
+	for _, tc := range testCases {
+		mockService := new(MockWalletService)
+		router := setupTestRouter(mockService)
+
+		walletID := uuid.New()
+		requestBody := UpdateBalanceRequest{
+			Amount:        300,
+			WalletID:      walletID.String(),
+			OperationType: models.OperationWithdraw,
+		}
+
+		mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(-300)).Return(service.BalanceChange{}, tc.err)
+
+		jsonBody, _ := json.Marshal(requestBody)
+		req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.title, assertProblem(t, w, tc.expected, tc.code).Title)
+
+		mockService.AssertExpectations(t)
+	}
+}
+
+func TestWalletHandler_UpdateWalletBalance_ReturnsConsistencyToken(t *testing.T) {
+	mockService := new(MockWalletService)
+	mockTokens := new(MockConsistencyTokens)
+	router := setupTestRouter(mockService, WithConsistencyTokens(mockTokens))
+
+	walletID := uuid.New()
+
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(500)).Return(service.BalanceChange{Wallet: repository.Wallet{ID: walletID, Balance: 500}}, nil)
+	mockTokens.On("ConsistencyToken", mock.Anything).Return("0/16B3748", nil)
+
+	jsonBody, _ := json.Marshal(UpdateBalanceRequest{
+		Amount:        500,
+		WalletID:      walletID.String(),
+		OperationType: models.OperationDeposit,
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0/16B3748", w.Header().Get(ConsistencyTokenHeader))
+
+	mockService.AssertExpectations(t)
+	mockTokens.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetWallet_ReadAfterToken(t *testing.T) {
+	mockService := new(MockWalletService)
+	mockTokens := new(MockConsistencyTokens)
+	router := setupTestRouter(mockService, WithConsistencyTokens(mockTokens))
+
+	walletID := uuid.New()
+	withToken := mock.MatchedBy(func(ctx context.Context) bool {
+		return ctx.Value(tokenKey{}) == "0/16B3748"
+	})
+
+	mockTokens.On("ReadAfter", mock.Anything, "0/16B3748").Return(nil, nil)
+	mockService.On("GetWalletByID", withToken, walletID).Return(repository.Wallet{ID: walletID}, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+walletID.String(), nil)
+	req.Header.Set(ConsistencyTokenHeader, "0/16B3748")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockService.AssertExpectations(t)
+	mockTokens.AssertExpectations(t)
+}
+
+func TestWalletHandler_GetWallet_InvalidToken(t *testing.T) {
+	mockService := new(MockWalletService)
+	mockTokens := new(MockConsistencyTokens)
+	router := setupTestRouter(mockService, WithConsistencyTokens(mockTokens))
+
+	mockTokens.On("ReadAfter", mock.Anything, "garbage").Return(nil, errors.New("invalid LSN"))
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+uuid.New().String(), nil)
+	req.Header.Set(ConsistencyTokenHeader, "garbage")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertNotCalled(t, "GetWalletByID", mock.Anything, mock.Anything)
+}
+
+func TestWalletHandler_UpdateWalletBalance_RequestID(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("ChangeWalletBalance", mock.Anything, walletID, int32(500)).Return(service.BalanceChange{Wallet: repository.Wallet{ID: walletID}}, nil)
+
+	post := func(requestID string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(UpdateBalanceRequest{Amount: 500, WalletID: walletID.String(), OperationType: models.OperationDeposit})
+		req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("req-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+
+	w = post("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := uuid.Parse(w.Header().Get(RequestIDHeader))
+	assert.NoError(t, err, "a request ID is generated")
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+)
+
+type CreateWalletRequest struct {
+	Currency string            `json:"currency"`
+	Metadata json.RawMessage   `json:"metadata"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// UpdateWalletRequest replaces the fields it has and leaves out the others.
+type UpdateWalletRequest struct {
+	Metadata json.RawMessage   `json:"metadata"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// walletSortKeys maps the sort query parameter to the service sort keys.
+var walletSortKeys = map[string]string{
+	"id":        service.SortByID,
+	"balance":   service.SortByBalance,
+	"createdAt": service.SortByCreatedAt,
+}
+
+func (h *WalletHandler) CreateWallet(c *gin.Context) {
+	var req CreateWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	wallet, err := h.service.OpenWallet(auditContext(c), service.NewWallet{
+		Currency: req.Currency,
+		Metadata: req.Metadata,
+		Labels:   req.Labels,
+	})
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, wallet)
+}
+
+func (h *WalletHandler) UpdateWallet(c *gin.Context) {
+	walletID, ok := walletIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortBind(c, err)
+		return
+	}
+
+	wallet, err := h.service.SetWalletDetails(auditContext(c), walletID, service.WalletDetails{
+		Metadata: req.Metadata,
+		Labels:   req.Labels,
+	})
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// ListWallets searches wallets. status, currency, labels (a label selector
+// like "env=prod,tier!=gold,vip,!closed"), minBalance and maxBalance
+// (inclusive), createdFrom and createdTo narrow them down; sort is id,
+// balance or createdAt, prefixed with "-" for descending order. afterId is
+// the last wallet of the previous page.
+func (h *WalletHandler) ListWallets(c *gin.Context) {
+	search := service.WalletSearch{
+		Status:   models.WalletStatus(c.Query("status")),
+		Currency: c.Query("currency"),
+	}
+
+	var err error
+	if search.Labels, err = service.ParseLabelSelector(c.Query("labels")); err != nil {
+		abort(c, err)
+		return
+	}
+
+	for name, bound := range map[string]**int32{"minBalance": &search.MinBalance, "maxBalance": &search.MaxBalance} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			abort(c, invalidParameter("Invalid "+name))
+			return
+		}
+		balance := int32(n)
+		*bound = &balance
+	}
+
+	if value := c.Query("createdFrom"); value != "" {
+		if search.CreatedFrom, err = parseStatementTime(value); err != nil {
+			abort(c, invalidParameter("Invalid createdFrom"))
+			return
+		}
+	}
+
+	if value := c.Query("createdTo"); value != "" {
+		if search.CreatedTo, err = parseStatementTime(value); err != nil {
+			abort(c, invalidParameter("Invalid createdTo"))
+			return
+		}
+	}
+
+	if value := c.Query("sort"); value != "" {
+		key, descending := strings.CutPrefix(value, "-")
+		sortBy, ok := walletSortKeys[key]
+		if !ok {
+			abort(c, invalidParameter("Invalid sort: expected id, balance or createdAt"))
+			return
+		}
+		search.SortBy, search.Descending = sortBy, descending
+	}
+
+	if value := c.Query("afterId"); value != "" {
+		if search.AfterID, err = uuid.Parse(value); err != nil {
+			abort(c, invalidParameter("Invalid afterId"))
+			return
+		}
+	}
+
+	var ok bool
+	if search.Limit, ok = pageSize(c); !ok {
+		return
+	}
+
+	wallets, err := h.service.SearchWallets(c, search)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nonNil(wallets))
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletHandler_CreateWallet(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	wallet := repository.Wallet{ID: uuid.New(), Currency: "EUR", Metadata: json.RawMessage(`{"note":"savings"}`), Labels: json.RawMessage(`{"env":"prod"}`)}
+	mockService.On("OpenWallet", mock.Anything, service.NewWallet{
+		Currency: "EUR",
+		Metadata: json.RawMessage(`{"note": "savings"}`),
+		Labels:   map[string]string{"env": "prod"},
+	}).Return(wallet, nil)
+
+	body := `{"currency": "EUR", "metadata": {"note": "savings"}, "labels": {"env": "prod"}}`
+	req, _ := http.NewRequest("POST", "/api/v1/wallets", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var got repository.Wallet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, wallet.ID, got.ID)
+	assert.JSONEq(t, `{"env": "prod"}`, string(got.Labels))
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_CreateWallet_Invalid(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	mockService.On("OpenWallet", mock.Anything, mock.Anything).
+		Return(repository.Wallet{}, errors.Join(service.ErrInvalidWallet, errors.New("invalid currency")))
+
+	for _, body := range []string{`{"labels": ["env"]}`, `{"currency": "EURO"}`} {
+		req, _ := http.NewRequest("POST", "/api/v1/wallets", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	mockService.AssertNumberOfCalls(t, "OpenWallet", 1)
+}
+
+func TestWalletHandler_UpdateWallet(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	walletID := uuid.New()
+	mockService.On("SetWalletDetails", mock.Anything, walletID, service.WalletDetails{Labels: map[string]string{}}).
+		Return(repository.Wallet{ID: walletID}, nil)
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/wallets/"+walletID.String(), bytes.NewBufferString(`{"labels": {}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	missing := uuid.New()
+	mockService.On("SetWalletDetails", mock.Anything, missing, mock.Anything).
+		Return(repository.Wallet{}, service.ErrWalletNotFound)
+
+	req, _ = http.NewRequest("PATCH", "/api/v1/wallets/"+missing.String(), bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_ListWallets(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	afterID := uuid.New()
+	minBalance, maxBalance := int32(-5), int32(100)
+	search := service.WalletSearch{
+		Status:   models.WalletStatusActive,
+		Currency: "EUR",
+		Labels: service.LabelSelector{
+			Match: map[string]string{"env": "prod"},
+			Not:   map[string]string{"tier": "gold"},
+		},
+		MinBalance:  &minBalance,
+		MaxBalance:  &maxBalance,
+		CreatedFrom: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedTo:   time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		SortBy:      service.SortByCreatedAt,
+		Descending:  true,
+		AfterID:     afterID,
+		Limit:       20,
+	}
+	mockService.On("SearchWallets", mock.Anything, search).Return([]repository.Wallet(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets?status=ACTIVE&currency=EUR&labels=env%3Dprod,tier!%3Dgold"+
+		"&minBalance=-5&maxBalance=100&createdFrom=2025-01-01&createdTo=2025-02-01&sort=-createdAt"+
+		"&afterId="+afterID.String()+"&limit=20", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWalletHandler_ListWallets_BadRequest(t *testing.T) {
+	mockService := new(MockWalletService)
+	router := setupTestRouter(mockService)
+
+	mockService.On("SearchWallets", mock.Anything, mock.Anything).
+		Return([]repository.Wallet(nil), errors.Join(service.ErrInvalidWalletSearch, errors.New("unknown status")))
+
+	for _, query := range []string{
+		"labels=env%3D%3Dprod",
+		"minBalance=lots",
+		"maxBalance=3000000000",
+		"createdFrom=yesterday",
+		"createdTo=tomorrow",
+		"sort=name",
+		"sort=%2Bbalance",
+		"afterId=nope",
+		"limit=0",
+		"status=CLOSED",
+	} {
+		req, _ := http.NewRequest("GET", "/api/v1/wallets?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mockService.AssertNumberOfCalls(t, "SearchWallets", 1)
+}
@@ -0,0 +1,21 @@
+package models
+
+type AuditAction string
+
+const (
+	AuditActionBalanceChange AuditAction = "BALANCE_CHANGE"
+	AuditActionStatusChange  AuditAction = "STATUS_CHANGE"
+	// AuditActionShardsChange is a change of the number of credit shards.
+	AuditActionShardsChange AuditAction = "SHARDS_CHANGE"
+	AuditActionReversal     AuditAction = "REVERSAL"
+	AuditActionWalletCreate AuditAction = "WALLET_CREATE"
+	// AuditActionDetailsChange is a change of the metadata or the labels.
+	AuditActionDetailsChange AuditAction = "DETAILS_CHANGE"
+	// AuditActionTransfer and AuditActionExchange are recorded for both
+	// wallets, AuditActionImport once per wallet an import changed.
+	AuditActionTransfer AuditAction = "TRANSFER"
+	AuditActionExchange AuditAction = "EXCHANGE"
+	AuditActionImport   AuditAction = "IMPORT"
+	// AuditActionInterestChange is a change of the interest product or rate.
+	AuditActionInterestChange AuditAction = "INTEREST_CHANGE"
+)
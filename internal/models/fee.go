@@ -0,0 +1,10 @@
+package models
+
+type FeeKind string
+
+const (
+	FeeKindFlat       FeeKind = "FLAT"
+	FeeKindPercentage FeeKind = "PERCENTAGE"
+	// FeeKindTiered prices an amount by the tier it falls in.
+	FeeKindTiered FeeKind = "TIERED"
+)
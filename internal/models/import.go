@@ -0,0 +1,11 @@
+package models
+
+type ImportStatus string
+
+const (
+	// ImportStatusPending is an import whose rows are staged but not
+	// applied yet.
+	ImportStatusPending  ImportStatus = "PENDING"
+	ImportStatusApplied  ImportStatus = "APPLIED"
+	ImportStatusRejected ImportStatus = "REJECTED"
+)
@@ -0,0 +1,23 @@
+package models
+
+// DayCount is the convention for the number of days in a year when an
+// annual rate is turned into a daily one.
+type DayCount string
+
+const (
+	DayCountAct365 DayCount = "ACT/365"
+	DayCountAct360 DayCount = "ACT/360"
+	// DayCountActAct uses the actual length of the year of each day.
+	DayCountActAct DayCount = "ACT/ACT"
+)
+
+type Rounding string
+
+const (
+	// RoundingHalfUp rounds halves away from zero.
+	RoundingHalfUp Rounding = "HALF_UP"
+	// RoundingHalfEven rounds halves to the even neighbour, as banks do.
+	RoundingHalfEven Rounding = "HALF_EVEN"
+	// RoundingDown truncates towards zero.
+	RoundingDown Rounding = "DOWN"
+)
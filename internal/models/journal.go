@@ -0,0 +1,23 @@
+package models
+
+// JournalAccount is an account journal legs are booked on: a wallet or one
+// of the system accounts.
+type JournalAccount string
+
+const (
+	JournalAccountWallet  JournalAccount = "wallet"
+	JournalAccountCashIn  JournalAccount = "cash_in"
+	JournalAccountCashOut JournalAccount = "cash_out"
+	// JournalAccountFees clears the fees charged to wallets into the fee
+	// wallet.
+	JournalAccountFees        JournalAccount = "fees"
+	JournalAccountAdjustments JournalAccount = "adjustments"
+	// JournalAccountOpening holds the balances that predate the journal.
+	JournalAccountOpening JournalAccount = "opening"
+	// JournalAccountExchange takes one currency in and pays another out
+	// when wallets convert.
+	JournalAccountExchange JournalAccount = "exchange"
+	// JournalAccountInterest is the expense of the interest paid to
+	// wallets.
+	JournalAccountInterest JournalAccount = "interest"
+)
@@ -0,0 +1,17 @@
+package models
+
+type ScheduleStatus string
+
+const (
+	ScheduleStatusActive ScheduleStatus = "ACTIVE"
+	ScheduleStatusPaused ScheduleStatus = "PAUSED"
+	// ScheduleStatusDone marks a one-off operation that has run.
+	ScheduleStatusDone ScheduleStatus = "DONE"
+)
+
+type RunStatus string
+
+const (
+	RunStatusSucceeded RunStatus = "SUCCEEDED"
+	RunStatusFailed    RunStatus = "FAILED"
+)
@@ -3,6 +3,21 @@ package models
 type OperationType string
 
 const (
-	OperationDeposit  OperationType = "DEPOSIT"
-	OperationWithdraw OperationType = "WITHDRAW"
+	OperationDeposit    OperationType = "DEPOSIT"
+	OperationWithdraw   OperationType = "WITHDRAW"
+	OperationAdjustment OperationType = "ADJUSTMENT"
+	// OperationTransfer is a leg of a transfer: one is recorded on each
+	// wallet, each linked to the other as its counterpart.
+	OperationTransfer OperationType = "TRANSFER"
+	// OperationFee is a fee charged for another operation, recorded on both
+	// the charged wallet and the fee wallet.
+	OperationFee OperationType = "FEE"
+	// OperationReversal reverses all or part of an earlier operation of the
+	// same wallet.
+	OperationReversal OperationType = "REVERSAL"
+	// OperationExchange is either side of a currency conversion between two
+	// wallets of the same owner.
+	OperationExchange OperationType = "EXCHANGE"
+	// OperationInterest pays out the interest accrued on a wallet.
+	OperationInterest OperationType = "INTEREST"
 )
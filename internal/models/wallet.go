@@ -0,0 +1,8 @@
+package models
+
+type WalletStatus string
+
+const (
+	WalletStatusActive WalletStatus = "ACTIVE"
+	WalletStatusFrozen WalletStatus = "FROZEN"
+)
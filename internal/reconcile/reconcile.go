@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+const DefaultPageSize = 1000
+
+type StoreInterface interface {
+	ListWalletLedgerPage(ctx context.Context, arg repository.ListWalletLedgerPageParams) ([]repository.ListWalletLedgerPageRow, error)
+	RepairWallet(ctx context.Context, id uuid.UUID) (repository.Operation, error)
+}
+
+// Discrepancy is a wallet whose stored balance differs from the sum of its
+// recorded operations.
+type Discrepancy struct {
+	WalletID      uuid.UUID `json:"walletId"`
+	Balance       int64     `json:"balance"`
+	LedgerBalance int64     `json:"ledgerBalance"`
+	Difference    int64     `json:"difference"`
+	Repaired      bool      `json:"repaired"`
+}
+
+type Summary struct {
+	Checked    int `json:"checked"`
+	Mismatched int `json:"mismatched"`
+	Repaired   int `json:"repaired"`
+}
+
+type Reconciler struct {
+	store    StoreInterface
+	pageSize int32
+}
+
+func NewReconciler(store StoreInterface, pageSize int32) *Reconciler {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	return &Reconciler{
+		store:    store,
+		pageSize: pageSize,
+	}
+}
+
+// Run walks all wallets page by page and calls report for every discrepancy.
+// With repair set, each mismatch gets a compensating ADJUSTMENT operation so
+// that the ledger matches wallets.balance again.
+func (r *Reconciler) Run(ctx context.Context, repair bool, report func(Discrepancy) error) (Summary, error) {
+	var summary Summary
+
+	afterID := uuid.Nil
+
+	for {
+		rows, err := r.store.ListWalletLedgerPage(ctx, repository.ListWalletLedgerPageParams{
+			AfterID:  afterID,
+			PageSize: r.pageSize,
+		})
+		if err != nil {
+			return summary, fmt.Errorf("failed to list wallets after %s: %w", afterID, err)
+		}
+
+		for _, row := range rows {
+			summary.Checked++
+
+			diff := row.Balance - row.LedgerBalance
+			if diff == 0 {
+				continue
+			}
+
+			summary.Mismatched++
+
+			discrepancy := Discrepancy{
+				WalletID:      row.ID,
+				Balance:       row.Balance,
+				LedgerBalance: row.LedgerBalance,
+				Difference:    diff,
+			}
+
+			if repair {
+				if diff < math.MinInt32 || diff > math.MaxInt32 {
+					return summary, fmt.Errorf("wallet %s: %w: %d", row.ID, ErrDifferenceTooLarge, diff)
+				}
+
+				// A concurrent repair may have fixed the wallet in the meantime;
+				// then this run repaired nothing.
+				_, err := r.store.RepairWallet(ctx, row.ID)
+				switch {
+				case errors.Is(err, ErrNothingToRepair):
+				case err != nil:
+					return summary, fmt.Errorf("failed to repair wallet %s: %w", row.ID, err)
+				default:
+					discrepancy.Repaired = true
+					summary.Repaired++
+				}
+			}
+
+			if err := report(discrepancy); err != nil {
+				return summary, err
+			}
+		}
+
+		if len(rows) < int(r.pageSize) {
+			return summary, nil
+		}
+
+		afterID = rows[len(rows)-1].ID
+	}
+}
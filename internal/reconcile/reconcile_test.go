@@ -0,0 +1,187 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListWalletLedgerPage(ctx context.Context, arg repository.ListWalletLedgerPageParams) ([]repository.ListWalletLedgerPageRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]repository.ListWalletLedgerPageRow), args.Error(1)
+}
+
+func (m *MockStore) RepairWallet(ctx context.Context, id uuid.UUID) (repository.Operation, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.Operation), args.Error(1)
+}
+
+func collect(discrepancies *[]Discrepancy) func(Discrepancy) error {
+	return func(d Discrepancy) error {
+		*discrepancies = append(*discrepancies, d)
+		return nil
+	}
+}
+
+func TestReconciler_Run_Pages(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 2)
+
+	ctx := context.Background()
+	first := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	second := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	third := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+
+	mockStore.On("ListWalletLedgerPage", ctx, repository.ListWalletLedgerPageParams{AfterID: uuid.Nil, PageSize: 2}).
+		Return([]repository.ListWalletLedgerPageRow{
+			{ID: first, Balance: 100, LedgerBalance: 100},
+			{ID: second, Balance: 50, LedgerBalance: 80},
+		}, nil)
+	mockStore.On("ListWalletLedgerPage", ctx, repository.ListWalletLedgerPageParams{AfterID: second, PageSize: 2}).
+		Return([]repository.ListWalletLedgerPageRow{
+			{ID: third, Balance: 0, LedgerBalance: 0},
+		}, nil)
+
+	var discrepancies []Discrepancy
+	summary, err := reconciler.Run(ctx, false, collect(&discrepancies))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Checked: 3, Mismatched: 1}, summary)
+	assert.Equal(t, []Discrepancy{{WalletID: second, Balance: 50, LedgerBalance: 80, Difference: -30}}, discrepancies)
+
+	mockStore.AssertExpectations(t)
+	mockStore.AssertNotCalled(t, "RepairWallet", mock.Anything, mock.Anything)
+}
+
+func TestReconciler_Run_Repair(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 10)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockStore.On("ListWalletLedgerPage", ctx, repository.ListWalletLedgerPageParams{AfterID: uuid.Nil, PageSize: 10}).
+		Return([]repository.ListWalletLedgerPageRow{{ID: walletID, Balance: 70, LedgerBalance: 20}}, nil)
+	mockStore.On("RepairWallet", ctx, walletID).Return(repository.Operation{Amount: 50}, nil)
+
+	var discrepancies []Discrepancy
+	summary, err := reconciler.Run(ctx, true, collect(&discrepancies))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Checked: 1, Mismatched: 1, Repaired: 1}, summary)
+	assert.True(t, discrepancies[0].Repaired)
+	assert.Equal(t, int64(50), discrepancies[0].Difference)
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestReconciler_Run_AlreadyRepaired(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 10)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockStore.On("ListWalletLedgerPage", ctx, mock.Anything).
+		Return([]repository.ListWalletLedgerPageRow{{ID: walletID, Balance: 70, LedgerBalance: 20}}, nil)
+	mockStore.On("RepairWallet", ctx, walletID).Return(repository.Operation{}, ErrNothingToRepair)
+
+	var discrepancies []Discrepancy
+	summary, err := reconciler.Run(ctx, true, collect(&discrepancies))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Checked: 1, Mismatched: 1}, summary)
+	assert.False(t, discrepancies[0].Repaired, "a concurrent repair is not counted")
+}
+
+func TestReconciler_Run_RepairError(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 10)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+	expectedError := errors.New("database error")
+
+	mockStore.On("ListWalletLedgerPage", ctx, mock.Anything).
+		Return([]repository.ListWalletLedgerPageRow{{ID: walletID, Balance: 70, LedgerBalance: 20}}, nil)
+	mockStore.On("RepairWallet", ctx, walletID).Return(repository.Operation{}, expectedError)
+
+	summary, err := reconciler.Run(ctx, true, func(Discrepancy) error { return nil })
+
+	assert.ErrorIs(t, err, expectedError)
+	assert.Equal(t, 0, summary.Repaired)
+}
+
+func TestReconciler_Run_DifferenceTooLarge(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 10)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockStore.On("ListWalletLedgerPage", ctx, mock.Anything).
+		Return([]repository.ListWalletLedgerPageRow{{ID: walletID, Balance: math.MaxInt32, LedgerBalance: -1}}, nil)
+
+	summary, err := reconciler.Run(ctx, true, func(Discrepancy) error { return nil })
+
+	assert.ErrorIs(t, err, ErrDifferenceTooLarge)
+	assert.Equal(t, 0, summary.Repaired)
+	mockStore.AssertNotCalled(t, "RepairWallet", mock.Anything, mock.Anything)
+}
+
+func TestReconciler_Run_ListError(t *testing.T) {
+	mockStore := new(MockStore)
+	reconciler := NewReconciler(mockStore, 10)
+
+	ctx := context.Background()
+	expectedError := errors.New("database error")
+
+	mockStore.On("ListWalletLedgerPage", ctx, mock.Anything).
+		Return([]repository.ListWalletLedgerPageRow(nil), expectedError)
+
+	_, err := reconciler.Run(ctx, false, func(Discrepancy) error { return nil })
+
+	assert.ErrorIs(t, err, expectedError)
+}
+
+func TestNewWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewWriter(FormatCSV, &buf)
+	assert.NoError(t, err)
+
+	walletID := uuid.MustParse("8e3449a8-5cbc-4159-a8e2-45eea1eebdb1")
+	assert.NoError(t, writer.Write(Discrepancy{WalletID: walletID, Balance: 10, LedgerBalance: 15, Difference: -5}))
+	assert.NoError(t, writer.Flush())
+
+	assert.Equal(t, "wallet_id,balance,ledger_balance,difference,repaired\n"+
+		"8e3449a8-5cbc-4159-a8e2-45eea1eebdb1,10,15,-5,false\n", buf.String())
+}
+
+func TestNewWriter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewWriter(FormatJSON, &buf)
+	assert.NoError(t, err)
+
+	walletID := uuid.MustParse("8e3449a8-5cbc-4159-a8e2-45eea1eebdb1")
+	assert.NoError(t, writer.Write(Discrepancy{WalletID: walletID, Balance: 10, LedgerBalance: 15, Difference: -5}))
+
+	assert.JSONEq(t, `{"walletId":"8e3449a8-5cbc-4159-a8e2-45eea1eebdb1","balance":10,"ledgerBalance":15,"difference":-5,"repaired":false}`, buf.String())
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter("xml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrNothingToRepair    = errors.New("wallet balance already matches its operations")
+	ErrDifferenceTooLarge = errors.New("difference does not fit into one adjustment")
+)
+
+type Store struct {
+	*repository.Queries
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{
+		Queries: repository.New(pool),
+		pool:    pool,
+	}
+}
+
+// RepairWallet locks the wallet and its shards, recomputes the difference and
+// records it as an ADJUSTMENT operation. The locks make the ledger sum include
+// every operation committed before the adjustment. The difference is
+// checked again under them, since it may have grown since it was listed. The
+// balance does not change, so there is nothing to book in the journal.
+func (s *Store) RepairWallet(ctx context.Context, id uuid.UUID) (repository.Operation, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return repository.Operation{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	q := s.Queries.WithTx(tx)
+
+	wallet, err := q.GetWalletByIDForUpdate(ctx, id)
+	if err != nil {
+		return repository.Operation{}, err
+	}
+
+	shardsBalance, err := q.LockWalletShards(ctx, id)
+	if err != nil {
+		return repository.Operation{}, err
+	}
+
+	ledgerBalance, err := q.GetWalletLedgerBalance(ctx, id)
+	if err != nil {
+		return repository.Operation{}, err
+	}
+
+	diff := int64(wallet.Balance) + shardsBalance - ledgerBalance
+	if diff == 0 {
+		return repository.Operation{}, ErrNothingToRepair
+	}
+	if diff < math.MinInt32 || diff > math.MaxInt32 {
+		return repository.Operation{}, fmt.Errorf("%w: %d", ErrDifferenceTooLarge, diff)
+	}
+
+	operation, err := q.CreateOperation(ctx, repository.CreateOperationParams{
+		WalletID:      id,
+		OperationType: string(models.OperationAdjustment),
+		Amount:        int32(diff),
+	})
+	if err != nil {
+		return repository.Operation{}, err
+	}
+
+	return operation, tx.Commit(ctx)
+}
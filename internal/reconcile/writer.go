@@ -0,0 +1,71 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+type Writer interface {
+	Write(d Discrepancy) error
+	Flush() error
+}
+
+// NewWriter returns a writer for the given format. JSON output is one object
+// per line so that large reports can be streamed.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) Write(d Discrepancy) error {
+	return w.enc.Encode(d)
+}
+
+func (w *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(d Discrepancy) error {
+	if !w.headerWritten {
+		if err := w.w.Write([]string{"wallet_id", "balance", "ledger_balance", "difference", "repaired"}); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+
+	return w.w.Write([]string{
+		d.WalletID.String(),
+		strconv.FormatInt(d.Balance, 10),
+		strconv.FormatInt(d.LedgerBalance, 10),
+		strconv.FormatInt(d.Difference, 10),
+		strconv.FormatBool(d.Repaired),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,629 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/handler"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminKey authorizes the admin routes of newFullStack.
+const adminKey = "admin-key"
+
+// newFullStack wires the real handler and service to the in-memory store.
+// Requests without an Authorization header act for the default tenant, or
+// as the operator on the admin routes.
+func newFullStack(t *testing.T) (http.Handler, *service.WalletService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.NewStore()
+	store.AddWallet(service.DefaultFeeWalletID)
+
+	walletService := service.NewWalletService(store, service.WithFees(service.DefaultFeeWalletID))
+	key, err := walletService.IssueTenantKey(context.Background(), service.DefaultTenantID)
+	require.NoError(t, err)
+
+	r := SetupRouter(
+		handler.NewWalletHandler(walletService),
+		handler.NewScheduleHandler(walletService),
+		handler.NewInterestHandler(walletService),
+		handler.NewFeeHandler(walletService),
+		handler.NewImportHandler(walletService, 0),
+		handler.NewAuditHandler(walletService),
+		handler.NewExchangeHandler(walletService),
+		walletService,
+		adminKey,
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Header.Get("Authorization") != "":
+		case strings.HasPrefix(req.URL.Path, "/api/v1/admin/"):
+			req.Header.Set("Authorization", "Bearer "+adminKey)
+		default:
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		r.ServeHTTP(w, req)
+	}), walletService
+}
+
+func postOperation(r http.Handler, walletID string, operation models.OperationType, amount int32) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(handler.UpdateBalanceRequest{
+		Amount:        amount,
+		WalletID:      walletID,
+		OperationType: operation,
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestFullStack_DepositWithdraw(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 0)
+	require.NoError(t, err)
+	id := wallet.ID.String()
+
+	assert.Equal(t, http.StatusOK, postOperation(r, id, models.OperationDeposit, 1000).Code)
+	assert.Equal(t, http.StatusOK, postOperation(r, id, models.OperationWithdraw, 300).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, postOperation(r, id, models.OperationWithdraw, 701).Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+id, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Balance int32 `json:"balance"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, int32(700), got.Balance)
+
+	history, err := walletService.GetWalletHistory(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, history, 2, "the rejected withdrawal is not recorded")
+}
+
+func TestFullStack_FrozenAndMissing(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 50)
+	require.NoError(t, err)
+
+	_, err = walletService.SetWalletStatus(ctx, wallet.ID, models.WalletStatusFrozen)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusConflict, postOperation(r, wallet.ID.String(), models.OperationDeposit, 1).Code)
+	assert.Equal(t, http.StatusNotFound, postOperation(r, "8e3449a8-5cbc-4159-a8e2-45eea1eebdb9", models.OperationDeposit, 1).Code)
+}
+
+func TestFullStack_ScheduledTransfer(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	parent, err := walletService.CreateWallet(ctx, 100)
+	require.NoError(t, err)
+	child, err := walletService.CreateWallet(ctx, 0)
+	require.NoError(t, err)
+
+	body, _ := json.Marshal(handler.ScheduledOperationRequest{
+		WalletID:       parent.ID.String(),
+		TargetWalletID: child.ID.String(),
+		OperationType:  models.OperationTransfer,
+		Amount:         30,
+		Cron:           "@monthly",
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/scheduled-operations", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var op struct {
+		ID        string    `json:"id"`
+		NextRunAt time.Time `json:"next_run_at"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &op))
+
+	ran, err := walletService.RunDueScheduledOperations(ctx, op.NextRunAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+
+	got, err := walletService.GetWalletByID(ctx, child.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(30), got.Balance)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scheduled-operations/"+op.ID+"/runs", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"SUCCEEDED"`)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scheduled-operations?walletId="+child.ID.String(), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), op.ID)
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/scheduled-operations/"+op.ID, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scheduled-operations/"+op.ID, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFullStack_Interest(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 1000)
+	require.NoError(t, err)
+
+	body, _ := json.Marshal(handler.InterestProductRequest{Name: "savings", AnnualRateBps: 3650})
+	req, _ := http.NewRequest("POST", "/api/v1/admin/interest-products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var product struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+
+	body, _ = json.Marshal(handler.WalletInterestRequest{ProductID: product.ID})
+	req, _ = http.NewRequest("PUT", "/api/v1/wallets/"+wallet.ID.String()+"/interest", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 36.5% a year on 1000 is 1 a day.
+	_, err = walletService.AccrueInterest(ctx, time.Now().AddDate(0, 0, 2))
+	require.NoError(t, err)
+
+	req, _ = http.NewRequest("GET", "/api/v1/wallets/"+wallet.ID.String()+"/interest", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"pending_micros":2000000`)
+}
+
+func TestFullStack_Fees(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 1000)
+	require.NoError(t, err)
+
+	body, _ := json.Marshal(handler.FeeScheduleRequest{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindPercentage,
+		RateBps:       100,
+		MinFee:        2,
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/admin/fee-schedules", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/v1/fees/quote?walletId="+wallet.ID.String()+"&operationType=WITHDRAW&amount=500", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"fee":5`)
+
+	w = postOperation(r, wallet.ID.String(), models.OperationWithdraw, 500)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Wallet struct {
+			Balance int32 `json:"balance"`
+		} `json:"wallet"`
+		Fee int32 `json:"fee"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int32(5), response.Fee)
+	assert.Equal(t, int32(495), response.Wallet.Balance)
+
+	w = postOperation(r, wallet.ID.String(), models.OperationWithdraw, 495)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "the fee must be covered too")
+
+	feeWallet, err := walletService.GetWalletByID(ctx, service.DefaultFeeWalletID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(5), feeWallet.Balance)
+}
+
+func TestFullStack_Statement(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 100)
+	require.NoError(t, err)
+
+	w := postOperation(r, wallet.ID.String(), models.OperationWithdraw, 30)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	req, _ := http.NewRequest("GET", "/api/v1/wallets/"+wallet.ID.String()+"/statement?from=2000-01-01&format=csv", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, "2000-01-01T00:00:00Z,,OPENING_BALANCE,,0", lines[1])
+	assert.Contains(t, lines[2], ",DEPOSIT,100,100")
+	assert.Contains(t, lines[3], ",WITHDRAW,-30,70")
+	assert.Contains(t, lines[4], ",CLOSING_BALANCE,,70")
+
+	req, _ = http.NewRequest("GET", "/api/v1/wallets/"+uuid.NewString()+"/statement?from=2000-01-01", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFullStack_Import(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 10)
+	require.NoError(t, err)
+
+	csv := "walletId,operationType,amount,reference\n" +
+		wallet.ID.String() + ",DEPOSIT,40,INV-1\n" +
+		wallet.ID.String() + ",WITHDRAW,100,INV-2\n"
+
+	req, _ := http.NewRequest("POST", "/api/v1/imports", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var imp service.Import
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imp))
+	assert.Equal(t, string(models.ImportStatusRejected), imp.Status)
+	assert.Equal(t, []service.ImportRowError{{Row: 2, Error: "insufficient funds"}}, imp.Errors)
+
+	req, _ = http.NewRequest("POST", "/api/v1/imports?skipInvalid=true", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imp))
+	assert.Equal(t, string(models.ImportStatusApplied), imp.Status)
+
+	req, _ = http.NewRequest("GET", "/api/v1/imports/"+imp.ID.String(), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"applied_rows":1`)
+
+	got, err := walletService.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(50), got.Balance)
+}
+
+func TestFullStack_Audit(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 0)
+	require.NoError(t, err)
+
+	body, _ := json.Marshal(handler.UpdateBalanceRequest{Amount: 100, WalletID: wallet.ID.String(), OperationType: models.OperationDeposit})
+	req, _ := http.NewRequest("POST", "/api/v1/wallet", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "admin")
+	req.Header.Set(handler.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, postOperation(r, wallet.ID.String(), models.OperationWithdraw, 500).Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/audit?walletId="+wallet.ID.String(), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entries []service.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "tenant:"+service.DefaultTenantID.String(), entries[0].Actor, "the actor is the tenant of the API key, not X-Actor")
+	assert.Equal(t, "req-1", entries[0].RequestID)
+	assert.Equal(t, int32(0), entries[0].Before.Balance)
+	assert.Equal(t, int32(100), entries[0].After.Balance)
+
+	req, _ = http.NewRequest("GET", "/api/v1/audit?actor=someone-else", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestFullStack_Tenants(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	acme, err := walletService.CreateTenant(ctx, "acme")
+	require.NoError(t, err)
+
+	ownerID := uuid.New()
+	wallet, err := walletService.CreateWallet(service.WithTenant(ctx, acme.ID), 0)
+	require.NoError(t, err)
+	_, err = walletService.SetWalletOwner(ctx, wallet.ID, ownerID)
+	require.NoError(t, err)
+
+	acmeKey, err := walletService.IssueTenantKey(ctx, acme.ID)
+	require.NoError(t, err)
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/api/v1/wallets/"+wallet.ID.String(), acmeKey).Code)
+	assert.Equal(t, http.StatusNotFound, postOperation(r, wallet.ID.String(), models.OperationDeposit, 1).Code,
+		"the key of the default tenant does not reach the wallets of acme")
+
+	w := get("/api/v1/owners/"+ownerID.String()+"/wallets", acmeKey)
+	require.Equal(t, http.StatusOK, w.Code)
+	var wallets []struct {
+		ID uuid.UUID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &wallets))
+	require.Len(t, wallets, 1)
+	assert.Equal(t, wallet.ID, wallets[0].ID)
+
+	// A new key replaces the previous one.
+	newKey, err := walletService.IssueTenantKey(ctx, acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get("/api/v1/wallets/"+wallet.ID.String(), newKey).Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/v1/wallets/"+wallet.ID.String(), acmeKey).Code)
+
+	w = get("/api/v1/audit", "itk_not-a-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+
+	req, _ := http.NewRequest("GET", "/api/v1/audit", nil)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "requests without an API key act for no tenant")
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestFullStack_WalletSearch(t *testing.T) {
+	r, _ := newFullStack(t)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	var ids []uuid.UUID
+	for _, body := range []string{
+		`{"currency": "EUR", "labels": {"env": "prod"}}`,
+		`{"currency": "EUR", "labels": {"env": "test"}, "metadata": {"note": "sandbox"}}`,
+		`{"currency": "USD", "labels": {"env": "prod"}}`,
+	} {
+		w := send("POST", "/api/v1/wallets", body)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var wallet struct {
+			ID uuid.UUID `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &wallet))
+		ids = append(ids, wallet.ID)
+	}
+
+	assert.Equal(t, http.StatusOK, postOperation(r, ids[0].String(), models.OperationDeposit, 100).Code)
+	assert.Equal(t, http.StatusOK, send("PATCH", "/api/v1/wallets/"+ids[1].String(), `{"labels": {"env": "prod", "tier": "gold"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api/v1/wallets", `{"currency": "euro"}`).Code)
+
+	w := send("GET", "/api/v1/wallets?currency=EUR&labels=env%3Dprod&sort=-balance", "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var wallets []struct {
+		ID       uuid.UUID       `json:"id"`
+		Balance  int32           `json:"balance"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &wallets))
+	require.Len(t, wallets, 2)
+	assert.Equal(t, ids[0], wallets[0].ID)
+	assert.Equal(t, int32(100), wallets[0].Balance)
+	assert.Equal(t, ids[1], wallets[1].ID)
+	assert.JSONEq(t, `{"note": "sandbox"}`, string(wallets[1].Metadata))
+}
+
+func TestFullStack_Reversal(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	wallet, err := walletService.CreateWallet(ctx, 0)
+	require.NoError(t, err)
+	id := wallet.ID.String()
+
+	assert.Equal(t, http.StatusOK, postOperation(r, id, models.OperationDeposit, 100).Code)
+	assert.Equal(t, http.StatusOK, postOperation(r, id, models.OperationWithdraw, 80).Code)
+
+	history, err := walletService.GetWalletHistory(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	ops := make(map[int32]uuid.UUID)
+	for _, op := range history {
+		ops[op.Amount] = op.ID
+	}
+
+	reverse := func(operationID uuid.UUID, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/transactions/"+operationID.String()+"/reverse", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, reverse(ops[100], ``).Code, "the deposit is mostly spent")
+	assert.Equal(t, http.StatusCreated, reverse(ops[100], `{"amount": 20}`).Code)
+	assert.Equal(t, http.StatusBadRequest, reverse(ops[100], `{"amount": 81}`).Code)
+	assert.Equal(t, http.StatusCreated, reverse(ops[-80], ``).Code)
+	assert.Equal(t, http.StatusConflict, reverse(ops[-80], ``).Code)
+
+	w := reverse(ops[100], ``)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var reversal struct {
+		Reversal struct {
+			Amount     int32     `json:"amount"`
+			ReversalOf uuid.UUID `json:"reversal_of"`
+		} `json:"reversal"`
+		Original struct {
+			ReversedAmount int32 `json:"reversed_amount"`
+		} `json:"original"`
+		Wallet struct {
+			Balance int32 `json:"balance"`
+		} `json:"wallet"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reversal))
+	assert.Equal(t, int32(-80), reversal.Reversal.Amount)
+	assert.Equal(t, ops[100], reversal.Reversal.ReversalOf)
+	assert.Equal(t, int32(100), reversal.Original.ReversedAmount)
+	assert.Zero(t, reversal.Wallet.Balance)
+}
+
+func TestFullStack_Exchange(t *testing.T) {
+	r, walletService := newFullStack(t)
+	ctx := context.Background()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	usd, err := walletService.OpenWallet(ctx, service.NewWallet{Currency: "USD", InitialBalance: 2000})
+	require.NoError(t, err)
+	eur, err := walletService.OpenWallet(ctx, service.NewWallet{Currency: "EUR"})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/v1/admin/exchange-rates",
+		`{"baseCurrency": "USD", "quoteCurrency": "EUR", "rateMicros": 920000, "effectiveFrom": "2020-01-01T00:00:00Z", "source": "ECB"}`).Code)
+	assert.Equal(t, http.StatusConflict, send("POST", "/api/v1/admin/exchange-rates",
+		`{"baseCurrency": "USD", "quoteCurrency": "EUR", "rateMicros": 930000, "effectiveFrom": "2020-01-01T00:00:00Z", "source": "ECB"}`).Code)
+
+	quoteBody := `{"fromWalletId": "` + usd.ID.String() + `", "toWalletId": "` + eur.ID.String() + `", "amount": 1000}`
+	w := send("POST", "/api/v1/exchange/quotes", quoteBody)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var quote struct {
+		ID              uuid.UUID `json:"id"`
+		RateMicros      int64     `json:"rate_micros"`
+		ConvertedAmount int32     `json:"converted_amount"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &quote))
+	assert.Equal(t, int64(920000), quote.RateMicros)
+	assert.Equal(t, int32(915), quote.ConvertedAmount)
+
+	// Rates published after the quote do not change it.
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/v1/admin/exchange-rates",
+		`{"baseCurrency": "USD", "quoteCurrency": "EUR", "rateMicros": 500000, "source": "ECB"}`).Code)
+
+	w = send("POST", "/api/v1/exchange/quotes/"+quote.ID.String()+"/execute", "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exchange struct {
+		From struct {
+			Balance int32 `json:"balance"`
+		} `json:"from"`
+		To struct {
+			Balance int32 `json:"balance"`
+		} `json:"to"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exchange))
+	assert.Equal(t, int32(1000), exchange.From.Balance)
+	assert.Equal(t, int32(915), exchange.To.Balance)
+
+	assert.Equal(t, http.StatusConflict, send("POST", "/api/v1/exchange/quotes/"+quote.ID.String()+"/execute", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("POST", "/api/v1/exchange/quotes/"+uuid.NewString()+"/execute", "").Code)
+
+	w = send("GET", "/api/v1/exchange-rates?base=usd&quote=eur", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var rates []struct {
+		RateMicros int64 `json:"rate_micros"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rates))
+	require.Len(t, rates, 2)
+	assert.Equal(t, int64(500000), rates[0].RateMicros)
+}
+
+func TestFullStack_Problems(t *testing.T) {
+	r, _ := newFullStack(t)
+
+	w := postOperation(r, "not-a-uuid", models.OperationDeposit, 1)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, handler.ProblemContentType, w.Header().Get("Content-Type"))
+
+	var problem handler.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "VALIDATION_FAILED", problem.Code)
+	assert.Equal(t, "urn:itk:problem:validation-failed", problem.Type)
+	assert.Equal(t, w.Header().Get(handler.RequestIDHeader), problem.Instance)
+	assert.Equal(t, []handler.FieldError{{Field: "walletId", Code: "UUID", Detail: "must be a UUID"}}, problem.Errors)
+
+	req, _ := http.NewRequest("GET", "/api/v1/nowhere", nil)
+	req.Header.Set(handler.RequestIDHeader, "req-1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "ROUTE_NOT_FOUND", problem.Code)
+	assert.Equal(t, "req-1", problem.Instance)
+}
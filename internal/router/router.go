@@ -1,17 +1,84 @@
 package router
 
 import (
+	"expvar"
+
 	"github.com/gin-gonic/gin"
 	"github.com/kuzmindeniss/itk/internal/handler"
 )
 
-func SetupRouter(walletHandler *handler.WalletHandler) *gin.Engine {
-	r := gin.Default()
+func SetupRouter(walletHandler *handler.WalletHandler, scheduleHandler *handler.ScheduleHandler, interestHandler *handler.InterestHandler, feeHandler *handler.FeeHandler, importHandler *handler.ImportHandler, auditHandler *handler.AuditHandler, exchangeHandler *handler.ExchangeHandler, tenants handler.TenantAuthenticator, adminKey string) *gin.Engine {
+	r := gin.New()
+	// Problems comes before every other middleware that can fail a request,
+	// so that all errors are answered as problem details.
+	r.Use(gin.Logger(), gin.CustomRecovery(handler.Recovered), handler.Problems())
+	r.NoRoute(handler.RouteNotFound)
+	// Lets handlers see the tenant that the Tenant middleware puts in the
+	// request context.
+	r.ContextWithFallback = true
 
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", handler.Tenant(tenants))
 
 	v1.POST("/wallet", walletHandler.UpdateWalletBalance)
+	v1.POST("/wallets", walletHandler.CreateWallet)
+	v1.GET("/wallets", walletHandler.ListWallets)
 	v1.GET("/wallets/:id", walletHandler.GetWallet)
+	v1.PATCH("/wallets/:id", walletHandler.UpdateWallet)
+	v1.GET("/wallets/:id/stream", walletHandler.StreamWallet)
+	v1.GET("/wallets/:id/statement", walletHandler.GetStatement)
+	v1.GET("/owners/:ownerId/wallets", walletHandler.ListOwnerWallets)
+	v1.POST("/transactions/:id/reverse", walletHandler.ReverseTransaction)
+
+	v1.POST("/scheduled-operations", scheduleHandler.CreateScheduledOperation)
+	v1.GET("/scheduled-operations", scheduleHandler.ListScheduledOperations)
+	v1.GET("/scheduled-operations/:id", scheduleHandler.GetScheduledOperation)
+	v1.PUT("/scheduled-operations/:id", scheduleHandler.UpdateScheduledOperation)
+	v1.DELETE("/scheduled-operations/:id", scheduleHandler.DeleteScheduledOperation)
+	v1.GET("/scheduled-operations/:id/runs", scheduleHandler.ListScheduledOperationRuns)
+
+	v1.GET("/interest-products", interestHandler.ListInterestProducts)
+	v1.GET("/interest-products/:id", interestHandler.GetInterestProduct)
+	v1.PUT("/wallets/:id/interest", interestHandler.SetWalletInterest)
+	v1.GET("/wallets/:id/interest", interestHandler.GetWalletInterest)
+	v1.DELETE("/wallets/:id/interest", interestHandler.DeleteWalletInterest)
+	v1.GET("/wallets/:id/interest/payouts", interestHandler.ListInterestPayouts)
+
+	v1.GET("/fee-schedules", feeHandler.ListFeeSchedules)
+	v1.GET("/fee-schedules/:id", feeHandler.GetFeeSchedule)
+	v1.GET("/fees/quote", feeHandler.QuoteFee)
+
+	v1.POST("/imports", importHandler.CreateImport)
+	v1.GET("/imports/:id", importHandler.GetImport)
+
+	v1.GET("/audit", auditHandler.ListAuditEntries)
+
+	v1.GET("/exchange-rates", exchangeHandler.ListExchangeRates)
+	v1.POST("/exchange/quotes", exchangeHandler.QuoteExchange)
+	v1.POST("/exchange/quotes/:id/execute", exchangeHandler.ExecuteExchange)
+
+	// Products, fee schedules and exchange rates are shared by all tenants,
+	// so only the operator changes them.
+	admin := r.Group("/api/v1/admin", handler.Admin(adminKey))
+
+	admin.POST("/interest-products", interestHandler.CreateInterestProduct)
+	admin.PUT("/interest-products/:id", interestHandler.UpdateInterestProduct)
+
+	admin.POST("/fee-schedules", feeHandler.CreateFeeSchedule)
+	admin.PUT("/fee-schedules/:id", feeHandler.UpdateFeeSchedule)
+	admin.DELETE("/fee-schedules/:id", feeHandler.DeleteFeeSchedule)
+
+	admin.POST("/exchange-rates", exchangeHandler.CreateExchangeRate)
+
+	return r
+}
+
+// SetupDebugRouter serves expvar, which shows the command line and memory
+// statistics; it belongs on a listener that only operators can reach.
+func SetupDebugRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 
 	return r
 }
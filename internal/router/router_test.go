@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kuzmindeniss/itk/internal/db/repository"
 	"github.com/kuzmindeniss/itk/internal/handler"
+	"github.com/kuzmindeniss/itk/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -22,16 +24,58 @@ func (m *MockWalletService) GetWalletByID(ctx context.Context, id uuid.UUID) (re
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
-func (m *MockWalletService) TopUpWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (repository.Wallet, error) {
+func (m *MockWalletService) ChangeWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (service.BalanceChange, error) {
 	args := m.Called(ctx, id, amount)
+	return args.Get(0).(service.BalanceChange), args.Error(1)
+}
+
+func (m *MockWalletService) WaitForVersion(ctx context.Context, id uuid.UUID, version int64) (repository.Wallet, error) {
+	args := m.Called(ctx, id, version)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) WriteStatement(ctx context.Context, id uuid.UUID, from, to time.Time, w service.StatementWriter) error {
+	args := m.Called(ctx, id, from, to, w)
+	return args.Error(0)
+}
+
+func (m *MockWalletService) ListOwnerWallets(ctx context.Context, ownerID, afterID uuid.UUID, limit int32) ([]repository.Wallet, error) {
+	args := m.Called(ctx, ownerID, afterID, limit)
+	return args.Get(0).([]repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) OpenWallet(ctx context.Context, w service.NewWallet) (repository.Wallet, error) {
+	args := m.Called(ctx, w)
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
+func (m *MockWalletService) SetWalletDetails(ctx context.Context, id uuid.UUID, details service.WalletDetails) (repository.Wallet, error) {
+	args := m.Called(ctx, id, details)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) SearchWallets(ctx context.Context, search service.WalletSearch) ([]repository.Wallet, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).([]repository.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) ReverseOperation(ctx context.Context, id uuid.UUID, amount int32) (service.Reversal, error) {
+	args := m.Called(ctx, id, amount)
+	return args.Get(0).(service.Reversal), args.Error(1)
+}
+
+// anyKey accepts every API key as one of the default tenant.
+type anyKey struct{}
+
+func (anyKey) TenantForKey(context.Context, string) (uuid.UUID, error) {
+	return service.DefaultTenantID, nil
+}
+
 func TestSetupRouter_RoutesRegistered(t *testing.T) {
 	mockService := new(MockWalletService)
 	walletHandler := handler.NewWalletHandler(mockService)
 
-	router := SetupRouter(walletHandler)
+	router := SetupRouter(walletHandler, handler.NewScheduleHandler(nil), handler.NewInterestHandler(nil), handler.NewFeeHandler(nil), handler.NewImportHandler(nil, 0), handler.NewAuditHandler(nil), handler.NewExchangeHandler(nil), anyKey{}, "admin-key")
 
 	testCases := []struct {
 		method   string
@@ -39,11 +83,36 @@ func TestSetupRouter_RoutesRegistered(t *testing.T) {
 		expected int
 	}{
 		{"GET", "/api/v1/wallets/invalid-uuid", http.StatusBadRequest},
+		{"POST", "/api/v1/wallets", http.StatusBadRequest},
+		{"GET", "/api/v1/wallets?sort=name", http.StatusBadRequest},
+		{"PATCH", "/api/v1/wallets/invalid-uuid", http.StatusBadRequest},
 		{"POST", "/api/v1/wallet", http.StatusBadRequest},
+		{"GET", "/api/v1/wallets/invalid-uuid/stream", http.StatusBadRequest},
+		{"GET", "/api/v1/wallets/invalid-uuid/statement", http.StatusBadRequest},
+		{"GET", "/api/v1/owners/invalid-uuid/wallets", http.StatusBadRequest},
+		{"POST", "/api/v1/transactions/invalid-uuid/reverse", http.StatusBadRequest},
+		{"POST", "/api/v1/scheduled-operations", http.StatusBadRequest},
+		{"GET", "/api/v1/scheduled-operations?limit=0", http.StatusBadRequest},
+		{"GET", "/api/v1/scheduled-operations/invalid-uuid", http.StatusBadRequest},
+		{"PUT", "/api/v1/scheduled-operations/invalid-uuid", http.StatusBadRequest},
+		{"DELETE", "/api/v1/scheduled-operations/invalid-uuid", http.StatusBadRequest},
+		{"GET", "/api/v1/scheduled-operations/invalid-uuid/runs", http.StatusBadRequest},
+		{"POST", "/api/v1/admin/fee-schedules", http.StatusBadRequest},
+		{"GET", "/api/v1/fee-schedules/invalid-uuid", http.StatusBadRequest},
+		{"GET", "/api/v1/fees/quote?walletId=invalid-uuid", http.StatusBadRequest},
+		{"POST", "/api/v1/imports?skipInvalid=maybe", http.StatusBadRequest},
+		{"GET", "/api/v1/imports/invalid-uuid", http.StatusBadRequest},
+		{"GET", "/api/v1/audit?walletId=invalid-uuid", http.StatusBadRequest},
+		{"POST", "/api/v1/admin/exchange-rates", http.StatusBadRequest},
+		{"GET", "/api/v1/exchange-rates?limit=0", http.StatusBadRequest},
+		{"POST", "/api/v1/exchange/quotes", http.StatusBadRequest},
+		{"POST", "/api/v1/exchange/quotes/invalid-uuid/execute", http.StatusBadRequest},
 	}
 
 	for _, tc := range testCases {
 		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		// anyKey takes the admin key for a tenant key too.
+		req.Header.Set("Authorization", "Bearer admin-key")
 		w := httptest.NewRecorder()
 
 		router.ServeHTTP(w, req)
@@ -55,10 +124,44 @@ func TestSetupRouter_RoutesRegistered(t *testing.T) {
 	}
 }
 
+func TestSetupRouter_AdminRoutes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		adminKey string
+		method   string
+		path     string
+		key      string
+		expected int
+	}{
+		{"tenant key", "admin-key", "POST", "/api/v1/admin/fee-schedules", "tenant-key", http.StatusUnauthorized},
+		{"no key", "admin-key", "PUT", "/api/v1/admin/interest-products/" + uuid.NewString(), "", http.StatusUnauthorized},
+		{"admin off", "", "POST", "/api/v1/admin/exchange-rates", "admin-key", http.StatusUnauthorized},
+		{"admin key", "admin-key", "DELETE", "/api/v1/admin/fee-schedules/invalid-uuid", "admin-key", http.StatusBadRequest},
+		{"fee schedules for tenants", "admin-key", "POST", "/api/v1/fee-schedules", "admin-key", http.StatusNotFound},
+		{"products for tenants", "admin-key", "PUT", "/api/v1/interest-products/" + uuid.NewString(), "admin-key", http.StatusNotFound},
+		{"rates for tenants", "admin-key", "POST", "/api/v1/exchange-rates", "admin-key", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := SetupRouter(handler.NewWalletHandler(new(MockWalletService)), handler.NewScheduleHandler(nil), handler.NewInterestHandler(nil), handler.NewFeeHandler(nil), handler.NewImportHandler(nil, 0), handler.NewAuditHandler(nil), handler.NewExchangeHandler(nil), anyKey{}, tc.adminKey)
+
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expected, w.Code, "%s %s", tc.method, tc.path)
+		})
+	}
+}
+
 func TestSetupRouter_CorrectRoutes(t *testing.T) {
 	mockService := new(MockWalletService)
 	walletHandler := handler.NewWalletHandler(mockService)
-	router := SetupRouter(walletHandler)
+	router := SetupRouter(walletHandler, handler.NewScheduleHandler(nil), handler.NewInterestHandler(nil), handler.NewFeeHandler(nil), handler.NewImportHandler(nil, 0), handler.NewAuditHandler(nil), handler.NewExchangeHandler(nil), anyKey{}, "admin-key")
 
 	req, _ := http.NewRequest("GET", "/api/v1/nonexistent", nil)
 	w := httptest.NewRecorder()
@@ -71,7 +174,7 @@ func TestSetupRouter_CorrectRoutes(t *testing.T) {
 func TestSetupRouter_APIVersion(t *testing.T) {
 	mockService := new(MockWalletService)
 	walletHandler := handler.NewWalletHandler(mockService)
-	router := SetupRouter(walletHandler)
+	router := SetupRouter(walletHandler, handler.NewScheduleHandler(nil), handler.NewInterestHandler(nil), handler.NewFeeHandler(nil), handler.NewImportHandler(nil, 0), handler.NewAuditHandler(nil), handler.NewExchangeHandler(nil), anyKey{}, "admin-key")
 
 	testCases := []struct {
 		path     string
@@ -91,3 +194,17 @@ func TestSetupRouter_APIVersion(t *testing.T) {
 			"Route %s should return %d", tc.path, tc.expected)
 	}
 }
+
+func TestSetupDebugRouter(t *testing.T) {
+	router := SetupRouter(handler.NewWalletHandler(new(MockWalletService)), handler.NewScheduleHandler(nil), handler.NewInterestHandler(nil), handler.NewFeeHandler(nil), handler.NewImportHandler(nil, 0), handler.NewAuditHandler(nil), handler.NewExchangeHandler(nil), anyKey{}, "admin-key")
+
+	req, _ := http.NewRequest("GET", "/debug/vars", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "expvar is not public")
+
+	w = httptest.NewRecorder()
+	SetupDebugRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cmdline"`)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+type AuditServiceInterface interface {
+	ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+// AuditInfo says who makes a change. Changes made with a context carrying it
+// are recorded in the audit log, in the transaction that makes them.
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+	SourceIP  string
+}
+
+// Actors of the changes the service makes on its own, in the background.
+const (
+	SchedulerActor      = "system:scheduler"
+	InterestActor       = "system:interest"
+	ImportRecoveryActor = "system:import-recovery"
+)
+
+type auditKey struct{}
+
+// WithAudit returns a context whose wallet changes are audited as made by
+// info.Actor.
+func WithAudit(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditKey{}, info)
+}
+
+func auditing(ctx context.Context) (AuditInfo, bool) {
+	info, ok := ctx.Value(auditKey{}).(AuditInfo)
+	return info, ok
+}
+
+// AuditState is the state of a wallet before or after an audited change.
+// The currency and the details are recorded only when a wallet is created
+// or its details change.
+type AuditState struct {
+	Balance    int32           `json:"balance"`
+	Status     string          `json:"status"`
+	ShardCount int32           `json:"shard_count"`
+	Currency   string          `json:"currency,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	Labels     json.RawMessage `json:"labels,omitempty"`
+	// Interest is recorded only when the interest terms change.
+	Interest *AuditInterest `json:"interest,omitempty"`
+}
+
+// AuditInterest is the interest product or the own rate of a wallet.
+type AuditInterest struct {
+	ProductID     *uuid.UUID `json:"product_id,omitempty"`
+	AnnualRateBps *int32     `json:"annual_rate_bps,omitempty"`
+}
+
+func auditInterest(wi repository.WalletInterest) *AuditInterest {
+	var ai AuditInterest
+	if wi.ProductID != uuid.Nil {
+		ai.ProductID = &wi.ProductID
+	}
+	if wi.AnnualRateBps.Valid {
+		ai.AnnualRateBps = &wi.AnnualRateBps.Int32
+	}
+	return &ai
+}
+
+func auditState(action models.AuditAction, wallet repository.Wallet) AuditState {
+	state := AuditState{
+		Balance:    wallet.Balance,
+		Status:     wallet.Status,
+		ShardCount: wallet.ShardCount,
+	}
+
+	if action == models.AuditActionWalletCreate || action == models.AuditActionDetailsChange {
+		state.Currency = wallet.Currency
+		state.Metadata = wallet.Metadata
+		state.Labels = wallet.Labels
+	}
+
+	return state
+}
+
+type AuditEntry struct {
+	ID        uuid.UUID  `json:"id"`
+	Actor     string     `json:"actor"`
+	Action    string     `json:"action"`
+	WalletID  uuid.UUID  `json:"wallet_id"`
+	Before    AuditState `json:"before"`
+	After     AuditState `json:"after"`
+	RequestID string     `json:"request_id"`
+	SourceIP  string     `json:"source_ip"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AuditFilter selects entries created in [From, To). Empty Actor and zero
+// WalletID match any; AfterID continues a previous page.
+type AuditFilter struct {
+	Actor    string
+	WalletID uuid.UUID
+	From     time.Time
+	To       time.Time
+	AfterID  uuid.UUID
+	Limit    int32
+}
+
+// ListAuditEntries returns the entries matching filter, oldest first.
+func (s *WalletService) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	if !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidAuditFilter)
+	}
+
+	rows, err := s.repo.ListAuditEntries(ctx, repository.ListAuditEntriesParams{
+		Actor:    filter.Actor,
+		WalletID: filter.WalletID,
+		FromTime: filter.From,
+		ToTime:   filter.To,
+		AfterID:  filter.AfterID,
+		PageSize: filter.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = AuditEntry{
+			ID:        row.ID,
+			Actor:     row.Actor,
+			Action:    row.Action,
+			WalletID:  row.WalletID,
+			RequestID: row.RequestID,
+			SourceIP:  row.SourceIp,
+			CreatedAt: row.CreatedAt,
+		}
+		if err := json.Unmarshal(row.Before, &entries[i].Before); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row.After, &entries[i].After); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// recordAudit logs a change of a wallet if ctx carries audit info.
+func recordAudit(ctx context.Context, repo AuditStore, action models.AuditAction, before, after repository.Wallet) error {
+	return recordAuditStates(ctx, repo, action, after.ID, auditState(action, before), auditState(action, after))
+}
+
+// recordAuditStates is recordAudit for states that hold more than the
+// wallet row.
+func recordAuditStates(ctx context.Context, repo AuditStore, action models.AuditAction, walletID uuid.UUID, before, after AuditState) error {
+	info, ok := auditing(ctx)
+	if !ok {
+		return nil
+	}
+
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateAuditEntry(ctx, repository.CreateAuditEntryParams{
+		Actor:     info.Actor,
+		Action:    string(action),
+		WalletID:  walletID,
+		Before:    beforeJSON,
+		After:     afterJSON,
+		RequestID: info.RequestID,
+		SourceIp:  info.SourceIP,
+	})
+	return err
+}
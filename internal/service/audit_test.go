@@ -0,0 +1,244 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditEntries(t *testing.T, svc *service.WalletService, filter service.AuditFilter) []service.AuditEntry {
+	t.Helper()
+
+	filter.To = time.Now().Add(time.Minute)
+	filter.Limit = 100
+
+	entries, err := svc.ListAuditEntries(context.Background(), filter)
+	require.NoError(t, err)
+
+	return entries
+}
+
+func TestWalletService_Audit(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+	admin := service.WithAudit(ctx, service.AuditInfo{Actor: "admin", RequestID: "req-1", SourceIP: "10.0.0.1"})
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{OperationType: models.OperationWithdraw, Kind: models.FeeKindFlat, FlatAmount: 2})
+	require.NoError(t, err)
+
+	wallet := newWallet(t, svc, 100)
+
+	_, err = svc.ChangeWalletBalance(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, auditEntries(t, svc, service.AuditFilter{}), "changes without audit info are not recorded")
+
+	_, err = svc.ChangeWalletBalance(admin, wallet.ID, -30)
+	require.NoError(t, err)
+	_, err = svc.ChangeWalletBalance(admin, wallet.ID, -1000)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+	_, err = svc.SetWalletStatus(admin, wallet.ID, models.WalletStatusFrozen)
+	require.NoError(t, err)
+	_, err = svc.SetWalletStatus(admin, wallet.ID, models.WalletStatusActive)
+	require.NoError(t, err)
+	_, err = svc.SetWalletShards(service.WithAudit(ctx, service.AuditInfo{Actor: "ops"}), wallet.ID, 4)
+	require.NoError(t, err)
+
+	entries := auditEntries(t, svc, service.AuditFilter{WalletID: wallet.ID})
+	require.Len(t, entries, 4, "failed changes are not recorded")
+
+	assert.Equal(t, "admin", entries[0].Actor)
+	assert.Equal(t, string(models.AuditActionBalanceChange), entries[0].Action)
+	assert.Equal(t, wallet.ID, entries[0].WalletID)
+	assert.Equal(t, "req-1", entries[0].RequestID)
+	assert.Equal(t, "10.0.0.1", entries[0].SourceIP)
+	assert.Equal(t, service.AuditState{Balance: 110, Status: "ACTIVE"}, entries[0].Before)
+	assert.Equal(t, service.AuditState{Balance: 78, Status: "ACTIVE"}, entries[0].After, "the fee is part of the change")
+
+	assert.Equal(t, string(models.AuditActionStatusChange), entries[1].Action)
+	assert.Equal(t, service.AuditState{Balance: 78, Status: "ACTIVE"}, entries[1].Before)
+	assert.Equal(t, service.AuditState{Balance: 78, Status: "FROZEN"}, entries[1].After)
+
+	assert.Equal(t, "FROZEN", entries[2].Before.Status)
+	assert.Equal(t, "ACTIVE", entries[2].After.Status)
+
+	assert.Equal(t, "ops", entries[3].Actor)
+	assert.Equal(t, string(models.AuditActionShardsChange), entries[3].Action)
+	assert.Equal(t, service.AuditState{Balance: 78, Status: "ACTIVE", ShardCount: 4}, entries[3].After)
+
+	assert.Len(t, auditEntries(t, svc, service.AuditFilter{Actor: "admin"}), 3)
+	assert.Equal(t, entries[2:], auditEntries(t, svc, service.AuditFilter{AfterID: entries[1].ID}))
+	assert.Empty(t, auditEntries(t, svc, service.AuditFilter{WalletID: uuid.New()}))
+}
+
+func TestWalletService_Audit_WalletDetails(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	admin := service.WithAudit(context.Background(), service.AuditInfo{Actor: "admin"})
+
+	wallet, err := svc.OpenWallet(admin, service.NewWallet{Currency: "EUR", InitialBalance: 50, Labels: map[string]string{"env": "test"}})
+	require.NoError(t, err)
+
+	_, err = svc.SetWalletDetails(admin, wallet.ID, service.WalletDetails{Labels: map[string]string{"env": "prod"}})
+	require.NoError(t, err)
+
+	entries := auditEntries(t, svc, service.AuditFilter{WalletID: wallet.ID})
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, string(models.AuditActionWalletCreate), entries[0].Action)
+	assert.Equal(t, service.AuditState{}, entries[0].Before)
+	assert.Equal(t, int32(50), entries[0].After.Balance)
+	assert.Equal(t, "EUR", entries[0].After.Currency)
+	assert.JSONEq(t, `{"env": "test"}`, string(entries[0].After.Labels))
+
+	assert.Equal(t, string(models.AuditActionDetailsChange), entries[1].Action)
+	assert.JSONEq(t, `{"env": "test"}`, string(entries[1].Before.Labels))
+	assert.JSONEq(t, `{"env": "prod"}`, string(entries[1].After.Labels))
+	assert.JSONEq(t, `{}`, string(entries[1].After.Metadata), "metadata is left as it is")
+	assert.Equal(t, int32(50), entries[1].Before.Balance)
+}
+
+func TestWalletService_Audit_Batched(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore(), service.WithBatching(10))
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+
+	for _, actor := range []string{"alice", "bob"} {
+		_, err := svc.ChangeWalletBalance(service.WithAudit(ctx, service.AuditInfo{Actor: actor}), wallet.ID, 5)
+		require.NoError(t, err)
+	}
+
+	entries := auditEntries(t, svc, service.AuditFilter{WalletID: wallet.ID})
+	require.Len(t, entries, 2)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, int32(0), entries[0].Before.Balance)
+	assert.Equal(t, int32(5), entries[0].After.Balance)
+	assert.Equal(t, "bob", entries[1].Actor)
+	assert.Equal(t, int32(5), entries[1].Before.Balance)
+	assert.Equal(t, int32(10), entries[1].After.Balance)
+}
+
+func TestWalletService_Audit_Transfers(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+	admin := service.WithAudit(ctx, service.AuditInfo{Actor: "admin"})
+
+	from := newWallet(t, svc, 100)
+	to := newWallet(t, svc, 0)
+	_, _, err := svc.Transfer(admin, from.ID, to.ID, 30)
+	require.NoError(t, err)
+
+	usd := newCurrencyWallet(t, svc, "USD", 1000)
+	eur := newCurrencyWallet(t, svc, "EUR", 0)
+	addRate(t, svc, "USD", "EUR", 1000000)
+	quote, err := svc.QuoteExchange(ctx, usd.ID, eur.ID, 1000)
+	require.NoError(t, err)
+	_, err = svc.ExecuteExchange(admin, quote.ID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		walletID      uuid.UUID
+		action        models.AuditAction
+		before, after int32
+	}{
+		{from.ID, models.AuditActionTransfer, 100, 70},
+		{to.ID, models.AuditActionTransfer, 0, 30},
+		{usd.ID, models.AuditActionExchange, 1000, 0},
+		{eur.ID, models.AuditActionExchange, 0, quote.ConvertedAmount},
+	}
+	for _, tt := range tests {
+		entries := auditEntries(t, svc, service.AuditFilter{WalletID: tt.walletID})
+		require.Len(t, entries, 1)
+		assert.Equal(t, "admin", entries[0].Actor)
+		assert.Equal(t, string(tt.action), entries[0].Action)
+		assert.Equal(t, tt.before, entries[0].Before.Balance)
+		assert.Equal(t, tt.after, entries[0].After.Balance)
+	}
+}
+
+func TestWalletService_Audit_Import(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	admin := service.WithAudit(context.Background(), service.AuditInfo{Actor: "admin"})
+
+	wallet := newWallet(t, svc, 10)
+	untouched := newWallet(t, svc, 10)
+
+	_, err := svc.CreateImport(admin, []service.ImportRow{
+		{WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 5},
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 2},
+		{WalletID: untouched.ID, OperationType: models.OperationWithdraw, Amount: 100},
+	}, true)
+	require.NoError(t, err)
+
+	entries := auditEntries(t, svc, service.AuditFilter{Actor: "admin"})
+	require.Len(t, entries, 1, "one entry per wallet the import changed")
+	assert.Equal(t, string(models.AuditActionImport), entries[0].Action)
+	assert.Equal(t, wallet.ID, entries[0].WalletID)
+	assert.Equal(t, int32(10), entries[0].Before.Balance)
+	assert.Equal(t, int32(13), entries[0].After.Balance)
+}
+
+func TestWalletService_Audit_ScheduledRun(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	runAt := time.Now().Add(time.Hour)
+	_, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:      wallet.ID,
+		OperationType: models.OperationDeposit,
+		Amount:        30,
+		RunAt:         runAt,
+	})
+	require.NoError(t, err)
+
+	_, err = svc.RunDueScheduledOperations(ctx, runAt)
+	require.NoError(t, err)
+
+	entries := auditEntries(t, svc, service.AuditFilter{WalletID: wallet.ID})
+	require.Len(t, entries, 1)
+	assert.Equal(t, service.SchedulerActor, entries[0].Actor)
+	assert.Equal(t, string(models.AuditActionBalanceChange), entries[0].Action)
+	assert.Equal(t, int32(30), entries[0].After.Balance)
+}
+
+func TestWalletService_Audit_Interest(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	admin := service.WithAudit(context.Background(), service.AuditInfo{Actor: "admin"})
+
+	wallet := newWallet(t, svc, 0)
+	product, err := svc.CreateInterestProduct(admin, service.InterestProductParams{Name: "savings", AnnualRateBps: 200})
+	require.NoError(t, err)
+
+	_, err = svc.SetWalletInterest(admin, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(100)})
+	require.NoError(t, err)
+	_, err = svc.SetWalletInterest(admin, wallet.ID, service.WalletInterestParams{ProductID: product.ID})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteWalletInterest(admin, wallet.ID))
+
+	entries := auditEntries(t, svc, service.AuditFilter{WalletID: wallet.ID})
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		assert.Equal(t, string(models.AuditActionInterestChange), e.Action)
+	}
+
+	assert.Nil(t, entries[0].Before.Interest, "the wallet had no interest")
+	assert.Equal(t, &service.AuditInterest{AnnualRateBps: rate(100)}, entries[0].After.Interest)
+	assert.Equal(t, &service.AuditInterest{ProductID: &product.ID}, entries[1].After.Interest)
+	assert.Equal(t, entries[1].After, entries[2].Before)
+	assert.Nil(t, entries[2].After.Interest)
+}
+
+func TestWalletService_ListAuditEntries_InvalidPeriod(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+
+	now := time.Now()
+	_, err := svc.ListAuditEntries(context.Background(), service.AuditFilter{From: now, To: now, Limit: 10})
+	assert.ErrorIs(t, err, service.ErrInvalidAuditFilter)
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var errBalanceOverflow = errors.New("balance out of range")
+
+type batchRequest struct {
+	ctx    context.Context
+	amount int32
+	done   chan batchResult
+}
+
+type batchResult struct {
+	wallet repository.Wallet
+	fee    int32
+	err    error
+
+	// before is the balance the request was applied to.
+	before int32
+}
+
+type walletQueue struct {
+	pending []*batchRequest
+}
+
+// walletBatcher implements group commit per wallet. The first caller for an
+// idle wallet starts a drain goroutine; callers arriving while a batch is
+// being committed queue up and go into the next transaction together, so a
+// hot wallet takes one row lock per batch instead of one per operation.
+type walletBatcher struct {
+	mu           sync.Mutex
+	queues       map[uuid.UUID]*walletQueue
+	maxBatchSize int
+	apply        func(ctx context.Context, id uuid.UUID, batch []*batchRequest)
+}
+
+func newWalletBatcher(maxBatchSize int, apply func(ctx context.Context, id uuid.UUID, batch []*batchRequest)) *walletBatcher {
+	if maxBatchSize < 1 {
+		maxBatchSize = 1
+	}
+
+	return &walletBatcher{
+		queues:       make(map[uuid.UUID]*walletQueue),
+		maxBatchSize: maxBatchSize,
+		apply:        apply,
+	}
+}
+
+func (b *walletBatcher) submit(ctx context.Context, id uuid.UUID, amount int32) batchResult {
+	req := &batchRequest{
+		ctx:    ctx,
+		amount: amount,
+		done:   make(chan batchResult, 1),
+	}
+
+	b.mu.Lock()
+	queue, running := b.queues[id]
+	if !running {
+		queue = &walletQueue{}
+		b.queues[id] = queue
+	}
+	queue.pending = append(queue.pending, req)
+	b.mu.Unlock()
+
+	if !running {
+		go b.drain(id, queue)
+	}
+
+	// Once a request is part of a batch its outcome is decided by the
+	// transaction, so wait for the result even if ctx is cancelled meanwhile.
+	return <-req.done
+}
+
+func (b *walletBatcher) drain(id uuid.UUID, queue *walletQueue) {
+	for {
+		b.mu.Lock()
+		if len(queue.pending) == 0 {
+			delete(b.queues, id)
+			b.mu.Unlock()
+			return
+		}
+
+		n := min(len(queue.pending), b.maxBatchSize)
+		batch := make([]*batchRequest, 0, n)
+		for _, req := range queue.pending[:n] {
+			if err := req.ctx.Err(); err != nil {
+				req.done <- batchResult{err: err}
+				continue
+			}
+			batch = append(batch, req)
+		}
+		queue.pending = queue.pending[n:]
+		b.mu.Unlock()
+
+		if len(batch) > 0 {
+			b.apply(context.WithoutCancel(batch[0].ctx), id, batch)
+		}
+	}
+}
+
+// applyBatch commits a batch in one transaction: it locks the wallet, decides
+// every request in arrival order against the running balance, then writes one
+// UPDATE and copies all accepted operations at once. Shards of a sharded
+// wallet are locked as well and folded into that UPDATE. Fees are recorded
+// per operation and credited to the fee wallet as one sum.
+//
+// Requests of several tenants may share a batch, so it runs without tenant
+// isolation and each request is checked against its own tenant instead.
+func (s *WalletService) applyBatch(ctx context.Context, id uuid.UUID, batch []*batchRequest) {
+	ctx = withoutTenant(ctx)
+	results := make([]batchResult, len(batch))
+	hidden := make([]bool, len(batch))
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		wallet, err := repo.GetWalletByIDForUpdate(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		for i, req := range batch {
+			if !visibleTo(req.ctx, wallet) {
+				hidden[i] = true
+				results[i].err = ErrWalletNotFound
+			}
+		}
+
+		if err := checkWalletActive(wallet); err != nil {
+			return err
+		}
+
+		balance := int64(wallet.Balance)
+		if wallet.ShardCount > 0 {
+			shardsBalance, err := repo.LockWalletShards(ctx, id)
+			if err != nil {
+				return err
+			}
+			balance += shardsBalance
+		}
+		var total, fees int64
+		operations := make([]repository.CreateOperationsParams, 0, len(batch))
+		schedules := make(map[models.OperationType]*FeeSchedule)
+
+		for i, req := range batch {
+			if hidden[i] {
+				continue
+			}
+
+			opType := operationTypeFor(req.amount)
+
+			schedule, ok := schedules[opType]
+			if !ok {
+				found, ok, err := s.walletFeeSchedule(ctx, repo, id, opType)
+				if err != nil {
+					return err
+				}
+				if ok {
+					schedule = &found
+				}
+				schedules[opType] = schedule
+			}
+
+			var fee int32
+			if schedule != nil {
+				fee = schedule.fee(req.amount)
+			}
+
+			next := balance + int64(req.amount) - int64(fee)
+
+			switch {
+			case (req.amount < 0 || fee > 0) && next < 0:
+				results[i].err = ErrInsufficientFunds
+				continue
+			case next > math.MaxInt32 || next < math.MinInt32:
+				results[i].err = errBalanceOverflow
+				continue
+			}
+
+			results[i].before = int32(balance)
+			balance = next
+			total += int64(req.amount) - int64(fee)
+			fees += int64(fee)
+
+			results[i].wallet = wallet
+			results[i].wallet.Balance = int32(balance)
+			results[i].fee = fee
+
+			operations = append(operations, repository.CreateOperationsParams{
+				WalletID:      id,
+				OperationType: string(opType),
+				Amount:        req.amount,
+			})
+			if fee > 0 {
+				operations = append(operations, repository.CreateOperationsParams{
+					WalletID:      id,
+					OperationType: string(models.OperationFee),
+					Amount:        -fee,
+				})
+			}
+		}
+
+		if len(operations) == 0 {
+			return nil
+		}
+
+		var updated repository.Wallet
+		if wallet.ShardCount > 0 {
+			if err := repo.ResetWalletShards(ctx, id); err != nil {
+				return err
+			}
+
+			if updated, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{
+				ID:      id,
+				Balance: int32(balance),
+			}); err != nil {
+				return err
+			}
+
+			if updated, err = sumWalletShards(ctx, repo, updated); err != nil {
+				return err
+			}
+		} else if updated, err = repo.UpdateWallet(ctx, repository.UpdateWalletParams{
+			ID:     id,
+			Amount: int32(total),
+		}); err != nil {
+			return err
+		}
+
+		// The batch commits as one change, so all its operations share the
+		// resulting version.
+		for i, req := range batch {
+			if results[i].err != nil {
+				continue
+			}
+			results[i].wallet.Version = updated.Version
+
+			// Each request is audited with its own caller, but must not
+			// fail the batch if that caller has gone away.
+			before := results[i].wallet
+			before.Balance = results[i].before
+			if err := recordAudit(context.WithoutCancel(req.ctx), repo, models.AuditActionBalanceChange, before, results[i].wallet); err != nil {
+				return err
+			}
+		}
+
+		if _, err = repo.CreateOperations(ctx, operations); err != nil {
+			return err
+		}
+
+		if err := bookBatch(ctx, repo, id, operations); err != nil || fees == 0 {
+			return err
+		}
+
+		return s.collectFee(ctx, repo, fees)
+	})
+
+	for i, req := range batch {
+		res := results[i]
+		if err != nil && !hidden[i] {
+			res = batchResult{err: err}
+		}
+		req.done <- res
+	}
+}
+
+// bookBatch books the operations of a batch as one entry, with a leg per
+// counter account.
+func bookBatch(ctx context.Context, repo JournalStore, id uuid.UUID, operations []repository.CreateOperationsParams) error {
+	var total int64
+	counters := make(map[models.JournalAccount]int64)
+	var accounts []models.JournalAccount
+
+	for _, op := range operations {
+		account := counterAccount(models.OperationType(op.OperationType))
+		if _, ok := counters[account]; !ok {
+			accounts = append(accounts, account)
+		}
+		counters[account] -= int64(op.Amount)
+		total += int64(op.Amount)
+	}
+
+	legs := []journalLeg{walletLeg(id, int32(total))}
+	for _, account := range accounts {
+		if counters[account] > math.MaxInt32 || counters[account] < math.MinInt32 {
+			return errBalanceOverflow
+		}
+		legs = append(legs, journalLeg{account: account, amount: int32(counters[account])})
+	}
+
+	return postEntry(ctx, repo, "BATCH", legs...)
+}
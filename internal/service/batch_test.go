@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepository keeps wallets in memory and simulates Postgres costs: every
+// statement takes latency, and a transaction holds the lock for its whole
+// duration, like the row lock taken by UpdateWallet. The stores it embeds
+// are nil: only what the batching and watch tests use is implemented.
+type fakeRepository struct {
+	WalletStore
+	ShardStore
+	OperationStore
+	JournalStore
+	ScheduleStore
+	InterestStore
+	FeeStore
+	ImportStore
+	AuditStore
+	TenantStore
+	ExchangeStore
+
+	mu         *sync.Mutex
+	latency    time.Duration
+	wallets    map[uuid.UUID]repository.Wallet
+	operations *[]repository.Operation
+}
+
+func newFakeRepository(latency time.Duration, wallets ...repository.Wallet) *fakeRepository {
+	repo := &fakeRepository{
+		mu:         &sync.Mutex{},
+		latency:    latency,
+		wallets:    make(map[uuid.UUID]repository.Wallet),
+		operations: &[]repository.Operation{},
+	}
+	for _, w := range wallets {
+		repo.wallets[w.ID] = w
+	}
+	return repo
+}
+
+func (f *fakeRepository) roundTrip() {
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+}
+
+func (f *fakeRepository) ExecTx(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roundTrip()
+
+	snapshot := make(map[uuid.UUID]repository.Wallet, len(f.wallets))
+	for id, w := range f.wallets {
+		snapshot[id] = w
+	}
+	operations := len(*f.operations)
+
+	// The transaction sees the same state but must not lock again.
+	tx := *f
+	tx.mu = &sync.Mutex{}
+
+	err := fn(&tx)
+	f.roundTrip()
+	if err != nil {
+		f.wallets = snapshot
+		*f.operations = (*f.operations)[:operations]
+	}
+	return err
+}
+
+func (f *fakeRepository) ExecSnapshot(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error {
+	return f.ExecTx(ctx, fn)
+}
+
+func (f *fakeRepository) GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	f.roundTrip()
+	wallet, ok := f.wallets[id]
+	if !ok {
+		return repository.Wallet{}, pgx.ErrNoRows
+	}
+	return wallet, nil
+}
+
+func (f *fakeRepository) GetWalletByIDForUpdate(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	return f.GetWalletByID(ctx, id)
+}
+
+func (f *fakeRepository) GetWalletWithShards(ctx context.Context, id uuid.UUID) (repository.GetWalletWithShardsRow, error) {
+	wallet, err := f.GetWalletByID(ctx, id)
+	return repository.GetWalletWithShardsRow{Wallet: wallet}, err
+}
+
+func (f *fakeRepository) CreateWallet(ctx context.Context, arg repository.CreateWalletParams) (repository.Wallet, error) {
+	f.roundTrip()
+	wallet := repository.Wallet{ID: uuid.New(), Status: string(models.WalletStatusActive)}
+	f.wallets[wallet.ID] = wallet
+	return wallet, nil
+}
+
+func (f *fakeRepository) UpdateWallet(ctx context.Context, arg repository.UpdateWalletParams) (repository.Wallet, error) {
+	f.roundTrip()
+	wallet, ok := f.wallets[arg.ID]
+	if !ok || wallet.Status != string(models.WalletStatusActive) || (arg.Amount < 0 && wallet.Balance+arg.Amount < 0) {
+		return repository.Wallet{}, pgx.ErrNoRows
+	}
+	wallet.Balance += arg.Amount
+	wallet.Version++
+	f.wallets[arg.ID] = wallet
+	return wallet, nil
+}
+
+func (f *fakeRepository) SumWalletShards(ctx context.Context, walletID uuid.UUID) (repository.SumWalletShardsRow, error) {
+	return repository.SumWalletShardsRow{}, nil
+}
+
+func (f *fakeRepository) LockWalletShards(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeRepository) ResetWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeRepository) DeleteWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeRepository) CreateOperation(ctx context.Context, arg repository.CreateOperationParams) (repository.Operation, error) {
+	f.roundTrip()
+	operation := repository.Operation{ID: uuid.New(), WalletID: arg.WalletID, OperationType: arg.OperationType, Amount: arg.Amount}
+	*f.operations = append(*f.operations, operation)
+	return operation, nil
+}
+
+func (f *fakeRepository) CreateOperations(ctx context.Context, arg []repository.CreateOperationsParams) (int64, error) {
+	f.roundTrip()
+	for _, op := range arg {
+		*f.operations = append(*f.operations, repository.Operation{ID: uuid.New(), WalletID: op.WalletID, OperationType: op.OperationType, Amount: op.Amount})
+	}
+	return int64(len(arg)), nil
+}
+
+func (f *fakeRepository) CreateJournalEntry(ctx context.Context, arg repository.CreateJournalEntryParams) (repository.CreateJournalEntryRow, error) {
+	f.roundTrip()
+	return repository.CreateJournalEntryRow{ID: uuid.New(), Description: arg.Description}, nil
+}
+
+func activeWallet(balance int32) repository.Wallet {
+	return repository.Wallet{ID: uuid.New(), Balance: balance, Status: string(models.WalletStatusActive)}
+}
+
+func TestWalletService_ApplyBatch_DecidesInOrder(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("GetWalletByIDForUpdate", ctx, walletID).
+		Return(repository.Wallet{ID: walletID, Balance: 40, Status: string(models.WalletStatusActive)}, nil)
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: walletID, Amount: 20}).
+		Return(repository.Wallet{ID: walletID, Balance: 60}, nil)
+	mockRepo.On("CreateOperations", ctx, []repository.CreateOperationsParams{
+		{WalletID: walletID, OperationType: string(models.OperationDeposit), Amount: 50},
+		{WalletID: walletID, OperationType: string(models.OperationWithdraw), Amount: -30},
+	}).Return(int64(2), nil)
+	mockRepo.On("CreateJournalEntry", ctx, repository.CreateJournalEntryParams{
+		Accounts:    []string{"wallet", "cash_in", "cash_out"},
+		WalletIds:   []uuid.UUID{walletID, uuid.Nil, uuid.Nil},
+		Debits:      []int32{0, 50, 0},
+		Credits:     []int32{20, 0, 30},
+		Currencies:  []string{"", "", ""},
+		Description: "BATCH",
+	}).Return(repository.CreateJournalEntryRow{}, nil)
+
+	batch := []*batchRequest{
+		{ctx: ctx, amount: 50, done: make(chan batchResult, 1)},
+		{ctx: ctx, amount: -100, done: make(chan batchResult, 1)},
+		{ctx: ctx, amount: -30, done: make(chan batchResult, 1)},
+	}
+
+	service.applyBatch(ctx, walletID, batch)
+
+	first, second, third := <-batch[0].done, <-batch[1].done, <-batch[2].done
+	assert.NoError(t, first.err)
+	assert.Equal(t, int32(90), first.wallet.Balance)
+	assert.ErrorIs(t, second.err, ErrInsufficientFunds)
+	assert.NoError(t, third.err)
+	assert.Equal(t, int32(60), third.wallet.Balance)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_ApplyBatch_Frozen(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("GetWalletByIDForUpdate", ctx, walletID).
+		Return(repository.Wallet{ID: walletID, Balance: 40, Status: string(models.WalletStatusFrozen)}, nil)
+
+	batch := []*batchRequest{
+		{ctx: ctx, amount: 50, done: make(chan batchResult, 1)},
+		{ctx: ctx, amount: -10, done: make(chan batchResult, 1)},
+	}
+
+	service.applyBatch(ctx, walletID, batch)
+
+	for _, req := range batch {
+		assert.ErrorIs(t, (<-req.done).err, ErrWalletFrozen)
+	}
+	mockRepo.AssertNotCalled(t, "UpdateWallet")
+}
+
+func TestWalletService_Batching_ConcurrentDeposits(t *testing.T) {
+	wallet := activeWallet(0)
+	repo := newFakeRepository(100*time.Microsecond, wallet)
+	service := NewWalletService(repo, WithBatching(50))
+
+	const callers = 200
+
+	balances := make(chan int32, callers)
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.TopUpWalletBalance(context.Background(), wallet.ID, 1)
+			assert.NoError(t, err)
+			balances <- result.Balance
+		}()
+	}
+	wg.Wait()
+	close(balances)
+
+	// Every caller sees the balance right after its own operation.
+	seen := make(map[int32]bool)
+	for balance := range balances {
+		seen[balance] = true
+	}
+	assert.Len(t, seen, callers)
+
+	assert.Equal(t, int32(callers), repo.wallets[wallet.ID].Balance)
+	assert.Len(t, *repo.operations, callers)
+}
+
+func TestWalletService_Batching_InsufficientFunds(t *testing.T) {
+	wallet := activeWallet(100)
+	repo := newFakeRepository(100*time.Microsecond, wallet)
+	service := NewWalletService(repo, WithBatching(50))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+		rejected int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.TopUpWalletBalance(context.Background(), wallet.ID, -30)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, ErrInsufficientFunds) {
+				rejected++
+				return
+			}
+			assert.NoError(t, err)
+			accepted++
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, accepted)
+	assert.Equal(t, 7, rejected)
+	assert.Equal(t, int32(10), repo.wallets[wallet.ID].Balance)
+	assert.Len(t, *repo.operations, 3)
+}
+
+func TestWalletService_Batching_NotFound(t *testing.T) {
+	repo := newFakeRepository(0)
+	service := NewWalletService(repo, WithBatching(50))
+
+	_, err := service.TopUpWalletBalance(context.Background(), uuid.New(), 10)
+
+	require.ErrorIs(t, err, ErrWalletNotFound)
+}
+
+func TestWalletService_Batching_CancelledBeforeBatch(t *testing.T) {
+	wallet := activeWallet(0)
+	repo := newFakeRepository(0, wallet)
+	service := NewWalletService(repo, WithBatching(50))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := service.TopUpWalletBalance(ctx, wallet.ID, 10)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(0), repo.wallets[wallet.ID].Balance)
+}
+
+// The benchmarks run many concurrent deposits on one wallet against the fake
+// repository, where each statement costs 100µs and a transaction holds the
+// row lock. Without batching every deposit pays for its own transaction.
+func benchmarkHotWallet(b *testing.B, opts ...Option) {
+	wallet := activeWallet(0)
+	repo := newFakeRepository(100*time.Microsecond, wallet)
+	service := NewWalletService(repo, opts...)
+
+	b.SetParallelism(32)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := service.TopUpWalletBalance(context.Background(), wallet.ID, 1); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkTopUpWalletBalance_HotWallet_Direct(b *testing.B) {
+	benchmarkHotWallet(b)
+}
+
+func BenchmarkTopUpWalletBalance_HotWallet_Batched(b *testing.B) {
+	benchmarkHotWallet(b, WithBatching(100))
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+// CacheStats is a snapshot of the wallet cache counters.
+type CacheStats struct {
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRatio  float64 `json:"hit_ratio"`
+	Evictions uint64  `json:"evictions"`
+	Size      int     `json:"size"`
+}
+
+type cacheEntry struct {
+	wallet    repository.Wallet
+	expiresAt time.Time
+}
+
+// walletCache is an LRU of wallets bounded by size, whose entries expire
+// after ttl.
+type walletCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]*list.Element
+	lru     *list.List
+	// generation changes on every invalidation. A read that started before
+	// an invalidation must not store what it read.
+	generation uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func newWalletCache(ttl time.Duration, size int) *walletCache {
+	return &walletCache{
+		ttl:     ttl,
+		size:    max(size, 1),
+		now:     time.Now,
+		entries: make(map[uuid.UUID]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the cached wallet, or the current generation to pass to put
+// after reading the wallet from the repository.
+func (c *walletCache) get(id uuid.UUID) (repository.Wallet, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if c.now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+			c.hits.Add(1)
+			return entry.wallet, c.generation, true
+		}
+		c.removeElement(elem)
+	}
+
+	c.misses.Add(1)
+	return repository.Wallet{}, c.generation, false
+}
+
+func (c *walletCache) put(wallet repository.Wallet, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &cacheEntry{wallet: wallet, expiresAt: c.now().Add(c.ttl)}
+
+	if elem, ok := c.entries[wallet.ID]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[wallet.ID] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *walletCache) invalidate(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[id]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *walletCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	clear(c.entries)
+	c.lru.Init()
+}
+
+func (c *walletCache) removeElement(elem *list.Element) {
+	delete(c.entries, elem.Value.(*cacheEntry).wallet.ID)
+	c.lru.Remove(elem)
+}
+
+func (c *walletCache) stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+
+	return stats
+}
+
+type (
+	primaryReadKey    struct{}
+	consistentReadKey struct{}
+)
+
+// FromPrimary returns a context whose repository reads are served by the
+// primary. The cache is filled this way, so it never stores what a lagging
+// replica returned.
+func FromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+// ReadsPrimary reports whether reads under ctx must go to the primary.
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadKey{}).(bool)
+	return primary
+}
+
+// Consistent marks ctx as carrying a consistency token. GetWalletByID skips
+// the cache under it: an invalidation from another instance may not have
+// arrived yet.
+func Consistent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, true)
+}
+
+func isConsistent(ctx context.Context) bool {
+	consistent, _ := ctx.Value(consistentReadKey{}).(bool)
+	return consistent
+}
+
+// WithCache serves GetWalletByID from an in-memory cache of at most size
+// wallets, each kept for ttl. Writes made through the service drop the
+// cached wallet; writes made elsewhere must be reported via WalletChanged.
+func WithCache(ttl time.Duration, size int) Option {
+	return func(s *WalletService) {
+		s.cache = newWalletCache(ttl, size)
+	}
+}
+
+// CacheStats reports the wallet cache counters; ok is false when the cache
+// is disabled.
+func (s *WalletService) CacheStats() (stats CacheStats, ok bool) {
+	if s.cache == nil {
+		return CacheStats{}, false
+	}
+	return s.cache.stats(), true
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletService_GetWalletByID_Cached(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo, WithCache(time.Minute, 10))
+
+	ctx := context.Background()
+	wallet := repository.Wallet{ID: uuid.New(), Balance: 1000}
+
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), wallet.ID).Return(repository.GetWalletWithShardsRow{Wallet: wallet}, nil).Once()
+
+	for range 3 {
+		result, err := service.GetWalletByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet, result)
+	}
+
+	stats, ok := service.CacheStats()
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.InDelta(t, 2.0/3.0, stats.HitRatio, 1e-9)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_GetWalletByID_CacheNotFound(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo, WithCache(time.Minute, 10))
+
+	ctx := context.Background()
+	walletID := uuid.New()
+	wallet := repository.Wallet{ID: walletID, Balance: 10}
+
+	// Missing wallets are not cached: the second read finds the new wallet.
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), walletID).Return(repository.GetWalletWithShardsRow{}, ErrWalletNotFound).Once()
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), walletID).Return(repository.GetWalletWithShardsRow{Wallet: wallet}, nil).Once()
+
+	_, err := service.GetWalletByID(ctx, walletID)
+	assert.ErrorIs(t, err, ErrWalletNotFound)
+
+	result, err := service.GetWalletByID(ctx, walletID)
+	require.NoError(t, err)
+	assert.Equal(t, wallet, result)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_TopUpWalletBalance_InvalidatesCache(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo, WithCache(time.Minute, 10))
+
+	ctx := context.Background()
+	before := repository.Wallet{ID: uuid.New(), Balance: 100}
+	after := repository.Wallet{ID: before.ID, Balance: 150}
+
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), before.ID).Return(repository.GetWalletWithShardsRow{Wallet: before}, nil).Once()
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: before.ID, Amount: 50}).Return(after, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      before.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        50,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), before.ID).Return(repository.GetWalletWithShardsRow{Wallet: after}, nil).Once()
+
+	_, err := service.GetWalletByID(ctx, before.ID)
+	require.NoError(t, err)
+
+	_, err = service.TopUpWalletBalance(ctx, before.ID, 50)
+	require.NoError(t, err)
+
+	result, err := service.GetWalletByID(ctx, before.ID)
+	require.NoError(t, err)
+	assert.Equal(t, after, result)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletCache_Expiry(t *testing.T) {
+	cache := newWalletCache(time.Second, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	wallet := repository.Wallet{ID: uuid.New()}
+
+	_, generation, _ := cache.get(wallet.ID)
+	cache.put(wallet, generation)
+
+	_, _, ok := cache.get(wallet.ID)
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+
+	_, _, ok = cache.get(wallet.ID)
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.stats().Size)
+}
+
+func TestWalletCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newWalletCache(time.Minute, 2)
+
+	first := repository.Wallet{ID: uuid.New()}
+	second := repository.Wallet{ID: uuid.New()}
+	third := repository.Wallet{ID: uuid.New()}
+
+	cache.put(first, 0)
+	cache.put(second, 0)
+	cache.get(first.ID)
+	cache.put(third, 0)
+
+	_, _, ok := cache.get(second.ID)
+	assert.False(t, ok)
+	_, _, ok = cache.get(first.ID)
+	assert.True(t, ok)
+	_, _, ok = cache.get(third.ID)
+	assert.True(t, ok)
+
+	assert.Equal(t, uint64(1), cache.stats().Evictions)
+}
+
+func TestWalletCache_InvalidateDuringRead(t *testing.T) {
+	cache := newWalletCache(time.Minute, 10)
+	stale := repository.Wallet{ID: uuid.New(), Balance: 100}
+
+	// A write lands between the cache miss and storing what was read.
+	_, generation, _ := cache.get(stale.ID)
+	cache.invalidate(stale.ID)
+	cache.put(stale, generation)
+
+	_, _, ok := cache.get(stale.ID)
+	assert.False(t, ok)
+}
+
+func TestWalletService_GetWalletByID_ConsistentSkipsCache(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo, WithCache(time.Minute, 10))
+
+	ctx := context.Background()
+	stale := repository.Wallet{ID: uuid.New(), Balance: 10}
+	fresh := repository.Wallet{ID: stale.ID, Balance: 20}
+
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(ReadsPrimary), stale.ID).Return(repository.GetWalletWithShardsRow{Wallet: stale}, nil).Once()
+	mockRepo.On("GetWalletWithShards", mock.MatchedBy(isConsistent), stale.ID).Return(repository.GetWalletWithShardsRow{Wallet: fresh}, nil).Once()
+
+	result, err := service.GetWalletByID(ctx, stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stale, result)
+
+	// A read with a consistency token neither uses nor fills the cache.
+	result, err = service.GetWalletByID(Consistent(ctx), stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fresh, result)
+
+	result, err = service.GetWalletByID(ctx, stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stale, result)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,9 @@
+package service
+
+import "errors"
+
+var (
+	ErrWalletNotFound    = errors.New("wallet not found")
+	ErrWalletFrozen      = errors.New("wallet is frozen")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrExchangeRateNotFound  = errors.New("exchange rate not found")
+	ErrExchangeRateExists    = errors.New("exchange rate already exists")
+	ErrInvalidExchangeRate   = errors.New("invalid exchange rate")
+	ErrInvalidExchange       = errors.New("invalid exchange")
+	ErrExchangeQuoteNotFound = errors.New("exchange quote not found")
+	ErrExchangeQuoteExpired  = errors.New("exchange quote has expired")
+	ErrExchangeQuoteExecuted = errors.New("exchange quote is already executed")
+)
+
+const (
+	// MaxSpreadBps is a spread of 100% in basis points.
+	MaxSpreadBps = 10000
+
+	DefaultQuoteTTL  = 30 * time.Second
+	DefaultSpreadBps = 50
+)
+
+type ExchangeServiceInterface interface {
+	CreateExchangeRate(ctx context.Context, p ExchangeRateParams) (repository.ExchangeRate, error)
+	ListExchangeRates(ctx context.Context, baseCurrency, quoteCurrency string, limit int32) ([]repository.ExchangeRate, error)
+	QuoteExchange(ctx context.Context, fromID, toID uuid.UUID, amount int32) (repository.ExchangeQuote, error)
+	ExecuteExchange(ctx context.Context, quoteID uuid.UUID) (Exchange, error)
+}
+
+// WithExchange sets how long quotes hold their rate, the spread taken off
+// the rate and how converted amounts are rounded. The defaults are 30
+// seconds, 50 basis points and DOWN.
+func WithExchange(quoteTTL time.Duration, spreadBps int32, rounding models.Rounding) Option {
+	return func(s *WalletService) {
+		s.quoteTTL = quoteTTL
+		s.spreadBps = spreadBps
+		s.exchangeRounding = rounding
+	}
+}
+
+type ExchangeRateParams struct {
+	BaseCurrency  string
+	QuoteCurrency string
+	RateMicros    int64
+	// EffectiveFrom defaults to now.
+	EffectiveFrom time.Time
+	Source        string
+}
+
+// Exchange is an executed quote with both wallets after the conversion.
+type Exchange struct {
+	Quote repository.ExchangeQuote `json:"quote"`
+	From  repository.Wallet        `json:"from"`
+	To    repository.Wallet        `json:"to"`
+}
+
+func (s *WalletService) CreateExchangeRate(ctx context.Context, p ExchangeRateParams) (repository.ExchangeRate, error) {
+	base, quote := strings.ToUpper(p.BaseCurrency), strings.ToUpper(p.QuoteCurrency)
+	switch {
+	case !currencyPattern.MatchString(base) || base == NoCurrency:
+		return repository.ExchangeRate{}, fmt.Errorf("%w: invalid base currency %q", ErrInvalidExchangeRate, p.BaseCurrency)
+	case !currencyPattern.MatchString(quote) || quote == NoCurrency:
+		return repository.ExchangeRate{}, fmt.Errorf("%w: invalid quote currency %q", ErrInvalidExchangeRate, p.QuoteCurrency)
+	case base == quote:
+		return repository.ExchangeRate{}, fmt.Errorf("%w: base and quote currencies are the same", ErrInvalidExchangeRate)
+	case p.RateMicros <= 0:
+		return repository.ExchangeRate{}, fmt.Errorf("%w: rate must be positive", ErrInvalidExchangeRate)
+	case strings.TrimSpace(p.Source) == "":
+		return repository.ExchangeRate{}, fmt.Errorf("%w: source is required", ErrInvalidExchangeRate)
+	}
+
+	effectiveFrom := p.EffectiveFrom
+	if effectiveFrom.IsZero() {
+		effectiveFrom = time.Now()
+	}
+
+	rate, err := s.repo.CreateExchangeRate(ctx, repository.CreateExchangeRateParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		RateMicros:    p.RateMicros,
+		EffectiveFrom: effectiveFrom,
+		Source:        strings.TrimSpace(p.Source),
+	})
+	if isExchangeRateTaken(err) {
+		return repository.ExchangeRate{}, ErrExchangeRateExists
+	}
+	if err != nil {
+		return repository.ExchangeRate{}, err
+	}
+
+	return rate, nil
+}
+
+func isExchangeRateTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == "exchange_rates_pair_key"
+}
+
+// ListExchangeRates returns the rates of a pair, newest first, or of all
+// pairs when a currency is empty.
+func (s *WalletService) ListExchangeRates(ctx context.Context, baseCurrency, quoteCurrency string, limit int32) ([]repository.ExchangeRate, error) {
+	return s.repo.ListExchangeRates(ctx, repository.ListExchangeRatesParams{
+		BaseCurrency:  strings.ToUpper(baseCurrency),
+		QuoteCurrency: strings.ToUpper(quoteCurrency),
+		Limit:         limit,
+	})
+}
+
+// QuoteExchange prices converting amount from one wallet into another of the
+// same owner at the rate in effect now, less the spread. The quote holds the
+// rate until it expires, however the rates change meanwhile.
+func (s *WalletService) QuoteExchange(ctx context.Context, fromID, toID uuid.UUID, amount int32) (repository.ExchangeQuote, error) {
+	if amount <= 0 {
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: amount must be positive", ErrInvalidExchange)
+	}
+	if fromID == toID {
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: wallets must differ", ErrInvalidExchange)
+	}
+
+	from, err := readWallet(ctx, s.repo, fromID)
+	if err != nil {
+		return repository.ExchangeQuote{}, err
+	}
+	to, err := readWallet(ctx, s.repo, toID)
+	if err != nil {
+		return repository.ExchangeQuote{}, err
+	}
+
+	switch {
+	case from.TenantID != to.TenantID || from.OwnerID != to.OwnerID:
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: wallets belong to different owners", ErrInvalidExchange)
+	case from.Currency == NoCurrency || to.Currency == NoCurrency:
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: wallets without a currency cannot convert", ErrInvalidExchange)
+	case from.Currency == to.Currency:
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: wallets have the same currency", ErrInvalidExchange)
+	}
+
+	now := time.Now()
+
+	rate, err := s.repo.GetEffectiveExchangeRate(ctx, repository.GetEffectiveExchangeRateParams{
+		BaseCurrency:  from.Currency,
+		QuoteCurrency: to.Currency,
+		At:            now,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: no rate from %s to %s", ErrExchangeRateNotFound, from.Currency, to.Currency)
+	}
+	if err != nil {
+		return repository.ExchangeQuote{}, err
+	}
+
+	converted, ok := convert(amount, rate.RateMicros, s.spreadBps, s.exchangeRounding)
+	if !ok {
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: %d %s does not fit into a balance", ErrInvalidExchange, amount, from.Currency)
+	}
+	if converted == 0 {
+		return repository.ExchangeQuote{}, fmt.Errorf("%w: %d %s converts to nothing", ErrInvalidExchange, amount, from.Currency)
+	}
+
+	return s.repo.CreateExchangeQuote(ctx, repository.CreateExchangeQuoteParams{
+		FromWalletID:    fromID,
+		ToWalletID:      toID,
+		RateID:          rate.ID,
+		FromCurrency:    from.Currency,
+		ToCurrency:      to.Currency,
+		RateMicros:      rate.RateMicros,
+		SpreadBps:       s.spreadBps,
+		Rounding:        string(s.exchangeRounding),
+		Amount:          amount,
+		ConvertedAmount: converted,
+		ExpiresAt:       now.Add(s.quoteTTL),
+	})
+}
+
+// ExecuteExchange debits the quoted amount from one wallet and credits the
+// converted amount to the other, at the rate of the quote. A quote executes
+// once, before it expires; a failed execution, for want of funds say, may be
+// retried until then.
+func (s *WalletService) ExecuteExchange(ctx context.Context, quoteID uuid.UUID) (Exchange, error) {
+	quote, err := s.repo.GetExchangeQuote(ctx, quoteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Exchange{}, ErrExchangeQuoteNotFound
+	}
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	switch {
+	case quote.FromOperationID != uuid.Nil:
+		return Exchange{}, ErrExchangeQuoteExecuted
+	case !time.Now().Before(quote.ExpiresAt):
+		return Exchange{}, ErrExchangeQuoteExpired
+	}
+
+	defer s.WalletChanged(quote.FromWalletID)
+	defer s.WalletChanged(quote.ToWalletID)
+
+	var exchange Exchange
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := lockWallets(ctx, repo, quote.FromWalletID, quote.ToWalletID); err != nil {
+			return err
+		}
+
+		var debit, credit repository.Operation
+		var err error
+		if exchange.From, debit, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      quote.FromWalletID,
+			OperationType: string(models.OperationExchange),
+			Amount:        -quote.Amount,
+		}); err != nil {
+			return err
+		}
+		if exchange.To, credit, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      quote.ToWalletID,
+			OperationType: string(models.OperationExchange),
+			Amount:        quote.ConvertedAmount,
+		}); err != nil {
+			return err
+		}
+
+		// The exchange account takes the amount in and pays the converted
+		// amount out, each in its own currency.
+		if err := postEntry(ctx, repo, string(models.OperationExchange),
+			walletLeg(quote.FromWalletID, -quote.Amount),
+			journalLeg{account: models.JournalAccountExchange, amount: quote.Amount, currency: quote.FromCurrency},
+			journalLeg{account: models.JournalAccountExchange, amount: -quote.ConvertedAmount, currency: quote.ToCurrency},
+			walletLeg(quote.ToWalletID, quote.ConvertedAmount),
+		); err != nil {
+			return err
+		}
+
+		// The quote is locked from here on: a concurrent execution waits and
+		// then finds it executed.
+		exchange.Quote, err = repo.ExecuteExchangeQuote(ctx, repository.ExecuteExchangeQuoteParams{
+			ID:              quoteID,
+			FromOperationID: debit.ID,
+			ToOperationID:   credit.ID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrExchangeQuoteExecuted
+		}
+		if err != nil {
+			return err
+		}
+
+		fromBefore, toBefore := exchange.From, exchange.To
+		fromBefore.Balance += quote.Amount
+		toBefore.Balance -= quote.ConvertedAmount
+		if err := recordAudit(ctx, repo, models.AuditActionExchange, fromBefore, exchange.From); err != nil {
+			return err
+		}
+		return recordAudit(ctx, repo, models.AuditActionExchange, toBefore, exchange.To)
+	})
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	return exchange, nil
+}
+
+// convert returns amount at rateMicros less spreadBps, rounded. It reports
+// false if the result does not fit into a balance.
+func convert(amount int32, rateMicros int64, spreadBps int32, rounding models.Rounding) (int32, bool) {
+	n := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(rateMicros))
+	n.Mul(n, big.NewInt(int64(MaxSpreadBps-spreadBps)))
+	d := int64(microsPerUnit * MaxSpreadBps)
+
+	q, r := new(big.Int).QuoRem(n, big.NewInt(d), new(big.Int))
+	if !q.IsInt64() || q.Int64() > math.MaxInt32 {
+		return 0, false
+	}
+
+	converted := roundQuotient(q.Int64(), r.Int64(), d, rounding)
+	if converted > math.MaxInt32 {
+		return 0, false
+	}
+
+	return int32(converted), true
+}
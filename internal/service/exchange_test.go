@@ -0,0 +1,229 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCurrencyWallet(t *testing.T, svc *service.WalletService, currency string, balance int32) repository.Wallet {
+	t.Helper()
+
+	wallet, err := svc.OpenWallet(context.Background(), service.NewWallet{Currency: currency, InitialBalance: balance})
+	require.NoError(t, err)
+
+	return wallet
+}
+
+func addRate(t *testing.T, svc *service.WalletService, base, quote string, rateMicros int64) repository.ExchangeRate {
+	t.Helper()
+
+	rate, err := svc.CreateExchangeRate(context.Background(), service.ExchangeRateParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		RateMicros:    rateMicros,
+		EffectiveFrom: time.Now().Add(-time.Minute),
+		Source:        "test",
+	})
+	require.NoError(t, err)
+
+	return rate
+}
+
+func TestWalletService_Exchange(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	usd := newCurrencyWallet(t, svc, "USD", 1500)
+	eur := newCurrencyWallet(t, svc, "EUR", 10)
+	rate := addRate(t, svc, "usd", "eur", 920000)
+
+	// A rate that takes effect later is not quoted yet.
+	_, err := svc.CreateExchangeRate(ctx, service.ExchangeRateParams{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "EUR",
+		RateMicros:    2000000,
+		EffectiveFrom: time.Now().Add(time.Hour),
+		Source:        "test",
+	})
+	require.NoError(t, err)
+
+	quote, err := svc.QuoteExchange(ctx, usd.ID, eur.ID, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, rate.ID, quote.RateID)
+	assert.Equal(t, int64(920000), quote.RateMicros)
+	assert.Equal(t, int32(service.DefaultSpreadBps), quote.SpreadBps)
+	assert.Equal(t, string(models.RoundingDown), quote.Rounding)
+	assert.Equal(t, int32(915), quote.ConvertedAmount, "1000 * 0.92 less 0.5% is 915.4")
+	assert.WithinDuration(t, time.Now().Add(service.DefaultQuoteTTL), quote.ExpiresAt, time.Second)
+
+	exchange, err := svc.ExecuteExchange(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(500), exchange.From.Balance)
+	assert.Equal(t, int32(925), exchange.To.Balance)
+	assert.NotEqual(t, uuid.Nil, exchange.Quote.FromOperationID)
+	assert.NotEqual(t, uuid.Nil, exchange.Quote.ToOperationID)
+
+	assert.Equal(t, exchange.Quote.FromOperationID, operationOf(t, svc, usd.ID, -1000))
+	assert.Equal(t, exchange.Quote.ToOperationID, operationOf(t, svc, eur.ID, 915))
+
+	_, err = svc.ExecuteExchange(ctx, quote.ID)
+	assert.ErrorIs(t, err, service.ErrExchangeQuoteExecuted)
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+	assert.Contains(t, accountTotals(t, balance, "USD"), service.AccountTotal{Account: models.JournalAccountExchange, Credit: 1000},
+		"the exchange account takes dollars in")
+	assert.Contains(t, accountTotals(t, balance, "EUR"), service.AccountTotal{Account: models.JournalAccountExchange, Debit: 915},
+		"and pays euros out, each balanced in its own currency")
+}
+
+func TestWalletService_Exchange_Rounding(t *testing.T) {
+	ctx := context.Background()
+
+	// 3 at 1.5 is 4.5 exactly, which each rule settles differently.
+	for rounding, want := range map[models.Rounding]int32{
+		models.RoundingDown:     4,
+		models.RoundingHalfUp:   5,
+		models.RoundingHalfEven: 4,
+	} {
+		t.Run(string(rounding), func(t *testing.T) {
+			svc := service.NewWalletService(memory.NewStore(), service.WithExchange(time.Minute, 0, rounding))
+			addRate(t, svc, "GBP", "USD", 1500000)
+
+			quote, err := svc.QuoteExchange(ctx, newCurrencyWallet(t, svc, "GBP", 3).ID, newCurrencyWallet(t, svc, "USD", 0).ID, 3)
+			require.NoError(t, err)
+			assert.Equal(t, want, quote.ConvertedAmount)
+		})
+	}
+}
+
+func TestWalletService_Exchange_Expired(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore(), service.WithExchange(time.Nanosecond, 0, models.RoundingDown))
+	ctx := context.Background()
+
+	addRate(t, svc, "USD", "EUR", 900000)
+	usd := newCurrencyWallet(t, svc, "USD", 100)
+	eur := newCurrencyWallet(t, svc, "EUR", 0)
+
+	quote, err := svc.QuoteExchange(ctx, usd.ID, eur.ID, 100)
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond)
+	_, err = svc.ExecuteExchange(ctx, quote.ID)
+	assert.ErrorIs(t, err, service.ErrExchangeQuoteExpired)
+
+	got, err := svc.GetWalletByID(ctx, usd.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(100), got.Balance)
+}
+
+func TestWalletService_Exchange_InsufficientFunds(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	addRate(t, svc, "USD", "EUR", 900000)
+	usd := newCurrencyWallet(t, svc, "USD", 50)
+	eur := newCurrencyWallet(t, svc, "EUR", 0)
+
+	quote, err := svc.QuoteExchange(ctx, usd.ID, eur.ID, 100)
+	require.NoError(t, err)
+
+	_, err = svc.ExecuteExchange(ctx, quote.ID)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	got, err := svc.GetWalletByID(ctx, eur.ID)
+	require.NoError(t, err)
+	assert.Zero(t, got.Balance, "a failed exchange credits nothing")
+
+	// The quote stays open until it expires.
+	_, err = svc.ChangeWalletBalance(ctx, usd.ID, 50)
+	require.NoError(t, err)
+	exchange, err := svc.ExecuteExchange(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Zero(t, exchange.From.Balance)
+	assert.Equal(t, quote.ConvertedAmount, exchange.To.Balance)
+}
+
+func TestWalletService_QuoteExchange_Invalid(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	addRate(t, svc, "USD", "EUR", 900000)
+	usd := newCurrencyWallet(t, svc, "USD", 100)
+	eur := newCurrencyWallet(t, svc, "EUR", 0)
+	otherUSD := newCurrencyWallet(t, svc, "USD", 0)
+	plain := newWallet(t, svc, 100)
+	jpy := newCurrencyWallet(t, svc, "JPY", 0)
+
+	owned := newCurrencyWallet(t, svc, "EUR", 0)
+	_, err := svc.SetWalletOwner(ctx, owned.ID, uuid.New())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		from, to uuid.UUID
+		amount   int32
+		err      error
+	}{
+		{"zero amount", usd.ID, eur.ID, 0, service.ErrInvalidExchange},
+		{"same wallet", usd.ID, usd.ID, 10, service.ErrInvalidExchange},
+		{"same currency", usd.ID, otherUSD.ID, 10, service.ErrInvalidExchange},
+		{"no currency", plain.ID, eur.ID, 10, service.ErrInvalidExchange},
+		{"different owners", usd.ID, owned.ID, 10, service.ErrInvalidExchange},
+		{"converts to nothing", usd.ID, eur.ID, 1, service.ErrInvalidExchange},
+		{"no rate", usd.ID, jpy.ID, 10, service.ErrExchangeRateNotFound},
+		{"missing wallet", usd.ID, uuid.New(), 10, service.ErrWalletNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.QuoteExchange(ctx, tt.from, tt.to, tt.amount)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	_, err = svc.ExecuteExchange(ctx, uuid.New())
+	assert.ErrorIs(t, err, service.ErrExchangeQuoteNotFound)
+}
+
+func TestWalletService_CreateExchangeRate(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	at := time.Now().Truncate(time.Second)
+	valid := service.ExchangeRateParams{BaseCurrency: "usd", QuoteCurrency: "EUR", RateMicros: 920000, EffectiveFrom: at, Source: " ECB "}
+
+	rate, err := svc.CreateExchangeRate(ctx, valid)
+	require.NoError(t, err)
+	assert.Equal(t, "USD", rate.BaseCurrency)
+	assert.Equal(t, "ECB", rate.Source)
+
+	_, err = svc.CreateExchangeRate(ctx, valid)
+	assert.ErrorIs(t, err, service.ErrExchangeRateExists)
+
+	for name, change := range map[string]func(p *service.ExchangeRateParams){
+		"bad base":      func(p *service.ExchangeRateParams) { p.BaseCurrency = "US" },
+		"no currency":   func(p *service.ExchangeRateParams) { p.QuoteCurrency = service.NoCurrency },
+		"same currency": func(p *service.ExchangeRateParams) { p.QuoteCurrency = "USD" },
+		"zero rate":     func(p *service.ExchangeRateParams) { p.RateMicros = 0 },
+		"no source":     func(p *service.ExchangeRateParams) { p.Source = " " },
+	} {
+		p := valid
+		change(&p)
+		_, err := svc.CreateExchangeRate(ctx, p)
+		assert.ErrorIs(t, err, service.ErrInvalidExchangeRate, name)
+	}
+
+	rates, err := svc.ListExchangeRates(ctx, "usd", "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []repository.ExchangeRate{rate}, rates)
+}
@@ -0,0 +1,465 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrFeeScheduleNotFound = errors.New("fee schedule not found")
+	ErrFeeScheduleExists   = errors.New("fee schedule already exists")
+	ErrInvalidFeeSchedule  = errors.New("invalid fee schedule")
+	ErrInvalidFeeQuote     = errors.New("invalid fee quote")
+
+	errFeeWalletNotFound = errors.New("fee wallet not found")
+)
+
+// DefaultFeeWalletID is the system wallet created by the fees migration.
+var DefaultFeeWalletID = uuid.MustParse("fee00000-0000-4000-8000-000000000000")
+
+// MaxFeeRateBps is 100% in basis points.
+const MaxFeeRateBps = 10000
+
+type FeeServiceInterface interface {
+	CreateFeeSchedule(ctx context.Context, p FeeScheduleParams) (FeeSchedule, error)
+	GetFeeSchedule(ctx context.Context, id uuid.UUID) (FeeSchedule, error)
+	ListFeeSchedules(ctx context.Context) ([]FeeSchedule, error)
+	UpdateFeeSchedule(ctx context.Context, id uuid.UUID, p FeeScheduleParams) (FeeSchedule, error)
+	DeleteFeeSchedule(ctx context.Context, id uuid.UUID) error
+	QuoteFee(ctx context.Context, walletID uuid.UUID, opType models.OperationType, amount int32) (FeeQuote, error)
+}
+
+// WithFees charges the fee schedules on balance changes and transfers and
+// credits the fees to the given wallet. Without it no fees are charged.
+func WithFees(feeWalletID uuid.UUID) Option {
+	return func(s *WalletService) {
+		s.feeWalletID = feeWalletID
+	}
+}
+
+type FeeTierParams struct {
+	MinAmount  int32
+	FlatAmount int32
+	RateBps    int32
+}
+
+// FeeScheduleParams prices an operation type. FLAT schedules charge
+// FlatAmount, PERCENTAGE ones RateBps of the amount and TIERED ones the
+// flat amount and rate of the tier the amount falls in.
+type FeeScheduleParams struct {
+	OperationType models.OperationType
+	// ProductID limits the schedule to wallets whose product, set with
+	// SetWalletProduct, is ProductID; without it the schedule applies to all
+	// other wallets.
+	ProductID  uuid.UUID
+	Kind       models.FeeKind
+	FlatAmount int32
+	RateBps    int32
+	MinFee     int32
+	// MaxFee caps the fee unless it is zero.
+	MaxFee int32
+	Tiers  []FeeTierParams
+}
+
+func (p FeeScheduleParams) validate() error {
+	switch p.OperationType {
+	case models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer:
+	default:
+		return fmt.Errorf("%w: operation type must be %s, %s or %s", ErrInvalidFeeSchedule, models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer)
+	}
+
+	switch {
+	case p.FlatAmount < 0 || p.MinFee < 0 || p.MaxFee < 0:
+		return fmt.Errorf("%w: amounts must not be negative", ErrInvalidFeeSchedule)
+	case p.RateBps < 0 || p.RateBps > MaxFeeRateBps:
+		return fmt.Errorf("%w: rate must be 0 to %d basis points", ErrInvalidFeeSchedule, MaxFeeRateBps)
+	case p.MaxFee != 0 && p.MaxFee < p.MinFee:
+		return fmt.Errorf("%w: max fee is below min fee", ErrInvalidFeeSchedule)
+	}
+
+	switch p.Kind {
+	case models.FeeKindFlat:
+		if p.RateBps != 0 || len(p.Tiers) > 0 {
+			return fmt.Errorf("%w: a flat fee has no rate or tiers", ErrInvalidFeeSchedule)
+		}
+	case models.FeeKindPercentage:
+		if p.FlatAmount != 0 || len(p.Tiers) > 0 {
+			return fmt.Errorf("%w: a percentage fee has no flat amount or tiers", ErrInvalidFeeSchedule)
+		}
+	case models.FeeKindTiered:
+		if p.FlatAmount != 0 || p.RateBps != 0 || len(p.Tiers) == 0 {
+			return fmt.Errorf("%w: a tiered fee is priced by its tiers only", ErrInvalidFeeSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be %s, %s or %s", ErrInvalidFeeSchedule, models.FeeKindFlat, models.FeeKindPercentage, models.FeeKindTiered)
+	}
+
+	seen := make(map[int32]bool, len(p.Tiers))
+	for _, t := range p.Tiers {
+		switch {
+		case t.MinAmount < 0 || t.FlatAmount < 0:
+			return fmt.Errorf("%w: tier amounts must not be negative", ErrInvalidFeeSchedule)
+		case t.RateBps < 0 || t.RateBps > MaxFeeRateBps:
+			return fmt.Errorf("%w: tier rate must be 0 to %d basis points", ErrInvalidFeeSchedule, MaxFeeRateBps)
+		case seen[t.MinAmount]:
+			return fmt.Errorf("%w: two tiers start at %d", ErrInvalidFeeSchedule, t.MinAmount)
+		}
+		seen[t.MinAmount] = true
+	}
+
+	return nil
+}
+
+// FeeSchedule is a schedule with its tiers, ordered by min amount.
+type FeeSchedule struct {
+	repository.FeeSchedule
+	Tiers []repository.FeeTier `json:"tiers"`
+}
+
+// FeeQuote is the fee an operation would be charged now.
+type FeeQuote struct {
+	WalletID      uuid.UUID            `json:"wallet_id"`
+	OperationType models.OperationType `json:"operation_type"`
+	Amount        int32                `json:"amount"`
+	Fee           int32                `json:"fee"`
+	// ScheduleID is zero when no schedule applies.
+	ScheduleID uuid.UUID `json:"schedule_id"`
+}
+
+func (s *WalletService) CreateFeeSchedule(ctx context.Context, p FeeScheduleParams) (FeeSchedule, error) {
+	if err := p.validate(); err != nil {
+		return FeeSchedule{}, err
+	}
+
+	var schedule FeeSchedule
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := checkFeeProduct(ctx, repo, p.ProductID); err != nil {
+			return err
+		}
+
+		created, err := repo.CreateFeeSchedule(ctx, repository.CreateFeeScheduleParams{
+			OperationType: string(p.OperationType),
+			ProductID:     p.ProductID,
+			Kind:          string(p.Kind),
+			FlatAmount:    p.FlatAmount,
+			RateBps:       p.RateBps,
+			MinFee:        p.MinFee,
+			MaxFee:        p.MaxFee,
+		})
+		if err != nil {
+			return err
+		}
+
+		schedule, err = putFeeTiers(ctx, repo, created, p.Tiers)
+		return err
+	})
+	if isFeeScheduleTaken(err) {
+		return FeeSchedule{}, ErrFeeScheduleExists
+	}
+	if err != nil {
+		return FeeSchedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (s *WalletService) GetFeeSchedule(ctx context.Context, id uuid.UUID) (FeeSchedule, error) {
+	schedule, err := s.repo.GetFeeSchedule(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return FeeSchedule{}, ErrFeeScheduleNotFound
+	}
+	if err != nil {
+		return FeeSchedule{}, err
+	}
+
+	return withFeeTiers(ctx, s.repo, schedule)
+}
+
+// ListFeeSchedules returns every schedule by operation type, the default
+// one of each type first.
+func (s *WalletService) ListFeeSchedules(ctx context.Context) ([]FeeSchedule, error) {
+	schedules, err := s.repo.ListFeeSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]FeeSchedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		withTiers, err := withFeeTiers(ctx, s.repo, schedule)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, withTiers)
+	}
+
+	return result, nil
+}
+
+// UpdateFeeSchedule replaces a schedule with its tiers. Fees charged already
+// are not affected.
+func (s *WalletService) UpdateFeeSchedule(ctx context.Context, id uuid.UUID, p FeeScheduleParams) (FeeSchedule, error) {
+	if err := p.validate(); err != nil {
+		return FeeSchedule{}, err
+	}
+
+	var schedule FeeSchedule
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := checkFeeProduct(ctx, repo, p.ProductID); err != nil {
+			return err
+		}
+
+		updated, err := repo.UpdateFeeSchedule(ctx, repository.UpdateFeeScheduleParams{
+			ID:            id,
+			OperationType: string(p.OperationType),
+			ProductID:     p.ProductID,
+			Kind:          string(p.Kind),
+			FlatAmount:    p.FlatAmount,
+			RateBps:       p.RateBps,
+			MinFee:        p.MinFee,
+			MaxFee:        p.MaxFee,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrFeeScheduleNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := repo.DeleteFeeTiers(ctx, id); err != nil {
+			return err
+		}
+
+		schedule, err = putFeeTiers(ctx, repo, updated, p.Tiers)
+		return err
+	})
+	if isFeeScheduleTaken(err) {
+		return FeeSchedule{}, ErrFeeScheduleExists
+	}
+	if err != nil {
+		return FeeSchedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (s *WalletService) DeleteFeeSchedule(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.repo.DeleteFeeSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrFeeScheduleNotFound
+	}
+	return nil
+}
+
+// SetWalletProduct makes productID the product of the wallet, whose fee
+// schedules then apply to it, or leaves the wallet without a product with a
+// zero productID. It does not change the interest the wallet earns.
+func (s *WalletService) SetWalletProduct(ctx context.Context, walletID, productID uuid.UUID) (repository.Wallet, error) {
+	defer s.WalletChanged(walletID)
+
+	var wallet repository.Wallet
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := checkFeeProduct(ctx, repo, productID); err != nil {
+			return err
+		}
+
+		var err error
+		if wallet, err = repo.SetWalletProduct(ctx, repository.SetWalletProductParams{ID: walletID, ProductID: productID}); err != nil {
+			return err
+		}
+
+		wallet, err = sumWalletShards(ctx, repo, wallet)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// QuoteFee returns the fee a positive amount of the given operation type
+// would be charged on the wallet now, without changing anything.
+func (s *WalletService) QuoteFee(ctx context.Context, walletID uuid.UUID, opType models.OperationType, amount int32) (FeeQuote, error) {
+	switch {
+	case opType != models.OperationDeposit && opType != models.OperationWithdraw && opType != models.OperationTransfer:
+		return FeeQuote{}, fmt.Errorf("%w: operation type must be %s, %s or %s", ErrInvalidFeeQuote, models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer)
+	case amount <= 0:
+		return FeeQuote{}, fmt.Errorf("%w: amount must be positive", ErrInvalidFeeQuote)
+	}
+
+	if _, err := readWallet(ctx, s.repo, walletID); err != nil {
+		return FeeQuote{}, err
+	}
+
+	quote := FeeQuote{
+		WalletID:      walletID,
+		OperationType: opType,
+		Amount:        amount,
+	}
+
+	schedule, ok, err := s.walletFeeSchedule(ctx, s.repo, walletID, opType)
+	if err != nil || !ok {
+		return quote, err
+	}
+
+	quote.Fee = schedule.fee(amount)
+	quote.ScheduleID = schedule.ID
+
+	return quote, nil
+}
+
+func checkFeeProduct(ctx context.Context, repo InterestStore, productID uuid.UUID) error {
+	if productID == uuid.Nil {
+		return nil
+	}
+
+	_, err := repo.GetInterestProduct(ctx, productID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInterestProductNotFound
+	}
+	return err
+}
+
+func putFeeTiers(ctx context.Context, repo FeeStore, schedule repository.FeeSchedule, tiers []FeeTierParams) (FeeSchedule, error) {
+	for _, t := range tiers {
+		if err := repo.CreateFeeTier(ctx, repository.CreateFeeTierParams{
+			ScheduleID: schedule.ID,
+			MinAmount:  t.MinAmount,
+			FlatAmount: t.FlatAmount,
+			RateBps:    t.RateBps,
+		}); err != nil {
+			return FeeSchedule{}, err
+		}
+	}
+
+	return withFeeTiers(ctx, repo, schedule)
+}
+
+func withFeeTiers(ctx context.Context, repo FeeStore, schedule repository.FeeSchedule) (FeeSchedule, error) {
+	tiers, err := repo.ListFeeTiers(ctx, schedule.ID)
+	if err != nil {
+		return FeeSchedule{}, err
+	}
+
+	return FeeSchedule{FeeSchedule: schedule, Tiers: nonNilTiers(tiers)}, nil
+}
+
+func nonNilTiers(tiers []repository.FeeTier) []repository.FeeTier {
+	if tiers == nil {
+		return []repository.FeeTier{}
+	}
+	return tiers
+}
+
+func isFeeScheduleTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == "fee_schedules_operation_type_product_id_key"
+}
+
+// walletFeeSchedule returns the schedule that prices opType on the wallet,
+// if fees are charged and one applies.
+func (s *WalletService) walletFeeSchedule(ctx context.Context, repo WalletRepositoryInterface, walletID uuid.UUID, opType models.OperationType) (FeeSchedule, bool, error) {
+	if s.feeWalletID == uuid.Nil || walletID == s.feeWalletID {
+		return FeeSchedule{}, false, nil
+	}
+
+	schedule, err := repo.GetWalletFeeSchedule(ctx, repository.GetWalletFeeScheduleParams{
+		WalletID:      walletID,
+		OperationType: string(opType),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return FeeSchedule{}, false, nil
+	}
+	if err != nil {
+		return FeeSchedule{}, false, err
+	}
+
+	if models.FeeKind(schedule.Kind) != models.FeeKindTiered {
+		return FeeSchedule{FeeSchedule: schedule}, true, nil
+	}
+
+	withTiers, err := withFeeTiers(ctx, repo, schedule)
+	return withTiers, err == nil, err
+}
+
+// walletFee is the fee of amount of type opType on the wallet, zero when no
+// schedule applies.
+func (s *WalletService) walletFee(ctx context.Context, repo WalletRepositoryInterface, walletID uuid.UUID, opType models.OperationType, amount int32) (int32, error) {
+	schedule, ok, err := s.walletFeeSchedule(ctx, repo, walletID, opType)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return schedule.fee(amount), nil
+}
+
+// fee prices amount, whatever its sign. Percentages are rounded half up.
+func (schedule FeeSchedule) fee(amount int32) int32 {
+	base := int64(amount)
+	if base < 0 {
+		base = -base
+	}
+
+	flat, rate := schedule.FlatAmount, schedule.RateBps
+	if models.FeeKind(schedule.Kind) == models.FeeKindTiered {
+		flat, rate = 0, 0
+		for _, t := range schedule.Tiers {
+			if base >= int64(t.MinAmount) {
+				flat, rate = t.FlatAmount, t.RateBps
+			}
+		}
+	}
+
+	fee := int64(flat) + roundDiv(base*int64(rate), MaxFeeRateBps, models.RoundingHalfUp)
+	fee = max(fee, int64(schedule.MinFee))
+	if schedule.MaxFee > 0 {
+		fee = min(fee, int64(schedule.MaxFee))
+	}
+
+	return int32(min(fee, math.MaxInt32))
+}
+
+// chargeFee debits fee from the wallet and credits it to the fee wallet,
+// recording a FEE operation on both.
+func (s *WalletService) chargeFee(ctx context.Context, repo WalletRepositoryInterface, walletID uuid.UUID, fee int32) (repository.Wallet, error) {
+	wallet, err := applyOperationAs(ctx, repo, walletID, models.OperationFee, -fee)
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	if err := s.collectFee(ctx, repo, int64(fee)); err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// collectFee credits fees charged already to the fee wallet.
+func (s *WalletService) collectFee(ctx context.Context, repo WalletRepositoryInterface, fee int64) error {
+	if fee > math.MaxInt32 {
+		return errBalanceOverflow
+	}
+
+	// The fee wallet belongs to the default tenant, whoever pays the fee.
+	_, err := applyOperationAs(withoutTenant(ctx), repo, s.feeWalletID, models.OperationFee, int32(fee))
+	if errors.Is(err, ErrWalletNotFound) {
+		return errFeeWalletNotFound
+	}
+	return err
+}
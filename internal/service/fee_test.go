@@ -0,0 +1,306 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFeeService returns a service charging fees to the default fee wallet.
+func newFeeService(t *testing.T, opts ...service.Option) *service.WalletService {
+	t.Helper()
+
+	store := memory.NewStore()
+	store.AddWallet(service.DefaultFeeWalletID)
+
+	svc := service.NewWalletService(store, append(opts, service.WithFees(service.DefaultFeeWalletID))...)
+	require.NoError(t, svc.MarkSystemWallet(context.Background(), service.DefaultFeeWalletID))
+
+	return svc
+}
+
+func feeWalletBalance(t *testing.T, svc *service.WalletService) int32 {
+	t.Helper()
+
+	wallet, err := svc.GetWalletByID(context.Background(), service.DefaultFeeWalletID)
+	require.NoError(t, err)
+
+	return wallet.Balance
+}
+
+func TestWalletService_QuoteFee(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule service.FeeScheduleParams
+		amount   int32
+		fee      int32
+	}{
+		{"flat", service.FeeScheduleParams{Kind: models.FeeKindFlat, FlatAmount: 3}, 1000, 3},
+		{"percentage", service.FeeScheduleParams{Kind: models.FeeKindPercentage, RateBps: 150}, 1000, 15},
+		{"percentage rounds half up", service.FeeScheduleParams{Kind: models.FeeKindPercentage, RateBps: 50}, 100, 1},
+		{"min fee", service.FeeScheduleParams{Kind: models.FeeKindPercentage, RateBps: 100, MinFee: 5}, 100, 5},
+		{"max fee", service.FeeScheduleParams{Kind: models.FeeKindPercentage, RateBps: 100, MaxFee: 20}, 10000, 20},
+		{"below the first tier", tiered(), 50, 0},
+		{"first tier", tiered(), 100, 2},
+		{"second tier", tiered(), 1000, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFeeService(t)
+			ctx := context.Background()
+
+			wallet := newWallet(t, svc, 0)
+
+			tt.schedule.OperationType = models.OperationWithdraw
+			schedule, err := svc.CreateFeeSchedule(ctx, tt.schedule)
+			require.NoError(t, err)
+
+			quote, err := svc.QuoteFee(ctx, wallet.ID, models.OperationWithdraw, tt.amount)
+			require.NoError(t, err)
+			assert.Equal(t, tt.fee, quote.Fee)
+			assert.Equal(t, schedule.ID, quote.ScheduleID)
+
+			quote, err = svc.QuoteFee(ctx, wallet.ID, models.OperationDeposit, tt.amount)
+			require.NoError(t, err)
+			assert.Zero(t, quote.Fee, "deposits have no schedule")
+			assert.Equal(t, uuid.Nil, quote.ScheduleID)
+		})
+	}
+}
+
+// tiered charges 2 from 100 and 1% from 1000.
+func tiered() service.FeeScheduleParams {
+	return service.FeeScheduleParams{
+		Kind: models.FeeKindTiered,
+		Tiers: []service.FeeTierParams{
+			{MinAmount: 1000, RateBps: 100},
+			{MinAmount: 100, FlatAmount: 2},
+		},
+	}
+}
+
+func TestWalletService_ChangeWalletBalance_ChargesFee(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 100)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    2,
+	})
+	require.NoError(t, err)
+
+	change, err := svc.ChangeWalletBalance(ctx, wallet.ID, -50)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), change.Fee)
+	assert.Equal(t, int32(48), change.Wallet.Balance)
+
+	history, err := svc.GetWalletHistory(ctx, wallet.ID, 2)
+	require.NoError(t, err)
+
+	amounts := make(map[string]int32)
+	for _, op := range history {
+		amounts[op.OperationType] = op.Amount
+	}
+	assert.Equal(t, map[string]int32{
+		string(models.OperationWithdraw): -50,
+		string(models.OperationFee):      -2,
+	}, amounts, "the fee is a separate operation")
+
+	assert.Equal(t, int32(2), feeWalletBalance(t, svc))
+
+	_, err = svc.ChangeWalletBalance(ctx, wallet.ID, -47)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds, "the fee must be covered too")
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(48), got.Balance)
+	assert.Equal(t, int32(2), feeWalletBalance(t, svc), "a failed operation charges nothing")
+
+	change, err = svc.ChangeWalletBalance(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	assert.Zero(t, change.Fee, "deposits have no schedule")
+}
+
+func TestWalletService_ChangeWalletBalance_ProductSchedule(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	product, err := svc.CreateInterestProduct(ctx, service.InterestProductParams{Name: "premium"})
+	require.NoError(t, err)
+
+	premium := newWallet(t, svc, 100)
+	_, err = svc.SetWalletProduct(ctx, premium.ID, product.ID)
+	require.NoError(t, err)
+
+	// Earning the interest of a product does not make it the wallet's.
+	regular := newWallet(t, svc, 100)
+	_, err = svc.SetWalletInterest(ctx, regular.ID, service.WalletInterestParams{ProductID: product.ID})
+	require.NoError(t, err)
+
+	for _, p := range []service.FeeScheduleParams{
+		{OperationType: models.OperationWithdraw, Kind: models.FeeKindFlat, FlatAmount: 5},
+		{OperationType: models.OperationWithdraw, ProductID: product.ID, Kind: models.FeeKindFlat, FlatAmount: 1},
+	} {
+		_, err := svc.CreateFeeSchedule(ctx, p)
+		require.NoError(t, err)
+	}
+
+	change, err := svc.ChangeWalletBalance(ctx, regular.ID, -10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(5), change.Fee)
+
+	change, err = svc.ChangeWalletBalance(ctx, premium.ID, -10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), change.Fee, "the product schedule wins")
+
+	_, err = svc.SetWalletProduct(ctx, premium.ID, uuid.New())
+	assert.ErrorIs(t, err, service.ErrInterestProductNotFound)
+	_, err = svc.SetWalletProduct(ctx, uuid.New(), product.ID)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+}
+
+func TestWalletService_ChangeWalletBalance_BatchedFees(t *testing.T) {
+	svc := newFeeService(t, service.WithBatching(10))
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 1000)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    1,
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			change, err := svc.ChangeWalletBalance(ctx, wallet.ID, -10)
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), change.Fee)
+		}()
+	}
+	wg.Wait()
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1000-20*11), got.Balance)
+	assert.Equal(t, int32(20), feeWalletBalance(t, svc))
+}
+
+func TestWalletService_Transfer_ChargesFee(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	from := newWallet(t, svc, 100)
+	to := newWallet(t, svc, 0)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationTransfer,
+		Kind:          models.FeeKindPercentage,
+		RateBps:       1000,
+	})
+	require.NoError(t, err)
+
+	gotFrom, gotTo, err := svc.Transfer(ctx, from.ID, to.ID, 50)
+	require.NoError(t, err)
+	assert.Equal(t, int32(45), gotFrom.Balance)
+	assert.Equal(t, int32(50), gotTo.Balance, "the target receives the full amount")
+	assert.Equal(t, int32(5), feeWalletBalance(t, svc))
+
+	_, _, err = svc.Transfer(ctx, from.ID, to.ID, 45)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+}
+
+func TestWalletService_FeeSchedules(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	for name, p := range map[string]service.FeeScheduleParams{
+		"fee operation":       {OperationType: models.OperationFee, Kind: models.FeeKindFlat},
+		"unknown kind":        {OperationType: models.OperationDeposit, Kind: "CAPPED"},
+		"rate too high":       {OperationType: models.OperationDeposit, Kind: models.FeeKindPercentage, RateBps: service.MaxFeeRateBps + 1},
+		"flat with a rate":    {OperationType: models.OperationDeposit, Kind: models.FeeKindFlat, RateBps: 1},
+		"tiered without tier": {OperationType: models.OperationDeposit, Kind: models.FeeKindTiered},
+		"max below min":       {OperationType: models.OperationDeposit, Kind: models.FeeKindFlat, MinFee: 5, MaxFee: 1},
+		"duplicate tiers": {OperationType: models.OperationDeposit, Kind: models.FeeKindTiered, Tiers: []service.FeeTierParams{
+			{MinAmount: 10}, {MinAmount: 10},
+		}},
+	} {
+		_, err := svc.CreateFeeSchedule(ctx, p)
+		assert.ErrorIs(t, err, service.ErrInvalidFeeSchedule, name)
+	}
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{OperationType: models.OperationDeposit, ProductID: uuid.New(), Kind: models.FeeKindFlat})
+	assert.ErrorIs(t, err, service.ErrInterestProductNotFound)
+
+	schedule, err := svc.CreateFeeSchedule(ctx, tieredWithdrawal())
+	require.NoError(t, err)
+	require.Len(t, schedule.Tiers, 2)
+	assert.Equal(t, int32(100), schedule.Tiers[0].MinAmount)
+
+	_, err = svc.CreateFeeSchedule(ctx, tieredWithdrawal())
+	assert.ErrorIs(t, err, service.ErrFeeScheduleExists)
+
+	updated, err := svc.UpdateFeeSchedule(ctx, schedule.ID, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    1,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Tiers, "tiers are replaced")
+
+	_, err = svc.UpdateFeeSchedule(ctx, uuid.New(), tieredWithdrawal())
+	assert.ErrorIs(t, err, service.ErrFeeScheduleNotFound)
+
+	schedules, err := svc.ListFeeSchedules(ctx)
+	require.NoError(t, err)
+	assert.Len(t, schedules, 1)
+
+	require.NoError(t, svc.DeleteFeeSchedule(ctx, schedule.ID))
+	assert.ErrorIs(t, svc.DeleteFeeSchedule(ctx, schedule.ID), service.ErrFeeScheduleNotFound)
+
+	_, err = svc.QuoteFee(ctx, uuid.New(), models.OperationDeposit, 1)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+
+	_, err = svc.QuoteFee(ctx, uuid.New(), models.OperationDeposit, 0)
+	assert.ErrorIs(t, err, service.ErrInvalidFeeQuote)
+}
+
+func tieredWithdrawal() service.FeeScheduleParams {
+	p := tiered()
+	p.OperationType = models.OperationWithdraw
+	return p
+}
+
+func TestWalletService_FeesDisabled(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 100)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    2,
+	})
+	require.NoError(t, err)
+
+	change, err := svc.ChangeWalletBalance(ctx, wallet.ID, -10)
+	require.NoError(t, err)
+	assert.Zero(t, change.Fee)
+	assert.Equal(t, int32(90), change.Wallet.Balance)
+}
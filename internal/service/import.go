@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrImportNotFound  = errors.New("import not found")
+	ErrInvalidImport   = errors.New("invalid import")
+	ErrDuplicateImport = errors.New("file already imported")
+
+	errImportRejected = errors.New("import rejected")
+)
+
+const importPageSize = 1000
+
+type ImportServiceInterface interface {
+	CreateImport(ctx context.Context, rows []ImportRow, skipInvalid bool) (Import, error)
+	GetImport(ctx context.Context, id uuid.UUID) (Import, error)
+}
+
+// ImportRow is an operation read from an import file. Error is set when the
+// row could not be parsed; the row is then staged and reported as invalid.
+type ImportRow struct {
+	WalletID      uuid.UUID
+	OperationType models.OperationType
+	Amount        int32
+	Reference     string
+	Error         string
+}
+
+// validate checks the row on its own. DEPOSIT and WITHDRAW take a positive
+// amount, ADJUSTMENT a signed one.
+func (r *ImportRow) validate() {
+	switch {
+	case r.Error != "":
+	case r.WalletID == uuid.Nil:
+		r.Error = "wallet ID is required"
+	case r.OperationType == models.OperationAdjustment:
+		if r.Amount == 0 {
+			r.Error = "amount must not be zero"
+		}
+	case r.OperationType == models.OperationDeposit, r.OperationType == models.OperationWithdraw:
+		if r.Amount <= 0 {
+			r.Error = "amount must be positive"
+		}
+	default:
+		r.Error = fmt.Sprintf("invalid operation type %q", r.OperationType)
+	}
+}
+
+func (r ImportRow) amount() int32 {
+	if r.OperationType == models.OperationWithdraw {
+		return -r.Amount
+	}
+	return r.Amount
+}
+
+type ImportRowError struct {
+	Row   int32  `json:"row"`
+	Error string `json:"error"`
+}
+
+// Import is an import with the errors of its invalid rows.
+type Import struct {
+	repository.Import
+	Errors []ImportRowError `json:"errors"`
+}
+
+// CreateImport stages rows with COPY, then applies them. The import
+// belongs to the tenant of ctx. A file whose rows the tenant imported
+// before, by an import that was not rejected, is refused.
+func (s *WalletService) CreateImport(ctx context.Context, rows []ImportRow, skipInvalid bool) (Import, error) {
+	if len(rows) == 0 {
+		return Import{}, fmt.Errorf("%w: no rows", ErrInvalidImport)
+	}
+
+	var imp repository.Import
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		hash := fileHash(rows)
+
+		existing, err := repo.GetImportByFileHash(ctx, hash)
+		if err == nil {
+			return fmt.Errorf("%w: already imported as %s", ErrDuplicateImport, existing.ID)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		imp, err = repo.CreateImport(ctx, repository.CreateImportParams{
+			SkipInvalid: skipInvalid,
+			TotalRows:   int32(len(rows)),
+			FileHash:    hash,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "imports_file_hash_key" {
+			return fmt.Errorf("%w: imported concurrently", ErrDuplicateImport)
+		}
+		if err != nil {
+			return err
+		}
+
+		staged := make([]repository.CreateImportRowsParams, len(rows))
+		for i, r := range rows {
+			r.validate()
+			staged[i] = repository.CreateImportRowsParams{
+				ImportID:      imp.ID,
+				RowNumber:     int32(i + 1),
+				WalletID:      r.WalletID,
+				OperationType: string(r.OperationType),
+				Amount:        r.Amount,
+				Reference:     r.Reference,
+				Error:         r.Error,
+			}
+		}
+
+		_, err = repo.CreateImportRows(ctx, staged)
+		return err
+	})
+	if err != nil {
+		return Import{}, err
+	}
+
+	return s.applyImport(ctx, imp.ID)
+}
+
+// fileHash identifies the rows of a file, whatever the order of its
+// columns.
+func fileHash(rows []ImportRow) string {
+	h := sha256.New()
+	for _, r := range rows {
+		fmt.Fprintf(h, "%s,%s,%d,%q,%q\n", r.WalletID, r.OperationType, r.Amount, r.Reference, r.Error)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applyImport applies the staged rows of a pending import in one
+// transaction. With the wallets locked, the rows of missing and frozen
+// wallets and those that would overdraw or overflow a balance are marked
+// invalid, then the rest are applied at once. Rows of sharded wallets are
+// applied one by one. Unless the import skips invalid rows, any invalid row
+// rejects it and nothing is applied. Imported operations are corrections:
+// they are booked against adjustments and charged no fees.
+func (s *WalletService) applyImport(ctx context.Context, id uuid.UUID) (Import, error) {
+	var (
+		imp     repository.Import
+		failed  []ImportRowError
+		changed []uuid.UUID
+	)
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+		if imp, err = repo.ClaimImport(ctx, id); err != nil {
+			return err
+		}
+
+		if changed, err = repo.LockImportWallets(ctx, id); err != nil {
+			return err
+		}
+
+		// Audited imports log each wallet they change, before and after.
+		var before []repository.Wallet
+		if _, ok := auditing(ctx); ok {
+			for _, walletID := range changed {
+				wallet, err := readWallet(ctx, repo, walletID)
+				if err != nil {
+					return err
+				}
+				before = append(before, wallet)
+			}
+		}
+
+		if _, err := repo.CheckImportRows(ctx, repository.CheckImportRowsParams{
+			ImportID:       id,
+			WalletNotFound: ErrWalletNotFound.Error(),
+			WalletFrozen:   ErrWalletFrozen.Error(),
+		}); err != nil {
+			return err
+		}
+
+		if err := checkImportRowBalances(ctx, repo, id); err != nil {
+			return err
+		}
+
+		applied, err := repo.ApplyImportRows(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		sharded, err := repo.ListShardedImportRows(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range sharded {
+			err := repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+				return applyImportRow(ctx, repo, r)
+			})
+			if msg, ok := importRowError(err); ok {
+				if err := setImportRowError(ctx, repo, id, r.RowNumber, msg); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			applied++
+		}
+
+		for _, b := range before {
+			after, err := readWallet(ctx, repo, b.ID)
+			if err != nil {
+				return err
+			}
+			if after.Balance == b.Balance {
+				continue
+			}
+			if err := recordAudit(ctx, repo, models.AuditActionImport, b, after); err != nil {
+				return err
+			}
+		}
+
+		rows, err := repo.ListImportErrors(ctx, id)
+		if err != nil {
+			return err
+		}
+		failed = importRowErrors(rows)
+
+		if len(failed) > 0 && !imp.SkipInvalid {
+			return errImportRejected
+		}
+
+		imp, err = repo.FinishImport(ctx, repository.FinishImportParams{
+			ID:          id,
+			Status:      string(models.ImportStatusApplied),
+			AppliedRows: applied,
+			FailedRows:  int32(len(failed)),
+		})
+		return err
+	})
+
+	if errors.Is(err, errImportRejected) {
+		// Nothing was applied; only the reasons are kept.
+		changed = nil
+		err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+			if _, err := repo.ClaimImport(ctx, id); err != nil {
+				return err
+			}
+
+			marked := repository.SetImportRowErrorsParams{ImportID: id}
+			for _, f := range failed {
+				marked.RowNumbers = append(marked.RowNumbers, f.Row)
+				marked.Errors = append(marked.Errors, f.Error)
+			}
+			if err := repo.SetImportRowErrors(ctx, marked); err != nil {
+				return err
+			}
+
+			var err error
+			imp, err = repo.FinishImport(ctx, repository.FinishImportParams{
+				ID:         id,
+				Status:     string(models.ImportStatusRejected),
+				FailedRows: int32(len(failed)),
+			})
+			return err
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another instance finished the import first.
+		return s.GetImport(ctx, id)
+	}
+	if err != nil {
+		return Import{}, err
+	}
+
+	for _, id := range changed {
+		s.WalletChanged(id)
+	}
+
+	return Import{Import: imp, Errors: nonNilErrors(failed)}, nil
+}
+
+// applyImportRow applies a row of a sharded wallet.
+func applyImportRow(ctx context.Context, repo WalletRepositoryInterface, r repository.ImportRow) error {
+	row := ImportRow{WalletID: r.WalletID, OperationType: models.OperationType(r.OperationType), Amount: r.Amount}
+
+	_, _, err := applyRecorded(ctx, repo, repository.CreateOperationParams{
+		WalletID:      r.WalletID,
+		OperationType: r.OperationType,
+		Amount:        row.amount(),
+		ImportID:      r.ImportID,
+		Reference:     r.Reference,
+	})
+	if err != nil {
+		return err
+	}
+
+	return bookOperation(ctx, repo, r.WalletID, row.OperationType, row.amount(), models.JournalAccountAdjustments)
+}
+
+// RunImportRecovery applies, every interval until ctx is done, the imports
+// left pending for longer than interval, such as those of an instance that
+// crashed between staging and applying them.
+func (s *WalletService) RunImportRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx = WithAudit(ctx, AuditInfo{Actor: ImportRecoveryActor})
+	for {
+		if _, err := s.RecoverImports(ctx, time.Now().Add(-interval)); err != nil && ctx.Err() == nil {
+			log.Printf("import recovery: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecoverImports applies the imports pending since before and returns how
+// many it finished. Each is applied for its tenant, so that its rows reach
+// only the wallets of that tenant.
+func (s *WalletService) RecoverImports(ctx context.Context, before time.Time) (int, error) {
+	pending, err := s.repo.ListPendingImports(ctx, repository.ListPendingImportsParams{Before: before, PageSize: importPageSize})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, imp := range pending {
+		if _, err := s.applyImport(WithTenant(ctx, imp.TenantID), imp.ID); err != nil {
+			return i, fmt.Errorf("import %s: %w", imp.ID, err)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func (s *WalletService) GetImport(ctx context.Context, id uuid.UUID) (Import, error) {
+	imp, err := s.repo.GetImport(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Import{}, ErrImportNotFound
+	}
+	if err != nil {
+		return Import{}, err
+	}
+
+	rows, err := s.repo.ListImportErrors(ctx, id)
+	if err != nil {
+		return Import{}, err
+	}
+
+	return Import{Import: imp, Errors: nonNilErrors(importRowErrors(rows))}, nil
+}
+
+func importRowErrors(rows []repository.ImportRow) []ImportRowError {
+	var failed []ImportRowError
+	for _, r := range rows {
+		failed = append(failed, ImportRowError{Row: r.RowNumber, Error: r.Error})
+	}
+	return failed
+}
+
+// importRowError tells the errors that make a row invalid from those that
+// fail the whole import.
+func importRowError(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, ErrWalletNotFound), errors.Is(err, ErrWalletFrozen),
+		errors.Is(err, ErrInsufficientFunds), errors.Is(err, errBalanceOverflow):
+		return err.Error(), true
+	case errors.As(err, &pgErr) && pgErr.Code == "22003":
+		return errBalanceOverflow.Error(), true
+	default:
+		return "", false
+	}
+}
+
+// checkImportRowBalances marks, in one ordered scan, the valid rows that
+// would take the balance of their unsharded wallet below zero or past the
+// integer range. A marked row is not applied, so the rows after it count
+// from the balance before it.
+func checkImportRowBalances(ctx context.Context, repo ImportStore, importID uuid.UUID) error {
+	rows, err := repo.ListImportRowBalances(ctx, importID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		walletID uuid.UUID
+		balance  int64
+		marked   = repository.SetImportRowErrorsParams{ImportID: importID}
+	)
+	for _, r := range rows {
+		if r.WalletID != walletID {
+			walletID, balance = r.WalletID, int64(r.Balance)
+		}
+
+		amount := int64(r.Amount)
+		if r.OperationType == string(models.OperationWithdraw) {
+			amount = -amount
+		}
+
+		var msg string
+		switch next := balance + amount; {
+		case next < 0:
+			msg = ErrInsufficientFunds.Error()
+		case next > math.MaxInt32:
+			msg = errBalanceOverflow.Error()
+		default:
+			balance = next
+			continue
+		}
+		marked.RowNumbers = append(marked.RowNumbers, r.RowNumber)
+		marked.Errors = append(marked.Errors, msg)
+	}
+
+	if len(marked.RowNumbers) == 0 {
+		return nil
+	}
+	return repo.SetImportRowErrors(ctx, marked)
+}
+
+func setImportRowError(ctx context.Context, repo ImportStore, importID uuid.UUID, row int32, msg string) error {
+	return repo.SetImportRowError(ctx, repository.SetImportRowErrorParams{
+		ImportID:  importID,
+		RowNumber: row,
+		Error:     msg,
+	})
+}
+
+func nonNilErrors(errs []ImportRowError) []ImportRowError {
+	if errs == nil {
+		return []ImportRowError{}
+	}
+	return errs
+}
@@ -0,0 +1,313 @@
+package service_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func walletBalance(t *testing.T, svc *service.WalletService, id uuid.UUID) int32 {
+	t.Helper()
+
+	wallet, err := svc.GetWalletByID(context.Background(), id)
+	require.NoError(t, err)
+
+	return wallet.Balance
+}
+
+// importRows has one row of every kind of error, after two valid ones.
+func importRows(wallet, frozen uuid.UUID) []service.ImportRow {
+	return []service.ImportRow{
+		{WalletID: wallet, OperationType: models.OperationDeposit, Amount: 50, Reference: "r1"},
+		{WalletID: wallet, OperationType: models.OperationAdjustment, Amount: -20, Reference: "r2"},
+		{WalletID: wallet, OperationType: models.OperationWithdraw, Amount: 1000},
+		{WalletID: uuid.New(), OperationType: models.OperationDeposit, Amount: 1},
+		{WalletID: frozen, OperationType: models.OperationDeposit, Amount: 1},
+		{WalletID: wallet, OperationType: models.OperationTransfer, Amount: 1},
+		{WalletID: wallet, OperationType: models.OperationDeposit, Amount: -1},
+		{Error: "invalid wallet ID"},
+	}
+}
+
+var importErrors = []service.ImportRowError{
+	{Row: 3, Error: "insufficient funds"},
+	{Row: 4, Error: "wallet not found"},
+	{Row: 5, Error: "wallet is frozen"},
+	{Row: 6, Error: `invalid operation type "TRANSFER"`},
+	{Row: 7, Error: "amount must be positive"},
+	{Row: 8, Error: "invalid wallet ID"},
+}
+
+func newImportWallets(t *testing.T, svc *service.WalletService) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+
+	wallet := newWallet(t, svc, 100)
+	frozen := newWallet(t, svc, 0)
+	_, err := svc.SetWalletStatus(context.Background(), frozen.ID, models.WalletStatusFrozen)
+	require.NoError(t, err)
+
+	return wallet.ID, frozen.ID
+}
+
+func TestWalletService_CreateImport_SkipInvalid(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	wallet, frozen := newImportWallets(t, svc)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{OperationType: models.OperationDeposit, Kind: models.FeeKindFlat, FlatAmount: 5})
+	require.NoError(t, err)
+
+	imp, err := svc.CreateImport(ctx, importRows(wallet, frozen), true)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusApplied), imp.Status)
+	assert.Equal(t, int32(8), imp.TotalRows)
+	assert.Equal(t, int32(2), imp.AppliedRows)
+	assert.Equal(t, int32(6), imp.FailedRows)
+	assert.Equal(t, importErrors, imp.Errors)
+
+	assert.Equal(t, int32(130), walletBalance(t, svc, wallet), "valid rows are applied without fees")
+	assert.Zero(t, feeWalletBalance(t, svc))
+
+	got, err := svc.GetImport(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, imp, got)
+}
+
+func TestWalletService_CreateImport_Atomic(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet, frozen := newImportWallets(t, svc)
+
+	imp, err := svc.CreateImport(ctx, importRows(wallet, frozen), false)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusRejected), imp.Status)
+	assert.Zero(t, imp.AppliedRows)
+	assert.Equal(t, int32(6), imp.FailedRows)
+	assert.Equal(t, importErrors, imp.Errors, "every row is checked")
+
+	assert.Equal(t, int32(100), walletBalance(t, svc, wallet), "nothing is applied")
+
+	got, err := svc.GetImport(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, importErrors, got.Errors)
+
+	imp, err = svc.CreateImport(ctx, importRows(wallet, frozen)[:2], false)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusApplied), imp.Status)
+	assert.Equal(t, int32(2), imp.AppliedRows)
+	assert.Empty(t, imp.Errors)
+	assert.Equal(t, int32(130), walletBalance(t, svc, wallet))
+}
+
+func TestWalletService_CreateImport_InOrder(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+
+	imp, err := svc.CreateImport(ctx, []service.ImportRow{
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 10},
+		{WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 10},
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 10},
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []service.ImportRowError{{Row: 1, Error: "insufficient funds"}}, imp.Errors,
+		"a row sees the rows before it")
+	assert.Zero(t, walletBalance(t, svc, wallet.ID))
+}
+
+func TestWalletService_CreateImport_Balances(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 5)
+	full := newWallet(t, svc, 0)
+
+	imp, err := svc.CreateImport(ctx, []service.ImportRow{
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 10},
+		{WalletID: full.ID, OperationType: models.OperationAdjustment, Amount: math.MaxInt32},
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 6},
+		{WalletID: full.ID, OperationType: models.OperationDeposit, Amount: 1},
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 5},
+		{WalletID: full.ID, OperationType: models.OperationWithdraw, Amount: 1},
+		{WalletID: full.ID, OperationType: models.OperationDeposit, Amount: 2},
+		{WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1},
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []service.ImportRowError{
+		{Row: 1, Error: "insufficient funds"},
+		{Row: 3, Error: "insufficient funds"},
+		{Row: 4, Error: "balance out of range"},
+		{Row: 7, Error: "balance out of range"},
+	}, imp.Errors, "every failing row is found at once")
+	assert.Equal(t, int32(1), walletBalance(t, svc, wallet.ID))
+	assert.Equal(t, int32(math.MaxInt32-1), walletBalance(t, svc, full.ID))
+}
+
+func TestWalletService_CreateImport_Errors(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	_, err := svc.CreateImport(ctx, nil, true)
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+
+	_, err = svc.GetImport(ctx, uuid.New())
+	assert.ErrorIs(t, err, service.ErrImportNotFound)
+}
+
+func TestWalletService_CreateImport_Once(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet, frozen := newImportWallets(t, svc)
+	rows := importRows(wallet, frozen)
+
+	rejected, err := svc.CreateImport(ctx, rows, false)
+	require.NoError(t, err)
+	require.Equal(t, string(models.ImportStatusRejected), rejected.Status)
+
+	imp, err := svc.CreateImport(ctx, rows, true)
+	require.NoError(t, err, "a rejected file may be imported again")
+	assert.Equal(t, string(models.ImportStatusApplied), imp.Status)
+
+	_, err = svc.CreateImport(ctx, rows, true)
+	assert.ErrorIs(t, err, service.ErrDuplicateImport)
+	assert.ErrorContains(t, err, imp.ID.String())
+	assert.Equal(t, int32(130), walletBalance(t, svc, wallet), "the file is applied once")
+
+	ops, err := svc.ListOperationsPage(ctx, repository.ListOperationsPageParams{WalletID: wallet, PageSize: 10})
+	require.NoError(t, err)
+
+	var references []string
+	for _, op := range ops {
+		if op.ImportID == imp.ID {
+			references = append(references, op.Reference)
+		}
+	}
+	assert.ElementsMatch(t, []string{"r1", "r2"}, references)
+}
+
+func TestWalletService_CreateImport_Sharded(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	plain := newWallet(t, svc, 0)
+	sharded := newWallet(t, svc, 100)
+	_, err := svc.SetWalletShards(ctx, sharded.ID, 4)
+	require.NoError(t, err)
+
+	imp, err := svc.CreateImport(ctx, []service.ImportRow{
+		{WalletID: plain.ID, OperationType: models.OperationDeposit, Amount: 10},
+		{WalletID: sharded.ID, OperationType: models.OperationWithdraw, Amount: 30},
+		{WalletID: sharded.ID, OperationType: models.OperationWithdraw, Amount: 100},
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), imp.AppliedRows)
+	assert.Equal(t, []service.ImportRowError{{Row: 3, Error: "insufficient funds"}}, imp.Errors)
+
+	assert.Equal(t, int32(10), walletBalance(t, svc, plain.ID))
+	assert.Equal(t, int32(70), walletBalance(t, svc, sharded.ID))
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+	assert.Empty(t, balance.Mismatches)
+}
+
+func TestWalletService_RecoverImports(t *testing.T) {
+	store := memory.NewStore()
+	svc := service.NewWalletService(store)
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+
+	// An import staged by an instance that crashed before applying it.
+	imp, err := store.CreateImport(ctx, repository.CreateImportParams{TotalRows: 1})
+	require.NoError(t, err)
+	_, err = store.CreateImportRows(ctx, []repository.CreateImportRowsParams{
+		{ImportID: imp.ID, RowNumber: 1, WalletID: wallet.ID, OperationType: string(models.OperationDeposit), Amount: 40},
+	})
+	require.NoError(t, err)
+
+	recovered, err := svc.RecoverImports(ctx, imp.UpdatedAt)
+	require.NoError(t, err)
+	assert.Zero(t, recovered, "a recent import may still be applied by its instance")
+
+	recovered, err = svc.RecoverImports(ctx, imp.UpdatedAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.Equal(t, int32(40), walletBalance(t, svc, wallet.ID))
+
+	got, err := svc.GetImport(ctx, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ImportStatusApplied), got.Status)
+	assert.Equal(t, int32(1), got.AppliedRows)
+
+	recovered, err = svc.RecoverImports(ctx, imp.UpdatedAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+	assert.Equal(t, int32(40), walletBalance(t, svc, wallet.ID))
+}
+
+func TestWalletService_CreateImport_Tenants(t *testing.T) {
+	store := memory.NewStore()
+	svc := service.NewWalletService(store)
+	ctx := context.Background()
+
+	acme, err := svc.CreateTenant(ctx, "acme")
+	require.NoError(t, err)
+	globex, err := svc.CreateTenant(ctx, "globex")
+	require.NoError(t, err)
+	acmeCtx := service.WithTenant(ctx, acme.ID)
+	globexCtx := service.WithTenant(ctx, globex.ID)
+
+	acmeWallet, err := svc.CreateWallet(acmeCtx, 0)
+	require.NoError(t, err)
+	globexWallet, err := svc.CreateWallet(globexCtx, 0)
+	require.NoError(t, err)
+
+	rows := []service.ImportRow{{WalletID: acmeWallet.ID, OperationType: models.OperationDeposit, Amount: 10}}
+	imp, err := svc.CreateImport(acmeCtx, rows, false)
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, imp.TenantID)
+
+	_, err = svc.GetImport(globexCtx, imp.ID)
+	assert.ErrorIs(t, err, service.ErrImportNotFound)
+
+	// The file is new to globex, but the wallet in it is not its own.
+	other, err := svc.CreateImport(globexCtx, rows, true)
+	require.NoError(t, err)
+	assert.Equal(t, []service.ImportRowError{{Row: 1, Error: service.ErrWalletNotFound.Error()}}, other.Errors)
+	assert.Equal(t, int32(10), walletBalance(t, svc, acmeWallet.ID))
+
+	// A crashed import is recovered for its tenant only.
+	pending, err := store.CreateImport(globexCtx, repository.CreateImportParams{TotalRows: 2, SkipInvalid: true})
+	require.NoError(t, err)
+	_, err = store.CreateImportRows(globexCtx, []repository.CreateImportRowsParams{
+		{ImportID: pending.ID, RowNumber: 1, WalletID: acmeWallet.ID, OperationType: string(models.OperationDeposit), Amount: 5},
+		{ImportID: pending.ID, RowNumber: 2, WalletID: globexWallet.ID, OperationType: string(models.OperationDeposit), Amount: 7},
+	})
+	require.NoError(t, err)
+
+	recovered, err := svc.RecoverImports(ctx, pending.UpdatedAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.Equal(t, int32(10), walletBalance(t, svc, acmeWallet.ID))
+	assert.Equal(t, int32(7), walletBalance(t, svc, globexWallet.ID))
+
+	got, err := svc.GetImport(globexCtx, pending.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), got.AppliedRows)
+	assert.Equal(t, []service.ImportRowError{{Row: 1, Error: service.ErrWalletNotFound.Error()}}, got.Errors)
+}
@@ -0,0 +1,616 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrInterestProductNotFound = errors.New("interest product not found")
+	ErrInterestProductExists   = errors.New("interest product already exists")
+	ErrWalletInterestNotFound  = errors.New("wallet does not earn interest")
+	ErrInvalidInterest         = errors.New("invalid interest terms")
+)
+
+// MaxAnnualRateBps is the highest annual rate, 1000%, in basis points.
+const MaxAnnualRateBps = 100000
+
+const (
+	// microsPerUnit is how many accrued micros make one balance unit.
+	microsPerUnit    = 1_000_000
+	interestPageSize = 100
+)
+
+type InterestServiceInterface interface {
+	CreateInterestProduct(ctx context.Context, p InterestProductParams) (repository.InterestProduct, error)
+	GetInterestProduct(ctx context.Context, id uuid.UUID) (repository.InterestProduct, error)
+	ListInterestProducts(ctx context.Context) ([]repository.InterestProduct, error)
+	UpdateInterestProduct(ctx context.Context, id uuid.UUID, p InterestProductParams) (repository.InterestProduct, error)
+	SetWalletInterest(ctx context.Context, walletID uuid.UUID, p WalletInterestParams) (WalletInterest, error)
+	GetWalletInterest(ctx context.Context, walletID uuid.UUID) (WalletInterest, error)
+	DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) error
+	ListInterestPayouts(ctx context.Context, walletID uuid.UUID, limit int32) ([]repository.InterestPayout, error)
+}
+
+// WithInterestConventions sets the day-count convention and rounding mode
+// of products created without them and of wallets earning interest at their
+// own rate. The defaults are ACT/365 and HALF_EVEN.
+func WithInterestConventions(dayCount models.DayCount, rounding models.Rounding) Option {
+	return func(s *WalletService) {
+		s.dayCount = dayCount
+		s.rounding = rounding
+	}
+}
+
+type InterestProductParams struct {
+	Name          string
+	AnnualRateBps int32
+	// DayCount and Rounding fall back to the service defaults when empty.
+	DayCount models.DayCount
+	Rounding models.Rounding
+}
+
+func (s *WalletService) validateProduct(p *InterestProductParams) error {
+	if p.DayCount == "" {
+		p.DayCount = s.dayCount
+	}
+	if p.Rounding == "" {
+		p.Rounding = s.rounding
+	}
+
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidInterest)
+	case p.AnnualRateBps < 0 || p.AnnualRateBps > MaxAnnualRateBps:
+		return fmt.Errorf("%w: annual rate must be 0 to %d basis points", ErrInvalidInterest, MaxAnnualRateBps)
+	case !validDayCount(p.DayCount):
+		return fmt.Errorf("%w: day count must be %s, %s or %s", ErrInvalidInterest, models.DayCountAct365, models.DayCountAct360, models.DayCountActAct)
+	case !validRounding(p.Rounding):
+		return fmt.Errorf("%w: rounding must be %s, %s or %s", ErrInvalidInterest, models.RoundingHalfUp, models.RoundingHalfEven, models.RoundingDown)
+	}
+
+	return nil
+}
+
+func validDayCount(dayCount models.DayCount) bool {
+	return dayCount == models.DayCountAct365 || dayCount == models.DayCountAct360 || dayCount == models.DayCountActAct
+}
+
+func validRounding(rounding models.Rounding) bool {
+	return rounding == models.RoundingHalfUp || rounding == models.RoundingHalfEven || rounding == models.RoundingDown
+}
+
+func (s *WalletService) CreateInterestProduct(ctx context.Context, p InterestProductParams) (repository.InterestProduct, error) {
+	if err := s.validateProduct(&p); err != nil {
+		return repository.InterestProduct{}, err
+	}
+
+	product, err := s.repo.CreateInterestProduct(ctx, repository.CreateInterestProductParams{
+		Name:          p.Name,
+		AnnualRateBps: p.AnnualRateBps,
+		DayCount:      string(p.DayCount),
+		Rounding:      string(p.Rounding),
+	})
+	if isProductNameTaken(err) {
+		return repository.InterestProduct{}, ErrInterestProductExists
+	}
+	return product, err
+}
+
+func (s *WalletService) GetInterestProduct(ctx context.Context, id uuid.UUID) (repository.InterestProduct, error) {
+	product, err := s.repo.GetInterestProduct(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.InterestProduct{}, ErrInterestProductNotFound
+	}
+	return product, err
+}
+
+// ListInterestProducts returns every product, ordered by name.
+func (s *WalletService) ListInterestProducts(ctx context.Context) ([]repository.InterestProduct, error) {
+	return s.repo.ListInterestProducts(ctx)
+}
+
+// UpdateInterestProduct replaces the terms of a product. Days accrued
+// already keep the terms they were accrued at.
+func (s *WalletService) UpdateInterestProduct(ctx context.Context, id uuid.UUID, p InterestProductParams) (repository.InterestProduct, error) {
+	if err := s.validateProduct(&p); err != nil {
+		return repository.InterestProduct{}, err
+	}
+
+	product, err := s.repo.UpdateInterestProduct(ctx, repository.UpdateInterestProductParams{
+		ID:            id,
+		Name:          p.Name,
+		AnnualRateBps: p.AnnualRateBps,
+		DayCount:      string(p.DayCount),
+		Rounding:      string(p.Rounding),
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return repository.InterestProduct{}, ErrInterestProductNotFound
+	case isProductNameTaken(err):
+		return repository.InterestProduct{}, ErrInterestProductExists
+	}
+	return product, err
+}
+
+func isProductNameTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == "interest_products_name_key"
+}
+
+// WalletInterestParams enrolls a wallet in a product, at its own rate, or
+// both: the wallet rate then overrides the rate of the product.
+type WalletInterestParams struct {
+	ProductID     uuid.UUID
+	AnnualRateBps *int32
+}
+
+// WalletInterest is what a wallet earns interest on, with the interest
+// accrued but not paid yet.
+type WalletInterest struct {
+	repository.WalletInterest
+	// PendingMicros includes the rounding remainder of the last payout.
+	PendingMicros int64 `json:"pending_micros"`
+}
+
+// SetWalletInterest enrolls a wallet or changes its terms. The wallet
+// accrues interest from the day it was first enrolled.
+func (s *WalletService) SetWalletInterest(ctx context.Context, walletID uuid.UUID, p WalletInterestParams) (WalletInterest, error) {
+	rate := pgtype.Int4{}
+	if p.AnnualRateBps != nil {
+		rate = pgtype.Int4{Int32: *p.AnnualRateBps, Valid: true}
+	}
+
+	switch {
+	case p.ProductID == uuid.Nil && !rate.Valid:
+		return WalletInterest{}, fmt.Errorf("%w: a product or an annual rate is required", ErrInvalidInterest)
+	case rate.Valid && (rate.Int32 < 0 || rate.Int32 > MaxAnnualRateBps):
+		return WalletInterest{}, fmt.Errorf("%w: annual rate must be 0 to %d basis points", ErrInvalidInterest, MaxAnnualRateBps)
+	}
+
+	if p.ProductID != uuid.Nil {
+		if _, err := s.GetInterestProduct(ctx, p.ProductID); err != nil {
+			return WalletInterest{}, err
+		}
+	}
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		wallet, err := repo.GetWalletByID(ctx, walletID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		before := auditState(models.AuditActionInterestChange, wallet)
+		if prev, err := repo.GetWalletInterest(ctx, walletID); err == nil {
+			before.Interest = auditInterest(prev)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		wi, err := repo.SetWalletInterest(ctx, repository.SetWalletInterestParams{
+			WalletID:      walletID,
+			ProductID:     p.ProductID,
+			AnnualRateBps: rate,
+		})
+		if err != nil {
+			return err
+		}
+
+		after := auditState(models.AuditActionInterestChange, wallet)
+		after.Interest = auditInterest(wi)
+		return recordAuditStates(ctx, repo, models.AuditActionInterestChange, walletID, before, after)
+	})
+	if err != nil {
+		return WalletInterest{}, err
+	}
+
+	return s.GetWalletInterest(ctx, walletID)
+}
+
+func (s *WalletService) GetWalletInterest(ctx context.Context, walletID uuid.UUID) (WalletInterest, error) {
+	var wi WalletInterest
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+
+		wi.WalletInterest, err = repo.GetWalletInterest(ctx, walletID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletInterestNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		wi.PendingMicros, err = pendingInterest(ctx, repo, walletID)
+		return err
+	})
+	if err != nil {
+		return WalletInterest{}, err
+	}
+
+	return wi, nil
+}
+
+func pendingInterest(ctx context.Context, repo InterestStore, walletID uuid.UUID) (int64, error) {
+	accrued, err := repo.GetUnpaidInterest(ctx, walletID)
+	if err != nil {
+		return 0, err
+	}
+
+	carry, err := lastCarry(ctx, repo, walletID)
+	return accrued + carry, err
+}
+
+func lastCarry(ctx context.Context, repo InterestStore, walletID uuid.UUID) (int64, error) {
+	payout, err := repo.GetLatestInterestPayout(ctx, walletID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return payout.CarryMicros, err
+}
+
+// DeleteWalletInterest stops accruing interest for the wallet. Interest
+// accrued until then is still paid with the next monthly payout.
+func (s *WalletService) DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) error {
+	return s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		prev, err := repo.GetWalletInterest(ctx, walletID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletInterestNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := repo.DeleteWalletInterest(ctx, walletID); err != nil {
+			return err
+		}
+
+		wallet, err := repo.GetWalletByID(ctx, walletID)
+		if err != nil {
+			return err
+		}
+
+		before := auditState(models.AuditActionInterestChange, wallet)
+		before.Interest = auditInterest(prev)
+		return recordAuditStates(ctx, repo, models.AuditActionInterestChange, walletID, before, auditState(models.AuditActionInterestChange, wallet))
+	})
+}
+
+// ListInterestPayouts returns the latest monthly payouts of a wallet, newest
+// first.
+func (s *WalletService) ListInterestPayouts(ctx context.Context, walletID uuid.UUID, limit int32) ([]repository.InterestPayout, error) {
+	if _, err := s.GetWalletByID(ctx, walletID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListInterestPayouts(ctx, repository.ListInterestPayoutsParams{
+		WalletID: walletID,
+		Limit:    limit,
+	})
+}
+
+// RunInterest accrues the days that have ended and pays the interest of
+// past months every interval until ctx is done. Days missed while it was
+// not running are caught up on the next tick.
+func (s *WalletService) RunInterest(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx = WithAudit(ctx, AuditInfo{Actor: InterestActor})
+	for {
+		if _, err := s.PayInterest(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("interest: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AccrueInterest accrues interest for every day, in UTC, that ended by now
+// and has not been accrued yet, and returns how many days it accrued.
+// Accruing a day twice is a no-op, so reruns and concurrent instances are
+// safe.
+func (s *WalletService) AccrueInterest(ctx context.Context, now time.Time) (int, error) {
+	through := startOfDay(now).AddDate(0, 0, -1)
+	accrued := 0
+
+	var errs []error
+	params := repository.ListInterestTermsParams{PageSize: interestPageSize}
+
+	for {
+		terms, err := s.repo.ListInterestTerms(ctx, params)
+		if err != nil {
+			return accrued, err
+		}
+
+		for _, t := range terms {
+			n, err := s.accrueWalletInterest(ctx, t, through)
+			accrued += n
+			if err != nil {
+				if ctx.Err() != nil {
+					return accrued, err
+				}
+				errs = append(errs, fmt.Errorf("wallet %s: %w", t.WalletID, err))
+			}
+		}
+
+		if len(terms) < interestPageSize {
+			return accrued, errors.Join(errs...)
+		}
+		params.AfterWalletID = terms[len(terms)-1].WalletID
+	}
+}
+
+// accrueWalletInterest accrues the days through the given one that are
+// missing since the wallet was enrolled or, if later, since its last
+// payout period.
+func (s *WalletService) accrueWalletInterest(ctx context.Context, t repository.WalletInterestTerm, through time.Time) (int, error) {
+	dayCount, rounding := models.DayCount(t.DayCount), models.Rounding(t.Rounding)
+	if dayCount == "" {
+		dayCount, rounding = s.dayCount, s.rounding
+	}
+
+	from := startOfDay(t.CreatedAt)
+
+	payout, err := s.repo.GetLatestInterestPayout(ctx, t.WalletID)
+	if err == nil {
+		if end := payout.Period.AddDate(0, 1, 0); end.After(from) {
+			from = end
+		}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	if from.After(through) {
+		return 0, nil
+	}
+
+	existing, err := s.repo.ListInterestAccruals(ctx, repository.ListInterestAccrualsParams{
+		WalletID: t.WalletID,
+		FromDate: from,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	done := make(map[string]bool, len(existing))
+	for _, a := range existing {
+		done[a.AccrualDate.Format(time.DateOnly)] = true
+	}
+
+	accrued := 0
+	for day := from; !day.After(through); day = day.AddDate(0, 0, 1) {
+		if done[day.Format(time.DateOnly)] {
+			continue
+		}
+
+		balance, err := s.repo.GetWalletBalanceAt(ctx, repository.GetWalletBalanceAtParams{
+			WalletID: t.WalletID,
+			Before:   day.AddDate(0, 0, 1),
+		})
+		if err != nil {
+			return accrued, err
+		}
+
+		n, err := s.repo.CreateInterestAccrual(ctx, repository.CreateInterestAccrualParams{
+			WalletID:      t.WalletID,
+			AccrualDate:   day,
+			Balance:       balance,
+			AnnualRateBps: t.AnnualRateBps,
+			DayCount:      string(dayCount),
+			AmountMicros:  dailyInterest(balance, t.AnnualRateBps, dayCount, rounding, day),
+		})
+		if err != nil {
+			return accrued, err
+		}
+		accrued += int(n)
+	}
+
+	return accrued, nil
+}
+
+// PayInterest pays, as an INTEREST operation, the interest accrued before
+// the month of now, after accruing any day still missing. Each wallet is
+// paid at most once per month, so reruns pay nothing twice. It returns how
+// many wallets it paid.
+//
+// A payout that fails, e.g. because the wallet is frozen, is rolled back and
+// tried again on the next run.
+func (s *WalletService) PayInterest(ctx context.Context, now time.Time) (int, error) {
+	if _, err := s.AccrueInterest(ctx, now); err != nil {
+		return 0, err
+	}
+
+	period := startOfMonth(now).AddDate(0, -1, 0)
+	paid := 0
+
+	var errs []error
+	params := repository.ListWalletsWithUnpaidInterestParams{
+		BeforeDate: period.AddDate(0, 1, 0),
+		PageSize:   interestPageSize,
+	}
+
+	for {
+		walletIDs, err := s.repo.ListWalletsWithUnpaidInterest(ctx, params)
+		if err != nil {
+			return paid, err
+		}
+
+		for _, id := range walletIDs {
+			ok, err := s.payWalletInterest(ctx, id, period)
+			if err != nil {
+				if ctx.Err() != nil {
+					return paid, err
+				}
+				errs = append(errs, fmt.Errorf("wallet %s: %w", id, err))
+				continue
+			}
+			if ok {
+				paid++
+			}
+		}
+
+		if len(walletIDs) < interestPageSize {
+			return paid, errors.Join(errs...)
+		}
+		params.AfterWalletID = walletIDs[len(walletIDs)-1]
+	}
+}
+
+var errInterestPaid = errors.New("interest already paid")
+
+// payWalletInterest pays the accruals of the wallet up to the end of period
+// in one transaction: the accruals are marked paid, the payout is recorded
+// and the amount is deposited, or none of it happens.
+func (s *WalletService) payWalletInterest(ctx context.Context, walletID uuid.UUID, period time.Time) (bool, error) {
+	rounding := s.rounding
+	terms, err := s.repo.GetInterestTerms(ctx, walletID)
+	if err == nil && terms.Rounding != "" {
+		rounding = models.Rounding(terms.Rounding)
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var carry int64
+
+		last, err := repo.GetLatestInterestPayout(ctx, walletID)
+		switch {
+		case err == nil:
+			if !last.Period.Before(period) {
+				return errInterestPaid
+			}
+			carry = last.CarryMicros
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		}
+
+		accrued, err := repo.MarkInterestAccrualsPaid(ctx, repository.MarkInterestAccrualsPaidParams{
+			WalletID:   walletID,
+			BeforeDate: period.AddDate(0, 1, 0),
+		})
+		if err != nil {
+			return err
+		}
+
+		pending := accrued + carry
+		amount := roundDiv(pending, microsPerUnit, rounding)
+		if amount > math.MaxInt32 {
+			return fmt.Errorf("interest of %d exceeds the largest deposit", amount)
+		}
+
+		// Another instance paying the same month conflicts here.
+		n, err := repo.CreateInterestPayout(ctx, repository.CreateInterestPayoutParams{
+			WalletID:      walletID,
+			Period:        period,
+			AccruedMicros: accrued,
+			Amount:        int32(amount),
+			CarryMicros:   pending - amount*microsPerUnit,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errInterestPaid
+		}
+
+		if amount == 0 {
+			return nil
+		}
+		// Interest is paid without a deposit fee.
+		wallet, err := applyOperationAs(ctx, repo, walletID, models.OperationInterest, int32(amount))
+		if err != nil {
+			return err
+		}
+
+		before := wallet
+		before.Balance -= int32(amount)
+		return recordAudit(ctx, repo, models.AuditActionBalanceChange, before, wallet)
+	})
+	if errors.Is(err, errInterestPaid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	s.WalletChanged(walletID)
+	return true, nil
+}
+
+// dailyInterest returns the interest of one day on balance, in micros.
+func dailyInterest(balance int64, annualRateBps int32, dayCount models.DayCount, rounding models.Rounding, day time.Time) int64 {
+	if balance <= 0 {
+		return 0
+	}
+
+	days := int64(365)
+	switch dayCount {
+	case models.DayCountAct360:
+		days = 360
+	case models.DayCountActAct:
+		if year := day.Year(); year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			days = 366
+		}
+	}
+
+	// balance * rate / 10000 bps per unit * 1000000 micros per unit / days.
+	return roundDiv(balance*int64(annualRateBps)*100, days, rounding)
+}
+
+// roundDiv divides n by a positive d and rounds the quotient.
+func roundDiv(n, d int64, rounding models.Rounding) int64 {
+	return roundQuotient(n/d, n%d, d, rounding)
+}
+
+// roundQuotient rounds the quotient q of a division by a positive d, given
+// its remainder r.
+func roundQuotient(q, r, d int64, rounding models.Rounding) int64 {
+	if r == 0 || rounding == models.RoundingDown {
+		return q
+	}
+
+	sign := int64(1)
+	if r < 0 {
+		sign, r = -1, -r
+	}
+
+	switch {
+	case 2*r > d:
+		return q + sign
+	case 2*r < d:
+		return q
+	case rounding == models.RoundingHalfEven && q%2 == 0:
+		return q
+	default:
+		return q + sign
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
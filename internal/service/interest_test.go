@@ -0,0 +1,262 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rate(bps int32) *int32 {
+	return &bps
+}
+
+func TestWalletService_AccrueInterest_OncePerDay(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 1000)
+
+	// 3.65% a year on 1000 is 0.1 a day with ACT/365.
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(365)})
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	accrued, err := svc.AccrueInterest(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, accrued, "today has not ended")
+
+	accrued, err = svc.AccrueInterest(ctx, now.AddDate(0, 0, 3))
+	require.NoError(t, err)
+	assert.Equal(t, 3, accrued)
+
+	accrued, err = svc.AccrueInterest(ctx, now.AddDate(0, 0, 3))
+	require.NoError(t, err)
+	assert.Zero(t, accrued, "a rerun accrues nothing twice")
+
+	accrued, err = svc.AccrueInterest(ctx, now.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	assert.Equal(t, 2, accrued, "missed days are caught up")
+
+	wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500_000), wi.PendingMicros)
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1000), got.Balance, "accruals are not paid yet")
+}
+
+func TestWalletService_AccrueInterest_Conventions(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  int32
+		dayCount models.DayCount
+		rounding models.Rounding
+		micros   int64
+	}{
+		// 1 bps on 9 with ACT/360 is 2.5 micros a day.
+		{"half up", 9, models.DayCountAct360, models.RoundingHalfUp, 3},
+		{"half even down", 9, models.DayCountAct360, models.RoundingHalfEven, 2},
+		{"half even up", 27, models.DayCountAct360, models.RoundingHalfEven, 8},
+		{"down", 27, models.DayCountAct360, models.RoundingDown, 7},
+		// 1 bps on 9 with ACT/365 is 2.47 micros a day.
+		{"act/365", 9, models.DayCountAct365, models.RoundingHalfUp, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := service.NewWalletService(memory.NewStore())
+			ctx := context.Background()
+
+			wallet := newWallet(t, svc, tt.balance)
+
+			product, err := svc.CreateInterestProduct(ctx, service.InterestProductParams{
+				Name:          "savings",
+				AnnualRateBps: 1,
+				DayCount:      tt.dayCount,
+				Rounding:      tt.rounding,
+			})
+			require.NoError(t, err)
+
+			_, err = svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{ProductID: product.ID})
+			require.NoError(t, err)
+
+			_, err = svc.AccrueInterest(ctx, time.Now().AddDate(0, 0, 1))
+			require.NoError(t, err)
+
+			wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.micros, wi.PendingMicros)
+		})
+	}
+}
+
+func TestWalletService_AccrueInterest_DefaultConventions(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore(), service.WithInterestConventions(models.DayCountAct360, models.RoundingDown))
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 27)
+
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(1)})
+	require.NoError(t, err)
+
+	_, err = svc.AccrueInterest(ctx, time.Now().AddDate(0, 0, 1))
+	require.NoError(t, err)
+
+	wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), wi.PendingMicros)
+}
+
+func TestWalletService_PayInterest(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 1000)
+
+	// 36.5% a year on 1000 is exactly 1 a day.
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(3650)})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 1, 0, 0, 0, time.UTC)
+	days := nextMonth.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)) / (24 * time.Hour)
+
+	paid, err := svc.PayInterest(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, paid, "nothing accrued in past months")
+
+	paid, err = svc.PayInterest(ctx, nextMonth)
+	require.NoError(t, err)
+	assert.Equal(t, 1, paid)
+
+	paid, err = svc.PayInterest(ctx, nextMonth.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, paid, "a month is paid once")
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1000)+int32(days), got.Balance)
+
+	history, err := svc.GetWalletHistory(ctx, wallet.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, string(models.OperationInterest), history[0].OperationType)
+
+	payouts, err := svc.ListInterestPayouts(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, payouts, 1)
+	assert.Equal(t, int32(days), payouts[0].Amount)
+	assert.Zero(t, payouts[0].CarryMicros)
+
+	wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Zero(t, wi.PendingMicros)
+}
+
+func TestWalletService_PayInterest_CarriesRemainder(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 10)
+
+	// 0.1 a day: a month pays 3 and carries the rest.
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(36500)})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	for month := 1; month <= 2; month++ {
+		_, err := svc.PayInterest(ctx, time.Date(now.Year(), now.Month()+time.Month(month), 1, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+	}
+
+	payouts, err := svc.ListInterestPayouts(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+
+	var accrued, amount int64
+	for _, p := range payouts {
+		accrued += p.AccruedMicros
+		amount += int64(p.Amount)
+	}
+
+	wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, accrued, amount*1_000_000+wi.PendingMicros, "remainders are carried, never lost")
+	assert.Less(t, wi.PendingMicros, int64(500_000))
+}
+
+func TestWalletService_PayInterest_FrozenWalletIsRetried(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 1000)
+
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(3650)})
+	require.NoError(t, err)
+
+	_, err = svc.SetWalletStatus(ctx, wallet.ID, models.WalletStatusFrozen)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	paid, err := svc.PayInterest(ctx, nextMonth)
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+	assert.Zero(t, paid)
+
+	wi, err := svc.GetWalletInterest(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Positive(t, wi.PendingMicros, "a failed payout marks nothing paid")
+
+	_, err = svc.SetWalletStatus(ctx, wallet.ID, models.WalletStatusActive)
+	require.NoError(t, err)
+
+	paid, err = svc.PayInterest(ctx, nextMonth)
+	require.NoError(t, err)
+	assert.Equal(t, 1, paid)
+}
+
+func TestWalletService_WalletInterest(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+
+	_, err := svc.GetWalletInterest(ctx, wallet.ID)
+	assert.ErrorIs(t, err, service.ErrWalletInterestNotFound)
+
+	_, err = svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{})
+	assert.ErrorIs(t, err, service.ErrInvalidInterest)
+
+	_, err = svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(service.MaxAnnualRateBps + 1)})
+	assert.ErrorIs(t, err, service.ErrInvalidInterest)
+
+	_, err = svc.SetWalletInterest(ctx, uuid.New(), service.WalletInterestParams{AnnualRateBps: rate(100)})
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+
+	_, err = svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{ProductID: uuid.New()})
+	assert.ErrorIs(t, err, service.ErrInterestProductNotFound)
+
+	product, err := svc.CreateInterestProduct(ctx, service.InterestProductParams{Name: "savings", AnnualRateBps: 200})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.DayCountAct365), product.DayCount, "conventions default to the service ones")
+	assert.Equal(t, string(models.RoundingHalfEven), product.Rounding)
+
+	_, err = svc.CreateInterestProduct(ctx, service.InterestProductParams{Name: "savings", AnnualRateBps: 300})
+	assert.ErrorIs(t, err, service.ErrInterestProductExists)
+
+	wi, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{ProductID: product.ID})
+	require.NoError(t, err)
+	assert.Equal(t, product.ID, wi.ProductID)
+
+	require.NoError(t, svc.DeleteWalletInterest(ctx, wallet.ID))
+	assert.ErrorIs(t, svc.DeleteWalletInterest(ctx, wallet.ID), service.ErrWalletInterestNotFound)
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var ErrTrialBalanceOff = errors.New("trial balance is off")
+
+// journalLeg books amount on an account: a positive amount is a credit, a
+// negative one a debit. A zero walletID books it on a system account. An
+// empty currency is that of the wallet or, for a system account, of the
+// wallets of the entry.
+type journalLeg struct {
+	account  models.JournalAccount
+	walletID uuid.UUID
+	amount   int32
+	currency string
+}
+
+func walletLeg(walletID uuid.UUID, amount int32) journalLeg {
+	return journalLeg{account: models.JournalAccountWallet, walletID: walletID, amount: amount}
+}
+
+// counterAccount is the system account booked against the wallets for
+// operations of opType.
+func counterAccount(opType models.OperationType) models.JournalAccount {
+	switch opType {
+	case models.OperationDeposit:
+		return models.JournalAccountCashIn
+	case models.OperationWithdraw:
+		return models.JournalAccountCashOut
+	case models.OperationFee:
+		return models.JournalAccountFees
+	case models.OperationInterest:
+		return models.JournalAccountInterest
+	default:
+		return models.JournalAccountAdjustments
+	}
+}
+
+// bookedAccount is the system account op was booked against: adjustments
+// for an imported operation, else that of its type.
+func bookedAccount(op repository.Operation) models.JournalAccount {
+	if op.ImportID != uuid.Nil {
+		return models.JournalAccountAdjustments
+	}
+	return counterAccount(models.OperationType(op.OperationType))
+}
+
+// bookOperation books an operation on a wallet against account.
+func bookOperation(ctx context.Context, repo JournalStore, walletID uuid.UUID, opType models.OperationType, amount int32, account models.JournalAccount) error {
+	return postEntry(ctx, repo, string(opType),
+		walletLeg(walletID, amount),
+		journalLeg{account: account, amount: -amount},
+	)
+}
+
+// postEntry writes a journal entry, leaving out zero legs. The legs must
+// balance in every currency; an entry of zero legs only is not written.
+func postEntry(ctx context.Context, repo JournalStore, description string, legs ...journalLeg) error {
+	var arg repository.CreateJournalEntryParams
+	for _, leg := range legs {
+		if leg.amount == 0 {
+			continue
+		}
+
+		arg.Accounts = append(arg.Accounts, string(leg.account))
+		arg.WalletIds = append(arg.WalletIds, leg.walletID)
+		arg.Debits = append(arg.Debits, max(-leg.amount, 0))
+		arg.Credits = append(arg.Credits, max(leg.amount, 0))
+		arg.Currencies = append(arg.Currencies, leg.currency)
+	}
+	if len(arg.Accounts) == 0 {
+		return nil
+	}
+	arg.Description = description
+
+	_, err := repo.CreateJournalEntry(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("journal entry %s does not balance", description)
+	}
+	return err
+}
+
+// AccountTotal is what was debited and credited to an account. Wallets are
+// added up into one account.
+type AccountTotal struct {
+	Account models.JournalAccount `json:"account"`
+	Debit   int64                 `json:"debit"`
+	Credit  int64                 `json:"credit"`
+}
+
+// WalletMismatch is a wallet whose legs in the journal do not add up to its
+// balance.
+type WalletMismatch struct {
+	WalletID       uuid.UUID `json:"wallet_id"`
+	Balance        int64     `json:"balance"`
+	JournalBalance int64     `json:"journal_balance"`
+}
+
+// CurrencyBalance totals the legs of one currency. Amounts of different
+// currencies are never added up.
+type CurrencyBalance struct {
+	Currency string         `json:"currency"`
+	Accounts []AccountTotal `json:"accounts"`
+	Debit    int64          `json:"debit"`
+	Credit   int64          `json:"credit"`
+}
+
+type TrialBalance struct {
+	Currencies []CurrencyBalance `json:"currencies"`
+	// Mismatches lists at most maxWalletMismatches wallets.
+	Mismatches []WalletMismatch `json:"mismatches,omitempty"`
+}
+
+// maxWalletMismatches bounds the wallets a trial balance lists as off.
+const maxWalletMismatches = 100
+
+// Balanced reports whether the debits of all accounts equal their credits
+// in every currency, which holds as long as every entry was balanced, and
+// every wallet's legs add up to its balance.
+func (b TrialBalance) Balanced() bool {
+	for _, c := range b.Currencies {
+		if c.Debit != c.Credit {
+			return false
+		}
+	}
+	return len(b.Mismatches) == 0
+}
+
+// TrialBalance totals the journal by currency and account and checks the
+// legs of every wallet against its balance, shards included. It fails with
+// ErrTrialBalanceOff, along with the totals, if either is off.
+func (s *WalletService) TrialBalance(ctx context.Context) (TrialBalance, error) {
+	rows, err := s.repo.GetTrialBalance(ctx)
+	if err != nil {
+		return TrialBalance{}, err
+	}
+
+	mismatches, err := s.repo.ListWalletJournalMismatches(ctx, maxWalletMismatches)
+	if err != nil {
+		return TrialBalance{}, err
+	}
+
+	// The rows come ordered by currency.
+	var balance TrialBalance
+	for _, row := range rows {
+		n := len(balance.Currencies)
+		if n == 0 || balance.Currencies[n-1].Currency != row.Currency {
+			balance.Currencies = append(balance.Currencies, CurrencyBalance{Currency: row.Currency})
+			n++
+		}
+
+		c := &balance.Currencies[n-1]
+		c.Accounts = append(c.Accounts, AccountTotal{
+			Account: models.JournalAccount(row.Account),
+			Debit:   row.Debit,
+			Credit:  row.Credit,
+		})
+		c.Debit += row.Debit
+		c.Credit += row.Credit
+	}
+
+	for _, m := range mismatches {
+		balance.Mismatches = append(balance.Mismatches, WalletMismatch{
+			WalletID:       m.ID,
+			Balance:        m.Balance,
+			JournalBalance: m.JournalBalance,
+		})
+	}
+
+	for _, c := range balance.Currencies {
+		if c.Debit != c.Credit {
+			return balance, fmt.Errorf("%w: %s debits %d, credits %d", ErrTrialBalanceOff, c.Currency, c.Debit, c.Credit)
+		}
+	}
+	if len(balance.Mismatches) > 0 {
+		return balance, fmt.Errorf("%w: %d wallets do not match their legs", ErrTrialBalanceOff, len(balance.Mismatches))
+	}
+
+	return balance, nil
+}
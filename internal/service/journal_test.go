@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walletTotal is the net of what the journal credited to wallets without a
+// currency.
+func walletTotal(t *testing.T, balance service.TrialBalance) int64 {
+	t.Helper()
+
+	for _, total := range accountTotals(t, balance, service.NoCurrency) {
+		if total.Account == models.JournalAccountWallet {
+			return total.Credit - total.Debit
+		}
+	}
+	return 0
+}
+
+// accountTotals are the totals of the accounts in currency.
+func accountTotals(t *testing.T, balance service.TrialBalance, currency string) []service.AccountTotal {
+	t.Helper()
+
+	for _, c := range balance.Currencies {
+		if c.Currency == currency {
+			return c.Accounts
+		}
+	}
+	return nil
+}
+
+func TestWalletService_TrialBalance(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    2,
+	})
+	require.NoError(t, err)
+
+	a := newWallet(t, svc, 200)
+	b := newWallet(t, svc, 0)
+
+	_, err = svc.ChangeWalletBalance(ctx, a.ID, -50)
+	require.NoError(t, err)
+	_, _, err = svc.Transfer(ctx, a.ID, b.ID, 30)
+	require.NoError(t, err)
+	_, err = svc.ReverseOperation(ctx, operationOf(t, svc, a.ID, 200), 20)
+	require.NoError(t, err)
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+	assert.Equal(t, []service.AccountTotal{
+		{Account: models.JournalAccountCashIn, Debit: 200, Credit: 20},
+		{Account: models.JournalAccountCashOut, Credit: 50},
+		{Account: models.JournalAccountFees, Debit: 2, Credit: 2},
+		{Account: models.JournalAccountWallet, Debit: 102, Credit: 232},
+	}, accountTotals(t, balance, service.NoCurrency))
+	require.Len(t, balance.Currencies, 1)
+	assert.Equal(t, int64(304), balance.Currencies[0].Debit)
+
+	got, err := svc.GetWalletByID(ctx, a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(98), got.Balance)
+	assert.Equal(t, int64(98+30+2), walletTotal(t, balance), "wallets hold what the journal credited them")
+}
+
+func TestWalletService_TrialBalance_Batched(t *testing.T) {
+	svc := newFeeService(t, service.WithBatching(10))
+	ctx := context.Background()
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{
+		OperationType: models.OperationWithdraw,
+		Kind:          models.FeeKindFlat,
+		FlatAmount:    1,
+	})
+	require.NoError(t, err)
+
+	wallet := newWallet(t, svc, 100)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			amount := int32(7)
+			if i%2 == 0 {
+				amount = -5
+			}
+			_, err := svc.ChangeWalletBalance(ctx, wallet.ID, amount)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+	assert.Equal(t, int64(100+10*7-10*6+10), walletTotal(t, balance))
+}
+
+func TestWalletService_TrialBalance_InterestAndImports(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 1000)
+
+	// 36.5% a year on 1000 is exactly 1 a day.
+	_, err := svc.SetWalletInterest(ctx, wallet.ID, service.WalletInterestParams{AnnualRateBps: rate(3650)})
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	_, err = svc.PayInterest(ctx, time.Date(now.Year(), now.Month()+1, 1, 1, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	interest := int64(walletBalance(t, svc, wallet.ID)) - 1000
+	require.Positive(t, interest)
+
+	_, err = svc.CreateImport(ctx, []service.ImportRow{
+		{WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 50},
+		{WalletID: wallet.ID, OperationType: models.OperationWithdraw, Amount: 20},
+	}, false)
+	require.NoError(t, err)
+
+	// An import books the net change of each wallet.
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+	assert.Empty(t, balance.Mismatches)
+	assert.Equal(t, []service.AccountTotal{
+		{Account: models.JournalAccountAdjustments, Debit: 30},
+		{Account: models.JournalAccountCashIn, Debit: 1000},
+		{Account: models.JournalAccountInterest, Debit: interest},
+		{Account: models.JournalAccountWallet, Credit: 1030 + interest},
+	}, accountTotals(t, balance, service.NoCurrency), "interest is an expense and imports are corrections, not cash")
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+// WalletRepositoryInterface is all the storage the service needs, split by
+// feature so that test fakes implement only the stores they use.
+type WalletRepositoryInterface interface {
+	WalletStore
+	ShardStore
+	OperationStore
+	JournalStore
+	ScheduleStore
+	InterestStore
+	FeeStore
+	ImportStore
+	AuditStore
+	TenantStore
+	ExchangeStore
+
+	ExecTx(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error
+	ExecSnapshot(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error
+}
+
+// WalletStore reads and changes wallet rows.
+type WalletStore interface {
+	GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error)
+	GetWalletByIDForUpdate(ctx context.Context, id uuid.UUID) (repository.Wallet, error)
+	CreateWallet(ctx context.Context, arg repository.CreateWalletParams) (repository.Wallet, error)
+	ListWallets(ctx context.Context, arg repository.ListWalletsParams) ([]repository.Wallet, error)
+	UpdateWallet(ctx context.Context, arg repository.UpdateWalletParams) (repository.Wallet, error)
+	SetWalletBalance(ctx context.Context, arg repository.SetWalletBalanceParams) (repository.Wallet, error)
+	SetWalletStatus(ctx context.Context, arg repository.SetWalletStatusParams) (repository.Wallet, error)
+	SetWalletOwner(ctx context.Context, arg repository.SetWalletOwnerParams) (repository.Wallet, error)
+	MarkSystemWallet(ctx context.Context, id uuid.UUID) (repository.Wallet, error)
+	ListOwnerWallets(ctx context.Context, arg repository.ListOwnerWalletsParams) ([]repository.Wallet, error)
+	SetWalletDetails(ctx context.Context, arg repository.SetWalletDetailsParams) (repository.Wallet, error)
+	SetWalletProduct(ctx context.Context, arg repository.SetWalletProductParams) (repository.Wallet, error)
+	SearchWallets(ctx context.Context, arg SearchWalletsParams) ([]repository.Wallet, error)
+}
+
+// SearchWalletsParams is the filter of the SearchWalletsBy queries and the
+// sort key and direction that picks one of them.
+type SearchWalletsParams struct {
+	Status        string
+	Currency      string
+	LabelsMatch   json.RawMessage
+	LabelsNot     json.RawMessage
+	LabelsHas     []string
+	LabelsMissing []string
+	MinBalance    int32
+	MaxBalance    int32
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	SortBy        string
+	Descending    bool
+	AfterID       uuid.UUID
+	PageSize      int32
+}
+
+// ShardStore keeps the balance shards of hot wallets.
+type ShardStore interface {
+	SetWalletShardCount(ctx context.Context, arg repository.SetWalletShardCountParams) (repository.Wallet, error)
+	CreateWalletShards(ctx context.Context, id uuid.UUID) error
+	CreditWalletShard(ctx context.Context, arg repository.CreditWalletShardParams) (int64, error)
+	SumWalletShards(ctx context.Context, walletID uuid.UUID) (repository.SumWalletShardsRow, error)
+	GetWalletWithShards(ctx context.Context, id uuid.UUID) (repository.GetWalletWithShardsRow, error)
+	LockWalletShards(ctx context.Context, walletID uuid.UUID) (int64, error)
+	ResetWalletShards(ctx context.Context, walletID uuid.UUID) error
+	DeleteWalletShards(ctx context.Context, walletID uuid.UUID) error
+}
+
+// OperationStore records balance operations and their reversals.
+type OperationStore interface {
+	CreateOperation(ctx context.Context, arg repository.CreateOperationParams) (repository.Operation, error)
+	CreateOperations(ctx context.Context, arg []repository.CreateOperationsParams) (int64, error)
+	GetOperation(ctx context.Context, id uuid.UUID) (repository.Operation, error)
+	ListWalletOperations(ctx context.Context, arg repository.ListWalletOperationsParams) ([]repository.Operation, error)
+	ListOperationsPage(ctx context.Context, arg repository.ListOperationsPageParams) ([]repository.Operation, error)
+	ReverseOperation(ctx context.Context, arg repository.ReverseOperationParams) (repository.Operation, error)
+	SetOperationCounterpart(ctx context.Context, arg repository.SetOperationCounterpartParams) error
+}
+
+// JournalStore books operations in the double-entry journal.
+type JournalStore interface {
+	CreateJournalEntry(ctx context.Context, arg repository.CreateJournalEntryParams) (repository.CreateJournalEntryRow, error)
+	ListJournalLegs(ctx context.Context, entryID uuid.UUID) ([]repository.JournalLeg, error)
+	GetTrialBalance(ctx context.Context) ([]repository.GetTrialBalanceRow, error)
+	ListWalletJournalMismatches(ctx context.Context, maxRows int32) ([]repository.ListWalletJournalMismatchesRow, error)
+}
+
+// ScheduleStore keeps scheduled operations and their runs.
+type ScheduleStore interface {
+	CreateScheduledOperation(ctx context.Context, arg repository.CreateScheduledOperationParams) (repository.ScheduledOperation, error)
+	GetScheduledOperation(ctx context.Context, id uuid.UUID) (repository.ScheduledOperation, error)
+	ListScheduledOperations(ctx context.Context, arg repository.ListScheduledOperationsParams) ([]repository.ScheduledOperation, error)
+	UpdateScheduledOperation(ctx context.Context, arg repository.UpdateScheduledOperationParams) (repository.ScheduledOperation, error)
+	DeleteScheduledOperation(ctx context.Context, id uuid.UUID) (int64, error)
+	ClaimDueScheduledOperation(ctx context.Context, now time.Time) (repository.ScheduledOperation, error)
+	CreateScheduledOperationRun(ctx context.Context, arg repository.CreateScheduledOperationRunParams) (repository.ScheduledOperationRun, error)
+	ListScheduledOperationRuns(ctx context.Context, arg repository.ListScheduledOperationRunsParams) ([]repository.ScheduledOperationRun, error)
+}
+
+// InterestStore keeps interest products, accruals and payouts.
+type InterestStore interface {
+	CreateInterestProduct(ctx context.Context, arg repository.CreateInterestProductParams) (repository.InterestProduct, error)
+	GetInterestProduct(ctx context.Context, id uuid.UUID) (repository.InterestProduct, error)
+	ListInterestProducts(ctx context.Context) ([]repository.InterestProduct, error)
+	UpdateInterestProduct(ctx context.Context, arg repository.UpdateInterestProductParams) (repository.InterestProduct, error)
+	SetWalletInterest(ctx context.Context, arg repository.SetWalletInterestParams) (repository.WalletInterest, error)
+	GetWalletInterest(ctx context.Context, walletID uuid.UUID) (repository.WalletInterest, error)
+	DeleteWalletInterest(ctx context.Context, walletID uuid.UUID) (int64, error)
+	GetInterestTerms(ctx context.Context, walletID uuid.UUID) (repository.WalletInterestTerm, error)
+	ListInterestTerms(ctx context.Context, arg repository.ListInterestTermsParams) ([]repository.WalletInterestTerm, error)
+	GetWalletBalanceAt(ctx context.Context, arg repository.GetWalletBalanceAtParams) (int64, error)
+	CreateInterestAccrual(ctx context.Context, arg repository.CreateInterestAccrualParams) (int64, error)
+	ListInterestAccruals(ctx context.Context, arg repository.ListInterestAccrualsParams) ([]repository.InterestAccrual, error)
+	ListWalletsWithUnpaidInterest(ctx context.Context, arg repository.ListWalletsWithUnpaidInterestParams) ([]uuid.UUID, error)
+	MarkInterestAccrualsPaid(ctx context.Context, arg repository.MarkInterestAccrualsPaidParams) (int64, error)
+	GetUnpaidInterest(ctx context.Context, walletID uuid.UUID) (int64, error)
+	GetLatestInterestPayout(ctx context.Context, walletID uuid.UUID) (repository.InterestPayout, error)
+	CreateInterestPayout(ctx context.Context, arg repository.CreateInterestPayoutParams) (int64, error)
+	ListInterestPayouts(ctx context.Context, arg repository.ListInterestPayoutsParams) ([]repository.InterestPayout, error)
+}
+
+// FeeStore keeps fee schedules and their tiers.
+type FeeStore interface {
+	CreateFeeSchedule(ctx context.Context, arg repository.CreateFeeScheduleParams) (repository.FeeSchedule, error)
+	GetFeeSchedule(ctx context.Context, id uuid.UUID) (repository.FeeSchedule, error)
+	ListFeeSchedules(ctx context.Context) ([]repository.FeeSchedule, error)
+	UpdateFeeSchedule(ctx context.Context, arg repository.UpdateFeeScheduleParams) (repository.FeeSchedule, error)
+	DeleteFeeSchedule(ctx context.Context, id uuid.UUID) (int64, error)
+	GetWalletFeeSchedule(ctx context.Context, arg repository.GetWalletFeeScheduleParams) (repository.FeeSchedule, error)
+	CreateFeeTier(ctx context.Context, arg repository.CreateFeeTierParams) error
+	ListFeeTiers(ctx context.Context, scheduleID uuid.UUID) ([]repository.FeeTier, error)
+	DeleteFeeTiers(ctx context.Context, scheduleID uuid.UUID) error
+}
+
+// ImportStore stages, applies and tracks CSV imports.
+type ImportStore interface {
+	CreateImport(ctx context.Context, arg repository.CreateImportParams) (repository.Import, error)
+	GetImport(ctx context.Context, id uuid.UUID) (repository.Import, error)
+	GetImportByFileHash(ctx context.Context, fileHash string) (repository.Import, error)
+	ClaimImport(ctx context.Context, id uuid.UUID) (repository.Import, error)
+	ListPendingImports(ctx context.Context, arg repository.ListPendingImportsParams) ([]repository.Import, error)
+	FinishImport(ctx context.Context, arg repository.FinishImportParams) (repository.Import, error)
+	CreateImportRows(ctx context.Context, arg []repository.CreateImportRowsParams) (int64, error)
+	ListImportRows(ctx context.Context, arg repository.ListImportRowsParams) ([]repository.ImportRow, error)
+	ListImportErrors(ctx context.Context, importID uuid.UUID) ([]repository.ImportRow, error)
+	SetImportRowError(ctx context.Context, arg repository.SetImportRowErrorParams) error
+	SetImportRowErrors(ctx context.Context, arg repository.SetImportRowErrorsParams) error
+	LockImportWallets(ctx context.Context, importID uuid.UUID) ([]uuid.UUID, error)
+	CheckImportRows(ctx context.Context, arg repository.CheckImportRowsParams) (int64, error)
+	ListImportRowBalances(ctx context.Context, importID uuid.UUID) ([]repository.ListImportRowBalancesRow, error)
+	ApplyImportRows(ctx context.Context, importID uuid.UUID) (int32, error)
+	ListShardedImportRows(ctx context.Context, importID uuid.UUID) ([]repository.ImportRow, error)
+}
+
+// AuditStore appends to and reads the audit log.
+type AuditStore interface {
+	CreateAuditEntry(ctx context.Context, arg repository.CreateAuditEntryParams) (repository.AuditLog, error)
+	ListAuditEntries(ctx context.Context, arg repository.ListAuditEntriesParams) ([]repository.AuditLog, error)
+}
+
+// TenantStore keeps the tenants.
+type TenantStore interface {
+	CreateTenant(ctx context.Context, name string) (repository.Tenant, error)
+	ListTenants(ctx context.Context) ([]repository.Tenant, error)
+	SetTenantKeyHash(ctx context.Context, arg repository.SetTenantKeyHashParams) (repository.Tenant, error)
+	GetTenantByKeyHash(ctx context.Context, apiKeyHash pgtype.Text) (repository.Tenant, error)
+}
+
+// ExchangeStore keeps exchange rates and quotes.
+type ExchangeStore interface {
+	CreateExchangeRate(ctx context.Context, arg repository.CreateExchangeRateParams) (repository.ExchangeRate, error)
+	ListExchangeRates(ctx context.Context, arg repository.ListExchangeRatesParams) ([]repository.ExchangeRate, error)
+	GetEffectiveExchangeRate(ctx context.Context, arg repository.GetEffectiveExchangeRateParams) (repository.ExchangeRate, error)
+	CreateExchangeQuote(ctx context.Context, arg repository.CreateExchangeQuoteParams) (repository.ExchangeQuote, error)
+	GetExchangeQuote(ctx context.Context, id uuid.UUID) (repository.ExchangeQuote, error)
+	ExecuteExchangeQuote(ctx context.Context, arg repository.ExecuteExchangeQuoteParams) (repository.ExchangeQuote, error)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrOperationNotFound      = errors.New("operation not found")
+	ErrOperationNotReversible = errors.New("operation cannot be reversed")
+	ErrOperationReversed      = errors.New("operation is already reversed")
+	ErrInvalidReversal        = errors.New("invalid reversal")
+)
+
+// Reversal is a REVERSAL operation with the operation it reverses and the
+// wallet after both. The reversal of a transfer leg has the reversal of the
+// other leg as its counterpart.
+type Reversal struct {
+	Reversal    repository.Operation `json:"reversal"`
+	Original    repository.Operation `json:"original"`
+	Wallet      repository.Wallet    `json:"wallet"`
+	Counterpart *Reversal            `json:"counterpart,omitempty"`
+}
+
+// ReverseOperation reverses amount of operation id, or all that is left of it
+// when amount is zero. The reversal is an operation of the opposite sign on
+// the same wallet, subject to the same checks as any other: reversing a
+// deposit fails when its amount has been spent. Reversing either leg of a
+// transfer reverses both, so the target pays back what the source gets.
+// Fees charged for the original are not refunded and no fee is charged for
+// the reversal.
+func (s *WalletService) ReverseOperation(ctx context.Context, id uuid.UUID, amount int32) (Reversal, error) {
+	if amount < 0 {
+		return Reversal{}, fmt.Errorf("%w: amount must not be negative", ErrInvalidReversal)
+	}
+
+	original, err := s.repo.GetOperation(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Reversal{}, ErrOperationNotFound
+	}
+	if err != nil {
+		return Reversal{}, err
+	}
+
+	switch models.OperationType(original.OperationType) {
+	case models.OperationDeposit, models.OperationWithdraw, models.OperationAdjustment:
+	case models.OperationTransfer:
+		return s.reverseTransfer(ctx, original, amount)
+	default:
+		return Reversal{}, fmt.Errorf("%w: %s operations are not reversible", ErrOperationNotReversible, original.OperationType)
+	}
+
+	defer s.WalletChanged(original.WalletID)
+
+	var reversal Reversal
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		// Read again: a concurrent reversal may have committed since.
+		current, err := repo.GetOperation(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		reversed, err := reversedAmount(current, amount)
+		if err != nil {
+			return err
+		}
+
+		// ReverseOperation locks the original, so concurrent reversals of
+		// it wait here and then fail to match if they would over-reverse.
+		if reversal.Original, err = markReversed(ctx, repo, id, reversed); err != nil {
+			return err
+		}
+
+		compensation := reversed
+		if current.Amount > 0 {
+			compensation = -reversed
+		}
+
+		if reversal.Wallet, reversal.Reversal, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      current.WalletID,
+			OperationType: string(models.OperationReversal),
+			Amount:        compensation,
+			ReversalOf:    id,
+		}); err != nil {
+			return err
+		}
+
+		if err := postEntry(ctx, repo, string(models.OperationReversal),
+			walletLeg(current.WalletID, compensation),
+			journalLeg{account: bookedAccount(current), amount: -compensation},
+		); err != nil {
+			return err
+		}
+
+		before := reversal.Wallet
+		before.Balance -= compensation
+		return recordAudit(ctx, repo, models.AuditActionReversal, before, reversal.Wallet)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Reversal{}, ErrOperationNotFound
+	}
+	if err != nil {
+		return Reversal{}, err
+	}
+
+	return reversal, nil
+}
+
+// reverseTransfer reverses amount of both legs of the transfer leg is one
+// of. Both wallets are locked first, in the order Transfer locks them, and
+// the debit leg is marked before the credit leg, so that reversals of
+// either leg of the same transfer wait for each other.
+func (s *WalletService) reverseTransfer(ctx context.Context, leg repository.Operation, amount int32) (Reversal, error) {
+	if leg.CounterpartID == uuid.Nil {
+		return Reversal{}, fmt.Errorf("%w: the transfer has no other leg", ErrOperationNotReversible)
+	}
+
+	debitID, creditID := leg.ID, leg.CounterpartID
+	if leg.Amount > 0 {
+		debitID, creditID = creditID, debitID
+	}
+
+	var debit, credit Reversal
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		from, err := repo.GetOperation(ctx, debitID)
+		if err != nil {
+			return err
+		}
+		to, err := repo.GetOperation(ctx, creditID)
+		if err != nil {
+			return err
+		}
+
+		if err := lockWallets(ctx, repo, from.WalletID, to.WalletID); err != nil {
+			return err
+		}
+
+		// Read the leg again under the locks: a reversal of the other
+		// leg may have committed since.
+		current := from
+		if leg.ID == creditID {
+			current = to
+		}
+		if current, err = repo.GetOperation(ctx, current.ID); err != nil {
+			return err
+		}
+		reversed, err := reversedAmount(current, amount)
+		if err != nil {
+			return err
+		}
+
+		if debit.Original, err = markReversed(ctx, repo, debitID, reversed); err != nil {
+			return err
+		}
+		if credit.Original, err = markReversed(ctx, repo, creditID, reversed); err != nil {
+			return err
+		}
+
+		// The target pays back first: this is what fails when the money
+		// has been spent.
+		if credit.Wallet, credit.Reversal, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      to.WalletID,
+			OperationType: string(models.OperationReversal),
+			Amount:        -reversed,
+			ReversalOf:    creditID,
+		}); err != nil {
+			return err
+		}
+		if debit.Wallet, debit.Reversal, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      from.WalletID,
+			OperationType: string(models.OperationReversal),
+			Amount:        reversed,
+			ReversalOf:    debitID,
+		}); err != nil {
+			return err
+		}
+
+		if err := postEntry(ctx, repo, string(models.OperationReversal),
+			walletLeg(to.WalletID, -reversed), walletLeg(from.WalletID, reversed),
+		); err != nil {
+			return err
+		}
+
+		for _, r := range []Reversal{credit, debit} {
+			before := r.Wallet
+			before.Balance -= r.Reversal.Amount
+			if err := recordAudit(ctx, repo, models.AuditActionReversal, before, r.Wallet); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Reversal{}, ErrOperationNotFound
+	}
+	if err != nil {
+		return Reversal{}, err
+	}
+
+	s.WalletChanged(debit.Wallet.ID)
+	s.WalletChanged(credit.Wallet.ID)
+
+	if leg.ID == debitID {
+		debit.Counterpart = &credit
+		return debit, nil
+	}
+	credit.Counterpart = &debit
+	return credit, nil
+}
+
+// reversedAmount is how much of op a reversal of amount reverses: all that
+// is left of it when amount is zero.
+func reversedAmount(op repository.Operation, amount int32) (int32, error) {
+	left := abs64(op.Amount) - int64(op.ReversedAmount)
+	if left == 0 {
+		return 0, ErrOperationReversed
+	}
+	if amount == 0 {
+		return int32(left), nil
+	}
+	if int64(amount) > left {
+		return 0, fmt.Errorf("%w: only %d of the operation is left to reverse", ErrInvalidReversal, left)
+	}
+	return amount, nil
+}
+
+// markReversed adds amount to the reversed amount of operation id, failing
+// with ErrOperationReversed when that would reverse it more than once over.
+func markReversed(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, amount int32) (repository.Operation, error) {
+	op, err := repo.ReverseOperation(ctx, repository.ReverseOperationParams{
+		ID:     id,
+		Amount: amount,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Operation{}, ErrOperationReversed
+	}
+	return op, err
+}
+
+func abs64(n int32) int64 {
+	if n < 0 {
+		return -int64(n)
+	}
+	return int64(n)
+}
@@ -0,0 +1,242 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// operationOf returns the operation of a wallet for amount.
+func operationOf(t *testing.T, svc *service.WalletService, walletID uuid.UUID, amount int32) uuid.UUID {
+	t.Helper()
+
+	ops, err := svc.GetWalletHistory(context.Background(), walletID, 100)
+	require.NoError(t, err)
+	for _, op := range ops {
+		if op.Amount == amount {
+			return op.ID
+		}
+	}
+	require.FailNow(t, "no operation", "wallet %s has no operation for %d", walletID, amount)
+	return uuid.Nil
+}
+
+func TestWalletService_ReverseOperation(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 100)
+	require.NoError(t, err)
+	deposit := operationOf(t, svc, wallet.ID, 100)
+
+	reversal, err := svc.ReverseOperation(ctx, deposit, 30)
+	require.NoError(t, err)
+	assert.Equal(t, int32(70), reversal.Wallet.Balance)
+	assert.Equal(t, string(models.OperationReversal), reversal.Reversal.OperationType)
+	assert.Equal(t, int32(-30), reversal.Reversal.Amount)
+	assert.Equal(t, deposit, reversal.Reversal.ReversalOf)
+	assert.Equal(t, int32(30), reversal.Original.ReversedAmount)
+
+	_, err = svc.ReverseOperation(ctx, deposit, 71)
+	assert.ErrorIs(t, err, service.ErrInvalidReversal)
+
+	reversal, err = svc.ReverseOperation(ctx, deposit, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(-70), reversal.Reversal.Amount, "zero reverses what is left")
+	assert.Zero(t, reversal.Wallet.Balance)
+
+	_, err = svc.ReverseOperation(ctx, deposit, 0)
+	assert.ErrorIs(t, err, service.ErrOperationReversed)
+
+	_, err = svc.ReverseOperation(ctx, reversal.Reversal.ID, 0)
+	assert.ErrorIs(t, err, service.ErrOperationNotReversible)
+
+	_, err = svc.ReverseOperation(ctx, uuid.New(), 0)
+	assert.ErrorIs(t, err, service.ErrOperationNotFound)
+
+	_, err = svc.ReverseOperation(ctx, deposit, -1)
+	assert.ErrorIs(t, err, service.ErrInvalidReversal)
+
+	history, err := svc.GetWalletHistory(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for _, op := range history {
+		if op.ID == deposit {
+			assert.Equal(t, int32(100), op.ReversedAmount, "the original is marked as reversed")
+		}
+	}
+}
+
+func TestWalletService_ReverseOperation_InsufficientFunds(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 100)
+	require.NoError(t, err)
+	deposit := operationOf(t, svc, wallet.ID, 100)
+
+	_, err = svc.ChangeWalletBalance(ctx, wallet.ID, -80)
+	require.NoError(t, err)
+	withdrawal := operationOf(t, svc, wallet.ID, -80)
+
+	_, err = svc.ReverseOperation(ctx, deposit, 0)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	reversal, err := svc.ReverseOperation(ctx, withdrawal, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(80), reversal.Reversal.Amount)
+	assert.Equal(t, int32(100), reversal.Wallet.Balance)
+
+	reversal, err = svc.ReverseOperation(ctx, deposit, 0)
+	require.NoError(t, err, "the failed reversal left nothing behind")
+	assert.Zero(t, reversal.Wallet.Balance)
+}
+
+func TestWalletService_ReverseOperation_Transfer(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	from := newWallet(t, svc, 100)
+	to := newWallet(t, svc, 0)
+	_, _, err := svc.Transfer(ctx, from.ID, to.ID, 40)
+	require.NoError(t, err)
+	debit := operationOf(t, svc, from.ID, -40)
+	credit := operationOf(t, svc, to.ID, 40)
+
+	reversal, err := svc.ReverseOperation(ctx, debit, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(70), reversal.Wallet.Balance)
+	assert.Equal(t, int32(10), reversal.Reversal.Amount)
+	require.NotNil(t, reversal.Counterpart, "reversing one leg reverses the other")
+	assert.Equal(t, credit, reversal.Counterpart.Original.ID)
+	assert.Equal(t, int32(30), reversal.Counterpart.Wallet.Balance)
+	assert.Equal(t, int32(-10), reversal.Counterpart.Reversal.Amount)
+
+	reversal, err = svc.ReverseOperation(ctx, credit, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(-30), reversal.Reversal.Amount, "both legs have the same amount left")
+	assert.Zero(t, reversal.Wallet.Balance)
+	assert.Equal(t, int32(100), reversal.Counterpart.Wallet.Balance)
+
+	_, err = svc.ReverseOperation(ctx, debit, 0)
+	assert.ErrorIs(t, err, service.ErrOperationReversed)
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.True(t, balance.Balanced())
+}
+
+func TestWalletService_ReverseOperation_TransferCreatesNoMoney(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	from := newWallet(t, svc, 100)
+	to := newWallet(t, svc, 0)
+	_, _, err := svc.Transfer(ctx, from.ID, to.ID, 40)
+	require.NoError(t, err)
+	_, err = svc.ChangeWalletBalance(ctx, to.ID, -30)
+	require.NoError(t, err)
+
+	for _, leg := range []uuid.UUID{operationOf(t, svc, from.ID, -40), operationOf(t, svc, to.ID, 40)} {
+		_, err = svc.ReverseOperation(ctx, leg, 0)
+		assert.ErrorIs(t, err, service.ErrInsufficientFunds, "the target has spent the money")
+	}
+
+	gotFrom, err := svc.GetWalletByID(ctx, from.ID)
+	require.NoError(t, err)
+	gotTo, err := svc.GetWalletByID(ctx, to.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(60), gotFrom.Balance, "the source is not credited alone")
+	assert.Equal(t, int32(10), gotTo.Balance)
+
+	reversal, err := svc.ReverseOperation(ctx, operationOf(t, svc, from.ID, -40), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(70), reversal.Wallet.Balance)
+	assert.Equal(t, gotFrom.Balance+gotTo.Balance, reversal.Wallet.Balance+reversal.Counterpart.Wallet.Balance, "a reversal moves money, it does not create it")
+}
+
+func TestWalletService_ReverseOperation_Imported(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	_, err := svc.CreateImport(ctx, []service.ImportRow{
+		{WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 50},
+	}, false)
+	require.NoError(t, err)
+
+	_, err = svc.ReverseOperation(ctx, operationOf(t, svc, wallet.ID, 50), 0)
+	require.NoError(t, err)
+
+	balance, err := svc.TrialBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []service.AccountTotal{
+		{Account: models.JournalAccountAdjustments, Debit: 50, Credit: 50},
+		{Account: models.JournalAccountWallet, Debit: 50, Credit: 50},
+	}, accountTotals(t, balance, service.NoCurrency), "an imported operation is reversed against adjustments")
+}
+
+func TestWalletService_ReverseOperation_Audited(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 50)
+	require.NoError(t, err)
+	deposit := operationOf(t, svc, wallet.ID, 50)
+
+	_, err = svc.SetWalletStatus(ctx, wallet.ID, models.WalletStatusFrozen)
+	require.NoError(t, err)
+	_, err = svc.ReverseOperation(ctx, deposit, 0)
+	assert.ErrorIs(t, err, service.ErrWalletFrozen)
+	_, err = svc.SetWalletStatus(ctx, wallet.ID, models.WalletStatusActive)
+	require.NoError(t, err)
+
+	auditCtx := service.WithAudit(ctx, service.AuditInfo{Actor: "alice"})
+	_, err = svc.ReverseOperation(auditCtx, deposit, 20)
+	require.NoError(t, err)
+
+	entries, err := svc.ListAuditEntries(ctx, service.AuditFilter{
+		Actor:    "alice",
+		WalletID: wallet.ID,
+		From:     time.Now().Add(-time.Hour),
+		To:       time.Now().Add(time.Hour),
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, string(models.AuditActionReversal), entries[0].Action)
+	assert.Equal(t, int32(50), entries[0].Before.Balance)
+	assert.Equal(t, int32(30), entries[0].After.Balance)
+}
+
+func TestWalletService_ReverseOperation_Tenant(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	acme, err := svc.CreateTenant(ctx, "acme")
+	require.NoError(t, err)
+	globex, err := svc.CreateTenant(ctx, "globex")
+	require.NoError(t, err)
+
+	acmeCtx := service.WithTenant(ctx, acme.ID)
+	wallet, err := svc.CreateWallet(acmeCtx, 10)
+	require.NoError(t, err)
+	deposit := operationOf(t, svc, wallet.ID, 10)
+
+	_, err = svc.ReverseOperation(service.WithTenant(ctx, globex.ID), deposit, 0)
+	assert.ErrorIs(t, err, service.ErrOperationNotFound)
+
+	reversal, err := svc.ReverseOperation(acmeCtx, deposit, 0)
+	require.NoError(t, err)
+	assert.Zero(t, reversal.Wallet.Balance)
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrScheduledOperationNotFound = errors.New("scheduled operation not found")
+	ErrInvalidSchedule            = errors.New("invalid scheduled operation")
+)
+
+type ScheduleServiceInterface interface {
+	CreateScheduledOperation(ctx context.Context, p ScheduleParams) (repository.ScheduledOperation, error)
+	GetScheduledOperation(ctx context.Context, id uuid.UUID) (repository.ScheduledOperation, error)
+	ListScheduledOperations(ctx context.Context, walletID, afterID uuid.UUID, limit int32) ([]repository.ScheduledOperation, error)
+	UpdateScheduledOperation(ctx context.Context, id uuid.UUID, p ScheduleParams) (repository.ScheduledOperation, error)
+	DeleteScheduledOperation(ctx context.Context, id uuid.UUID) error
+	ListScheduledOperationRuns(ctx context.Context, id uuid.UUID, limit int32) ([]repository.ScheduledOperationRun, error)
+}
+
+// ScheduleParams describes a scheduled deposit, withdrawal or transfer.
+type ScheduleParams struct {
+	WalletID uuid.UUID
+	// TargetWalletID receives the amount of a transfer.
+	TargetWalletID uuid.UUID
+	OperationType  models.OperationType
+	Amount         int32
+	// RunAt is when a one-off operation runs. Cron makes the operation
+	// recurring instead: a five-field expression or a descriptor such as
+	// @monthly, evaluated in UTC unless prefixed with CRON_TZ=.
+	RunAt time.Time
+	Cron  string
+	// Status is ACTIVE when empty.
+	Status models.ScheduleStatus
+}
+
+// cronParser accepts the same expressions as crontab.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// nextRunAt returns the first time the operation runs after now. A one-off
+// operation must not be due already.
+func (p ScheduleParams) nextRunAt(now time.Time) (time.Time, error) {
+	if p.Cron == "" {
+		if p.RunAt.Before(now) {
+			return time.Time{}, fmt.Errorf("%w: run time is in the past", ErrInvalidSchedule)
+		}
+		return p.RunAt, nil
+	}
+
+	schedule, err := cronParser.Parse(p.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: cron: %v", ErrInvalidSchedule, err)
+	}
+
+	next := schedule.Next(now.UTC())
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: cron %q never matches", ErrInvalidSchedule, p.Cron)
+	}
+	return next, nil
+}
+
+func (p *ScheduleParams) validate() error {
+	if p.Status == "" {
+		p.Status = models.ScheduleStatusActive
+	}
+
+	switch {
+	case p.OperationType != models.OperationDeposit && p.OperationType != models.OperationWithdraw && p.OperationType != models.OperationTransfer:
+		return fmt.Errorf("%w: operation type must be %s, %s or %s", ErrInvalidSchedule, models.OperationDeposit, models.OperationWithdraw, models.OperationTransfer)
+	case p.Amount <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidSchedule)
+	case (p.OperationType == models.OperationTransfer) != (p.TargetWalletID != uuid.Nil):
+		return fmt.Errorf("%w: a target wallet is required for transfers and only for them", ErrInvalidSchedule)
+	case p.TargetWalletID == p.WalletID:
+		return fmt.Errorf("%w: cannot transfer to the same wallet", ErrInvalidSchedule)
+	case (p.Cron == "") == p.RunAt.IsZero():
+		return fmt.Errorf("%w: exactly one of run time and cron is required", ErrInvalidSchedule)
+	case p.Status != models.ScheduleStatusActive && p.Status != models.ScheduleStatusPaused:
+		return fmt.Errorf("%w: status must be %s or %s", ErrInvalidSchedule, models.ScheduleStatusActive, models.ScheduleStatusPaused)
+	}
+
+	return nil
+}
+
+func (s *WalletService) checkScheduleWallets(ctx context.Context, p ScheduleParams) error {
+	for _, id := range []uuid.UUID{p.WalletID, p.TargetWalletID} {
+		if id == uuid.Nil {
+			continue
+		}
+		if _, err := s.repo.GetWalletByID(ctx, id); errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WalletService) CreateScheduledOperation(ctx context.Context, p ScheduleParams) (repository.ScheduledOperation, error) {
+	if err := p.validate(); err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	nextRunAt, err := p.nextRunAt(time.Now())
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	if err := s.checkScheduleWallets(ctx, p); err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	var op repository.ScheduledOperation
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		op, err = repo.CreateScheduledOperation(ctx, repository.CreateScheduledOperationParams{
+			WalletID:       p.WalletID,
+			TargetWalletID: p.TargetWalletID,
+			OperationType:  string(p.OperationType),
+			Amount:         p.Amount,
+			Cron:           p.Cron,
+			NextRunAt:      nextRunAt,
+		})
+		if err != nil || p.Status == models.ScheduleStatusActive {
+			return err
+		}
+
+		op, err = repo.UpdateScheduledOperation(ctx, updateScheduleParams(op, p.Status, op.NextRunAt))
+		return err
+	})
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	return op, nil
+}
+
+func (s *WalletService) GetScheduledOperation(ctx context.Context, id uuid.UUID) (repository.ScheduledOperation, error) {
+	op, err := s.repo.GetScheduledOperation(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.ScheduledOperation{}, ErrScheduledOperationNotFound
+	}
+	return op, err
+}
+
+// ListScheduledOperations pages through scheduled operations in ID order,
+// optionally only those moving money from or to a wallet.
+func (s *WalletService) ListScheduledOperations(ctx context.Context, walletID, afterID uuid.UUID, limit int32) ([]repository.ScheduledOperation, error) {
+	return s.repo.ListScheduledOperations(ctx, repository.ListScheduledOperationsParams{
+		AfterID:  afterID,
+		WalletID: walletID,
+		PageSize: limit,
+	})
+}
+
+// UpdateScheduledOperation replaces everything but the source wallet and
+// reschedules the next run.
+func (s *WalletService) UpdateScheduledOperation(ctx context.Context, id uuid.UUID, p ScheduleParams) (repository.ScheduledOperation, error) {
+	current, err := s.GetScheduledOperation(ctx, id)
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	if p.WalletID != uuid.Nil && p.WalletID != current.WalletID {
+		return repository.ScheduledOperation{}, fmt.Errorf("%w: the wallet cannot be changed", ErrInvalidSchedule)
+	}
+	p.WalletID = current.WalletID
+
+	if err := p.validate(); err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	nextRunAt, err := p.nextRunAt(time.Now())
+	if err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	if err := s.checkScheduleWallets(ctx, p); err != nil {
+		return repository.ScheduledOperation{}, err
+	}
+
+	op, err := s.repo.UpdateScheduledOperation(ctx, repository.UpdateScheduledOperationParams{
+		ID:             id,
+		TargetWalletID: p.TargetWalletID,
+		OperationType:  string(p.OperationType),
+		Amount:         p.Amount,
+		Cron:           p.Cron,
+		Status:         string(p.Status),
+		NextRunAt:      nextRunAt,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.ScheduledOperation{}, ErrScheduledOperationNotFound
+	}
+	return op, err
+}
+
+func (s *WalletService) DeleteScheduledOperation(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.repo.DeleteScheduledOperation(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrScheduledOperationNotFound
+	}
+	return nil
+}
+
+// ListScheduledOperationRuns returns the latest runs of an operation, newest
+// first.
+func (s *WalletService) ListScheduledOperationRuns(ctx context.Context, id uuid.UUID, limit int32) ([]repository.ScheduledOperationRun, error) {
+	if _, err := s.GetScheduledOperation(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListScheduledOperationRuns(ctx, repository.ListScheduledOperationRunsParams{
+		ScheduledOperationID: id,
+		Limit:                limit,
+	})
+}
+
+// RunScheduler runs due scheduled operations every interval until ctx is
+// done. Any number of instances may run it: each due operation is claimed
+// by exactly one of them.
+func (s *WalletService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunDueScheduledOperations(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("scheduler: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDueScheduledOperations runs every operation due at now and returns how
+// many ran, successfully or not.
+func (s *WalletService) RunDueScheduledOperations(ctx context.Context, now time.Time) (int, error) {
+	ran := 0
+	for {
+		ok, err := s.runNextScheduledOperation(ctx, now)
+		if err != nil || !ok {
+			return ran, err
+		}
+		ran++
+	}
+}
+
+// runNextScheduledOperation claims one due operation and, in the same
+// transaction, applies it, records the run and schedules the next one, so
+// an occurrence runs exactly once even if the process dies halfway.
+//
+// Occurrences missed while no scheduler was running are collapsed into one
+// run: the next run is the first match of the cron expression after now.
+func (s *WalletService) runNextScheduledOperation(ctx context.Context, now time.Time) (bool, error) {
+	var op repository.ScheduledOperation
+	var run repository.ScheduledOperationRun
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+
+		op, err = repo.ClaimDueScheduledOperation(ctx, now)
+		if err != nil {
+			return err
+		}
+
+		// A failed operation only rolls back to the savepoint, so the failure
+		// is recorded and the schedule moves on.
+		status, message := models.RunStatusSucceeded, ""
+		err = repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+			return applyScheduledOperation(WithAudit(ctx, AuditInfo{Actor: SchedulerActor}), s.withRepo(repo), op)
+		})
+		if err != nil {
+			status, message = models.RunStatusFailed, err.Error()
+		}
+
+		run, err = repo.CreateScheduledOperationRun(ctx, repository.CreateScheduledOperationRunParams{
+			ScheduledOperationID: op.ID,
+			ScheduledFor:         op.NextRunAt,
+			Status:               string(status),
+			Error:                message,
+		})
+		if err != nil {
+			return err
+		}
+
+		nextStatus, nextRunAt := models.ScheduleStatusDone, op.NextRunAt
+		if op.Cron != "" {
+			nextStatus = models.ScheduleStatusActive
+			nextRunAt, err = ScheduleParams{Cron: op.Cron}.nextRunAt(now)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = repo.UpdateScheduledOperation(ctx, updateScheduleParams(op, nextStatus, nextRunAt))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if run.Status == string(models.RunStatusSucceeded) {
+		s.WalletChanged(op.WalletID)
+		if op.TargetWalletID != uuid.Nil {
+			s.WalletChanged(op.TargetWalletID)
+		}
+	}
+
+	return true, nil
+}
+
+func applyScheduledOperation(ctx context.Context, s *WalletService, op repository.ScheduledOperation) error {
+	var err error
+
+	switch models.OperationType(op.OperationType) {
+	case models.OperationDeposit:
+		_, err = s.TopUpWalletBalance(ctx, op.WalletID, op.Amount)
+	case models.OperationWithdraw:
+		_, err = s.TopUpWalletBalance(ctx, op.WalletID, -op.Amount)
+	case models.OperationTransfer:
+		_, _, err = s.Transfer(ctx, op.WalletID, op.TargetWalletID, op.Amount)
+	default:
+		err = fmt.Errorf("unknown operation type %q", op.OperationType)
+	}
+
+	return err
+}
+
+func updateScheduleParams(op repository.ScheduledOperation, status models.ScheduleStatus, nextRunAt time.Time) repository.UpdateScheduledOperationParams {
+	return repository.UpdateScheduledOperationParams{
+		ID:             op.ID,
+		TargetWalletID: op.TargetWalletID,
+		OperationType:  op.OperationType,
+		Amount:         op.Amount,
+		Cron:           op.Cron,
+		Status:         string(status),
+		NextRunAt:      nextRunAt,
+	}
+}
@@ -0,0 +1,248 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletService_RunDueScheduledOperations_OneOff(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	runAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+
+	op, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:      wallet.ID,
+		OperationType: models.OperationDeposit,
+		Amount:        30,
+		RunAt:         runAt,
+	})
+	require.NoError(t, err)
+	assert.True(t, runAt.Equal(op.NextRunAt))
+
+	ran, err := svc.RunDueScheduledOperations(ctx, runAt.Add(-time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, ran, "not due yet")
+
+	ran, err = svc.RunDueScheduledOperations(ctx, runAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+
+	ran, err = svc.RunDueScheduledOperations(ctx, runAt.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, ran, "a one-off operation runs once")
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(30), got.Balance)
+
+	op, err = svc.GetScheduledOperation(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ScheduleStatusDone), op.Status)
+
+	runs, err := svc.ListScheduledOperationRuns(ctx, op.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, string(models.RunStatusSucceeded), runs[0].Status)
+	assert.True(t, runAt.Equal(runs[0].ScheduledFor))
+}
+
+func TestWalletService_RunDueScheduledOperations_RecurringTransfer(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	parent := newWallet(t, svc, 100)
+	child := newWallet(t, svc, 0)
+
+	op, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:       parent.ID,
+		TargetWalletID: child.ID,
+		OperationType:  models.OperationTransfer,
+		Amount:         25,
+		Cron:           "0 9 1 * *",
+	})
+	require.NoError(t, err)
+
+	first := op.NextRunAt
+	assert.Equal(t, 1, first.Day())
+	assert.Equal(t, 9, first.Hour())
+
+	// The scheduler was down for three months: the missed allowances are
+	// paid once, not three times.
+	ran, err := svc.RunDueScheduledOperations(ctx, first.AddDate(0, 2, 0))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+
+	got, err := svc.GetWalletByID(ctx, child.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(25), got.Balance)
+
+	op, err = svc.GetScheduledOperation(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ScheduleStatusActive), op.Status)
+	assert.True(t, first.AddDate(0, 3, 0).Equal(op.NextRunAt), "next run is the first match after now")
+}
+
+func TestWalletService_RunDueScheduledOperations_RecordsFailure(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 10)
+
+	op, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:      wallet.ID,
+		OperationType: models.OperationWithdraw,
+		Amount:        50,
+		RunAt:         time.Now().Add(time.Second),
+	})
+	require.NoError(t, err)
+
+	ran, err := svc.RunDueScheduledOperations(ctx, op.NextRunAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+
+	runs, err := svc.ListScheduledOperationRuns(ctx, op.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, string(models.RunStatusFailed), runs[0].Status)
+	assert.Equal(t, service.ErrInsufficientFunds.Error(), runs[0].Error)
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(10), got.Balance)
+
+	history, err := svc.GetWalletHistory(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, history, 1, "only the opening deposit is recorded")
+}
+
+func TestWalletService_RunDueScheduledOperations_ConcurrentSchedulers(t *testing.T) {
+	store := memory.NewStore()
+	ctx := context.Background()
+
+	wallet := newWallet(t, service.NewWalletService(store), 0)
+	now := time.Now().Add(time.Second)
+
+	const operations = 20
+	for range operations {
+		_, err := service.NewWalletService(store).CreateScheduledOperation(ctx, service.ScheduleParams{
+			WalletID:      wallet.ID,
+			OperationType: models.OperationDeposit,
+			Amount:        1,
+			RunAt:         now,
+		})
+		require.NoError(t, err)
+	}
+
+	// Each scheduler is its own service, like one per instance.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ran, err := service.NewWalletService(store).RunDueScheduledOperations(ctx, now)
+			assert.NoError(t, err)
+			mu.Lock()
+			total += ran
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, operations, total)
+
+	got, err := service.NewWalletService(store).GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(operations), got.Balance)
+}
+
+func TestWalletService_CreateScheduledOperation_Invalid(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	other := newWallet(t, svc, 0)
+	runAt := time.Now().Add(time.Hour)
+
+	for name, p := range map[string]service.ScheduleParams{
+		"no time":            {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1},
+		"time and cron":      {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1, RunAt: runAt, Cron: "@daily"},
+		"bad cron":           {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1, Cron: "every day"},
+		"seconds in cron":    {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1, Cron: "0 0 0 1 * *"},
+		"negative amount":    {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: -1, RunAt: runAt},
+		"adjustment":         {WalletID: wallet.ID, OperationType: models.OperationAdjustment, Amount: 1, RunAt: runAt},
+		"no target":          {WalletID: wallet.ID, OperationType: models.OperationTransfer, Amount: 1, RunAt: runAt},
+		"target for deposit": {WalletID: wallet.ID, TargetWalletID: other.ID, OperationType: models.OperationDeposit, Amount: 1, RunAt: runAt},
+		"done":               {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1, RunAt: runAt, Status: models.ScheduleStatusDone},
+		"past":               {WalletID: wallet.ID, OperationType: models.OperationDeposit, Amount: 1, RunAt: time.Now().Add(-time.Minute)},
+	} {
+		_, err := svc.CreateScheduledOperation(ctx, p)
+		assert.ErrorIs(t, err, service.ErrInvalidSchedule, name)
+	}
+
+	_, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:       wallet.ID,
+		TargetWalletID: uuid.New(),
+		OperationType:  models.OperationTransfer,
+		Amount:         1,
+		RunAt:          runAt,
+	})
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+}
+
+func TestWalletService_UpdateScheduledOperation(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+
+	op, err := svc.CreateScheduledOperation(ctx, service.ScheduleParams{
+		WalletID:      wallet.ID,
+		OperationType: models.OperationDeposit,
+		Amount:        1,
+		Cron:          "@daily",
+		Status:        models.ScheduleStatusPaused,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ScheduleStatusPaused), op.Status)
+
+	ran, err := svc.RunDueScheduledOperations(ctx, op.NextRunAt)
+	require.NoError(t, err)
+	assert.Zero(t, ran, "paused operations do not run")
+
+	op, err = svc.UpdateScheduledOperation(ctx, op.ID, service.ScheduleParams{
+		OperationType: models.OperationDeposit,
+		Amount:        7,
+		Cron:          "@weekly",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ScheduleStatusActive), op.Status)
+	assert.Equal(t, int32(7), op.Amount)
+	assert.Equal(t, time.Sunday, op.NextRunAt.Weekday())
+
+	_, err = svc.UpdateScheduledOperation(ctx, op.ID, service.ScheduleParams{
+		WalletID:      uuid.New(),
+		OperationType: models.OperationDeposit,
+		Amount:        7,
+		Cron:          "@weekly",
+	})
+	assert.ErrorIs(t, err, service.ErrInvalidSchedule)
+
+	require.NoError(t, svc.DeleteScheduledOperation(ctx, op.ID))
+	assert.ErrorIs(t, svc.DeleteScheduledOperation(ctx, op.ID), service.ErrScheduledOperationNotFound)
+
+	_, err = svc.UpdateScheduledOperation(ctx, op.ID, service.ScheduleParams{OperationType: models.OperationDeposit, Amount: 1, Cron: "@daily"})
+	assert.ErrorIs(t, err, service.ErrScheduledOperationNotFound)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+// MaxWalletShards bounds the number of sub-balances of a sharded wallet.
+const MaxWalletShards = 64
+
+var ErrInvalidShardCount = errors.New("invalid shard count")
+
+// SetWalletShards spreads future credits of a wallet over the given number of
+// shard rows, or turns sharding off with zero. Existing shard balances are
+// folded into the wallets row first, so the total balance does not change.
+func (s *WalletService) SetWalletShards(ctx context.Context, id uuid.UUID, shards int32) (repository.Wallet, error) {
+	if shards < 0 || shards > MaxWalletShards {
+		return repository.Wallet{}, ErrInvalidShardCount
+	}
+
+	defer s.WalletChanged(id)
+
+	var wallet repository.Wallet
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		before, err := foldWalletShards(ctx, repo, id, 0)
+		if err != nil {
+			return err
+		}
+
+		if err := repo.DeleteWalletShards(ctx, id); err != nil {
+			return err
+		}
+
+		wallet, err = repo.SetWalletShardCount(ctx, repository.SetWalletShardCountParams{
+			ID:         id,
+			ShardCount: shards,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := recordAudit(ctx, repo, models.AuditActionShardsChange, before, wallet); err != nil || shards == 0 {
+			return err
+		}
+
+		return repo.CreateWalletShards(ctx, id)
+	})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// applyShardedOperation changes the balance of a sharded wallet. Credits go to
+// a random shard without touching the wallets row; debits take the locked
+// path, since only the total of all shards tells whether funds suffice.
+func applyShardedOperation(ctx context.Context, repo WalletRepositoryInterface, wallet repository.Wallet, op repository.CreateOperationParams) (repository.Wallet, repository.Operation, error) {
+	if op.Amount < 0 {
+		return applyLockedOperation(ctx, repo, op)
+	}
+
+	credited, err := repo.CreditWalletShard(ctx, repository.CreditWalletShardParams{
+		WalletID: wallet.ID,
+		ShardID:  rand.Int32N(wallet.ShardCount),
+		Amount:   op.Amount,
+	})
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	// The wallet was frozen or resharded after it was read.
+	if credited == 0 {
+		return applyLockedOperation(ctx, repo, op)
+	}
+
+	shards, err := repo.SumWalletShards(ctx, wallet.ID)
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	recorded, err := repo.CreateOperation(ctx, op)
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	if wallet, err = withShards(wallet, shards); err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	return wallet, recorded, nil
+}
+
+// applyLockedOperation locks the wallet with all its shards, folds the shards
+// into the wallets row and applies op there.
+func applyLockedOperation(ctx context.Context, repo WalletRepositoryInterface, op repository.CreateOperationParams) (repository.Wallet, repository.Operation, error) {
+	wallet, err := foldWalletShards(ctx, repo, op.WalletID, op.Amount)
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	recorded, err := repo.CreateOperation(ctx, op)
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	return wallet, recorded, nil
+}
+
+func foldWalletShards(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, amount int32) (repository.Wallet, error) {
+	wallet, err := repo.GetWalletByIDForUpdate(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	if amount != 0 {
+		if err := checkWalletActive(wallet); err != nil {
+			return repository.Wallet{}, err
+		}
+	}
+
+	shardsBalance, err := repo.LockWalletShards(ctx, id)
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	total := int64(wallet.Balance) + shardsBalance + int64(amount)
+	if amount < 0 && total < 0 {
+		return repository.Wallet{}, ErrInsufficientFunds
+	}
+	if total > math.MaxInt32 || total < math.MinInt32 {
+		return repository.Wallet{}, errBalanceOverflow
+	}
+
+	if err := repo.ResetWalletShards(ctx, id); err != nil {
+		return repository.Wallet{}, err
+	}
+
+	wallet, err = repo.SetWalletBalance(ctx, repository.SetWalletBalanceParams{
+		ID:      id,
+		Balance: int32(total),
+	})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	// The shards are empty now, but their versions still count.
+	return sumWalletShards(ctx, repo, wallet)
+}
+
+// withShards returns wallet with the balances and versions of all its shards
+// added to its own.
+func withShards(wallet repository.Wallet, shards repository.SumWalletShardsRow) (repository.Wallet, error) {
+	total := int64(wallet.Balance) + shards.Balance
+	if total > math.MaxInt32 || total < math.MinInt32 {
+		return repository.Wallet{}, errBalanceOverflow
+	}
+
+	wallet.Balance = int32(total)
+	wallet.Version += shards.Version
+	return wallet, nil
+}
+
+func sumWalletShards(ctx context.Context, repo ShardStore, wallet repository.Wallet) (repository.Wallet, error) {
+	if wallet.ShardCount == 0 {
+		return wallet, nil
+	}
+
+	shards, err := repo.SumWalletShards(ctx, wallet.ID)
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return withShards(wallet, shards)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func shardedWallet(balance int32) repository.Wallet {
+	return repository.Wallet{
+		ID:         uuid.New(),
+		Balance:    balance,
+		Status:     string(models.WalletStatusActive),
+		ShardCount: 4,
+	}
+}
+
+func TestWalletService_GetWalletByID_SumsShards(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	wallet := shardedWallet(100)
+
+	mockRepo.On("GetWalletWithShards", ctx, wallet.ID).Return(repository.GetWalletWithShardsRow{Wallet: wallet, ShardsBalance: 50, ShardsVersion: 3}, nil)
+
+	result, err := service.GetWalletByID(ctx, wallet.ID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(150), result.Balance)
+	assert.Equal(t, wallet.Version+3, result.Version)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_TopUpWalletBalance_ShardedCredit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	wallet := shardedWallet(100)
+
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: 30}).Return(repository.Wallet{}, pgx.ErrNoRows)
+	mockRepo.On("GetWalletByID", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("CreditWalletShard", ctx, mock.MatchedBy(func(arg repository.CreditWalletShardParams) bool {
+		return arg.WalletID == wallet.ID && arg.Amount == 30 && arg.ShardID >= 0 && arg.ShardID < wallet.ShardCount
+	})).Return(int64(1), nil)
+	mockRepo.On("SumWalletShards", ctx, wallet.ID).Return(repository.SumWalletShardsRow{Balance: 80}, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        30,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
+
+	result, err := service.TopUpWalletBalance(ctx, wallet.ID, 30)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(180), result.Balance)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "SetWalletBalance", mock.Anything, mock.Anything)
+}
+
+func TestWalletService_TopUpWalletBalance_ShardedDebit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	wallet := shardedWallet(20)
+
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: -50}).Return(repository.Wallet{}, pgx.ErrNoRows)
+	mockRepo.On("GetWalletByID", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("GetWalletByIDForUpdate", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("LockWalletShards", ctx, wallet.ID).Return(int64(80), nil)
+	mockRepo.On("ResetWalletShards", ctx, wallet.ID).Return(nil)
+	mockRepo.On("SetWalletBalance", ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: 50}).
+		Return(repository.Wallet{ID: wallet.ID, Balance: 50, ShardCount: 4}, nil)
+	mockRepo.On("SumWalletShards", ctx, wallet.ID).Return(repository.SumWalletShardsRow{}, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      wallet.ID,
+		OperationType: string(models.OperationWithdraw),
+		Amount:        -50,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
+
+	result, err := service.TopUpWalletBalance(ctx, wallet.ID, -50)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(50), result.Balance)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_TopUpWalletBalance_ShardedDebit_InsufficientFunds(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	wallet := shardedWallet(20)
+
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: wallet.ID, Amount: -150}).Return(repository.Wallet{}, pgx.ErrNoRows)
+	mockRepo.On("GetWalletByID", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("GetWalletByIDForUpdate", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("LockWalletShards", ctx, wallet.ID).Return(int64(80), nil)
+
+	_, err := service.TopUpWalletBalance(ctx, wallet.ID, -150)
+
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	mockRepo.AssertNotCalled(t, "ResetWalletShards", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "CreateOperation", mock.Anything, mock.Anything)
+}
+
+func TestWalletService_SetWalletShards(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	wallet := shardedWallet(20)
+
+	mockRepo.On("GetWalletByIDForUpdate", ctx, wallet.ID).Return(wallet, nil)
+	mockRepo.On("LockWalletShards", ctx, wallet.ID).Return(int64(80), nil)
+	mockRepo.On("ResetWalletShards", ctx, wallet.ID).Return(nil)
+	mockRepo.On("SetWalletBalance", ctx, repository.SetWalletBalanceParams{ID: wallet.ID, Balance: 100}).
+		Return(repository.Wallet{ID: wallet.ID, Balance: 100, ShardCount: 4}, nil)
+	mockRepo.On("SumWalletShards", ctx, wallet.ID).Return(repository.SumWalletShardsRow{}, nil)
+	mockRepo.On("DeleteWalletShards", ctx, wallet.ID).Return(nil)
+	mockRepo.On("SetWalletShardCount", ctx, repository.SetWalletShardCountParams{ID: wallet.ID, ShardCount: 8}).
+		Return(repository.Wallet{ID: wallet.ID, Balance: 100, ShardCount: 8}, nil)
+	mockRepo.On("CreateWalletShards", ctx, wallet.ID).Return(nil)
+
+	result, err := service.SetWalletShards(ctx, wallet.ID, 8)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(100), result.Balance)
+	assert.Equal(t, int32(8), result.ShardCount)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_SetWalletShards_Invalid(t *testing.T) {
+	service := NewWalletService(new(MockRepository))
+
+	_, err := service.SetWalletShards(context.Background(), uuid.New(), MaxWalletShards+1)
+
+	assert.ErrorIs(t, err, ErrInvalidShardCount)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+var ErrInvalidStatementPeriod = errors.New("invalid statement period")
+
+const statementPageSize = 500
+
+// StatementOpening starts a statement of the operations made in [From, To).
+type StatementOpening struct {
+	WalletID uuid.UUID
+	Currency string
+	From     time.Time
+	To       time.Time
+	Balance  int64
+}
+
+// StatementClosing ends a statement. Balance is the opening balance plus
+// Credits minus Debits.
+type StatementClosing struct {
+	Balance    int64
+	Credits    int64
+	Debits     int64
+	Operations int
+}
+
+// StatementWriter receives a statement while it is read, one operation at a
+// time, so that it never has to be held in memory.
+type StatementWriter interface {
+	Opening(o StatementOpening) error
+	Operation(op repository.Operation, balance int64) error
+	Closing(c StatementClosing) error
+}
+
+// WriteStatement writes the operations of a wallet made in [from, to), each
+// with the balance after it. Everything is read from one snapshot, so the
+// totals reconcile even while the wallet keeps changing.
+func (s *WalletService) WriteStatement(ctx context.Context, id uuid.UUID, from, to time.Time, w StatementWriter) error {
+	if !from.Before(to) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidStatementPeriod)
+	}
+
+	return s.repo.ExecSnapshot(ctx, func(repo WalletRepositoryInterface) error {
+		wallet, err := repo.GetWalletByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrWalletNotFound
+			}
+			return err
+		}
+
+		opening, err := repo.GetWalletBalanceAt(ctx, repository.GetWalletBalanceAtParams{WalletID: id, Before: from})
+		if err != nil {
+			return err
+		}
+
+		if err := w.Opening(StatementOpening{WalletID: id, Currency: wallet.Currency, From: from, To: to, Balance: opening}); err != nil {
+			return err
+		}
+
+		closing := StatementClosing{Balance: opening}
+
+		// The zero ID sorts first, so the page starts with the operations
+		// made at from itself.
+		after := repository.ListOperationsPageParams{AfterCreatedAt: from, WalletID: id, PageSize: statementPageSize}
+		for {
+			page, err := repo.ListOperationsPage(ctx, after)
+			if err != nil {
+				return err
+			}
+
+			for _, op := range page {
+				if !op.CreatedAt.Before(to) {
+					return w.Closing(closing)
+				}
+
+				closing.Balance += int64(op.Amount)
+				if op.Amount < 0 {
+					closing.Debits -= int64(op.Amount)
+				} else {
+					closing.Credits += int64(op.Amount)
+				}
+				closing.Operations++
+
+				if err := w.Operation(op, closing.Balance); err != nil {
+					return err
+				}
+			}
+
+			if len(page) < statementPageSize {
+				return w.Closing(closing)
+			}
+
+			last := page[len(page)-1]
+			after.AfterCreatedAt, after.AfterID = last.CreatedAt, last.ID
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statementRecorder keeps a statement in memory. Operation fails once fail
+// operations were written, if fail is set.
+type statementRecorder struct {
+	opening    service.StatementOpening
+	operations []repository.Operation
+	balances   []int64
+	closing    *service.StatementClosing
+
+	fail int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (r *statementRecorder) Opening(o service.StatementOpening) error {
+	r.opening = o
+	return nil
+}
+
+func (r *statementRecorder) Operation(op repository.Operation, balance int64) error {
+	if r.fail > 0 && len(r.operations) == r.fail {
+		return errWriteFailed
+	}
+	r.operations = append(r.operations, op)
+	r.balances = append(r.balances, balance)
+	return nil
+}
+
+func (r *statementRecorder) Closing(c service.StatementClosing) error {
+	r.closing = &c
+	return nil
+}
+
+func TestWalletService_WriteStatement(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 100)
+	time.Sleep(time.Millisecond)
+	from := time.Now().Truncate(time.Microsecond)
+
+	for _, amount := range []int32{50, -30} {
+		_, err := svc.ChangeWalletBalance(ctx, wallet.ID, amount)
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Millisecond)
+	to := time.Now().Truncate(time.Microsecond)
+	time.Sleep(time.Millisecond)
+
+	_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 1000)
+	require.NoError(t, err)
+
+	var r statementRecorder
+	require.NoError(t, svc.WriteStatement(ctx, wallet.ID, from, to, &r))
+
+	assert.Equal(t, service.StatementOpening{WalletID: wallet.ID, Currency: service.NoCurrency, From: from, To: to, Balance: 100}, r.opening)
+	require.Len(t, r.operations, 2, "operations outside the period are left out")
+	assert.Equal(t, int32(50), r.operations[0].Amount)
+	assert.Equal(t, []int64{150, 120}, r.balances)
+	assert.Equal(t, &service.StatementClosing{Balance: 120, Credits: 50, Debits: 30, Operations: 2}, r.closing)
+}
+
+func TestWalletService_WriteStatement_Pages(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 0)
+	const operations = 1200
+	for range operations {
+		_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 1)
+		require.NoError(t, err)
+	}
+
+	var r statementRecorder
+	require.NoError(t, svc.WriteStatement(ctx, wallet.ID, time.Time{}, time.Now().Add(time.Second), &r))
+
+	require.Len(t, r.operations, operations)
+	seen := make(map[uuid.UUID]bool, operations)
+	for i, op := range r.operations {
+		assert.False(t, seen[op.ID], "operation %d is repeated", i)
+		seen[op.ID] = true
+	}
+	assert.Equal(t, int64(operations), r.closing.Balance)
+
+	got, err := svc.GetWalletByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(got.Balance), r.closing.Balance, "the statement reconciles with the wallet")
+}
+
+func TestWalletService_WriteStatement_Errors(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+	now := time.Now()
+
+	err := svc.WriteStatement(ctx, uuid.New(), now.Add(-time.Hour), now, &statementRecorder{})
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+
+	wallet := newWallet(t, svc, 10)
+
+	err = svc.WriteStatement(ctx, wallet.ID, now, now, &statementRecorder{})
+	assert.ErrorIs(t, err, service.ErrInvalidStatementPeriod)
+
+	for range 2 {
+		_, err := svc.ChangeWalletBalance(ctx, wallet.ID, 1)
+		require.NoError(t, err)
+	}
+
+	r := statementRecorder{fail: 1}
+	err = svc.WriteStatement(ctx, wallet.ID, now.Add(-time.Hour), time.Now().Add(time.Second), &r)
+	assert.ErrorIs(t, err, errWriteFailed)
+	assert.Nil(t, r.closing)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+var (
+	ErrInvalidTenant  = errors.New("invalid tenant")
+	ErrTenantExists   = errors.New("tenant already exists")
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+)
+
+// apiKeyPrefix starts every API key, so that leaked keys are easy to find.
+const apiKeyPrefix = "itk_"
+
+// DefaultTenantID is the tenant created by the tenants migration. Wallets
+// that existed before tenants belong to it.
+var DefaultTenantID = uuid.MustParse("defa0000-0000-4000-8000-000000000000")
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose repository calls only see the wallets of
+// tenant, and the rows that belong to them. Wallets created with it belong to
+// tenant.
+func WithTenant(ctx context.Context, tenant uuid.UUID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant set by WithTenant. Without one, every
+// wallet is visible.
+func TenantFrom(ctx context.Context) (uuid.UUID, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(uuid.UUID)
+	return tenant, tenant != uuid.Nil
+}
+
+// withoutTenant lifts the isolation of ctx, for the service's own writes to
+// wallets of other tenants, such as crediting the fee wallet.
+func withoutTenant(ctx context.Context) context.Context {
+	if _, ok := TenantFrom(ctx); !ok {
+		return ctx
+	}
+	return WithTenant(ctx, uuid.Nil)
+}
+
+// visibleTo reports whether wallet, read without isolation, belongs to the
+// tenant of ctx.
+func visibleTo(ctx context.Context, wallet repository.Wallet) bool {
+	tenant, ok := TenantFrom(ctx)
+	return !ok || wallet.TenantID == tenant
+}
+
+func (s *WalletService) CreateTenant(ctx context.Context, name string) (repository.Tenant, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return repository.Tenant{}, fmt.Errorf("%w: name is required", ErrInvalidTenant)
+	}
+
+	tenant, err := s.repo.CreateTenant(ctx, name)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "tenants_name_key" {
+		return repository.Tenant{}, ErrTenantExists
+	}
+	return tenant, err
+}
+
+func (s *WalletService) ListTenants(ctx context.Context) ([]repository.Tenant, error) {
+	return s.repo.ListTenants(ctx)
+}
+
+// IssueTenantKey returns a new API key for the tenant, which replaces its
+// previous one. Only the hash of the key is stored.
+func (s *WalletService) IssueTenantKey(ctx context.Context, id uuid.UUID) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	_, err := s.repo.SetTenantKeyHash(ctx, repository.SetTenantKeyHashParams{
+		ID:         id,
+		ApiKeyHash: apiKeyHash(key),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrTenantNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// TenantForKey returns the tenant that the API key was issued to.
+func (s *WalletService) TenantForKey(ctx context.Context, key string) (uuid.UUID, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return uuid.Nil, ErrInvalidAPIKey
+	}
+
+	tenant, err := s.repo.GetTenantByKeyHash(ctx, apiKeyHash(key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return tenant.ID, nil
+}
+
+// apiKeyHash is the stored form of an API key. The key is random, so an
+// unsalted hash is enough.
+func apiKeyHash(key string) pgtype.Text {
+	sum := sha256.Sum256([]byte(key))
+	return pgtype.Text{String: hex.EncodeToString(sum[:]), Valid: true}
+}
+
+// MarkSystemWallet hides a wallet of the service, such as the fee wallet,
+// from every tenant.
+func (s *WalletService) MarkSystemWallet(ctx context.Context, id uuid.UUID) error {
+	defer s.WalletChanged(id)
+
+	_, err := s.repo.MarkSystemWallet(withoutTenant(ctx), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWalletNotFound
+	}
+	return err
+}
+
+// SetWalletOwner assigns the wallet to ownerID, or to no one with a zero
+// ownerID.
+func (s *WalletService) SetWalletOwner(ctx context.Context, id, ownerID uuid.UUID) (repository.Wallet, error) {
+	defer s.WalletChanged(id)
+
+	var wallet repository.Wallet
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+		if wallet, err = repo.SetWalletOwner(ctx, repository.SetWalletOwnerParams{ID: id, OwnerID: ownerID}); err != nil {
+			return err
+		}
+
+		wallet, err = sumWalletShards(ctx, repo, wallet)
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// ListOwnerWallets returns the wallets of an owner in ID order after
+// afterID, with their total balances.
+func (s *WalletService) ListOwnerWallets(ctx context.Context, ownerID, afterID uuid.UUID, limit int32) ([]repository.Wallet, error) {
+	wallets, err := s.repo.ListOwnerWallets(ctx, repository.ListOwnerWalletsParams{
+		OwnerID:  ownerID,
+		AfterID:  afterID,
+		PageSize: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range wallets {
+		if wallets[i], err = sumWalletShards(ctx, s.repo, wallets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return wallets, nil
+}
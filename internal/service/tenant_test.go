@@ -0,0 +1,195 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletService_CreateTenant(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	_, err := svc.CreateTenant(ctx, "  ")
+	assert.ErrorIs(t, err, service.ErrInvalidTenant)
+
+	tenant, err := svc.CreateTenant(ctx, " acme ")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant.Name)
+
+	_, err = svc.CreateTenant(ctx, "acme")
+	assert.ErrorIs(t, err, service.ErrTenantExists)
+
+	tenants, err := svc.ListTenants(ctx)
+	require.NoError(t, err)
+	require.Len(t, tenants, 2)
+	assert.Equal(t, "acme", tenants[0].Name)
+	assert.Equal(t, service.DefaultTenantID, tenants[1].ID)
+}
+
+func TestWalletService_TenantKeys(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	acme, err := svc.CreateTenant(ctx, "acme")
+	require.NoError(t, err)
+
+	_, err = svc.IssueTenantKey(ctx, uuid.New())
+	assert.ErrorIs(t, err, service.ErrTenantNotFound)
+
+	key, err := svc.IssueTenantKey(ctx, acme.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "itk_"))
+
+	tenant, err := svc.TenantForKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, tenant)
+
+	tenants, err := svc.ListTenants(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, tenants[0].ApiKeyHash.String, key, "only the hash of the key is stored")
+
+	newKey, err := svc.IssueTenantKey(ctx, acme.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, newKey)
+
+	for _, invalid := range []string{key, "", "itk_", strings.TrimPrefix(newKey, "itk_")} {
+		_, err = svc.TenantForKey(ctx, invalid)
+		assert.ErrorIs(t, err, service.ErrInvalidAPIKey, invalid)
+	}
+
+	tenant, err = svc.TenantForKey(ctx, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, tenant)
+}
+
+func TestWalletService_TenantIsolation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []service.Option
+	}{
+		{"plain", nil},
+		{"cached", []service.Option{service.WithCache(time.Minute, 100)}},
+		{"batched", []service.Option{service.WithBatching(8)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFeeService(t, tt.opts...)
+			ctx := context.Background()
+
+			_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{OperationType: models.OperationDeposit, Kind: models.FeeKindFlat, FlatAmount: 1})
+			require.NoError(t, err)
+
+			acme, err := svc.CreateTenant(ctx, "acme")
+			require.NoError(t, err)
+			globex, err := svc.CreateTenant(ctx, "globex")
+			require.NoError(t, err)
+
+			acmeCtx := service.WithTenant(ctx, acme.ID)
+			globexCtx := service.WithTenant(ctx, globex.ID)
+
+			wallet, err := svc.CreateWallet(acmeCtx, 0)
+			require.NoError(t, err)
+			assert.Equal(t, acme.ID, wallet.TenantID)
+
+			change, err := svc.ChangeWalletBalance(acmeCtx, wallet.ID, 10)
+			require.NoError(t, err)
+			assert.Equal(t, int32(9), change.Wallet.Balance)
+			assert.Equal(t, int32(1), feeWalletBalance(t, svc), "fees of every tenant go to the fee wallet")
+
+			_, err = svc.GetWalletByID(acmeCtx, wallet.ID)
+			assert.NoError(t, err)
+			_, err = svc.GetWalletByID(globexCtx, wallet.ID)
+			assert.ErrorIs(t, err, service.ErrWalletNotFound)
+			_, err = svc.ChangeWalletBalance(globexCtx, wallet.ID, 10)
+			assert.ErrorIs(t, err, service.ErrWalletNotFound)
+			_, err = svc.SetWalletOwner(globexCtx, wallet.ID, uuid.New())
+			assert.ErrorIs(t, err, service.ErrWalletNotFound)
+
+			got, err := svc.GetWalletByID(ctx, wallet.ID)
+			require.NoError(t, err)
+			assert.Equal(t, int32(9), got.Balance, "a rejected change leaves the wallet as it was")
+		})
+	}
+}
+
+func TestWalletService_SystemWallet(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := service.WithTenant(context.Background(), service.DefaultTenantID)
+
+	_, err := svc.CreateFeeSchedule(ctx, service.FeeScheduleParams{OperationType: models.OperationDeposit, Kind: models.FeeKindFlat, FlatAmount: 1})
+	require.NoError(t, err)
+
+	wallet, err := svc.CreateWallet(ctx, 0)
+	require.NoError(t, err)
+	_, err = svc.ChangeWalletBalance(ctx, wallet.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), feeWalletBalance(t, svc), "the fee wallet still collects fees")
+
+	_, err = svc.GetWalletByID(ctx, service.DefaultFeeWalletID)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+	_, err = svc.ChangeWalletBalance(ctx, service.DefaultFeeWalletID, -1)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+	_, _, err = svc.Transfer(ctx, service.DefaultFeeWalletID, wallet.ID, 1)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+	assert.Equal(t, int32(1), feeWalletBalance(t, svc))
+
+	wallets, err := svc.ListWallets(ctx, uuid.Nil, 100)
+	require.NoError(t, err)
+	for _, w := range wallets {
+		assert.NotEqual(t, service.DefaultFeeWalletID, w.ID)
+	}
+
+	assert.ErrorIs(t, svc.MarkSystemWallet(ctx, uuid.New()), service.ErrWalletNotFound)
+}
+
+func TestWalletService_ListOwnerWallets(t *testing.T) {
+	svc := newFeeService(t)
+	ctx := context.Background()
+
+	acme, err := svc.CreateTenant(ctx, "acme")
+	require.NoError(t, err)
+	acmeCtx := service.WithTenant(ctx, acme.ID)
+
+	ownerID := uuid.New()
+
+	first := newWallet(t, svc, 0)
+	_, err = svc.SetWalletOwner(ctx, first.ID, ownerID)
+	require.NoError(t, err)
+
+	second, err := svc.CreateWallet(acmeCtx, 0)
+	require.NoError(t, err)
+	owned, err := svc.SetWalletOwner(acmeCtx, second.ID, ownerID)
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, owned.OwnerID)
+
+	_, err = svc.SetWalletShards(ctx, second.ID, 2)
+	require.NoError(t, err)
+	_, err = svc.ChangeWalletBalance(acmeCtx, second.ID, 40)
+	require.NoError(t, err)
+
+	wallets, err := svc.ListOwnerWallets(acmeCtx, ownerID, uuid.Nil, 10)
+	require.NoError(t, err)
+	require.Len(t, wallets, 1)
+	assert.Equal(t, second.ID, wallets[0].ID)
+	assert.Equal(t, int32(40), wallets[0].Balance, "the balance includes the shards")
+
+	wallets, err = svc.ListOwnerWallets(ctx, ownerID, uuid.Nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, wallets, 2)
+
+	wallets, err = svc.ListOwnerWallets(ctx, ownerID, wallets[0].ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, wallets, 1)
+
+	_, err = svc.SetWalletOwner(ctx, uuid.New(), ownerID)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var ErrInvalidTransfer = errors.New("invalid transfer")
+
+// Transfer moves a positive amount between two wallets in one transaction,
+// recording a TRANSFER operation on each, linked to the other. The transfer
+// fee, if any, is charged to the source.
+func (s *WalletService) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int32) (from, to repository.Wallet, err error) {
+	if amount <= 0 || fromID == toID {
+		return repository.Wallet{}, repository.Wallet{}, ErrInvalidTransfer
+	}
+
+	defer s.WalletChanged(fromID)
+	defer s.WalletChanged(toID)
+
+	var fee int32
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := lockWallets(ctx, repo, fromID, toID); err != nil {
+			return err
+		}
+
+		var err error
+		if fee, err = s.walletFee(ctx, repo, fromID, models.OperationTransfer, amount); err != nil {
+			return err
+		}
+
+		var debit, credit repository.Operation
+		if from, debit, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      fromID,
+			OperationType: string(models.OperationTransfer),
+			Amount:        -amount,
+		}); err != nil {
+			return err
+		}
+		if to, credit, err = applyRecorded(ctx, repo, repository.CreateOperationParams{
+			WalletID:      toID,
+			OperationType: string(models.OperationTransfer),
+			Amount:        amount,
+			CounterpartID: debit.ID,
+		}); err != nil {
+			return err
+		}
+		if err := repo.SetOperationCounterpart(ctx, repository.SetOperationCounterpartParams{
+			ID:            debit.ID,
+			CounterpartID: credit.ID,
+		}); err != nil {
+			return err
+		}
+
+		// The money stays in the service: the transfer is booked from one
+		// wallet to the other, without going through cash.
+		if err := postEntry(ctx, repo, string(models.OperationTransfer), walletLeg(fromID, -amount), walletLeg(toID, amount)); err != nil {
+			return err
+		}
+
+		if fee > 0 {
+			if from, err = s.chargeFee(ctx, repo, fromID, fee); err != nil {
+				return err
+			}
+		}
+
+		fromBefore, toBefore := from, to
+		fromBefore.Balance += amount + fee
+		toBefore.Balance -= amount
+		if err := recordAudit(ctx, repo, models.AuditActionTransfer, fromBefore, from); err != nil {
+			return err
+		}
+		return recordAudit(ctx, repo, models.AuditActionTransfer, toBefore, to)
+	})
+	if err != nil {
+		return repository.Wallet{}, repository.Wallet{}, err
+	}
+
+	if fee > 0 {
+		s.WalletChanged(s.feeWalletID)
+	}
+
+	return from, to, nil
+}
+
+// lockWallets locks two wallets for update in ID order, which keeps
+// transactions locking the same pair the other way round from deadlocking.
+func lockWallets(ctx context.Context, repo WalletRepositoryInterface, a, b uuid.UUID) error {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	for _, id := range []uuid.UUID{a, b} {
+		_, err := repo.GetWalletByIDForUpdate(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
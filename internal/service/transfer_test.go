@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWallet(t *testing.T, svc *service.WalletService, balance int32) repository.Wallet {
+	t.Helper()
+
+	wallet, err := svc.CreateWallet(context.Background(), balance)
+	require.NoError(t, err)
+
+	return wallet
+}
+
+func TestWalletService_Transfer(t *testing.T) {
+	store := memory.NewStore()
+	svc := service.NewWalletService(store)
+	ctx := context.Background()
+
+	from := newWallet(t, svc, 100)
+	to := newWallet(t, svc, 5)
+
+	gotFrom, gotTo, err := svc.Transfer(ctx, from.ID, to.ID, 40)
+	require.NoError(t, err)
+	assert.Equal(t, int32(60), gotFrom.Balance)
+	assert.Equal(t, int32(45), gotTo.Balance)
+
+	history, err := svc.GetWalletHistory(ctx, to.ID, 10)
+	require.NoError(t, err)
+	credit := history[0]
+	assert.Equal(t, int32(40), credit.Amount)
+	assert.Equal(t, string(models.OperationTransfer), credit.OperationType)
+
+	history, err = svc.GetWalletHistory(ctx, from.ID, 10)
+	require.NoError(t, err)
+	debit := history[0]
+	assert.Equal(t, int32(-40), debit.Amount)
+	assert.Equal(t, string(models.OperationTransfer), debit.OperationType)
+	assert.Equal(t, credit.ID, debit.CounterpartID, "the legs are linked to each other")
+	assert.Equal(t, debit.ID, credit.CounterpartID)
+}
+
+func TestWalletService_Transfer_InsufficientFunds(t *testing.T) {
+	store := memory.NewStore()
+	svc := service.NewWalletService(store)
+	ctx := context.Background()
+
+	from := newWallet(t, svc, 10)
+	to := newWallet(t, svc, 0)
+
+	_, _, err := svc.Transfer(ctx, from.ID, to.ID, 11)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	got, err := svc.GetWalletByID(ctx, to.ID)
+	require.NoError(t, err)
+	assert.Zero(t, got.Balance, "the deposit is rolled back with the withdrawal")
+}
+
+func TestWalletService_Transfer_Invalid(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet := newWallet(t, svc, 10)
+
+	_, _, err := svc.Transfer(ctx, wallet.ID, wallet.ID, 1)
+	assert.ErrorIs(t, err, service.ErrInvalidTransfer)
+
+	_, _, err = svc.Transfer(ctx, wallet.ID, uuid.New(), 0)
+	assert.ErrorIs(t, err, service.ErrInvalidTransfer)
+
+	_, _, err = svc.Transfer(ctx, wallet.ID, uuid.New(), 1)
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+}
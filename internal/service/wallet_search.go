@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+)
+
+var (
+	ErrInvalidWallet       = errors.New("invalid wallet")
+	ErrInvalidWalletSearch = errors.New("invalid wallet search")
+)
+
+const (
+	// NoCurrency is the ISO 4217 code of wallets created without a currency.
+	NoCurrency = "XXX"
+
+	MaxWalletLabels   = 32
+	MaxWalletMetadata = 4096
+)
+
+var (
+	currencyPattern   = regexp.MustCompile(`^[A-Z]{3}$`)
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{0,63}$`)
+)
+
+// Sort keys of SearchWallets.
+const (
+	SortByID        = "id"
+	SortByBalance   = "balance"
+	SortByCreatedAt = "created_at"
+)
+
+// NewWallet describes a wallet to open. Empty fields take their defaults: no
+// currency, no metadata and no labels.
+type NewWallet struct {
+	Currency       string
+	InitialBalance int32
+	Metadata       json.RawMessage
+	Labels         map[string]string
+}
+
+// WalletDetails changes the descriptive fields of a wallet. A nil field is
+// left as it is; labels are replaced as a whole.
+type WalletDetails struct {
+	Metadata json.RawMessage
+	Labels   map[string]string
+}
+
+// LabelSelector selects wallets by their labels. It is written like a
+// Kubernetes equality-based selector: "env=prod,tier!=gold,vip,!closed"
+// selects wallets labelled env=prod, without tier=gold, with a vip label
+// and without a closed one.
+type LabelSelector struct {
+	Match   map[string]string
+	Not     map[string]string
+	Has     []string
+	Missing []string
+}
+
+// ParseLabelSelector parses the written form of a LabelSelector. An empty
+// string selects every wallet.
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	var sel LabelSelector
+	seen := make(map[string]bool)
+
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var key, value string
+		var add func()
+		switch {
+		case strings.Contains(term, "!="):
+			key, value, _ = strings.Cut(term, "!=")
+			add = func() { sel.Not = setLabel(sel.Not, key, value) }
+		case strings.Contains(term, "="):
+			key, value, _ = strings.Cut(term, "=")
+			add = func() { sel.Match = setLabel(sel.Match, key, value) }
+		case strings.HasPrefix(term, "!"):
+			key = term[1:]
+			add = func() { sel.Missing = append(sel.Missing, key) }
+		default:
+			key = term
+			add = func() { sel.Has = append(sel.Has, key) }
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := checkLabel(key, value); err != nil {
+			return LabelSelector{}, fmt.Errorf("%w: %w", ErrInvalidWalletSearch, err)
+		}
+		if seen[key] {
+			return LabelSelector{}, fmt.Errorf("%w: label %q is selected twice", ErrInvalidWalletSearch, key)
+		}
+		seen[key] = true
+
+		add()
+	}
+
+	return sel, nil
+}
+
+func setLabel(labels map[string]string, key, value string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[key] = value
+	return labels
+}
+
+func checkLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	if !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("invalid value %q of label %q", value, key)
+	}
+	return nil
+}
+
+// WalletSearch filters and orders wallets. Zero fields do not filter; the
+// balance bounds are inclusive and the creation period is [CreatedFrom,
+// CreatedTo). Balances are those of the wallets rows: credits to shards not
+// yet folded into them are not taken into account.
+type WalletSearch struct {
+	Status      models.WalletStatus
+	Currency    string
+	Labels      LabelSelector
+	MinBalance  *int32
+	MaxBalance  *int32
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// SortBy is one of the SortBy constants, SortByID by default.
+	SortBy     string
+	Descending bool
+	// AfterID is the last wallet of the previous page.
+	AfterID uuid.UUID
+	Limit   int32
+}
+
+// OpenWallet creates a wallet, recording a non-zero initial balance as a
+// deposit.
+func (s *WalletService) OpenWallet(ctx context.Context, w NewWallet) (repository.Wallet, error) {
+	currency := strings.ToUpper(w.Currency)
+	if currency != "" && !currencyPattern.MatchString(currency) {
+		return repository.Wallet{}, fmt.Errorf("%w: invalid currency %q", ErrInvalidWallet, w.Currency)
+	}
+
+	metadata, labels, err := encodeWalletDetails(WalletDetails{Metadata: w.Metadata, Labels: w.Labels})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	var wallet repository.Wallet
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+
+		wallet, err = repo.CreateWallet(ctx, repository.CreateWalletParams{
+			Currency: currency,
+			Metadata: metadata,
+			Labels:   labels,
+		})
+		if err != nil {
+			return err
+		}
+
+		if w.InitialBalance != 0 {
+			if wallet, err = applyOperation(ctx, repo, wallet.ID, w.InitialBalance); err != nil {
+				return err
+			}
+		}
+
+		return recordAudit(ctx, repo, models.AuditActionWalletCreate, repository.Wallet{ID: wallet.ID}, wallet)
+	})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// SetWalletDetails changes the metadata and labels of a wallet.
+func (s *WalletService) SetWalletDetails(ctx context.Context, id uuid.UUID, details WalletDetails) (repository.Wallet, error) {
+	metadata, labels, err := encodeWalletDetails(details)
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	defer s.WalletChanged(id)
+
+	var wallet repository.Wallet
+
+	err = s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var before repository.Wallet
+		if _, ok := auditing(ctx); ok {
+			var err error
+			if before, err = repo.GetWalletByIDForUpdate(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if wallet, err = repo.SetWalletDetails(ctx, repository.SetWalletDetailsParams{
+			ID:       id,
+			Metadata: metadata,
+			Labels:   labels,
+		}); err != nil {
+			return err
+		}
+
+		if wallet, err = sumWalletShards(ctx, repo, wallet); err != nil {
+			return err
+		}
+
+		before.Balance, before.ShardCount = wallet.Balance, wallet.ShardCount
+		return recordAudit(ctx, repo, models.AuditActionDetailsChange, before, wallet)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// encodeWalletDetails checks details and encodes them as their columns,
+// leaving nil fields nil.
+func encodeWalletDetails(details WalletDetails) (metadata, labels json.RawMessage, err error) {
+	if details.Metadata != nil {
+		if len(details.Metadata) > MaxWalletMetadata {
+			return nil, nil, fmt.Errorf("%w: metadata exceeds %d bytes", ErrInvalidWallet, MaxWalletMetadata)
+		}
+
+		var object map[string]any
+		if err := json.Unmarshal(details.Metadata, &object); err != nil || object == nil {
+			return nil, nil, fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidWallet)
+		}
+		metadata = details.Metadata
+	}
+
+	if details.Labels != nil {
+		if len(details.Labels) > MaxWalletLabels {
+			return nil, nil, fmt.Errorf("%w: more than %d labels", ErrInvalidWallet, MaxWalletLabels)
+		}
+
+		for key, value := range details.Labels {
+			if err := checkLabel(key, value); err != nil {
+				return nil, nil, fmt.Errorf("%w: %w", ErrInvalidWallet, err)
+			}
+		}
+
+		if labels, err = json.Marshal(details.Labels); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return metadata, labels, nil
+}
+
+// SearchWallets returns a page of the wallets matching search, with their
+// total balances.
+func (s *WalletService) SearchWallets(ctx context.Context, search WalletSearch) ([]repository.Wallet, error) {
+	arg := SearchWalletsParams{
+		Status:        string(search.Status),
+		Currency:      strings.ToUpper(search.Currency),
+		LabelsHas:     nonNilStrings(search.Labels.Has),
+		LabelsMissing: nonNilStrings(search.Labels.Missing),
+		MinBalance:    math.MinInt32,
+		MaxBalance:    math.MaxInt32,
+		CreatedFrom:   search.CreatedFrom,
+		CreatedTo:     search.CreatedTo,
+		SortBy:        search.SortBy,
+		Descending:    search.Descending,
+		AfterID:       search.AfterID,
+		PageSize:      search.Limit,
+	}
+
+	switch search.Status {
+	case "", models.WalletStatusActive, models.WalletStatusFrozen:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidWalletSearch, search.Status)
+	}
+
+	if arg.Currency != "" && !currencyPattern.MatchString(arg.Currency) {
+		return nil, fmt.Errorf("%w: invalid currency %q", ErrInvalidWalletSearch, search.Currency)
+	}
+
+	switch arg.SortBy {
+	case "":
+		arg.SortBy = SortByID
+	case SortByID, SortByBalance, SortByCreatedAt:
+	default:
+		return nil, fmt.Errorf("%w: unknown sort key %q", ErrInvalidWalletSearch, search.SortBy)
+	}
+
+	if search.MinBalance != nil {
+		arg.MinBalance = *search.MinBalance
+	}
+	if search.MaxBalance != nil {
+		arg.MaxBalance = *search.MaxBalance
+	}
+	if arg.MinBalance > arg.MaxBalance {
+		return nil, fmt.Errorf("%w: minimum balance is above the maximum", ErrInvalidWalletSearch)
+	}
+
+	if arg.CreatedTo.IsZero() {
+		arg.CreatedTo = endOfTime
+	}
+	if !arg.CreatedFrom.Before(arg.CreatedTo) {
+		return nil, fmt.Errorf("%w: createdFrom must be before createdTo", ErrInvalidWalletSearch)
+	}
+
+	var err error
+	if arg.LabelsMatch, err = encodeSelectorLabels(search.Labels.Match); err != nil {
+		return nil, err
+	}
+	if arg.LabelsNot, err = encodeSelectorLabels(search.Labels.Not); err != nil {
+		return nil, err
+	}
+
+	wallets, err := s.repo.SearchWallets(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range wallets {
+		if wallets[i], err = sumWalletShards(ctx, s.repo, wallets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return wallets, nil
+}
+
+// endOfTime bounds searches without an end: the largest timestamptz is in
+// the year 294276.
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+func encodeSelectorLabels(labels map[string]string) (json.RawMessage, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(labels)
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return slices.Clone(s)
+}
@@ -0,0 +1,160 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/memory"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/kuzmindeniss/itk/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	sel, err := service.ParseLabelSelector(" env=prod, tier!=gold,vip,!closed,region= ")
+	require.NoError(t, err)
+	assert.Equal(t, service.LabelSelector{
+		Match:   map[string]string{"env": "prod", "region": ""},
+		Not:     map[string]string{"tier": "gold"},
+		Has:     []string{"vip"},
+		Missing: []string{"closed"},
+	}, sel)
+
+	sel, err = service.ParseLabelSelector("")
+	require.NoError(t, err)
+	assert.Equal(t, service.LabelSelector{}, sel)
+
+	for _, s := range []string{"=prod", "env=pr od", "!", "env=prod,env!=test", "-env", "env==prod"} {
+		_, err := service.ParseLabelSelector(s)
+		assert.ErrorIs(t, err, service.ErrInvalidWalletSearch, s)
+	}
+}
+
+func TestWalletService_OpenWallet(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet, err := svc.OpenWallet(ctx, service.NewWallet{
+		Currency:       "eur",
+		InitialBalance: 50,
+		Metadata:       json.RawMessage(`{"note": "savings"}`),
+		Labels:         map[string]string{"env": "prod"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", wallet.Currency)
+	assert.Equal(t, int32(50), wallet.Balance)
+	assert.JSONEq(t, `{"note": "savings"}`, string(wallet.Metadata))
+	assert.JSONEq(t, `{"env": "prod"}`, string(wallet.Labels))
+
+	wallet, err = svc.OpenWallet(ctx, service.NewWallet{})
+	require.NoError(t, err)
+	assert.Equal(t, service.NoCurrency, wallet.Currency)
+
+	tooMany := make(map[string]string)
+	for i := range service.MaxWalletLabels + 1 {
+		tooMany[uuid.NewString()[:8]+string(rune('a'+i%26))] = ""
+	}
+
+	for name, w := range map[string]service.NewWallet{
+		"currency":       {Currency: "EURO"},
+		"metadata array": {Metadata: json.RawMessage(`[1]`)},
+		"metadata null":  {Metadata: json.RawMessage(`null`)},
+		"large metadata": {Metadata: json.RawMessage(`{"note": "` + string(make([]byte, service.MaxWalletMetadata)) + `"}`)},
+		"label key":      {Labels: map[string]string{"env prod": ""}},
+		"label value":    {Labels: map[string]string{"env": "pr/od"}},
+		"many labels":    {Labels: tooMany},
+	} {
+		_, err := svc.OpenWallet(ctx, w)
+		assert.ErrorIs(t, err, service.ErrInvalidWallet, name)
+	}
+}
+
+func TestWalletService_SetWalletDetails(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	wallet, err := svc.OpenWallet(ctx, service.NewWallet{
+		Metadata: json.RawMessage(`{"note": "savings"}`),
+		Labels:   map[string]string{"env": "prod"},
+	})
+	require.NoError(t, err)
+
+	wallet, err = svc.SetWalletDetails(ctx, wallet.ID, service.WalletDetails{Labels: map[string]string{"tier": "gold"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"note": "savings"}`, string(wallet.Metadata))
+	assert.JSONEq(t, `{"tier": "gold"}`, string(wallet.Labels))
+
+	wallet, err = svc.SetWalletDetails(ctx, wallet.ID, service.WalletDetails{Metadata: json.RawMessage(`{}`), Labels: map[string]string{}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(wallet.Metadata))
+	assert.JSONEq(t, `{}`, string(wallet.Labels))
+
+	_, err = svc.SetWalletDetails(ctx, uuid.New(), service.WalletDetails{Labels: map[string]string{}})
+	assert.ErrorIs(t, err, service.ErrWalletNotFound)
+
+	_, err = svc.SetWalletDetails(ctx, wallet.ID, service.WalletDetails{Metadata: json.RawMessage(`"note"`)})
+	assert.ErrorIs(t, err, service.ErrInvalidWallet)
+}
+
+func TestWalletService_SearchWallets(t *testing.T) {
+	svc := service.NewWalletService(memory.NewStore())
+	ctx := context.Background()
+
+	open := func(currency string, balance int32, labels map[string]string) uuid.UUID {
+		t.Helper()
+
+		wallet, err := svc.OpenWallet(ctx, service.NewWallet{Currency: currency, InitialBalance: balance, Labels: labels})
+		require.NoError(t, err)
+		return wallet.ID
+	}
+
+	gold := open("EUR", 300, map[string]string{"env": "prod", "tier": "gold"})
+	silver := open("EUR", 100, map[string]string{"env": "prod", "tier": "silver"})
+	usd := open("USD", 200, map[string]string{"env": "prod"})
+	open("EUR", 50, map[string]string{"env": "test"})
+
+	_, err := svc.SetWalletShards(ctx, silver, 2)
+	require.NoError(t, err)
+	_, err = svc.ChangeWalletBalance(ctx, silver, 10)
+	require.NoError(t, err)
+
+	selector, err := service.ParseLabelSelector("env=prod,tier")
+	require.NoError(t, err)
+
+	wallets, err := svc.SearchWallets(ctx, service.WalletSearch{
+		Currency:   "eur",
+		Labels:     selector,
+		SortBy:     service.SortByBalance,
+		Descending: true,
+		Limit:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, wallets, 2)
+	assert.Equal(t, gold, wallets[0].ID)
+	assert.Equal(t, silver, wallets[1].ID)
+	assert.Equal(t, int32(110), wallets[1].Balance, "the balance includes the shards")
+
+	minBalance, maxBalance := int32(150), int32(250)
+	wallets, err = svc.SearchWallets(ctx, service.WalletSearch{MinBalance: &minBalance, MaxBalance: &maxBalance, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, wallets, 1)
+	assert.Equal(t, usd, wallets[0].ID)
+
+	wallets, err = svc.SearchWallets(ctx, service.WalletSearch{Status: models.WalletStatusFrozen, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, wallets)
+
+	for name, search := range map[string]service.WalletSearch{
+		"status":   {Status: "CLOSED"},
+		"currency": {Currency: "EURO"},
+		"sort":     {SortBy: "name"},
+		"balance":  {MinBalance: &maxBalance, MaxBalance: &minBalance},
+	} {
+		search.Limit = 10
+		_, err := svc.SearchWallets(ctx, search)
+		assert.ErrorIs(t, err, service.ErrInvalidWalletSearch, name)
+	}
+}
@@ -2,38 +2,394 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
 )
 
-type WalletRepositoryInterface interface {
-	GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error)
-	UpdateWallet(ctx context.Context, arg repository.UpdateWalletParams) (repository.Wallet, error)
-}
-
 type WalletServiceInterface interface {
 	GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error)
-	TopUpWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (repository.Wallet, error)
+	ChangeWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (BalanceChange, error)
+	WaitForVersion(ctx context.Context, id uuid.UUID, version int64) (repository.Wallet, error)
+	WriteStatement(ctx context.Context, id uuid.UUID, from, to time.Time, w StatementWriter) error
+	ListOwnerWallets(ctx context.Context, ownerID, afterID uuid.UUID, limit int32) ([]repository.Wallet, error)
+	OpenWallet(ctx context.Context, w NewWallet) (repository.Wallet, error)
+	SetWalletDetails(ctx context.Context, id uuid.UUID, details WalletDetails) (repository.Wallet, error)
+	SearchWallets(ctx context.Context, search WalletSearch) ([]repository.Wallet, error)
+	ReverseOperation(ctx context.Context, id uuid.UUID, amount int32) (Reversal, error)
 }
 
 type WalletService struct {
-	repo WalletRepositoryInterface
+	repo     WalletRepositoryInterface
+	batcher  *walletBatcher
+	cache    *walletCache
+	watchers *walletWatchers
+
+	// dayCount and rounding are the default interest conventions.
+	dayCount models.DayCount
+	rounding models.Rounding
+
+	// feeWalletID collects the fees; fees are charged only when it is set.
+	feeWalletID uuid.UUID
+
+	// quoteTTL, spreadBps and exchangeRounding price currency conversions.
+	quoteTTL         time.Duration
+	spreadBps        int32
+	exchangeRounding models.Rounding
+}
+
+type Option func(s *WalletService)
+
+// WithBatching coalesces concurrent balance changes of the same wallet into
+// a single transaction of at most maxBatchSize operations.
+func WithBatching(maxBatchSize int) Option {
+	return func(s *WalletService) {
+		s.batcher = newWalletBatcher(maxBatchSize, s.applyBatch)
+	}
+}
+
+func NewWalletService(repo WalletRepositoryInterface, opts ...Option) *WalletService {
+	s := &WalletService{
+		repo:     repo,
+		watchers: newWalletWatchers(),
+		dayCount: models.DayCountAct365,
+		rounding: models.RoundingHalfEven,
+
+		quoteTTL:         DefaultQuoteTTL,
+		spreadBps:        DefaultSpreadBps,
+		exchangeRounding: models.RoundingDown,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+var errDryRun = errors.New("dry run")
+
+// DryRun calls fn with a service bound to a transaction that is always rolled
+// back, so fn can show the outcome of writes without committing them.
+func (s *WalletService) DryRun(ctx context.Context, fn func(svc *WalletService) error) error {
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		if err := fn(s.withRepo(repo)); err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
 }
 
-func NewWalletService(repo WalletRepositoryInterface) *WalletService {
+// withRepo returns a service with the same settings bound to repo, usually a
+// transaction. It neither batches, caches nor notifies watchers.
+func (s *WalletService) withRepo(repo WalletRepositoryInterface) *WalletService {
 	return &WalletService{
-		repo: repo,
+		repo:        repo,
+		dayCount:    s.dayCount,
+		rounding:    s.rounding,
+		feeWalletID: s.feeWalletID,
+
+		quoteTTL:         s.quoteTTL,
+		spreadBps:        s.spreadBps,
+		exchangeRounding: s.exchangeRounding,
 	}
 }
 
+// GetWalletByID returns the wallet with its total balance, including the
+// shards of a sharded wallet.
 func (s *WalletService) GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
-	return s.repo.GetWalletByID(ctx, id)
+	if s.cache == nil || isConsistent(ctx) {
+		return s.loadWallet(ctx, id)
+	}
+
+	// The cache is shared by all tenants.
+	wallet, generation, ok := s.cache.get(id)
+	if ok {
+		if !visibleTo(ctx, wallet) {
+			return repository.Wallet{}, ErrWalletNotFound
+		}
+		return wallet, nil
+	}
+
+	wallet, err := s.loadWallet(FromPrimary(ctx), id)
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	s.cache.put(wallet, generation)
+
+	return wallet, nil
 }
 
+func (s *WalletService) loadWallet(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	return readWallet(ctx, s.repo, id)
+}
+
+// readWallet reads the wallet and its shards in one statement: read apart,
+// a concurrent fold could be counted twice or not at all.
+func readWallet(ctx context.Context, repo ShardStore, id uuid.UUID) (repository.Wallet, error) {
+	row, err := repo.GetWalletWithShards(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return withShards(row.Wallet, repository.SumWalletShardsRow{Balance: row.ShardsBalance, Version: row.ShardsVersion})
+}
+
+func (s *WalletService) CreateWallet(ctx context.Context, initialBalance int32) (repository.Wallet, error) {
+	return s.OpenWallet(ctx, NewWallet{InitialBalance: initialBalance})
+}
+
+func (s *WalletService) ListWallets(ctx context.Context, afterID uuid.UUID, limit int32) ([]repository.Wallet, error) {
+	wallets, err := s.repo.ListWallets(ctx, repository.ListWalletsParams{
+		AfterID:  afterID,
+		PageSize: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range wallets {
+		if wallets[i], err = sumWalletShards(ctx, s.repo, wallets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return wallets, nil
+}
+
+// BalanceChange is a wallet after a balance change with the fee charged for
+// it, which is already included in the balance.
+type BalanceChange struct {
+	Wallet repository.Wallet
+	Fee    int32
+}
+
+// TopUpWalletBalance changes the balance and records the operation in the
+// same transaction, so the operations ledger always sums to the balance.
+// With batching enabled that transaction may be shared with concurrent calls
+// for the same wallet.
 func (s *WalletService) TopUpWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (repository.Wallet, error) {
-	return s.repo.UpdateWallet(ctx, repository.UpdateWalletParams{
-		ID:     id,
-		Amount: amount,
+	change, err := s.ChangeWalletBalance(ctx, id, amount)
+	return change.Wallet, err
+}
+
+// ChangeWalletBalance is TopUpWalletBalance that also reports the fee. The
+// fee is charged in the same transaction as a separate FEE operation and
+// credited to the fee wallet.
+func (s *WalletService) ChangeWalletBalance(ctx context.Context, id uuid.UUID, amount int32) (BalanceChange, error) {
+	defer s.WalletChanged(id)
+
+	if s.batcher != nil {
+		return s.submitBatched(ctx, id, amount)
+	}
+
+	var change BalanceChange
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var err error
+		if change, err = s.applyCharged(ctx, repo, id, amount); err != nil {
+			return err
+		}
+
+		before := change.Wallet
+		before.Balance -= amount - change.Fee
+		return recordAudit(ctx, repo, models.AuditActionBalanceChange, before, change.Wallet)
+	})
+	if err != nil {
+		return BalanceChange{}, err
+	}
+
+	if change.Fee > 0 {
+		s.WalletChanged(s.feeWalletID)
+	}
+
+	return change, nil
+}
+
+func (s *WalletService) submitBatched(ctx context.Context, id uuid.UUID, amount int32) (BalanceChange, error) {
+	res := s.batcher.submit(ctx, id, amount)
+	if res.err != nil {
+		return BalanceChange{}, res.err
+	}
+
+	if res.fee > 0 {
+		s.WalletChanged(s.feeWalletID)
+	}
+
+	return BalanceChange{Wallet: res.wallet, Fee: res.fee}, nil
+}
+
+// applyCharged applies amount and the fee it is charged.
+func (s *WalletService) applyCharged(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, amount int32) (BalanceChange, error) {
+	fee, err := s.walletFee(ctx, repo, id, operationTypeFor(amount), amount)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+
+	wallet, err := applyOperation(ctx, repo, id, amount)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	if fee == 0 {
+		return BalanceChange{Wallet: wallet}, nil
+	}
+
+	if wallet, err = s.chargeFee(ctx, repo, id, fee); err != nil {
+		return BalanceChange{}, err
+	}
+
+	return BalanceChange{Wallet: wallet, Fee: fee}, nil
+}
+
+func (s *WalletService) SetWalletStatus(ctx context.Context, id uuid.UUID, status models.WalletStatus) (repository.Wallet, error) {
+	defer s.WalletChanged(id)
+
+	var wallet repository.Wallet
+
+	err := s.repo.ExecTx(ctx, func(repo WalletRepositoryInterface) error {
+		var before repository.Wallet
+		if _, ok := auditing(ctx); ok {
+			var err error
+			if before, err = repo.GetWalletByIDForUpdate(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		wallet, err = repo.SetWalletStatus(ctx, repository.SetWalletStatusParams{
+			ID:     id,
+			Status: string(status),
+		})
+		if err != nil {
+			return err
+		}
+
+		if wallet, err = sumWalletShards(ctx, repo, wallet); err != nil {
+			return err
+		}
+
+		before.Balance, before.ShardCount = wallet.Balance, wallet.ShardCount
+		return recordAudit(ctx, repo, models.AuditActionStatusChange, before, wallet)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Wallet{}, ErrWalletNotFound
+	}
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// GetWalletHistory returns the latest operations of a wallet, newest first.
+func (s *WalletService) GetWalletHistory(ctx context.Context, id uuid.UUID, limit int32) ([]repository.Operation, error) {
+	if _, err := s.GetWalletByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListWalletOperations(ctx, repository.ListWalletOperationsParams{
+		WalletID: id,
+		Limit:    limit,
 	})
 }
+
+// ListOperationsPage returns operations in creation order after the given
+// cursor. A zero WalletID lists operations of all wallets.
+func (s *WalletService) ListOperationsPage(ctx context.Context, arg repository.ListOperationsPageParams) ([]repository.Operation, error) {
+	return s.repo.ListOperationsPage(ctx, arg)
+}
+
+func applyOperation(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, amount int32) (repository.Wallet, error) {
+	return applyOperationAs(ctx, repo, id, operationTypeFor(amount), amount)
+}
+
+// applyOperationAs changes the balance by amount, records it as an operation
+// of type opType and books it in the journal against the counter account of
+// opType.
+func applyOperationAs(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, opType models.OperationType, amount int32) (repository.Wallet, error) {
+	return applyBooked(ctx, repo, id, opType, amount, counterAccount(opType))
+}
+
+// applyBooked is applyOperationAs booking against account.
+func applyBooked(ctx context.Context, repo WalletRepositoryInterface, id uuid.UUID, opType models.OperationType, amount int32, account models.JournalAccount) (repository.Wallet, error) {
+	wallet, _, err := applyRecorded(ctx, repo, repository.CreateOperationParams{
+		WalletID:      id,
+		OperationType: string(opType),
+		Amount:        amount,
+	})
+	if err != nil {
+		return repository.Wallet{}, err
+	}
+
+	if err := bookOperation(ctx, repo, id, opType, amount, account); err != nil {
+		return repository.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// applyRecorded changes the balance of op.WalletID by op.Amount and records
+// op, returning the wallet and the operation created. The caller books it.
+func applyRecorded(ctx context.Context, repo WalletRepositoryInterface, op repository.CreateOperationParams) (repository.Wallet, repository.Operation, error) {
+	wallet, err := repo.UpdateWallet(ctx, repository.UpdateWalletParams{
+		ID:     op.WalletID,
+		Amount: op.Amount,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// UpdateWallet matched no row: the wallet is missing, frozen,
+		// sharded, or the withdrawal exceeds its balance.
+		current, err := repo.GetWalletByID(ctx, op.WalletID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repository.Wallet{}, repository.Operation{}, ErrWalletNotFound
+		}
+		if err != nil {
+			return repository.Wallet{}, repository.Operation{}, err
+		}
+
+		if err := checkWalletActive(current); err != nil {
+			return repository.Wallet{}, repository.Operation{}, err
+		}
+
+		if current.ShardCount > 0 {
+			return applyShardedOperation(ctx, repo, current, op)
+		}
+
+		return repository.Wallet{}, repository.Operation{}, ErrInsufficientFunds
+	}
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	recorded, err := repo.CreateOperation(ctx, op)
+	if err != nil {
+		return repository.Wallet{}, repository.Operation{}, err
+	}
+
+	return wallet, recorded, nil
+}
+
+func checkWalletActive(wallet repository.Wallet) error {
+	if wallet.Status == string(models.WalletStatusFrozen) {
+		return ErrWalletFrozen
+	}
+	return nil
+}
+
+func operationTypeFor(amount int32) models.OperationType {
+	if amount < 0 {
+		return models.OperationWithdraw
+	}
+	return models.OperationDeposit
+}
@@ -6,13 +6,27 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// MockRepository mocks the stores the service tests set expectations on; the
+// others are nil.
 type MockRepository struct {
 	mock.Mock
+	WalletStore
+	OperationStore
+	JournalStore
+	ScheduleStore
+	InterestStore
+	FeeStore
+	ImportStore
+	AuditStore
+	TenantStore
+	ExchangeStore
 }
 
 func (m *MockRepository) GetWalletByID(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
@@ -20,11 +34,109 @@ func (m *MockRepository) GetWalletByID(ctx context.Context, id uuid.UUID) (repos
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
+func (m *MockRepository) GetWalletByIDForUpdate(ctx context.Context, id uuid.UUID) (repository.Wallet, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockRepository) CreateWallet(ctx context.Context, arg repository.CreateWalletParams) (repository.Wallet, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockRepository) SetWalletBalance(ctx context.Context, arg repository.SetWalletBalanceParams) (repository.Wallet, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockRepository) SetWalletShardCount(ctx context.Context, arg repository.SetWalletShardCountParams) (repository.Wallet, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockRepository) CreateWalletShards(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreditWalletShard(ctx context.Context, arg repository.CreditWalletShardParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) SumWalletShards(ctx context.Context, walletID uuid.UUID) (repository.SumWalletShardsRow, error) {
+	args := m.Called(ctx, walletID)
+	return args.Get(0).(repository.SumWalletShardsRow), args.Error(1)
+}
+
+func (m *MockRepository) GetWalletWithShards(ctx context.Context, id uuid.UUID) (repository.GetWalletWithShardsRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.GetWalletWithShardsRow), args.Error(1)
+}
+
+func (m *MockRepository) LockWalletShards(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, walletID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) ResetWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	args := m.Called(ctx, walletID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteWalletShards(ctx context.Context, walletID uuid.UUID) error {
+	args := m.Called(ctx, walletID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetWalletStatus(ctx context.Context, arg repository.SetWalletStatusParams) (repository.Wallet, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.Wallet), args.Error(1)
+}
+
+func (m *MockRepository) ListWalletOperations(ctx context.Context, arg repository.ListWalletOperationsParams) ([]repository.Operation, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]repository.Operation), args.Error(1)
+}
+
 func (m *MockRepository) UpdateWallet(ctx context.Context, arg repository.UpdateWalletParams) (repository.Wallet, error) {
 	args := m.Called(ctx, arg)
 	return args.Get(0).(repository.Wallet), args.Error(1)
 }
 
+func (m *MockRepository) CreateOperation(ctx context.Context, arg repository.CreateOperationParams) (repository.Operation, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.Operation), args.Error(1)
+}
+
+func (m *MockRepository) CreateOperations(ctx context.Context, arg []repository.CreateOperationsParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) CreateJournalEntry(ctx context.Context, arg repository.CreateJournalEntryParams) (repository.CreateJournalEntryRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repository.CreateJournalEntryRow), args.Error(1)
+}
+
+func (m *MockRepository) GetTrialBalance(ctx context.Context) ([]repository.GetTrialBalanceRow, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repository.GetTrialBalanceRow), args.Error(1)
+}
+
+func (m *MockRepository) ListWalletJournalMismatches(ctx context.Context, maxRows int32) ([]repository.ListWalletJournalMismatchesRow, error) {
+	args := m.Called(ctx, maxRows)
+	return args.Get(0).([]repository.ListWalletJournalMismatchesRow), args.Error(1)
+}
+
+func (m *MockRepository) ExecTx(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error {
+	return fn(m)
+}
+
+func (m *MockRepository) ExecSnapshot(ctx context.Context, fn func(repo WalletRepositoryInterface) error) error {
+	return fn(m)
+}
+
 func TestWalletService_GetWalletByID_Success(t *testing.T) {
 	mockRepo := new(MockRepository)
 	service := NewWalletService(mockRepo)
@@ -36,7 +148,7 @@ func TestWalletService_GetWalletByID_Success(t *testing.T) {
 		Balance: 1000,
 	}
 
-	mockRepo.On("GetWalletByID", ctx, walletID).Return(expectedWallet, nil)
+	mockRepo.On("GetWalletWithShards", ctx, walletID).Return(repository.GetWalletWithShardsRow{Wallet: expectedWallet}, nil)
 
 	result, err := service.GetWalletByID(ctx, walletID)
 
@@ -55,7 +167,7 @@ func TestWalletService_GetWalletByID_Error(t *testing.T) {
 	walletID := uuid.New()
 	expectedError := errors.New("wallet not found")
 
-	mockRepo.On("GetWalletByID", ctx, walletID).Return(repository.Wallet{}, expectedError)
+	mockRepo.On("GetWalletWithShards", ctx, walletID).Return(repository.GetWalletWithShardsRow{}, expectedError)
 
 	result, err := service.GetWalletByID(ctx, walletID)
 
@@ -85,6 +197,13 @@ func TestWalletService_TopUpWalletBalance_Success(t *testing.T) {
 	}
 
 	mockRepo.On("UpdateWallet", ctx, expectedParams).Return(expectedWallet, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      walletID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        amount,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
 
 	result, err := service.TopUpWalletBalance(ctx, walletID, amount)
 
@@ -140,6 +259,13 @@ func TestWalletService_TopUpWalletBalance_Withdraw(t *testing.T) {
 	}
 
 	mockRepo.On("UpdateWallet", ctx, expectedParams).Return(expectedWallet, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      walletID,
+		OperationType: string(models.OperationWithdraw),
+		Amount:        amount,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
 
 	result, err := service.TopUpWalletBalance(ctx, walletID, amount)
 
@@ -149,3 +275,231 @@ func TestWalletService_TopUpWalletBalance_Withdraw(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestWalletService_TopUpWalletBalance_OperationError(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+	amount := int32(500)
+
+	expectedParams := repository.UpdateWalletParams{
+		ID:     walletID,
+		Amount: amount,
+	}
+
+	expectedError := errors.New("insert operation failed")
+
+	mockRepo.On("UpdateWallet", ctx, expectedParams).Return(repository.Wallet{ID: walletID, Balance: 500}, nil)
+	mockRepo.On("CreateOperation", ctx, mock.AnythingOfType("repository.CreateOperationParams")).Return(repository.Operation{}, expectedError)
+
+	result, err := service.TopUpWalletBalance(ctx, walletID, amount)
+
+	assert.Error(t, err)
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, repository.Wallet{}, result)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_GetWalletByID_NotFound(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("GetWalletWithShards", ctx, walletID).Return(repository.GetWalletWithShardsRow{}, pgx.ErrNoRows)
+
+	_, err := service.GetWalletByID(ctx, walletID)
+
+	assert.ErrorIs(t, err, ErrWalletNotFound)
+}
+
+func TestWalletService_TopUpWalletBalance_Rejected(t *testing.T) {
+	walletID := uuid.New()
+
+	testCases := []struct {
+		name     string
+		wallet   repository.Wallet
+		getErr   error
+		expected error
+	}{
+		{"not found", repository.Wallet{}, pgx.ErrNoRows, ErrWalletNotFound},
+		{"frozen", repository.Wallet{ID: walletID, Balance: 1000, Status: string(models.WalletStatusFrozen)}, nil, ErrWalletFrozen},
+		{"insufficient funds", repository.Wallet{ID: walletID, Balance: 100, Status: string(models.WalletStatusActive)}, nil, ErrInsufficientFunds},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			service := NewWalletService(mockRepo)
+
+			ctx := context.Background()
+			amount := int32(-300)
+
+			mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: walletID, Amount: amount}).Return(repository.Wallet{}, pgx.ErrNoRows)
+			mockRepo.On("GetWalletByID", ctx, walletID).Return(tc.wallet, tc.getErr)
+
+			result, err := service.TopUpWalletBalance(ctx, walletID, amount)
+
+			assert.ErrorIs(t, err, tc.expected)
+			assert.Equal(t, repository.Wallet{}, result)
+
+			mockRepo.AssertExpectations(t)
+			mockRepo.AssertNotCalled(t, "CreateOperation", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestWalletService_CreateWallet_InitialBalance(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("CreateWallet", ctx, repository.CreateWalletParams{}).Return(repository.Wallet{ID: walletID}, nil)
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: walletID, Amount: 250}).
+		Return(repository.Wallet{ID: walletID, Balance: 250}, nil)
+	mockRepo.On("CreateOperation", ctx, repository.CreateOperationParams{
+		WalletID:      walletID,
+		OperationType: string(models.OperationDeposit),
+		Amount:        250,
+	}).Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
+
+	result, err := service.CreateWallet(ctx, 250)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(250), result.Balance)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_SetWalletStatus_NotFound(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("SetWalletStatus", ctx, repository.SetWalletStatusParams{ID: walletID, Status: string(models.WalletStatusFrozen)}).
+		Return(repository.Wallet{}, pgx.ErrNoRows)
+
+	_, err := service.SetWalletStatus(ctx, walletID, models.WalletStatusFrozen)
+
+	assert.ErrorIs(t, err, ErrWalletNotFound)
+}
+
+func TestWalletService_GetWalletHistory(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+	operations := []repository.Operation{{WalletID: walletID, Amount: 100}}
+
+	mockRepo.On("GetWalletWithShards", ctx, walletID).Return(repository.GetWalletWithShardsRow{Wallet: repository.Wallet{ID: walletID}}, nil)
+	mockRepo.On("ListWalletOperations", ctx, repository.ListWalletOperationsParams{WalletID: walletID, Limit: 20}).
+		Return(operations, nil)
+
+	result, err := service.GetWalletHistory(ctx, walletID, 20)
+
+	assert.NoError(t, err)
+	assert.Equal(t, operations, result)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_DryRun(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("UpdateWallet", ctx, repository.UpdateWalletParams{ID: walletID, Amount: 100}).
+		Return(repository.Wallet{ID: walletID, Balance: 100}, nil)
+	mockRepo.On("CreateOperation", ctx, mock.AnythingOfType("repository.CreateOperationParams")).
+		Return(repository.Operation{}, nil)
+	mockRepo.On("CreateJournalEntry", ctx, mock.AnythingOfType("repository.CreateJournalEntryParams")).
+		Return(repository.CreateJournalEntryRow{}, nil)
+
+	var result repository.Wallet
+	err := service.DryRun(ctx, func(tx *WalletService) error {
+		var err error
+		result, err = tx.TopUpWalletBalance(ctx, walletID, 100)
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(100), result.Balance)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_DryRun_Error(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	expectedError := errors.New("database error")
+
+	err := service.DryRun(context.Background(), func(tx *WalletService) error {
+		return expectedError
+	})
+
+	assert.Equal(t, expectedError, err)
+}
+
+func TestWalletService_TrialBalance_Off(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+
+	mockRepo.On("GetTrialBalance", ctx).Return([]repository.GetTrialBalanceRow{
+		{Currency: "EUR", Account: "cash_in", Debit: 100},
+		{Currency: "EUR", Account: "wallet", Credit: 100},
+		{Currency: "USD", Account: "cash_in", Debit: 100},
+		{Currency: "USD", Account: "wallet", Credit: 90},
+	}, nil)
+	mockRepo.On("ListWalletJournalMismatches", ctx, int32(maxWalletMismatches)).Return([]repository.ListWalletJournalMismatchesRow(nil), nil)
+
+	result, err := service.TrialBalance(ctx)
+
+	assert.ErrorIs(t, err, ErrTrialBalanceOff)
+	assert.False(t, result.Balanced())
+	assert.Len(t, result.Currencies, 2)
+	assert.Equal(t, result.Currencies[0].Debit, result.Currencies[0].Credit, "EUR balances, USD does not")
+	assert.Equal(t, int64(100), result.Currencies[1].Debit)
+	assert.Equal(t, int64(90), result.Currencies[1].Credit)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWalletService_TrialBalance_WalletOff(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewWalletService(mockRepo)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+
+	mockRepo.On("GetTrialBalance", ctx).Return([]repository.GetTrialBalanceRow{
+		{Account: "cash_in", Debit: 100},
+		{Account: "wallet", Credit: 100},
+	}, nil)
+	mockRepo.On("ListWalletJournalMismatches", ctx, int32(maxWalletMismatches)).Return([]repository.ListWalletJournalMismatchesRow{
+		{ID: walletID, Balance: 120, JournalBalance: 100},
+	}, nil)
+
+	result, err := service.TrialBalance(ctx)
+
+	assert.ErrorIs(t, err, ErrTrialBalanceOff, "the totals balance, but a wallet does not match its legs")
+	assert.False(t, result.Balanced())
+	assert.Equal(t, []WalletMismatch{{WalletID: walletID, Balance: 120, JournalBalance: 100}}, result.Mismatches)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+)
+
+// walletWatchers wakes up waiters of changed wallets. A wake-up only means
+// the wallet may have changed; waiters read it again to find out.
+type walletWatchers struct {
+	mu       sync.Mutex
+	watchers map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+func newWalletWatchers() *walletWatchers {
+	return &walletWatchers{watchers: make(map[uuid.UUID]map[chan struct{}]struct{})}
+}
+
+// subscribe returns a channel signalled after changes of the wallet. Signals
+// coalesce, so a slow reader sees one wake-up for many changes.
+func (w *walletWatchers) subscribe(id uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watchers[id] == nil {
+		w.watchers[id] = make(map[chan struct{}]struct{})
+	}
+	w.watchers[id][ch] = struct{}{}
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.watchers[id], ch)
+		if len(w.watchers[id]) == 0 {
+			delete(w.watchers, id)
+		}
+	}
+}
+
+func (w *walletWatchers) notify(id uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.watchers[id] {
+		wake(ch)
+	}
+}
+
+func (w *walletWatchers) notifyAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, chans := range w.watchers {
+		for ch := range chans {
+			wake(ch)
+		}
+	}
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// WalletChanged drops the cached wallet and wakes up its waiters. The
+// service reports its own writes; writes made elsewhere, e.g. by another
+// instance, must be reported by the caller.
+func (s *WalletService) WalletChanged(id uuid.UUID) {
+	if s.cache != nil {
+		s.cache.invalidate(id)
+	}
+	if s.watchers != nil {
+		s.watchers.notify(id)
+	}
+}
+
+// ChangesMissed is called when changes may have gone unreported, e.g. while
+// the change listener was reconnecting. Every wallet is treated as changed.
+func (s *WalletService) ChangesMissed() {
+	if s.cache != nil {
+		s.cache.flush()
+	}
+	if s.watchers != nil {
+		s.watchers.notifyAll()
+	}
+}
+
+// WaitForVersion returns the wallet once its version is greater than
+// version. With a negative version it returns the current wallet at once.
+// When ctx is done first, the latest wallet read is returned with ctx.Err().
+//
+// Wallets are read from the primary, bypassing the cache and replicas, so a
+// change that woke the waiter is never missed.
+func (s *WalletService) WaitForVersion(ctx context.Context, id uuid.UUID, version int64) (repository.Wallet, error) {
+	// Subscribe before reading, or a change between the read and the
+	// subscription would go unnoticed.
+	changed, unsubscribe := s.watchers.subscribe(id)
+	defer unsubscribe()
+
+	for {
+		wallet, err := s.loadWallet(FromPrimary(ctx), id)
+		if err != nil {
+			return repository.Wallet{}, err
+		}
+
+		if wallet.Version > version {
+			return wallet, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return wallet, ctx.Err()
+		case <-changed:
+		}
+	}
+}
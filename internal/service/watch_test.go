@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kuzmindeniss/itk/internal/db/repository"
+	"github.com/kuzmindeniss/itk/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletService_WaitForVersion(t *testing.T) {
+	wallet := repository.Wallet{ID: uuid.New(), Balance: 100, Status: string(models.WalletStatusActive)}
+	service := NewWalletService(newFakeRepository(0, wallet), WithCache(time.Minute, 10))
+
+	ctx := context.Background()
+
+	current, err := service.WaitForVersion(ctx, wallet.ID, -1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), current.Version)
+
+	done := make(chan repository.Wallet)
+	go func() {
+		changed, err := service.WaitForVersion(ctx, wallet.ID, current.Version)
+		assert.NoError(t, err)
+		done <- changed
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("WaitForVersion returned before the wallet changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = service.TopUpWalletBalance(ctx, wallet.ID, 50)
+	require.NoError(t, err)
+
+	select {
+	case changed := <-done:
+		assert.Equal(t, int32(150), changed.Balance)
+		assert.Equal(t, int64(1), changed.Version)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForVersion did not return after the wallet changed")
+	}
+}
+
+func TestWalletService_WaitForVersion_ChangedElsewhere(t *testing.T) {
+	wallet := repository.Wallet{ID: uuid.New(), Balance: 100, Status: string(models.WalletStatusActive)}
+	repo := newFakeRepository(0, wallet)
+	service := NewWalletService(repo)
+
+	ctx := context.Background()
+
+	done := make(chan repository.Wallet)
+	go func() {
+		changed, err := service.WaitForVersion(ctx, wallet.ID, 0)
+		assert.NoError(t, err)
+		done <- changed
+	}()
+
+	// Another instance writes; the change listener reports it.
+	time.Sleep(20 * time.Millisecond)
+	_, err := NewWalletService(repo).TopUpWalletBalance(ctx, wallet.ID, -30)
+	require.NoError(t, err)
+	service.ChangesMissed()
+
+	select {
+	case changed := <-done:
+		assert.Equal(t, int32(70), changed.Balance)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForVersion did not return after ChangesMissed")
+	}
+}
+
+func TestWalletService_WaitForVersion_Timeout(t *testing.T) {
+	wallet := repository.Wallet{ID: uuid.New(), Balance: 100, Version: 3}
+	service := NewWalletService(newFakeRepository(0, wallet))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	current, err := service.WaitForVersion(ctx, wallet.ID, 3)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, wallet, current)
+}
+
+func TestWalletService_WaitForVersion_NotFound(t *testing.T) {
+	service := NewWalletService(newFakeRepository(0))
+
+	_, err := service.WaitForVersion(context.Background(), uuid.New(), -1)
+
+	assert.ErrorIs(t, err, ErrWalletNotFound)
+}
+
+func TestWalletService_WaitForVersion_ManyWaiters(t *testing.T) {
+	wallet := repository.Wallet{ID: uuid.New(), Balance: 100, Status: string(models.WalletStatusActive)}
+	service := NewWalletService(newFakeRepository(0, wallet))
+
+	ctx := context.Background()
+
+	const waiters = 50
+	done := make(chan int32, waiters)
+	for range waiters {
+		go func() {
+			changed, err := service.WaitForVersion(ctx, wallet.ID, 0)
+			assert.NoError(t, err)
+			done <- changed.Balance
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		service.watchers.mu.Lock()
+		defer service.watchers.mu.Unlock()
+		return len(service.watchers.watchers[wallet.ID]) == waiters
+	}, time.Second, time.Millisecond)
+
+	_, err := service.TopUpWalletBalance(ctx, wallet.ID, 1)
+	require.NoError(t, err)
+
+	for range waiters {
+		assert.Equal(t, int32(101), <-done)
+	}
+
+	service.watchers.mu.Lock()
+	defer service.watchers.mu.Unlock()
+	assert.Empty(t, service.watchers.watchers)
+}